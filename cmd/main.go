@@ -2,6 +2,7 @@ package main
 
 import (
 	"context"
+	"expvar"
 	"fmt"
 	"log"
 	"net/http"
@@ -14,9 +15,21 @@ import (
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
 	"github.com/joho/godotenv"
+	"github.com/ngenohkevin/kuiper_admin/internal/chat"
+	"github.com/ngenohkevin/kuiper_admin/internal/cli"
 	"github.com/ngenohkevin/kuiper_admin/internal/database"
 	"github.com/ngenohkevin/kuiper_admin/internal/handlers"
+	"github.com/ngenohkevin/kuiper_admin/internal/jobs"
+	"github.com/ngenohkevin/kuiper_admin/internal/live"
+	"github.com/ngenohkevin/kuiper_admin/internal/mailer"
+	"github.com/ngenohkevin/kuiper_admin/internal/media"
 	custommiddleware "github.com/ngenohkevin/kuiper_admin/internal/middleware"
+	"github.com/ngenohkevin/kuiper_admin/internal/models"
+	"github.com/ngenohkevin/kuiper_admin/internal/secrets"
+	"github.com/ngenohkevin/kuiper_admin/internal/shipping"
+	"github.com/ngenohkevin/kuiper_admin/internal/storage"
+	"github.com/ngenohkevin/kuiper_admin/internal/storefront"
+	"github.com/ngenohkevin/kuiper_admin/internal/wms"
 )
 
 func main() {
@@ -25,6 +38,23 @@ func main() {
 		log.Println("No .env file found")
 	}
 
+	// Fill in secrets kept in files, Docker secrets or Vault rather than the environment
+	found := secrets.Load()
+
+	// Run a maintenance command instead of the server when one is given
+	if len(os.Args) > 1 {
+		os.Exit(cli.Run(os.Args[1:], os.Stdout, os.Stderr))
+	}
+
+	if !secrets.LogReport(found) {
+		log.Fatal("Required secrets are missing")
+	}
+	if store, err := storage.FromEnv(); err != nil {
+		log.Printf("Image uploads won't work until storage is configured: %v", err)
+	} else {
+		log.Printf("Storing uploads in %s storage at %s", store.Name(), store.BaseURL())
+	}
+
 	// Initialize the database connection
 	db, err := database.New()
 	if err != nil {
@@ -32,6 +62,24 @@ func main() {
 	}
 	defer db.Close()
 
+	if custommiddleware.TenantBaseDomain() != "" && database.PoolMode() == database.PoolModeTransaction {
+		log.Printf("Warning: tenants aren't served until DB_POOL_MODE is direct or session, since a transaction pooler doesn't keep their search_path")
+	}
+
+	// Tenants' schemas are migrated along with the main one
+	if os.Getenv("RUN_MIGRATIONS") == "true" {
+		if err := models.MigrateTenants(db, database.MigrationsDir); err != nil {
+			log.Printf("Error migrating tenant schemas: %v", err)
+		}
+	}
+
+	// Create the first admin account on a new deployment
+	if created, err := models.BootstrapAdminUser(db, os.Getenv("ADMIN_USERNAME"), os.Getenv("ADMIN_PASSWORD")); err != nil {
+		log.Printf("Error creating admin account from ADMIN_USERNAME: %v", err)
+	} else if created {
+		log.Printf("Created admin account %s from ADMIN_USERNAME", os.Getenv("ADMIN_USERNAME"))
+	}
+
 	// Initialize session manager
 	sessionManager := scs.New()
 	sessionManager.Lifetime = 24 * time.Hour // Set session lifetime
@@ -43,6 +91,8 @@ func main() {
 	r := chi.NewRouter()
 	r.Use(middleware.Logger)
 	r.Use(middleware.Recoverer)
+	// Requests on a tenant's subdomain use the tenant's schema from here on
+	r.Use(custommiddleware.Tenant(db))
 	// Custom method override middleware
 	r.Use(func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -55,7 +105,7 @@ func main() {
 		})
 	})
 	r.Use(sessionManager.LoadAndSave)
-	r.Use(custommiddleware.Auth(sessionManager))
+	r.Use(custommiddleware.Auth(db, sessionManager))
 
 	// Serve static files
 	fs := http.FileServer(http.Dir("./web/static"))
@@ -64,16 +114,76 @@ func main() {
 	// Initialize handlers with database connection and session manager
 	h := handlers.New(db, sessionManager)
 
+	// Start background jobs
+	jobsCtx, stopJobs := context.WithCancel(context.Background())
+	defer stopJobs()
+	jobs.Every(jobsCtx, "monitor-pool", db.Monitor.Interval(), jobs.MonitorPool(db))
+	// Jobs on the store's data run for the main schema and then each tenant's
+	jobs.Every(jobsCtx, "refresh-dashboard-stats", jobs.DashboardStatsInterval(), jobs.ForEachTenant(db, jobs.RefreshDashboardStats))
+	jobs.Every(jobsCtx, "purge-trash", time.Hour, jobs.ForEachTenant(db, jobs.PurgeTrash))
+	jobs.Every(jobsCtx, "purge-search-log", 24*time.Hour, jobs.ForEachTenant(db, jobs.PurgeSearchLog))
+	jobs.Every(jobsCtx, "purge-view-sessions", time.Hour, jobs.ForEachTenant(db, jobs.PurgeProductViewSessions))
+	jobs.Every(jobsCtx, jobs.RetentionJob, jobs.RetentionInterval, jobs.ForEachTenant(db, jobs.ApplyRetention))
+	jobs.Every(jobsCtx, "detect-duplicates", 6*time.Hour, jobs.ForEachTenant(db, jobs.DetectDuplicates))
+	jobs.Every(jobsCtx, "validate-variants", 6*time.Hour, jobs.ForEachTenant(db, jobs.ValidateVariants))
+	jobs.Every(jobsCtx, "import-feeds", time.Minute, jobs.ForEachTenant(db, jobs.ImportFeeds))
+	mediaConfig, pipelineConfig := media.ConfigFromEnv(), media.PipelineConfigFromEnv()
+	jobs.Every(jobsCtx, "process-images", 15*time.Second, jobs.ForEachTenant(db, func(db *database.DB) func(ctx context.Context) error {
+		return jobs.ProcessImages(db, mediaConfig, pipelineConfig)
+	}))
+	jobs.Every(jobsCtx, "remove-orphaned-media", time.Hour, jobs.ForEachTenant(db, func(db *database.DB) func(ctx context.Context) error {
+		return jobs.RemoveOrphanedMedia(db, mediaConfig)
+	}))
+	anomalyThresholds, chatConfig := models.AnomalyThresholdsFromEnv(), chat.ConfigFromEnv()
+	jobs.Every(jobsCtx, "detect-anomalies", time.Minute, jobs.ForEachTenant(db, func(db *database.DB) func(ctx context.Context) error {
+		return jobs.DetectAnomalies(db, anomalyThresholds, chatConfig)
+	}))
+	// Order notifications run without email or a storefront endpoint too, logging what they couldn't send
+	mailConfig, storefrontConfig := mailer.ConfigFromEnv(), storefront.ConfigFromEnv()
+	jobs.Every(jobsCtx, "send-order-notifications", 30*time.Second, jobs.ForEachTenant(db, func(db *database.DB) func(ctx context.Context) error {
+		return jobs.SendOrderNotifications(db, mailConfig, storefrontConfig)
+	}))
+	if mailConfig.Enabled() {
+		jobs.Every(jobsCtx, "send-digests", 15*time.Minute, jobs.ForEachTenant(db, func(db *database.DB) func(ctx context.Context) error {
+			return jobs.SendDigests(db, mailConfig)
+		}))
+	}
+	if shippingConfig := shipping.ConfigFromEnv(); shippingConfig.Enabled() {
+		if _, err := shipping.New(shippingConfig); err != nil {
+			log.Printf("Shipping labels won't work until they are configured: %v", err)
+		} else {
+			jobs.Every(jobsCtx, "track-shipments", shippingConfig.TrackingInterval, jobs.ForEachTenant(db, func(db *database.DB) func(ctx context.Context) error {
+				return jobs.TrackShipments(db, shippingConfig)
+			}))
+		}
+	}
+	// The warehouse settings are the main store's, so its stock is the only stock synced with it
+	if wmsConfig := wms.ConfigFromEnv(); wmsConfig.Enabled() {
+		jobs.Every(jobsCtx, "sync-stock", wmsConfig.Interval, jobs.SyncStock(db, wmsConfig))
+	}
+
 	// Image proxy for external images (before auth middleware)
 	r.Get("/proxy/image", h.ImageProxy)
+	r.Get("/healthz", h.Healthz)
 
 	// Define routes
 	r.Route("/", func(r chi.Router) {
+		r.Use(h.LoadPreferences)
+		r.Use(h.ApplyTheme)
+		// Creates, updates and deletes go in the audit log
+		r.Use(h.AuditMutations)
+
 		// Auth routes
 		r.Get("/login", h.LoginPage)
 		r.Post("/login", h.Login)
 		r.Get("/logout", h.Logout)
 
+		// Signed preview links, open without signing in
+		r.Get("/preview/{token}", h.PreviewProduct)
+
+		// Inbound webhooks, signed by the sender instead
+		r.Post("/webhooks/storefront", h.StorefrontWebhook)
+
 		// Main app routes
 		r.Get("/", h.Home)
 
@@ -81,22 +191,73 @@ func main() {
 		r.Route("/categories", func(r chi.Router) {
 			r.Get("/", h.ListCategories)
 			r.Get("/new", h.NewCategoryForm)
+			r.Get("/export", h.ExportCategories)
 			r.Post("/", h.CreateCategory)
 			r.Get("/{id}", h.GetCategory)
 			r.Get("/{id}/edit", h.EditCategoryForm)
+			r.Get("/{id}/timeline", h.CategoryTimeline)
 			r.Put("/{id}", h.UpdateCategory)
 			r.Delete("/{id}", h.DeleteCategory)
+			r.Post("/{id}/restore", h.RestoreCategory)
 		})
 
 		// Products routes
 		r.Route("/products", func(r chi.Router) {
 			r.Get("/", h.ListProducts)
 			r.Get("/new", h.NewProductForm)
+			r.Get("/import", h.ImportProductsForm)
+			r.Get("/import/template.csv", h.ProductImportTemplate)
+			r.Get("/export", h.ExportProducts)
+			r.Post("/columns", h.SetProductColumns)
+			r.Post("/import", h.ImportProducts)
+			r.Get("/import/map", h.UploadMappingForm)
+			r.Post("/import/apply", h.ImportStoredUpload)
+			r.Delete("/import/mappings/{id}", h.DeleteImportMapping)
+			r.Get("/import/feeds", h.ImportFeeds)
+			r.Post("/import/feeds", h.CreateImportFeed)
+			r.Get("/import/feeds/{id}", h.ImportFeed)
+			r.Get("/import/feeds/{id}/mapping", h.FeedMappingForm)
+			r.Post("/import/feeds/{id}/mapping", h.SaveFeedMapping)
+			r.Post("/import/feeds/{id}/run", h.RunImportFeed)
+			r.Post("/import/feeds/{id}/toggle", h.ToggleImportFeed)
+			r.Delete("/import/feeds/{id}", h.DeleteImportFeed)
+			r.Get("/import/runs/{id}", h.ImportRunReport)
+			r.Get("/bulk/price", h.BulkPriceForm)
+			r.Post("/bulk/price", h.BulkChangePrices)
+			r.Get("/bulk/delete", h.BulkDeletePreview)
+			r.Post("/bulk/delete", h.BulkDeleteProducts)
+			r.Get("/compare", h.CompareProducts)
+			r.Get("/merge", h.MergeProductsForm)
+			r.Post("/merge", h.MergeProducts)
+			r.Get("/duplicates", h.DuplicateReport)
+			r.Post("/duplicates/refresh", h.RefreshDuplicateReport)
 			r.Post("/", h.CreateProduct)
 			r.Get("/{id}", h.GetProduct)
 			r.Get("/{id}/edit", h.EditProductForm)
+			r.Get("/{id}/qr.png", h.ProductQRCode)
 			r.Put("/{id}", h.UpdateProduct)
+			r.Get("/{id}/delete", h.DeleteProductConfirm)
 			r.Delete("/{id}", h.DeleteProduct)
+			r.Post("/{id}/restore", h.RestoreProduct)
+			r.Post("/{id}/archive", h.ArchiveProduct)
+			r.Post("/{id}/unarchive", h.UnarchiveProduct)
+			r.Post("/{id}/auto-availability", h.SetAutoAvailability)
+			r.Post("/{id}/preview-links", h.CreatePreviewLink)
+			r.Post("/{id}/images", h.UploadProductImages)
+			r.Put("/{id}/images/alt", h.SetProductImageAlt)
+			r.Get("/{id}/images/jobs", h.ProductImageJobs)
+			r.Post("/{id}/images/process", h.ProcessProductImages)
+			r.Get("/{id}/faqs", h.ProductFAQs)
+			r.Post("/{id}/faqs", h.CreateProductFAQ)
+			r.Put("/{id}/faqs/{faqID}", h.UpdateProductFAQ)
+			r.Delete("/{id}/faqs/{faqID}", h.DeleteProductFAQ)
+			r.Get("/{id}/experiments", h.ProductExperiments)
+			r.Post("/{id}/experiments", h.CreateExperiment)
+			r.Post("/{id}/experiments/{experimentID}/start", h.StartExperiment)
+			r.Post("/{id}/experiments/{experimentID}/stop", h.StopExperiment)
+			r.Delete("/{id}/experiments/{experimentID}", h.DeleteExperiment)
+			r.Get("/{id}/timeline", h.ProductTimeline)
+			r.Get("/{id}/views", h.ProductViews)
 
 			// Product variants routes
 			r.Post("/{id}/bulk-variants", h.CreateBulkVariants)
@@ -104,23 +265,218 @@ func main() {
 			r.Get("/{id}/variants/{variantID}/edit", h.EditProductVariantForm)
 			r.Put("/{id}/variants/{variantID}", h.UpdateProductVariant)
 			r.Delete("/{id}/variants/{variantID}", h.DeleteProductVariant)
+			r.Post("/{id}/variants/{variantID}/restore", h.RestoreProductVariant)
+		})
+
+		// API routes, for signed-in admins or clients with an API token
+		r.Route("/api/v1", func(r chi.Router) {
+			r.Use(custommiddleware.APIToken(db, sessionManager))
+			r.Use(h.AuditMutations) // Again, to name the token in audit entries
+			r.Get("/products", h.ListProductsAPI)
+			r.Post("/products", h.CreateProductAPI)
+			r.Get("/products/{id}", h.GetProductAPI)
+			r.Put("/products/{id}", h.UpdateProductAPI)
+			r.Delete("/products/{id}", h.DeleteProductAPI)
+			r.Get("/products/{id}/variants/{variantID}/edit-form", h.GetVariantEditForm)
+			r.Put("/products/{id}/variants/{variantID}", h.UpdateVariantAPI)
+			// What shoppers send through the storefront, which storefront-scoped tokens may too
+			r.Post("/reviews", h.SubmitReviewAPI)
+			r.Post("/reviews/{id}/reports", h.ReportReviewAPI)
+			r.Post("/gift-cards/validate", h.ValidateGiftCardAPI)
+			r.Post("/gift-cards/redeem", h.RedeemGiftCardAPI)
+			r.Post("/backups", h.RecordBackupAPI)
+			r.Get("/segments", h.ListSegmentsAPI)
+			r.Get("/segments/{id}/members", h.SegmentMembers)
+			r.Get("/segments/{id}/export", h.ExportSegment)
+
+			// Read-only public catalog and product view reports, the only routes catalog-scoped
+			// tokens may call, and storefront-scoped ones besides the shopper routes above
+			r.Route("/catalog", func(r chi.Router) {
+				r.Get("/products", h.CatalogProducts)
+				r.Get("/products/{id}", h.CatalogProduct)
+				r.Get("/products/{id}/faqs", h.CatalogProductFAQs)
+				r.Get("/products/{id}/experiment", h.CatalogProductExperiment)
+				r.Get("/categories", h.CatalogCategories)
+				r.Get("/banners", h.CatalogBanners)
+				r.Get("/pages", h.CatalogPages)
+				r.Get("/pages/{slug}", h.CatalogPage)
+				r.Get("/stream", h.CatalogStockStream)
+				r.Post("/views", h.RecordProductViewsAPI)
+			})
+		})
+
+		// Preferences routes
+		r.Get("/preferences", h.GetPreferences)
+		r.Post("/preferences", h.UpdatePreferences)
+		r.Get("/preferences/digest", h.DigestPreview)
+		r.Post("/theme", h.ToggleTheme)
+
+		// Command palette (Ctrl+K) results
+		r.Get("/palette", h.Palette)
+		r.Get("/whats-new", h.WhatsNew)
+		r.Post("/favorites/{type}/{id}", h.SetFavorite)
+
+		// Changes other admins make, streamed as server-sent events, and who else is online
+		r.Get("/live", h.LiveUpdates)
+		r.Post("/presence", h.Presence)
+
+		// Notification center
+		r.Get("/notifications", h.Notifications)
+		r.Get("/notifications/unread", h.UnreadNotifications)
+
+		// Runtime counters, such as template render failures
+		r.Handle("/debug/vars", expvar.Handler())
+
+		// Settings routes
+		r.Route("/settings", func(r chi.Router) {
+			r.Get("/store", h.StoreSettings)
+			r.Post("/store", h.UpdateStoreSettings)
+			r.Get("/cache", h.CacheSettings)
+			r.Post("/cache/flush", h.FlushCache)
+			r.Get("/database", h.DatabaseSettings)
+			r.Get("/diagnostics", h.Diagnostics)
+			r.Get("/backups", h.Backups)
+			r.Post("/backups", h.RecordBackup)
+			r.Get("/jobs", h.Jobs)
+			r.Get("/search", h.SearchSettings)
+			r.Post("/search/synonyms", h.CreateSearchSynonym)
+			r.Delete("/search/synonyms/{id}", h.DeleteSearchSynonym)
+			r.Post("/search/stop-words", h.SaveSearchStopWords)
+			r.Get("/search/report", h.SearchReport)
+			r.Get("/weight-presets", h.WeightPresets)
+			r.Post("/weight-presets", h.CreateWeightPreset)
+			r.Delete("/weight-presets/{id}", h.DeleteWeightPreset)
+			r.Route("/stock-sync", func(r chi.Router) {
+				// The warehouse settings are the main store's
+				r.Use(custommiddleware.MainHostOnly)
+				r.Get("/", h.StockSyncSettings)
+				r.Post("/run", h.RunStockSync)
+			})
+			r.Get("/order-notifications", h.OrderNotificationSettings)
+			r.Post("/order-notifications/{status}", h.SaveOrderStatusTemplate)
+			r.Get("/cleanup", h.OrphanChecks)
+			r.Post("/cleanup/{type}", h.CleanOrphans)
+			r.Get("/retention", h.RetentionSettings)
+			r.Post("/retention", h.SaveRetentionPolicies)
+			r.Post("/retention/{rule}/run", h.ApplyRetentionPolicy)
+			r.Get("/image-hosts", h.ImageHosts)
+			r.Post("/image-hosts", h.MigrateImageHosts)
+			r.Get("/image-proxy", h.ImageProxySettings)
+			r.Post("/image-proxy", h.SaveImageProxyProfile)
+			r.Post("/image-proxy/cache/clear", h.ClearImageCache)
+			r.Delete("/image-proxy/{id}", h.DeleteImageProxyProfile)
+			r.Get("/variant-report", h.VariantReport)
+			r.Post("/variant-report/refresh", h.RefreshVariantReport)
+			r.Post("/variant-report/{id}/fix", h.FixVariantIssue)
+			r.Get("/variant-storage", h.VariantStorage)
+			r.Post("/variant-storage/backfill", h.BackfillVariantStorage)
+			r.Get("/api-tokens", h.APITokens)
+			r.Post("/api-tokens", h.CreateAPIToken)
+			r.Put("/api-tokens/{id}", h.UpdateAPITokenLimits)
+			r.Delete("/api-tokens/{id}", h.RevokeAPIToken)
+			r.Get("/admins", h.AdminUsers)
+			r.Post("/admins", h.CreateAdminUser)
+			r.Put("/admins/{id}/password", h.ResetAdminPassword)
+			r.Post("/admins/{id}/disable", h.DisableAdminUser)
+			r.Post("/admins/{id}/enable", h.EnableAdminUser)
+			r.Route("/tenants", func(r chi.Router) {
+				// Tenants are managed from the main store only
+				r.Use(custommiddleware.MainHostOnly)
+				r.Get("/", h.Tenants)
+				r.Post("/", h.CreateTenant)
+				r.Post("/{id}/admins", h.CreateTenantAdmin)
+				r.Post("/{id}/migrate", h.MigrateTenant)
+				r.Post("/{id}/disable", h.DisableTenant)
+				r.Post("/{id}/enable", h.EnableTenant)
+			})
+		})
+
+		// Audit log of every create, update and delete
+		r.Get("/audit", h.AuditLog)
+
+		// Trash routes
+		r.Route("/trash", func(r chi.Router) {
+			r.Get("/", h.ListTrash)
+			r.Post("/{type}/{id}/restore", h.RestoreTrashItem)
+			r.Delete("/{type}/{id}", h.PurgeTrashItem)
+		})
+
+		// Mobile quick stock routes
+		r.Route("/m", func(r chi.Router) {
+			r.Get("/stock", h.MobileStock)
+			r.Get("/stock/{id}", h.MobileStockProduct)
+			r.Post("/stock/{id}/adjust", h.AdjustMobileStock)
+		})
+
+		// Banners routes
+		r.Route("/banners", func(r chi.Router) {
+			r.Get("/", h.ListBanners)
+			r.Get("/new", h.NewBannerForm)
+			r.Post("/", h.CreateBanner)
+			r.Get("/{id}/edit", h.EditBannerForm)
+			r.Put("/{id}", h.UpdateBanner)
+			r.Delete("/{id}", h.DeleteBanner)
 		})
 
-		// API Routes for variants - these need to be at the top level
-		r.Route("/api/v1/products", func(r chi.Router) {
-			r.Get("/{id}/variants/{variantID}/edit-form", h.GetVariantEditForm)
-			r.Put("/{id}/variants/{variantID}", h.UpdateVariantAPI)
+		// Promotions routes
+		r.Route("/promotions", func(r chi.Router) {
+			r.Get("/", h.ListPromotions)
+			r.Get("/new", h.NewPromotionForm)
+			r.Post("/", h.CreatePromotion)
+			r.Get("/{id}/edit", h.EditPromotionForm)
+			r.Put("/{id}", h.UpdatePromotion)
+			r.Delete("/{id}", h.DeletePromotion)
+		})
+
+		// Gift cards routes
+		r.Route("/gift-cards", func(r chi.Router) {
+			r.Get("/", h.ListGiftCards)
+			r.Post("/", h.IssueGiftCard)
+			r.Get("/{id}", h.GiftCard)
+			r.Post("/{id}/adjust", h.AdjustGiftCard)
+		})
+
+		// Content pages routes
+		r.Route("/pages", func(r chi.Router) {
+			r.Get("/", h.ListPages)
+			r.Get("/new", h.NewPageForm)
+			r.Post("/", h.CreatePage)
+			r.Post("/preview", h.PreviewPage)
+			r.Get("/{id}/edit", h.EditPageForm)
+			r.Put("/{id}", h.UpdatePage)
+			r.Delete("/{id}", h.DeletePage)
+			r.Get("/{id}/revisions/{revisionID}", h.PageRevision)
+			r.Post("/{id}/revisions/{revisionID}/restore", h.RestorePageRevision)
 		})
 
 		// Reviews routes
 		r.Route("/reviews", func(r chi.Router) {
 			r.Get("/", h.ListReviews)
 			r.Get("/new", h.NewReviewForm)
+			r.Get("/export", h.ExportReviews)
 			r.Post("/", h.CreateReview)
+			r.Get("/reports", h.ReviewReports)
+			r.Post("/reports/{id}/resolve", h.ResolveReviewReports)
+			r.Post("/reports/sessions/{id}/unban", h.UnbanSession)
 			r.Get("/{id}", h.GetReview)
 			r.Get("/{id}/edit", h.EditReviewForm)
+			r.Get("/{id}/timeline", h.ReviewTimeline)
 			r.Put("/{id}", h.UpdateReview)
 			r.Delete("/{id}", h.DeleteReview)
+			r.Post("/{id}/restore", h.RestoreReview)
+			r.Post("/{id}/status", h.ModerateReview)
+		})
+
+		// Reports routes
+		r.Route("/reports", func(r chi.Router) {
+			r.Get("/profitability", h.Profitability)
+			r.Get("/profitability/export", h.ExportProfitability)
+			r.Get("/dead-stock", h.DeadStock)
+			r.Get("/dead-stock/export", h.ExportDeadStock)
+			r.Get("/categories", h.CategoryPerformance)
+			r.Get("/categories/{id}", h.CategoryPerformanceDetail)
+			r.Get("/wishlists", h.Wishlists)
+			r.Get("/wishlists/export", h.ExportWishlists)
 		})
 
 		// Sessions routes
@@ -131,6 +487,41 @@ func main() {
 			r.Put("/{id}", h.UpdateSession)
 			r.Delete("/{id}", h.DeleteSession)
 		})
+
+		// Orders routes
+		r.Route("/orders", func(r chi.Router) {
+			r.Get("/", h.ListOrders)
+			r.Get("/tracking", h.TrackingImportForm)
+			r.Post("/tracking", h.ImportTracking)
+			r.Post("/tracking/apply", h.ApplyTrackingImport)
+			r.Get("/tracking/template.csv", h.TrackingImportTemplate)
+			r.Get("/{id}", h.GetOrder)
+			r.Post("/{id}/status", h.SetOrderStatus)
+			r.Post("/{id}/notifications/{notificationID}/retry", h.RetryOrderNotification)
+			r.Post("/{id}/shipping/rates", h.ShippingRates)
+			r.Post("/{id}/shipping/labels", h.BuyShippingLabel)
+			r.Get("/{id}/timeline", h.OrderTimeline)
+		})
+
+		// Fulfillment routes
+		r.Route("/fulfillment", func(r chi.Router) {
+			r.Get("/", h.PickQueue)
+			r.Get("/{id}", h.PickOrder)
+			r.Post("/{id}/pack", h.PackOrder)
+			r.Post("/{id}/locations", h.SetPickLocation)
+		})
+
+		// Customer segments routes
+		r.Route("/segments", func(r chi.Router) {
+			r.Get("/", h.ListSegments)
+			r.Get("/new", h.NewSegmentForm)
+			r.Post("/", h.CreateSegment)
+			r.Get("/{id}", h.Segment)
+			r.Get("/{id}/edit", h.EditSegmentForm)
+			r.Put("/{id}", h.UpdateSegment)
+			r.Delete("/{id}", h.DeleteSegment)
+			r.Get("/{id}/export", h.ExportSegment)
+		})
 	})
 
 	// Create HTTP server
@@ -146,6 +537,7 @@ func main() {
 		WriteTimeout: 10 * time.Second,
 		IdleTimeout:  120 * time.Second,
 	}
+	srv.RegisterOnShutdown(live.Shutdown)
 
 	// Start server in a goroutine
 	go func() {
@@ -159,6 +551,7 @@ func main() {
 	stopChan := make(chan os.Signal, 1)
 	signal.Notify(stopChan, os.Interrupt, syscall.SIGTERM, syscall.SIGINT)
 	<-stopChan
+	stopJobs()
 
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
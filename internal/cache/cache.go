@@ -1,26 +1,68 @@
 package cache
 
 import (
+	"container/list"
+	"strings"
 	"sync"
 	"time"
 )
 
+// Default limits used by New
+const (
+	DefaultMaxEntries = 1000
+	DefaultMaxBytes   = 64 << 20 // 64 MB
+)
+
 // CacheItem represents a cached item with expiration
 type CacheItem struct {
 	Value      interface{}
 	Expiration time.Time
 }
 
-// Cache provides thread-safe in-memory caching
+// entry is what the LRU list holds for each key
+type entry struct {
+	key  string
+	item CacheItem
+	size int64
+}
+
+// counters tracks lookups and evictions for one key prefix
+type counters struct {
+	hits      uint64
+	misses    uint64
+	evictions uint64
+}
+
+// Cache provides thread-safe in-memory caching, bounded by entry count and
+// estimated size. When either limit is exceeded the least recently used
+// entries are evicted.
 type Cache struct {
-	items map[string]CacheItem
-	mutex sync.RWMutex
+	items      map[string]*list.Element
+	lru        *list.List // Front is most recently used
+	bytes      int64
+	maxEntries int
+	maxBytes   int64
+	counters   map[string]*counters
+	mutex      sync.RWMutex
+	done       chan struct{} // Closed by Stop
+	stopOnce   sync.Once
 }
 
-// New creates a new cache instance
+// New creates a new cache instance with the default limits
 func New() *Cache {
+	return NewWithLimits(DefaultMaxEntries, DefaultMaxBytes)
+}
+
+// NewWithLimits creates a new cache instance that holds at most maxEntries
+// items and roughly maxBytes of values. A limit of zero or less disables it.
+func NewWithLimits(maxEntries int, maxBytes int64) *Cache {
 	cache := &Cache{
-		items: make(map[string]CacheItem),
+		items:      make(map[string]*list.Element),
+		lru:        list.New(),
+		maxEntries: maxEntries,
+		maxBytes:   maxBytes,
+		counters:   make(map[string]*counters),
+		done:       make(chan struct{}),
 	}
 
 	// Start cleanup goroutine
@@ -31,46 +73,127 @@ func New() *Cache {
 
 // Set stores a value in the cache with TTL
 func (c *Cache) Set(key string, value interface{}, ttl time.Duration) {
+	// Size the value before taking the lock; encoding can be slow for large pages
+	size := int64(len(key)) + estimateSize(value)
+
 	c.mutex.Lock()
 	defer c.mutex.Unlock()
 
-	c.items[key] = CacheItem{
+	item := CacheItem{
 		Value:      value,
 		Expiration: time.Now().Add(ttl),
 	}
+
+	if el, exists := c.items[key]; exists {
+		e := el.Value.(*entry)
+		c.bytes += size - e.size
+		e.item = item
+		e.size = size
+		c.lru.MoveToFront(el)
+	} else {
+		c.items[key] = c.lru.PushFront(&entry{key: key, item: item, size: size})
+		c.bytes += size
+	}
+
+	c.evict()
 }
 
 // Get retrieves a value from the cache
 func (c *Cache) Get(key string) (interface{}, bool) {
-	c.mutex.RLock()
-	defer c.mutex.RUnlock()
+	// Takes the write lock: lookups update the LRU order and hit counters
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
 
-	item, exists := c.items[key]
+	stats := c.countersFor(key)
+
+	el, exists := c.items[key]
 	if !exists {
+		stats.misses++
 		return nil, false
 	}
 
-	if time.Now().After(item.Expiration) {
+	e := el.Value.(*entry)
+	if time.Now().After(e.item.Expiration) {
 		// Item expired, remove it
-		delete(c.items, key)
+		c.removeElement(el)
+		stats.misses++
 		return nil, false
 	}
 
-	return item.Value, true
+	c.lru.MoveToFront(el)
+	stats.hits++
+	return e.item.Value, true
 }
 
 // Delete removes a value from the cache
 func (c *Cache) Delete(key string) {
 	c.mutex.Lock()
 	defer c.mutex.Unlock()
-	delete(c.items, key)
+	if el, exists := c.items[key]; exists {
+		c.removeElement(el)
+	}
+}
+
+// DeletePrefix removes every value whose key starts with prefix
+func (c *Cache) DeletePrefix(prefix string) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	for key, el := range c.items {
+		if strings.HasPrefix(key, prefix) {
+			c.removeElement(el)
+		}
+	}
 }
 
 // Clear removes all items from the cache
 func (c *Cache) Clear() {
 	c.mutex.Lock()
 	defer c.mutex.Unlock()
-	c.items = make(map[string]CacheItem)
+	c.items = make(map[string]*list.Element)
+	c.lru.Init()
+	c.bytes = 0
+}
+
+// evict drops least recently used entries until the cache is within its limits.
+// Callers must hold the write lock.
+func (c *Cache) evict() {
+	for c.overLimit() {
+		el := c.lru.Back()
+		if el == nil {
+			return
+		}
+		c.countersFor(el.Value.(*entry).key).evictions++
+		c.removeElement(el)
+	}
+}
+
+// overLimit reports whether either limit is exceeded. Callers must hold the lock.
+func (c *Cache) overLimit() bool {
+	return (c.maxEntries > 0 && c.lru.Len() > c.maxEntries) ||
+		(c.maxBytes > 0 && c.bytes > c.maxBytes)
+}
+
+// removeElement unlinks an entry. Callers must hold the write lock.
+func (c *Cache) removeElement(el *list.Element) {
+	e := c.lru.Remove(el).(*entry)
+	delete(c.items, e.key)
+	c.bytes -= e.size
+}
+
+// countersFor returns the lookup counters for key's prefix. Callers must hold the write lock.
+func (c *Cache) countersFor(key string) *counters {
+	prefix := KeyPrefix(key)
+	stats, ok := c.counters[prefix]
+	if !ok {
+		stats = &counters{}
+		c.counters[prefix] = stats
+	}
+	return stats
+}
+
+// Stop ends the goroutine that removes expired items, once the cache is no longer used
+func (c *Cache) Stop() {
+	c.stopOnce.Do(func() { close(c.done) })
 }
 
 // cleanup periodically removes expired items
@@ -80,12 +203,14 @@ func (c *Cache) cleanup() {
 
 	for {
 		select {
+		case <-c.done:
+			return
 		case <-ticker.C:
 			c.mutex.Lock()
 			now := time.Now()
-			for key, item := range c.items {
-				if now.After(item.Expiration) {
-					delete(c.items, key)
+			for _, el := range c.items {
+				if now.After(el.Value.(*entry).item.Expiration) {
+					c.removeElement(el)
 				}
 			}
 			c.mutex.Unlock()
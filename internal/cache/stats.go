@@ -0,0 +1,107 @@
+package cache
+
+import (
+	"encoding/json"
+	"sort"
+	"strings"
+)
+
+// PrefixStats summarises the cache entries and lookups for one key prefix
+type PrefixStats struct {
+	Prefix    string `json:"prefix"`
+	Entries   int    `json:"entries"`
+	Bytes     int64  `json:"bytes"` // Estimated from the JSON encoding of each value
+	Hits      uint64 `json:"hits"`
+	Misses    uint64 `json:"misses"`
+	Evictions uint64 `json:"evictions"`
+}
+
+// HitRatio returns the fraction of lookups served from the cache
+func (s PrefixStats) HitRatio() float64 {
+	return hitRatio(s.Hits, s.Misses)
+}
+
+// Stats is a point-in-time snapshot of the whole cache
+type Stats struct {
+	Entries    int           `json:"entries"`
+	Bytes      int64         `json:"bytes"`
+	MaxEntries int           `json:"max_entries"`
+	MaxBytes   int64         `json:"max_bytes"`
+	Hits       uint64        `json:"hits"`
+	Misses     uint64        `json:"misses"`
+	Evictions  uint64        `json:"evictions"`
+	Prefixes   []PrefixStats `json:"prefixes"`
+}
+
+// HitRatio returns the fraction of lookups served from the cache
+func (s Stats) HitRatio() float64 {
+	return hitRatio(s.Hits, s.Misses)
+}
+
+func hitRatio(hits, misses uint64) float64 {
+	if hits+misses == 0 {
+		return 0
+	}
+	return float64(hits) / float64(hits+misses)
+}
+
+// KeyPrefix returns the part of a key before the first colon, which is how
+// entries are grouped for stats and flushing (e.g. "products")
+func KeyPrefix(key string) string {
+	if i := strings.Index(key, ":"); i >= 0 {
+		return key[:i]
+	}
+	return key
+}
+
+// Stats collects entry counts, size estimates, hit ratios and evictions per key prefix
+func (c *Cache) Stats() Stats {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+
+	byPrefix := make(map[string]*PrefixStats)
+	get := func(prefix string) *PrefixStats {
+		stats, ok := byPrefix[prefix]
+		if !ok {
+			stats = &PrefixStats{Prefix: prefix}
+			byPrefix[prefix] = stats
+		}
+		return stats
+	}
+
+	for key, el := range c.items {
+		stats := get(KeyPrefix(key))
+		stats.Entries++
+		stats.Bytes += el.Value.(*entry).size
+	}
+	for prefix, counts := range c.counters {
+		stats := get(prefix)
+		stats.Hits = counts.hits
+		stats.Misses = counts.misses
+		stats.Evictions = counts.evictions
+	}
+
+	total := Stats{MaxEntries: c.maxEntries, MaxBytes: c.maxBytes}
+	for _, stats := range byPrefix {
+		total.Entries += stats.Entries
+		total.Bytes += stats.Bytes
+		total.Hits += stats.Hits
+		total.Misses += stats.Misses
+		total.Evictions += stats.Evictions
+		total.Prefixes = append(total.Prefixes, *stats)
+	}
+	sort.Slice(total.Prefixes, func(i, j int) bool {
+		return total.Prefixes[i].Prefix < total.Prefixes[j].Prefix
+	})
+
+	return total
+}
+
+// estimateSize approximates the memory held by a cached value from its JSON encoding
+func estimateSize(value interface{}) int64 {
+	encoded, err := json.Marshal(value)
+	if err != nil {
+		return 0
+	}
+	return int64(len(encoded))
+}
@@ -0,0 +1,60 @@
+// Package chat posts the admin's alerts to a team chat channel through an incoming webhook.
+// Slack, Mattermost and Rocket.Chat webhooks take the {"text": ...} body it sends as it is;
+// Discord takes it on the webhook URL with /slack on the end.
+package chat
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// Config holds the chat webhook settings
+type Config struct {
+	WebhookURL string
+}
+
+// ConfigFromEnv reads CHAT_WEBHOOK_URL. Posting to chat is disabled while it's empty.
+func ConfigFromEnv() Config {
+	return Config{WebhookURL: strings.TrimSpace(os.Getenv("CHAT_WEBHOOK_URL"))}
+}
+
+// Enabled reports whether a webhook is configured
+func (c Config) Enabled() bool {
+	return c.WebhookURL != ""
+}
+
+// client posts to the webhook, giving up on a chat service that doesn't answer
+var client = &http.Client{Timeout: 10 * time.Second}
+
+// Post sends a message to the channel behind the webhook
+func (c Config) Post(ctx context.Context, text string) error {
+	body, err := json.Marshal(map[string]string{"text": text})
+	if err != nil {
+		return fmt.Errorf("error encoding chat message: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.WebhookURL, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("error creating chat request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("error posting to chat: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("chat webhook returned %s: %s", resp.Status, strings.TrimSpace(string(msg)))
+	}
+	return nil
+}
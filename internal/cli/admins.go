@@ -0,0 +1,46 @@
+package cli
+
+import (
+	"bufio"
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/ngenohkevin/kuiper_admin/internal/database"
+	"github.com/ngenohkevin/kuiper_admin/internal/models"
+)
+
+// stdin is where create-admin reads a password piped to it
+var stdin io.Reader = os.Stdin
+
+// createAdmin adds an account that can sign in to the dashboard. The password comes from
+// ADMIN_PASSWORD, or else the first line of standard input, so it stays out of the shell history.
+func createAdmin(ctx context.Context, db *database.DB, args []string, stdout, stderr io.Writer) error {
+	fs := flag.NewFlagSet("create-admin", flag.ContinueOnError)
+	positional, err := parseFlags(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(positional) != 1 {
+		return usageError{"expected one username"}
+	}
+
+	password := os.Getenv("ADMIN_PASSWORD")
+	if password == "" {
+		line, err := bufio.NewReader(stdin).ReadString('\n')
+		if err != nil && line == "" {
+			return usageError{"set ADMIN_PASSWORD or pipe the password on standard input"}
+		}
+		password = strings.TrimRight(line, "\r\n")
+	}
+
+	user, err := models.CreateAdminUser(db, positional[0], password, "command line")
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(stdout, "Created admin %s\n", user.Username)
+	return nil
+}
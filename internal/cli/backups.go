@@ -0,0 +1,36 @@
+package cli
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+
+	"github.com/ngenohkevin/kuiper_admin/internal/database"
+	"github.com/ngenohkevin/kuiper_admin/internal/models"
+)
+
+// recordBackup notes a backup that has just finished, for backup scripts to run afterwards so
+// bulk deletes and merges know how recent the last one is
+func recordBackup(ctx context.Context, db *database.DB, args []string, stdout, stderr io.Writer) error {
+	fs := flag.NewFlagSet("record-backup", flag.ContinueOnError)
+	failed := fs.Bool("failed", false, "record a backup that failed")
+	source := fs.String("source", "", "what took the backup, e.g. pg_dump")
+	note := fs.String("note", "", "anything worth knowing about it, such as where it's stored")
+	if positional, err := parseFlags(fs, args); err != nil {
+		return err
+	} else if len(positional) > 0 {
+		return usageError{"unexpected argument " + positional[0]}
+	}
+
+	run := models.BackupRun{Status: models.BackupSucceeded, Source: *source, Note: *note, RecordedBy: "command line"}
+	if *failed {
+		run.Status = models.BackupFailed
+	}
+	run, err := models.RecordBackup(db, run)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(stdout, "Recorded %s backup at %s\n", run.Status, run.FinishedAt.Format("2006-01-02 15:04:05"))
+	return nil
+}
@@ -0,0 +1,123 @@
+// Package cli runs maintenance tasks from the command line, for operators who script them:
+// exporting and importing products, changing prices in bulk, purging expired sessions,
+// applying data retention, reporting backups, creating admin accounts and migrating tenants'
+// schemas. It uses the same model code as the dashboard, against the database in DATABASE_URL.
+package cli
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+
+	"github.com/ngenohkevin/kuiper_admin/internal/database"
+)
+
+// Exit codes
+const (
+	exitOK    = 0
+	exitError = 1
+	exitUsage = 2
+)
+
+// command is one subcommand, such as "export products"
+type command struct {
+	name  string
+	usage string
+	run   func(ctx context.Context, db *database.DB, args []string, stdout, stderr io.Writer) error
+}
+
+// commands lists the subcommands in the order the usage shows them
+var commands = []command{
+	{"export products", "export products [--category ID] [--search TEXT] [--archived] [--format csv|xlsx|json] [--out FILE]", exportProducts},
+	{"import products", "import products FILE [--format auto|shopify|woocommerce|products|csv|json] [--mapping NAME] [--dry-run] [--all-or-nothing]", importProducts},
+	{"set-price", "set-price (--category ID|NAME | --all) (--percent N | --amount N | --set N) [--variants] [--dry-run]", setPrice},
+	{"purge-sessions", "purge-sessions --expired [--dry-run]", purgeSessions},
+	{"apply-retention", "apply-retention [--dry-run]", applyRetention},
+	{"record-backup", "record-backup [--failed] [--source NAME] [--note TEXT]", recordBackup},
+	{"create-admin", "create-admin USERNAME  (password from ADMIN_PASSWORD or standard input)", createAdmin},
+	{"migrate-tenants", "migrate-tenants [--tenant SUBDOMAIN]", migrateTenants},
+}
+
+// usageError is a mistake in how a command was called, answered with the usage
+type usageError struct{ message string }
+
+func (e usageError) Error() string { return e.message }
+
+// Run runs the subcommand in args and returns the process exit code. It connects to the
+// database only once the command is known, and stops when interrupted.
+func Run(args []string, stdout, stderr io.Writer) int {
+	if len(args) == 0 || args[0] == "help" || args[0] == "-h" || args[0] == "--help" {
+		printUsage(stdout)
+		return exitOK
+	}
+
+	cmd, rest, ok := findCommand(args)
+	if !ok {
+		fmt.Fprintf(stderr, "unknown command %q\n\n", strings.Join(args, " "))
+		printUsage(stderr)
+		return exitUsage
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	db, err := database.New()
+	if err != nil {
+		fmt.Fprintf(stderr, "error: %v\n", err)
+		return exitError
+	}
+	defer db.Close()
+
+	if err := cmd.run(ctx, db.WithContext(ctx), rest, stdout, stderr); err != nil {
+		if _, ok := err.(usageError); ok {
+			fmt.Fprintf(stderr, "error: %v\nusage: %s\n", err, cmd.usage)
+			return exitUsage
+		}
+		fmt.Fprintf(stderr, "error: %v\n", err)
+		return exitError
+	}
+	return exitOK
+}
+
+// findCommand matches the start of args to a command, returning the arguments after its name
+func findCommand(args []string) (command, []string, bool) {
+	for _, cmd := range commands {
+		words := strings.Fields(cmd.name)
+		if len(args) >= len(words) && strings.Join(args[:len(words)], " ") == cmd.name {
+			return cmd, args[len(words):], true
+		}
+	}
+	return command{}, nil, false
+}
+
+// printUsage lists the commands
+func printUsage(w io.Writer) {
+	fmt.Fprintln(w, "Run without arguments to start the dashboard, or run a maintenance command:")
+	fmt.Fprintln(w)
+	for _, cmd := range commands {
+		fmt.Fprintln(w, "  "+cmd.usage)
+	}
+}
+
+// parseFlags parses a command's flags, which may come before or after its positional
+// arguments, and returns the positional ones
+func parseFlags(fs *flag.FlagSet, args []string) ([]string, error) {
+	fs.SetOutput(io.Discard)
+	var positional []string
+	for {
+		if err := fs.Parse(args); err != nil {
+			return nil, usageError{err.Error()}
+		}
+		args = fs.Args()
+		if len(args) == 0 {
+			return positional, nil
+		}
+		positional = append(positional, args[0])
+		args = args[1:]
+	}
+}
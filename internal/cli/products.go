@@ -0,0 +1,315 @@
+package cli
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/ngenohkevin/kuiper_admin/internal/database"
+	"github.com/ngenohkevin/kuiper_admin/internal/importer"
+	"github.com/ngenohkevin/kuiper_admin/internal/models"
+	"github.com/ngenohkevin/kuiper_admin/internal/xlsx"
+)
+
+// exportProducts writes the products matching the filters as CSV or an Excel workbook, with the
+// dashboard export's standard columns and the SKU, or as a JSON array, to stdout or a file
+func exportProducts(ctx context.Context, db *database.DB, args []string, stdout, stderr io.Writer) error {
+	fs := flag.NewFlagSet("export products", flag.ContinueOnError)
+	category := fs.String("category", "", "only products in this category, by ID or name")
+	search := fs.String("search", "", "only products matching this search")
+	archived := fs.Bool("archived", false, "include archived products")
+	format := fs.String("format", "csv", "csv, xlsx or json")
+	out := fs.String("out", "", "file to write instead of stdout")
+	if positional, err := parseFlags(fs, args); err != nil {
+		return err
+	} else if len(positional) > 0 {
+		return usageError{"unexpected argument " + positional[0]}
+	}
+	if *format != "csv" && *format != "xlsx" && *format != "json" {
+		return usageError{"format must be csv, xlsx or json"}
+	}
+
+	export := models.ProductExport{Search: *search, IncludeArchived: *archived}
+	if *category != "" {
+		c, err := findCategory(db, *category)
+		if err != nil {
+			return err
+		}
+		export.CategoryID = c.ID
+	}
+
+	w := stdout
+	if *out != "" {
+		f, err := os.Create(*out)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		w = f
+	}
+
+	var count int
+	if *format == "json" {
+		io.WriteString(w, "[")
+		err := models.EachProductExport(db, export, func(p models.Product) error {
+			data, err := json.Marshal(p)
+			if err != nil {
+				return err
+			}
+			if count > 0 {
+				io.WriteString(w, ",\n")
+			}
+			count++
+			_, err = w.Write(data)
+			return err
+		})
+		if err != nil {
+			return err
+		}
+		io.WriteString(w, "]\n")
+	} else {
+		header := []string{"id", "name", "slug", "sku", "price", "stock_count", "is_available"}
+		var out interface{ Write([]string) error }
+		var finish func() error
+		if *format == "xlsx" {
+			workbook := xlsx.NewWriter(w, "Products")
+			workbook.WriteHeader(header)
+			out, finish = workbook, workbook.Close
+		} else {
+			table := csv.NewWriter(w)
+			table.Write(header)
+			out, finish = table, func() error { table.Flush(); return table.Error() }
+		}
+		err := models.EachProductExport(db, export, func(p models.Product) error {
+			count++
+			return out.Write([]string{p.ID, csvText(p.Name), p.Slug, csvText(p.SKU), p.Price.String(), strconv.Itoa(p.StockCount), strconv.FormatBool(p.IsAvailable)})
+		})
+		if err != nil {
+			return err
+		}
+		if err := finish(); err != nil {
+			return err
+		}
+	}
+
+	fmt.Fprintf(stderr, "Exported %d products\n", count)
+	return nil
+}
+
+// importProducts creates or updates products by slug from a Shopify or WooCommerce export, or
+// from a plain CSV or JSON file read through an import mapping saved in the dashboard
+func importProducts(ctx context.Context, db *database.DB, args []string, stdout, stderr io.Writer) error {
+	fs := flag.NewFlagSet("import products", flag.ContinueOnError)
+	format := fs.String("format", importer.FormatAuto, "auto, shopify, woocommerce, products, csv or json")
+	mappingName := fs.String("mapping", "", "saved import mapping to read a csv or json file with")
+	dryRun := fs.Bool("dry-run", false, "report what would change without writing anything")
+	allOrNothing := fs.Bool("all-or-nothing", false, "import every product in one transaction, or none if any fails")
+	positional, err := parseFlags(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(positional) != 1 {
+		return usageError{"give one file to import"}
+	}
+
+	f, err := os.Open(positional[0])
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	var products []models.ProductImport
+	if *format == importer.FormatCSV || *format == importer.FormatJSON {
+		if *mappingName == "" {
+			return usageError{"csv and json files need --mapping, the name of a mapping saved on the import page"}
+		}
+		mapping, err := findImportMapping(db, *mappingName)
+		if err != nil {
+			return err
+		}
+		products, err = importer.ParseMapped(*format, f, mapping.Mapping)
+		if err != nil {
+			return err
+		}
+	} else {
+		products, err = importer.Parse(*format, f)
+		if err != nil {
+			return err
+		}
+	}
+
+	var results []models.ImportRowResult
+	if *allOrNothing {
+		if results, err = models.ImportProductsTogether(db, products, *dryRun); err != nil {
+			return err
+		}
+	} else {
+		results = models.ImportProducts(db, products, *dryRun)
+	}
+
+	counts := map[string]int{}
+	for _, result := range results {
+		counts[result.Status]++
+		switch result.Status {
+		case models.ImportFailed:
+			fmt.Fprintf(stdout, "failed\t%s\t%s\n", result.Slug, result.Error)
+		case models.ImportCreated, models.ImportUpdated:
+			fmt.Fprintf(stdout, "%s\t%s\t%s\n", result.Status, result.Slug, strings.Join(result.Changes, ", "))
+		}
+	}
+
+	prefix := "Imported"
+	if *dryRun {
+		prefix = "Dry run, nothing written:"
+	}
+	fmt.Fprintf(stderr, "%s %d created, %d updated, %d unchanged, %d failed\n", prefix,
+		counts[models.ImportCreated], counts[models.ImportUpdated], counts[models.ImportUnchanged], counts[models.ImportFailed])
+	if counts[models.ImportSkipped] > 0 {
+		fmt.Fprintf(stderr, "Nothing was saved: %d products were skipped because others failed\n", counts[models.ImportSkipped])
+	}
+	if counts[models.ImportFailed] > 0 {
+		return fmt.Errorf("%d products failed to import", counts[models.ImportFailed])
+	}
+	return nil
+}
+
+// setPrice changes the prices of every live product in a category, or in the whole catalog,
+// like the bulk price change on the product list, and notes each change on its timeline
+func setPrice(ctx context.Context, db *database.DB, args []string, stdout, stderr io.Writer) error {
+	fs := flag.NewFlagSet("set-price", flag.ContinueOnError)
+	category := fs.String("category", "", "category to change, by ID or name")
+	all := fs.Bool("all", false, "change every product instead of one category")
+	percent := fs.String("percent", "", "raise or lower prices by this percentage, e.g. -10")
+	amount := fs.String("amount", "", "add this amount to prices, or subtract it when negative")
+	set := fs.String("set", "", "set every price to this amount")
+	variants := fs.Bool("variants", false, "change variant prices too")
+	dryRun := fs.Bool("dry-run", false, "show the new prices without writing them")
+	if positional, err := parseFlags(fs, args); err != nil {
+		return err
+	} else if len(positional) > 0 {
+		return usageError{"unexpected argument " + positional[0]}
+	}
+
+	if (*category == "") == !*all {
+		return usageError{"choose the products with either --category or --all"}
+	}
+
+	change := models.PriceChange{IncludeVariants: *variants}
+	var value string
+	for _, option := range []struct{ mode, value string }{
+		{models.PriceChangePercent, *percent},
+		{models.PriceChangeAmount, *amount},
+		{models.PriceChangeSet, *set},
+	} {
+		if option.value == "" {
+			continue
+		}
+		if change.Mode != "" {
+			return usageError{"give only one of --percent, --amount and --set"}
+		}
+		change.Mode, value = option.mode, option.value
+	}
+	if change.Mode == "" {
+		return usageError{"give the change with --percent, --amount or --set"}
+	}
+	var err error
+	if change.Value, err = strconv.ParseFloat(value, 64); err != nil {
+		return usageError{"the change must be a number"}
+	}
+
+	export := models.ProductExport{}
+	if *category != "" {
+		c, err := findCategory(db, *category)
+		if err != nil {
+			return err
+		}
+		export.CategoryID = c.ID
+	}
+	var ids []string
+	err = models.EachProductExport(db, export, func(p models.Product) error {
+		ids = append(ids, p.ID)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if len(ids) == 0 {
+		fmt.Fprintln(stderr, "No products to change")
+		return nil
+	}
+
+	rows, err := models.BulkChangePrices(db, ids, change, *dryRun)
+	if err != nil {
+		return err
+	}
+
+	failed := 0
+	for _, row := range rows {
+		name := row.ProductName
+		if row.VariantID != "" {
+			name += " / " + row.VariantName
+		}
+		line := fmt.Sprintf("%s\t%s → %s", name, row.OldPrice.Format(), row.NewPrice.Format())
+		if row.Error != "" {
+			line += "\t" + row.Error
+			failed++
+		}
+		fmt.Fprintln(stdout, line)
+	}
+
+	switch {
+	case failed > 0:
+		return fmt.Errorf("%d prices can't be changed that way; nothing was written", failed)
+	case *dryRun:
+		fmt.Fprintf(stderr, "Dry run, nothing written: %d prices would change\n", len(rows))
+	default:
+		if err := models.RecordActivity(db, models.PriceChangeActivity(rows)...); err != nil {
+			fmt.Fprintf(stderr, "warning: prices changed but not noted on product timelines: %v\n", err)
+		}
+		fmt.Fprintf(stderr, "Changed %d prices\n", len(rows))
+	}
+	return nil
+}
+
+// findCategory looks a category up by ID, or by name ignoring case
+func findCategory(db *database.DB, ref string) (models.Category, error) {
+	categories, err := models.GetAllCategories(db)
+	if err != nil {
+		return models.Category{}, err
+	}
+	for _, c := range categories {
+		if c.ID == ref || strings.EqualFold(c.Name, ref) || c.Slug == ref {
+			return c, nil
+		}
+	}
+	return models.Category{}, fmt.Errorf("no category %q", ref)
+}
+
+// findImportMapping looks a saved import mapping up by name, ignoring case
+func findImportMapping(db *database.DB, name string) (models.ImportMapping, error) {
+	mappings, err := models.GetImportMappings(db)
+	if err != nil {
+		return models.ImportMapping{}, err
+	}
+	for _, m := range mappings {
+		if strings.EqualFold(m.Name, name) {
+			return m, nil
+		}
+	}
+	return models.ImportMapping{}, fmt.Errorf("no import mapping named %q", name)
+}
+
+// csvText guards a free-text value against being read as a formula when the CSV is opened in
+// a spreadsheet, as the dashboard's exports do
+func csvText(s string) string {
+	if s != "" && strings.ContainsRune("=+-@\t\r", rune(s[0])) {
+		return "'" + s
+	}
+	return s
+}
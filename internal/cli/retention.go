@@ -0,0 +1,52 @@
+package cli
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+
+	"github.com/ngenohkevin/kuiper_admin/internal/database"
+	"github.com/ngenohkevin/kuiper_admin/internal/models"
+)
+
+// applyRetention applies the retention policies set under Settings → Data Retention now,
+// instead of waiting for the scheduled job, or with --dry-run reports what they would remove
+func applyRetention(ctx context.Context, db *database.DB, args []string, stdout, stderr io.Writer) error {
+	fs := flag.NewFlagSet("apply-retention", flag.ContinueOnError)
+	dryRun := fs.Bool("dry-run", false, "report what would be removed without changing anything")
+	if positional, err := parseFlags(fs, args); err != nil {
+		return err
+	} else if len(positional) > 0 {
+		return usageError{"unexpected argument " + positional[0]}
+	}
+
+	policies, err := models.GetRetentionPolicies(db)
+	if err != nil {
+		return err
+	}
+
+	for _, policy := range policies {
+		if !policy.Enabled() {
+			fmt.Fprintf(stdout, "%s: kept forever\n", policy.Label)
+			continue
+		}
+		if *dryRun {
+			preview, err := models.PreviewRetention(db, policy)
+			if err != nil {
+				return err
+			}
+			fmt.Fprintf(stdout, "%s: %d older than %d days (%s)\n", policy.Label, preview.Count, policy.Days, policy.Action)
+			continue
+		}
+		changed, err := models.ApplyRetention(db, policy)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(stdout, "%s: %d older than %d days (%s, done)\n", policy.Label, changed, policy.Days, policy.Action)
+	}
+	if *dryRun {
+		fmt.Fprintln(stdout, "Dry run, nothing changed")
+	}
+	return nil
+}
@@ -0,0 +1,38 @@
+package cli
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+
+	"github.com/ngenohkevin/kuiper_admin/internal/database"
+	"github.com/ngenohkevin/kuiper_admin/internal/models"
+)
+
+// purgeSessions deletes expired storefront sessions. --expired is required so the command
+// can't be read as deleting every session.
+func purgeSessions(ctx context.Context, db *database.DB, args []string, stdout, stderr io.Writer) error {
+	fs := flag.NewFlagSet("purge-sessions", flag.ContinueOnError)
+	expired := fs.Bool("expired", false, "delete the sessions that have expired")
+	dryRun := fs.Bool("dry-run", false, "count them without deleting anything")
+	if positional, err := parseFlags(fs, args); err != nil {
+		return err
+	} else if len(positional) > 0 {
+		return usageError{"unexpected argument " + positional[0]}
+	}
+	if !*expired {
+		return usageError{"only expired sessions can be purged; pass --expired"}
+	}
+
+	count, err := models.PurgeExpiredSessions(db, *dryRun)
+	if err != nil {
+		return err
+	}
+	if *dryRun {
+		fmt.Fprintf(stdout, "Dry run, nothing deleted: %d expired sessions would be purged\n", count)
+	} else {
+		fmt.Fprintf(stdout, "Purged %d expired sessions\n", count)
+	}
+	return nil
+}
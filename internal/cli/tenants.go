@@ -0,0 +1,56 @@
+package cli
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"slices"
+
+	"github.com/ngenohkevin/kuiper_admin/internal/database"
+	"github.com/ngenohkevin/kuiper_admin/internal/models"
+)
+
+// migrateTenants brings tenants' schemas up to date with the migrations, all of them or the one
+// named with --tenant, reporting the version each ends up at
+func migrateTenants(ctx context.Context, db *database.DB, args []string, stdout, stderr io.Writer) error {
+	fs := flag.NewFlagSet("migrate-tenants", flag.ContinueOnError)
+	only := fs.String("tenant", "", "subdomain of the one tenant to migrate")
+	if positional, err := parseFlags(fs, args); err != nil {
+		return err
+	} else if len(positional) > 0 {
+		return usageError{"unexpected argument " + positional[0]}
+	}
+
+	tenants, err := models.GetTenants(db)
+	if err != nil {
+		return err
+	}
+
+	failed := 0
+	for _, t := range tenants {
+		if *only != "" && t.Slug != *only {
+			continue
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		migrated, err := models.MigrateTenant(db, t, database.MigrationsDir)
+		if err != nil {
+			failed++
+			fmt.Fprintf(stderr, "%s (%s): %v\n", t.Slug, t.Schema, err)
+			continue
+		}
+		fmt.Fprintf(stdout, "%s (%s): at version %d\n", t.Slug, t.Schema, migrated.SchemaVersion)
+	}
+
+	switch {
+	case *only != "" && !slices.ContainsFunc(tenants, func(t models.Tenant) bool { return t.Slug == *only }):
+		return fmt.Errorf("no tenant on %s", *only)
+	case failed > 0:
+		return fmt.Errorf("%d of the tenants failed to migrate", failed)
+	case len(tenants) == 0:
+		fmt.Fprintln(stdout, "No tenants")
+	}
+	return nil
+}
@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"log"
 	"os"
+	"strconv"
 	"time"
 
 	"github.com/golang-migrate/migrate/v4"
@@ -16,9 +17,19 @@ import (
 	"github.com/ngenohkevin/kuiper_admin/internal/cache"
 )
 
+// MigrationsDir is where the migrations are read from, relative to the working directory
+const MigrationsDir = "migrations"
+
 type DB struct {
-	Pool  *pgxpool.Pool
-	Cache *cache.Cache
+	Pool     *pgxpool.Pool
+	Cache    *cache.Cache
+	Monitor  *PoolMonitor
+	Timeouts Timeouts
+	Schema   string // The tenant schema queries run in, empty for the main one
+
+	ctx     context.Context // Set by WithContext
+	url     string          // DATABASE_URL, for migrations and tenant pools
+	tenants *tenantPools    // Shared by the main DB and every tenant's
 }
 
 // New creates a new database connection
@@ -37,7 +48,28 @@ func New() (*DB, error) {
 		}
 	}
 
-	// Set up connection pool
+	poolConfig := PoolConfigFromEnv()
+	pool, err := openPool(dbURL, poolConfig, "")
+	if err != nil {
+		return nil, err
+	}
+
+	log.Println("Successfully connected to the database")
+	db := &DB{
+		Pool:     pool,
+		Cache:    newCache(),
+		Monitor:  &PoolMonitor{pool: pool, config: poolConfig},
+		Timeouts: TimeoutsFromEnv(),
+		url:      dbURL,
+		tenants:  &tenantPools{dbs: map[string]*DB{}},
+	}
+	db.tenants.main = db
+	return db, nil
+}
+
+// openPool connects a pool to the database, with its connections searching schema first when
+// one is given
+func openPool(dbURL string, poolConfig PoolConfig, schema string) (*pgxpool.Pool, error) {
 	config, err := pgxpool.ParseConfig(dbURL)
 	if err != nil {
 		return nil, fmt.Errorf("error parsing database config: %w", err)
@@ -49,11 +81,24 @@ func New() (*DB, error) {
 	// Disable prepared statements for PgBouncer/Supabase compatibility
 	config.ConnConfig.DefaultQueryExecMode = pgx.QueryExecModeSimpleProtocol
 
+	// Extensions stay in public, so it comes after the tenant's own schema. Each connection
+	// checks the server kept it, as a pooler that drops startup parameters wouldn't.
+	if schema != "" {
+		config.ConnConfig.RuntimeParams["search_path"] = pgx.Identifier{schema}.Sanitize() + ", public"
+		config.AfterConnect = func(ctx context.Context, conn *pgx.Conn) error {
+			var current string
+			if err := conn.QueryRow(ctx, `SELECT current_schema()`).Scan(&current); err != nil {
+				return fmt.Errorf("error checking search_path: %w", err)
+			}
+			if current != schema {
+				return fmt.Errorf("connection is in schema %q rather than %q: %w", current, schema, errTenantPooling)
+			}
+			return nil
+		}
+	}
+
 	// Set connection pool settings
-	config.MaxConns = 20
-	config.MinConns = 5
-	config.MaxConnLifetime = 30 * time.Minute
-	config.MaxConnIdleTime = 10 * time.Minute
+	poolConfig.apply(config)
 
 	// Create the connection pool
 	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
@@ -65,18 +110,36 @@ func New() (*DB, error) {
 	}
 
 	if err := pool.Ping(ctx); err != nil {
+		pool.Close()
 		return nil, fmt.Errorf("error connecting to database: %w", err)
 	}
+	return pool, nil
+}
 
-	log.Println("Successfully connected to the database")
-	return &DB{
-		Pool:  pool,
-		Cache: cache.New(),
-	}, nil
+// newCache creates the query cache, sized by CACHE_MAX_ENTRIES and CACHE_MAX_MB when set
+func newCache() *cache.Cache {
+	maxEntries := cache.DefaultMaxEntries
+	if s := os.Getenv("CACHE_MAX_ENTRIES"); s != "" {
+		if n, err := strconv.Atoi(s); err == nil {
+			maxEntries = n
+		}
+	}
+
+	maxBytes := int64(cache.DefaultMaxBytes)
+	if s := os.Getenv("CACHE_MAX_MB"); s != "" {
+		if n, err := strconv.Atoi(s); err == nil {
+			maxBytes = int64(n) << 20
+		}
+	}
+
+	return cache.NewWithLimits(maxEntries, maxBytes)
 }
 
-// Close closes the database connection
+// Close closes the database connection, and those of the tenants when db is the main one
 func (db *DB) Close() {
+	if db.Schema == "" && db.tenants != nil {
+		db.tenants.closeAll()
+	}
 	if db.Pool != nil {
 		db.Pool.Close()
 	}
@@ -84,7 +147,7 @@ func (db *DB) Close() {
 
 // RunMigrations runs the database migrations
 func runMigrations(dbURL string) error {
-	m, err := migrate.New("file://migrations", dbURL)
+	m, err := migrate.New("file://"+MigrationsDir, dbURL)
 	if err != nil {
 		return fmt.Errorf("error creating migration instance: %w", err)
 	}
@@ -0,0 +1,217 @@
+package database
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// poolSamplesKept is how many samples the monitor keeps for the diagnostics page, an hour at
+// the default interval
+const poolSamplesKept = 120
+
+// PoolConfig holds the connection pool settings and the thresholds the pool monitor alerts on
+type PoolConfig struct {
+	MaxConns        int32
+	MinConns        int32
+	MaxConnLifetime time.Duration
+	MaxConnIdleTime time.Duration
+	MonitorInterval time.Duration
+	SlowAcquire     time.Duration // Average wait for a connection over an interval that counts as slow
+}
+
+// PoolConfigFromEnv reads DB_MAX_CONNS, DB_MIN_CONNS, DB_MAX_CONN_LIFETIME_MINUTES,
+// DB_MAX_CONN_IDLE_MINUTES, DB_POOL_MONITOR_SECONDS and DB_SLOW_ACQUIRE_MS, keeping the
+// defaults for any that are unset or invalid
+func PoolConfigFromEnv() PoolConfig {
+	cfg := PoolConfig{
+		MaxConns:        20,
+		MinConns:        5,
+		MaxConnLifetime: 30 * time.Minute,
+		MaxConnIdleTime: 10 * time.Minute,
+		MonitorInterval: 30 * time.Second,
+		SlowAcquire:     100 * time.Millisecond,
+	}
+	if n, ok := positiveEnv("DB_MAX_CONNS"); ok {
+		cfg.MaxConns = int32(n)
+	}
+	if n, err := strconv.Atoi(os.Getenv("DB_MIN_CONNS")); err == nil && n >= 0 {
+		cfg.MinConns = int32(n)
+	}
+	if n, ok := positiveEnv("DB_MAX_CONN_LIFETIME_MINUTES"); ok {
+		cfg.MaxConnLifetime = time.Duration(n) * time.Minute
+	}
+	if n, ok := positiveEnv("DB_MAX_CONN_IDLE_MINUTES"); ok {
+		cfg.MaxConnIdleTime = time.Duration(n) * time.Minute
+	}
+	if n, ok := positiveEnv("DB_POOL_MONITOR_SECONDS"); ok {
+		cfg.MonitorInterval = time.Duration(n) * time.Second
+	}
+	if n, ok := positiveEnv("DB_SLOW_ACQUIRE_MS"); ok {
+		cfg.SlowAcquire = time.Duration(n) * time.Millisecond
+	}
+	cfg.MinConns = min(cfg.MinConns, cfg.MaxConns)
+	return cfg
+}
+
+// positiveEnv reads an environment variable as a whole number above zero
+func positiveEnv(name string) (int, bool) {
+	n, err := strconv.Atoi(os.Getenv(name))
+	if err != nil || n <= 0 {
+		return 0, false
+	}
+	return n, true
+}
+
+// apply sets the pool settings on a parsed pgx config
+func (c PoolConfig) apply(config *pgxpool.Config) {
+	config.MaxConns = c.MaxConns
+	config.MinConns = c.MinConns
+	config.MaxConnLifetime = c.MaxConnLifetime
+	config.MaxConnIdleTime = c.MaxConnIdleTime
+}
+
+// PoolSample is the pool's activity over one monitor interval
+type PoolSample struct {
+	At           time.Time     `json:"at"`
+	Acquires     int64         `json:"acquires"`      // Connections handed out during the interval
+	Waited       int64         `json:"waited"`        // Of those, how many had to wait for one to free up or open
+	Canceled     int64         `json:"canceled"`      // Acquires given up on, usually because the request timed out
+	AverageWait  time.Duration `json:"average_wait"`  // Average time to get a connection
+	NewConns     int64         `json:"new_conns"`     // Connections opened during the interval
+	AcquiredPeak int32         `json:"acquired_peak"` // Connections in use when the sample was taken
+	Slow         bool          `json:"slow"`
+}
+
+// PoolStats is the pool's state now, with its recent samples newest first
+type PoolStats struct {
+	Config            PoolConfig    `json:"config"`
+	TotalConns        int32         `json:"total_conns"`
+	AcquiredConns     int32         `json:"acquired_conns"`
+	IdleConns         int32         `json:"idle_conns"`
+	ConstructingConns int32         `json:"constructing_conns"`
+	AcquireCount      int64         `json:"acquire_count"`
+	WaitedCount       int64         `json:"waited_count"`
+	CanceledCount     int64         `json:"canceled_count"`
+	AverageWait       time.Duration `json:"average_wait"` // Since the server started
+	Samples           []PoolSample  `json:"samples"`
+	SlowSamples       int           `json:"slow_samples"`
+	Advice            []string      `json:"advice"`
+}
+
+// PoolMonitor samples the pool's counters on an interval so slow acquisitions can be spotted
+// and logged, and keeps the recent samples for the diagnostics page
+type PoolMonitor struct {
+	pool   *pgxpool.Pool
+	config PoolConfig
+
+	mu      sync.Mutex
+	last    *pgxpool.Stat
+	samples []PoolSample
+}
+
+// Interval is how often the monitor should be sampled
+func (m *PoolMonitor) Interval() time.Duration {
+	return m.config.MonitorInterval
+}
+
+// Sample records the pool's activity since the previous sample. The first call only takes the
+// starting point and returns ok false.
+func (m *PoolMonitor) Sample() (sample PoolSample, ok bool) {
+	stat := m.pool.Stat()
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	last := m.last
+	m.last = stat
+	if last == nil {
+		return PoolSample{}, false
+	}
+
+	sample = PoolSample{
+		At:           time.Now(),
+		Acquires:     stat.AcquireCount() - last.AcquireCount(),
+		Waited:       stat.EmptyAcquireCount() - last.EmptyAcquireCount(),
+		Canceled:     stat.CanceledAcquireCount() - last.CanceledAcquireCount(),
+		NewConns:     stat.NewConnsCount() - last.NewConnsCount(),
+		AcquiredPeak: stat.AcquiredConns(),
+	}
+	if sample.Acquires > 0 {
+		sample.AverageWait = (stat.AcquireDuration() - last.AcquireDuration()) / time.Duration(sample.Acquires)
+	}
+	sample.Slow = sample.AverageWait >= m.config.SlowAcquire || sample.Canceled > 0
+
+	m.samples = append(m.samples, sample)
+	if len(m.samples) > poolSamplesKept {
+		m.samples = m.samples[len(m.samples)-poolSamplesKept:]
+	}
+	return sample, true
+}
+
+// Stats reports the pool's state now with the monitor's recent samples and what to change
+// if they show it struggling
+func (m *PoolMonitor) Stats() PoolStats {
+	stat := m.pool.Stat()
+	stats := PoolStats{
+		Config:            m.config,
+		TotalConns:        stat.TotalConns(),
+		AcquiredConns:     stat.AcquiredConns(),
+		IdleConns:         stat.IdleConns(),
+		ConstructingConns: stat.ConstructingConns(),
+		AcquireCount:      stat.AcquireCount(),
+		WaitedCount:       stat.EmptyAcquireCount(),
+		CanceledCount:     stat.CanceledAcquireCount(),
+		Samples:           []PoolSample{},
+		Advice:            []string{},
+	}
+	if stats.AcquireCount > 0 {
+		stats.AverageWait = stat.AcquireDuration() / time.Duration(stats.AcquireCount)
+	}
+
+	m.mu.Lock()
+	for i := len(m.samples) - 1; i >= 0; i-- {
+		stats.Samples = append(stats.Samples, m.samples[i])
+	}
+	m.mu.Unlock()
+
+	stats.Advice = stats.advise()
+	return stats
+}
+
+// advise suggests pool settings to change from the recent samples. Waits while every connection
+// is in use mean the pool is too small; waits with connections to spare mean new ones are slow
+// to open, which warm connections avoid.
+func (s *PoolStats) advise() []string {
+	var saturated, opening int
+	for _, sample := range s.Samples {
+		if !sample.Slow {
+			continue
+		}
+		s.SlowSamples++
+		if sample.AcquiredPeak >= s.Config.MaxConns {
+			saturated++
+		} else if sample.NewConns > 0 {
+			opening++
+		}
+	}
+
+	var advice []string
+	if s.SlowSamples == 0 {
+		return advice
+	}
+	if saturated*2 >= s.SlowSamples {
+		advice = append(advice, fmt.Sprintf("Every connection was in use during most slow intervals. Raise DB_MAX_CONNS above %d if the database or PgBouncer allows more clients, or look for slow queries holding connections.", s.Config.MaxConns))
+	}
+	if opening*2 >= s.SlowSamples && s.Config.MinConns < s.Config.MaxConns {
+		advice = append(advice, fmt.Sprintf("Slow intervals mostly had to open new connections. Raise DB_MIN_CONNS above %d, or DB_MAX_CONN_IDLE_MINUTES, to keep more of them open.", s.Config.MinConns))
+	}
+	if len(advice) == 0 {
+		advice = append(advice, "Waits happened with connections to spare and none being opened, which points at the network or PgBouncer rather than the pool size.")
+	}
+	return advice
+}
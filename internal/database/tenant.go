@@ -0,0 +1,189 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// schemaPattern is what a tenant schema may be called: lowercase letters, digits and
+// underscores, starting with a letter, within Postgres's 63 character limit
+var schemaPattern = regexp.MustCompile(`^[a-z][a-z0-9_]{0,62}$`)
+
+// ValidSchema reports whether name can be a tenant schema, which rules out Postgres's own
+func ValidSchema(name string) bool {
+	return schemaPattern.MatchString(name) && name != "public" && name != "information_schema" && !strings.HasPrefix(name, "pg_")
+}
+
+// tenantPools holds the connection pools of the tenants that have been used since startup
+type tenantPools struct {
+	main *DB
+	mu   sync.Mutex
+	dbs  map[string]*DB
+}
+
+// closeAll closes every tenant's pool
+func (t *tenantPools) closeAll() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for schema, db := range t.dbs {
+		db.Pool.Close()
+		db.Cache.Stop()
+		delete(t.dbs, schema)
+	}
+}
+
+// Ways DATABASE_URL can reach Postgres, set with DB_POOL_MODE
+const (
+	PoolModeDirect      = "direct"      // Straight to Postgres
+	PoolModeSession     = "session"     // Through a pooler in session mode
+	PoolModeTransaction = "transaction" // Through a pooler in transaction mode, like Supabase's on port 6543
+)
+
+// PoolMode reads DB_POOL_MODE, how DATABASE_URL reaches Postgres. Unset, it is taken to be a
+// transaction pooler, which the connections are set up to work with.
+func PoolMode() string {
+	switch mode := strings.ToLower(strings.TrimSpace(os.Getenv("DB_POOL_MODE"))); mode {
+	case PoolModeDirect, PoolModeSession:
+		return mode
+	}
+	return PoolModeTransaction
+}
+
+// errTenantPooling is why tenants aren't served through a transaction pooler: it hands each
+// transaction whichever server connection is free, without the search_path the client
+// connected with, so a tenant's queries could run in another's schema
+var errTenantPooling = errors.New("tenant schemas need a direct or session-pooled database connection; set DB_POOL_MODE to direct or session once DATABASE_URL is one")
+
+// TenantPoolConfig is the pool settings of each tenant's pool: the main pool's, but with at most
+// TENANT_DB_MAX_CONNS connections (5) and none kept open while idle, since every tenant in use
+// holds a pool of its own
+func TenantPoolConfig() PoolConfig {
+	cfg := PoolConfigFromEnv()
+	cfg.MaxConns = 5
+	if n, ok := positiveEnv("TENANT_DB_MAX_CONNS"); ok {
+		cfg.MaxConns = int32(n)
+	}
+	cfg.MinConns = 0
+	return cfg
+}
+
+// ForSchema returns a DB whose queries run in a tenant's schema, connecting on first use. Each
+// tenant gets its own pool and its own query cache, so cached results never cross tenants. The
+// empty schema is the main one.
+func (db *DB) ForSchema(schema string) (*DB, error) {
+	if schema == "" {
+		return db.tenants.main, nil
+	}
+	if !ValidSchema(schema) {
+		return nil, fmt.Errorf("invalid tenant schema %q", schema)
+	}
+	if PoolMode() == PoolModeTransaction {
+		return nil, errTenantPooling
+	}
+
+	db.tenants.mu.Lock()
+	defer db.tenants.mu.Unlock()
+	if tenant, ok := db.tenants.dbs[schema]; ok {
+		return tenant, nil
+	}
+
+	poolConfig := TenantPoolConfig()
+	pool, err := openPool(db.url, poolConfig, schema)
+	if err != nil {
+		return nil, fmt.Errorf("tenant %s: %w", schema, err)
+	}
+	tenant := &DB{
+		Pool:     pool,
+		Cache:    newCache(),
+		Monitor:  &PoolMonitor{pool: pool, config: poolConfig},
+		Timeouts: db.Timeouts,
+		Schema:   schema,
+		url:      db.url,
+		tenants:  db.tenants,
+	}
+	db.tenants.dbs[schema] = tenant
+	return tenant, nil
+}
+
+// Main returns the main schema's DB, running queries under the same context as db
+func (db *DB) Main() *DB {
+	main := *db.tenants.main
+	main.ctx = db.ctx
+	return &main
+}
+
+// CloseSchema closes a tenant's pool, once it has been disabled. It reconnects if used again.
+func (db *DB) CloseSchema(schema string) {
+	db.tenants.mu.Lock()
+	defer db.tenants.mu.Unlock()
+	if tenant, ok := db.tenants.dbs[schema]; ok {
+		tenant.Pool.Close()
+		tenant.Cache.Stop()
+		delete(db.tenants.dbs, schema)
+	}
+}
+
+// MigrateSchema creates a tenant's schema if it doesn't exist yet and applies the migrations to
+// it, which keep their own record of what has run in the schema. Tables are created in the
+// tenant's schema; extensions already in public are used from there.
+func (db *DB) MigrateSchema(schema string) error {
+	if !ValidSchema(schema) {
+		return fmt.Errorf("invalid tenant schema %q", schema)
+	}
+	if PoolMode() == PoolModeTransaction {
+		return errTenantPooling
+	}
+
+	ctx, cancel := db.Context(Bulk)
+	defer cancel()
+	if _, err := db.Pool.Exec(ctx, `CREATE SCHEMA IF NOT EXISTS `+pgx.Identifier{schema}.Sanitize()); err != nil {
+		return fmt.Errorf("error creating schema %s: %w", schema, err)
+	}
+
+	schemaURL, err := withSearchPath(db.url, schema)
+	if err != nil {
+		return err
+	}
+	if err := runMigrations(schemaURL); err != nil {
+		return fmt.Errorf("schema %s: %w", schema, err)
+	}
+	log.Printf("Migrated tenant schema %s", schema)
+	return nil
+}
+
+// withSearchPath adds a search_path to a postgres:// URL, which the migration driver passes on
+// to the server when it connects
+func withSearchPath(dbURL, schema string) (string, error) {
+	u, err := url.Parse(dbURL)
+	if err != nil || (u.Scheme != "postgres" && u.Scheme != "postgresql") {
+		return "", fmt.Errorf("tenant migrations need DATABASE_URL as a postgres:// URL")
+	}
+	q := u.Query()
+	q.Set("search_path", schema+",public")
+	u.RawQuery = q.Encode()
+	return u.String(), nil
+}
+
+type dbKey struct{}
+
+// NewContext returns a copy of ctx carrying db, the database of the request's tenant
+func NewContext(ctx context.Context, db *DB) context.Context {
+	return context.WithValue(ctx, dbKey{}, db)
+}
+
+// FromContext returns the database ctx carries, or fallback when it carries none
+func FromContext(ctx context.Context, fallback *DB) *DB {
+	if db, ok := ctx.Value(dbKey{}).(*DB); ok {
+		return db
+	}
+	return fallback
+}
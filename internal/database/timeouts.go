@@ -0,0 +1,82 @@
+package database
+
+import (
+	"context"
+	"time"
+)
+
+// Kinds of query, each with its own timeout
+type Operation int
+
+const (
+	Read  Operation = iota // Fetching one row or a handful, e.g. a record by ID
+	List                   // Pages, searches, reports and anything joining many rows
+	Write                  // Inserts, updates and deletes of a few rows, with their transaction
+	Bulk                   // Imports, merges, backfills and whole-catalog scans
+)
+
+// Timeouts holds how long each kind of query may take
+type Timeouts struct {
+	Read  time.Duration
+	List  time.Duration
+	Write time.Duration
+	Bulk  time.Duration
+}
+
+// TimeoutsFromEnv reads DB_TIMEOUT_READ_SECONDS, DB_TIMEOUT_LIST_SECONDS,
+// DB_TIMEOUT_WRITE_SECONDS and DB_TIMEOUT_BULK_SECONDS, keeping the defaults for any that are
+// unset or invalid
+func TimeoutsFromEnv() Timeouts {
+	t := Timeouts{
+		Read:  5 * time.Second,
+		List:  15 * time.Second,
+		Write: 10 * time.Second,
+		Bulk:  5 * time.Minute,
+	}
+	if n, ok := positiveEnv("DB_TIMEOUT_READ_SECONDS"); ok {
+		t.Read = time.Duration(n) * time.Second
+	}
+	if n, ok := positiveEnv("DB_TIMEOUT_LIST_SECONDS"); ok {
+		t.List = time.Duration(n) * time.Second
+	}
+	if n, ok := positiveEnv("DB_TIMEOUT_WRITE_SECONDS"); ok {
+		t.Write = time.Duration(n) * time.Second
+	}
+	if n, ok := positiveEnv("DB_TIMEOUT_BULK_SECONDS"); ok {
+		t.Bulk = time.Duration(n) * time.Second
+	}
+	return t
+}
+
+// For is the timeout of a kind of query
+func (t Timeouts) For(op Operation) time.Duration {
+	switch op {
+	case List:
+		return t.List
+	case Write:
+		return t.Write
+	case Bulk:
+		return t.Bulk
+	}
+	return t.Read
+}
+
+// WithContext returns a copy of db whose queries run under ctx, usually the request's, so they
+// stop when the client goes away and never outlast its deadline. The copy shares the pool and
+// cache.
+func (db *DB) WithContext(ctx context.Context) *DB {
+	scoped := *db
+	scoped.ctx = ctx
+	return &scoped
+}
+
+// Context starts the context for a query of the kind op: the db's own context, or the
+// background, limited to the configured timeout. A deadline the parent already has is kept when
+// it's sooner.
+func (db *DB) Context(op Operation) (context.Context, context.CancelFunc) {
+	parent := db.ctx
+	if parent == nil {
+		parent = context.Background()
+	}
+	return context.WithTimeout(parent, db.Timeouts.For(op))
+}
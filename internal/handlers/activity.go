@@ -0,0 +1,133 @@
+package handlers
+
+import (
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+	custommiddleware "github.com/ngenohkevin/kuiper_admin/internal/middleware"
+	"github.com/ngenohkevin/kuiper_admin/internal/models"
+	"github.com/ngenohkevin/kuiper_admin/internal/templates"
+)
+
+// timelineSize is how many entries an entity's timeline shows
+const timelineSize = 50
+
+// recordActivity adds an event to an entity's timeline, by the signed-in admin or the API token
+// the request was made with. The change it describes has already been made, so a failure is
+// logged rather than shown.
+func (h *Handler) recordActivity(r *http.Request, entityType, entityID, action, summary string) {
+	h.recordActivities(r, models.ActivityEvent{EntityType: entityType, EntityID: entityID, Action: action, Summary: summary})
+}
+
+// recordActivities adds several events at once, by whoever made the request
+func (h *Handler) recordActivities(r *http.Request, events ...models.ActivityEvent) {
+	actor := h.requestActor(r)
+	for i := range events {
+		events[i].Actor = actor
+	}
+	if err := models.RecordActivity(h.db(r), events...); err != nil {
+		log.Printf("Error recording activity: %v", err)
+	}
+}
+
+// requestActor names who made a request: the signed-in admin, else the API token it carried
+func (h *Handler) requestActor(r *http.Request) string {
+	if username := h.Session.GetString(r.Context(), "username"); username != "" {
+		return username
+	}
+	if token, ok := custommiddleware.APITokenFromContext(r.Context()); ok {
+		return "API token " + token.Name
+	}
+	return ""
+}
+
+// recordProductEdit notes what an edit changed on a product: its price, then everything else
+func (h *Handler) recordProductEdit(r *http.Request, before, after models.Product) {
+	var events []models.ActivityEvent
+	if before.Price != after.Price {
+		events = append(events, models.ActivityEvent{
+			EntityType: models.ActivityProduct, EntityID: after.ID, Action: models.ActivityPriceChanged,
+			Summary:   "Price " + before.Price.Format() + " → " + after.Price.Format(),
+			PriceDrop: models.PriceDrop(before.Price, after.Price),
+		})
+	}
+	if changes := models.ProductChanges(before, after); len(changes) > 0 {
+		events = append(events, models.ActivityEvent{
+			EntityType: models.ActivityProduct, EntityID: after.ID, Action: models.ActivityUpdated,
+			Summary: strings.Join(changes, "; "),
+		})
+	}
+	h.recordActivities(r, events...)
+	h.auditUpdate(r, models.ActivityProduct, after.ID, models.DiffFields(before, after))
+}
+
+// recordVariantEdit notes what an edit changed on a variant on its product's timeline. The
+// audit log has the changes on the product too, each field named after the variant, as in
+// "variants[500ml].price".
+func (h *Handler) recordVariantEdit(r *http.Request, before, after models.ProductVariant) {
+	var events []models.ActivityEvent
+	if before.Price != after.Price {
+		events = append(events, models.ActivityEvent{
+			EntityType: models.ActivityProduct, EntityID: before.ProductID, Action: models.ActivityPriceChanged,
+			Summary:   before.Name + ": price " + before.Price.Format() + " → " + after.Price.Format(),
+			PriceDrop: models.PriceDrop(before.Price, after.Price),
+		})
+	}
+	if changes := models.VariantChanges(before, after); len(changes) > 0 {
+		events = append(events, models.ActivityEvent{
+			EntityType: models.ActivityProduct, EntityID: before.ProductID, Action: models.ActivityUpdated,
+			Summary: strings.Join(changes, "; "),
+		})
+	}
+	h.recordActivities(r, events...)
+
+	changes := models.DiffFields(before, after)
+	for i := range changes {
+		changes[i].Field = "variants[" + before.Name + "]." + changes[i].Field
+	}
+	h.auditUpdate(r, models.ActivityProduct, before.ProductID, changes)
+}
+
+// recordPriceChanges notes each price a bulk change moved on its product's timeline
+func (h *Handler) recordPriceChanges(r *http.Request, rows []models.PriceChangeRow) {
+	h.recordActivities(r, models.PriceChangeActivity(rows)...)
+	h.audit(r, models.PriceChangeAudit(rows)...)
+}
+
+// ProductTimeline shows the activity timeline panel on a product page
+func (h *Handler) ProductTimeline(w http.ResponseWriter, r *http.Request) {
+	h.renderTimeline(w, r, models.ActivityProduct)
+}
+
+// CategoryTimeline shows the activity timeline panel on a category page
+func (h *Handler) CategoryTimeline(w http.ResponseWriter, r *http.Request) {
+	h.renderTimeline(w, r, models.ActivityCategory)
+}
+
+// ReviewTimeline shows the activity timeline panel on a review page
+func (h *Handler) ReviewTimeline(w http.ResponseWriter, r *http.Request) {
+	h.renderTimeline(w, r, models.ActivityReview)
+}
+
+// OrderTimeline shows the activity timeline panel on an order page: its status changes, the
+// labels bought for it and where their parcels have got to
+func (h *Handler) OrderTimeline(w http.ResponseWriter, r *http.Request) {
+	h.renderTimeline(w, r, models.ActivityOrder)
+}
+
+// renderTimeline shows the latest events on the entity in the URL, newest first
+func (h *Handler) renderTimeline(w http.ResponseWriter, r *http.Request, entityType string) {
+	events, err := models.GetTimeline(h.db(r), entityType, chi.URLParam(r, "id"), timelineSize)
+	if err != nil {
+		writeFailure(w, r, "getting activity", err)
+		return
+	}
+	if wantsJSON(r) {
+		writeList(w, r, models.SinglePage(events))
+		return
+	}
+
+	render(w, r, templates.ActivityTimeline(events, timelineSize))
+}
@@ -0,0 +1,120 @@
+package handlers
+
+import (
+	"net/http"
+	"net/url"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/ngenohkevin/kuiper_admin/internal/models"
+	"github.com/ngenohkevin/kuiper_admin/internal/templates"
+)
+
+// adminUsersFailed goes back to the accounts page with what went wrong, or answers with it
+// for JSON requests
+func adminUsersFailed(w http.ResponseWriter, r *http.Request, action string, err error) {
+	if wantsJSON(r) {
+		writeFailure(w, r, action, err)
+		return
+	}
+	http.Redirect(w, r, "/settings/admins?error="+url.QueryEscape(publicMessage(err, action)), http.StatusSeeOther)
+}
+
+// AdminUsers lists the accounts that can sign in to the dashboard
+func (h *Handler) AdminUsers(w http.ResponseWriter, r *http.Request) {
+	users, err := models.GetAdminUsers(h.db(r))
+	if err != nil {
+		writeFailure(w, r, "getting admin users", err)
+		return
+	}
+
+	if wantsJSON(r) {
+		writeList(w, r, models.SinglePage(users))
+		return
+	}
+
+	query := r.URL.Query()
+	render(w, r, templates.AdminUsers(users, h.Session.GetString(r.Context(), "username"), query.Get("notice"), query.Get("error")))
+}
+
+// CreateAdminUser adds an account with the username and password from the form
+func (h *Handler) CreateAdminUser(w http.ResponseWriter, r *http.Request) {
+	// Parse form
+	if err := r.ParseForm(); err != nil {
+		writeError(w, r, http.StatusBadRequest, "Error parsing form")
+		return
+	}
+
+	user, err := models.CreateAdminUser(h.db(r), r.FormValue("username"), r.FormValue("password"), h.Session.GetString(r.Context(), "username"))
+	if err != nil {
+		adminUsersFailed(w, r, "creating admin user", err)
+		return
+	}
+
+	if wantsJSON(r) {
+		writeJSON(w, http.StatusCreated, user)
+		return
+	}
+	http.Redirect(w, r, "/settings/admins?notice="+url.QueryEscape("Added "+user.Username), http.StatusSeeOther)
+}
+
+// ResetAdminPassword gives an account a new password
+func (h *Handler) ResetAdminPassword(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	if id == "" {
+		writeError(w, r, http.StatusBadRequest, "Missing admin user ID")
+		return
+	}
+
+	// Parse form
+	if err := r.ParseForm(); err != nil {
+		writeError(w, r, http.StatusBadRequest, "Error parsing form")
+		return
+	}
+
+	user, err := models.SetAdminUserPassword(h.db(r), id, r.FormValue("password"))
+	if err != nil {
+		adminUsersFailed(w, r, "changing admin password", err)
+		return
+	}
+
+	if wantsJSON(r) {
+		writeJSON(w, http.StatusOK, user)
+		return
+	}
+	http.Redirect(w, r, "/settings/admins?notice="+url.QueryEscape("Changed the password of "+user.Username), http.StatusSeeOther)
+}
+
+// DisableAdminUser stops an account from signing in and ends its sessions
+func (h *Handler) DisableAdminUser(w http.ResponseWriter, r *http.Request) {
+	h.setAdminUserDisabled(w, r, true)
+}
+
+// EnableAdminUser lets a disabled account sign in again
+func (h *Handler) EnableAdminUser(w http.ResponseWriter, r *http.Request) {
+	h.setAdminUserDisabled(w, r, false)
+}
+
+// setAdminUserDisabled turns an account off or back on
+func (h *Handler) setAdminUserDisabled(w http.ResponseWriter, r *http.Request, disabled bool) {
+	id := chi.URLParam(r, "id")
+	if id == "" {
+		writeError(w, r, http.StatusBadRequest, "Missing admin user ID")
+		return
+	}
+
+	user, err := models.SetAdminUserDisabled(h.db(r), id, disabled, h.Session.GetString(r.Context(), "username"))
+	if err != nil {
+		adminUsersFailed(w, r, "updating admin user", err)
+		return
+	}
+
+	if wantsJSON(r) {
+		writeJSON(w, http.StatusOK, user)
+		return
+	}
+	notice := "Enabled " + user.Username
+	if disabled {
+		notice = "Disabled " + user.Username
+	}
+	http.Redirect(w, r, "/settings/admins?notice="+url.QueryEscape(notice), http.StatusSeeOther)
+}
@@ -0,0 +1,131 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/ngenohkevin/kuiper_admin/internal/models"
+	"github.com/ngenohkevin/kuiper_admin/internal/templates"
+)
+
+// apiTokenUsageDays is how many days of usage the tokens page graphs
+const apiTokenUsageDays = 14
+
+// parseAPITokenLimits reads the rate limit and daily quota fields; blank means unlimited
+func parseAPITokenLimits(r *http.Request) (int, int, error) {
+	limits := make([]int, 2)
+	for i, field := range []string{"rate_limit", "daily_quota"} {
+		value := strings.TrimSpace(r.FormValue(field))
+		if value == "" {
+			continue
+		}
+		n, err := strconv.Atoi(value)
+		if err != nil {
+			return 0, 0, fmt.Errorf("%s must be a whole number", strings.ReplaceAll(field, "_", " "))
+		}
+		limits[i] = n
+	}
+	return limits[0], limits[1], nil
+}
+
+// renderAPITokens shows the tokens page, with a new token's secret when one was just created
+func (h *Handler) renderAPITokens(w http.ResponseWriter, r *http.Request, secret, formError string) {
+	tokens, err := models.GetAPITokens(h.db(r), apiTokenUsageDays)
+	if err != nil {
+		writeFailure(w, r, "getting API tokens", err)
+		return
+	}
+
+	if wantsJSON(r) {
+		writeList(w, r, models.SinglePage(tokens))
+		return
+	}
+
+	render(w, r, templates.APITokens(tokens, secret, formError))
+}
+
+// APITokens lists the API tokens with their limits and recent usage
+func (h *Handler) APITokens(w http.ResponseWriter, r *http.Request) {
+	h.renderAPITokens(w, r, "", r.URL.Query().Get("error"))
+}
+
+// CreateAPIToken creates a token and shows its secret once
+func (h *Handler) CreateAPIToken(w http.ResponseWriter, r *http.Request) {
+	// Parse form
+	if err := r.ParseForm(); err != nil {
+		writeError(w, r, http.StatusBadRequest, "Error parsing form")
+		return
+	}
+
+	rateLimit, dailyQuota, err := parseAPITokenLimits(r)
+	var token models.APIToken
+	var secret string
+	if err == nil {
+		token, secret, err = models.CreateAPIToken(h.db(r), r.FormValue("name"), r.FormValue("scope"), rateLimit, dailyQuota, h.Session.GetString(r.Context(), "username"))
+	}
+	if err != nil {
+		if wantsJSON(r) {
+			writeFailure(w, r, "creating API token", err)
+			return
+		}
+		http.Redirect(w, r, "/settings/api-tokens?error="+url.QueryEscape(publicMessage(err, "creating API token")), http.StatusSeeOther)
+		return
+	}
+
+	if wantsJSON(r) {
+		writeJSON(w, http.StatusCreated, map[string]interface{}{"token": token, "secret": secret})
+		return
+	}
+	h.renderAPITokens(w, r, secret, "")
+}
+
+// UpdateAPITokenLimits changes a token's rate limit and daily quota
+func (h *Handler) UpdateAPITokenLimits(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	if id == "" {
+		writeError(w, r, http.StatusBadRequest, "Missing token ID")
+		return
+	}
+
+	// Parse form
+	if err := r.ParseForm(); err != nil {
+		writeError(w, r, http.StatusBadRequest, "Error parsing form")
+		return
+	}
+
+	rateLimit, dailyQuota, err := parseAPITokenLimits(r)
+	if err == nil {
+		err = models.UpdateAPITokenLimits(h.db(r), id, rateLimit, dailyQuota)
+	}
+	if err != nil {
+		http.Redirect(w, r, "/settings/api-tokens?error="+url.QueryEscape(publicMessage(err, "updating API token")), http.StatusSeeOther)
+		return
+	}
+
+	http.Redirect(w, r, "/settings/api-tokens", http.StatusSeeOther)
+}
+
+// RevokeAPIToken stops a token from working
+func (h *Handler) RevokeAPIToken(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	if id == "" {
+		writeError(w, r, http.StatusBadRequest, "Missing token ID")
+		return
+	}
+
+	if err := models.RevokeAPIToken(h.db(r), id); err != nil {
+		writeFailure(w, r, "revoking API token", err)
+		return
+	}
+
+	if r.Header.Get("HX-Request") == "true" {
+		w.Header().Set("HX-Refresh", "true")
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+	http.Redirect(w, r, "/settings/api-tokens", http.StatusSeeOther)
+}
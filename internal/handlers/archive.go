@@ -0,0 +1,50 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/ngenohkevin/kuiper_admin/internal/models"
+)
+
+// ArchiveProduct handles the request to archive a product
+func (h *Handler) ArchiveProduct(w http.ResponseWriter, r *http.Request) {
+	h.setProductArchived(w, r, true)
+}
+
+// UnarchiveProduct handles the request to bring an archived product back
+func (h *Handler) UnarchiveProduct(w http.ResponseWriter, r *http.Request) {
+	h.setProductArchived(w, r, false)
+}
+
+// setProductArchived archives or unarchives the product in the URL and sends the admin back to it
+func (h *Handler) setProductArchived(w http.ResponseWriter, r *http.Request, archived bool) {
+	id := chi.URLParam(r, "id")
+	if id == "" {
+		writeError(w, r, http.StatusBadRequest, "Missing product ID")
+		return
+	}
+
+	var err error
+	if archived {
+		err = models.ArchiveProduct(h.db(r), id)
+	} else {
+		err = models.UnarchiveProduct(h.db(r), id)
+	}
+	if err != nil {
+		writeFailure(w, r, "updating product", err)
+		return
+	}
+	if archived {
+		h.recordActivity(r, models.ActivityProduct, id, models.ActivityArchived, "Archived")
+	} else {
+		h.recordActivity(r, models.ActivityProduct, id, models.ActivityUnarchived, "Unarchived")
+	}
+
+	if r.Header.Get("HX-Request") == "true" {
+		w.Header().Set("HX-Refresh", "true")
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+	http.Redirect(w, r, "/products/"+id, http.StatusSeeOther)
+}
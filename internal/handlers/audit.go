@@ -0,0 +1,272 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	chimiddleware "github.com/go-chi/chi/v5/middleware"
+	"github.com/ngenohkevin/kuiper_admin/internal/models"
+	"github.com/ngenohkevin/kuiper_admin/internal/templates"
+)
+
+// auditBodyLimit is the largest JSON request body whose fields go in the audit log
+const auditBodyLimit = 64 << 10
+
+// unauditedRoutes are the routes whose requests change nothing anyone needs to trace: signing
+// in, an admin's own preferences, calls that only read or quote, and what the storefront sends
+// on behalf of shoppers
+var unauditedRoutes = map[string]bool{
+	"/login":                       true,
+	"/webhooks/storefront":         true,
+	"/preferences":                 true,
+	"/theme":                       true,
+	"/favorites/{type}/{id}":       true,
+	"/presence":                    true,
+	"/products/columns":            true,
+	"/pages/preview":               true,
+	"/orders/{id}/shipping/rates":  true,
+	"/api/v1/reviews":              true,
+	"/api/v1/reviews/{id}/reports": true,
+	"/api/v1/gift-cards/validate":  true,
+	"/api/v1/catalog/views":        true,
+}
+
+// auditPrefixes are the route segments that group routes rather than name what they change
+var auditPrefixes = map[string]bool{"api": true, "v1": true, "settings": true, "m": true}
+
+type auditTrailKey struct{}
+
+// auditTrail collects what a request changed, as its handler describes it. r is the request as
+// the handler got it, carrying the API token it was authenticated with.
+type auditTrail struct {
+	r         *http.Request
+	described bool
+	entries   []models.AuditEntry
+}
+
+// AuditMutations is middleware that puts every create, update and delete in the audit log once
+// its handler is done. Handlers that know the fields they changed describe them with h.audit;
+// other requests are logged with the fields they sent. Failed requests and dry runs change
+// nothing, so they aren't logged. Routes behind their own authentication, like the API's bearer
+// tokens, use it again inside, so entries name the token.
+func (h *Handler) AuditMutations(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete:
+		default:
+			next.ServeHTTP(w, r)
+			return
+		}
+		if trail, ok := r.Context().Value(auditTrailKey{}).(*auditTrail); ok {
+			trail.r = r
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		var body []byte
+		if strings.HasPrefix(r.Header.Get("Content-Type"), "application/json") {
+			body, _ = io.ReadAll(io.LimitReader(r.Body, auditBodyLimit+1))
+			r.Body = io.NopCloser(io.MultiReader(bytes.NewReader(body), r.Body))
+		} else {
+			// As the method override does for POST, so PUT forms are parsed for both
+			r.ParseForm()
+		}
+
+		trail := &auditTrail{r: r}
+		ww := chimiddleware.NewWrapResponseWriter(w, r.ProtoMajor)
+		next.ServeHTTP(ww, r.WithContext(context.WithValue(r.Context(), auditTrailKey{}, trail)))
+
+		rctx := chi.RouteContext(r.Context())
+		if rctx == nil || unauditedRoutes[rctx.RoutePattern()] {
+			return
+		}
+		actor := h.requestActor(trail.r)
+		if actor == "" {
+			return
+		}
+
+		entries := trail.entries
+		if !trail.described {
+			if ww.Status() >= http.StatusBadRequest || r.Form.Get("dry_run") != "" {
+				return
+			}
+			entry := routeAuditEntry(rctx, r.Method)
+			if len(body) > 0 && len(body) <= auditBodyLimit {
+				entry.Changes = models.JSONChanges(body)
+			} else {
+				entry.Changes = models.FormChanges(r.PostForm)
+			}
+			entries = []models.AuditEntry{entry}
+		}
+		for i := range entries {
+			entries[i].Actor, entries[i].Method, entries[i].Path = actor, r.Method, r.URL.Path
+		}
+		if err := models.RecordAudit(h.db(r), entries...); err != nil {
+			log.Printf("Error recording audit log: %v", err)
+		}
+	})
+}
+
+// audit describes what a request changed, for the audit log. Called with no entries, it says
+// the request changed nothing. Outside AuditMutations the entries are written straight away.
+func (h *Handler) audit(r *http.Request, entries ...models.AuditEntry) {
+	if trail, ok := r.Context().Value(auditTrailKey{}).(*auditTrail); ok {
+		trail.described = true
+		trail.entries = append(trail.entries, entries...)
+		return
+	}
+
+	actor := h.requestActor(r)
+	for i := range entries {
+		entries[i].Actor, entries[i].Method, entries[i].Path = actor, r.Method, r.URL.Path
+	}
+	if err := models.RecordAudit(h.db(r), entries...); err != nil {
+		log.Printf("Error recording audit log: %v", err)
+	}
+}
+
+// auditCreate describes an entity a request created, with every field it was created with
+func (h *Handler) auditCreate(r *http.Request, entityType, entityID string, created interface{}) {
+	h.audit(r, models.AuditEntry{
+		EntityType: entityType, EntityID: entityID, Action: models.AuditCreate,
+		Changes: models.DiffFields(nil, created),
+	})
+}
+
+// auditUpdate describes an update to an entity by the fields it changed. An update that
+// changed none is left out of the log.
+func (h *Handler) auditUpdate(r *http.Request, entityType, entityID string, changes []models.AuditChange) {
+	if len(changes) == 0 {
+		h.audit(r)
+		return
+	}
+	h.audit(r, models.AuditEntry{EntityType: entityType, EntityID: entityID, Action: models.AuditUpdate, Changes: changes})
+}
+
+// routeAuditEntry works out what a request its handler didn't describe changed from the route
+// it matched: "/products/{id}/variants/{variantID}" updates the variant, a POST to a collection
+// such as "/settings/api-tokens" creates an API token, and "/settings/store" updates the store.
+func routeAuditEntry(rctx *chi.Context, method string) models.AuditEntry {
+	var static []string
+	var param, segment string
+	for _, s := range strings.Split(strings.Trim(rctx.RoutePattern(), "/"), "/") {
+		if name, ok := strings.CutPrefix(s, "{"); ok {
+			name, _, _ = strings.Cut(strings.TrimSuffix(name, "}"), ":")
+			param = name
+			if len(static) > 0 {
+				segment = static[len(static)-1]
+			}
+			continue
+		}
+		if s != "" && !auditPrefixes[s] {
+			static = append(static, s)
+		}
+	}
+
+	entry := models.AuditEntry{Action: models.AuditUpdate}
+	patterns := rctx.RoutePatterns
+	switch {
+	case method == http.MethodDelete:
+		entry.Action = models.AuditDelete
+	case method == http.MethodPost && len(patterns) > 0 && patterns[len(patterns)-1] == "/":
+		entry.Action = models.AuditCreate
+	case method == http.MethodPost && param == "" && len(static) > 0 && strings.HasSuffix(static[len(static)-1], "s"):
+		entry.Action = models.AuditCreate
+		segment = static[len(static)-1]
+	}
+
+	switch {
+	case rctx.URLParam("type") != "":
+		entry.EntityType = rctx.URLParam("type")
+	case segment != "":
+		entry.EntityType = segment
+	case len(static) > 0:
+		entry.EntityType = static[0]
+	default:
+		entry.EntityType = "admin"
+	}
+	entry.EntityType = singular(entry.EntityType)
+	if param != "" {
+		entry.EntityID = rctx.URLParam(param)
+	}
+	return entry
+}
+
+// singular turns a route's plural noun, as in "categories", into the entity it names
+func singular(noun string) string {
+	switch {
+	case strings.HasSuffix(noun, "ies"):
+		return strings.TrimSuffix(noun, "ies") + "y"
+	case strings.HasSuffix(noun, "ss"), strings.HasSuffix(noun, "us"):
+		return noun
+	}
+	return strings.TrimSuffix(noun, "s")
+}
+
+// auditRange reads the audit log's optional from and to dates, each a day in local time and to
+// taking in the whole of its day
+func auditRange(r *http.Request) (models.AuditFilter, error) {
+	var f models.AuditFilter
+	var err error
+	if s := r.URL.Query().Get("from"); s != "" {
+		if f.From, err = time.ParseInLocation("2006-01-02", s, time.Local); err != nil {
+			return f, fmt.Errorf("From isn't a valid date")
+		}
+	}
+	if s := r.URL.Query().Get("to"); s != "" {
+		day, err := time.ParseInLocation("2006-01-02", s, time.Local)
+		if err != nil {
+			return f, fmt.Errorf("To isn't a valid date")
+		}
+		f.To = day.AddDate(0, 0, 1)
+	}
+	if !f.From.IsZero() && !f.To.IsZero() && !f.From.Before(f.To) {
+		return f, fmt.Errorf("From must be on or before To")
+	}
+	return f, nil
+}
+
+// AuditLog lists who created, changed and deleted what, newest first, narrowed to an entity
+// type, a search and a date range
+func (h *Handler) AuditLog(w http.ResponseWriter, r *http.Request) {
+	query := listQuery(r, "type", models.AuditSorts)
+	filter, err := auditRange(r)
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	result, err := models.GetAuditLog(h.db(r), query, filter)
+	if err != nil {
+		writeFailure(w, r, "getting audit log", err)
+		return
+	}
+	if wantsJSON(r) {
+		writeList(w, r, result)
+		return
+	}
+
+	types, err := models.AuditEntityTypes(h.db(r))
+	if err != nil {
+		writeFailure(w, r, "getting audit log", err)
+		return
+	}
+
+	state := templates.NewListState("/audit", "entries", "type", query, result)
+	state.Params = url.Values{}
+	for _, param := range []string{"from", "to"} {
+		if value := r.URL.Query().Get(param); value != "" {
+			state.Params.Set(param, value)
+		}
+	}
+	h.rememberList(r, "/audit")
+	render(w, r, templates.AuditLog(state, result.Data, types))
+}
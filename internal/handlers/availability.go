@@ -0,0 +1,40 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/ngenohkevin/kuiper_admin/internal/models"
+)
+
+// SetAutoAvailability handles the request to change what happens to the product's variants when they sell out
+func (h *Handler) SetAutoAvailability(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	if id == "" {
+		writeError(w, r, http.StatusBadRequest, "Missing product ID")
+		return
+	}
+
+	// Parse form
+	if err := r.ParseForm(); err != nil {
+		writeError(w, r, http.StatusBadRequest, "Invalid form data")
+		return
+	}
+
+	mode := r.FormValue("auto_availability")
+	if mode != "" && !models.IsAutoAvailabilityMode(mode) {
+		writeError(w, r, http.StatusBadRequest, "Invalid auto availability mode")
+		return
+	}
+
+	if err := models.SetAutoAvailability(h.db(r), id, mode); err != nil {
+		writeFailure(w, r, "updating product", err)
+		return
+	}
+
+	if r.Header.Get("HX-Request") == "true" {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	http.Redirect(w, r, "/products/"+id, http.StatusSeeOther)
+}
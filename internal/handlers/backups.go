@@ -0,0 +1,125 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	custommiddleware "github.com/ngenohkevin/kuiper_admin/internal/middleware"
+	"github.com/ngenohkevin/kuiper_admin/internal/models"
+	"github.com/ngenohkevin/kuiper_admin/internal/templates"
+)
+
+// Backups lists the backups reported so far and whether bulk deletes and merges will ask for
+// confirmation
+func (h *Handler) Backups(w http.ResponseWriter, r *http.Request) {
+	h.renderBackups(w, r, "")
+}
+
+// renderBackups shows the backups page, with formError above the form when the last backup
+// recorded from it was rejected
+func (h *Handler) renderBackups(w http.ResponseWriter, r *http.Request, formError string) {
+	runs, err := models.GetBackupRuns(h.db(r))
+	if err != nil {
+		writeFailure(w, r, "getting backups", err)
+		return
+	}
+	check, err := models.CheckBackup(h.db(r))
+	if err != nil {
+		writeFailure(w, r, "checking last backup", err)
+		return
+	}
+
+	if wantsJSON(r) {
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"check":   check,
+			"stale":   check.Stale(),
+			"backups": runs,
+		})
+		return
+	}
+
+	if formError != "" {
+		w.WriteHeader(http.StatusUnprocessableEntity)
+	}
+	render(w, r, templates.Backups(runs, check, formError))
+}
+
+// RecordBackup notes a backup an admin took by hand
+func (h *Handler) RecordBackup(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		writeError(w, r, http.StatusBadRequest, "Invalid form data")
+		return
+	}
+
+	run := models.BackupRun{
+		Status:     r.FormValue("status"),
+		Source:     r.FormValue("source"),
+		Note:       r.FormValue("note"),
+		RecordedBy: h.Session.GetString(r.Context(), "username"),
+	}
+	if _, err := models.RecordBackup(h.db(r), run); err != nil {
+		h.renderBackups(w, r, publicMessage(err, "recording backup"))
+		return
+	}
+
+	http.Redirect(w, r, "/settings/backups", http.StatusSeeOther)
+}
+
+// backupReport is the body of POST /api/v1/backups
+type backupReport struct {
+	Status     string    `json:"status"` // succeeded or failed, succeeded when left out
+	Source     string    `json:"source"`
+	Note       string    `json:"note"`
+	FinishedAt time.Time `json:"finished_at"` // Now when left out
+}
+
+// RecordBackupAPI lets a backup job report each backup it takes, so the dashboard knows how
+// recent the last one is
+func (h *Handler) RecordBackupAPI(w http.ResponseWriter, r *http.Request) {
+	var body backupReport
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 64<<10)).Decode(&body); err != nil {
+		writeError(w, r, http.StatusBadRequest, "Invalid JSON body")
+		return
+	}
+
+	run := models.BackupRun{Status: body.Status, Source: body.Source, Note: body.Note, FinishedAt: body.FinishedAt}
+	if token, ok := custommiddleware.APITokenFromContext(r.Context()); ok {
+		run.RecordedBy = "API token " + token.Name
+	}
+	run, err := models.RecordBackup(h.db(r), run)
+	if err != nil {
+		writeFailure(w, r, "recording backup", err)
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, run)
+}
+
+// confirmBackup guards an operation that can't easily be undone. When the last successful
+// backup is older than models.BackupMaxAge, the request must carry acknowledge_backup=1, which
+// the confirmation pages ask for; otherwise it answers 428 and returns false. The check is
+// returned so the operation can note the acknowledgement in the activity history.
+func (h *Handler) confirmBackup(w http.ResponseWriter, r *http.Request) (models.BackupCheck, bool) {
+	check, err := models.CheckBackup(h.db(r))
+	if err != nil {
+		writeFailure(w, r, "checking last backup", err)
+		return check, false
+	}
+	if check.Stale() && r.FormValue("acknowledge_backup") != "1" {
+		writeError(w, r, http.StatusPreconditionRequired, check.Describe()+
+			", more than "+strconv.Itoa(int(check.MaxAge.Hours()))+" hours ago. Confirm you want to go ahead without a recent backup.")
+		return check, false
+	}
+	return check, true
+}
+
+// withBackupNote adds the backup acknowledgement to an activity summary when the operation
+// went ahead without a recent backup
+func withBackupNote(summary string, check models.BackupCheck) string {
+	if check.Stale() {
+		return summary + " (" + check.Acknowledged() + ")"
+	}
+	return summary
+}
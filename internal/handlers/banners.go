@@ -0,0 +1,223 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/ngenohkevin/kuiper_admin/internal/media"
+	"github.com/ngenohkevin/kuiper_admin/internal/models"
+	"github.com/ngenohkevin/kuiper_admin/internal/templates"
+)
+
+// catalogBannerFields are the banner fields the public catalog sends
+var catalogBannerFields = []string{"id", "title", "body", "image_url", "link_url", "placement", "starts_at", "ends_at"}
+
+// bannerCrumbs is the trail down to a banner
+func bannerCrumbs(banner models.Banner) []templates.Breadcrumb {
+	return []templates.Breadcrumb{
+		{Label: "Banners", URL: "/banners"},
+		{Label: banner.Title, URL: "/banners/" + banner.ID + "/edit"},
+	}
+}
+
+// parseDateTimeLocal reads a datetime-local input in the server's time zone, returning nil when
+// it is empty, which leaves that end of a banner's window open
+func parseDateTimeLocal(field, value string) (*time.Time, error) {
+	if value == "" {
+		return nil, nil
+	}
+	t, err := time.ParseInLocation("2006-01-02T15:04", value, time.Local)
+	if err != nil {
+		return nil, fmt.Errorf("%s isn't a valid date and time", field)
+	}
+	return &t, nil
+}
+
+// parseBanner reads a banner from the form, storing an uploaded image in place of the image URL.
+// JSON clients send the banner's fields, with RFC 3339 times.
+func parseBanner(r *http.Request) (models.Banner, error) {
+	banner := models.Banner{Enabled: true}
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "application/json") {
+		if err := json.NewDecoder(r.Body).Decode(&banner); err != nil {
+			return models.Banner{}, fmt.Errorf("Invalid JSON: expected the banner's fields")
+		}
+		return banner, nil
+	}
+
+	if err := r.ParseMultipartForm(32 << 20); err != nil && !errors.Is(err, http.ErrNotMultipart) {
+		return models.Banner{}, fmt.Errorf("Invalid form data")
+	}
+	banner.Title = r.FormValue("title")
+	banner.Body = r.FormValue("body")
+	banner.ImageURL = r.FormValue("image_url")
+	banner.LinkURL = r.FormValue("link_url")
+	banner.Placement = r.FormValue("placement")
+	banner.Enabled = r.FormValue("enabled") != ""
+
+	var err error
+	if banner.StartsAt, err = parseDateTimeLocal("Start", r.FormValue("starts_at")); err != nil {
+		return banner, err
+	}
+	if banner.EndsAt, err = parseDateTimeLocal("End", r.FormValue("ends_at")); err != nil {
+		return banner, err
+	}
+
+	if file, header, err := r.FormFile("image"); err == nil {
+		defer file.Close()
+		cfg := media.ConfigFromEnv()
+		if err := cfg.CheckSize(header.Size); err != nil {
+			return banner, err
+		}
+		data, err := io.ReadAll(io.LimitReader(file, cfg.MaxBytes+1))
+		if err != nil {
+			return banner, fmt.Errorf("error reading image: %w", err)
+		}
+		image, err := media.Save(r.Context(), cfg, data)
+		if err != nil {
+			return banner, err
+		}
+		banner.ImageURL = image.URL
+	}
+	return banner, nil
+}
+
+// ListBanners shows every banner with whether it is showing now
+func (h *Handler) ListBanners(w http.ResponseWriter, r *http.Request) {
+	banners, err := models.GetBanners(h.db(r))
+	if err != nil {
+		writeFailure(w, r, "getting banners", err)
+		return
+	}
+	if wantsJSON(r) {
+		writeList(w, r, models.SinglePage(banners))
+		return
+	}
+
+	ctx := withCrumbs(r, templates.Breadcrumb{Label: "Banners"})
+	render(w, r.WithContext(ctx), templates.BannerList(banners, time.Now()))
+}
+
+// NewBannerForm shows the form for a new banner
+func (h *Handler) NewBannerForm(w http.ResponseWriter, r *http.Request) {
+	ctx := withCrumbs(r, templates.Breadcrumb{Label: "Banners", URL: "/banners"}, templates.Breadcrumb{Label: "New"})
+	render(w, r.WithContext(ctx), templates.BannerForm(models.Banner{Enabled: true, Placement: models.BannerHomePromo}, ""))
+}
+
+// CreateBanner saves a new banner, showing the form again with the problem when it is invalid
+func (h *Handler) CreateBanner(w http.ResponseWriter, r *http.Request) {
+	banner, err := parseBanner(r)
+	if err == nil {
+		banner, err = models.CreateBanner(h.db(r), banner)
+	}
+	if err != nil {
+		h.bannerFormFailed(w, r, banner, "creating banner", err)
+		return
+	}
+
+	if wantsJSON(r) {
+		writeJSON(w, http.StatusCreated, banner)
+		return
+	}
+	http.Redirect(w, r, "/banners", http.StatusSeeOther)
+}
+
+// EditBannerForm shows the form for changing a banner
+func (h *Handler) EditBannerForm(w http.ResponseWriter, r *http.Request) {
+	banner, err := models.GetBannerByID(h.db(r), chi.URLParam(r, "id"))
+	if err != nil {
+		writeFailure(w, r, "getting banner", err)
+		return
+	}
+
+	ctx := withCrumbs(r, current(bannerCrumbs(banner))...)
+	render(w, r.WithContext(ctx), templates.BannerForm(banner, ""))
+}
+
+// UpdateBanner saves changes to a banner
+func (h *Handler) UpdateBanner(w http.ResponseWriter, r *http.Request) {
+	banner, err := parseBanner(r)
+	banner.ID = chi.URLParam(r, "id")
+	if err == nil {
+		banner, err = models.UpdateBanner(h.db(r), banner)
+	}
+	if err != nil {
+		h.bannerFormFailed(w, r, banner, "updating banner", err)
+		return
+	}
+
+	if wantsJSON(r) {
+		writeJSON(w, http.StatusOK, banner)
+		return
+	}
+	http.Redirect(w, r, "/banners", http.StatusSeeOther)
+}
+
+// bannerFormFailed shows the banner form again with what the admin entered and why it was
+// turned down. JSON clients and errors that aren't about the input get the usual error response.
+func (h *Handler) bannerFormFailed(w http.ResponseWriter, r *http.Request, banner models.Banner, action string, err error) {
+	status, _ := classifyError(err)
+	if wantsJSON(r) || (status != http.StatusBadRequest && status != http.StatusUnprocessableEntity) {
+		writeFailure(w, r, action, err)
+		return
+	}
+
+	crumbs := []templates.Breadcrumb{{Label: "Banners", URL: "/banners"}, {Label: "New"}}
+	if banner.ID != "" {
+		crumbs = current(bannerCrumbs(banner))
+	}
+	w.WriteHeader(http.StatusUnprocessableEntity)
+	render(w, r.WithContext(withCrumbs(r, crumbs...)), templates.BannerForm(banner, publicMessage(err, action)))
+}
+
+// DeleteBanner removes a banner
+func (h *Handler) DeleteBanner(w http.ResponseWriter, r *http.Request) {
+	if err := models.DeleteBanner(h.db(r), chi.URLParam(r, "id")); err != nil {
+		writeFailure(w, r, "deleting banner", err)
+		return
+	}
+
+	// For HTMX requests, just return 200 OK so the row is removed
+	if r.Header.Get("HX-Request") == "true" {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+	http.Redirect(w, r, "/banners", http.StatusSeeOther)
+}
+
+// CatalogBanners lists the banners showing on the storefront now, in one ?placement= or all
+func (h *Handler) CatalogBanners(w http.ResponseWriter, r *http.Request) {
+	placement := r.URL.Query().Get("placement")
+	if placement != "" && !models.ValidBannerPlacement(placement) {
+		writeError(w, r, http.StatusBadRequest, fmt.Sprintf("unknown placement %q", placement))
+		return
+	}
+	fields, err := catalogFields(r, catalogBannerFields)
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	banners, err := models.GetActiveBanners(h.db(r), placement, time.Now())
+	if err != nil {
+		writeFailure(w, r, "getting banners", err)
+		return
+	}
+
+	selected := make([]map[string]json.RawMessage, 0, len(banners))
+	for _, banner := range banners {
+		b, err := selectFields(banner, fields)
+		if err != nil {
+			writeFailure(w, r, "encoding banner", err)
+			return
+		}
+		selected = append(selected, b)
+	}
+
+	writeCatalogJSON(w, r, paginate(w, r, models.SinglePage(selected)))
+}
@@ -0,0 +1,82 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/ngenohkevin/kuiper_admin/internal/models"
+	"github.com/ngenohkevin/kuiper_admin/internal/templates"
+)
+
+// rememberList keeps the URL of the list page at path, with its search, filters and page, so
+// breadcrumbs and the redirects after an edit lead back to where the admin was
+func (h *Handler) rememberList(r *http.Request, path string) {
+	if r.Method == http.MethodGet && !wantsJSON(r) {
+		h.Session.Put(r.Context(), "list:"+path, r.URL.RequestURI())
+	}
+}
+
+// listURL is the last URL the admin viewed the list at path with, or path itself
+func (h *Handler) listURL(r *http.Request, path string) string {
+	if url := h.Session.GetString(r.Context(), "list:"+path); url != "" {
+		return url
+	}
+	return path
+}
+
+// withCrumbs returns the request's context carrying the breadcrumb trail for the page
+func withCrumbs(r *http.Request, crumbs ...templates.Breadcrumb) context.Context {
+	return templates.WithBreadcrumbs(r.Context(), crumbs...)
+}
+
+// productCrumbs is the trail down to a product: the product list, its category and the
+// product itself
+func (h *Handler) productCrumbs(r *http.Request, product models.Product) []templates.Breadcrumb {
+	crumbs := []templates.Breadcrumb{{Label: "Products", URL: h.listURL(r, "/products")}}
+	if product.Category != nil {
+		crumbs = append(crumbs, templates.Breadcrumb{Label: product.Category.Name, URL: "/products?category=" + product.Category.ID})
+	}
+	return append(crumbs, templates.Breadcrumb{Label: product.Name, URL: "/products/" + product.ID})
+}
+
+// categoryCrumbs is the trail down to a category through its parent, found in categories
+func (h *Handler) categoryCrumbs(r *http.Request, category models.Category, categories []models.Category) []templates.Breadcrumb {
+	crumbs := []templates.Breadcrumb{{Label: "Categories", URL: h.listURL(r, "/categories")}}
+	if category.ParentID != nil {
+		for _, parent := range categories {
+			if parent.ID == *category.ParentID {
+				crumbs = append(crumbs, templates.Breadcrumb{Label: parent.Name, URL: "/categories/" + parent.ID})
+				break
+			}
+		}
+	}
+	return append(crumbs, templates.Breadcrumb{Label: category.Name, URL: "/categories/" + category.ID})
+}
+
+// reviewCrumbs is the trail down to a review, named after the product it is about
+func (h *Handler) reviewCrumbs(r *http.Request, review models.Review) []templates.Breadcrumb {
+	label := "Review"
+	if review.Product != nil {
+		label = "Review of " + review.Product.Name
+	}
+	return []templates.Breadcrumb{
+		{Label: "Reviews", URL: h.listURL(r, "/reviews")},
+		{Label: label, URL: "/reviews/" + review.ID},
+	}
+}
+
+// sessionCrumbs is the trail down to a session
+func (h *Handler) sessionCrumbs(r *http.Request, session models.Session) []templates.Breadcrumb {
+	return []templates.Breadcrumb{
+		{Label: "Sessions", URL: h.listURL(r, "/sessions")},
+		{Label: session.ID, URL: "/sessions/" + session.ID},
+	}
+}
+
+// current marks the last step of a trail as the page being shown
+func current(crumbs []templates.Breadcrumb) []templates.Breadcrumb {
+	if len(crumbs) > 0 {
+		crumbs[len(crumbs)-1].URL = ""
+	}
+	return crumbs
+}
@@ -0,0 +1,167 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/ngenohkevin/kuiper_admin/internal/models"
+	"github.com/ngenohkevin/kuiper_admin/internal/templates"
+)
+
+// maxBulkProducts caps how many products one bulk operation can touch
+const maxBulkProducts = 200
+
+// bulkSelection reads the selected product IDs, writing an error response if there are none or too many
+func bulkSelection(w http.ResponseWriter, r *http.Request, ids []string) ([]string, bool) {
+	ids = uniqueIDs(ids)
+	if len(ids) == 0 || len(ids) > maxBulkProducts {
+		writeError(w, r, http.StatusBadRequest, fmt.Sprintf("Select between 1 and %d products", maxBulkProducts))
+		return nil, false
+	}
+	return ids, true
+}
+
+// BulkPriceForm shows the bulk price change form for the selected products
+func (h *Handler) BulkPriceForm(w http.ResponseWriter, r *http.Request) {
+	ids, ok := bulkSelection(w, r, r.URL.Query()["ids"])
+	if !ok {
+		return
+	}
+
+	render(w, r, templates.BulkPriceForm(ids, models.PriceChange{Mode: models.PriceChangePercent, IncludeVariants: true}, ""))
+}
+
+// BulkChangePrices previews or applies a price change to the selected products.
+// With dry_run set it only computes the new prices; nothing is written.
+func (h *Handler) BulkChangePrices(w http.ResponseWriter, r *http.Request) {
+	// Parse form
+	if err := r.ParseForm(); err != nil {
+		writeError(w, r, http.StatusBadRequest, "Invalid form data")
+		return
+	}
+
+	ids, ok := bulkSelection(w, r, r.Form["ids"])
+	if !ok {
+		return
+	}
+
+	change := models.PriceChange{
+		Mode:            r.FormValue("mode"),
+		IncludeVariants: r.FormValue("include_variants") != "",
+	}
+	value, err := strconv.ParseFloat(r.FormValue("value"), 64)
+	if err != nil {
+		w.WriteHeader(http.StatusUnprocessableEntity)
+		render(w, r, templates.BulkPriceForm(ids, change, "Enter a number for the change"))
+		return
+	}
+	change.Value = value
+
+	if err := change.Validate(); err != nil {
+		w.WriteHeader(http.StatusUnprocessableEntity)
+		render(w, r, templates.BulkPriceForm(ids, change, err.Error()))
+		return
+	}
+
+	dryRun := r.FormValue("dry_run") != ""
+	rows, err := models.BulkChangePrices(h.db(r), ids, change, dryRun)
+	if err != nil {
+		writeFailure(w, r, "changing prices", err)
+		return
+	}
+	if !dryRun {
+		h.recordPriceChanges(r, rows)
+	}
+
+	if wantsJSON(r) {
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"dry_run": dryRun,
+			"changes": rows,
+		})
+		return
+	}
+
+	render(w, r, templates.BulkPriceResult(ids, change, rows, dryRun))
+}
+
+// BulkDeletePreview lists what deleting the selected products would move to the trash, without deleting anything
+func (h *Handler) BulkDeletePreview(w http.ResponseWriter, r *http.Request) {
+	ids, ok := bulkSelection(w, r, r.URL.Query()["ids"])
+	if !ok {
+		return
+	}
+
+	rows, err := models.BulkDeleteProducts(h.db(r), ids, true)
+	if err != nil {
+		writeFailure(w, r, "previewing delete", err)
+		return
+	}
+	check, err := models.CheckBackup(h.db(r))
+	if err != nil {
+		writeFailure(w, r, "checking last backup", err)
+		return
+	}
+
+	if wantsJSON(r) {
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"dry_run":                  true,
+			"products":                 rows,
+			"backup_check":             check,
+			"needs_backup_acknowledge": check.Stale(),
+		})
+		return
+	}
+
+	render(w, r, templates.BulkDeletePreview(rows, check))
+}
+
+// BulkDeleteProducts moves the selected products to the trash
+func (h *Handler) BulkDeleteProducts(w http.ResponseWriter, r *http.Request) {
+	// Parse form
+	if err := r.ParseForm(); err != nil {
+		writeError(w, r, http.StatusBadRequest, "Invalid form data")
+		return
+	}
+
+	ids, ok := bulkSelection(w, r, r.Form["ids"])
+	if !ok {
+		return
+	}
+
+	check, ok := h.confirmBackup(w, r)
+	if !ok {
+		return
+	}
+
+	rows, err := models.BulkDeleteProducts(h.db(r), ids, false)
+	if err != nil {
+		writeFailure(w, r, "deleting products", err)
+		return
+	}
+
+	events := make([]models.ActivityEvent, len(rows))
+	deleted := make([]models.AuditEntry, len(rows))
+	for i, row := range rows {
+		events[i] = models.ActivityEvent{
+			EntityType: models.ActivityProduct, EntityID: row.ProductID, Action: models.ActivityDeleted,
+			Summary: withBackupNote("Moved to the trash in a bulk delete of "+strconv.Itoa(len(rows)), check),
+		}
+		deleted[i] = models.AuditEntry{
+			EntityType: models.ActivityProduct, EntityID: row.ProductID, Action: models.AuditDelete,
+			Changes: models.DiffFields(row, nil),
+		}
+	}
+	h.recordActivities(r, events...)
+	h.audit(r, deleted...)
+
+	if wantsJSON(r) {
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"dry_run":  false,
+			"products": rows,
+		})
+		return
+	}
+
+	http.Redirect(w, r, "/products", http.StatusSeeOther)
+}
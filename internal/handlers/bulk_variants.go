@@ -1,14 +1,15 @@
 package handlers
 
 import (
-	"fmt"
 	"log"
 	"net/http"
 	"strconv"
 	"strings"
 
+	"github.com/a-h/templ"
 	"github.com/go-chi/chi/v5"
 	"github.com/ngenohkevin/kuiper_admin/internal/models"
+	"github.com/ngenohkevin/kuiper_admin/internal/money"
 	"github.com/ngenohkevin/kuiper_admin/internal/templates"
 )
 
@@ -16,29 +17,39 @@ import (
 func (h *Handler) CreateBulkVariants(w http.ResponseWriter, r *http.Request) {
 	productID := chi.URLParam(r, "id")
 	if productID == "" {
-		http.Error(w, "Missing product ID", http.StatusBadRequest)
+		writeError(w, r, http.StatusBadRequest, "Missing product ID")
 		return
 	}
 
 	// Parse form
 	if err := r.ParseForm(); err != nil {
-		http.Error(w, "Invalid form data", http.StatusBadRequest)
+		writeError(w, r, http.StatusBadRequest, "Invalid form data")
 		return
 	}
 
 	weightsStr := r.FormValue("weights")
 
+	// A preset supplies its saved weight list
+	if presetID := r.FormValue("preset_id"); presetID != "" {
+		preset, err := models.GetWeightPresetByID(h.db(r), presetID)
+		if err != nil {
+			writeFailure(w, r, "getting weight preset", err)
+			return
+		}
+		weightsStr = preset.Weights
+	}
+
 	// Get the parent product
-	product, err := models.GetProductByID(h.DB, productID)
+	product, err := models.GetProductByID(h.db(r), productID)
 	if err != nil {
-		http.Error(w, fmt.Sprintf("Error getting product: %v", err), http.StatusInternalServerError)
+		writeFailure(w, r, "getting product", err)
 		return
 	}
 
 	// Parse weights from the comma-separated string
 	weights := strings.Split(weightsStr, ",")
 	if len(weights) == 0 {
-		http.Error(w, "No weights provided", http.StatusBadRequest)
+		writeError(w, r, http.StatusBadRequest, "No weights provided")
 		return
 	}
 
@@ -64,21 +75,19 @@ func (h *Handler) CreateBulkVariants(w http.ResponseWriter, r *http.Request) {
 			weightValue = 1.0
 		}
 
-		// Simple price calculation, adjust as needed
-		price := product.Price * (1 + (weightValue / 100))
-
-		// Round price to 2 decimal places
-		price = float64(int(price*100)) / 100
+		// Simple price calculation, adjust as needed: the weight is added as a percentage,
+		// rounded to the nearest cent
+		price := product.Price.Percent(weightValue)
 
 		// Create the variant
-		_, err = models.CreateProductVariant(h.DB, productID, name, price, 0, true)
+		_, err = models.CreateProductVariant(h.db(r), productID, name, price, 0, true)
 		if err != nil {
 			log.Printf("Error creating variant %s: %v", name, err)
 		}
 	}
 
 	// Ensure the product is marked as having variants
-	err = models.UpdateProductHasVariants(h.DB, productID, true)
+	err = models.UpdateProductHasVariants(h.db(r), productID, true)
 	if err != nil {
 		log.Printf("Warning: Error updating product has_variants flag: %v", err)
 	}
@@ -94,23 +103,23 @@ func (h *Handler) GetVariantEditForm(w http.ResponseWriter, r *http.Request) {
 
 	if productID == "" || variantID == "" {
 		log.Printf("Missing parameter - productID: %s, variantID: %s", productID, variantID)
-		http.Error(w, "Missing product ID or variant ID", http.StatusBadRequest)
+		writeError(w, r, http.StatusBadRequest, "Missing product ID or variant ID")
 		return
 	}
 
 	// Get the parent product
-	product, err := models.GetProductByID(h.DB, productID)
+	product, err := models.GetProductByID(h.db(r), productID)
 	if err != nil {
 		log.Printf("Error getting product %s: %v", productID, err)
-		http.Error(w, fmt.Sprintf("Error getting product: %v", err), http.StatusInternalServerError)
+		writeFailure(w, r, "getting product", err)
 		return
 	}
 
 	// Get the variant
-	variant, err := models.GetProductVariantByID(h.DB, variantID)
+	variant, err := models.GetProductVariantByID(h.db(r), variantID)
 	if err != nil {
 		log.Printf("Error getting variant %s: %v", variantID, err)
-		http.Error(w, fmt.Sprintf("Error getting product variant: %v", err), http.StatusInternalServerError)
+		writeFailure(w, r, "getting product variant", err)
 		return
 	}
 
@@ -118,13 +127,13 @@ func (h *Handler) GetVariantEditForm(w http.ResponseWriter, r *http.Request) {
 	if variant.ProductID != productID {
 		log.Printf("Variant %s does not belong to product %s (belongs to %s)",
 			variantID, productID, variant.ProductID)
-		http.Error(w, "Variant does not belong to the specified product", http.StatusBadRequest)
+		writeError(w, r, http.StatusBadRequest, "Variant does not belong to the specified product")
 		return
 	}
 
 	log.Printf("Rendering edit form for variant %s (name: %s) of product %s",
 		variant.ID, variant.Name, product.ID)
-	templates.VariantEditForm(product, variant).Render(r.Context(), w)
+	render(w, r, templates.VariantEditForm(product, variant))
 }
 
 // UpdateVariantAPI handles the API request to update a product variant
@@ -133,13 +142,13 @@ func (h *Handler) UpdateVariantAPI(w http.ResponseWriter, r *http.Request) {
 	variantID := chi.URLParam(r, "variantID")
 
 	if productID == "" || variantID == "" {
-		http.Error(w, "Missing product ID or variant ID", http.StatusBadRequest)
+		writeError(w, r, http.StatusBadRequest, "Missing product ID or variant ID")
 		return
 	}
 
 	// Parse form
 	if err := r.ParseForm(); err != nil {
-		http.Error(w, "Invalid form data", http.StatusBadRequest)
+		writeError(w, r, http.StatusBadRequest, "Invalid form data")
 		return
 	}
 
@@ -150,47 +159,64 @@ func (h *Handler) UpdateVariantAPI(w http.ResponseWriter, r *http.Request) {
 
 	// Validate required fields
 	if name == "" || priceStr == "" || stockCountStr == "" {
-		http.Error(w, "Name, price, and stock count are required", http.StatusBadRequest)
+		writeError(w, r, http.StatusBadRequest, "Name, price, and stock count are required")
 		return
 	}
 
 	// Parse numeric values
-	price, err := strconv.ParseFloat(priceStr, 64)
+	price, err := money.ParseInput(priceStr)
 	if err != nil {
-		http.Error(w, "Invalid price", http.StatusBadRequest)
+		writeError(w, r, http.StatusBadRequest, "Invalid price: "+err.Error())
 		return
 	}
 
 	stockCount, err := strconv.Atoi(stockCountStr)
 	if err != nil {
-		http.Error(w, "Invalid stock count", http.StatusBadRequest)
+		writeError(w, r, http.StatusBadRequest, "Invalid stock count")
 		return
 	}
 
 	// Handle is_available checkbox
 	isAvailable := isAvailableStr == "true"
 
+	orderOptions, hasOrderOptions, err := parseOrderOptions(r)
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	before, err := models.GetProductVariantByID(h.db(r), variantID)
+	if err != nil {
+		writeFailure(w, r, "getting product variant", err)
+		return
+	}
+
 	// Update the product variant
-	_, err = models.UpdateProductVariant(h.DB, variantID, name, price, stockCount, isAvailable)
+	variant, err := models.UpdateProductVariant(h.db(r), variantID, name, price, stockCount, isAvailable)
 	if err != nil {
-		http.Error(w, fmt.Sprintf("Error updating product variant: %v", err), http.StatusInternalServerError)
+		writeFailure(w, r, "updating product variant", err)
 		return
 	}
+	h.recordVariantEdit(r, before, variant)
+
+	if hasOrderOptions {
+		if err := models.SetVariantOrderOptions(h.db(r), productID, variantID, orderOptions); err != nil {
+			writeFailure(w, r, "saving order options", err)
+			return
+		}
+	}
 
 	// Get updated product for rendering updated variants
-	product, err := models.GetProductByID(h.DB, productID)
+	product, err := models.GetProductByID(h.db(r), productID)
 	if err != nil {
-		http.Error(w, fmt.Sprintf("Error getting updated product: %v", err), http.StatusInternalServerError)
+		writeFailure(w, r, "getting updated product", err)
 		return
 	}
 
 	// Render just the variants table rows for HTMX swap
-	w.Header().Set("Content-Type", "text/html")
-	for _, variant := range product.Variants {
-		err := templates.VariantRow(variant, productID).Render(r.Context(), w)
-		if err != nil {
-			http.Error(w, fmt.Sprintf("Error rendering variant row: %v", err), http.StatusInternalServerError)
-			return
-		}
+	rows := make([]templ.Component, len(product.Variants))
+	for i, variant := range product.Variants {
+		rows[i] = templates.VariantRow(variant, productID)
 	}
+	render(w, r, templ.Join(rows...))
 }
@@ -0,0 +1,39 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/ngenohkevin/kuiper_admin/internal/templates"
+)
+
+// CacheSettings shows cache entry counts, size estimates and hit ratios per key prefix
+func (h *Handler) CacheSettings(w http.ResponseWriter, r *http.Request) {
+	stats := h.db(r).Cache.Stats()
+
+	if wantsJSON(r) {
+		writeJSON(w, http.StatusOK, stats)
+		return
+	}
+
+	render(w, r, templates.CacheSettings(stats, r.URL.Query().Get("flushed")))
+}
+
+// FlushCache removes cached entries for the posted key prefix, or everything when no prefix is given
+func (h *Handler) FlushCache(w http.ResponseWriter, r *http.Request) {
+	// Parse form
+	if err := r.ParseForm(); err != nil {
+		writeError(w, r, http.StatusBadRequest, "Invalid form data")
+		return
+	}
+
+	prefix := r.FormValue("prefix")
+	flushed := "all"
+	if prefix == "" {
+		h.db(r).Cache.Clear()
+	} else {
+		h.db(r).Cache.DeletePrefix(prefix + ":")
+		flushed = prefix
+	}
+
+	http.Redirect(w, r, "/settings/cache?flushed="+flushed, http.StatusSeeOther)
+}
@@ -0,0 +1,222 @@
+package handlers
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/ngenohkevin/kuiper_admin/internal/models"
+	"github.com/ngenohkevin/kuiper_admin/internal/preview"
+)
+
+// catalogMaxAge is how long storefronts and shared caches may reuse a catalog response
+const catalogMaxAge = 60
+
+// Fields the public catalog exposes, in their JSON names. Admin-only fields such as
+// archived_at and variants_json are never sent.
+var (
+	catalogProductFields = []string{
+		"id", "category_id", "name", "slug", "description", "price", "image_urls", "images", "stock_count",
+		"is_available", "has_variants", "created_at", "updated_at", "category", "variants",
+		"variant_summary", "backorder", "preorder", "expected_at", "sale",
+	}
+	catalogCategoryFields = []string{"id", "name", "slug", "parent_id", "created_at"}
+)
+
+// catalogFields reads ?fields=name,price into the set of fields to send, all of allowed when the
+// parameter is absent. The id is always sent.
+func catalogFields(r *http.Request, allowed []string) (map[string]bool, error) {
+	fields := make(map[string]bool)
+	param := r.URL.Query().Get("fields")
+	if param == "" {
+		for _, field := range allowed {
+			fields[field] = true
+		}
+		return fields, nil
+	}
+
+	fields["id"] = true
+	for _, field := range strings.Split(param, ",") {
+		field = strings.TrimSpace(field)
+		if field == "" {
+			continue
+		}
+		if !slices.Contains(allowed, field) {
+			return nil, fmt.Errorf("unknown field %q", field)
+		}
+		fields[field] = true
+	}
+	return fields, nil
+}
+
+// catalogWithVariants decides whether products carry their variants. They do when variants is
+// in the requested fields, by default on a single product and not on lists; ?include=variants
+// and ?exclude=variants override that.
+func catalogWithVariants(r *http.Request, fields map[string]bool, byDefault bool) bool {
+	switch {
+	case r.URL.Query().Get("exclude") == "variants":
+		return false
+	case r.URL.Query().Get("include") == "variants":
+		return true
+	case r.URL.Query().Get("fields") != "":
+		return fields["variants"]
+	}
+	return byDefault
+}
+
+// selectFields encodes v and keeps only the given top-level fields
+func selectFields(v interface{}, fields map[string]bool) (map[string]json.RawMessage, error) {
+	encoded, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	var all map[string]json.RawMessage
+	if err := json.Unmarshal(encoded, &all); err != nil {
+		return nil, err
+	}
+	for field := range all {
+		if !fields[field] {
+			delete(all, field)
+		}
+	}
+	return all, nil
+}
+
+// writeCatalogJSON writes a cacheable response with an ETag, answering a matching
+// If-None-Match with 304 Not Modified
+func writeCatalogJSON(w http.ResponseWriter, r *http.Request, v interface{}) {
+	body, err := json.Marshal(v)
+	if err != nil {
+		writeFailure(w, r, "encoding response", err)
+		return
+	}
+
+	sum := sha256.Sum256(body)
+	etag := `"` + hex.EncodeToString(sum[:16]) + `"`
+	w.Header().Set("ETag", etag)
+	w.Header().Set("Cache-Control", "public, max-age="+strconv.Itoa(catalogMaxAge))
+	if r.Header.Get("If-None-Match") == etag {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(body)
+	w.Write([]byte("\n"))
+}
+
+// CatalogProducts lists live products for the storefront, optionally in one category
+func (h *Handler) CatalogProducts(w http.ResponseWriter, r *http.Request) {
+	fields, err := catalogFields(r, catalogProductFields)
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+	withVariants := catalogWithVariants(r, fields, false)
+	fields["variants"] = withVariants
+
+	page, _ := strconv.Atoi(r.URL.Query().Get("page"))
+	limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
+	result, err := models.GetCatalogProducts(h.db(r), page, limit, r.URL.Query().Get("category_id"), withVariants)
+	if err != nil {
+		writeFailure(w, r, "getting products", err)
+		return
+	}
+
+	products := models.PaginatedResult[map[string]json.RawMessage]{
+		Data:       make([]map[string]json.RawMessage, 0, len(result.Data)),
+		TotalCount: result.TotalCount,
+		Page:       result.Page,
+		PageSize:   result.PageSize,
+		TotalPages: result.TotalPages,
+		HasNext:    result.HasNext,
+		HasPrev:    result.HasPrev,
+	}
+	for _, product := range result.Data {
+		selected, err := selectFields(product, fields)
+		if err != nil {
+			writeFailure(w, r, "encoding product", err)
+			return
+		}
+		products.Data = append(products.Data, selected)
+	}
+
+	writeCatalogJSON(w, r, paginate(w, r, products))
+}
+
+// CatalogProduct returns one live product by ID or slug. With a signed ?preview= token it also
+// returns the unpublished product the token was made for, so the storefront can preview it.
+func (h *Handler) CatalogProduct(w http.ResponseWriter, r *http.Request) {
+	fields, err := catalogFields(r, catalogProductFields)
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+	fields["variants"] = catalogWithVariants(r, fields, true)
+
+	token := r.URL.Query().Get("preview")
+	var product models.Product
+	if token != "" {
+		product, _, err = h.previewProduct(r, token)
+		if err == nil && chi.URLParam(r, "id") != product.ID && chi.URLParam(r, "id") != product.Slug {
+			err = preview.ErrInvalid
+		}
+		if err != nil {
+			writeFailure(w, r, "checking preview link", err)
+			return
+		}
+	} else {
+		product, err = models.GetCatalogProduct(h.db(r), chi.URLParam(r, "id"))
+		if err != nil {
+			writeFailure(w, r, "getting product", err)
+			return
+		}
+	}
+
+	selected, err := selectFields(product, fields)
+	if err != nil {
+		writeFailure(w, r, "encoding product", err)
+		return
+	}
+
+	if token != "" {
+		// Previews must not land in shared caches, where they would outlive the token
+		w.Header().Set("Cache-Control", "private, no-store")
+		writeJSON(w, http.StatusOK, selected)
+		return
+	}
+	writeCatalogJSON(w, r, selected)
+}
+
+// CatalogCategories lists the categories for the storefront
+func (h *Handler) CatalogCategories(w http.ResponseWriter, r *http.Request) {
+	fields, err := catalogFields(r, catalogCategoryFields)
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	categories, err := models.GetAllCategories(h.db(r))
+	if err != nil {
+		writeFailure(w, r, "getting categories", err)
+		return
+	}
+
+	selected := make([]map[string]json.RawMessage, 0, len(categories))
+	for _, category := range categories {
+		c, err := selectFields(category, fields)
+		if err != nil {
+			writeFailure(w, r, "encoding category", err)
+			return
+		}
+		selected = append(selected, c)
+	}
+
+	writeCatalogJSON(w, r, paginate(w, r, models.SinglePage(selected)))
+}
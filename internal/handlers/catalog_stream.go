@@ -0,0 +1,106 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/ngenohkevin/kuiper_admin/internal/live"
+	"github.com/ngenohkevin/kuiper_admin/internal/models"
+)
+
+// stockStreamDelay is how long the stock stream gathers changes before reading them, so a bulk
+// edit or an import is sent as a few events rather than one per product
+const stockStreamDelay = time.Second
+
+// stockStreamBatch caps how many products one stock event carries
+const stockStreamBatch = 200
+
+// CatalogStockStream streams the price, sale and stock of products as they change, as
+// server-sent "stock" events, so storefront pages can update without polling. ?product_id=
+// takes a comma-separated list to follow only those products. Changes made while a client is
+// disconnected aren't replayed, so it should fetch the products again after reconnecting.
+func (h *Handler) CatalogStockStream(w http.ResponseWriter, r *http.Request) {
+	db := h.db(r)
+
+	var only map[string]bool
+	if ids := r.URL.Query().Get("product_id"); ids != "" {
+		only = make(map[string]bool)
+		for _, id := range strings.Split(ids, ",") {
+			if id = strings.TrimSpace(id); id != "" {
+				only[id] = true
+			}
+		}
+	}
+
+	// The stream outlives the server's write timeout, which is meant for ordinary requests
+	rc := http.NewResponseController(w)
+	if err := rc.SetWriteDeadline(time.Time{}); err != nil {
+		writeError(w, r, http.StatusInternalServerError, "Streaming isn't supported here")
+		return
+	}
+
+	changes, unsubscribe := live.SubscribeProductChanges()
+	defer unsubscribe()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprint(w, "retry: 5000\n\n")
+	rc.Flush()
+
+	keepAlive := time.NewTicker(liveKeepAlive)
+	defer keepAlive.Stop()
+
+	// Changed products wait in pending until the timer fires; order keeps them in the order
+	// they first changed
+	pending := make(map[string]bool)
+	var order []string
+	send := time.NewTimer(stockStreamDelay)
+	send.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-keepAlive.C:
+			fmt.Fprint(w, ": keep-alive\n\n")
+		case c, ok := <-changes:
+			if !ok {
+				return
+			}
+			if c.Tenant != db.Schema || (only != nil && !only[c.ProductID]) || pending[c.ProductID] {
+				continue
+			}
+			if len(order) == 0 {
+				send.Reset(stockStreamDelay)
+			}
+			pending[c.ProductID] = true
+			order = append(order, c.ProductID)
+			continue
+		case <-send.C:
+			for len(order) > 0 {
+				batch := order[:min(len(order), stockStreamBatch)]
+				order = order[len(batch):]
+				stock, err := models.GetCatalogStock(db, batch)
+				if err != nil {
+					log.Printf("Error reading stock for the stock stream: %v", err)
+					continue
+				}
+				data, err := json.Marshal(stock)
+				if err != nil {
+					continue
+				}
+				fmt.Fprintf(w, "event: stock\ndata: %s\n\n", data)
+			}
+			clear(pending)
+		}
+		if err := rc.Flush(); err != nil {
+			return
+		}
+	}
+}
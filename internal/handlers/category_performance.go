@@ -0,0 +1,70 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/ngenohkevin/kuiper_admin/internal/models"
+	"github.com/ngenohkevin/kuiper_admin/internal/templates"
+)
+
+// categoryTopProducts is how many of its best products a category's drill-down lists
+const categoryTopProducts = 20
+
+// CategoryPerformance compares the categories by product count, stock value, average rating
+// and the sales of a date range, sorted by ?sort=
+func (h *Handler) CategoryPerformance(w http.ResponseWriter, r *http.Request) {
+	from, to, err := reportRange(r)
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	comparison, err := models.CompareCategories(h.db(r), from, to, r.URL.Query().Get("sort"))
+	if err != nil {
+		writeFailure(w, r, "comparing categories", err)
+		return
+	}
+
+	if wantsJSON(r) {
+		writeJSON(w, http.StatusOK, comparison)
+		return
+	}
+
+	render(w, r, templates.CategoryPerformance(comparison, reportRangeQuery(from, to)))
+}
+
+// CategoryPerformanceDetail drills into one category of the comparison: its figures and the
+// products in it that did best over the date range, by contribution margin
+func (h *Handler) CategoryPerformanceDetail(w http.ResponseWriter, r *http.Request) {
+	from, to, err := reportRange(r)
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	id := chi.URLParam(r, "id")
+	category, err := models.GetCategoryPerformance(h.db(r), from, to, id)
+	if err != nil {
+		writeFailure(w, r, "getting category performance", err)
+		return
+	}
+	products, err := models.GetProfitability(h.db(r), from, to, id)
+	if err != nil {
+		writeFailure(w, r, "getting category's top products", err)
+		return
+	}
+	if len(products.Rows) > categoryTopProducts {
+		products.Rows = products.Rows[:categoryTopProducts]
+	}
+
+	if wantsJSON(r) {
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"category":     category,
+			"top_products": products.Rows,
+		})
+		return
+	}
+
+	render(w, r, templates.CategoryPerformanceDetail(category, products, reportRangeQuery(from, to)))
+}
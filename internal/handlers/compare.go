@@ -0,0 +1,126 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/ngenohkevin/kuiper_admin/internal/models"
+	"github.com/ngenohkevin/kuiper_admin/internal/templates"
+)
+
+// Bounds on how many products can be compared or merged at once
+const (
+	minCompareProducts = 2
+	maxCompareProducts = 4
+)
+
+// CompareProducts shows 2–4 products side by side, selected with repeated ids query parameters
+func (h *Handler) CompareProducts(w http.ResponseWriter, r *http.Request) {
+	products, ok := h.loadSelectedProducts(w, r, r.URL.Query()["ids"])
+	if !ok {
+		return
+	}
+
+	render(w, r, templates.CompareProducts(products))
+}
+
+// MergeProductsForm shows the guided merge step for the selected products, where one is picked to survive
+func (h *Handler) MergeProductsForm(w http.ResponseWriter, r *http.Request) {
+	products, ok := h.loadSelectedProducts(w, r, r.URL.Query()["ids"])
+	if !ok {
+		return
+	}
+
+	check, err := models.CheckBackup(h.db(r))
+	if err != nil {
+		writeFailure(w, r, "checking last backup", err)
+		return
+	}
+
+	render(w, r, templates.MergeProductsForm(products, check))
+}
+
+// MergeProducts folds the selected duplicates into the chosen survivor
+func (h *Handler) MergeProducts(w http.ResponseWriter, r *http.Request) {
+	// Parse form
+	if err := r.ParseForm(); err != nil {
+		writeError(w, r, http.StatusBadRequest, "Invalid form data")
+		return
+	}
+
+	survivorID := r.FormValue("survivor_id")
+	if survivorID == "" {
+		writeError(w, r, http.StatusBadRequest, "Pick the product to keep")
+		return
+	}
+
+	var duplicateIDs []string
+	for _, id := range uniqueIDs(r.Form["ids"]) {
+		if id != survivorID {
+			duplicateIDs = append(duplicateIDs, id)
+		}
+	}
+	if len(duplicateIDs) == 0 {
+		writeError(w, r, http.StatusBadRequest, "Select at least one other product to merge")
+		return
+	}
+
+	check, ok := h.confirmBackup(w, r)
+	if !ok {
+		return
+	}
+
+	if err := models.MergeProducts(h.db(r), survivorID, duplicateIDs); err != nil {
+		writeFailure(w, r, "merging products", err)
+		return
+	}
+
+	events := []models.ActivityEvent{{
+		EntityType: models.ActivityProduct, EntityID: survivorID, Action: models.ActivityUpdated,
+		Summary: withBackupNote("Merged in "+strconv.Itoa(len(duplicateIDs))+" duplicates", check),
+	}}
+	for _, id := range duplicateIDs {
+		events = append(events, models.ActivityEvent{
+			EntityType: models.ActivityProduct, EntityID: id, Action: models.ActivityDeleted,
+			Summary: withBackupNote("Merged into another product and moved to the trash", check),
+		})
+	}
+	h.recordActivities(r, events...)
+
+	http.Redirect(w, r, "/products/"+survivorID, http.StatusSeeOther)
+}
+
+// loadSelectedProducts fetches 2–4 selected products in selection order, writing an error response if it fails
+func (h *Handler) loadSelectedProducts(w http.ResponseWriter, r *http.Request, ids []string) ([]models.Product, bool) {
+	ids = uniqueIDs(ids)
+	if len(ids) < minCompareProducts || len(ids) > maxCompareProducts {
+		writeError(w, r, http.StatusBadRequest, fmt.Sprintf("Select between %d and %d products", minCompareProducts, maxCompareProducts))
+		return nil, false
+	}
+
+	products := make([]models.Product, 0, len(ids))
+	for _, id := range ids {
+		product, err := models.GetProductByID(h.db(r), id)
+		if err != nil {
+			writeFailure(w, r, "getting product", err)
+			return nil, false
+		}
+		products = append(products, product)
+	}
+	return products, true
+}
+
+// uniqueIDs drops empty and repeated IDs, keeping the selection order
+func uniqueIDs(ids []string) []string {
+	seen := make(map[string]bool)
+	var unique []string
+	for _, id := range ids {
+		if id == "" || seen[id] {
+			continue
+		}
+		seen[id] = true
+		unique = append(unique, id)
+	}
+	return unique
+}
@@ -0,0 +1,20 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/ngenohkevin/kuiper_admin/internal/templates"
+)
+
+// DatabaseSettings shows the connection pool's settings, its live usage and how long requests
+// have recently waited for a connection
+func (h *Handler) DatabaseSettings(w http.ResponseWriter, r *http.Request) {
+	stats := h.db(r).Monitor.Stats()
+
+	if wantsJSON(r) {
+		writeJSON(w, http.StatusOK, stats)
+		return
+	}
+
+	render(w, r, templates.DatabaseSettings(stats))
+}
@@ -0,0 +1,76 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/ngenohkevin/kuiper_admin/internal/models"
+	"github.com/ngenohkevin/kuiper_admin/internal/templates"
+)
+
+// deadStockDefaultDays is how long stock must go unsold to show on the dead stock report when
+// the admin doesn't say
+const deadStockDefaultDays = 90
+
+// deadStockParams reads the dead stock report's days and sort from the query
+func deadStockParams(r *http.Request) (int, string) {
+	days := deadStockDefaultDays
+	if d, err := strconv.Atoi(r.URL.Query().Get("days")); err == nil && d > 0 && d <= 3650 {
+		days = d
+	}
+	sort := r.URL.Query().Get("sort")
+	if !models.IsDeadStockSort(sort) {
+		sort = models.DeadStockSortCapital
+	}
+	return days, sort
+}
+
+// DeadStock lists the products and variants with stock that hasn't sold in the last ?days=
+// days, with the capital tied up in them, sorted by ?sort=
+func (h *Handler) DeadStock(w http.ResponseWriter, r *http.Request) {
+	days, sort := deadStockParams(r)
+	report, err := models.GetDeadStock(h.db(r), days, sort)
+	if err != nil {
+		writeFailure(w, r, "getting dead stock", err)
+		return
+	}
+
+	if wantsJSON(r) {
+		writeJSON(w, http.StatusOK, report)
+		return
+	}
+
+	render(w, r, templates.DeadStock(report))
+}
+
+// ExportDeadStock downloads the dead stock report as CSV, or as JSON with format=json
+func (h *Handler) ExportDeadStock(w http.ResponseWriter, r *http.Request) {
+	days, sort := deadStockParams(r)
+	report, err := models.GetDeadStock(h.db(r), days, sort)
+	if err != nil {
+		writeFailure(w, r, "exporting dead stock", err)
+		return
+	}
+
+	header := []string{"product_id", "name", "variant_id", "variant", "sku", "stock", "unit_cost", "capital", "last_sold_at", "views"}
+	out := newExportStream(w, r, "Dead stock", exportFilename("dead-stock"), header, int64(len(report.Rows)))
+	for _, row := range report.Rows {
+		unitCost, capital, lastSold := "", "", ""
+		if row.UnitCost != nil {
+			unitCost, capital = row.UnitCost.String(), row.Capital.String()
+		}
+		if row.LastSoldAt != nil {
+			lastSold = row.LastSoldAt.UTC().Format(time.RFC3339)
+		}
+		record := []string{
+			row.ProductID, csvText(row.ProductName), row.VariantID, csvText(row.VariantName), csvText(row.SKU),
+			strconv.Itoa(row.Stock), unitCost, capital, lastSold, strconv.Itoa(row.Views),
+		}
+		if err := out.Write(record, row); err != nil {
+			out.Close(err)
+			return
+		}
+	}
+	out.Close(nil)
+}
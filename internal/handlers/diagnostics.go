@@ -0,0 +1,202 @@
+package handlers
+
+import (
+	"cmp"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ngenohkevin/kuiper_admin/internal/database"
+	"github.com/ngenohkevin/kuiper_admin/internal/imagecache"
+	"github.com/ngenohkevin/kuiper_admin/internal/jobs"
+	"github.com/ngenohkevin/kuiper_admin/internal/mailer"
+	"github.com/ngenohkevin/kuiper_admin/internal/media"
+	custommiddleware "github.com/ngenohkevin/kuiper_admin/internal/middleware"
+	"github.com/ngenohkevin/kuiper_admin/internal/models"
+	"github.com/ngenohkevin/kuiper_admin/internal/money"
+	"github.com/ngenohkevin/kuiper_admin/internal/secrets"
+	"github.com/ngenohkevin/kuiper_admin/internal/shipping"
+	"github.com/ngenohkevin/kuiper_admin/internal/storage"
+	"github.com/ngenohkevin/kuiper_admin/internal/storefront"
+	"github.com/ngenohkevin/kuiper_admin/internal/templates"
+	"github.com/ngenohkevin/kuiper_admin/internal/version"
+	"github.com/ngenohkevin/kuiper_admin/internal/wms"
+)
+
+// Diagnostics shows which environment this is, the build running, whether the database schema
+// is up to date and the configuration in effect, with secrets withheld
+func (h *Handler) Diagnostics(w http.ResponseWriter, r *http.Request) {
+	migrations, err := models.GetMigrationStatus(h.db(r), database.MigrationsDir)
+	if err != nil {
+		writeFailure(w, r, "getting migration status", err)
+		return
+	}
+
+	env := models.CurrentEnvironment()
+	build := version.Get()
+	settings := h.configSettings()
+
+	if wantsJSON(r) {
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"environment": env,
+			"build":       build,
+			"migrations":  migrations,
+			"settings":    settings,
+		})
+		return
+	}
+
+	render(w, r, templates.Diagnostics(env, build, migrations, settings))
+}
+
+// configSettings lists the environment variables the dashboard reads, grouped as the README
+// documents them, each with the value in effect after defaults
+func (h *Handler) configSettings() []models.ConfigSetting {
+	var settings []models.ConfigSetting
+	add := func(group, name, value string) {
+		settings = append(settings, models.ConfigSetting{Group: group, Name: name, Value: value, Set: os.Getenv(name) != "", Source: secretSource(name)})
+	}
+	secret := func(group, name string) {
+		settings = append(settings, models.ConfigSetting{Group: group, Name: name, Set: os.Getenv(name) != "", Secret: true, Source: secretSource(name)})
+	}
+
+	env := models.CurrentEnvironment()
+	add("Environment", "APP_ENV", env.Name)
+	add("Environment", "APP_ENV_COLOR", env.Color)
+	add("Environment", "PORT", cmp.Or(os.Getenv("PORT"), "8090"))
+	add("Environment", "RUN_MIGRATIONS", onOff(os.Getenv("RUN_MIGRATIONS") == "true"))
+	add("Environment", "ADMIN_USERNAME", os.Getenv("ADMIN_USERNAME"))
+	secret("Environment", "ADMIN_PASSWORD")
+
+	conn := h.DB.Pool.Config().ConnConfig
+	add("Database", "DATABASE_URL", fmt.Sprintf("%s@%s:%d/%s", conn.User, conn.Host, conn.Port, conn.Database))
+	pool := database.PoolConfigFromEnv()
+	add("Database", "DB_MAX_CONNS", strconv.Itoa(int(pool.MaxConns)))
+	add("Database", "DB_MIN_CONNS", strconv.Itoa(int(pool.MinConns)))
+	add("Database", "DB_MAX_CONN_LIFETIME_MINUTES", minutes(pool.MaxConnLifetime))
+	add("Database", "DB_MAX_CONN_IDLE_MINUTES", minutes(pool.MaxConnIdleTime))
+	add("Database", "DB_POOL_MONITOR_SECONDS", seconds(pool.MonitorInterval))
+	add("Database", "DB_SLOW_ACQUIRE_MS", strconv.FormatInt(pool.SlowAcquire.Milliseconds(), 10))
+	add("Database", "DB_TIMEOUT_READ_SECONDS", seconds(h.DB.Timeouts.Read))
+	add("Database", "DB_TIMEOUT_LIST_SECONDS", seconds(h.DB.Timeouts.List))
+	add("Database", "DB_TIMEOUT_WRITE_SECONDS", seconds(h.DB.Timeouts.Write))
+	add("Database", "DB_TIMEOUT_BULK_SECONDS", seconds(h.DB.Timeouts.Bulk))
+	add("Database", "BACKUP_MAX_AGE_HOURS", strconv.Itoa(int(models.BackupMaxAge().Hours())))
+	cache := h.DB.Cache.Stats()
+	add("Database", "CACHE_MAX_ENTRIES", strconv.Itoa(cache.MaxEntries))
+	add("Database", "CACHE_MAX_MB", strconv.FormatInt(cache.MaxBytes>>20, 10))
+	add("Database", "TENANT_BASE_DOMAIN", custommiddleware.TenantBaseDomain())
+	add("Database", "DB_POOL_MODE", database.PoolMode())
+	add("Database", "TENANT_DB_MAX_CONNS", strconv.Itoa(int(database.TenantPoolConfig().MaxConns)))
+
+	add("Store", "STOREFRONT_URL", strings.TrimRight(os.Getenv("STOREFRONT_URL"), "/"))
+	add("Store", "STOREFRONT_NOTIFY_URL", storefront.ConfigFromEnv().NotifyURL)
+	add("Store", "CURRENCY_SYMBOL", money.Symbol())
+	add("Store", "STOCK_AUTO_AVAILABILITY", models.DefaultAutoAvailability())
+	add("Store", "VARIANT_STORAGE", models.VariantStorage())
+	add("Store", "UNDO_WINDOW_SECONDS", strconv.Itoa(undoWindowSeconds()))
+	add("Store", "TRASH_RETENTION_DAYS", days(jobs.TrashRetention()))
+	add("Store", "SEARCH_LOG_RETENTION_DAYS", days(jobs.SearchLogRetention()))
+	add("Store", "PRODUCT_VIEW_WINDOW_MINUTES", minutes(models.ProductViewWindow()))
+	add("Store", "REVIEW_REPORT_SLA_HOURS", strconv.Itoa(int(models.ReviewReportSLA().Hours())))
+	add("Store", "DASHBOARD_STATS_REFRESH_MINUTES", minutes(jobs.DashboardStatsInterval()))
+	secret("Store", "STOREFRONT_WEBHOOK_SECRET")
+
+	files := media.ConfigFromEnv()
+	pipeline := media.PipelineConfigFromEnv()
+	add("Media", "MEDIA_MAX_MB", strconv.FormatInt(files.MaxBytes>>20, 10))
+	add("Media", "MEDIA_MIN_PIXELS", strconv.Itoa(files.MinSide))
+	add("Media", "MEDIA_MAX_PIXELS", strconv.Itoa(files.MaxSide))
+	add("Media", "MEDIA_PIPELINE", strings.Join(pipeline.Steps, ","))
+	add("Media", "MEDIA_JPEG_QUALITY", strconv.Itoa(pipeline.JPEGQuality))
+	add("Media", "BG_REMOVAL_URL", pipeline.BackgroundRemovalURL)
+	secret("Media", "BG_REMOVAL_API_KEY")
+	images := imagecache.ConfigFromEnv()
+	add("Media", "IMAGE_CACHE_DIR", images.Dir)
+	add("Media", "IMAGE_CACHE_TTL_MINUTES", minutes(images.TTL))
+	add("Media", "IMAGE_CACHE_MAX_MB", strconv.FormatInt(images.MaxBytes>>20, 10))
+
+	store := storage.ConfigFromEnv()
+	add("Storage", "STORAGE_BACKEND", store.Backend)
+	add("Storage", "STORAGE_PREFIX", store.Prefix)
+	add("Storage", "STORAGE_PUBLIC_URL", files.URL)
+	add("Storage", "MEDIA_DIR", store.Dir)
+	add("Storage", "MEDIA_URL", store.URL)
+	add("Storage", "S3_BUCKET", store.S3Bucket)
+	add("Storage", "S3_REGION", store.S3Region)
+	add("Storage", "S3_ENDPOINT", store.S3Endpoint)
+	add("Storage", "S3_ACCESS_KEY_ID", store.S3AccessKeyID)
+	secret("Storage", "S3_SECRET_ACCESS_KEY")
+	add("Storage", "SUPABASE_URL", store.SupabaseURL)
+	add("Storage", "SUPABASE_BUCKET", store.SupabaseBucket)
+	secret("Storage", "SUPABASE_SERVICE_KEY")
+
+	mail := mailer.ConfigFromEnv()
+	add("Email", "SMTP_HOST", mail.Host)
+	add("Email", "SMTP_PORT", mail.Port)
+	add("Email", "SMTP_USERNAME", mail.Username)
+	secret("Email", "SMTP_PASSWORD")
+	add("Email", "MAIL_FROM", mail.From)
+
+	alerts := models.AnomalyThresholdsFromEnv()
+	add("Alerts", "ALERT_WINDOW_MINUTES", minutes(alerts.Window))
+	add("Alerts", "ALERT_DELETIONS", strconv.Itoa(alerts.Deletions))
+	add("Alerts", "ALERT_PRICE_DROPS", strconv.Itoa(alerts.PriceDrops))
+	add("Alerts", "ALERT_PRICE_DROP_PERCENT", strconv.FormatFloat(alerts.PriceDropPercent, 'f', -1, 64))
+	add("Alerts", "ALERT_SESSION_REVIEWS", strconv.Itoa(alerts.SessionReviews))
+	secret("Alerts", "CHAT_WEBHOOK_URL")
+
+	warehouse := wms.ConfigFromEnv()
+	add("Warehouse", "WMS_SYNC_URL", warehouse.URL)
+	secret("Warehouse", "WMS_API_KEY")
+	add("Warehouse", "WMS_SYNC_MODE", warehouse.Mode)
+	add("Warehouse", "WMS_SYNC_INTERVAL_MINUTES", minutes(warehouse.Interval))
+
+	labels := shipping.ConfigFromEnv()
+	add("Shipping", "SHIPPING_PROVIDER", labels.Provider)
+	secret("Shipping", "SHIPPING_API_KEY")
+	add("Shipping", "SHIPPING_FROM_NAME", labels.From.Name)
+	add("Shipping", "SHIPPING_FROM_STREET1", labels.From.Street1)
+	add("Shipping", "SHIPPING_FROM_STREET2", labels.From.Street2)
+	add("Shipping", "SHIPPING_FROM_CITY", labels.From.City)
+	add("Shipping", "SHIPPING_FROM_STATE", labels.From.State)
+	add("Shipping", "SHIPPING_FROM_ZIP", labels.From.Zip)
+	add("Shipping", "SHIPPING_FROM_COUNTRY", labels.From.Country)
+	add("Shipping", "SHIPPING_FROM_PHONE", labels.From.Phone)
+	add("Shipping", "SHIPPING_FROM_EMAIL", labels.From.Email)
+	add("Shipping", "SHIPPING_TRACKING_INTERVAL_MINUTES", minutes(labels.TrackingInterval))
+
+	add("Secrets", "SECRETS_DIR", cmp.Or(os.Getenv("SECRETS_DIR"), "/run/secrets"))
+	add("Secrets", "VAULT_ADDR", os.Getenv("VAULT_ADDR"))
+	add("Secrets", "VAULT_SECRET_PATH", os.Getenv("VAULT_SECRET_PATH"))
+	add("Secrets", "VAULT_NAMESPACE", os.Getenv("VAULT_NAMESPACE"))
+	secret("Secrets", "VAULT_TOKEN")
+
+	return settings
+}
+
+// secretSource is where a secret setting was read from at startup, such as a file or Vault, or
+// empty for one set in the environment or that isn't a secret
+func secretSource(name string) string {
+	s, ok := secrets.Lookup(name)
+	if !ok || !s.Found() || s.Source == secrets.SourceEnv {
+		return ""
+	}
+	return s.Describe()
+}
+
+// onOff renders a switch setting
+func onOff(on bool) string {
+	if on {
+		return "on"
+	}
+	return "off"
+}
+
+// seconds, minutes and days render a duration in the unit its environment variable takes
+func seconds(d time.Duration) string { return strconv.Itoa(int(d / time.Second)) }
+func minutes(d time.Duration) string { return strconv.Itoa(int(d / time.Minute)) }
+func days(d time.Duration) string    { return strconv.Itoa(int(d / (24 * time.Hour))) }
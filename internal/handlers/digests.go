@@ -0,0 +1,46 @@
+package handlers
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/ngenohkevin/kuiper_admin/internal/mailer"
+	"github.com/ngenohkevin/kuiper_admin/internal/models"
+	"github.com/ngenohkevin/kuiper_admin/internal/templates"
+)
+
+// DigestPreview shows the signed-in admin what their next change digest would say if it went
+// out now. Without a digest turned on it covers the last day.
+func (h *Handler) DigestPreview(w http.ResponseWriter, r *http.Request) {
+	prefs := models.PreferencesFromContext(r.Context())
+	sub := models.DigestSubscription{Frequency: prefs.DigestFrequency}
+	if sub.Frequency == models.DigestOff {
+		sub.Frequency = models.DigestDaily
+	}
+
+	subs, err := models.GetDigestSubscriptions(h.db(r))
+	if err != nil {
+		writeFailure(w, r, "getting digest subscriptions", err)
+		return
+	}
+	for _, s := range subs {
+		if s.Username == prefs.Username {
+			sub = s
+		}
+	}
+
+	now := time.Now()
+	digest, err := models.BuildDigest(h.db(r), sub.Since(now), now)
+	if err != nil {
+		writeFailure(w, r, "building digest", err)
+		return
+	}
+
+	if wantsJSON(r) {
+		writeJSON(w, http.StatusOK, digest)
+		return
+	}
+
+	ctx := withCrumbs(r, templates.Breadcrumb{Label: "Preferences", URL: "/preferences"}, templates.Breadcrumb{Label: "Digest preview"})
+	render(w, r.WithContext(ctx), templates.DigestPreviewPage(prefs, digest, mailer.ConfigFromEnv().Enabled()))
+}
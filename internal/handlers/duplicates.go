@@ -0,0 +1,35 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/ngenohkevin/kuiper_admin/internal/models"
+	"github.com/ngenohkevin/kuiper_admin/internal/templates"
+)
+
+// DuplicateReport lists the groups of likely-duplicate products found by the background job
+func (h *Handler) DuplicateReport(w http.ResponseWriter, r *http.Request) {
+	groups, err := models.GetDuplicateReport(h.db(r))
+	if err != nil {
+		writeFailure(w, r, "getting duplicate report", err)
+		return
+	}
+
+	if wantsJSON(r) {
+		writeList(w, r, models.SinglePage(groups))
+		return
+	}
+
+	render(w, r, templates.DuplicateReport(groups))
+}
+
+// RefreshDuplicateReport rebuilds the report now instead of waiting for the next scheduled run.
+// Image hashing is slow, so new images are still only picked up by the background job.
+func (h *Handler) RefreshDuplicateReport(w http.ResponseWriter, r *http.Request) {
+	if _, err := models.RebuildDuplicateReport(h.db(r)); err != nil {
+		writeFailure(w, r, "detecting duplicates", err)
+		return
+	}
+
+	http.Redirect(w, r, "/products/duplicates", http.StatusSeeOther)
+}
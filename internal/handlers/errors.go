@@ -0,0 +1,121 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/ngenohkevin/kuiper_admin/internal/httperr"
+	"github.com/ngenohkevin/kuiper_admin/internal/models"
+	"github.com/ngenohkevin/kuiper_admin/internal/preview"
+	"github.com/ngenohkevin/kuiper_admin/internal/templates"
+)
+
+// Postgres error codes classifyError recognises
+const (
+	pgInvalidText     = "22P02" // A value that doesn't parse, usually a mistyped UUID in the URL
+	pgForeignKey      = "23503"
+	pgUniqueViolation = "23505"
+	pgCheckViolation  = "23514"
+	pgQueryCanceled   = "57014"
+)
+
+// classifyError decides what the client is told about an error from the model layer. Errors the
+// models create themselves, either alone or carrying models.ErrNotFound or models.ErrConflict,
+// describe the problem for the admin and are shown as they are. Other wrapped errors come from
+// the database or elsewhere inside, so only their kind is described; the message is empty for
+// failures the client can do nothing about.
+func classifyError(err error) (int, string) {
+	var pgErr *pgconn.PgError
+	isPg := errors.As(err, &pgErr)
+	switch {
+	case errors.Unwrap(err) == models.ErrNotFound:
+		return http.StatusNotFound, err.Error()
+	case errors.Unwrap(err) == models.ErrConflict:
+		return http.StatusConflict, err.Error()
+	case err == preview.ErrInvalid, err == preview.ErrExpired:
+		return http.StatusForbidden, err.Error()
+	case errors.Is(err, models.ErrNotFound), errors.Is(err, pgx.ErrNoRows), isPg && pgErr.Code == pgInvalidText:
+		return http.StatusNotFound, "That item doesn't exist. It may have been deleted."
+	case isPg && pgErr.Code == pgUniqueViolation:
+		return http.StatusConflict, "That conflicts with an existing record, such as a duplicate name or slug."
+	case isPg && pgErr.Code == pgForeignKey:
+		return http.StatusConflict, "That refers to a record that doesn't exist, or one that is still in use."
+	case isPg && pgErr.Code == pgCheckViolation:
+		return http.StatusUnprocessableEntity, "One of the values isn't allowed."
+	case errors.Is(err, context.DeadlineExceeded), isPg && pgErr.Code == pgQueryCanceled:
+		return http.StatusServiceUnavailable, "The database took too long to answer. Please try again."
+	case errors.Unwrap(err) == nil:
+		return http.StatusBadRequest, err.Error()
+	}
+	return http.StatusInternalServerError, ""
+}
+
+// isUniqueViolation reports whether err is a duplicate of a unique column, such as a slug
+func isUniqueViolation(err error) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && pgErr.Code == pgUniqueViolation
+}
+
+// publicMessage is what the admin may be shown about err, for pages that display errors inline
+func publicMessage(err error, action string) string {
+	if _, message := classifyError(err); message != "" {
+		return message
+	}
+	log.Printf("Error %s: %v", action, err)
+	return "Something went wrong " + action + ". Please try again."
+}
+
+// isAPIRequest reports whether errors should be sent as JSON: API routes, and clients that asked for JSON
+func isAPIRequest(r *http.Request) bool {
+	return strings.HasPrefix(r.URL.Path, "/api/") || wantsJSON(r)
+}
+
+// writeHTTPError sends e as the JSON error body to API clients, as an error toast to HTMX
+// requests and as plain text otherwise
+func writeHTTPError(w http.ResponseWriter, r *http.Request, e *httperr.Error) {
+	switch {
+	case isAPIRequest(r):
+		httperr.WriteJSON(w, e)
+	case r.Header.Get("HX-Request") == "true":
+		// Show the toast whatever the triggering element targets
+		w.Header().Set("HX-Retarget", "#toast-container")
+		w.Header().Set("HX-Reswap", "afterbegin")
+		w.Header().Set("HX-Reselect", ".error-toast")
+		w.Header().Set("X-Error-Code", e.Code)
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.WriteHeader(e.Status)
+		if err := templates.ErrorToast(e.Message).Render(r.Context(), w); err != nil {
+			log.Printf("Error rendering error toast: %v", err)
+		}
+	default:
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.WriteHeader(e.Status)
+		if err := templates.ErrorPage(e.Status, e.Message).Render(r.Context(), w); err != nil {
+			log.Printf("Error rendering error page: %v", err)
+		}
+	}
+}
+
+// writeError sends an error with the code that matches its status
+func writeError(w http.ResponseWriter, r *http.Request, status int, message string) {
+	writeHTTPError(w, r, httperr.New(status, message))
+}
+
+// writeFailure responds to an error from the model layer with the status and message
+// classifyError picks, logging the details so they never reach the browser. action reads
+// like "getting product".
+func writeFailure(w http.ResponseWriter, r *http.Request, action string, err error) {
+	status, message := classifyError(err)
+	if status >= http.StatusInternalServerError || status == http.StatusNotFound {
+		log.Printf("Error %s: %v", action, err)
+	}
+	if message == "" {
+		message = "Something went wrong " + action + ". Please try again."
+	}
+	writeError(w, r, status, message)
+}
@@ -0,0 +1,146 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/ngenohkevin/kuiper_admin/internal/models"
+	"github.com/ngenohkevin/kuiper_admin/internal/money"
+	"github.com/ngenohkevin/kuiper_admin/internal/templates"
+)
+
+// parseExperiment reads an experiment from the form or, for JSON clients, a JSON body. Empty
+// variant fields keep the product's own price or description.
+func parseExperiment(r *http.Request) (models.Experiment, error) {
+	experiment := models.Experiment{TrafficSplit: 50}
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "application/json") {
+		if err := json.NewDecoder(r.Body).Decode(&experiment); err != nil {
+			return models.Experiment{}, fmt.Errorf("Invalid JSON: expected name, variant_price, variant_description and traffic_split")
+		}
+		return experiment, nil
+	}
+
+	if err := r.ParseForm(); err != nil {
+		return models.Experiment{}, fmt.Errorf("Invalid form data")
+	}
+	experiment.Name = r.FormValue("name")
+	if s := strings.TrimSpace(r.FormValue("variant_price")); s != "" {
+		price, err := money.ParseInput(s)
+		if err != nil {
+			return models.Experiment{}, fmt.Errorf("Variant price must be an amount such as 19.99")
+		}
+		experiment.VariantPrice = &price
+	}
+	if s := r.FormValue("variant_description"); strings.TrimSpace(s) != "" {
+		experiment.VariantDescription = &s
+	}
+	if s := r.FormValue("traffic_split"); s != "" {
+		split, err := strconv.Atoi(s)
+		if err != nil {
+			return models.Experiment{}, fmt.Errorf("Traffic split must be a whole number")
+		}
+		experiment.TrafficSplit = split
+	}
+	return experiment, nil
+}
+
+// renderProductExperiments answers an experiment change with the product's experiments: as
+// JSON, or as the refreshed section of the product page
+func (h *Handler) renderProductExperiments(w http.ResponseWriter, r *http.Request, productID string, status int) {
+	experiments, err := models.GetProductExperiments(h.db(r), productID)
+	if err != nil {
+		writeFailure(w, r, "getting experiments", err)
+		return
+	}
+	if wantsJSON(r) {
+		writeJSON(w, status, paginate(w, r, models.SinglePage(experiments)))
+		return
+	}
+	w.WriteHeader(status)
+	render(w, r, templates.ProductExperiments(productID, experiments))
+}
+
+// ProductExperiments shows a product's experiments and how each arm is doing
+func (h *Handler) ProductExperiments(w http.ResponseWriter, r *http.Request) {
+	h.renderProductExperiments(w, r, chi.URLParam(r, "id"), http.StatusOK)
+}
+
+// CreateExperiment adds a draft experiment to a product
+func (h *Handler) CreateExperiment(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+
+	experiment, err := parseExperiment(r)
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+	experiment.ProductID = id
+	if _, err := models.CreateExperiment(h.db(r), experiment); err != nil {
+		writeFailure(w, r, "creating experiment", err)
+		return
+	}
+
+	h.renderProductExperiments(w, r, id, http.StatusCreated)
+}
+
+// StartExperiment starts showing a draft experiment's variant to storefront sessions
+func (h *Handler) StartExperiment(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+
+	if err := models.StartExperiment(h.db(r), id, chi.URLParam(r, "experimentID")); err != nil {
+		writeFailure(w, r, "starting experiment", err)
+		return
+	}
+
+	h.renderProductExperiments(w, r, id, http.StatusOK)
+}
+
+// StopExperiment ends a running experiment, keeping its results
+func (h *Handler) StopExperiment(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+
+	if err := models.StopExperiment(h.db(r), id, chi.URLParam(r, "experimentID")); err != nil {
+		writeFailure(w, r, "stopping experiment", err)
+		return
+	}
+
+	h.renderProductExperiments(w, r, id, http.StatusOK)
+}
+
+// DeleteExperiment removes an experiment that isn't running, with its results
+func (h *Handler) DeleteExperiment(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+
+	if err := models.DeleteExperiment(h.db(r), id, chi.URLParam(r, "experimentID")); err != nil {
+		writeFailure(w, r, "deleting experiment", err)
+		return
+	}
+
+	h.renderProductExperiments(w, r, id, http.StatusOK)
+}
+
+// CatalogProductExperiment tells the storefront which price and description to show a
+// ?session= for a live product, by ID or slug, putting the session in an arm of the product's
+// running experiment the first time it asks. Products without one get their own price and
+// description in the control arm.
+func (h *Handler) CatalogProductExperiment(w http.ResponseWriter, r *http.Request) {
+	product, err := models.GetCatalogProduct(h.db(r), chi.URLParam(r, "id"))
+	if err != nil {
+		writeFailure(w, r, "getting product", err)
+		return
+	}
+
+	assignment, err := models.AssignExperiment(h.db(r), product, r.URL.Query().Get("session"))
+	if err != nil {
+		writeFailure(w, r, "assigning experiment", err)
+		return
+	}
+
+	// The answer differs per session, so it must not be shared through caches
+	w.Header().Set("Cache-Control", "private, no-store")
+	writeJSON(w, http.StatusOK, assignment)
+}
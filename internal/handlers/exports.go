@@ -0,0 +1,225 @@
+package handlers
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/ngenohkevin/kuiper_admin/internal/jobs"
+	"github.com/ngenohkevin/kuiper_admin/internal/models"
+	"github.com/ngenohkevin/kuiper_admin/internal/xlsx"
+)
+
+// exportFlushRows is how many rows an export writes between flushes, so the download starts
+// straight away and arrives in chunks rather than all at the end
+const exportFlushRows = 200
+
+// exportStream writes an export row by row as CSV, as an Excel workbook with format=xlsx, or
+// as a JSON array for clients that asked for JSON, and follows its progress as a task on the
+// jobs page. Nothing is sent until the first
+// row, so an export that fails before then can still answer with a proper error.
+type exportStream struct {
+	w        http.ResponseWriter
+	r        *http.Request
+	filename string
+	name     string
+	header   []string
+	json     bool
+	excel    bool
+	progress jobs.TaskProgress
+
+	csv     *csv.Writer
+	xlsx    *xlsx.Writer
+	started bool
+	rows    int64
+}
+
+// newExportStream starts an export named name, saved as filename with a .csv, .xlsx or .json
+// extension added. total is how many rows to expect, or 0 when unknown.
+func newExportStream(w http.ResponseWriter, r *http.Request, name, filename string, header []string, total int64) *exportStream {
+	// A large export outlives the server's write timeout, which is meant for ordinary requests
+	if err := http.NewResponseController(w).SetWriteDeadline(time.Time{}); err != nil {
+		log.Printf("Error lifting the write deadline for %s: %v", filename, err)
+	}
+
+	format := r.URL.Query().Get("format")
+	return &exportStream{
+		w:        w,
+		r:        r,
+		filename: filename,
+		name:     name,
+		header:   header,
+		json:     format == "json" || (format == "" && wantsJSON(r)),
+		excel:    format == "xlsx",
+		progress: jobs.StartTask("export", name, total),
+	}
+}
+
+// start sends the headers and the opening of the body
+func (s *exportStream) start() {
+	s.started = true
+	if s.json {
+		s.w.Header().Set("Content-Type", "application/json")
+		s.w.Header().Set("Content-Disposition", `attachment; filename="`+s.filename+`.json"`)
+		s.w.Write([]byte("["))
+		return
+	}
+	if s.excel {
+		s.w.Header().Set("Content-Type", xlsx.ContentType)
+		s.w.Header().Set("Content-Disposition", `attachment; filename="`+s.filename+`.xlsx"`)
+		s.xlsx = xlsx.NewWriter(s.w, s.name)
+		s.xlsx.WriteHeader(s.header)
+		return
+	}
+	s.w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	s.w.Header().Set("Content-Disposition", `attachment; filename="`+s.filename+`.csv"`)
+	s.csv = csv.NewWriter(s.w)
+	s.csv.Write(s.header)
+}
+
+// Write adds one row: record to a CSV or Excel export, or item encoded to a JSON one
+func (s *exportStream) Write(record []string, item interface{}) error {
+	if !s.started {
+		s.start()
+	}
+
+	if s.json {
+		data, err := json.Marshal(item)
+		if err != nil {
+			return err
+		}
+		if s.rows > 0 {
+			s.w.Write([]byte(","))
+		}
+		if _, err := s.w.Write(data); err != nil {
+			return err
+		}
+	} else if s.excel {
+		if err := s.xlsx.Write(record); err != nil {
+			return err
+		}
+	} else if err := s.csv.Write(record); err != nil {
+		return err
+	}
+
+	s.rows++
+	if s.rows%exportFlushRows == 0 {
+		s.flush()
+		s.progress.Add(exportFlushRows)
+	}
+	return s.flushError()
+}
+
+// flush sends what has been written so far to the client
+func (s *exportStream) flush() {
+	if s.csv != nil {
+		s.csv.Flush()
+	}
+	if s.xlsx != nil {
+		s.xlsx.Flush()
+	}
+	if f, ok := s.w.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// flushError is the CSV or Excel writer's error, such as the client having gone away
+func (s *exportStream) flushError() error {
+	if s.csv != nil {
+		return s.csv.Error()
+	}
+	if s.xlsx != nil {
+		return s.xlsx.Error()
+	}
+	return nil
+}
+
+// Close finishes the export. An error before the first row is sent as an error response; after
+// it the download can only be cut short, which the jobs page records.
+func (s *exportStream) Close(err error) {
+	s.progress.Add(s.rows % exportFlushRows)
+	if err == nil {
+		err = s.flushError()
+	}
+	s.progress.Finish(err)
+
+	if err != nil && !s.started {
+		writeFailure(s.w, s.r, "exporting "+s.filename, err)
+		return
+	}
+	if err != nil {
+		log.Printf("Error exporting %s: %v", s.filename, err)
+		return
+	}
+	if !s.started {
+		s.start()
+	}
+	if s.json {
+		s.w.Write([]byte("]"))
+	}
+	if s.xlsx != nil {
+		// The workbook's index comes last, so until now it couldn't be opened
+		if err := s.xlsx.Close(); err != nil {
+			log.Printf("Error finishing %s workbook: %v", s.filename, err)
+		}
+	}
+	s.flush()
+}
+
+// exportFilename names an export file after what it holds and today's date
+func exportFilename(name string) string {
+	return name + "-" + time.Now().Format("2006-01-02")
+}
+
+// ExportCategories downloads every category matching the category list's search and level
+// filter as CSV, as an Excel workbook with format=xlsx or as JSON with format=json
+func (h *Handler) ExportCategories(w http.ResponseWriter, r *http.Request) {
+	query := listQuery(r, "level", models.CategorySorts)
+	header := []string{"id", "name", "slug", "parent_id", "parent", "products", "created_at"}
+	out := newExportStream(w, r, "Categories", exportFilename("categories"), header, 0)
+	out.Close(models.EachCategoryExport(h.db(r), query, func(c models.CategoryExport) error {
+		parentID, createdAt := "", ""
+		if c.ParentID != nil {
+			parentID = *c.ParentID
+		}
+		if c.CreatedAt.Valid {
+			createdAt = c.CreatedAt.Time.UTC().Format(time.RFC3339)
+		}
+		return out.Write([]string{
+			c.ID, csvText(c.Name), c.Slug, parentID, csvText(c.Parent), strconv.Itoa(c.Products), createdAt,
+		}, c)
+	}))
+}
+
+// ExportReviews downloads every review matching the review list's search and status filter as
+// CSV, as an Excel workbook with format=xlsx or as JSON with format=json
+func (h *Handler) ExportReviews(w http.ResponseWriter, r *http.Request) {
+	query := listQuery(r, "status", models.ReviewSorts)
+	total, err := models.CountReviewExport(h.db(r), query)
+	if err != nil {
+		writeFailure(w, r, "exporting reviews", err)
+		return
+	}
+
+	header := []string{"id", "product_id", "product", "rating", "status", "reviewer_name", "comment", "created_at"}
+	out := newExportStream(w, r, "Reviews", exportFilename("reviews"), header, total)
+	out.Close(models.EachReviewExport(h.db(r), query, func(review models.Review) error {
+		productID, product, reviewer, createdAt := "", "", "", ""
+		if review.Product != nil {
+			productID, product = review.Product.ID, review.Product.Name
+		}
+		if review.ReviewerName != nil {
+			reviewer = *review.ReviewerName
+		}
+		if review.CreatedAt.Valid {
+			createdAt = review.CreatedAt.Time.UTC().Format(time.RFC3339)
+		}
+		return out.Write([]string{
+			review.ID, productID, csvText(product), strconv.FormatFloat(review.Rating, 'f', -1, 64), review.Status,
+			csvText(reviewer), csvText(review.Comment), createdAt,
+		}, review)
+	}))
+}
@@ -0,0 +1,54 @@
+package handlers
+
+import (
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/ngenohkevin/kuiper_admin/internal/models"
+	"github.com/ngenohkevin/kuiper_admin/internal/templates"
+)
+
+// withFavorites returns r carrying the IDs of the signed-in admin's starred products or
+// categories, for the page's stars. Without them the stars just show empty.
+func (h *Handler) withFavorites(r *http.Request, entityType string) *http.Request {
+	ids, err := models.GetFavoriteIDs(h.db(r), h.Session.GetString(r.Context(), "username"), entityType)
+	if err != nil {
+		log.Printf("Error getting favorite %ss: %v", entityType, err)
+	}
+	return r.WithContext(templates.WithFavorites(r.Context(), ids))
+}
+
+// SetFavorite stars a product or category for the signed-in admin, or unstars it with
+// favorite=false, answering HTMX requests with the updated star
+func (h *Handler) SetFavorite(w http.ResponseWriter, r *http.Request) {
+	username := h.Session.GetString(r.Context(), "username")
+	if username == "" {
+		writeError(w, r, http.StatusUnauthorized, "Not signed in")
+		return
+	}
+	if err := r.ParseForm(); err != nil {
+		writeError(w, r, http.StatusBadRequest, "Invalid form data")
+		return
+	}
+
+	entityType, id := chi.URLParam(r, "type"), chi.URLParam(r, "id")
+	favorite, err := strconv.ParseBool(r.FormValue("favorite"))
+	if err != nil {
+		favorite = true
+	}
+	if err := models.SetFavorite(h.db(r), username, entityType, id, favorite); err != nil {
+		writeFailure(w, r, "saving favorite", err)
+		return
+	}
+
+	switch {
+	case wantsJSON(r):
+		writeJSON(w, http.StatusOK, map[string]interface{}{"entity_type": entityType, "id": id, "favorite": favorite})
+	case r.Header.Get("HX-Request") == "true":
+		render(w, r, templates.FavoriteButton(entityType, id, favorite))
+	default:
+		http.Redirect(w, r, models.Favorite{EntityType: entityType, ID: id}.URL(), http.StatusSeeOther)
+	}
+}
@@ -0,0 +1,157 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/ngenohkevin/kuiper_admin/internal/models"
+	"github.com/ngenohkevin/kuiper_admin/internal/templates"
+)
+
+// PickQueue shows the orders waiting to be picked, oldest first, optionally only those in one
+// ?status=
+func (h *Handler) PickQueue(w http.ResponseWriter, r *http.Request) {
+	query := listQuery(r, "status", models.PickSorts)
+	result, err := models.GetPickQueue(h.db(r), query)
+	if err != nil {
+		writeFailure(w, r, "getting orders to pick", err)
+		return
+	}
+	if wantsJSON(r) {
+		writeList(w, r, result)
+		return
+	}
+
+	counts, err := models.CountOrdersByStatus(h.db(r))
+	if err != nil {
+		writeFailure(w, r, "counting orders", err)
+		return
+	}
+
+	state := templates.NewListState("/fulfillment", "orders", "status", query, result)
+	h.rememberList(r, "/fulfillment")
+	render(w, r, templates.PickQueue(state, result.Data, counts))
+}
+
+// PickOrder shows an order's pick list, in the order its lines are shelved, with the form that
+// packs and ships it
+func (h *Handler) PickOrder(w http.ResponseWriter, r *http.Request) {
+	h.renderPickList(w, r, http.StatusOK, nil, "")
+}
+
+// renderPickList shows the pick list with packing as last submitted, and errorMsg saying why it
+// wasn't packed. Without a submission, the packing form starts from the carrier and tracking
+// number of the label bought for the order, if any.
+func (h *Handler) renderPickList(w http.ResponseWriter, r *http.Request, status int, packing *models.Packing, errorMsg string) {
+	order, lines, err := models.GetPickList(h.db(r), chi.URLParam(r, "id"))
+	if err != nil {
+		writeFailure(w, r, "getting pick list", err)
+		return
+	}
+	if packing == nil {
+		packing = &models.Packing{Carrier: order.Carrier, TrackingNumber: order.TrackingNumber, Notify: true}
+	}
+	if wantsJSON(r) {
+		writeJSON(w, status, struct {
+			models.Order
+			PickLines []models.PickLine `json:"pick_lines"`
+		}{order, lines})
+		return
+	}
+
+	w.WriteHeader(status)
+	ctx := withCrumbs(r, templates.Breadcrumb{Label: "Fulfillment", URL: h.listURL(r, "/fulfillment")},
+		templates.Breadcrumb{Label: "Order " + order.ID})
+	render(w, r.WithContext(ctx), templates.PickList(order, lines, *packing, errorMsg))
+}
+
+// PackOrder ships an order whose lines were all picked, taking them out of stock and recording
+// the carrier and tracking number
+func (h *Handler) PackOrder(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+
+	body := struct {
+		Picked         []string `json:"picked"`
+		Carrier        string   `json:"carrier"`
+		TrackingNumber string   `json:"tracking_number"`
+		Notify         *bool    `json:"notify"` // Defaults to true
+	}{}
+	var err error
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "application/json") {
+		if err = json.NewDecoder(r.Body).Decode(&body); err != nil {
+			err = fmt.Errorf("Invalid JSON: expected picked, carrier, tracking_number and notify")
+		}
+	} else if err = r.ParseForm(); err != nil {
+		err = fmt.Errorf("Invalid form data")
+	} else {
+		notify := r.FormValue("notify") != ""
+		body.Picked, body.Notify = r.Form["picked"], &notify
+		body.Carrier, body.TrackingNumber = r.FormValue("carrier"), r.FormValue("tracking_number")
+	}
+	packing := models.Packing{
+		Picked: body.Picked, Carrier: body.Carrier, TrackingNumber: body.TrackingNumber,
+		Notify: body.Notify == nil || *body.Notify,
+	}
+
+	var order models.Order
+	var queued []models.OrderNotification
+	if err == nil {
+		order, queued, err = models.PackOrder(h.db(r), id, packing, h.Session.GetString(r.Context(), "username"))
+	}
+	if err != nil {
+		if status, _ := classifyError(err); wantsJSON(r) || (status != http.StatusBadRequest && status != http.StatusConflict) {
+			writeFailure(w, r, "packing order", err)
+			return
+		}
+		h.renderPickList(w, r, http.StatusUnprocessableEntity, &packing, publicMessage(err, "packing order"))
+		return
+	}
+
+	summary := "Packed and marked shipped"
+	if order.TrackingNumber != "" {
+		summary += ", " + strings.TrimSpace(order.Carrier+" "+order.TrackingNumber)
+	}
+	h.recordActivity(r, models.ActivityOrder, order.ID, models.ActivityStatusChanged, summary+queuedSummary(queued))
+
+	if wantsJSON(r) {
+		writeJSON(w, http.StatusOK, struct {
+			models.Order
+			Queued []models.OrderNotification `json:"queued_notifications"`
+		}{order, queued})
+		return
+	}
+
+	notice := "Packed and shipped"
+	switch pending := countQueued(queued); {
+	case pending == 1:
+		notice += "; the customer will be notified shortly"
+	case pending > 1:
+		notice += fmt.Sprintf("; %d notifications to the customer are queued", pending)
+	}
+	http.Redirect(w, r, orderURL(order.ID)+"?notice="+url.QueryEscape(notice), http.StatusSeeOther)
+}
+
+// SetPickLocation records where a line's product or variant is shelved, from the pick list
+func (h *Handler) SetPickLocation(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	if err := r.ParseForm(); err != nil {
+		writeError(w, r, http.StatusBadRequest, "Invalid form data")
+		return
+	}
+
+	err := models.SetPickLocation(h.db(r), r.FormValue("product_id"), r.FormValue("variant_id"), r.FormValue("location"),
+		h.Session.GetString(r.Context(), "username"))
+	if err != nil {
+		writeFailure(w, r, "setting pick location", err)
+		return
+	}
+	if wantsJSON(r) {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	http.Redirect(w, r, "/fulfillment/"+url.PathEscape(id), http.StatusSeeOther)
+}
@@ -0,0 +1,266 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/ngenohkevin/kuiper_admin/internal/httperr"
+	"github.com/ngenohkevin/kuiper_admin/internal/models"
+	"github.com/ngenohkevin/kuiper_admin/internal/money"
+	"github.com/ngenohkevin/kuiper_admin/internal/templates"
+)
+
+// giftCardCheck is the body of POST /api/v1/gift-cards/validate and /redeem
+type giftCardCheck struct {
+	Code      string       `json:"code"`
+	Amount    money.Amount `json:"amount"`    // Redeem only
+	Reference string       `json:"reference"` // Redeem only: the storefront's order
+}
+
+// giftCardBalance is what the storefront is told about a card
+type giftCardBalance struct {
+	Code      string       `json:"code"`
+	Balance   money.Amount `json:"balance"`
+	ExpiresAt *time.Time   `json:"expires_at"`
+}
+
+// giftCardRedemption answers a redemption with what was taken and what is left
+type giftCardRedemption struct {
+	giftCardBalance
+	Redeemed      money.Amount `json:"redeemed"`
+	TransactionID string       `json:"transaction_id"`
+}
+
+// giftCardCrumbs is the trail down to a gift card
+func giftCardCrumbs(card models.GiftCard) []templates.Breadcrumb {
+	return []templates.Breadcrumb{
+		{Label: "Gift Cards", URL: "/gift-cards"},
+		{Label: card.FormattedCode(), URL: "/gift-cards/" + card.ID},
+	}
+}
+
+// parseGiftCardAmount reads an amount typed into a gift card form
+func parseGiftCardAmount(value string) (money.Amount, error) {
+	amount, err := money.ParseInput(value)
+	if err != nil {
+		return 0, fmt.Errorf("Amount must be a number with at most two decimals, e.g. 25 or 49.99")
+	}
+	return amount, nil
+}
+
+// parseGiftCardExpiry reads a date input as the end of that day in the server's time zone;
+// empty means the card never expires
+func parseGiftCardExpiry(value string) (*time.Time, error) {
+	if value == "" {
+		return nil, nil
+	}
+	day, err := time.ParseInLocation("2006-01-02", value, time.Local)
+	if err != nil {
+		return nil, fmt.Errorf("Expiry isn't a valid date")
+	}
+	expires := day.AddDate(0, 0, 1)
+	return &expires, nil
+}
+
+// ListGiftCards shows gift cards, optionally those whose code starts with ?q=
+func (h *Handler) ListGiftCards(w http.ResponseWriter, r *http.Request) {
+	h.renderGiftCardList(w, r, http.StatusOK, "")
+}
+
+// renderGiftCardList shows the gift card list and issue form, with errorMsg explaining why the
+// last card wasn't issued
+func (h *Handler) renderGiftCardList(w http.ResponseWriter, r *http.Request, status int, errorMsg string) {
+	search := r.URL.Query().Get("q")
+	cards, err := models.GetGiftCards(h.db(r), search)
+	if err != nil {
+		writeFailure(w, r, "getting gift cards", err)
+		return
+	}
+	if wantsJSON(r) {
+		writeList(w, r, models.SinglePage(cards))
+		return
+	}
+
+	w.WriteHeader(status)
+	ctx := withCrumbs(r, templates.Breadcrumb{Label: "Gift Cards"})
+	render(w, r.WithContext(ctx), templates.GiftCardList(cards, search, time.Now(), errorMsg))
+}
+
+// IssueGiftCard creates a gift card with a new code and opens it, so the code can be handed on
+func (h *Handler) IssueGiftCard(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		Amount    money.Amount `json:"amount"`
+		ExpiresAt *time.Time   `json:"expires_at"`
+		Note      string       `json:"note"`
+	}
+	var err error
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "application/json") {
+		if err = json.NewDecoder(r.Body).Decode(&body); err != nil {
+			err = fmt.Errorf("Invalid JSON: expected amount, expires_at and note")
+		}
+	} else if err = r.ParseForm(); err != nil {
+		err = fmt.Errorf("Invalid form data")
+	} else {
+		body.Note = r.FormValue("note")
+		if body.Amount, err = parseGiftCardAmount(r.FormValue("amount")); err == nil {
+			body.ExpiresAt, err = parseGiftCardExpiry(r.FormValue("expires_on"))
+		}
+	}
+
+	var card models.GiftCard
+	if err == nil {
+		card, err = models.IssueGiftCard(h.db(r), body.Amount, body.ExpiresAt, body.Note, h.Session.GetString(r.Context(), "username"))
+	}
+	if err != nil {
+		if status, _ := classifyError(err); wantsJSON(r) || status != http.StatusBadRequest {
+			writeFailure(w, r, "issuing gift card", err)
+			return
+		}
+		h.renderGiftCardList(w, r, http.StatusUnprocessableEntity, publicMessage(err, "issuing gift card"))
+		return
+	}
+
+	if wantsJSON(r) {
+		writeJSON(w, http.StatusCreated, card)
+		return
+	}
+	http.Redirect(w, r, "/gift-cards/"+card.ID, http.StatusSeeOther)
+}
+
+// GiftCard shows a gift card with its full history
+func (h *Handler) GiftCard(w http.ResponseWriter, r *http.Request) {
+	h.renderGiftCard(w, r, http.StatusOK, "")
+}
+
+// renderGiftCard shows a gift card, with errorMsg explaining why the last adjustment was turned down
+func (h *Handler) renderGiftCard(w http.ResponseWriter, r *http.Request, status int, errorMsg string) {
+	card, err := models.GetGiftCardByID(h.db(r), chi.URLParam(r, "id"))
+	if err != nil {
+		writeFailure(w, r, "getting gift card", err)
+		return
+	}
+	transactions, err := models.GetGiftCardTransactions(h.db(r), card.ID)
+	if err != nil {
+		writeFailure(w, r, "getting gift card transactions", err)
+		return
+	}
+	if wantsJSON(r) {
+		writeJSON(w, status, struct {
+			models.GiftCard
+			Transactions []models.GiftCardTransaction `json:"transactions"`
+		}{card, transactions})
+		return
+	}
+
+	w.WriteHeader(status)
+	ctx := withCrumbs(r, current(giftCardCrumbs(card))...)
+	render(w, r.WithContext(ctx), templates.GiftCardView(card, transactions, time.Now(), errorMsg))
+}
+
+// AdjustGiftCard adds to or takes from a card's balance, with the reason kept in its history
+func (h *Handler) AdjustGiftCard(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+
+	var body struct {
+		Amount money.Amount `json:"amount"` // Negative to take off
+		Reason string       `json:"reason"`
+	}
+	var err error
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "application/json") {
+		if err = json.NewDecoder(r.Body).Decode(&body); err != nil {
+			err = fmt.Errorf("Invalid JSON: expected amount and reason")
+		}
+	} else if err = r.ParseForm(); err != nil {
+		err = fmt.Errorf("Invalid form data")
+	} else {
+		body.Reason = r.FormValue("reason")
+		if body.Amount, err = parseGiftCardAmount(r.FormValue("amount")); err == nil && r.FormValue("direction") == "remove" {
+			body.Amount = -body.Amount
+		}
+	}
+
+	if err == nil {
+		_, err = models.AdjustGiftCard(h.db(r), id, body.Amount, body.Reason, h.Session.GetString(r.Context(), "username"))
+	}
+	if err != nil {
+		if status, _ := classifyError(err); wantsJSON(r) || (status != http.StatusBadRequest && status != http.StatusConflict) {
+			writeFailure(w, r, "adjusting gift card", err)
+			return
+		}
+		h.renderGiftCard(w, r, http.StatusUnprocessableEntity, publicMessage(err, "adjusting gift card"))
+		return
+	}
+
+	if wantsJSON(r) {
+		h.renderGiftCard(w, r, http.StatusOK, "")
+		return
+	}
+	http.Redirect(w, r, "/gift-cards/"+id, http.StatusSeeOther)
+}
+
+// decodeGiftCardCheck reads a validate or redeem request, writing the error response itself
+// when it is invalid
+func decodeGiftCardCheck(w http.ResponseWriter, r *http.Request, redeem bool) (giftCardCheck, bool) {
+	var body giftCardCheck
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 16<<10)).Decode(&body); err != nil {
+		writeError(w, r, http.StatusBadRequest, "Invalid JSON body")
+		return body, false
+	}
+
+	invalid := httperr.New(http.StatusUnprocessableEntity, "The gift card request is invalid")
+	if strings.TrimSpace(body.Code) == "" {
+		invalid.WithField("code", "is required")
+	}
+	if redeem && body.Amount <= 0 {
+		invalid.WithField("amount", "must be greater than zero")
+	}
+	if redeem && strings.TrimSpace(body.Reference) == "" {
+		invalid.WithField("reference", "is required")
+	}
+	if len(invalid.Fields) > 0 {
+		writeHTTPError(w, r, invalid)
+		return body, false
+	}
+	return body, true
+}
+
+// ValidateGiftCardAPI tells the storefront whether a code can be spent and how much is on it
+func (h *Handler) ValidateGiftCardAPI(w http.ResponseWriter, r *http.Request) {
+	body, ok := decodeGiftCardCheck(w, r, false)
+	if !ok {
+		return
+	}
+
+	card, err := models.ValidateGiftCard(h.db(r), body.Code, time.Now())
+	if err != nil {
+		writeFailure(w, r, "checking gift card", err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, giftCardBalance{Code: card.FormattedCode(), Balance: card.Balance, ExpiresAt: card.ExpiresAt})
+}
+
+// RedeemGiftCardAPI spends part or all of a card's balance on a storefront order. Retrying with
+// the same reference returns the first redemption rather than charging the card again.
+func (h *Handler) RedeemGiftCardAPI(w http.ResponseWriter, r *http.Request) {
+	body, ok := decodeGiftCardCheck(w, r, true)
+	if !ok {
+		return
+	}
+
+	redemption, card, err := models.RedeemGiftCard(h.db(r), body.Code, body.Amount, body.Reference, time.Now())
+	if err != nil {
+		writeFailure(w, r, "redeeming gift card", err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, giftCardRedemption{
+		giftCardBalance: giftCardBalance{Code: card.FormattedCode(), Balance: card.Balance, ExpiresAt: card.ExpiresAt},
+		Redeemed:        -redemption.Amount,
+		TransactionID:   redemption.ID,
+	})
+}
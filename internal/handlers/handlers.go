@@ -1,7 +1,8 @@
 package handlers
 
 import (
-	"context"
+	"bytes"
+	"errors"
 	"fmt"
 	"io"
 	"log"
@@ -13,13 +14,18 @@ import (
 	"github.com/alexedwards/scs/v2"
 	"github.com/go-chi/chi/v5"
 	"github.com/ngenohkevin/kuiper_admin/internal/database"
+	"github.com/ngenohkevin/kuiper_admin/internal/imagecache"
+	custommiddleware "github.com/ngenohkevin/kuiper_admin/internal/middleware"
 	"github.com/ngenohkevin/kuiper_admin/internal/models"
+	"github.com/ngenohkevin/kuiper_admin/internal/money"
+	"github.com/ngenohkevin/kuiper_admin/internal/storage"
 	"github.com/ngenohkevin/kuiper_admin/internal/templates"
 )
 
 type Handler struct {
 	DB      *database.DB
 	Session *scs.SessionManager
+	Images  *imagecache.Cache // Images the image proxy has fetched
 }
 
 // New creates a new handler instance
@@ -27,153 +33,158 @@ func New(db *database.DB, session *scs.SessionManager) *Handler {
 	return &Handler{
 		DB:      db,
 		Session: session,
+		Images:  imagecache.New(imagecache.ConfigFromEnv()),
 	}
 }
 
-// Home handles the homepage request
-func (h *Handler) Home(w http.ResponseWriter, r *http.Request) {
-	// Get counts for each entity
-	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second) // Increased timeout
-	defer cancel()
-
-	var categoriesCount, productsCount, reviewsCount int
-
-	// Try to connect to the database and get counts with retries
-	maxRetries := 3
-	for i := 0; i < maxRetries; i++ {
-		var err1, err2, err3 error
-
-		// Get categories count
-		err1 = h.DB.Pool.QueryRow(ctx, "SELECT COUNT(*) FROM categories").Scan(&categoriesCount)
-
-		// Get products count
-		err2 = h.DB.Pool.QueryRow(ctx, "SELECT COUNT(*) FROM products").Scan(&productsCount)
+// db is the database of the request's tenant, scoped to the request so its queries stop when
+// the client goes away
+func (h *Handler) db(r *http.Request) *database.DB {
+	return database.FromContext(r.Context(), h.DB).WithContext(r.Context())
+}
 
-		// Get reviews count
-		err3 = h.DB.Pool.QueryRow(ctx, "SELECT COUNT(*) FROM reviews").Scan(&reviewsCount)
+// detachedDB is the database of the request's tenant for work started in the background, which
+// carries on after the response is sent
+func (h *Handler) detachedDB(r *http.Request) *database.DB {
+	return database.FromContext(r.Context(), h.DB)
+}
 
-		// If all queries succeeded, break the loop
-		if err1 == nil && err2 == nil && err3 == nil {
-			break
-		}
+// Home handles the homepage request
+func (h *Handler) Home(w http.ResponseWriter, r *http.Request) {
+	stats, err := models.GetDashboardStats(h.db(r))
+	if err != nil {
+		log.Printf("Database error getting dashboard stats: %v", err)
+		writeError(w, r, http.StatusInternalServerError, "Error getting dashboard stats")
+		return
+	}
 
-		// If this was the last attempt and we still have errors
-		if i == maxRetries-1 {
-			if err1 != nil {
-				log.Printf("Database error getting categories count: %v", err1)
-				http.Error(w, "Error getting categories count", http.StatusInternalServerError)
-				return
-			}
-			if err2 != nil {
-				log.Printf("Database error getting products count: %v", err2)
-				http.Error(w, "Error getting products count", http.StatusInternalServerError)
-				return
-			}
-			if err3 != nil {
-				log.Printf("Database error getting reviews count: %v", err3)
-				http.Error(w, "Error getting reviews count", http.StatusInternalServerError)
-				return
-			}
+	// The setup checklist is left out once it's finished or the admin has hidden it
+	var onboarding models.Onboarding
+	if !models.PreferencesFromContext(r.Context()).HideOnboarding {
+		onboarding, err = models.GetOnboarding(h.db(r), h.storefrontBaseURL(r) != "", storage.Configured())
+		if err != nil {
+			// The checklist is a guide, not the page itself, so carry on without it
+			log.Printf("Error checking onboarding steps: %v", err)
 		}
+	}
 
-		// Wait a bit before retrying
-		time.Sleep(500 * time.Millisecond)
+	favorites, err := models.GetFavorites(h.db(r), h.Session.GetString(r.Context(), "username"))
+	if err != nil {
+		// Shortcuts, like the checklist, aren't worth failing the page over
+		log.Printf("Error getting favorites: %v", err)
 	}
 
-	templates.Home(categoriesCount, productsCount, reviewsCount).Render(r.Context(), w)
+	render(w, r, templates.Home(stats, onboarding, favorites, h.recentlyViewed(r)))
 }
 
 // CATEGORY HANDLERS
 
-// ListCategories handles the request to list all categories
-func (h *Handler) ListCategories(w http.ResponseWriter, r *http.Request) {
-	// Check if search query parameter exists
-	searchQuery := r.URL.Query().Get("q")
-
-	var categories []models.Category
-	var err error
-
-	if searchQuery != "" {
-		// If search query exists, search for matching categories
-		categories, err = models.SearchCategories(h.DB, searchQuery)
-	} else {
-		// Otherwise, get all categories
-		categories, err = models.GetAllCategories(h.DB)
+// loadCategories fetches the (cached) category list used by forms and views,
+// writing the error response itself when the lookup fails
+func (h *Handler) loadCategories(w http.ResponseWriter, r *http.Request) ([]models.Category, bool) {
+	categories, err := models.GetAllCategories(h.db(r))
+	if err != nil {
+		writeFailure(w, r, "getting categories", err)
+		return nil, false
 	}
+	return categories, true
+}
 
+// ListCategories handles the request to list categories, a page at a time
+func (h *Handler) ListCategories(w http.ResponseWriter, r *http.Request) {
+	query := listQuery(r, "level", models.CategorySorts)
+	result, err := models.GetCategoriesPaginated(h.db(r), query)
 	if err != nil {
-		http.Error(w, fmt.Sprintf("Error getting categories: %v", err), http.StatusInternalServerError)
+		writeFailure(w, r, "getting categories", err)
+		return
+	}
+	if wantsJSON(r) {
+		writeList(w, r, result)
+		return
+	}
+
+	// Parents may be on another page, so their names come from the full list
+	categories, ok := h.loadCategories(w, r)
+	if !ok {
 		return
 	}
 
-	templates.CategoryList(categories).Render(r.Context(), w)
+	h.rememberList(r, "/categories")
+	state := templates.NewListState("/categories", "categories", "level", query, result)
+	state.ExportPath = "/categories/export"
+	render(w, r, templates.CategoryList(state, result.Data, categories))
 }
 
 // GetCategory handles the request to view a single category
 func (h *Handler) GetCategory(w http.ResponseWriter, r *http.Request) {
 	id := chi.URLParam(r, "id")
 	if id == "" {
-		http.Error(w, "Missing category ID", http.StatusBadRequest)
+		writeError(w, r, http.StatusBadRequest, "Missing category ID")
 		return
 	}
 
-	category, err := models.GetCategoryByID(h.DB, id)
+	category, err := models.GetCategoryByID(h.db(r), id)
 	if err != nil {
-		http.Error(w, fmt.Sprintf("Error getting category: %v", err), http.StatusInternalServerError)
+		writeFailure(w, r, "getting category", err)
 		return
 	}
 
 	// Get all categories for parent lookup
-	categories, err := models.GetAllCategories(h.DB)
-	if err != nil {
-		http.Error(w, fmt.Sprintf("Error getting categories: %v", err), http.StatusInternalServerError)
+	categories, ok := h.loadCategories(w, r)
+	if !ok {
 		return
 	}
 
-	templates.CategoryView(category, categories).Render(r.Context(), w)
+	h.recordView(r, models.ActivityCategory, category.ID)
+	r = h.withFavorites(r, models.ActivityCategory)
+	ctx := withCrumbs(r, current(h.categoryCrumbs(r, category, categories))...)
+	render(w, r.WithContext(ctx), templates.CategoryView(category, categories))
 }
 
 // NewCategoryForm handles the request to show the form for creating a new category
 func (h *Handler) NewCategoryForm(w http.ResponseWriter, r *http.Request) {
 	// Get all categories for parent dropdown
-	categories, err := models.GetAllCategories(h.DB)
-	if err != nil {
-		http.Error(w, fmt.Sprintf("Error getting categories: %v", err), http.StatusInternalServerError)
+	categories, ok := h.loadCategories(w, r)
+	if !ok {
 		return
 	}
 
-	templates.CategoryForm(nil, categories, false).Render(r.Context(), w)
+	ctx := withCrumbs(r,
+		templates.Breadcrumb{Label: "Categories", URL: h.listURL(r, "/categories")},
+		templates.Breadcrumb{Label: "New category"},
+	)
+	render(w, r.WithContext(ctx), templates.CategoryForm(nil, categories, false))
 }
 
 // EditCategoryForm handles the request to show the form for editing a category
 func (h *Handler) EditCategoryForm(w http.ResponseWriter, r *http.Request) {
 	id := chi.URLParam(r, "id")
 	if id == "" {
-		http.Error(w, "Missing category ID", http.StatusBadRequest)
+		writeError(w, r, http.StatusBadRequest, "Missing category ID")
 		return
 	}
 
-	category, err := models.GetCategoryByID(h.DB, id)
+	category, err := models.GetCategoryByID(h.db(r), id)
 	if err != nil {
-		http.Error(w, fmt.Sprintf("Error getting category: %v", err), http.StatusInternalServerError)
+		writeFailure(w, r, "getting category", err)
 		return
 	}
 
 	// Get all categories for parent dropdown
-	categories, err := models.GetAllCategories(h.DB)
-	if err != nil {
-		http.Error(w, fmt.Sprintf("Error getting categories: %v", err), http.StatusInternalServerError)
+	categories, ok := h.loadCategories(w, r)
+	if !ok {
 		return
 	}
 
-	templates.CategoryForm(&category, categories, true).Render(r.Context(), w)
+	ctx := withCrumbs(r, append(h.categoryCrumbs(r, category, categories), templates.Breadcrumb{Label: "Edit"})...)
+	render(w, r.WithContext(ctx), templates.CategoryForm(&category, categories, true))
 }
 
 // CreateCategory handles the request to create a new category
 func (h *Handler) CreateCategory(w http.ResponseWriter, r *http.Request) {
 	// Parse form
 	if err := r.ParseForm(); err != nil {
-		http.Error(w, "Invalid form data", http.StatusBadRequest)
+		writeError(w, r, http.StatusBadRequest, "Invalid form data")
 		return
 	}
 
@@ -183,7 +194,7 @@ func (h *Handler) CreateCategory(w http.ResponseWriter, r *http.Request) {
 
 	// Validate required fields
 	if name == "" || slug == "" {
-		http.Error(w, "Name and slug are required", http.StatusBadRequest)
+		writeError(w, r, http.StatusBadRequest, "Name and slug are required")
 		return
 	}
 
@@ -195,37 +206,39 @@ func (h *Handler) CreateCategory(w http.ResponseWriter, r *http.Request) {
 
 	// If parent_id is set, verify that it exists
 	if parentIDPtr != nil {
-		_, err := models.GetCategoryByID(h.DB, *parentIDPtr)
+		_, err := models.GetCategoryByID(h.db(r), *parentIDPtr)
 		if err != nil {
 			log.Printf("Parent category with ID %s not found: %v", *parentIDPtr, err)
-			http.Error(w, fmt.Sprintf("Parent category not found: %v", err), http.StatusBadRequest)
+			writeError(w, r, http.StatusBadRequest, "Parent category not found")
 			return
 		}
 	}
 
 	// Create the category
-	_, err := models.CreateCategory(h.DB, name, slug, parentIDPtr)
+	category, err := models.CreateCategory(h.db(r), name, slug, parentIDPtr)
 	if err != nil {
 		log.Printf("Error creating category: %v", err)
-		http.Error(w, fmt.Sprintf("Error creating category: %v", err), http.StatusInternalServerError)
+		writeFailure(w, r, "creating category", err)
 		return
 	}
+	h.recordActivity(r, models.ActivityCategory, category.ID, models.ActivityCreated, "Created as "+category.Name)
+	h.auditCreate(r, models.ActivityCategory, category.ID, category)
 
-	// Redirect to the categories list
-	http.Redirect(w, r, "/categories", http.StatusSeeOther)
+	// Redirect to the categories list, where the admin left it
+	http.Redirect(w, r, h.listURL(r, "/categories"), http.StatusSeeOther)
 }
 
 // UpdateCategory handles the request to update a category
 func (h *Handler) UpdateCategory(w http.ResponseWriter, r *http.Request) {
 	id := chi.URLParam(r, "id")
 	if id == "" {
-		http.Error(w, "Missing category ID", http.StatusBadRequest)
+		writeError(w, r, http.StatusBadRequest, "Missing category ID")
 		return
 	}
 
 	// Parse form
 	if err := r.ParseForm(); err != nil {
-		http.Error(w, "Invalid form data", http.StatusBadRequest)
+		writeError(w, r, http.StatusBadRequest, "Invalid form data")
 		return
 	}
 
@@ -235,7 +248,7 @@ func (h *Handler) UpdateCategory(w http.ResponseWriter, r *http.Request) {
 
 	// Validate required fields
 	if name == "" || slug == "" {
-		http.Error(w, "Name and slug are required", http.StatusBadRequest)
+		writeError(w, r, http.StatusBadRequest, "Name and slug are required")
 		return
 	}
 
@@ -245,12 +258,22 @@ func (h *Handler) UpdateCategory(w http.ResponseWriter, r *http.Request) {
 		parentIDPtr = &parentID
 	}
 
+	before, err := models.GetCategoryByID(h.db(r), id)
+	if err != nil {
+		writeFailure(w, r, "getting category", err)
+		return
+	}
+
 	// Update the category
-	_, err := models.UpdateCategory(h.DB, id, name, slug, parentIDPtr)
+	category, err := models.UpdateCategory(h.db(r), id, name, slug, parentIDPtr)
 	if err != nil {
-		http.Error(w, fmt.Sprintf("Error updating category: %v", err), http.StatusInternalServerError)
+		writeFailure(w, r, "updating category", err)
 		return
 	}
+	if changes := models.CategoryChanges(before, category); len(changes) > 0 {
+		h.recordActivity(r, models.ActivityCategory, id, models.ActivityUpdated, strings.Join(changes, "; "))
+	}
+	h.auditUpdate(r, models.ActivityCategory, id, models.DiffFields(before, category))
 
 	// Redirect to the category view
 	http.Redirect(w, r, "/categories/"+id, http.StatusSeeOther)
@@ -260,19 +283,20 @@ func (h *Handler) UpdateCategory(w http.ResponseWriter, r *http.Request) {
 func (h *Handler) DeleteCategory(w http.ResponseWriter, r *http.Request) {
 	id := chi.URLParam(r, "id")
 	if id == "" {
-		http.Error(w, "Missing category ID", http.StatusBadRequest)
+		writeError(w, r, http.StatusBadRequest, "Missing category ID")
 		return
 	}
 
 	// Delete the category
-	err := models.DeleteCategory(h.DB, id)
+	err := models.DeleteCategory(h.db(r), id)
 	if err != nil {
-		http.Error(w, fmt.Sprintf("Error deleting category: %v", err), http.StatusInternalServerError)
+		writeFailure(w, r, "deleting category", err)
 		return
 	}
+	h.recordActivity(r, models.ActivityCategory, id, models.ActivityDeleted, "Moved to the trash")
 
-	// For HTMX delete requests, just return 200 OK
-	w.WriteHeader(http.StatusOK)
+	// For HTMX delete requests, return 200 OK with an undo toast
+	writeUndoToast(w, r, "Category deleted", "/categories/"+id+"/restore")
 }
 
 // PRODUCT HANDLERS
@@ -287,99 +311,211 @@ func (h *Handler) ListProducts(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
-	pageSize := 15
-	if ps := r.URL.Query().Get("limit"); ps != "" {
-		if parsedSize, err := strconv.Atoi(ps); err == nil && parsedSize > 0 && parsedSize <= 100 {
-			pageSize = parsedSize
-		}
+	// Defaults come from the admin's saved preferences
+	filters := productListFilters(r)
+	pageSize, sort := listDefaults(r)
+	if filters.Limit > 0 {
+		pageSize = filters.Limit
 	}
+	if filters.Sort != "" {
+		sort = filters.Sort
+	}
+	searchQuery, categoryID, includeArchived := filters.Search, filters.Category, filters.Archived
+	r = h.withFavorites(r, models.ActivityProduct)
 
-	// Check if search query parameter exists
-	searchQuery := r.URL.Query().Get("q")
-	categoryID := r.URL.Query().Get("category")
-
-	if searchQuery != "" {
+	if filters.Favorites {
+		// Favorites are a short list, shown whole like search results
+		username := h.Session.GetString(r.Context(), "username")
+		products, err := models.GetFavoriteProducts(h.db(r), username, searchQuery, includeArchived)
+		if err != nil {
+			writeFailure(w, r, "getting favorite products", err)
+			return
+		}
+		h.rememberList(r, "/products")
+		products = inCategory(products, categoryID)
+		render(w, r, templates.ModernProductList(h.withSales(r, products), filters, productExportURL(r)))
+	} else if searchQuery != "" {
 		// If search query exists, search for matching products (no pagination for search yet)
-		products, err := models.SearchProducts(h.DB, searchQuery)
+		products, err := models.SearchProducts(h.db(r), searchQuery, includeArchived)
 		if err != nil {
-			http.Error(w, fmt.Sprintf("Error searching products: %v", err), http.StatusInternalServerError)
+			writeFailure(w, r, "searching products", err)
 			return
 		}
-		templates.ModernProductList(products).Render(r.Context(), w)
+		h.rememberList(r, "/products")
+		products = inCategory(products, categoryID)
+		filters.SearchID = h.logAdminSearch(r, searchQuery, len(products))
+		render(w, r, templates.ModernProductList(h.withSales(r, products), filters, productExportURL(r)))
 	} else {
+		// Infinite scroll moves through the list by cursor rather than page number
+		cursor := r.URL.Query().Get("cursor")
+		scroll := models.PreferencesFromContext(r.Context()).ProductListMode == models.ProductListScroll
+		if scroll {
+			page = 1
+		}
+
 		// Use pagination
-		result, err := models.GetProductsPaginated(h.DB, page, pageSize, categoryID, "")
+		result, err := models.GetProductsPaginated(h.db(r), page, pageSize, categoryID, "", sort, cursor, includeArchived)
 		if err != nil {
-			http.Error(w, fmt.Sprintf("Error getting products: %v", err), http.StatusInternalServerError)
+			writeFailure(w, r, "getting products", err)
+			return
+		}
+		paged := *result
+		paged.Data = h.withSales(r, result.Data)
+
+		var nextURL string
+		if (scroll || cursor != "") && result.HasNext {
+			nextURL = productScrollURL(r, result.NextCursor)
+		}
+
+		// The scroll sentinel only needs the next rows, to append to the grid
+		if cursor != "" && r.Header.Get("HX-Request") == "true" {
+			render(w, r, templates.ProductScrollPage(paged.Data, nextURL))
 			return
 		}
 
 		// Pass pagination result to template with full metadata
-		templates.ModernProductListPaginated(*result).Render(r.Context(), w)
+		h.rememberList(r, "/products")
+		render(w, r, templates.ModernProductListPaginated(paged, filters, productExportURL(r), nextURL))
+	}
+}
+
+// productListFilters reads the product list's filters from the request's URL, ignoring a page
+// size out of range
+func productListFilters(r *http.Request) templates.ProductListFilters {
+	query := r.URL.Query()
+	filters := templates.ProductListFilters{
+		Search:    query.Get("q"),
+		Category:  query.Get("category"),
+		Sort:      query.Get("sort"),
+		Archived:  query.Get("archived") == "1",
+		Favorites: query.Get("favorites") == "1",
+	}
+	if limit, err := strconv.Atoi(query.Get("limit")); err == nil && limit > 0 && limit <= 100 {
+		filters.Limit = limit
+	}
+	return filters
+}
+
+// inCategory narrows search results to a category, or leaves them be without one
+func inCategory(products []models.Product, categoryID string) []models.Product {
+	if categoryID == "" {
+		return products
+	}
+	var matching []models.Product
+	for _, p := range products {
+		if p.CategoryID != nil && *p.CategoryID == categoryID {
+			matching = append(matching, p)
+		}
 	}
+	return matching
+}
+
+// productScrollURL loads the page of the product list after cursor, keeping the request's
+// filters and sort
+func productScrollURL(r *http.Request, cursor string) string {
+	query := r.URL.Query()
+	query.Del("page")
+	query.Set("cursor", cursor)
+	return "/products?" + query.Encode()
 }
 
 // GetProduct handles the request to view a single product
 func (h *Handler) GetProduct(w http.ResponseWriter, r *http.Request) {
 	id := chi.URLParam(r, "id")
 	if id == "" {
-		http.Error(w, "Missing product ID", http.StatusBadRequest)
+		writeError(w, r, http.StatusBadRequest, "Missing product ID")
 		return
 	}
 
-	product, err := models.GetProductByID(h.DB, id)
+	product, err := models.GetProductByID(h.db(r), id)
 	if err != nil {
-		http.Error(w, fmt.Sprintf("Error getting product: %v", err), http.StatusInternalServerError)
+		writeFailure(w, r, "getting product", err)
+		return
+	}
+	product = h.withSales(r, []models.Product{product})[0]
+
+	// Opened from the results of a logged search on the product list
+	if searchID := r.URL.Query().Get("search_id"); searchID != "" {
+		if err := models.RecordSearchClick(h.db(r), searchID, product.ID); err != nil {
+			log.Printf("Error recording search click on product %s: %v", id, err)
+		}
+	}
+
+	if wantsJSON(r) {
+		writeJSON(w, http.StatusOK, product)
 		return
 	}
 
-	templates.ModernProductView(product).Render(r.Context(), w)
+	// Presets only feed the quick add buttons, so the page still renders without them
+	presets, err := models.GetWeightPresetsForCategory(h.db(r), product.CategoryID)
+	if err != nil {
+		log.Printf("Error getting weight presets for product %s: %v", id, err)
+	}
+
+	autoAvailability, err := models.GetAutoAvailability(h.db(r), id)
+	if err != nil {
+		log.Printf("Error getting auto availability for product %s: %v", id, err)
+	}
+	availabilityChanges, err := models.GetAvailabilityChanges(h.db(r), id, 5)
+	if err != nil {
+		log.Printf("Error getting availability changes for product %s: %v", id, err)
+	}
+
+	h.recordView(r, models.ActivityProduct, product.ID)
+	r = h.withFavorites(r, models.ActivityProduct)
+	ctx := withCrumbs(r, current(h.productCrumbs(r, product))...)
+	render(w, r.WithContext(ctx), templates.ModernProductView(product, h.storefrontLinks(r, product), presets, autoAvailability, availabilityChanges))
 }
 
 // NewProductForm handles the request to show the form for creating a new product
 func (h *Handler) NewProductForm(w http.ResponseWriter, r *http.Request) {
 	// Get all categories for dropdown
-	categories, err := models.GetAllCategories(h.DB)
-	if err != nil {
-		http.Error(w, fmt.Sprintf("Error getting categories: %v", err), http.StatusInternalServerError)
+	categories, ok := h.loadCategories(w, r)
+	if !ok {
 		return
 	}
 
-	templates.ModernProductForm(nil, categories, false).Render(r.Context(), w)
+	ctx := withCrumbs(r,
+		templates.Breadcrumb{Label: "Products", URL: h.listURL(r, "/products")},
+		templates.Breadcrumb{Label: "New product"},
+	)
+	render(w, r.WithContext(ctx), templates.ModernProductForm(nil, categories, false))
 }
 
 // EditProductForm handles the request to show the form for editing a product
 func (h *Handler) EditProductForm(w http.ResponseWriter, r *http.Request) {
 	id := chi.URLParam(r, "id")
 	if id == "" {
-		http.Error(w, "Missing product ID", http.StatusBadRequest)
+		writeError(w, r, http.StatusBadRequest, "Missing product ID")
 		return
 	}
 
-	product, err := models.GetProductByID(h.DB, id)
+	product, err := models.GetProductByID(h.db(r), id)
 	if err != nil {
-		http.Error(w, fmt.Sprintf("Error getting product: %v", err), http.StatusInternalServerError)
+		writeFailure(w, r, "getting product", err)
 		return
 	}
 
 	// Get all categories for dropdown
-	categories, err := models.GetAllCategories(h.DB)
-	if err != nil {
-		http.Error(w, fmt.Sprintf("Error getting categories: %v", err), http.StatusInternalServerError)
+	categories, ok := h.loadCategories(w, r)
+	if !ok {
 		return
 	}
 
 	// Use only ModernProductForm to fix the duplication issue
-	templates.ModernProductForm(&product, categories, true).Render(r.Context(), w)
+	ctx := withCrumbs(r, append(h.productCrumbs(r, product), templates.Breadcrumb{Label: "Edit"})...)
+	render(w, r.WithContext(ctx), templates.ModernProductForm(&product, categories, true))
 }
 
 // CreateProduct handles the request to create a new product
 func (h *Handler) CreateProduct(w http.ResponseWriter, r *http.Request) {
-	// Parse form
-	if err := r.ParseForm(); err != nil {
-		http.Error(w, "Invalid form data", http.StatusBadRequest)
+	if err := parseProductForm(w, r); err != nil {
+		writeError(w, r, http.StatusBadRequest, "Invalid form data, or the images are too large")
 		return
 	}
+	if r.MultipartForm != nil {
+		defer r.MultipartForm.RemoveAll()
+	}
 
 	name := r.FormValue("name")
 	slug := r.FormValue("slug")
@@ -387,40 +523,29 @@ func (h *Handler) CreateProduct(w http.ResponseWriter, r *http.Request) {
 	description := r.FormValue("description")
 	priceStr := r.FormValue("price")
 	stockCountStr := r.FormValue("stock_count")
-	imageURLsStr := r.FormValue("image_urls")
 	isAvailableStr := r.FormValue("is_available")
 	enableVariantsStr := r.FormValue("enable_variants")
 
 	// Validate required fields
 	if name == "" || slug == "" || priceStr == "" || stockCountStr == "" {
-		http.Error(w, "Name, slug, price, and stock count are required", http.StatusBadRequest)
+		writeError(w, r, http.StatusBadRequest, "Name, slug, price, and stock count are required")
 		return
 	}
 
 	// Parse numeric values
-	price, err := strconv.ParseFloat(priceStr, 64)
+	price, err := money.ParseInput(priceStr)
 	if err != nil {
-		http.Error(w, "Invalid price", http.StatusBadRequest)
+		writeError(w, r, http.StatusBadRequest, "Invalid price: "+err.Error())
 		return
 	}
 
 	stockCount, err := strconv.Atoi(stockCountStr)
 	if err != nil {
-		http.Error(w, "Invalid stock count", http.StatusBadRequest)
+		writeError(w, r, http.StatusBadRequest, "Invalid stock count")
 		return
 	}
 
-	// Parse image URLs
-	var imageURLs []string
-	if imageURLsStr != "" {
-		// Split by newline and filter empty strings
-		for _, url := range strings.Split(imageURLsStr, "\n") {
-			trimmedURL := strings.TrimSpace(url)
-			if trimmedURL != "" {
-				imageURLs = append(imageURLs, trimmedURL)
-			}
-		}
-	}
+	imageURLs := productFormImageURLs(r)
 
 	// Handle optional category ID
 	var categoryIDPtr *string
@@ -428,10 +553,10 @@ func (h *Handler) CreateProduct(w http.ResponseWriter, r *http.Request) {
 		categoryIDPtr = &categoryID
 
 		// Verify that the category exists
-		_, err := models.GetCategoryByID(h.DB, categoryID)
+		_, err := models.GetCategoryByID(h.db(r), categoryID)
 		if err != nil {
 			log.Printf("Category with ID %s not found: %v", categoryID, err)
-			http.Error(w, fmt.Sprintf("Category not found: %v", err), http.StatusBadRequest)
+			writeError(w, r, http.StatusBadRequest, "Category not found")
 			return
 		}
 	}
@@ -443,18 +568,53 @@ func (h *Handler) CreateProduct(w http.ResponseWriter, r *http.Request) {
 	hasVariants := enableVariantsStr == "true"
 	log.Printf("Enable variants: %s, hasVariants: %v", enableVariantsStr, hasVariants)
 
+	orderOptions, hasOrderOptions, err := parseOrderOptions(r)
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+	sku, cost, hasCosting, err := parseProductCosting(r)
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	// Upload last, so a form turned down for anything else leaves nothing behind in storage
+	uploaded, err := saveProductFormImages(r)
+	if err != nil {
+		writeError(w, r, http.StatusUnprocessableEntity, err.Error())
+		return
+	}
+	imageURLs = append(imageURLs, uploaded...)
+
 	// Create the product
-	product, err := models.CreateProduct(h.DB, categoryIDPtr, name, slug, description, price, imageURLs, stockCount, isAvailable, hasVariants)
+	product, err := models.CreateProduct(h.db(r), categoryIDPtr, name, slug, description, price, imageURLs, stockCount, isAvailable, hasVariants)
 	if err != nil {
-		log.Printf("Error creating product: %v", err)
+		removeUploadedImages(r.Context(), uploaded)
 		// Check for duplicate slug error
-		if strings.Contains(err.Error(), "products_slug_key") {
-			http.Error(w, fmt.Sprintf("A product with slug '%s' already exists. Please use a different slug.", slug), http.StatusConflict)
+		if isUniqueViolation(err) {
+			writeError(w, r, http.StatusConflict, fmt.Sprintf("A product with slug '%s' already exists. Please use a different slug.", slug))
 			return
 		}
-		http.Error(w, fmt.Sprintf("Error creating product: %v", err), http.StatusInternalServerError)
+		writeFailure(w, r, "creating product", err)
 		return
 	}
+	h.recordActivity(r, models.ActivityProduct, product.ID, models.ActivityCreated, "Created at "+product.Price.Format()+" with "+strconv.Itoa(product.StockCount)+" in stock")
+	h.auditCreate(r, models.ActivityProduct, product.ID, product)
+	h.queueUploadedImages(r, product.ID, uploaded)
+
+	if hasOrderOptions {
+		if err := models.SetProductOrderOptions(h.db(r), product.ID, orderOptions); err != nil {
+			writeFailure(w, r, "saving order options", err)
+			return
+		}
+	}
+	if hasCosting {
+		if err := models.SetProductCosting(h.db(r), product.ID, sku, cost); err != nil {
+			writeFailure(w, r, "saving SKU and cost", err)
+			return
+		}
+	}
 
 	// Redirect to the product view
 	http.Redirect(w, r, "/products/"+product.ID, http.StatusSeeOther)
@@ -464,15 +624,17 @@ func (h *Handler) CreateProduct(w http.ResponseWriter, r *http.Request) {
 func (h *Handler) UpdateProduct(w http.ResponseWriter, r *http.Request) {
 	id := chi.URLParam(r, "id")
 	if id == "" {
-		http.Error(w, "Missing product ID", http.StatusBadRequest)
+		writeError(w, r, http.StatusBadRequest, "Missing product ID")
 		return
 	}
 
-	// Parse form
-	if err := r.ParseForm(); err != nil {
-		http.Error(w, "Invalid form data", http.StatusBadRequest)
+	if err := parseProductForm(w, r); err != nil {
+		writeError(w, r, http.StatusBadRequest, "Invalid form data, or the images are too large")
 		return
 	}
+	if r.MultipartForm != nil {
+		defer r.MultipartForm.RemoveAll()
+	}
 
 	name := r.FormValue("name")
 	slug := r.FormValue("slug")
@@ -480,40 +642,29 @@ func (h *Handler) UpdateProduct(w http.ResponseWriter, r *http.Request) {
 	description := r.FormValue("description")
 	priceStr := r.FormValue("price")
 	stockCountStr := r.FormValue("stock_count")
-	imageURLsStr := r.FormValue("image_urls")
 	isAvailableStr := r.FormValue("is_available")
 	enableVariantsStr := r.FormValue("enable_variants")
 
 	// Validate required fields
 	if name == "" || slug == "" || priceStr == "" || stockCountStr == "" {
-		http.Error(w, "Name, slug, price, and stock count are required", http.StatusBadRequest)
+		writeError(w, r, http.StatusBadRequest, "Name, slug, price, and stock count are required")
 		return
 	}
 
 	// Parse numeric values
-	price, err := strconv.ParseFloat(priceStr, 64)
+	price, err := money.ParseInput(priceStr)
 	if err != nil {
-		http.Error(w, "Invalid price", http.StatusBadRequest)
+		writeError(w, r, http.StatusBadRequest, "Invalid price: "+err.Error())
 		return
 	}
 
 	stockCount, err := strconv.Atoi(stockCountStr)
 	if err != nil {
-		http.Error(w, "Invalid stock count", http.StatusBadRequest)
+		writeError(w, r, http.StatusBadRequest, "Invalid stock count")
 		return
 	}
 
-	// Parse image URLs
-	var imageURLs []string
-	if imageURLsStr != "" {
-		// Split by newline and filter empty strings
-		for _, url := range strings.Split(imageURLsStr, "\n") {
-			trimmedURL := strings.TrimSpace(url)
-			if trimmedURL != "" {
-				imageURLs = append(imageURLs, trimmedURL)
-			}
-		}
-	}
+	imageURLs := productFormImageURLs(r)
 
 	// Handle optional category ID
 	var categoryIDPtr *string
@@ -527,10 +678,21 @@ func (h *Handler) UpdateProduct(w http.ResponseWriter, r *http.Request) {
 	// Handle variants flag
 	hasVariants := enableVariantsStr == "true"
 
+	orderOptions, hasOrderOptions, err := parseOrderOptions(r)
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+	sku, cost, hasCosting, err := parseProductCosting(r)
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
 	// Get current product to check if it has variants
-	currentProduct, err := models.GetProductByID(h.DB, id)
+	currentProduct, err := models.GetProductByID(h.db(r), id)
 	if err != nil {
-		http.Error(w, fmt.Sprintf("Error getting current product: %v", err), http.StatusInternalServerError)
+		writeFailure(w, r, "getting current product", err)
 		return
 	}
 
@@ -540,12 +702,43 @@ func (h *Handler) UpdateProduct(w http.ResponseWriter, r *http.Request) {
 		hasVariants = true
 	}
 
+	uploaded, err := saveProductFormImages(r)
+	if err != nil {
+		writeError(w, r, http.StatusUnprocessableEntity, err.Error())
+		return
+	}
+	imageURLs = append(imageURLs, uploaded...)
+
 	// Update the product first
-	_, err = models.UpdateProduct(h.DB, id, categoryIDPtr, name, slug, description, price, imageURLs, stockCount, isAvailable, hasVariants)
+	_, err = models.UpdateProduct(h.db(r), id, categoryIDPtr, name, slug, description, price, imageURLs, stockCount, isAvailable, hasVariants)
 	if err != nil {
-		http.Error(w, fmt.Sprintf("Error updating product: %v", err), http.StatusInternalServerError)
+		removeUploadedImages(r.Context(), uploaded)
+		writeFailure(w, r, "updating product", err)
 		return
 	}
+	h.queueUploadedImages(r, id, uploaded)
+	// Images taken out of the gallery are deleted from storage once nothing uses them
+	if err := models.QueueOrphanedMedia(h.db(r), removedImages(currentProduct.ImageURLs, imageURLs)); err != nil {
+		log.Printf("Error recording images removed from product %s: %v", id, err)
+	}
+
+	if hasOrderOptions {
+		if err := models.SetProductOrderOptions(h.db(r), id, orderOptions); err != nil {
+			writeFailure(w, r, "saving order options", err)
+			return
+		}
+	}
+	if hasCosting {
+		if err := models.SetProductCosting(h.db(r), id, sku, cost); err != nil {
+			writeFailure(w, r, "saving SKU and cost", err)
+			return
+		}
+	}
+	if updated, err := models.GetProductByID(h.db(r), id); err != nil {
+		log.Printf("Error getting product %s to record its changes: %v", id, err)
+	} else {
+		h.recordProductEdit(r, currentProduct, updated)
+	}
 
 	// Handle variants if enabled
 	if hasVariants {
@@ -592,9 +785,9 @@ func (h *Handler) UpdateProduct(w http.ResponseWriter, r *http.Request) {
 			}
 
 			// Parse numeric values
-			variantPrice, err := strconv.ParseFloat(priceStr, 64)
+			variantPrice, err := money.ParseInput(priceStr)
 			if err != nil {
-				log.Printf("Skipping variant %s due to invalid price: %s", idx, priceStr)
+				log.Printf("Skipping variant %s due to invalid price: %v", idx, err)
 				continue
 			}
 
@@ -616,7 +809,7 @@ func (h *Handler) UpdateProduct(w http.ResponseWriter, r *http.Request) {
 
 			if !existingVariant {
 				// Create the new variant
-				variant, err := models.CreateProductVariant(h.DB, id, variantName, variantPrice, variantStockCount, true)
+				variant, err := models.CreateProductVariant(h.db(r), id, variantName, variantPrice, variantStockCount, true)
 				if err != nil {
 					log.Printf("Error creating product variant %s: %v", variantName, err)
 					continue
@@ -634,132 +827,194 @@ func (h *Handler) UpdateProduct(w http.ResponseWriter, r *http.Request) {
 	http.Redirect(w, r, "/products/"+id, http.StatusSeeOther)
 }
 
-// DeleteProduct handles the request to delete a product
+// DeleteProduct handles the request to delete a product. While reviews or other rows
+// still reference it, the admin is sent to DeleteProductConfirm to choose what happens to them.
 func (h *Handler) DeleteProduct(w http.ResponseWriter, r *http.Request) {
 	id := chi.URLParam(r, "id")
 	if id == "" {
-		http.Error(w, "Missing product ID", http.StatusBadRequest)
+		writeError(w, r, http.StatusBadRequest, "Missing product ID")
+		return
+	}
+
+	// Parse form
+	if err := r.ParseForm(); err != nil {
+		writeError(w, r, http.StatusBadRequest, "Invalid form data")
+		return
+	}
+
+	dependents := r.FormValue("dependents")
+	if dependents == models.DependentsAbort {
+		http.Redirect(w, r, "/products/"+id, http.StatusSeeOther)
+		return
+	}
+	if dependents != "" && !models.IsDependentsOption(dependents) {
+		writeError(w, r, http.StatusBadRequest, fmt.Sprintf("Unknown dependents option %q", dependents))
 		return
 	}
 
+	if dependents == "" {
+		found, err := models.GetProductDependents(h.db(r), id)
+		if err != nil {
+			writeFailure(w, r, "checking product dependents", err)
+			return
+		}
+		if len(found) > 0 {
+			confirmURL := "/products/" + id + "/delete"
+			switch {
+			case wantsJSON(r):
+				writeJSON(w, http.StatusConflict, map[string]interface{}{
+					"error":      "product is referenced by " + models.DependentsSummary(found),
+					"dependents": found,
+				})
+			case r.Header.Get("HX-Request") == "true":
+				w.Header().Set("HX-Redirect", confirmURL)
+				w.WriteHeader(http.StatusOK)
+			default:
+				http.Redirect(w, r, confirmURL, http.StatusSeeOther)
+			}
+			return
+		}
+	}
+
 	// Delete the product
-	err := models.DeleteProduct(h.DB, id)
+	err := models.DeleteProduct(h.db(r), id, dependents)
 	if err != nil {
-		http.Error(w, fmt.Sprintf("Error deleting product: %v", err), http.StatusInternalServerError)
+		writeFailure(w, r, "deleting product", err)
+		return
+	}
+	h.recordActivity(r, models.ActivityProduct, id, models.ActivityDeleted, "Moved to the trash")
+
+	// The confirmation page is a plain form, so send it back to the product list
+	if dependents != "" && r.Header.Get("HX-Request") != "true" && !wantsJSON(r) {
+		http.Redirect(w, r, h.listURL(r, "/products"), http.StatusSeeOther)
 		return
 	}
 
-	// For HTMX delete requests, just return 200 OK
-	w.WriteHeader(http.StatusOK)
+	// For HTMX delete requests, return 200 OK with an undo toast
+	writeUndoToast(w, r, "Product deleted", "/products/"+id+"/restore")
 }
 
-// REVIEW HANDLERS
+// DeleteProductConfirm lists the rows that still reference a product and asks whether
+// to delete them with it, detach them from it or keep the product
+func (h *Handler) DeleteProductConfirm(w http.ResponseWriter, r *http.Request) {
+	product, err := models.GetProductByID(h.db(r), chi.URLParam(r, "id"))
+	if err != nil {
+		writeFailure(w, r, "getting product", err)
+		return
+	}
 
-// ListReviews handles the request to list all reviews
-func (h *Handler) ListReviews(w http.ResponseWriter, r *http.Request) {
-	// Parse pagination parameters
-	page := 1
-	if p := r.URL.Query().Get("page"); p != "" {
-		if parsedPage, err := strconv.Atoi(p); err == nil && parsedPage > 0 {
-			page = parsedPage
-		}
+	dependents, err := models.GetProductDependents(h.db(r), product.ID)
+	if err != nil {
+		writeFailure(w, r, "checking product dependents", err)
+		return
 	}
 
-	pageSize := 15
-	if ps := r.URL.Query().Get("limit"); ps != "" {
-		if parsedSize, err := strconv.Atoi(ps); err == nil && parsedSize > 0 && parsedSize <= 100 {
-			pageSize = parsedSize
-		}
+	if wantsJSON(r) {
+		writeJSON(w, http.StatusOK, dependents)
+		return
 	}
 
-	// Check if search query parameter exists
-	searchQuery := r.URL.Query().Get("q")
+	ctx := withCrumbs(r, append(h.productCrumbs(r, product), templates.Breadcrumb{Label: "Delete"})...)
+	render(w, r.WithContext(ctx), templates.DeleteProductConfirm(product, dependents))
+}
 
-	if searchQuery != "" {
-		// If search query exists, search for matching reviews (no pagination for search yet)
-		reviews, err := models.SearchReviews(h.DB, searchQuery)
-		if err != nil {
-			http.Error(w, fmt.Sprintf("Error searching reviews: %v", err), http.StatusInternalServerError)
-			return
-		}
-		templates.ReviewList(reviews).Render(r.Context(), w)
-	} else {
-		// Use pagination
-		result, err := models.GetReviewsPaginated(h.DB, page, pageSize)
-		if err != nil {
-			http.Error(w, fmt.Sprintf("Error getting reviews: %v", err), http.StatusInternalServerError)
-			return
-		}
+// REVIEW HANDLERS
+
+// ListReviews handles the request to list reviews, a page at a time
+func (h *Handler) ListReviews(w http.ResponseWriter, r *http.Request) {
+	// The status filter is empty for every review; "pending" is the moderation queue
+	query := listQuery(r, "status", models.ReviewSorts)
+	result, err := models.GetReviewsPaginated(h.db(r), query)
+	if err != nil {
+		writeFailure(w, r, "getting reviews", err)
+		return
+	}
+	if wantsJSON(r) {
+		writeList(w, r, result)
+		return
+	}
+
+	pendingCount, err := models.CountPendingReviews(h.db(r))
+	if err != nil {
+		writeFailure(w, r, "counting pending reviews", err)
+		return
+	}
 
-		// Pass pagination result to template - using existing template with just data for now
-		templates.ReviewList(result.Data).Render(r.Context(), w)
+	// The report queue link only needs the counts, so the list still renders without them
+	openReports, overdueReports, err := models.CountOpenReviewReports(h.db(r), models.ReviewReportSLA())
+	if err != nil {
+		log.Printf("Error counting review reports: %v", err)
 	}
+
+	state := templates.NewListState("/reviews", "reviews", "status", query, result)
+	state.ExportPath = "/reviews/export"
+	h.rememberList(r, "/reviews")
+	render(w, r, templates.ReviewList(state, result.Data, pendingCount, openReports, overdueReports))
 }
 
 // GetReview handles the request to view a single review
 func (h *Handler) GetReview(w http.ResponseWriter, r *http.Request) {
 	id := chi.URLParam(r, "id")
 	if id == "" {
-		http.Error(w, "Missing review ID", http.StatusBadRequest)
+		writeError(w, r, http.StatusBadRequest, "Missing review ID")
 		return
 	}
 
-	review, err := models.GetReviewByID(h.DB, id)
+	review, err := models.GetReviewByID(h.db(r), id)
 	if err != nil {
-		http.Error(w, fmt.Sprintf("Error getting review: %v", err), http.StatusInternalServerError)
+		writeFailure(w, r, "getting review", err)
 		return
 	}
 
-	err = templates.ReviewView(review).Render(r.Context(), w)
-	if err != nil {
-		return
-	}
+	render(w, r.WithContext(withCrumbs(r, current(h.reviewCrumbs(r, review))...)), templates.ReviewView(review))
 }
 
 // NewReviewForm handles the request to show the form for creating a new review
 func (h *Handler) NewReviewForm(w http.ResponseWriter, r *http.Request) {
 	// Get all products for dropdown
-	products, err := models.GetAllProducts(h.DB)
+	products, err := models.GetAllProducts(h.db(r))
 	if err != nil {
-		http.Error(w, fmt.Sprintf("Error getting products: %v", err), http.StatusInternalServerError)
+		writeFailure(w, r, "getting products", err)
 		return
 	}
 
-	err = templates.ReviewForm(nil, products, false).Render(r.Context(), w)
-	if err != nil {
-		return
-	}
+	ctx := withCrumbs(r,
+		templates.Breadcrumb{Label: "Reviews", URL: h.listURL(r, "/reviews")},
+		templates.Breadcrumb{Label: "New review"},
+	)
+	render(w, r.WithContext(ctx), templates.ReviewForm(nil, products, false))
 }
 
 // EditReviewForm handles the request to show the form for editing a review
 func (h *Handler) EditReviewForm(w http.ResponseWriter, r *http.Request) {
 	id := chi.URLParam(r, "id")
 	if id == "" {
-		http.Error(w, "Missing review ID", http.StatusBadRequest)
+		writeError(w, r, http.StatusBadRequest, "Missing review ID")
 		return
 	}
 
-	review, err := models.GetReviewByID(h.DB, id)
+	review, err := models.GetReviewByID(h.db(r), id)
 	if err != nil {
-		http.Error(w, fmt.Sprintf("Error getting review: %v", err), http.StatusInternalServerError)
+		writeFailure(w, r, "getting review", err)
 		return
 	}
 
 	// Get all products for dropdown
-	products, err := models.GetAllProducts(h.DB)
+	products, err := models.GetAllProducts(h.db(r))
 	if err != nil {
-		http.Error(w, fmt.Sprintf("Error getting products: %v", err), http.StatusInternalServerError)
+		writeFailure(w, r, "getting products", err)
 		return
 	}
 
-	templates.ReviewForm(&review, products, true).Render(r.Context(), w)
+	ctx := withCrumbs(r, append(h.reviewCrumbs(r, review), templates.Breadcrumb{Label: "Edit"})...)
+	render(w, r.WithContext(ctx), templates.ReviewForm(&review, products, true))
 }
 
 // CreateReview handles the request to create a new review
 func (h *Handler) CreateReview(w http.ResponseWriter, r *http.Request) {
 	// Parse form
 	if err := r.ParseForm(); err != nil {
-		http.Error(w, "Invalid form data", http.StatusBadRequest)
+		writeError(w, r, http.StatusBadRequest, "Invalid form data")
 		return
 	}
 
@@ -770,49 +1025,51 @@ func (h *Handler) CreateReview(w http.ResponseWriter, r *http.Request) {
 
 	// Validate required fields
 	if productID == "" || ratingStr == "" {
-		http.Error(w, "Product and rating are required", http.StatusBadRequest)
+		writeError(w, r, http.StatusBadRequest, "Product and rating are required")
 		return
 	}
 
 	// Verify that the product exists
-	_, productErr := models.GetProductByID(h.DB, productID)
+	_, productErr := models.GetProductByID(h.db(r), productID)
 	if productErr != nil {
 		log.Printf("Product with ID %s not found: %v", productID, productErr)
-		http.Error(w, fmt.Sprintf("Product not found: %v", productErr), http.StatusBadRequest)
+		writeError(w, r, http.StatusBadRequest, "Product not found")
 		return
 	}
 
 	// Parse rating
 	rating, err := strconv.ParseFloat(ratingStr, 64)
 	if err != nil || rating < 1 || rating > 5 {
-		http.Error(w, "Invalid rating", http.StatusBadRequest)
+		writeError(w, r, http.StatusBadRequest, "Invalid rating")
 		return
 	}
 
 	// Create the review with an empty session ID for now
 	var sessionIDPtr *string
-	_, err = models.CreateReview(h.DB, &productID, sessionIDPtr, rating, comment, reviewerName)
+	review, err := models.CreateReview(h.db(r), &productID, sessionIDPtr, rating, comment, reviewerName)
 	if err != nil {
 		log.Printf("Error creating review: %v", err)
-		http.Error(w, fmt.Sprintf("Error creating review: %v", err), http.StatusInternalServerError)
+		writeFailure(w, r, "creating review", err)
 		return
 	}
+	h.recordActivity(r, models.ActivityReview, review.ID, models.ActivityCreated, "Added with a rating of "+strconv.FormatFloat(review.Rating, 'g', -1, 64))
+	h.auditCreate(r, models.ActivityReview, review.ID, review)
 
 	// Redirect to the reviews list
-	http.Redirect(w, r, "/reviews", http.StatusSeeOther)
+	http.Redirect(w, r, h.listURL(r, "/reviews"), http.StatusSeeOther)
 }
 
 // UpdateReview handles the request to update a review
 func (h *Handler) UpdateReview(w http.ResponseWriter, r *http.Request) {
 	id := chi.URLParam(r, "id")
 	if id == "" {
-		http.Error(w, "Missing review ID", http.StatusBadRequest)
+		writeError(w, r, http.StatusBadRequest, "Missing review ID")
 		return
 	}
 
 	// Parse form
 	if err := r.ParseForm(); err != nil {
-		http.Error(w, "Invalid form data", http.StatusBadRequest)
+		writeError(w, r, http.StatusBadRequest, "Invalid form data")
 		return
 	}
 
@@ -823,24 +1080,34 @@ func (h *Handler) UpdateReview(w http.ResponseWriter, r *http.Request) {
 
 	// Validate required fields
 	if productID == "" || ratingStr == "" {
-		http.Error(w, "Product and rating are required", http.StatusBadRequest)
+		writeError(w, r, http.StatusBadRequest, "Product and rating are required")
 		return
 	}
 
 	// Parse rating
 	rating, err := strconv.ParseFloat(ratingStr, 64)
 	if err != nil || rating < 1 || rating > 5 {
-		http.Error(w, "Invalid rating", http.StatusBadRequest)
+		writeError(w, r, http.StatusBadRequest, "Invalid rating")
+		return
+	}
+
+	before, err := models.GetReviewByID(h.db(r), id)
+	if err != nil {
+		writeFailure(w, r, "getting review", err)
 		return
 	}
 
 	// Update the review with an empty session ID for now
 	var sessionIDPtr *string
-	_, err = models.UpdateReview(h.DB, id, &productID, sessionIDPtr, rating, comment, reviewerName)
+	review, err := models.UpdateReview(h.db(r), id, &productID, sessionIDPtr, rating, comment, reviewerName)
 	if err != nil {
-		http.Error(w, fmt.Sprintf("Error updating review: %v", err), http.StatusInternalServerError)
+		writeFailure(w, r, "updating review", err)
 		return
 	}
+	if changes := models.ReviewChanges(before, review); len(changes) > 0 {
+		h.recordActivity(r, models.ActivityReview, id, models.ActivityUpdated, strings.Join(changes, "; "))
+	}
+	h.auditUpdate(r, models.ActivityReview, id, models.DiffFields(before, review))
 
 	// Redirect to the review view
 	http.Redirect(w, r, "/reviews/"+id, http.StatusSeeOther)
@@ -850,19 +1117,20 @@ func (h *Handler) UpdateReview(w http.ResponseWriter, r *http.Request) {
 func (h *Handler) DeleteReview(w http.ResponseWriter, r *http.Request) {
 	id := chi.URLParam(r, "id")
 	if id == "" {
-		http.Error(w, "Missing review ID", http.StatusBadRequest)
+		writeError(w, r, http.StatusBadRequest, "Missing review ID")
 		return
 	}
 
 	// Delete the review
-	err := models.DeleteReview(h.DB, id)
+	err := models.DeleteReview(h.db(r), id)
 	if err != nil {
-		http.Error(w, fmt.Sprintf("Error deleting review: %v", err), http.StatusInternalServerError)
+		writeFailure(w, r, "deleting review", err)
 		return
 	}
+	h.recordActivity(r, models.ActivityReview, id, models.ActivityDeleted, "Moved to the trash")
 
-	// For HTMX delete requests, just return 200 OK
-	w.WriteHeader(http.StatusOK)
+	// For HTMX delete requests, return 200 OK with an undo toast
+	writeUndoToast(w, r, "Review deleted", "/reviews/"+id+"/restore")
 }
 
 // AUTH HANDLERS
@@ -878,10 +1146,14 @@ func (h *Handler) LoginPage(w http.ResponseWriter, r *http.Request) {
 	// Get any error message from the query string
 	errorMsg := r.URL.Query().Get("error")
 
-	err := templates.Login(errorMsg).Render(r.Context(), w)
-	if err != nil {
-		return
+	// A new deployment has nobody to sign in as until an account is created
+	if count, err := models.CountAdminUsers(h.db(r)); err != nil {
+		log.Printf("Error counting admin accounts: %v", err)
+	} else if count == 0 {
+		errorMsg = "No admin accounts yet. Set ADMIN_USERNAME and ADMIN_PASSWORD and restart, or run the create-admin command."
 	}
+
+	render(w, r, templates.Login(errorMsg))
 }
 
 // Login handles the login form submission
@@ -889,7 +1161,7 @@ func (h *Handler) Login(w http.ResponseWriter, r *http.Request) {
 	// Parse the form data
 	err := r.ParseForm()
 	if err != nil {
-		http.Error(w, "Error parsing form", http.StatusBadRequest)
+		writeError(w, r, http.StatusBadRequest, "Error parsing form")
 		return
 	}
 
@@ -897,23 +1169,41 @@ func (h *Handler) Login(w http.ResponseWriter, r *http.Request) {
 	username := r.FormValue("username")
 	password := r.FormValue("password")
 
-	// Check credentials - hardcoded for simplicity
-	if username == "dylstar" && password == "dylstarperi@4560" {
-		// Set user as authenticated
-		h.Session.Put(r.Context(), "authenticated", true)
-		h.Session.Put(r.Context(), "username", username)
+	user, err := models.AuthenticateAdmin(h.db(r), username, password)
+	if errors.Is(err, models.ErrInvalidLogin) {
+		http.Redirect(w, r, "/login?error=Invalid+username+or+password", http.StatusSeeOther)
+		return
+	}
+	if err != nil {
+		log.Printf("Error signing in %s: %v", username, err)
+		http.Redirect(w, r, "/login?error=Couldn%27t+sign+in%2C+try+again", http.StatusSeeOther)
+		return
+	}
 
-		// Redirect to home page
-		http.Redirect(w, r, "/", http.StatusSeeOther)
+	// Start a fresh session so one fixed before signing in can't be reused
+	if err := h.Session.RenewToken(r.Context()); err != nil {
+		writeFailure(w, r, "signing in", err)
 		return
 	}
 
-	// Invalid credentials
-	http.Redirect(w, r, "/login?error=Invalid+username+or+password", http.StatusSeeOther)
+	// Set user as authenticated
+	h.Session.Put(r.Context(), "authenticated", true)
+	h.Session.Put(r.Context(), "username", user.Username)
+	h.Session.Put(r.Context(), "tenant", h.db(r).Schema)
+
+	// Redirect to home page
+	http.Redirect(w, r, "/", http.StatusSeeOther)
 }
 
 // Logout handles user logout
 func (h *Handler) Logout(w http.ResponseWriter, r *http.Request) {
+	// Stop showing the admin as online
+	if username := h.Session.GetString(r.Context(), "username"); username != "" {
+		if err := models.ClearPresence(h.db(r), username); err != nil {
+			log.Printf("Error clearing presence of %s: %v", username, err)
+		}
+	}
+
 	// Destroy the session
 	err := h.Session.Destroy(r.Context())
 	if err != nil {
@@ -924,37 +1214,74 @@ func (h *Handler) Logout(w http.ResponseWriter, r *http.Request) {
 	http.Redirect(w, r, "/login", http.StatusSeeOther)
 }
 
-// ImageProxy handles proxying external images to avoid CORS issues
+// maxCachedImage is the largest image the proxy reads into its cache; larger ones are passed
+// straight through
+const maxCachedImage = 20 << 20
+
+// ImageProxy handles proxying external images to avoid CORS issues. Images are cached, per
+// tenant, for the image cache's TTL and then checked with their host again, and served with an
+// ETag so browsers that already have one get a 304.
 func (h *Handler) ImageProxy(w http.ResponseWriter, r *http.Request) {
 	imageURL := r.URL.Query().Get("url")
 	if imageURL == "" {
-		http.Error(w, "Missing URL parameter", http.StatusBadRequest)
+		writeError(w, r, http.StatusBadRequest, "Missing URL parameter")
 		return
 	}
 
-	// Create HTTP client with timeout and headers
-	client := &http.Client{
-		Timeout: 10 * time.Second,
+	// Create request with headers
+	req, err := http.NewRequestWithContext(r.Context(), "GET", imageURL, nil)
+	if err != nil || (req.URL.Scheme != "http" && req.URL.Scheme != "https") {
+		writeError(w, r, http.StatusBadRequest, "Invalid URL")
+		return
 	}
 
-	// Create request with headers
-	req, err := http.NewRequest("GET", imageURL, nil)
+	// Send the headers the image's host expects, from its profile under Settings → Image Proxy
+	profile, err := models.GetImageProxyProfile(h.db(r), req.URL.Hostname())
 	if err != nil {
-		http.Error(w, "Invalid URL", http.StatusBadRequest)
+		log.Printf("Error getting image proxy profile for %s: %v", req.URL.Hostname(), err)
+	}
+
+	// The proxy is open to the storefront, so images fetched with a host's key, cached or not,
+	// are only for signed-in admins
+	if profile.SendsAuth(req.URL.Hostname()) {
+		if !custommiddleware.SignedIn(h.DB, h.Session, r) {
+			writeError(w, r, http.StatusForbidden, "Sign in to load images from this host")
+			return
+		}
+		w.Header().Set("Cache-Control", "private, max-age=3600")
+	}
+
+	// Tenants can send different headers to the same host, so they don't share cached images
+	cacheKey := h.db(r).Schema + " " + imageURL
+	cached, found := h.Images.Get(cacheKey)
+	if found && cached.Fresh(h.Images.TTL(), time.Now()) {
+		serveProxiedImage(w, r, cached, "HIT")
 		return
 	}
 
-	// Add headers to avoid blocking and handle authentication
-	req.Header.Set("User-Agent", "Mozilla/5.0 (compatible; GanymedeAdmin/1.0)")
-	req.Header.Set("Accept", "image/*,*/*")
-	req.Header.Set("Referer", "https://pixshelf.perigrine.cloud")
+	profile.Apply(req)
 	req.Header.Set("Cache-Control", "no-cache")
 
+	// A stale image is checked with its host, which can answer that it hasn't changed
+	if found {
+		if cached.UpstreamETag != "" {
+			req.Header.Set("If-None-Match", cached.UpstreamETag)
+		}
+		if cached.LastModified != "" {
+			req.Header.Set("If-Modified-Since", cached.LastModified)
+		}
+	}
+
 	// Fetch the image
+	client := &http.Client{Timeout: 10 * time.Second, CheckRedirect: profile.CheckRedirect}
 	resp, err := client.Do(req)
 	if err != nil {
 		log.Printf("Image proxy error for %s: %v", imageURL, err)
-		http.Error(w, "Failed to fetch image", http.StatusBadGateway)
+		if found {
+			serveProxiedImage(w, r, cached, "STALE")
+			return
+		}
+		writeError(w, r, http.StatusBadGateway, "Failed to fetch image")
 		return
 	}
 	defer func(Body io.ReadCloser) {
@@ -964,29 +1291,94 @@ func (h *Handler) ImageProxy(w http.ResponseWriter, r *http.Request) {
 		}
 	}(resp.Body)
 
+	if found && resp.StatusCode == http.StatusNotModified {
+		cached.FetchedAt = time.Now()
+		serveProxiedImage(w, r, h.Images.Put(cacheKey, cached), "REVALIDATED")
+		return
+	}
+
 	// Check if the response is successful
 	if resp.StatusCode != http.StatusOK {
 		log.Printf("Image proxy got status %d for %s", resp.StatusCode, imageURL)
-		http.Error(w, fmt.Sprintf("Image not found (status: %d)", resp.StatusCode), http.StatusNotFound)
+		if found && resp.StatusCode >= http.StatusInternalServerError {
+			serveProxiedImage(w, r, cached, "STALE")
+			return
+		}
+		writeError(w, r, http.StatusNotFound, fmt.Sprintf("Image not found (status: %d)", resp.StatusCode))
+		return
+	}
+
+	contentType := resp.Header.Get("Content-Type")
+	if contentType == "" {
+		contentType = "image/jpeg" // default
+	}
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxCachedImage+1))
+	if err != nil {
+		log.Printf("Error reading image %s: %v", imageURL, err)
+		writeError(w, r, http.StatusBadGateway, "Failed to fetch image")
 		return
 	}
 
-	// Set appropriate headers
-	if contentType := resp.Header.Get("Content-Type"); contentType != "" {
+	// Too large to cache: pass the rest of it straight through
+	if len(data) > maxCachedImage {
 		w.Header().Set("Content-Type", contentType)
-	} else {
-		w.Header().Set("Content-Type", "image/jpeg") // default
+		setImageProxyHeaders(w, "BYPASS")
+		if _, err := io.Copy(w, io.MultiReader(bytes.NewReader(data), resp.Body)); err != nil {
+			log.Printf("Error copying image data: %v", err)
+		}
+		return
 	}
 
-	// Set caching and CORS headers
-	w.Header().Set("Cache-Control", "public, max-age=3600") // Cache for 1 hour
+	entry := h.Images.Put(cacheKey, imagecache.Entry{
+		Data:         data,
+		ContentType:  contentType,
+		UpstreamETag: resp.Header.Get("ETag"),
+		LastModified: resp.Header.Get("Last-Modified"),
+	})
+	serveProxiedImage(w, r, entry, "MISS")
+}
+
+// serveProxiedImage writes an image the proxy fetched or cached, or a 304 when the browser's
+// copy is the same. X-Cache says whether it came from the cache.
+func serveProxiedImage(w http.ResponseWriter, r *http.Request, e imagecache.Entry, status string) {
+	w.Header().Set("Content-Type", e.ContentType)
+	w.Header().Set("ETag", e.ETag)
+	setImageProxyHeaders(w, status)
+
+	if etagMatches(r.Header.Get("If-None-Match"), e.ETag) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	w.Header().Set("Content-Length", strconv.Itoa(len(e.Data)))
+	if _, err := w.Write(e.Data); err != nil {
+		log.Printf("Error writing image data: %v", err)
+	}
+}
+
+// setImageProxyHeaders sets the caching and CORS headers every proxied image is sent with. An
+// image already marked private, as one fetched with a host's key is, stays private.
+func setImageProxyHeaders(w http.ResponseWriter, status string) {
+	if w.Header().Get("Cache-Control") == "" {
+		w.Header().Set("Cache-Control", "public, max-age=3600") // Cache for 1 hour
+	}
 	w.Header().Set("Access-Control-Allow-Origin", "*")
 	w.Header().Set("Access-Control-Allow-Methods", "GET")
 	w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
+	w.Header().Set("X-Cache", status)
+}
 
-	// Copy the image data
-	_, err = io.Copy(w, resp.Body)
-	if err != nil {
-		log.Printf("Error copying image data: %v", err)
+// etagMatches reports whether an If-None-Match header names etag, comparing weakly as
+// RFC 9110 asks for GET requests
+func etagMatches(ifNoneMatch, etag string) bool {
+	if ifNoneMatch == "" {
+		return false
+	}
+	for _, candidate := range strings.Split(ifNoneMatch, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || strings.TrimPrefix(candidate, "W/") == etag {
+			return true
+		}
 	}
+	return false
 }
@@ -0,0 +1,66 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/ngenohkevin/kuiper_admin/internal/models"
+	"github.com/ngenohkevin/kuiper_admin/internal/templates"
+)
+
+// ImageHosts shows the maintenance page for moving product images to a new host, with the moves
+// made so far
+func (h *Handler) ImageHosts(w http.ResponseWriter, r *http.Request) {
+	h.renderImageHosts(w, r, nil, false, "")
+}
+
+// renderImageHosts shows the image host page with the form as posted, and rows either previewed
+// or just moved. formError is shown above the form when the move was rejected.
+func (h *Handler) renderImageHosts(w http.ResponseWriter, r *http.Request, rows []models.ImageURLMigrationRow, dryRun bool, formError string) {
+	history, err := models.GetImageURLMigrations(h.db(r))
+	if err != nil {
+		writeFailure(w, r, "getting image host moves", err)
+		return
+	}
+
+	if wantsJSON(r) {
+		writeList(w, r, models.SinglePage(history))
+		return
+	}
+
+	if formError != "" {
+		w.WriteHeader(http.StatusUnprocessableEntity)
+	}
+	render(w, r, templates.ImageHosts(history, r.FormValue("old_prefix"), r.FormValue("new_prefix"), rows, dryRun, formError))
+}
+
+// MigrateImageHosts previews or applies rewriting every product image URL from old_prefix to
+// new_prefix. With dry_run set it only lists the URLs that would change; nothing is written.
+func (h *Handler) MigrateImageHosts(w http.ResponseWriter, r *http.Request) {
+	// Parse form
+	if err := r.ParseForm(); err != nil {
+		writeError(w, r, http.StatusBadRequest, "Invalid form data")
+		return
+	}
+
+	dryRun := r.FormValue("dry_run") != ""
+	actor := h.Session.GetString(r.Context(), "username")
+	rows, err := models.MigrateImageURLs(h.db(r), r.FormValue("old_prefix"), r.FormValue("new_prefix"), actor, dryRun)
+	if err != nil {
+		if wantsJSON(r) {
+			writeFailure(w, r, "moving image host", err)
+			return
+		}
+		h.renderImageHosts(w, r, nil, dryRun, publicMessage(err, "moving image host"))
+		return
+	}
+
+	if wantsJSON(r) {
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"dry_run":  dryRun,
+			"products": rows,
+		})
+		return
+	}
+
+	h.renderImageHosts(w, r, rows, dryRun, "")
+}
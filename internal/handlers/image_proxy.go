@@ -0,0 +1,100 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/ngenohkevin/kuiper_admin/internal/models"
+	"github.com/ngenohkevin/kuiper_admin/internal/templates"
+)
+
+// ImageProxySettings shows the headers the image proxy sends to each image host. With host set
+// the form is filled in with that host's profile, to change it.
+func (h *Handler) ImageProxySettings(w http.ResponseWriter, r *http.Request) {
+	h.renderImageProxySettings(w, r, models.ImageProxyProfile{Host: r.URL.Query().Get("host")}, "")
+}
+
+// renderImageProxySettings shows the image proxy page with form in the profile form, and
+// formError above it when the last change was rejected
+func (h *Handler) renderImageProxySettings(w http.ResponseWriter, r *http.Request, form models.ImageProxyProfile, formError string) {
+	profiles, err := models.GetImageProxyProfiles(h.db(r))
+	if err != nil {
+		writeFailure(w, r, "getting image proxy profiles", err)
+		return
+	}
+
+	if wantsJSON(r) {
+		writeList(w, r, models.SinglePage(profiles))
+		return
+	}
+
+	if formError == "" {
+		for _, p := range profiles {
+			if p.Host == form.Host {
+				form = p
+			}
+		}
+	}
+	if formError != "" {
+		w.WriteHeader(http.StatusUnprocessableEntity)
+	}
+	render(w, r, templates.ImageProxySettings(profiles, form, formError, h.Images.Stats()))
+}
+
+// SaveImageProxyProfile handles the request to add or change the headers sent to an image host
+func (h *Handler) SaveImageProxyProfile(w http.ResponseWriter, r *http.Request) {
+	// Parse form
+	if err := r.ParseForm(); err != nil {
+		writeError(w, r, http.StatusBadRequest, "Invalid form data")
+		return
+	}
+
+	form := models.ImageProxyProfile{
+		Host:       r.FormValue("host"),
+		Referer:    r.FormValue("referer"),
+		UserAgent:  r.FormValue("user_agent"),
+		AuthHeader: r.FormValue("auth_header"),
+		AuthValue:  r.FormValue("auth_value"),
+	}
+	profile, err := models.SaveImageProxyProfile(h.db(r), form, r.FormValue("clear_auth") != "")
+	if err != nil {
+		if wantsJSON(r) {
+			writeFailure(w, r, "saving image proxy profile", err)
+			return
+		}
+		form.AuthValue = ""
+		h.renderImageProxySettings(w, r, form, publicMessage(err, "saving image proxy profile"))
+		return
+	}
+
+	if wantsJSON(r) {
+		writeJSON(w, http.StatusOK, profile)
+		return
+	}
+	http.Redirect(w, r, "/settings/image-proxy", http.StatusSeeOther)
+}
+
+// ClearImageCache removes every image the proxy has cached, so they are fetched again
+func (h *Handler) ClearImageCache(w http.ResponseWriter, r *http.Request) {
+	if err := h.Images.Clear(); err != nil {
+		writeFailure(w, r, "clearing image cache", err)
+		return
+	}
+
+	if wantsJSON(r) {
+		writeJSON(w, http.StatusOK, h.Images.Stats())
+		return
+	}
+	http.Redirect(w, r, "/settings/image-proxy#cache", http.StatusSeeOther)
+}
+
+// DeleteImageProxyProfile handles the request to remove an image host's profile
+func (h *Handler) DeleteImageProxyProfile(w http.ResponseWriter, r *http.Request) {
+	if err := models.DeleteImageProxyProfile(h.db(r), chi.URLParam(r, "id")); err != nil {
+		writeFailure(w, r, "deleting image proxy profile", err)
+		return
+	}
+
+	// For HTMX requests, just return 200 OK so the row is removed
+	w.WriteHeader(http.StatusOK)
+}
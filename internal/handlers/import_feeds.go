@@ -0,0 +1,191 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/ngenohkevin/kuiper_admin/internal/importer"
+	"github.com/ngenohkevin/kuiper_admin/internal/jobs"
+	"github.com/ngenohkevin/kuiper_admin/internal/models"
+	"github.com/ngenohkevin/kuiper_admin/internal/templates"
+)
+
+// ImportFeeds lists the scheduled supplier feeds with the form to add one
+func (h *Handler) ImportFeeds(w http.ResponseWriter, r *http.Request) {
+	if wantsJSON(r) {
+		feeds, err := models.GetImportFeeds(h.db(r))
+		if err != nil {
+			writeFailure(w, r, "getting import feeds", err)
+			return
+		}
+		writeList(w, r, models.SinglePage(feeds))
+		return
+	}
+
+	h.renderImportFeeds(w, r, "")
+}
+
+// renderImportFeeds shows the feed list and form, with formError above the form when the last submission was rejected
+func (h *Handler) renderImportFeeds(w http.ResponseWriter, r *http.Request, formError string) {
+	feeds, err := models.GetImportFeeds(h.db(r))
+	if err != nil {
+		writeFailure(w, r, "getting import feeds", err)
+		return
+	}
+
+	mappings, err := models.GetImportMappings(h.db(r))
+	if err != nil {
+		writeFailure(w, r, "getting import mappings", err)
+		return
+	}
+
+	if formError != "" {
+		w.WriteHeader(http.StatusUnprocessableEntity)
+	}
+	render(w, r, templates.ImportFeeds(feeds, mappings, formError))
+}
+
+// CreateImportFeed handles the request to schedule a new supplier feed
+func (h *Handler) CreateImportFeed(w http.ResponseWriter, r *http.Request) {
+	// Parse form
+	if err := r.ParseForm(); err != nil {
+		writeError(w, r, http.StatusBadRequest, "Invalid form data")
+		return
+	}
+
+	feed := models.ImportFeed{
+		Name:   r.FormValue("name"),
+		URL:    r.FormValue("url"),
+		Format: r.FormValue("format"),
+	}
+	feed.IntervalMinutes, _ = strconv.Atoi(r.FormValue("interval_minutes"))
+
+	var err error
+	if !importer.IsFeedFormat(feed.Format) {
+		err = fmt.Errorf("unknown feed format %q", feed.Format)
+	} else if id := r.FormValue("mapping_id"); id != "" {
+		var saved models.ImportMapping
+		if saved, err = models.GetImportMappingByID(h.db(r), id); err == nil {
+			feed.FieldMapping = saved.Mapping
+		}
+	}
+	if err == nil {
+		feed, err = models.CreateImportFeed(h.db(r), feed)
+	}
+	if err != nil {
+		// Show validation problems on the page rather than a bare error
+		h.renderImportFeeds(w, r, publicMessage(err, "creating import feed"))
+		return
+	}
+
+	// CSV and JSON feeds need their columns mapped before the first run can import anything
+	if (feed.Format == importer.FormatCSV || feed.Format == importer.FormatJSON) && len(feed.FieldMapping) == 0 {
+		http.Redirect(w, r, "/products/import/feeds/"+feed.ID+"/mapping", http.StatusSeeOther)
+		return
+	}
+
+	http.Redirect(w, r, "/products/import/feeds", http.StatusSeeOther)
+}
+
+// ImportFeed shows a feed's configuration and its recent runs
+func (h *Handler) ImportFeed(w http.ResponseWriter, r *http.Request) {
+	feed, err := models.GetImportFeedByID(h.db(r), chi.URLParam(r, "id"))
+	if err != nil {
+		writeFailure(w, r, "getting import feed", err)
+		return
+	}
+
+	runs, err := models.GetImportRuns(h.db(r), feed.ID, 30)
+	if err != nil {
+		writeFailure(w, r, "getting import runs", err)
+		return
+	}
+
+	if wantsJSON(r) {
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"feed": feed,
+			"runs": runs,
+		})
+		return
+	}
+
+	render(w, r, templates.ImportFeedDetail(feed, runs, r.URL.Query().Get("started") != ""))
+}
+
+// RunImportFeed starts a feed run in the background instead of waiting for its schedule
+func (h *Handler) RunImportFeed(w http.ResponseWriter, r *http.Request) {
+	feed, err := models.GetImportFeedByID(h.db(r), chi.URLParam(r, "id"))
+	if err != nil {
+		writeFailure(w, r, "getting import feed", err)
+		return
+	}
+
+	// Large feeds can outlast the request timeout, so the run is detached and recorded like scheduled runs
+	db := h.detachedDB(r)
+	go func() {
+		if err := jobs.RunImportFeed(context.Background(), db, feed); err != nil {
+			log.Printf("Manual import of feed %s failed: %v", feed.Name, err)
+		}
+	}()
+
+	http.Redirect(w, r, "/products/import/feeds/"+feed.ID+"?started=1", http.StatusSeeOther)
+}
+
+// ToggleImportFeed pauses or resumes a feed's schedule
+func (h *Handler) ToggleImportFeed(w http.ResponseWriter, r *http.Request) {
+	feed, err := models.GetImportFeedByID(h.db(r), chi.URLParam(r, "id"))
+	if err != nil {
+		writeFailure(w, r, "getting import feed", err)
+		return
+	}
+
+	if err := models.SetImportFeedEnabled(h.db(r), feed.ID, !feed.Enabled); err != nil {
+		writeFailure(w, r, "updating import feed", err)
+		return
+	}
+
+	http.Redirect(w, r, "/products/import/feeds/"+feed.ID, http.StatusSeeOther)
+}
+
+// DeleteImportFeed handles the request to remove a feed and its run history
+func (h *Handler) DeleteImportFeed(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	if id == "" {
+		writeError(w, r, http.StatusBadRequest, "Missing feed ID")
+		return
+	}
+
+	if err := models.DeleteImportFeed(h.db(r), id); err != nil {
+		writeFailure(w, r, "deleting import feed", err)
+		return
+	}
+
+	// For HTMX requests, just return 200 OK so the row is removed
+	w.WriteHeader(http.StatusOK)
+}
+
+// ImportRunReport shows what one feed run created, updated and left unchanged
+func (h *Handler) ImportRunReport(w http.ResponseWriter, r *http.Request) {
+	run, err := models.GetImportRunByID(h.db(r), chi.URLParam(r, "id"))
+	if err != nil {
+		writeFailure(w, r, "getting import run", err)
+		return
+	}
+
+	if wantsJSON(r) {
+		writeJSON(w, http.StatusOK, run)
+		return
+	}
+
+	feed, err := models.GetImportFeedByID(h.db(r), run.FeedID)
+	if err != nil {
+		writeFailure(w, r, "getting import feed", err)
+		return
+	}
+
+	render(w, r, templates.ImportRunReport(feed, run))
+}
@@ -0,0 +1,320 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"github.com/ngenohkevin/kuiper_admin/internal/importer"
+	"github.com/ngenohkevin/kuiper_admin/internal/models"
+	"github.com/ngenohkevin/kuiper_admin/internal/templates"
+)
+
+// previewRows is how many rows of a file are shown while mapping its columns
+const previewRows = 5
+
+// importUploadTTL is how long an upload waits for its column mapping before it is cleaned up
+const importUploadTTL = 24 * time.Hour
+
+// importUploadPath returns where the upload with the given token is kept between the upload and mapping steps
+func importUploadPath(token string) (string, error) {
+	if token == "" || uuidPattern.FindString(token) != token {
+		return "", fmt.Errorf("invalid upload token")
+	}
+	return filepath.Join(os.TempDir(), "kuiper-import-"+token), nil
+}
+
+// saveImportUpload keeps an uploaded file for the mapping step and returns its token.
+// Uploads abandoned before mapping are removed here rather than by a separate job.
+func saveImportUpload(file io.Reader) (string, error) {
+	stale, _ := filepath.Glob(filepath.Join(os.TempDir(), "kuiper-import-*"))
+	for _, path := range stale {
+		if info, err := os.Stat(path); err == nil && time.Since(info.ModTime()) > importUploadTTL {
+			os.Remove(path)
+		}
+	}
+
+	token := uuid.New().String()
+	path, _ := importUploadPath(token)
+	out, err := os.Create(path)
+	if err != nil {
+		return "", fmt.Errorf("error saving upload: %w", err)
+	}
+	defer out.Close()
+
+	if _, err := io.Copy(out, file); err != nil {
+		os.Remove(path)
+		return "", fmt.Errorf("error saving upload: %w", err)
+	}
+	return token, nil
+}
+
+// mappingFromForm reads the column and transforms chosen for each field; unmapped fields are left out
+func mappingFromForm(r *http.Request) models.FieldMapping {
+	mapping := make(models.FieldMapping)
+	for _, field := range importer.MappableFields {
+		column := r.FormValue("column_" + field)
+		if column == "" {
+			continue
+		}
+		mapping[field] = models.FieldSource{Column: column, Transforms: r.Form["transforms_"+field]}
+	}
+	return mapping
+}
+
+// savedOrGuessedMapping returns the saved mapping picked in the query, or a guess from the column names
+func (h *Handler) savedOrGuessedMapping(r *http.Request, columns []string) (models.FieldMapping, error) {
+	if id := r.URL.Query().Get("mapping_id"); id != "" {
+		saved, err := models.GetImportMappingByID(h.db(r), id)
+		if err != nil {
+			return nil, err
+		}
+		return saved.Mapping, nil
+	}
+	return importer.GuessMapping(columns), nil
+}
+
+// saveMappingIfNamed stores the mapping for reuse when the admin gave it a name
+func (h *Handler) saveMappingIfNamed(r *http.Request, mapping models.FieldMapping) error {
+	name := strings.TrimSpace(r.FormValue("save_as"))
+	if name == "" {
+		return nil
+	}
+	_, err := models.SaveImportMapping(h.db(r), name, mapping)
+	return err
+}
+
+// renderImportMapping shows the mapping step for columns read from file. When importing is true the
+// form imports straight away and offers a dry run; otherwise it only saves the mapping.
+func (h *Handler) renderImportMapping(w http.ResponseWriter, r *http.Request, title, action string, hidden map[string]string, format string, file io.Reader, mapping models.FieldMapping, importing bool, formError string) {
+	columns, rows, err := importer.Preview(format, file, previewRows)
+	if err != nil {
+		writeError(w, r, http.StatusUnprocessableEntity, fmt.Sprintf("Error reading file: %v", err))
+		return
+	}
+
+	if mapping == nil {
+		mapping, err = h.savedOrGuessedMapping(r, columns)
+		if err != nil {
+			writeFailure(w, r, "getting import mapping", err)
+			return
+		}
+	}
+
+	saved, err := models.GetImportMappings(h.db(r))
+	if err != nil {
+		writeFailure(w, r, "getting import mappings", err)
+		return
+	}
+
+	if formError != "" {
+		w.WriteHeader(http.StatusUnprocessableEntity)
+	}
+	render(w, r, templates.ImportMapping(title, action, hidden, columns, rows, mapping, saved, importing, formError))
+}
+
+// UploadMappingForm shows the column mapping step for an uploaded CSV or JSON file
+func (h *Handler) UploadMappingForm(w http.ResponseWriter, r *http.Request) {
+	h.renderUploadMapping(w, r, nil, "")
+}
+
+func (h *Handler) renderUploadMapping(w http.ResponseWriter, r *http.Request, mapping models.FieldMapping, formError string) {
+	token, format := r.FormValue("token"), r.FormValue("format")
+	path, err := importUploadPath(token)
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		writeError(w, r, http.StatusNotFound, "This upload has expired; upload the file again")
+		return
+	}
+	defer file.Close()
+
+	hidden := map[string]string{"token": token, "format": format}
+	if allOrNothing := r.FormValue("all_or_nothing"); allOrNothing != "" {
+		hidden["all_or_nothing"] = allOrNothing
+	}
+	h.renderImportMapping(w, r, "Map Columns", "/products/import/apply", hidden, format, file, mapping, true, formError)
+}
+
+// ImportStoredUpload imports an upload kept by the mapping step or a dry run. CSV and JSON
+// files are read with the mapping from the form; dry_run previews the import again.
+func (h *Handler) ImportStoredUpload(w http.ResponseWriter, r *http.Request) {
+	// Parse form
+	if err := r.ParseForm(); err != nil {
+		writeError(w, r, http.StatusBadRequest, "Invalid form data")
+		return
+	}
+
+	var mapping models.FieldMapping
+	if format := r.FormValue("format"); format == importer.FormatCSV || format == importer.FormatJSON {
+		mapping = mappingFromForm(r)
+		if err := importer.ValidateMapping(mapping); err != nil {
+			h.renderUploadMapping(w, r, mapping, err.Error())
+			return
+		}
+	}
+
+	h.importUpload(w, r, mapping, r.FormValue("dry_run") != "")
+}
+
+// importUpload imports the stored upload named by the token in the form, reading it with
+// mapping when one is given. A dry run writes nothing, keeps the upload and offers to apply
+// the previewed changes with the same form values.
+func (h *Handler) importUpload(w http.ResponseWriter, r *http.Request, mapping models.FieldMapping, dryRun bool) {
+	// Errors in a mapped import are shown on the mapping step so the mapping can be fixed
+	fail := func(message string) {
+		if mapping != nil {
+			h.renderUploadMapping(w, r, mapping, message)
+		} else {
+			h.renderImportForm(w, r, message)
+		}
+	}
+
+	path, err := importUploadPath(r.FormValue("token"))
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		writeError(w, r, http.StatusNotFound, "This upload has expired; upload the file again")
+		return
+	}
+	defer file.Close()
+
+	var products []models.ProductImport
+	if mapping != nil {
+		products, err = importer.ParseMapped(r.FormValue("format"), file, mapping)
+	} else {
+		products, err = importer.Parse(r.FormValue("format"), file)
+	}
+	if err != nil {
+		fail(err.Error())
+		return
+	}
+
+	if mapping != nil && !dryRun {
+		if err := h.saveMappingIfNamed(r, mapping); err != nil {
+			fail(publicMessage(err, "saving mapping"))
+			return
+		}
+	}
+
+	results, err := h.runImport(r, products, dryRun)
+	if err != nil {
+		writeFailure(w, r, "importing products", err)
+		return
+	}
+	if !dryRun {
+		os.Remove(path)
+	}
+
+	if wantsJSON(r) {
+		writeJSON(w, http.StatusOK, results)
+		return
+	}
+
+	apply := url.Values{}
+	for name, values := range r.Form {
+		if name != "dry_run" {
+			apply[name] = values
+		}
+	}
+	render(w, r, templates.ImportResults(results, dryRun, apply))
+}
+
+// FeedMappingForm downloads a CSV or JSON feed and shows the column mapping step for it
+func (h *Handler) FeedMappingForm(w http.ResponseWriter, r *http.Request) {
+	feed, err := models.GetImportFeedByID(h.db(r), chi.URLParam(r, "id"))
+	if err != nil {
+		writeFailure(w, r, "getting import feed", err)
+		return
+	}
+
+	var mapping models.FieldMapping
+	if len(feed.FieldMapping) > 0 && r.URL.Query().Get("mapping_id") == "" {
+		mapping = feed.FieldMapping
+	}
+	h.renderFeedMapping(w, r, feed, mapping, "")
+}
+
+func (h *Handler) renderFeedMapping(w http.ResponseWriter, r *http.Request, feed models.ImportFeed, mapping models.FieldMapping, formError string) {
+	if feed.Format != importer.FormatCSV && feed.Format != importer.FormatJSON {
+		writeError(w, r, http.StatusBadRequest, "Only CSV and JSON feeds use a column mapping")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 8*time.Second)
+	defer cancel()
+
+	body, err := importer.Download(ctx, feed.URL)
+	if err != nil {
+		writeError(w, r, http.StatusBadGateway, fmt.Sprintf("Error downloading feed: %v", err))
+		return
+	}
+	defer body.Close()
+
+	action := "/products/import/feeds/" + feed.ID + "/mapping"
+	h.renderImportMapping(w, r, "Map Columns: "+feed.Name, action, nil, feed.Format, body, mapping, false, formError)
+}
+
+// SaveFeedMapping stores the mapping chosen for a feed, used from its next run on
+func (h *Handler) SaveFeedMapping(w http.ResponseWriter, r *http.Request) {
+	feed, err := models.GetImportFeedByID(h.db(r), chi.URLParam(r, "id"))
+	if err != nil {
+		writeFailure(w, r, "getting import feed", err)
+		return
+	}
+
+	// Parse form
+	if err := r.ParseForm(); err != nil {
+		writeError(w, r, http.StatusBadRequest, "Invalid form data")
+		return
+	}
+
+	mapping := mappingFromForm(r)
+	if err := importer.ValidateMapping(mapping); err != nil {
+		h.renderFeedMapping(w, r, feed, mapping, err.Error())
+		return
+	}
+	if err := h.saveMappingIfNamed(r, mapping); err != nil {
+		h.renderFeedMapping(w, r, feed, mapping, publicMessage(err, "saving mapping"))
+		return
+	}
+
+	if err := models.SetImportFeedMapping(h.db(r), feed.ID, mapping); err != nil {
+		writeFailure(w, r, "updating import feed", err)
+		return
+	}
+
+	http.Redirect(w, r, "/products/import/feeds/"+feed.ID, http.StatusSeeOther)
+}
+
+// DeleteImportMapping handles the request to remove a saved mapping
+func (h *Handler) DeleteImportMapping(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	if id == "" {
+		writeError(w, r, http.StatusBadRequest, "Missing mapping ID")
+		return
+	}
+
+	if err := models.DeleteImportMapping(h.db(r), id); err != nil {
+		writeFailure(w, r, "deleting import mapping", err)
+		return
+	}
+
+	// For HTMX requests, just return 200 OK so the row is removed
+	w.WriteHeader(http.StatusOK)
+}
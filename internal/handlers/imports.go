@@ -0,0 +1,112 @@
+package handlers
+
+import (
+	"log"
+	"net/http"
+	"net/url"
+
+	"github.com/ngenohkevin/kuiper_admin/internal/importer"
+	"github.com/ngenohkevin/kuiper_admin/internal/models"
+	"github.com/ngenohkevin/kuiper_admin/internal/templates"
+)
+
+// maxImportSize caps uploaded catalog exports
+const maxImportSize = 20 << 20 // 20 MB
+
+// ImportProductsForm shows the upload form for catalog exports and the saved column mappings
+func (h *Handler) ImportProductsForm(w http.ResponseWriter, r *http.Request) {
+	h.renderImportForm(w, r, "")
+}
+
+// renderImportForm shows the upload form, with formError above it when the last upload was rejected
+func (h *Handler) renderImportForm(w http.ResponseWriter, r *http.Request, formError string) {
+	mappings, err := models.GetImportMappings(h.db(r))
+	if err != nil {
+		writeFailure(w, r, "getting import mappings", err)
+		return
+	}
+
+	if formError != "" {
+		w.WriteHeader(http.StatusBadRequest)
+	}
+	render(w, r, templates.ImportProductsForm(mappings, formError))
+}
+
+// ImportProducts parses an uploaded catalog export and creates or updates its products by slug
+func (h *Handler) ImportProducts(w http.ResponseWriter, r *http.Request) {
+	r.Body = http.MaxBytesReader(w, r.Body, maxImportSize)
+	if err := r.ParseMultipartForm(maxImportSize); err != nil {
+		h.renderImportForm(w, r, "The upload is too large or invalid")
+		return
+	}
+
+	file, _, err := r.FormFile("file")
+	if err != nil {
+		h.renderImportForm(w, r, "Choose an export file to import")
+		return
+	}
+	defer file.Close()
+
+	// Plain CSV and JSON files go through the column mapping step first
+	if format := r.FormValue("format"); format == importer.FormatCSV || format == importer.FormatJSON {
+		token, err := saveImportUpload(file)
+		if err != nil {
+			writeFailure(w, r, "saving upload", err)
+			return
+		}
+		query := url.Values{"token": {token}, "format": {format}}
+		if allOrNothing := r.FormValue("all_or_nothing"); allOrNothing != "" {
+			query.Set("all_or_nothing", allOrNothing)
+		}
+		http.Redirect(w, r, "/products/import/map?"+query.Encode(), http.StatusSeeOther)
+		return
+	}
+
+	// A dry run keeps the upload so the preview can be applied without uploading again
+	if r.FormValue("dry_run") != "" {
+		token, err := saveImportUpload(file)
+		if err != nil {
+			writeFailure(w, r, "saving upload", err)
+			return
+		}
+		r.Form.Set("token", token)
+		h.importUpload(w, r, nil, true)
+		return
+	}
+
+	products, err := importer.Parse(r.FormValue("format"), file)
+	if err != nil {
+		h.renderImportForm(w, r, err.Error())
+		return
+	}
+
+	results, err := h.runImport(r, products, false)
+	if err != nil {
+		writeFailure(w, r, "importing products", err)
+		return
+	}
+
+	if wantsJSON(r) {
+		writeJSON(w, http.StatusOK, results)
+		return
+	}
+
+	render(w, r, templates.ImportResults(results, false, nil))
+}
+
+// runImport imports the products, all in one transaction when the form asks for all or nothing
+func (h *Handler) runImport(r *http.Request, products []models.ProductImport, dryRun bool) ([]models.ImportRowResult, error) {
+	if r.FormValue("all_or_nothing") != "" {
+		return models.ImportProductsTogether(h.db(r), products, dryRun)
+	}
+	return models.ImportProducts(h.db(r), products, dryRun), nil
+}
+
+// ProductImportTemplate downloads the product CSV with its columns and an example row to fill in
+func (h *Handler) ProductImportTemplate(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	w.Header().Set("Content-Disposition", `attachment; filename="products-template.csv"`)
+	if err := importer.WriteProductTemplate(w); err != nil {
+		log.Printf("Error writing product import template: %v", err)
+	}
+}
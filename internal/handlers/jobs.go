@@ -0,0 +1,21 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/ngenohkevin/kuiper_admin/internal/jobs"
+	"github.com/ngenohkevin/kuiper_admin/internal/templates"
+)
+
+// Jobs shows the scheduled background jobs with how their last runs went, and the progress of
+// exports running now or finished recently
+func (h *Handler) Jobs(w http.ResponseWriter, r *http.Request) {
+	schedules, tasks := jobs.Schedules(), jobs.Tasks()
+
+	if wantsJSON(r) {
+		writeJSON(w, http.StatusOK, map[string]interface{}{"schedules": schedules, "tasks": tasks})
+		return
+	}
+
+	render(w, r, templates.JobsPage(schedules, tasks))
+}
@@ -0,0 +1,64 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/ngenohkevin/kuiper_admin/internal/live"
+)
+
+// liveKeepAlive is how often an idle live stream sends a comment, so proxies don't close it
+const liveKeepAlive = 25 * time.Second
+
+// LiveUpdates streams changes other admins make as server-sent events, one "change" event per
+// activity entry, for pages to update in place. The admin's own changes aren't sent back, nor
+// are changes made in other tenants.
+func (h *Handler) LiveUpdates(w http.ResponseWriter, r *http.Request) {
+	username := h.Session.GetString(r.Context(), "username")
+	tenant := h.db(r).Schema
+
+	// The stream outlives the server's write timeout, which is meant for ordinary pages
+	rc := http.NewResponseController(w)
+	if err := rc.SetWriteDeadline(time.Time{}); err != nil {
+		writeError(w, r, http.StatusInternalServerError, "Live updates aren't supported here")
+		return
+	}
+
+	events, unsubscribe := live.Subscribe()
+	defer unsubscribe()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprint(w, "retry: 5000\n\n")
+	rc.Flush()
+
+	keepAlive := time.NewTicker(liveKeepAlive)
+	defer keepAlive.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-keepAlive.C:
+			fmt.Fprint(w, ": keep-alive\n\n")
+		case e, ok := <-events:
+			if !ok {
+				return
+			}
+			if e.Tenant != tenant || (e.Actor != "" && e.Actor == username) {
+				continue
+			}
+			data, err := json.Marshal(e)
+			if err != nil {
+				continue
+			}
+			fmt.Fprintf(w, "event: change\ndata: %s\n\n", data)
+		}
+		if err := rc.Flush(); err != nil {
+			return
+		}
+	}
+}
@@ -0,0 +1,113 @@
+package handlers
+
+import (
+	"log"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/ngenohkevin/kuiper_admin/internal/models"
+	"github.com/ngenohkevin/kuiper_admin/internal/templates"
+)
+
+// uuidPattern matches a product ID anywhere in a scanned code, e.g. the admin URL encoded in a product QR code
+var uuidPattern = regexp.MustCompile(`[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}`)
+
+// MobileStock shows the stripped-down stock lookup page for phones
+func (h *Handler) MobileStock(w http.ResponseWriter, r *http.Request) {
+	query := strings.TrimSpace(r.URL.Query().Get("q"))
+
+	// A scanned QR code or pasted admin link carries the product ID, so jump straight to it
+	if id := uuidPattern.FindString(query); id != "" {
+		if _, err := models.GetProductByID(h.db(r), id); err == nil {
+			target := "/m/stock/" + id
+			if r.Header.Get("HX-Request") == "true" {
+				w.Header().Set("HX-Redirect", target)
+				w.WriteHeader(http.StatusOK)
+				return
+			}
+			http.Redirect(w, r, target, http.StatusSeeOther)
+			return
+		}
+	}
+
+	var products []models.Product
+	if query != "" {
+		var err error
+		products, err = models.SearchProducts(h.db(r), query, false)
+		if err != nil {
+			writeFailure(w, r, "searching products", err)
+			return
+		}
+	}
+
+	// HTMX search requests only need the result list
+	if r.Header.Get("HX-Request") == "true" {
+		render(w, r, templates.MobileStockResults(query, products))
+		return
+	}
+
+	render(w, r, templates.MobileStockSearch(query, products))
+}
+
+// MobileStockProduct shows the stock counters for a single product and its variants
+func (h *Handler) MobileStockProduct(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	if id == "" {
+		writeError(w, r, http.StatusBadRequest, "Missing product ID")
+		return
+	}
+
+	product, err := models.GetProductByID(h.db(r), id)
+	if err != nil {
+		writeFailure(w, r, "getting product", err)
+		return
+	}
+
+	render(w, r, templates.MobileStockProduct(product))
+}
+
+// AdjustMobileStock applies a +/- stock change to a product or one of its variants
+// and returns the updated counter for HTMX to swap in place
+func (h *Handler) AdjustMobileStock(w http.ResponseWriter, r *http.Request) {
+	productID := chi.URLParam(r, "id")
+	if productID == "" {
+		writeError(w, r, http.StatusBadRequest, "Missing product ID")
+		return
+	}
+
+	// Parse form
+	if err := r.ParseForm(); err != nil {
+		writeError(w, r, http.StatusBadRequest, "Invalid form data")
+		return
+	}
+
+	variantID := r.FormValue("variant_id")
+	delta, err := strconv.Atoi(r.FormValue("delta"))
+	if err != nil || delta == 0 {
+		writeError(w, r, http.StatusBadRequest, "Invalid stock change")
+		return
+	}
+
+	change := models.StockChange{
+		Reason: models.MovementManual,
+		Note:   "Quick stock",
+		Actor:  h.Session.GetString(r.Context(), "username"),
+	}
+
+	var stockCount int
+	if variantID != "" {
+		stockCount, err = models.AdjustProductVariantStock(h.db(r), productID, variantID, delta, change)
+	} else {
+		stockCount, err = models.AdjustProductStock(h.db(r), productID, delta, change)
+	}
+	if err != nil {
+		log.Printf("Error adjusting stock for product %s (variant %q): %v", productID, variantID, err)
+		writeFailure(w, r, "adjusting stock", err)
+		return
+	}
+
+	render(w, r, templates.MobileStockCounter(productID, variantID, stockCount))
+}
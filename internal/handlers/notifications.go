@@ -0,0 +1,51 @@
+package handlers
+
+import (
+	"log"
+	"net/http"
+
+	"github.com/ngenohkevin/kuiper_admin/internal/models"
+	"github.com/ngenohkevin/kuiper_admin/internal/templates"
+)
+
+// Notifications is the notification center: the alerts raised for every admin, newest first,
+// with those raised since the admin last looked picked out. Opening it marks them all read.
+func (h *Handler) Notifications(w http.ResponseWriter, r *http.Request) {
+	username := h.Session.GetString(r.Context(), "username")
+	notifications, seenAt, err := models.GetNotifications(h.db(r), username)
+	if err != nil {
+		writeFailure(w, r, "getting notifications", err)
+		return
+	}
+	if err := models.MarkNotificationsSeen(h.db(r), username); err != nil {
+		// The list is still worth showing; the badge just stays lit
+		log.Printf("Error marking notifications seen by %s: %v", username, err)
+	}
+
+	if wantsJSON(r) {
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"notifications": notifications,
+			"seen_at":       seenAt,
+			"thresholds":    models.AnomalyThresholdsFromEnv(),
+		})
+		return
+	}
+
+	render(w, r, templates.Notifications(notifications, seenAt, models.AnomalyThresholdsFromEnv()))
+}
+
+// UnreadNotifications is the badge on the notification bell, which every page polls
+func (h *Handler) UnreadNotifications(w http.ResponseWriter, r *http.Request) {
+	unread, err := models.CountUnreadNotifications(h.db(r), h.Session.GetString(r.Context(), "username"))
+	if err != nil {
+		writeFailure(w, r, "counting unread notifications", err)
+		return
+	}
+
+	if wantsJSON(r) {
+		writeJSON(w, http.StatusOK, map[string]int{"unread": unread})
+		return
+	}
+
+	render(w, r, templates.NotificationBadge(unread))
+}
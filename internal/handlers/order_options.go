@@ -0,0 +1,29 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/ngenohkevin/kuiper_admin/internal/models"
+)
+
+// parseOrderOptions reads the order_mode and expected_at fields of a parsed form. ok is false
+// when the form has no order_mode field, so forms without the fields leave the settings alone.
+func parseOrderOptions(r *http.Request) (opts models.OrderOptions, ok bool, err error) {
+	if _, ok := r.Form["order_mode"]; !ok {
+		return models.OrderOptions{}, false, nil
+	}
+
+	var expectedAt *time.Time
+	if s := r.FormValue("expected_at"); s != "" {
+		t, err := time.Parse("2006-01-02", s)
+		if err != nil {
+			return models.OrderOptions{}, true, fmt.Errorf("invalid expected date %q", s)
+		}
+		expectedAt = &t
+	}
+
+	opts, err = models.NewOrderOptions(r.FormValue("order_mode"), expectedAt)
+	return opts, true, err
+}
@@ -0,0 +1,266 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/ngenohkevin/kuiper_admin/internal/jobs"
+	"github.com/ngenohkevin/kuiper_admin/internal/mailer"
+	"github.com/ngenohkevin/kuiper_admin/internal/models"
+	"github.com/ngenohkevin/kuiper_admin/internal/shipping"
+	"github.com/ngenohkevin/kuiper_admin/internal/storefront"
+	"github.com/ngenohkevin/kuiper_admin/internal/templates"
+)
+
+// orderURL is an order's page. Order IDs come from the storefront, so they are escaped.
+func orderURL(id string) string {
+	return "/orders/" + url.PathEscape(id)
+}
+
+// orderCrumbs is the trail down to an order
+func (h *Handler) orderCrumbs(r *http.Request, order models.Order) []templates.Breadcrumb {
+	return []templates.Breadcrumb{
+		{Label: "Orders", URL: h.listURL(r, "/orders")},
+		{Label: "Order " + order.ID, URL: orderURL(order.ID)},
+	}
+}
+
+// ListOrders shows a page of the orders the storefront reported, optionally in one ?status=
+func (h *Handler) ListOrders(w http.ResponseWriter, r *http.Request) {
+	query := listQuery(r, "status", models.OrderSorts)
+	result, err := models.GetOrdersPaginated(h.db(r), query)
+	if err != nil {
+		writeFailure(w, r, "getting orders", err)
+		return
+	}
+	if wantsJSON(r) {
+		writeList(w, r, result)
+		return
+	}
+
+	counts, err := models.CountOrdersByStatus(h.db(r))
+	if err != nil {
+		writeFailure(w, r, "counting orders", err)
+		return
+	}
+
+	state := templates.NewListState("/orders", "orders", "status", query, result)
+	h.rememberList(r, "/orders")
+	render(w, r, templates.OrderList(state, result.Data, counts))
+}
+
+// GetOrder shows an order with its lines, the form for changing its status, its shipping labels
+// and the log of the notifications its customer was sent
+func (h *Handler) GetOrder(w http.ResponseWriter, r *http.Request) {
+	h.renderOrder(w, r, http.StatusOK, r.URL.Query().Get("notice"), "")
+}
+
+// renderOrder shows an order, with notice saying what the last change did or errorMsg why it
+// was turned down
+func (h *Handler) renderOrder(w http.ResponseWriter, r *http.Request, status int, notice, errorMsg string) {
+	order, err := models.GetOrder(h.db(r), chi.URLParam(r, "id"))
+	if err != nil {
+		writeFailure(w, r, "getting order", err)
+		return
+	}
+	notifications, err := models.GetOrderNotifications(h.db(r), order.ID)
+	if err != nil {
+		writeFailure(w, r, "getting order notifications", err)
+		return
+	}
+	labels, err := models.GetShippingLabels(h.db(r), order.ID)
+	if err != nil {
+		writeFailure(w, r, "getting shipping labels", err)
+		return
+	}
+	if wantsJSON(r) {
+		writeJSON(w, status, struct {
+			models.Order
+			Notifications  []models.OrderNotification `json:"notifications"`
+			ShippingLabels []models.ShippingLabel     `json:"shipping_labels"`
+		}{order, notifications, labels})
+		return
+	}
+
+	templatesByStatus := make(map[string]models.OrderStatusTemplate)
+	statusTemplates, err := models.GetOrderStatusTemplates(h.db(r))
+	if err != nil {
+		writeFailure(w, r, "getting order status templates", err)
+		return
+	}
+	for _, t := range statusTemplates {
+		templatesByStatus[t.Status] = t
+	}
+
+	w.WriteHeader(status)
+	ctx := withCrumbs(r, current(h.orderCrumbs(r, order))...)
+	render(w, r.WithContext(ctx), templates.OrderView(order, notifications, labels, templatesByStatus,
+		shipping.ConfigFromEnv().Enabled(), notice, errorMsg))
+}
+
+// SetOrderStatus moves an order to another status, queueing the customer notifications the
+// status's template turns on unless notify is off
+func (h *Handler) SetOrderStatus(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+
+	body := struct {
+		Status string `json:"status"`
+		Notify *bool  `json:"notify"` // Defaults to true
+	}{}
+	var err error
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "application/json") {
+		if err = json.NewDecoder(r.Body).Decode(&body); err != nil {
+			err = fmt.Errorf("Invalid JSON: expected status and notify")
+		}
+	} else if err = r.ParseForm(); err != nil {
+		err = fmt.Errorf("Invalid form data")
+	} else {
+		notify := r.FormValue("notify") != ""
+		body.Status, body.Notify = r.FormValue("status"), &notify
+	}
+	notify := body.Notify == nil || *body.Notify
+
+	var order models.Order
+	var queued []models.OrderNotification
+	if err == nil {
+		order, queued, err = models.SetOrderStatus(h.db(r), id, body.Status, notify, h.Session.GetString(r.Context(), "username"))
+	}
+	if err != nil {
+		if status, _ := classifyError(err); wantsJSON(r) || (status != http.StatusBadRequest && status != http.StatusConflict) {
+			writeFailure(w, r, "changing order status", err)
+			return
+		}
+		h.renderOrder(w, r, http.StatusUnprocessableEntity, "", publicMessage(err, "changing order status"))
+		return
+	}
+
+	if wantsJSON(r) {
+		writeJSON(w, http.StatusOK, struct {
+			models.Order
+			Queued []models.OrderNotification `json:"queued_notifications"`
+		}{order, queued})
+		return
+	}
+
+	h.recordActivity(r, models.ActivityOrder, order.ID, models.ActivityStatusChanged, "Marked "+order.Status+queuedSummary(queued))
+
+	notice := "Marked " + order.Status
+	switch pending := countQueued(queued); {
+	case pending == 1:
+		notice += "; the customer will be notified shortly"
+	case pending > 1:
+		notice += fmt.Sprintf("; %d notifications to the customer are queued", pending)
+	}
+	http.Redirect(w, r, orderURL(order.ID)+"?notice="+url.QueryEscape(notice), http.StatusSeeOther)
+}
+
+// countQueued counts the notifications waiting to be sent, leaving out those already skipped
+func countQueued(notifications []models.OrderNotification) int {
+	n := 0
+	for _, notification := range notifications {
+		if notification.State == models.OrderNotificationPending {
+			n++
+		}
+	}
+	return n
+}
+
+// queuedSummary notes on an order's timeline that a status change notified the customer
+func queuedSummary(queued []models.OrderNotification) string {
+	if countQueued(queued) == 0 {
+		return ""
+	}
+	return "; customer notified"
+}
+
+// RetryOrderNotification queues a failed or skipped notification again
+func (h *Handler) RetryOrderNotification(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	if err := models.RetryOrderNotification(h.db(r), id, chi.URLParam(r, "notificationID")); err != nil {
+		writeFailure(w, r, "retrying order notification", err)
+		return
+	}
+	if wantsJSON(r) {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	http.Redirect(w, r, orderURL(id)+"?notice="+url.QueryEscape("Queued the notification again"), http.StatusSeeOther)
+}
+
+// OrderNotificationSettings shows the template of each order status and which ways of sending
+// it are set up
+func (h *Handler) OrderNotificationSettings(w http.ResponseWriter, r *http.Request) {
+	h.renderOrderNotificationSettings(w, r, http.StatusOK, nil, "")
+}
+
+// renderOrderNotificationSettings shows the templates. failed, when set, is a template that
+// wasn't saved, shown as it was typed with errorMsg saying why.
+func (h *Handler) renderOrderNotificationSettings(w http.ResponseWriter, r *http.Request, status int, failed *models.OrderStatusTemplate, errorMsg string) {
+	statusTemplates, err := models.GetOrderStatusTemplates(h.db(r))
+	if err != nil {
+		writeFailure(w, r, "getting order status templates", err)
+		return
+	}
+	if wantsJSON(r) {
+		writeJSON(w, status, statusTemplates)
+		return
+	}
+	if failed != nil {
+		for i := range statusTemplates {
+			if statusTemplates[i].Status == failed.Status {
+				statusTemplates[i] = *failed
+			}
+		}
+	}
+
+	mail, hook, err := jobs.OrderNotificationChannels(h.db(r), mailer.ConfigFromEnv(), storefront.ConfigFromEnv())
+	if err != nil {
+		writeFailure(w, r, "getting store settings", err)
+		return
+	}
+
+	w.WriteHeader(status)
+	render(w, r, templates.OrderNotificationSettings(statusTemplates, mail.Enabled(), hook.Enabled(), r.URL.Query().Get("saved"), failed, errorMsg))
+}
+
+// SaveOrderStatusTemplate replaces the template of one status
+func (h *Handler) SaveOrderStatusTemplate(w http.ResponseWriter, r *http.Request) {
+	t := models.OrderStatusTemplate{Status: chi.URLParam(r, "status")}
+	var err error
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "application/json") {
+		if err = json.NewDecoder(r.Body).Decode(&t); err != nil {
+			err = fmt.Errorf("Invalid JSON: expected send_email, send_webhook, subject and body")
+		}
+		t.Status = chi.URLParam(r, "status")
+	} else if err = r.ParseForm(); err != nil {
+		err = fmt.Errorf("Invalid form data")
+	} else {
+		t.SendEmail = r.FormValue("send_email") != ""
+		t.SendWebhook = r.FormValue("send_webhook") != ""
+		t.Subject = r.FormValue("subject")
+		t.Body = r.FormValue("body")
+	}
+
+	var saved models.OrderStatusTemplate
+	if err == nil {
+		saved, err = models.SaveOrderStatusTemplate(h.db(r), t, h.Session.GetString(r.Context(), "username"))
+	}
+	if err != nil {
+		if status, _ := classifyError(err); wantsJSON(r) || status != http.StatusBadRequest {
+			writeFailure(w, r, "saving order status template", err)
+			return
+		}
+		h.renderOrderNotificationSettings(w, r, http.StatusUnprocessableEntity, &t, publicMessage(err, "saving order status template"))
+		return
+	}
+
+	if wantsJSON(r) {
+		writeJSON(w, http.StatusOK, saved)
+		return
+	}
+	http.Redirect(w, r, "/settings/order-notifications?saved="+url.QueryEscape(saved.Status)+"#status-"+saved.Status, http.StatusSeeOther)
+}
@@ -0,0 +1,61 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/ngenohkevin/kuiper_admin/internal/models"
+	"github.com/ngenohkevin/kuiper_admin/internal/templates"
+)
+
+// OrphanChecks shows the maintenance page with how many orphaned rows each check finds
+func (h *Handler) OrphanChecks(w http.ResponseWriter, r *http.Request) {
+	checks, err := models.GetOrphanChecks(h.db(r))
+	if err != nil {
+		writeFailure(w, r, "checking for orphaned data", err)
+		return
+	}
+
+	if wantsJSON(r) {
+		writeList(w, r, models.SinglePage(checks))
+		return
+	}
+
+	render(w, r, templates.OrphanChecks(checks))
+}
+
+// CleanOrphans previews or applies the cleanup for one type of orphaned data. A dry run lists
+// every orphan; the cleanup itself only touches the IDs carried over from that preview.
+func (h *Handler) CleanOrphans(w http.ResponseWriter, r *http.Request) {
+	check, err := models.GetOrphanCheck(chi.URLParam(r, "type"))
+	if err != nil {
+		writeFailure(w, r, "getting orphan check", err)
+		return
+	}
+
+	// Parse form
+	if err := r.ParseForm(); err != nil {
+		writeError(w, r, http.StatusBadRequest, "Invalid form data")
+		return
+	}
+
+	dryRun := r.FormValue("dry_run") != ""
+	ids := uniqueIDs(r.Form["ids"])
+	if !dryRun && len(ids) == 0 {
+		writeError(w, r, http.StatusBadRequest, "Preview the cleanup first to choose the rows it fixes")
+		return
+	}
+
+	rows, err := models.CleanOrphans(h.db(r), check.Type, ids, dryRun)
+	if err != nil {
+		writeFailure(w, r, "cleaning up orphaned data", err)
+		return
+	}
+
+	if wantsJSON(r) {
+		writeJSON(w, http.StatusOK, rows)
+		return
+	}
+
+	render(w, r, templates.OrphanCleanup(check, rows, dryRun))
+}
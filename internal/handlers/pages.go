@@ -0,0 +1,242 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/ngenohkevin/kuiper_admin/internal/markdown"
+	"github.com/ngenohkevin/kuiper_admin/internal/models"
+	"github.com/ngenohkevin/kuiper_admin/internal/templates"
+)
+
+// catalogPage is a published page as the storefront gets it, with its body also rendered to HTML
+type catalogPage struct {
+	Slug      string    `json:"slug"`
+	Title     string    `json:"title"`
+	Body      string    `json:"body,omitempty"`
+	BodyHTML  string    `json:"body_html,omitempty"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// pageCrumbs is the trail down to a page
+func pageCrumbs(page models.Page) []templates.Breadcrumb {
+	return []templates.Breadcrumb{
+		{Label: "Pages", URL: "/pages"},
+		{Label: page.Title, URL: "/pages/" + page.ID + "/edit"},
+	}
+}
+
+// parsePage reads a page from the form or, for JSON clients, a JSON body
+func parsePage(r *http.Request) (models.Page, error) {
+	var page models.Page
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "application/json") {
+		if err := json.NewDecoder(r.Body).Decode(&page); err != nil {
+			return models.Page{}, fmt.Errorf("Invalid JSON: expected slug, title, body and published")
+		}
+		return page, nil
+	}
+
+	if err := r.ParseForm(); err != nil {
+		return models.Page{}, fmt.Errorf("Invalid form data")
+	}
+	page.Slug = r.FormValue("slug")
+	page.Title = r.FormValue("title")
+	page.Body = r.FormValue("body")
+	page.Published = r.FormValue("published") != ""
+	return page, nil
+}
+
+// ListPages shows every content page
+func (h *Handler) ListPages(w http.ResponseWriter, r *http.Request) {
+	pages, err := models.GetPages(h.db(r), false)
+	if err != nil {
+		writeFailure(w, r, "getting pages", err)
+		return
+	}
+	if wantsJSON(r) {
+		writeList(w, r, models.SinglePage(pages))
+		return
+	}
+
+	render(w, r.WithContext(withCrumbs(r, templates.Breadcrumb{Label: "Pages"})), templates.PageList(pages))
+}
+
+// NewPageForm shows the form for a new page
+func (h *Handler) NewPageForm(w http.ResponseWriter, r *http.Request) {
+	ctx := withCrumbs(r, templates.Breadcrumb{Label: "Pages", URL: "/pages"}, templates.Breadcrumb{Label: "New"})
+	render(w, r.WithContext(ctx), templates.PageForm(models.Page{}, nil, false, ""))
+}
+
+// CreatePage saves a new page, showing the form again with the problem when it is invalid
+func (h *Handler) CreatePage(w http.ResponseWriter, r *http.Request) {
+	page, err := parsePage(r)
+	if err == nil {
+		page, err = models.CreatePage(h.db(r), page, h.Session.GetString(r.Context(), "username"))
+	}
+	if err != nil {
+		h.pageFormFailed(w, r, page, "creating page", err)
+		return
+	}
+
+	if wantsJSON(r) {
+		writeJSON(w, http.StatusCreated, page)
+		return
+	}
+	http.Redirect(w, r, "/pages/"+page.ID+"/edit?saved=1", http.StatusSeeOther)
+}
+
+// EditPageForm shows the form for changing a page, with its revision history
+func (h *Handler) EditPageForm(w http.ResponseWriter, r *http.Request) {
+	page, err := models.GetPageByID(h.db(r), chi.URLParam(r, "id"))
+	if err != nil {
+		writeFailure(w, r, "getting page", err)
+		return
+	}
+	if wantsJSON(r) {
+		writeJSON(w, http.StatusOK, page)
+		return
+	}
+	revisions, err := models.GetPageRevisions(h.db(r), page.ID)
+	if err != nil {
+		writeFailure(w, r, "getting page revisions", err)
+		return
+	}
+
+	ctx := withCrumbs(r, current(pageCrumbs(page))...)
+	render(w, r.WithContext(ctx), templates.PageForm(page, revisions, r.URL.Query().Get("saved") != "", ""))
+}
+
+// UpdatePage saves changes to a page as a new revision
+func (h *Handler) UpdatePage(w http.ResponseWriter, r *http.Request) {
+	page, err := parsePage(r)
+	page.ID = chi.URLParam(r, "id")
+	if err == nil {
+		page, err = models.UpdatePage(h.db(r), page, h.Session.GetString(r.Context(), "username"))
+	}
+	if err != nil {
+		h.pageFormFailed(w, r, page, "updating page", err)
+		return
+	}
+
+	if wantsJSON(r) {
+		writeJSON(w, http.StatusOK, page)
+		return
+	}
+	http.Redirect(w, r, "/pages/"+page.ID+"/edit?saved=1", http.StatusSeeOther)
+}
+
+// pageFormFailed shows the page form again with what the admin wrote and why it was turned down.
+// JSON clients and errors that aren't about the input get the usual error response.
+func (h *Handler) pageFormFailed(w http.ResponseWriter, r *http.Request, page models.Page, action string, err error) {
+	status, _ := classifyError(err)
+	if wantsJSON(r) || (status != http.StatusBadRequest && status != http.StatusConflict) {
+		writeFailure(w, r, action, err)
+		return
+	}
+
+	crumbs := []templates.Breadcrumb{{Label: "Pages", URL: "/pages"}, {Label: "New"}}
+	var revisions []models.PageRevision
+	if page.ID != "" {
+		crumbs = current(pageCrumbs(page))
+		revisions, _ = models.GetPageRevisions(h.db(r), page.ID)
+	}
+	w.WriteHeader(http.StatusUnprocessableEntity)
+	render(w, r.WithContext(withCrumbs(r, crumbs...)), templates.PageForm(page, revisions, false, publicMessage(err, action)))
+}
+
+// DeletePage removes a page and its history
+func (h *Handler) DeletePage(w http.ResponseWriter, r *http.Request) {
+	if err := models.DeletePage(h.db(r), chi.URLParam(r, "id")); err != nil {
+		writeFailure(w, r, "deleting page", err)
+		return
+	}
+
+	if r.Header.Get("HX-Request") == "true" {
+		w.Header().Set("HX-Redirect", "/pages")
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+	http.Redirect(w, r, "/pages", http.StatusSeeOther)
+}
+
+// PageRevision shows a page as one of its revisions left it
+func (h *Handler) PageRevision(w http.ResponseWriter, r *http.Request) {
+	page, err := models.GetPageByID(h.db(r), chi.URLParam(r, "id"))
+	if err != nil {
+		writeFailure(w, r, "getting page", err)
+		return
+	}
+	revision, err := models.GetPageRevision(h.db(r), page.ID, chi.URLParam(r, "revisionID"))
+	if err != nil {
+		writeFailure(w, r, "getting page revision", err)
+		return
+	}
+	if wantsJSON(r) {
+		writeJSON(w, http.StatusOK, revision)
+		return
+	}
+
+	ctx := withCrumbs(r, append(pageCrumbs(page), templates.Breadcrumb{Label: "Revision"})...)
+	render(w, r.WithContext(ctx), templates.PageRevisionView(page, revision))
+}
+
+// RestorePageRevision brings back a revision's title and body as the page's newest revision
+func (h *Handler) RestorePageRevision(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	page, err := models.RestorePageRevision(h.db(r), id, chi.URLParam(r, "revisionID"), h.Session.GetString(r.Context(), "username"))
+	if err != nil {
+		writeFailure(w, r, "restoring page revision", err)
+		return
+	}
+
+	if wantsJSON(r) {
+		writeJSON(w, http.StatusOK, page)
+		return
+	}
+	http.Redirect(w, r, "/pages/"+page.ID+"/edit?saved=1", http.StatusSeeOther)
+}
+
+// PreviewPage renders the Markdown being written in the page form
+func (h *Handler) PreviewPage(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		writeError(w, r, http.StatusBadRequest, "Invalid form data")
+		return
+	}
+	render(w, r, templates.PageBody(r.FormValue("body")))
+}
+
+// CatalogPages lists the published pages for the storefront's navigation, without their bodies
+func (h *Handler) CatalogPages(w http.ResponseWriter, r *http.Request) {
+	pages, err := models.GetPages(h.db(r), true)
+	if err != nil {
+		writeFailure(w, r, "getting pages", err)
+		return
+	}
+
+	listed := make([]catalogPage, 0, len(pages))
+	for _, page := range pages {
+		listed = append(listed, catalogPage{Slug: page.Slug, Title: page.Title, UpdatedAt: page.UpdatedAt})
+	}
+	writeCatalogJSON(w, r, paginate(w, r, models.SinglePage(listed)))
+}
+
+// CatalogPage returns a published page by slug, with its Markdown and the HTML it renders to
+func (h *Handler) CatalogPage(w http.ResponseWriter, r *http.Request) {
+	page, err := models.GetPublishedPage(h.db(r), chi.URLParam(r, "slug"))
+	if err != nil {
+		writeFailure(w, r, "getting page", err)
+		return
+	}
+
+	writeCatalogJSON(w, r, catalogPage{
+		Slug:      page.Slug,
+		Title:     page.Title,
+		Body:      page.Body,
+		BodyHTML:  markdown.ToHTML(page.Body),
+		UpdatedAt: page.UpdatedAt,
+	})
+}
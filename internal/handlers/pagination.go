@@ -0,0 +1,107 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/ngenohkevin/kuiper_admin/internal/models"
+)
+
+// listResponse is the envelope every API list is returned in:
+//
+//	{"data": [...], "meta": {"pagination": {...}}, "links": {"self": "...", "next": "...", "prev": null}}
+type listResponse[T any] struct {
+	Data  []T       `json:"data"`
+	Meta  listMeta  `json:"meta"`
+	Links listLinks `json:"links"`
+}
+
+type listMeta struct {
+	Pagination listPagination `json:"pagination"`
+}
+
+type listPagination struct {
+	Page       int   `json:"page"`
+	PageSize   int   `json:"page_size"`
+	TotalCount int64 `json:"total_count"`
+	TotalPages int   `json:"total_pages"`
+}
+
+// listLinks point at neighbouring pages; next and prev are null at either end
+type listLinks struct {
+	Self string  `json:"self"`
+	Next *string `json:"next"`
+	Prev *string `json:"prev"`
+}
+
+// pageURL is the request's URL with the page parameter set to page, keeping the other parameters
+func pageURL(r *http.Request, page int) string {
+	query := r.URL.Query()
+	query.Set("page", strconv.Itoa(page))
+	return r.URL.Path + "?" + query.Encode()
+}
+
+// paginate wraps a page of results in the list envelope and sets the matching Link header
+func paginate[T any](w http.ResponseWriter, r *http.Request, result models.PaginatedResult[T]) listResponse[T] {
+	data := result.Data
+	if data == nil {
+		data = []T{}
+	}
+
+	response := listResponse[T]{
+		Data: data,
+		Meta: listMeta{Pagination: listPagination{
+			Page:       result.Page,
+			PageSize:   result.PageSize,
+			TotalCount: result.TotalCount,
+			TotalPages: result.TotalPages,
+		}},
+		Links: listLinks{Self: pageURL(r, result.Page)},
+	}
+
+	var links []string
+	if result.HasNext {
+		next := pageURL(r, result.Page+1)
+		response.Links.Next = &next
+		links = append(links, `<`+next+`>; rel="next"`)
+	}
+	if result.HasPrev {
+		prev := pageURL(r, result.Page-1)
+		response.Links.Prev = &prev
+		links = append(links, `<`+prev+`>; rel="prev"`)
+	}
+	if result.TotalPages > 1 {
+		links = append(links, `<`+pageURL(r, 1)+`>; rel="first"`, `<`+pageURL(r, result.TotalPages)+`>; rel="last"`)
+	}
+	if len(links) > 0 {
+		w.Header().Set("Link", strings.Join(links, ", "))
+	}
+
+	return response
+}
+
+// writeList writes a page of results as JSON in the list envelope
+func writeList[T any](w http.ResponseWriter, r *http.Request, result models.PaginatedResult[T]) {
+	writeJSON(w, http.StatusOK, paginate(w, r, result))
+}
+
+// listQuery reads a list page's state from the URL: page, limit, q, sort and the filter in
+// filterParam. The page size defaults to the admin's preference and an unknown sort to the
+// list's default.
+func listQuery(r *http.Request, filterParam string, sorts models.SortOptions) models.ListQuery {
+	query := r.URL.Query()
+	pageSize, _ := listDefaults(r)
+	if limit, err := strconv.Atoi(query.Get("limit")); err == nil && limit > 0 && limit <= 100 {
+		pageSize = limit
+	}
+	page, _ := strconv.Atoi(query.Get("page"))
+
+	return models.ListQuery{
+		Page:     max(page, 1),
+		PageSize: pageSize,
+		Search:   strings.TrimSpace(query.Get("q")),
+		Filter:   query.Get(filterParam),
+		Sort:     sorts.Normalize(query.Get("sort")),
+	}
+}
@@ -0,0 +1,154 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/ngenohkevin/kuiper_admin/internal/models"
+	"github.com/ngenohkevin/kuiper_admin/internal/templates"
+)
+
+// LoadPreferences is middleware that attaches the signed-in admin's preferences to the
+// request context so list handlers and the layout can use them as defaults
+func (h *Handler) LoadPreferences(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		username := h.Session.GetString(r.Context(), "username")
+		if username == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		prefs, err := models.GetAdminPreferences(h.db(r), username)
+		if err != nil {
+			// Fall back to the defaults rather than failing the page
+			log.Printf("Error loading preferences for %s: %v", username, err)
+		}
+
+		next.ServeHTTP(w, r.WithContext(models.WithPreferences(r.Context(), prefs)))
+	})
+}
+
+// GetPreferences returns the current admin's preferences as JSON, or the
+// preferences page when requested from a browser
+func (h *Handler) GetPreferences(w http.ResponseWriter, r *http.Request) {
+	prefs := models.PreferencesFromContext(r.Context())
+
+	if wantsJSON(r) {
+		writeJSON(w, http.StatusOK, prefs)
+		return
+	}
+
+	render(w, r, templates.PreferencesPage(prefs, r.URL.Query().Get("saved") == "1"))
+}
+
+// UpdatePreferences saves the current admin's preferences. Accepts a form or JSON body;
+// fields that are omitted keep their current value.
+func (h *Handler) UpdatePreferences(w http.ResponseWriter, r *http.Request) {
+	username := h.Session.GetString(r.Context(), "username")
+	if username == "" {
+		writeError(w, r, http.StatusUnauthorized, "Not signed in")
+		return
+	}
+
+	prefs := models.PreferencesFromContext(r.Context())
+	prefs.Username = username
+
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "application/json") {
+		// Decoding over the current values leaves omitted fields untouched
+		if err := json.NewDecoder(r.Body).Decode(&prefs); err != nil {
+			writeError(w, r, http.StatusBadRequest, fmt.Sprintf("Invalid JSON: %v", err))
+			return
+		}
+		prefs.Username = username
+	} else {
+		if err := r.ParseForm(); err != nil {
+			writeError(w, r, http.StatusBadRequest, "Invalid form data")
+			return
+		}
+
+		if r.Form.Has("page_size") {
+			pageSize, err := strconv.Atoi(r.FormValue("page_size"))
+			if err != nil {
+				writeError(w, r, http.StatusBadRequest, "Invalid page size")
+				return
+			}
+			prefs.PageSize = pageSize
+		}
+		if r.Form.Has("default_sort") {
+			prefs.DefaultSort = r.FormValue("default_sort")
+		}
+		if values := r.Form["sidebar_collapsed"]; len(values) > 0 {
+			// The preferences form posts a hidden "false" ahead of the checkbox, so the last value wins
+			value := values[len(values)-1]
+			prefs.SidebarCollapsed = value == "true" || value == "on"
+		}
+		if r.Form.Has("theme") {
+			prefs.Theme = r.FormValue("theme")
+		}
+		if values := r.Form["hide_onboarding"]; len(values) > 0 {
+			value := values[len(values)-1]
+			prefs.HideOnboarding = value == "true" || value == "on"
+		}
+		if r.Form.Has("product_list_mode") {
+			prefs.ProductListMode = r.FormValue("product_list_mode")
+		}
+		if r.Form.Has("digest_frequency") {
+			prefs.DigestFrequency = r.FormValue("digest_frequency")
+		}
+		if r.Form.Has("digest_email") {
+			prefs.DigestEmail = strings.TrimSpace(r.FormValue("digest_email"))
+		}
+		if columns, ok := productColumnsFromForm(r); ok {
+			prefs.ProductColumns = columns
+		}
+	}
+
+	if err := prefs.Validate(); err != nil {
+		writeError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	prefs, err := models.SaveAdminPreferences(h.db(r), prefs)
+	if err != nil {
+		writeFailure(w, r, "saving preferences", err)
+		return
+	}
+
+	// Keep the session theme in step with the saved preference
+	h.Session.Put(r.Context(), "theme", prefs.Theme)
+
+	switch {
+	case wantsJSON(r):
+		writeJSON(w, http.StatusOK, prefs)
+	case r.Header.Get("HX-Request") == "true":
+		// Background saves (e.g. the sidebar toggle) don't swap anything
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		http.Redirect(w, r, "/preferences?saved=1", http.StatusSeeOther)
+	}
+}
+
+// listDefaults returns the page size and product sort to use when the request doesn't specify them
+func listDefaults(r *http.Request) (int, string) {
+	prefs := models.PreferencesFromContext(r.Context())
+	return prefs.PageSize, prefs.DefaultSort
+}
+
+// wantsJSON reports whether the client asked for a JSON response
+func wantsJSON(r *http.Request) bool {
+	return strings.Contains(r.Header.Get("Accept"), "application/json") ||
+		strings.HasPrefix(r.Header.Get("Content-Type"), "application/json")
+}
+
+// writeJSON encodes v as the JSON response body with the given status code
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Printf("Error encoding JSON response: %v", err)
+	}
+}
@@ -0,0 +1,60 @@
+package handlers
+
+import (
+	"log"
+	"net/http"
+
+	"github.com/ngenohkevin/kuiper_admin/internal/models"
+	"github.com/ngenohkevin/kuiper_admin/internal/templates"
+)
+
+// Presence is the heartbeat every open page sends, with the record it shows and whether it's
+// the record's edit form. It answers with the other admins online, and with those on the same
+// record for the page's "also here" notice.
+func (h *Handler) Presence(w http.ResponseWriter, r *http.Request) {
+	username := h.Session.GetString(r.Context(), "username")
+	if username == "" {
+		writeError(w, r, http.StatusUnauthorized, "Not signed in")
+		return
+	}
+	if err := r.ParseForm(); err != nil {
+		writeError(w, r, http.StatusBadRequest, "Invalid form data")
+		return
+	}
+
+	entityType, entityID := r.FormValue("entity_type"), r.FormValue("entity_id")
+	err := models.Heartbeat(h.db(r), models.Presence{
+		Username:   username,
+		EntityType: entityType,
+		EntityID:   entityID,
+		Editing:    r.FormValue("editing") != "",
+	})
+	if err != nil {
+		// Presence is a courtesy; the admin can carry on without it
+		log.Printf("Error recording presence of %s: %v", username, err)
+	}
+
+	presence, err := models.GetPresence(h.db(r))
+	if err != nil {
+		writeFailure(w, r, "getting presence", err)
+		return
+	}
+
+	var others, here []models.Presence
+	for _, p := range presence {
+		if p.Username == username {
+			continue
+		}
+		others = append(others, p)
+		if p.On(entityType, entityID) {
+			here = append(here, p)
+		}
+	}
+
+	if wantsJSON(r) {
+		writeJSON(w, http.StatusOK, map[string]interface{}{"online": others, "here": here})
+		return
+	}
+
+	render(w, r, templates.PresenceList(others, here, entityType != ""))
+}
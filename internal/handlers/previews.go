@@ -0,0 +1,100 @@
+package handlers
+
+import (
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/ngenohkevin/kuiper_admin/internal/models"
+	"github.com/ngenohkevin/kuiper_admin/internal/preview"
+	"github.com/ngenohkevin/kuiper_admin/internal/templates"
+)
+
+// previewLinkLifetimes are the choices for how long a shared preview link works, in hours
+var previewLinkLifetimes = []int{1, 24, 72, 168}
+
+// previewProduct checks a signed preview token and loads the product it was made for,
+// published or not, with the time the token expires
+func (h *Handler) previewProduct(r *http.Request, token string) (models.Product, time.Time, error) {
+	settings, err := models.GetStoreSettings(h.db(r))
+	if err != nil {
+		return models.Product{}, time.Time{}, err
+	}
+	productID, expires, err := preview.Verify(settings.PreviewSecret, token, time.Now())
+	if err != nil {
+		return models.Product{}, time.Time{}, err
+	}
+	product, err := models.GetProductByID(h.db(r), productID)
+	return product, expires, err
+}
+
+// CreatePreviewLink signs a link to the public preview of a product, so someone without an
+// admin account can review it before it is published
+func (h *Handler) CreatePreviewLink(w http.ResponseWriter, r *http.Request) {
+	product, err := models.GetProductByID(h.db(r), chi.URLParam(r, "id"))
+	if err != nil {
+		writeFailure(w, r, "getting product", err)
+		return
+	}
+
+	hours, err := strconv.Atoi(r.FormValue("hours"))
+	if err != nil || !slices.Contains(previewLinkLifetimes, hours) {
+		writeError(w, r, http.StatusBadRequest, "Choose how long the link should work")
+		return
+	}
+
+	settings, err := models.GetStoreSettings(h.db(r))
+	if err != nil {
+		writeFailure(w, r, "creating preview link", err)
+		return
+	}
+	expires := time.Now().Add(time.Duration(hours) * time.Hour)
+	link := absoluteURL(r, "/preview/"+url.PathEscape(preview.Sign(settings.PreviewSecret, product.ID, expires)))
+
+	if wantsJSON(r) {
+		writeJSON(w, http.StatusCreated, map[string]interface{}{"url": link, "expires_at": expires.UTC()})
+		return
+	}
+	render(w, r, templates.PreviewLinkCreated(link, expires))
+}
+
+// PreviewProduct shows a product to whoever holds a signed preview link, without signing in.
+// ?format=json returns the product as the catalog API would.
+func (h *Handler) PreviewProduct(w http.ResponseWriter, r *http.Request) {
+	// The link is the credential, so keep it out of search engines, referrers and caches
+	w.Header().Set("X-Robots-Tag", "noindex, nofollow")
+	w.Header().Set("Referrer-Policy", "no-referrer")
+	w.Header().Set("Cache-Control", "private, no-store")
+
+	asJSON := wantsJSON(r) || r.URL.Query().Get("format") == "json"
+	product, expires, err := h.previewProduct(r, chi.URLParam(r, "token"))
+	if err != nil {
+		if asJSON {
+			writeFailure(w, r, "opening preview", err)
+			return
+		}
+		status, _ := classifyError(err)
+		w.WriteHeader(status)
+		render(w, r, templates.PreviewUnavailable(publicMessage(err, "opening preview")))
+		return
+	}
+
+	if asJSON {
+		fields := make(map[string]bool, len(catalogProductFields))
+		for _, field := range catalogProductFields {
+			fields[field] = true
+		}
+		payload, err := selectFields(product, fields)
+		if err != nil {
+			writeFailure(w, r, "encoding product", err)
+			return
+		}
+		writeJSON(w, http.StatusOK, payload)
+		return
+	}
+
+	render(w, r, templates.ProductPreview(product, r.URL.Path+"?format=json", expires))
+}
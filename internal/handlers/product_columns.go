@@ -0,0 +1,177 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ngenohkevin/kuiper_admin/internal/models"
+	"github.com/ngenohkevin/kuiper_admin/internal/money"
+)
+
+// parseProductCosting reads the sku and cost fields of a parsed form. ok is false when the
+// form has no sku field, so forms without the fields leave them alone. An empty cost isn't known.
+func parseProductCosting(r *http.Request) (sku string, cost *money.Amount, ok bool, err error) {
+	if _, ok := r.Form["sku"]; !ok {
+		return "", nil, false, nil
+	}
+
+	if s := strings.TrimSpace(r.FormValue("cost")); s != "" {
+		amount, err := money.ParseInput(s)
+		if err != nil {
+			return "", nil, true, fmt.Errorf("Invalid cost: %v", err)
+		}
+		cost = &amount
+	}
+	return r.FormValue("sku"), cost, true, nil
+}
+
+// productColumnsFromForm reads the product_columns checkboxes of a parsed form. Forms post an
+// empty value ahead of the checkboxes so that turning every column off still sends the field.
+func productColumnsFromForm(r *http.Request) ([]string, bool) {
+	values, ok := r.Form["product_columns"]
+	if !ok {
+		return nil, false
+	}
+
+	columns := []string{}
+	for _, v := range values {
+		if v != "" {
+			columns = append(columns, v)
+		}
+	}
+	return columns, true
+}
+
+// SetProductColumns saves which optional columns the admin shows on the product list, from the
+// picker on the list itself, and goes back to the list
+func (h *Handler) SetProductColumns(w http.ResponseWriter, r *http.Request) {
+	username := h.Session.GetString(r.Context(), "username")
+	if username == "" {
+		writeError(w, r, http.StatusUnauthorized, "Not signed in")
+		return
+	}
+	if err := r.ParseForm(); err != nil {
+		writeError(w, r, http.StatusBadRequest, "Invalid form data")
+		return
+	}
+
+	prefs := models.PreferencesFromContext(r.Context())
+	prefs.Username = username
+	prefs.ProductColumns, _ = productColumnsFromForm(r)
+
+	prefs, err := models.SaveAdminPreferences(h.db(r), prefs)
+	if err != nil {
+		writeFailure(w, r, "saving product columns", err)
+		return
+	}
+
+	switch {
+	case wantsJSON(r):
+		writeJSON(w, http.StatusOK, prefs)
+	case r.Header.Get("HX-Request") == "true":
+		w.Header().Set("HX-Refresh", "true")
+		w.WriteHeader(http.StatusOK)
+	default:
+		http.Redirect(w, r, h.listURL(r, "/products"), http.StatusSeeOther)
+	}
+}
+
+// productExportURL links to the CSV export of the product list the request is showing: the
+// same search, category, sort and archived filter, from the start
+func productExportURL(r *http.Request) string {
+	query := r.URL.Query()
+	query.Del("page")
+	query.Del("limit")
+	query.Del("cursor")
+	if encoded := query.Encode(); encoded != "" {
+		return "/products/export?" + encoded
+	}
+	return "/products/export"
+}
+
+// ExportProducts downloads every product matching the product list's filters as CSV, with the
+// optional columns the admin shows on the list, or as JSON with format=json. Products are
+// streamed from the database as they're written, so large catalogs don't pile up in memory.
+func (h *Handler) ExportProducts(w http.ResponseWriter, r *http.Request) {
+	filters := productListFilters(r)
+	_, sort := listDefaults(r)
+	if filters.Sort != "" {
+		sort = filters.Sort
+	}
+	export := models.ProductExport{
+		Search:          filters.Search,
+		CategoryID:      filters.Category,
+		Sort:            sort,
+		IncludeArchived: filters.Archived,
+	}
+	if filters.Favorites {
+		export.FavoritesOf = h.Session.GetString(r.Context(), "username")
+	}
+
+	total, err := models.CountProductExport(h.db(r), export)
+	if err != nil {
+		writeFailure(w, r, "exporting products", err)
+		return
+	}
+
+	prefs := models.PreferencesFromContext(r.Context())
+	header := []string{"id", "name", "slug", "price", "stock_count", "is_available"}
+	for _, c := range models.ProductColumns {
+		if prefs.ShowsColumn(c.Key) {
+			header = append(header, productCSVColumns[c.Key]...)
+		}
+	}
+
+	out := newExportStream(w, r, "Products", exportFilename("products"), header, total)
+	out.Close(models.EachProductExport(h.db(r), export, func(p models.Product) error {
+		row := []string{p.ID, csvText(p.Name), p.Slug, p.Price.String(), strconv.Itoa(p.StockCount), strconv.FormatBool(p.IsAvailable)}
+		for _, c := range models.ProductColumns {
+			if prefs.ShowsColumn(c.Key) {
+				row = append(row, productCSVValues(p, c.Key)...)
+			}
+		}
+		return out.Write(row, p)
+	}))
+}
+
+// productCSVColumns names the export columns each optional list column adds
+var productCSVColumns = map[string][]string{
+	models.ProductColumnSKU:      {"sku"},
+	models.ProductColumnMargin:   {"cost", "margin_percent"},
+	models.ProductColumnCategory: {"category"},
+	models.ProductColumnVariants: {"variant_count"},
+	models.ProductColumnUpdated:  {"updated_at"},
+}
+
+// productCSVValues is a product's values for the export columns of an optional list column
+func productCSVValues(p models.Product, column string) []string {
+	switch column {
+	case models.ProductColumnSKU:
+		return []string{csvText(p.SKU)}
+	case models.ProductColumnMargin:
+		cost, margin := "", ""
+		if p.Cost != nil {
+			cost = p.Cost.String()
+		}
+		if pct, ok := p.Margin(); ok {
+			margin = strconv.FormatFloat(pct, 'f', 1, 64)
+		}
+		return []string{cost, margin}
+	case models.ProductColumnCategory:
+		if p.Category != nil {
+			return []string{csvText(p.Category.Name)}
+		}
+		return []string{""}
+	case models.ProductColumnVariants:
+		return []string{strconv.Itoa(p.Summary.Count)}
+	case models.ProductColumnUpdated:
+		if p.UpdatedAt.Valid {
+			return []string{p.UpdatedAt.Time.UTC().Format(time.RFC3339)}
+		}
+		return []string{""}
+	}
+	return nil
+}
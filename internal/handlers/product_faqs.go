@@ -0,0 +1,127 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/ngenohkevin/kuiper_admin/internal/models"
+	"github.com/ngenohkevin/kuiper_admin/internal/templates"
+)
+
+// parseProductFAQ reads an FAQ from a form or, for JSON clients, a JSON body. A new FAQ is
+// published unless the client says otherwise; the form sends published only when it is ticked.
+func parseProductFAQ(r *http.Request) (models.ProductFAQ, error) {
+	faq := models.ProductFAQ{Published: true}
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "application/json") {
+		if err := json.NewDecoder(r.Body).Decode(&faq); err != nil {
+			return models.ProductFAQ{}, fmt.Errorf("Invalid JSON: expected question, answer, sort_order and published")
+		}
+		return faq, nil
+	}
+
+	if err := r.ParseForm(); err != nil {
+		return models.ProductFAQ{}, fmt.Errorf("Invalid form data")
+	}
+	faq.Question = r.FormValue("question")
+	faq.Answer = r.FormValue("answer")
+	faq.Published = r.FormValue("published") != ""
+	if s := r.FormValue("sort_order"); s != "" {
+		order, err := strconv.Atoi(s)
+		if err != nil {
+			return models.ProductFAQ{}, fmt.Errorf("Sort order must be a whole number")
+		}
+		faq.SortOrder = order
+	}
+	return faq, nil
+}
+
+// renderProductFAQs answers an FAQ change with the product's FAQs: as JSON, or as the refreshed
+// section of the product page
+func (h *Handler) renderProductFAQs(w http.ResponseWriter, r *http.Request, productID string, status int) {
+	faqs, err := models.GetProductFAQs(h.db(r), productID, false)
+	if err != nil {
+		writeFailure(w, r, "getting product FAQs", err)
+		return
+	}
+	if wantsJSON(r) {
+		writeJSON(w, status, paginate(w, r, models.SinglePage(faqs)))
+		return
+	}
+	w.WriteHeader(status)
+	render(w, r, templates.ProductFAQs(productID, faqs))
+}
+
+// ProductFAQs shows a product's questions and answers, published or not, for editing
+func (h *Handler) ProductFAQs(w http.ResponseWriter, r *http.Request) {
+	h.renderProductFAQs(w, r, chi.URLParam(r, "id"), http.StatusOK)
+}
+
+// CreateProductFAQ adds a question and answer to a product
+func (h *Handler) CreateProductFAQ(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+
+	faq, err := parseProductFAQ(r)
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+	faq.ProductID = id
+	if _, err := models.CreateProductFAQ(h.db(r), faq); err != nil {
+		writeFailure(w, r, "creating FAQ", err)
+		return
+	}
+
+	h.renderProductFAQs(w, r, id, http.StatusCreated)
+}
+
+// UpdateProductFAQ saves changes to one of a product's FAQs
+func (h *Handler) UpdateProductFAQ(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+
+	faq, err := parseProductFAQ(r)
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+	faq.ID = chi.URLParam(r, "faqID")
+	faq.ProductID = id
+	if _, err := models.UpdateProductFAQ(h.db(r), faq); err != nil {
+		writeFailure(w, r, "updating FAQ", err)
+		return
+	}
+
+	h.renderProductFAQs(w, r, id, http.StatusOK)
+}
+
+// DeleteProductFAQ removes one of a product's FAQs
+func (h *Handler) DeleteProductFAQ(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+
+	if err := models.DeleteProductFAQ(h.db(r), id, chi.URLParam(r, "faqID")); err != nil {
+		writeFailure(w, r, "deleting FAQ", err)
+		return
+	}
+
+	h.renderProductFAQs(w, r, id, http.StatusOK)
+}
+
+// CatalogProductFAQs lists the published questions and answers of a live product, by ID or slug
+func (h *Handler) CatalogProductFAQs(w http.ResponseWriter, r *http.Request) {
+	product, err := models.GetCatalogProduct(h.db(r), chi.URLParam(r, "id"))
+	if err != nil {
+		writeFailure(w, r, "getting product", err)
+		return
+	}
+
+	faqs, err := models.GetProductFAQs(h.db(r), product.ID, true)
+	if err != nil {
+		writeFailure(w, r, "getting product FAQs", err)
+		return
+	}
+
+	writeCatalogJSON(w, r, paginate(w, r, models.SinglePage(faqs)))
+}
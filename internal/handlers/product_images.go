@@ -0,0 +1,310 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"mime/multipart"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/ngenohkevin/kuiper_admin/internal/media"
+	"github.com/ngenohkevin/kuiper_admin/internal/models"
+	"github.com/ngenohkevin/kuiper_admin/internal/templates"
+)
+
+// maxImageUploadSize caps one request's worth of uploaded images
+const maxImageUploadSize = 100 << 20 // 100 MB
+
+// UploadProductImages checks and stores the images uploaded for a product and adds those that
+// pass to its gallery. Each file is judged on its own, so one bad file doesn't stop the rest.
+func (h *Handler) UploadProductImages(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+
+	r.Body = http.MaxBytesReader(w, r.Body, maxImageUploadSize)
+	if err := r.ParseMultipartForm(32 << 20); err != nil {
+		writeError(w, r, http.StatusBadRequest, "The upload is too large or invalid")
+		return
+	}
+	defer r.MultipartForm.RemoveAll()
+
+	files := r.MultipartForm.File["images"]
+	if len(files) == 0 {
+		writeError(w, r, http.StatusBadRequest, "Choose at least one image to upload")
+		return
+	}
+
+	cfg := media.ConfigFromEnv()
+	uploads := make([]templates.ImageUpload, 0, len(files))
+	var imageURLs []string
+	for _, file := range files {
+		upload := templates.ImageUpload{File: file.Filename}
+		image, err := saveUploadedImage(r.Context(), cfg, file)
+		if err != nil {
+			upload.Error = publicMessage(err, "saving image")
+		} else {
+			upload.Image = &image
+			imageURLs = append(imageURLs, image.URL)
+		}
+		uploads = append(uploads, upload)
+	}
+
+	queued := 0
+	if len(imageURLs) > 0 {
+		if err := models.AddProductImages(h.db(r), id, imageURLs); err != nil {
+			writeFailure(w, r, "adding product images", err)
+			return
+		}
+		// The images are in the gallery either way; processing only swaps in better copies
+		if pipeline := media.PipelineConfigFromEnv(); pipeline.Enabled() {
+			n, err := models.QueueImageJobs(h.db(r), id, imageURLs, pipeline.Steps)
+			if err != nil {
+				log.Printf("Error queueing processing for images of product %s: %v", id, err)
+			}
+			queued = n
+		}
+	}
+
+	status := http.StatusOK
+	if len(imageURLs) == 0 {
+		status = http.StatusUnprocessableEntity
+	}
+
+	if wantsJSON(r) {
+		writeJSON(w, status, map[string]interface{}{"uploads": uploads, "queued": queued})
+		return
+	}
+
+	product, err := models.GetProductByID(h.db(r), id)
+	if err != nil {
+		writeFailure(w, r, "getting product", err)
+		return
+	}
+	// HTMX only swaps successful responses, and the per-file report is wanted either way
+	render(w, r, templates.ImageUploadResults(product, uploads, queued > 0))
+}
+
+// saveUploadedImage reads one uploaded file and hands it to the media package to check and store
+func saveUploadedImage(ctx context.Context, cfg media.Config, file *multipart.FileHeader) (media.Image, error) {
+	if err := cfg.CheckSize(file.Size); err != nil {
+		return media.Image{}, err
+	}
+
+	f, err := file.Open()
+	if err != nil {
+		return media.Image{}, err
+	}
+	defer f.Close()
+
+	data, err := io.ReadAll(io.LimitReader(f, cfg.MaxBytes+1))
+	if err != nil {
+		return media.Image{}, err
+	}
+	return media.Save(ctx, cfg, data)
+}
+
+// parseProductForm reads the product form, which is multipart when it carries images to upload
+func parseProductForm(w http.ResponseWriter, r *http.Request) error {
+	if !strings.HasPrefix(r.Header.Get("Content-Type"), "multipart/form-data") {
+		return r.ParseForm()
+	}
+	r.Body = http.MaxBytesReader(w, r.Body, maxImageUploadSize)
+	return r.ParseMultipartForm(32 << 20)
+}
+
+// productFormImageURLs reads the gallery the product form keeps: an image_urls field per image
+// already there, any of which may also hold links pasted one per line
+func productFormImageURLs(r *http.Request) []string {
+	var imageURLs []string
+	for _, field := range r.Form["image_urls"] {
+		for _, url := range strings.Split(field, "\n") {
+			if url = strings.TrimSpace(url); url != "" && !slices.Contains(imageURLs, url) {
+				imageURLs = append(imageURLs, url)
+			}
+		}
+	}
+	return imageURLs
+}
+
+// saveProductFormImages stores the files chosen in the product form's images field and returns
+// their URLs. The form is saved whole or not at all, so when one file is turned down the ones
+// already stored are removed again and the error names the file.
+func saveProductFormImages(r *http.Request) ([]string, error) {
+	if r.MultipartForm == nil {
+		return nil, nil
+	}
+	cfg := media.ConfigFromEnv()
+	var imageURLs []string
+	for _, file := range r.MultipartForm.File["images"] {
+		image, err := saveUploadedImage(r.Context(), cfg, file)
+		if err != nil {
+			removeUploadedImages(r.Context(), imageURLs)
+			return nil, fmt.Errorf("%s: %s", file.Filename, publicMessage(err, "saving image"))
+		}
+		imageURLs = append(imageURLs, image.URL)
+	}
+	return imageURLs, nil
+}
+
+// removedImages lists the images in before that after no longer has
+func removedImages(before, after []string) []string {
+	var removed []string
+	for _, url := range before {
+		if !slices.Contains(after, url) {
+			removed = append(removed, url)
+		}
+	}
+	return removed
+}
+
+// removeUploadedImages deletes images uploaded with a form that then couldn't be saved
+func removeUploadedImages(ctx context.Context, imageURLs []string) {
+	cfg := media.ConfigFromEnv()
+	for _, url := range imageURLs {
+		if err := media.Remove(ctx, cfg, url); err != nil {
+			log.Printf("Error removing unused upload %s: %v", url, err)
+		}
+	}
+}
+
+// queueUploadedImages runs the configured processing pipeline over images just uploaded
+// with the product form
+func (h *Handler) queueUploadedImages(r *http.Request, productID string, imageURLs []string) {
+	if pipeline := media.PipelineConfigFromEnv(); pipeline.Enabled() && len(imageURLs) > 0 {
+		if _, err := models.QueueImageJobs(h.db(r), productID, imageURLs, pipeline.Steps); err != nil {
+			log.Printf("Error queueing processing for images of product %s: %v", productID, err)
+		}
+	}
+}
+
+// imageJobsShown is how many of a product's recent image jobs its page lists
+const imageJobsShown = 10
+
+// ProductImageJobs shows the processing panel under a product's gallery: the steps that can be
+// run and the recent jobs. While jobs are waiting the panel polls itself, and the poll that sees
+// the last one finish refreshes the gallery so the processed images show up.
+func (h *Handler) ProductImageJobs(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+
+	product, err := models.GetProductByID(h.db(r), id)
+	if err != nil {
+		writeFailure(w, r, "getting product", err)
+		return
+	}
+	jobs, err := models.GetImageJobs(h.db(r), id, imageJobsShown)
+	if err != nil {
+		writeFailure(w, r, "getting image jobs", err)
+		return
+	}
+
+	if wantsJSON(r) {
+		writeJSON(w, http.StatusOK, jobs)
+		return
+	}
+	polled := r.URL.Query().Get("poll") != ""
+	render(w, r, templates.ImageProcessing(product, jobs, media.PipelineConfigFromEnv(), polled))
+}
+
+// ProcessProductImages queues processing steps for a product's uploaded images, or for the
+// ones given as url fields. Steps are given as steps fields, run in the order they're sent;
+// blank ones are ignored so the form's "none" choices can be sent as they are.
+func (h *Handler) ProcessProductImages(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+
+	if err := r.ParseForm(); err != nil {
+		writeError(w, r, http.StatusBadRequest, "Invalid form data")
+		return
+	}
+	steps := media.ParseSteps(strings.Join(r.Form["steps"], ","))
+	pipeline := media.PipelineConfigFromEnv()
+	if _, err := pipeline.BuildSteps(steps); err != nil {
+		writeFailure(w, r, "queueing image processing", err)
+		return
+	}
+
+	product, err := models.GetProductByID(h.db(r), id)
+	if err != nil {
+		writeFailure(w, r, "getting product", err)
+		return
+	}
+	// Only uploaded images can be processed; linked images live on someone else's server
+	cfg := media.ConfigFromEnv()
+	var imageURLs []string
+	for _, url := range product.ImageURLs {
+		if media.IsUpload(cfg, url) && (len(r.Form["url"]) == 0 || slices.Contains(r.Form["url"], url)) {
+			imageURLs = append(imageURLs, url)
+		}
+	}
+	if len(imageURLs) == 0 {
+		writeError(w, r, http.StatusUnprocessableEntity, "This product has no uploaded images to process")
+		return
+	}
+
+	queued, err := models.QueueImageJobs(h.db(r), id, imageURLs, steps)
+	if err != nil {
+		writeFailure(w, r, "queueing image processing", err)
+		return
+	}
+
+	if wantsJSON(r) {
+		writeJSON(w, http.StatusAccepted, map[string]int{"queued": queued})
+		return
+	}
+	jobs, err := models.GetImageJobs(h.db(r), id, imageJobsShown)
+	if err != nil {
+		writeFailure(w, r, "getting image jobs", err)
+		return
+	}
+	render(w, r, templates.ImageProcessing(product, jobs, pipeline, false))
+}
+
+// SetProductImageAlt saves the alt text of a product's images. The gallery form posts each
+// image's url and alt in order; JSON clients send [{"url": "...", "alt": "..."}].
+func (h *Handler) SetProductImageAlt(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+
+	var images []models.ProductImage
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "application/json") {
+		if err := json.NewDecoder(r.Body).Decode(&images); err != nil {
+			writeError(w, r, http.StatusBadRequest, "Invalid JSON: expected a list of images with url and alt")
+			return
+		}
+	} else {
+		if err := r.ParseForm(); err != nil {
+			writeError(w, r, http.StatusBadRequest, "Invalid form data")
+			return
+		}
+		urls, alts := r.Form["url"], r.Form["alt"]
+		if len(urls) != len(alts) {
+			writeError(w, r, http.StatusBadRequest, "Each image needs a url and an alt field")
+			return
+		}
+		for i := range urls {
+			images = append(images, models.ProductImage{URL: urls[i], Alt: alts[i]})
+		}
+	}
+
+	alt := make(map[string]string, len(images))
+	for _, image := range images {
+		alt[image.URL] = image.Alt
+	}
+	if err := models.SetProductImageAlt(h.db(r), id, alt); err != nil {
+		writeFailure(w, r, "saving image alt text", err)
+		return
+	}
+
+	if wantsJSON(r) {
+		product, err := models.GetProductByID(h.db(r), id)
+		if err != nil {
+			writeFailure(w, r, "getting product", err)
+			return
+		}
+		writeJSON(w, http.StatusOK, product.Images)
+		return
+	}
+	w.Write([]byte("Saved"))
+}
@@ -1,13 +1,13 @@
 package handlers
 
 import (
-	"fmt"
 	"log"
 	"net/http"
 	"strconv"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/ngenohkevin/kuiper_admin/internal/models"
+	"github.com/ngenohkevin/kuiper_admin/internal/money"
 	"github.com/ngenohkevin/kuiper_admin/internal/templates"
 )
 
@@ -15,13 +15,13 @@ import (
 func (h *Handler) CreateProductVariant(w http.ResponseWriter, r *http.Request) {
 	productID := chi.URLParam(r, "id")
 	if productID == "" {
-		http.Error(w, "Missing product ID", http.StatusBadRequest)
+		writeError(w, r, http.StatusBadRequest, "Missing product ID")
 		return
 	}
 
 	// Parse form
 	if err := r.ParseForm(); err != nil {
-		http.Error(w, "Invalid form data", http.StatusBadRequest)
+		writeError(w, r, http.StatusBadRequest, "Invalid form data")
 		return
 	}
 
@@ -32,14 +32,14 @@ func (h *Handler) CreateProductVariant(w http.ResponseWriter, r *http.Request) {
 
 	// Validate required fields
 	if name == "" || priceStr == "" {
-		http.Error(w, "Name and price are required", http.StatusBadRequest)
+		writeError(w, r, http.StatusBadRequest, "Name and price are required")
 		return
 	}
 
 	// Parse numeric values
-	price, err := strconv.ParseFloat(priceStr, 64)
+	price, err := money.ParseInput(priceStr)
 	if err != nil {
-		http.Error(w, "Invalid price", http.StatusBadRequest)
+		writeError(w, r, http.StatusBadRequest, "Invalid price: "+err.Error())
 		return
 	}
 
@@ -48,7 +48,7 @@ func (h *Handler) CreateProductVariant(w http.ResponseWriter, r *http.Request) {
 	if stockCountStr != "" {
 		stockCount, err = strconv.Atoi(stockCountStr)
 		if err != nil {
-			http.Error(w, "Invalid stock count", http.StatusBadRequest)
+			writeError(w, r, http.StatusBadRequest, "Invalid stock count")
 			return
 		}
 	}
@@ -57,15 +57,15 @@ func (h *Handler) CreateProductVariant(w http.ResponseWriter, r *http.Request) {
 	isAvailable := isAvailableStr == "true"
 
 	// Create the product variant
-	_, err = models.CreateProductVariant(h.DB, productID, name, price, stockCount, isAvailable)
+	_, err = models.CreateProductVariant(h.db(r), productID, name, price, stockCount, isAvailable)
 	if err != nil {
 		log.Printf("Error creating product variant: %v", err)
-		http.Error(w, fmt.Sprintf("Error creating product variant: %v", err), http.StatusInternalServerError)
+		writeFailure(w, r, "creating product variant", err)
 		return
 	}
 
 	// Ensure the product is marked as having variants
-	err = models.UpdateProductHasVariants(h.DB, productID, true)
+	err = models.UpdateProductHasVariants(h.db(r), productID, true)
 	if err != nil {
 		log.Printf("Warning: Error updating product has_variants flag: %v", err)
 		// Continue anyway, don't fail the request if this update fails
@@ -80,31 +80,32 @@ func (h *Handler) EditProductVariantForm(w http.ResponseWriter, r *http.Request)
 	productID := chi.URLParam(r, "id")
 	variantID := chi.URLParam(r, "variantID")
 	if productID == "" || variantID == "" {
-		http.Error(w, "Missing product ID or variant ID", http.StatusBadRequest)
+		writeError(w, r, http.StatusBadRequest, "Missing product ID or variant ID")
 		return
 	}
 
 	// Get the parent product
-	product, err := models.GetProductByID(h.DB, productID)
+	product, err := models.GetProductByID(h.db(r), productID)
 	if err != nil {
-		http.Error(w, fmt.Sprintf("Error getting product: %v", err), http.StatusInternalServerError)
+		writeFailure(w, r, "getting product", err)
 		return
 	}
 
 	// Get the variant
-	variant, err := models.GetProductVariantByID(h.DB, variantID)
+	variant, err := models.GetProductVariantByID(h.db(r), variantID)
 	if err != nil {
-		http.Error(w, fmt.Sprintf("Error getting product variant: %v", err), http.StatusInternalServerError)
+		writeFailure(w, r, "getting product variant", err)
 		return
 	}
 
 	// Check if the variant belongs to the specified product
 	if variant.ProductID != productID {
-		http.Error(w, "Variant does not belong to the specified product", http.StatusBadRequest)
+		writeError(w, r, http.StatusBadRequest, "Variant does not belong to the specified product")
 		return
 	}
 
-	templates.ProductVariantForm(product, &variant, true).Render(r.Context(), w)
+	ctx := withCrumbs(r, append(h.productCrumbs(r, product), templates.Breadcrumb{Label: variant.Name})...)
+	render(w, r.WithContext(ctx), templates.ProductVariantForm(product, &variant, true))
 }
 
 // UpdateProductVariant handles the request to update a product variant
@@ -112,13 +113,13 @@ func (h *Handler) UpdateProductVariant(w http.ResponseWriter, r *http.Request) {
 	productID := chi.URLParam(r, "id")
 	variantID := chi.URLParam(r, "variantID")
 	if productID == "" || variantID == "" {
-		http.Error(w, "Missing product ID or variant ID", http.StatusBadRequest)
+		writeError(w, r, http.StatusBadRequest, "Missing product ID or variant ID")
 		return
 	}
 
 	// Parse form
 	if err := r.ParseForm(); err != nil {
-		http.Error(w, "Invalid form data", http.StatusBadRequest)
+		writeError(w, r, http.StatusBadRequest, "Invalid form data")
 		return
 	}
 
@@ -129,32 +130,52 @@ func (h *Handler) UpdateProductVariant(w http.ResponseWriter, r *http.Request) {
 
 	// Validate required fields
 	if name == "" || priceStr == "" || stockCountStr == "" {
-		http.Error(w, "Name, price, and stock count are required", http.StatusBadRequest)
+		writeError(w, r, http.StatusBadRequest, "Name, price, and stock count are required")
 		return
 	}
 
 	// Parse numeric values
-	price, err := strconv.ParseFloat(priceStr, 64)
+	price, err := money.ParseInput(priceStr)
 	if err != nil {
-		http.Error(w, "Invalid price", http.StatusBadRequest)
+		writeError(w, r, http.StatusBadRequest, "Invalid price: "+err.Error())
 		return
 	}
 
 	stockCount, err := strconv.Atoi(stockCountStr)
 	if err != nil {
-		http.Error(w, "Invalid stock count", http.StatusBadRequest)
+		writeError(w, r, http.StatusBadRequest, "Invalid stock count")
 		return
 	}
 
 	// Handle is_available checkbox
 	isAvailable := isAvailableStr == "true"
 
+	orderOptions, hasOrderOptions, err := parseOrderOptions(r)
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	before, err := models.GetProductVariantByID(h.db(r), variantID)
+	if err != nil {
+		writeFailure(w, r, "getting product variant", err)
+		return
+	}
+
 	// Update the product variant
-	_, err = models.UpdateProductVariant(h.DB, variantID, name, price, stockCount, isAvailable)
+	variant, err := models.UpdateProductVariant(h.db(r), variantID, name, price, stockCount, isAvailable)
 	if err != nil {
-		http.Error(w, fmt.Sprintf("Error updating product variant: %v", err), http.StatusInternalServerError)
+		writeFailure(w, r, "updating product variant", err)
 		return
 	}
+	h.recordVariantEdit(r, before, variant)
+
+	if hasOrderOptions {
+		if err := models.SetVariantOrderOptions(h.db(r), productID, variantID, orderOptions); err != nil {
+			writeFailure(w, r, "saving order options", err)
+			return
+		}
+	}
 
 	// Redirect to the product view
 	http.Redirect(w, r, "/products/"+productID, http.StatusSeeOther)
@@ -165,20 +186,20 @@ func (h *Handler) DeleteProductVariant(w http.ResponseWriter, r *http.Request) {
 	productID := chi.URLParam(r, "id")
 	variantID := chi.URLParam(r, "variantID")
 	if productID == "" || variantID == "" {
-		http.Error(w, "Missing product ID or variant ID", http.StatusBadRequest)
+		writeError(w, r, http.StatusBadRequest, "Missing product ID or variant ID")
 		return
 	}
 
 	// Delete the product variant
-	err := models.DeleteProductVariant(h.DB, variantID)
+	err := models.DeleteProductVariant(h.db(r), variantID)
 	if err != nil {
 		log.Printf("Error deleting product variant: %v", err)
-		http.Error(w, fmt.Sprintf("Error deleting product variant: %v", err), http.StatusInternalServerError)
+		writeFailure(w, r, "deleting product variant", err)
 		return
 	}
 
 	log.Printf("Successfully deleted variant %s", variantID)
 
-	// For HTMX delete requests, just return 200 OK
-	w.WriteHeader(http.StatusOK)
+	// For HTMX delete requests, return 200 OK with an undo toast
+	writeUndoToast(w, r, "Variant deleted", "/products/"+productID+"/variants/"+variantID+"/restore")
 }
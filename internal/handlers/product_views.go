@@ -0,0 +1,53 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/ngenohkevin/kuiper_admin/internal/models"
+	"github.com/ngenohkevin/kuiper_admin/internal/templates"
+)
+
+// productViewTrendDays is how many days of views the product page charts
+const productViewTrendDays = 30
+
+// productViewBatch is a batch of product views reported by the storefront
+type productViewBatch struct {
+	Views []models.ProductView `json:"views"`
+}
+
+// RecordProductViewsAPI lets the storefront report the product pages its shoppers viewed, in
+// batches of up to models.MaxProductViewBatch. Each session counts once per product per
+// PRODUCT_VIEW_WINDOW_MINUTES; the answer says how many of the batch counted.
+func (h *Handler) RecordProductViewsAPI(w http.ResponseWriter, r *http.Request) {
+	var body productViewBatch
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 256<<10)).Decode(&body); err != nil {
+		writeError(w, r, http.StatusBadRequest, "Invalid JSON body: expected views, each with product_id and session_token")
+		return
+	}
+
+	counted, err := models.RecordProductViews(h.db(r), body.Views, models.ProductViewWindow())
+	if err != nil {
+		writeFailure(w, r, "recording product views", err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]int{"received": len(body.Views), "counted": counted})
+}
+
+// ProductViews shows a product's storefront views over the last month, for its page
+func (h *Handler) ProductViews(w http.ResponseWriter, r *http.Request) {
+	trend, err := models.GetProductViewTrend(h.db(r), chi.URLParam(r, "id"), productViewTrendDays)
+	if err != nil {
+		writeFailure(w, r, "getting product views", err)
+		return
+	}
+
+	if wantsJSON(r) {
+		writeJSON(w, http.StatusOK, trend)
+		return
+	}
+
+	render(w, r, templates.ProductViews(trend))
+}
@@ -0,0 +1,307 @@
+package handlers
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/ngenohkevin/kuiper_admin/internal/httperr"
+	"github.com/ngenohkevin/kuiper_admin/internal/models"
+	"github.com/ngenohkevin/kuiper_admin/internal/money"
+)
+
+// maxProductNameLength matches the name column
+const maxProductNameLength = 255
+
+// productInput is the body of POST /api/v1/products and PUT /api/v1/products/{id}. On an update
+// a field left out keeps its value; category_id "" takes the product out of its category and
+// cost null forgets it.
+type productInput struct {
+	Name        *string         `json:"name"`
+	Slug        *string         `json:"slug"` // Made from the name when a new product has none
+	CategoryID  *string         `json:"category_id"`
+	Description *string         `json:"description"`
+	Price       *money.Amount   `json:"price"`
+	StockCount  *int            `json:"stock_count"`
+	ImageURLs   *[]string       `json:"image_urls"`
+	IsAvailable *bool           `json:"is_available"` // True for a new product when left out
+	SKU         *string         `json:"sku"`
+	Cost        json.RawMessage `json:"cost"`
+}
+
+// apply copies the fields the input sets onto p and checks the result, returning the problems
+// by field, nil when there are none, and whether the SKU or cost were set. creating requires
+// the fields a new product can't do without.
+func (in productInput) apply(h *Handler, r *http.Request, p *models.Product, creating bool) (*httperr.Error, bool) {
+	invalid := httperr.New(http.StatusUnprocessableEntity, "The product is invalid")
+	costing := in.SKU != nil || len(in.Cost) > 0
+
+	if in.Name != nil {
+		p.Name = strings.TrimSpace(*in.Name)
+	}
+	if in.Slug != nil {
+		p.Slug = strings.TrimSpace(*in.Slug)
+	}
+	if p.Slug == "" && creating {
+		p.Slug = models.Slugify(p.Name)
+	}
+	if in.Description != nil {
+		p.Description = *in.Description
+	}
+	if in.Price != nil {
+		p.Price = *in.Price
+	}
+	if in.StockCount != nil {
+		p.StockCount = *in.StockCount
+	}
+	if in.ImageURLs != nil {
+		p.ImageURLs = nil
+		for _, u := range *in.ImageURLs {
+			if u = strings.TrimSpace(u); u != "" {
+				p.ImageURLs = append(p.ImageURLs, u)
+			}
+		}
+	}
+	if in.IsAvailable != nil {
+		p.IsAvailable = *in.IsAvailable
+	}
+	if in.SKU != nil {
+		p.SKU = *in.SKU
+	}
+	if len(in.Cost) > 0 {
+		p.Cost = nil
+		if string(in.Cost) != "null" {
+			var cost money.Amount
+			if err := json.Unmarshal(in.Cost, &cost); err != nil {
+				invalid.WithField("cost", "must be an amount or null")
+			} else {
+				p.Cost = &cost
+			}
+		}
+	}
+	if in.CategoryID != nil {
+		p.CategoryID = nil
+		if id := strings.TrimSpace(*in.CategoryID); id != "" {
+			if _, err := models.GetCategoryByID(h.db(r), id); err != nil {
+				invalid.WithField("category_id", "doesn't match a category")
+			}
+			p.CategoryID = &id
+		}
+	}
+
+	if p.Name == "" {
+		invalid.WithField("name", "is required")
+	} else if len(p.Name) > maxProductNameLength {
+		invalid.WithField("name", "must be at most 255 characters")
+	}
+	if p.Slug == "" {
+		invalid.WithField("slug", "is required")
+	} else if in.Slug != nil && p.Slug != models.Slugify(p.Slug) {
+		invalid.WithField("slug", "may only hold lowercase letters, digits and dashes")
+	}
+	if in.Price == nil && creating {
+		invalid.WithField("price", "is required")
+	} else if p.Price < 0 {
+		invalid.WithField("price", "cannot be negative")
+	}
+	if p.StockCount < 0 {
+		invalid.WithField("stock_count", "cannot be negative")
+	}
+	if len(p.SKU) > 100 {
+		invalid.WithField("sku", "must be at most 100 characters")
+	}
+	if p.Cost != nil && *p.Cost < 0 {
+		invalid.WithField("cost", "cannot be negative")
+	}
+
+	if len(invalid.Fields) > 0 {
+		return invalid, costing
+	}
+	return nil, costing
+}
+
+// decodeProductInput reads a product from the JSON body, answering 400 when it isn't JSON
+func decodeProductInput(w http.ResponseWriter, r *http.Request) (productInput, bool) {
+	var in productInput
+	decoder := json.NewDecoder(http.MaxBytesReader(w, r.Body, 256<<10))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&in); err != nil {
+		writeError(w, r, http.StatusBadRequest, "Invalid JSON body: "+err.Error())
+		return in, false
+	}
+	return in, true
+}
+
+// ListProductsAPI lists products as JSON for scripts and the storefront's back office, a page at
+// a time. It takes the product list's filters: q, category, sort, archived=1, page and limit. A
+// search is answered in one page.
+func (h *Handler) ListProductsAPI(w http.ResponseWriter, r *http.Request) {
+	filters := productListFilters(r)
+
+	if filters.Search != "" {
+		products, err := models.SearchProducts(h.db(r), filters.Search, filters.Archived)
+		if err != nil {
+			writeFailure(w, r, "searching products", err)
+			return
+		}
+		writeList(w, r, models.SinglePage(inCategory(products, filters.Category)))
+		return
+	}
+
+	page, _ := strconv.Atoi(r.URL.Query().Get("page"))
+	result, err := models.GetProductsPaginated(h.db(r), page, filters.Limit, filters.Category, "", filters.Sort, "", filters.Archived)
+	if err != nil {
+		writeFailure(w, r, "getting products", err)
+		return
+	}
+	writeList(w, r, *result)
+}
+
+// GetProductAPI returns one product with its variants, costing and category as JSON
+func (h *Handler) GetProductAPI(w http.ResponseWriter, r *http.Request) {
+	product, err := models.GetProductByID(h.db(r), chi.URLParam(r, "id"))
+	if err != nil {
+		writeFailure(w, r, "getting product", err)
+		return
+	}
+	writeJSON(w, http.StatusOK, product)
+}
+
+// CreateProductAPI creates a product from a JSON body and answers 201 with it. Name and price
+// are required; the product has no variants until some are added.
+func (h *Handler) CreateProductAPI(w http.ResponseWriter, r *http.Request) {
+	in, ok := decodeProductInput(w, r)
+	if !ok {
+		return
+	}
+
+	product := models.Product{IsAvailable: true}
+	invalid, costing := in.apply(h, r, &product, true)
+	if invalid != nil {
+		writeHTTPError(w, r, invalid)
+		return
+	}
+
+	created, err := models.CreateProduct(h.db(r), product.CategoryID, product.Name, product.Slug, product.Description,
+		product.Price, product.ImageURLs, product.StockCount, product.IsAvailable, false)
+	if err != nil {
+		h.productAPIFailure(w, r, "creating product", err)
+		return
+	}
+	h.recordActivity(r, models.ActivityProduct, created.ID, models.ActivityCreated, "Created at "+created.Price.Format()+" with "+strconv.Itoa(created.StockCount)+" in stock")
+	h.auditCreate(r, models.ActivityProduct, created.ID, created)
+
+	if costing {
+		if err := models.SetProductCosting(h.db(r), created.ID, product.SKU, product.Cost); err != nil {
+			writeFailure(w, r, "saving SKU and cost", err)
+			return
+		}
+	}
+
+	// Read back so the answer carries the costing and category like GET does
+	product, err = models.GetProductByID(h.db(r), created.ID)
+	if err != nil {
+		writeFailure(w, r, "getting product", err)
+		return
+	}
+	writeJSON(w, http.StatusCreated, product)
+}
+
+// UpdateProductAPI changes the fields a JSON body sets on a product and answers with the
+// product as it now is
+func (h *Handler) UpdateProductAPI(w http.ResponseWriter, r *http.Request) {
+	in, ok := decodeProductInput(w, r)
+	if !ok {
+		return
+	}
+
+	current, err := models.GetProductByID(h.db(r), chi.URLParam(r, "id"))
+	if err != nil {
+		writeFailure(w, r, "getting product", err)
+		return
+	}
+
+	product := current
+	invalid, costing := in.apply(h, r, &product, false)
+	if invalid != nil {
+		writeHTTPError(w, r, invalid)
+		return
+	}
+
+	_, err = models.UpdateProduct(h.db(r), product.ID, product.CategoryID, product.Name, product.Slug, product.Description,
+		product.Price, product.ImageURLs, product.StockCount, product.IsAvailable, product.HasVariants)
+	if err != nil {
+		h.productAPIFailure(w, r, "updating product", err)
+		return
+	}
+	if err := models.QueueOrphanedMedia(h.db(r), removedImages(current.ImageURLs, product.ImageURLs)); err != nil {
+		log.Printf("Error recording images removed from product %s: %v", product.ID, err)
+	}
+	if costing {
+		if err := models.SetProductCosting(h.db(r), product.ID, product.SKU, product.Cost); err != nil {
+			writeFailure(w, r, "saving SKU and cost", err)
+			return
+		}
+	}
+
+	updated, err := models.GetProductByID(h.db(r), product.ID)
+	if err != nil {
+		writeFailure(w, r, "getting product", err)
+		return
+	}
+	h.recordProductEdit(r, current, updated)
+	writeJSON(w, http.StatusOK, updated)
+}
+
+// DeleteProductAPI moves a product to the trash and answers 204. While reviews or other rows
+// still reference it the answer is 409 with them listed, unless dependents=cascade or
+// dependents=nullify says what to do with them.
+func (h *Handler) DeleteProductAPI(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	if _, err := models.GetProductByID(h.db(r), id); err != nil {
+		writeFailure(w, r, "getting product", err)
+		return
+	}
+
+	dependents := r.URL.Query().Get("dependents")
+	if dependents != "" && (dependents == models.DependentsAbort || !models.IsDependentsOption(dependents)) {
+		writeHTTPError(w, r, httperr.New(http.StatusBadRequest, "Unknown dependents option").
+			WithField("dependents", "must be cascade or nullify"))
+		return
+	}
+	if dependents == "" {
+		found, err := models.GetProductDependents(h.db(r), id)
+		if err != nil {
+			writeFailure(w, r, "checking product dependents", err)
+			return
+		}
+		if len(found) > 0 {
+			writeJSON(w, http.StatusConflict, map[string]interface{}{
+				"error":      "product is referenced by " + models.DependentsSummary(found),
+				"dependents": found,
+			})
+			return
+		}
+	}
+
+	if err := models.DeleteProduct(h.db(r), id, dependents); err != nil {
+		writeFailure(w, r, "deleting product", err)
+		return
+	}
+	h.recordActivity(r, models.ActivityProduct, id, models.ActivityDeleted, "Moved to the trash")
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// productAPIFailure answers a failed create or update, naming the slug field when it is taken
+func (h *Handler) productAPIFailure(w http.ResponseWriter, r *http.Request, action string, err error) {
+	if isUniqueViolation(err) {
+		writeHTTPError(w, r, httperr.New(http.StatusConflict, "A product with that slug already exists").
+			WithField("slug", "is already taken"))
+		return
+	}
+	writeFailure(w, r, action, err)
+}
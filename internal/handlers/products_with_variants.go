@@ -1,33 +1,32 @@
 package handlers
 
 import (
-	"fmt"
 	"log"
 	"net/http"
 	"strconv"
 	"strings"
 
 	"github.com/ngenohkevin/kuiper_admin/internal/models"
+	"github.com/ngenohkevin/kuiper_admin/internal/money"
 	"github.com/ngenohkevin/kuiper_admin/internal/templates"
 )
 
 // EnhancedProductForm displays the form for creating a new product with optional variants
 func (h *Handler) EnhancedProductForm(w http.ResponseWriter, r *http.Request) {
 	// Get all categories for dropdown
-	categories, err := models.GetAllCategories(h.DB)
-	if err != nil {
-		http.Error(w, fmt.Sprintf("Error getting categories: %v", err), http.StatusInternalServerError)
+	categories, ok := h.loadCategories(w, r)
+	if !ok {
 		return
 	}
 
-	templates.EnhancedProductForm(nil, categories, false).Render(r.Context(), w)
+	render(w, r, templates.EnhancedProductForm(nil, categories, false))
 }
 
 // CreateProductWithVariants handles the request to create a new product with optional variants
 func (h *Handler) CreateProductWithVariants(w http.ResponseWriter, r *http.Request) {
 	// Parse form data
 	if err := r.ParseForm(); err != nil {
-		http.Error(w, "Invalid form data", http.StatusBadRequest)
+		writeError(w, r, http.StatusBadRequest, "Invalid form data")
 		return
 	}
 
@@ -44,20 +43,20 @@ func (h *Handler) CreateProductWithVariants(w http.ResponseWriter, r *http.Reque
 
 	// Validate required fields
 	if name == "" || slug == "" || priceStr == "" || stockCountStr == "" {
-		http.Error(w, "Name, slug, price, and stock count are required", http.StatusBadRequest)
+		writeError(w, r, http.StatusBadRequest, "Name, slug, price, and stock count are required")
 		return
 	}
 
 	// Parse numeric values
-	price, err := strconv.ParseFloat(priceStr, 64)
+	price, err := money.ParseInput(priceStr)
 	if err != nil {
-		http.Error(w, "Invalid price", http.StatusBadRequest)
+		writeError(w, r, http.StatusBadRequest, "Invalid price: "+err.Error())
 		return
 	}
 
 	stockCount, err := strconv.Atoi(stockCountStr)
 	if err != nil {
-		http.Error(w, "Invalid stock count", http.StatusBadRequest)
+		writeError(w, r, http.StatusBadRequest, "Invalid stock count")
 		return
 	}
 
@@ -86,7 +85,7 @@ func (h *Handler) CreateProductWithVariants(w http.ResponseWriter, r *http.Reque
 
 	// Create the product
 	product, err := models.CreateProduct(
-		h.DB,
+		h.db(r),
 		categoryIDPtr,
 		name,
 		slug,
@@ -99,7 +98,7 @@ func (h *Handler) CreateProductWithVariants(w http.ResponseWriter, r *http.Reque
 	)
 	if err != nil {
 		log.Printf("Error creating product: %v", err)
-		http.Error(w, fmt.Sprintf("Error creating product: %v", err), http.StatusInternalServerError)
+		writeFailure(w, r, "creating product", err)
 		return
 	}
 
@@ -151,9 +150,9 @@ func (h *Handler) CreateProductWithVariants(w http.ResponseWriter, r *http.Reque
 			}
 
 			// Parse numeric values
-			price, err := strconv.ParseFloat(priceStr, 64)
+			price, err := money.ParseInput(priceStr)
 			if err != nil {
-				log.Printf("Skipping variant %s due to invalid price: %s", idx, priceStr)
+				log.Printf("Skipping variant %s due to invalid price: %v", idx, err)
 				continue
 			}
 
@@ -164,7 +163,7 @@ func (h *Handler) CreateProductWithVariants(w http.ResponseWriter, r *http.Reque
 			}
 
 			// Create the variant
-			variant, err := models.CreateProductVariant(h.DB, product.ID, name, price, stockCount, true)
+			variant, err := models.CreateProductVariant(h.db(r), product.ID, name, price, stockCount, true)
 			if err != nil {
 				log.Printf("Error creating product variant %s: %v", name, err)
 				continue
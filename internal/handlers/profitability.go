@@ -0,0 +1,110 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/ngenohkevin/kuiper_admin/internal/models"
+	"github.com/ngenohkevin/kuiper_admin/internal/templates"
+)
+
+// reportDefaultDays is how many days a report covers when no range is given
+const reportDefaultDays = 30
+
+// reportRange reads a report's date range from the from and to query parameters, both days
+// counted in full in the server's time zone. Either left out falls back to the last
+// reportDefaultDays days up to today.
+func reportRange(r *http.Request) (from, to time.Time, err error) {
+	today := time.Now().In(time.Local)
+	today = time.Date(today.Year(), today.Month(), today.Day(), 0, 0, 0, 0, time.Local)
+	to = today.AddDate(0, 0, 1)
+	from = today.AddDate(0, 0, 1-reportDefaultDays)
+
+	if s := r.URL.Query().Get("from"); s != "" {
+		if from, err = time.ParseInLocation("2006-01-02", s, time.Local); err != nil {
+			return from, to, fmt.Errorf("From isn't a valid date")
+		}
+	}
+	if s := r.URL.Query().Get("to"); s != "" {
+		day, err := time.ParseInLocation("2006-01-02", s, time.Local)
+		if err != nil {
+			return from, to, fmt.Errorf("To isn't a valid date")
+		}
+		to = day.AddDate(0, 0, 1)
+	}
+	if !from.Before(to) {
+		return from, to, fmt.Errorf("From must be on or before To")
+	}
+	return from, to, nil
+}
+
+// reportRangeQuery is a report's date range as query parameters, for links to its export
+func reportRangeQuery(from, to time.Time) string {
+	return url.Values{
+		"from": {from.Format("2006-01-02")},
+		"to":   {to.AddDate(0, 0, -1).Format("2006-01-02")},
+	}.Encode()
+}
+
+// Profitability ranks the products sold over a date range by contribution margin: what their
+// orders brought in less what the units cost
+func (h *Handler) Profitability(w http.ResponseWriter, r *http.Request) {
+	from, to, err := reportRange(r)
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	report, err := models.GetProfitability(h.db(r), from, to, "")
+	if err != nil {
+		writeFailure(w, r, "getting profitability", err)
+		return
+	}
+
+	if wantsJSON(r) {
+		writeJSON(w, http.StatusOK, report)
+		return
+	}
+
+	render(w, r, templates.Profitability(report, reportRangeQuery(from, to)))
+}
+
+// ExportProfitability downloads the profitability report for a date range as CSV, or as JSON
+// with format=json
+func (h *Handler) ExportProfitability(w http.ResponseWriter, r *http.Request) {
+	from, to, err := reportRange(r)
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	report, err := models.GetProfitability(h.db(r), from, to, "")
+	if err != nil {
+		writeFailure(w, r, "exporting profitability", err)
+		return
+	}
+
+	header := []string{"product_id", "name", "sku", "orders", "units", "revenue", "cost", "margin", "margin_percent", "uncosted_units"}
+	out := newExportStream(w, r, "Profitability", exportFilename("profitability"), header, int64(len(report.Rows)))
+	for _, row := range report.Rows {
+		margin, marginPercent := "", ""
+		if row.Complete() {
+			margin = row.Margin.String()
+			if pct, ok := row.MarginPercent(); ok {
+				marginPercent = strconv.FormatFloat(pct, 'f', 1, 64)
+			}
+		}
+		record := []string{
+			row.ProductID, csvText(row.ProductName), csvText(row.SKU), strconv.Itoa(row.Orders), strconv.Itoa(row.Units),
+			row.Revenue.String(), row.Cost.String(), margin, marginPercent, strconv.Itoa(row.UncostedUnits),
+		}
+		if err := out.Write(record, row); err != nil {
+			out.Close(err)
+			return
+		}
+	}
+	out.Close(nil)
+}
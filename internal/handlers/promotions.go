@@ -0,0 +1,211 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/ngenohkevin/kuiper_admin/internal/models"
+	"github.com/ngenohkevin/kuiper_admin/internal/templates"
+)
+
+// withSales returns a copy of products with the sale price of any promotion running now. Sale
+// prices only decorate admin pages, so they are left off when they can't be worked out.
+func (h *Handler) withSales(r *http.Request, products []models.Product) []models.Product {
+	promoted := make([]models.Product, len(products))
+	copy(promoted, products)
+	if err := models.ApplyPromotions(h.db(r), promoted, time.Now()); err != nil {
+		log.Printf("Error applying promotions: %v", err)
+		return products
+	}
+	return promoted
+}
+
+// promotionCrumbs is the trail down to a promotion
+func promotionCrumbs(promotion models.Promotion) []templates.Breadcrumb {
+	return []templates.Breadcrumb{
+		{Label: "Promotions", URL: "/promotions"},
+		{Label: promotion.Name, URL: "/promotions/" + promotion.ID + "/edit"},
+	}
+}
+
+// parsePromotion reads a promotion from the form or, for JSON clients, a JSON body with
+// RFC 3339 times. The form's scope picks whether the product or the category applies.
+func parsePromotion(r *http.Request) (models.Promotion, error) {
+	promotion := models.Promotion{Enabled: true}
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "application/json") {
+		if err := json.NewDecoder(r.Body).Decode(&promotion); err != nil {
+			return models.Promotion{}, fmt.Errorf("Invalid JSON: expected the promotion's fields")
+		}
+		return promotion, nil
+	}
+
+	if err := r.ParseForm(); err != nil {
+		return models.Promotion{}, fmt.Errorf("Invalid form data")
+	}
+	promotion.Name = r.FormValue("name")
+	promotion.Enabled = r.FormValue("enabled") != ""
+	if r.FormValue("scope") == "category" {
+		id := r.FormValue("category_id")
+		promotion.CategoryID = &id
+	} else {
+		id := r.FormValue("product_id")
+		promotion.ProductID = &id
+	}
+
+	if s := strings.TrimSpace(r.FormValue("discount_percent")); s != "" {
+		pct, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			return promotion, fmt.Errorf("Discount must be a number such as 15")
+		}
+		promotion.DiscountPercent = pct
+	}
+	for _, t := range []struct {
+		field, value string
+		into         *time.Time
+	}{
+		{"Start", r.FormValue("starts_at"), &promotion.StartsAt},
+		{"End", r.FormValue("ends_at"), &promotion.EndsAt},
+	} {
+		parsed, err := parseDateTimeLocal(t.field, t.value)
+		if err != nil {
+			return promotion, err
+		}
+		if parsed != nil {
+			*t.into = *parsed
+		}
+	}
+	return promotion, nil
+}
+
+// ListPromotions shows every promotion with whether it applies now
+func (h *Handler) ListPromotions(w http.ResponseWriter, r *http.Request) {
+	promotions, err := models.GetPromotions(h.db(r))
+	if err != nil {
+		writeFailure(w, r, "getting promotions", err)
+		return
+	}
+	if wantsJSON(r) {
+		writeList(w, r, models.SinglePage(promotions))
+		return
+	}
+
+	ctx := withCrumbs(r, templates.Breadcrumb{Label: "Promotions"})
+	render(w, r.WithContext(ctx), templates.PromotionList(promotions, time.Now()))
+}
+
+// renderPromotionForm shows the promotion form with the products and categories it can apply to
+func (h *Handler) renderPromotionForm(w http.ResponseWriter, r *http.Request, promotion models.Promotion, errorMsg string, crumbs ...templates.Breadcrumb) {
+	categories, ok := h.loadCategories(w, r)
+	if !ok {
+		return
+	}
+	products, err := models.GetAllProducts(h.db(r))
+	if err != nil {
+		writeFailure(w, r, "getting products", err)
+		return
+	}
+
+	if errorMsg != "" {
+		w.WriteHeader(http.StatusUnprocessableEntity)
+	}
+	render(w, r.WithContext(withCrumbs(r, crumbs...)), templates.PromotionForm(promotion, products, categories, errorMsg))
+}
+
+// NewPromotionForm shows the form for a new promotion, starting now and running a week
+func (h *Handler) NewPromotionForm(w http.ResponseWriter, r *http.Request) {
+	now := time.Now().Truncate(time.Minute)
+	promotion := models.Promotion{Enabled: true, StartsAt: now, EndsAt: now.AddDate(0, 0, 7)}
+	if id := r.URL.Query().Get("product_id"); id != "" {
+		promotion.ProductID = &id
+	}
+	h.renderPromotionForm(w, r, promotion, "", templates.Breadcrumb{Label: "Promotions", URL: "/promotions"}, templates.Breadcrumb{Label: "New"})
+}
+
+// CreatePromotion saves a new promotion, showing the form again with the problem when it is invalid
+func (h *Handler) CreatePromotion(w http.ResponseWriter, r *http.Request) {
+	promotion, err := parsePromotion(r)
+	if err == nil {
+		promotion, err = models.CreatePromotion(h.db(r), promotion)
+	}
+	if err != nil {
+		h.promotionFormFailed(w, r, promotion, "creating promotion", err)
+		return
+	}
+
+	if wantsJSON(r) {
+		writeJSON(w, http.StatusCreated, promotion)
+		return
+	}
+	http.Redirect(w, r, "/promotions", http.StatusSeeOther)
+}
+
+// EditPromotionForm shows the form for changing a promotion
+func (h *Handler) EditPromotionForm(w http.ResponseWriter, r *http.Request) {
+	promotion, err := models.GetPromotionByID(h.db(r), chi.URLParam(r, "id"))
+	if err != nil {
+		writeFailure(w, r, "getting promotion", err)
+		return
+	}
+	if wantsJSON(r) {
+		writeJSON(w, http.StatusOK, promotion)
+		return
+	}
+
+	h.renderPromotionForm(w, r, promotion, "", current(promotionCrumbs(promotion))...)
+}
+
+// UpdatePromotion saves changes to a promotion
+func (h *Handler) UpdatePromotion(w http.ResponseWriter, r *http.Request) {
+	promotion, err := parsePromotion(r)
+	promotion.ID = chi.URLParam(r, "id")
+	if err == nil {
+		promotion, err = models.UpdatePromotion(h.db(r), promotion)
+	}
+	if err != nil {
+		h.promotionFormFailed(w, r, promotion, "updating promotion", err)
+		return
+	}
+
+	if wantsJSON(r) {
+		writeJSON(w, http.StatusOK, promotion)
+		return
+	}
+	http.Redirect(w, r, "/promotions", http.StatusSeeOther)
+}
+
+// promotionFormFailed shows the promotion form again with what the admin entered and why it was
+// turned down. JSON clients and errors that aren't about the input get the usual error response.
+func (h *Handler) promotionFormFailed(w http.ResponseWriter, r *http.Request, promotion models.Promotion, action string, err error) {
+	status, _ := classifyError(err)
+	if wantsJSON(r) || (status != http.StatusBadRequest && status != http.StatusConflict && status != http.StatusUnprocessableEntity) {
+		writeFailure(w, r, action, err)
+		return
+	}
+
+	crumbs := []templates.Breadcrumb{{Label: "Promotions", URL: "/promotions"}, {Label: "New"}}
+	if promotion.ID != "" {
+		crumbs = current(promotionCrumbs(promotion))
+	}
+	h.renderPromotionForm(w, r, promotion, publicMessage(err, action), crumbs...)
+}
+
+// DeletePromotion removes a promotion
+func (h *Handler) DeletePromotion(w http.ResponseWriter, r *http.Request) {
+	if err := models.DeletePromotion(h.db(r), chi.URLParam(r, "id")); err != nil {
+		writeFailure(w, r, "deleting promotion", err)
+		return
+	}
+
+	// For HTMX requests, just return 200 OK so the row is removed
+	if r.Header.Get("HX-Request") == "true" {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+	http.Redirect(w, r, "/promotions", http.StatusSeeOther)
+}
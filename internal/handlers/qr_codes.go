@@ -0,0 +1,78 @@
+package handlers
+
+import (
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/ngenohkevin/kuiper_admin/internal/models"
+	"github.com/skip2/go-qrcode"
+)
+
+// ProductQRCode renders a PNG QR code that deep links to a product.
+// The "target" query parameter selects the encoded URL: "edit" (default)
+// points at the admin edit page, "store" at the storefront product page.
+func (h *Handler) ProductQRCode(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	if id == "" {
+		writeError(w, r, http.StatusBadRequest, "Missing product ID")
+		return
+	}
+
+	product, err := models.GetProductByID(h.db(r), id)
+	if err != nil {
+		writeFailure(w, r, "getting product", err)
+		return
+	}
+
+	var target string
+	switch r.URL.Query().Get("target") {
+	case "", "edit":
+		target = absoluteURL(r, "/products/"+product.ID+"/edit")
+	case "store":
+		target = h.storefrontLinks(r, product).URL
+		if target == "" {
+			writeError(w, r, http.StatusNotFound, "Storefront URL is not configured")
+			return
+		}
+	default:
+		writeError(w, r, http.StatusBadRequest, "Invalid QR target")
+		return
+	}
+
+	// Default to a size that stays scannable when printed on a shelf label
+	size := 256
+	if s := r.URL.Query().Get("size"); s != "" {
+		if parsedSize, err := strconv.Atoi(s); err == nil && parsedSize >= 64 && parsedSize <= 1024 {
+			size = parsedSize
+		}
+	}
+
+	png, err := qrcode.Encode(target, qrcode.Medium, size)
+	if err != nil {
+		log.Printf("Error generating QR code for %s: %v", target, err)
+		writeError(w, r, http.StatusInternalServerError, "Error generating QR code")
+		return
+	}
+
+	w.Header().Set("Content-Type", "image/png")
+	w.Header().Set("Cache-Control", "private, max-age=3600")
+	if _, err := w.Write(png); err != nil {
+		log.Printf("Error writing QR code: %v", err)
+	}
+}
+
+// absoluteURL builds a fully qualified URL for path on the host serving the request,
+// honouring the X-Forwarded-Proto header set by the reverse proxy
+func absoluteURL(r *http.Request, path string) string {
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	if proto := r.Header.Get("X-Forwarded-Proto"); proto != "" {
+		scheme = strings.TrimSpace(strings.Split(proto, ",")[0])
+	}
+	return scheme + "://" + r.Host + path
+}
@@ -0,0 +1,67 @@
+package handlers
+
+import (
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/ngenohkevin/kuiper_admin/internal/models"
+	"github.com/ngenohkevin/kuiper_admin/internal/templates"
+)
+
+// paletteLimit is how many products, and how many categories, the command palette lists for a search
+const paletteLimit = 8
+
+// recordView remembers that the signed-in admin opened a product or category page. It's best
+// effort; a failure is logged and the page shown anyway.
+func (h *Handler) recordView(r *http.Request, entityType, id string) {
+	username := h.Session.GetString(r.Context(), "username")
+	if err := models.RecordView(h.db(r), username, entityType, id); err != nil {
+		log.Printf("Error recording view of %s %s: %v", entityType, id, err)
+	}
+}
+
+// recentlyViewed lists what the signed-in admin opened last, or nothing when that fails
+func (h *Handler) recentlyViewed(r *http.Request) []models.RecentItem {
+	items, err := models.GetRecentlyViewed(h.db(r), h.Session.GetString(r.Context(), "username"))
+	if err != nil {
+		log.Printf("Error getting recently viewed items: %v", err)
+	}
+	return items
+}
+
+// Palette answers the command palette (Ctrl+K): products and categories matching q, or the
+// admin's recently viewed ones before anything is typed
+func (h *Handler) Palette(w http.ResponseWriter, r *http.Request) {
+	query := strings.TrimSpace(r.URL.Query().Get("q"))
+
+	var entries []templates.PaletteEntry
+	if query == "" {
+		for _, item := range h.recentlyViewed(r) {
+			entries = append(entries, templates.PaletteEntry{Label: item.Name, Kind: item.EntityType, URL: item.URL()})
+		}
+	} else {
+		products, err := models.SearchProducts(h.db(r), query, false)
+		if err != nil {
+			writeFailure(w, r, "searching products", err)
+			return
+		}
+		categories, err := models.SearchCategories(h.db(r), query)
+		if err != nil {
+			writeFailure(w, r, "searching categories", err)
+			return
+		}
+		for _, p := range products[:min(len(products), paletteLimit)] {
+			entries = append(entries, templates.PaletteEntry{Label: p.Name, Kind: models.ActivityProduct, URL: "/products/" + p.ID})
+		}
+		for _, c := range categories[:min(len(categories), paletteLimit)] {
+			entries = append(entries, templates.PaletteEntry{Label: c.Name, Kind: models.ActivityCategory, URL: "/categories/" + c.ID})
+		}
+	}
+
+	if wantsJSON(r) {
+		writeJSON(w, http.StatusOK, entries)
+		return
+	}
+	render(w, r, templates.PaletteResults(query, entries))
+}
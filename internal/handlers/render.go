@@ -0,0 +1,58 @@
+package handlers
+
+import (
+	"bytes"
+	"expvar"
+	"log"
+	"net/http"
+
+	"github.com/a-h/templ"
+	"github.com/go-chi/chi/v5"
+)
+
+// renderFailures counts the pages and fragments that failed to render, by route, alongside the
+// runtime counters at /debug/vars
+var renderFailures = expvar.NewMap("template_render_failures")
+
+// fallbackPage is sent when a page fails to render. It doesn't use the layout, which may be
+// what failed.
+const fallbackPage = `<!DOCTYPE html>
+<html lang="en" class="dark">
+<head><meta charset="utf-8"><title>Something went wrong</title></head>
+<body style="font-family: system-ui, sans-serif; background: #111827; color: #e5e7eb; padding: 4rem 2rem; text-align: center">
+<h1 style="font-size: 1.5rem">This page couldn't be shown</h1>
+<p>Something went wrong putting it together. Please try again, or <a href="/" style="color: #a78bfa">go to the dashboard</a>.</p>
+</body>
+</html>`
+
+// render writes a page or fragment with the request's context. It's rendered into a buffer
+// first, so a template that fails partway never leaves a blank or half-written page: the
+// failure is logged and counted, and an error toast (for HTMX) or a plain error page is sent
+// instead. A status set before calling render is kept.
+func render(w http.ResponseWriter, r *http.Request, c templ.Component) {
+	var buf bytes.Buffer
+	if err := c.Render(r.Context(), &buf); err != nil {
+		route := r.URL.Path
+		if rc := chi.RouteContext(r.Context()); rc != nil && rc.RoutePattern() != "" {
+			route = rc.RoutePattern()
+		}
+		renderFailures.Add(r.Method+" "+route, 1)
+		log.Printf("Error rendering %s %s: %v", r.Method, r.URL.Path, err)
+
+		if r.Header.Get("HX-Request") == "true" || isAPIRequest(r) {
+			writeError(w, r, http.StatusInternalServerError, "This part of the page couldn't be shown. Please try again.")
+			return
+		}
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Write([]byte(fallbackPage))
+		return
+	}
+
+	if w.Header().Get("Content-Type") == "" {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	}
+	if _, err := buf.WriteTo(w); err != nil {
+		log.Printf("Error writing %s %s: %v", r.Method, r.URL.Path, err)
+	}
+}
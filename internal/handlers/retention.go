@@ -0,0 +1,136 @@
+package handlers
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/ngenohkevin/kuiper_admin/internal/jobs"
+	"github.com/ngenohkevin/kuiper_admin/internal/models"
+	"github.com/ngenohkevin/kuiper_admin/internal/templates"
+)
+
+// RetentionSettings shows the retention policies with a dry run of each: how much of the data
+// the next run would remove, as things stand now
+func (h *Handler) RetentionSettings(w http.ResponseWriter, r *http.Request) {
+	h.renderRetentionSettings(w, r, "")
+}
+
+// renderRetentionSettings shows the data retention page, with formError above the form when the
+// last change was rejected
+func (h *Handler) renderRetentionSettings(w http.ResponseWriter, r *http.Request, formError string) {
+	policies, err := models.GetRetentionPolicies(h.db(r))
+	if err != nil {
+		writeFailure(w, r, "getting retention policies", err)
+		return
+	}
+
+	previews := make([]models.RetentionPreview, len(policies))
+	for i, policy := range policies {
+		if previews[i], err = models.PreviewRetention(h.db(r), policy); err != nil {
+			writeFailure(w, r, "previewing retention", err)
+			return
+		}
+	}
+
+	schedule, _ := jobs.FindSchedule(jobs.RetentionJob)
+
+	if wantsJSON(r) {
+		writeJSON(w, http.StatusOK, map[string]interface{}{"policies": previews, "next_run": schedule.NextRun()})
+		return
+	}
+
+	if formError != "" {
+		w.WriteHeader(http.StatusUnprocessableEntity)
+	}
+	render(w, r, templates.RetentionSettings(previews, schedule.NextRun(), r.URL.Query().Get("started"), formError))
+}
+
+// SaveRetentionPolicies handles the request to change how long each kind of data is kept, from
+// the days_<rule> fields of the form, an empty one keeping everything. Rules without a field
+// are left alone.
+func (h *Handler) SaveRetentionPolicies(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		writeError(w, r, http.StatusBadRequest, "Invalid form data")
+		return
+	}
+
+	days := map[string]int{}
+	var err error
+	for field := range r.Form {
+		rule, ok := strings.CutPrefix(field, "days_")
+		if !ok {
+			continue
+		}
+		days[rule] = 0
+		if s := strings.TrimSpace(r.Form.Get(field)); s != "" {
+			if days[rule], err = strconv.Atoi(s); err != nil {
+				err = fmt.Errorf("days to keep must be whole numbers")
+				break
+			}
+		}
+	}
+	if err == nil {
+		err = models.SetRetentionDays(h.db(r), days, h.Session.GetString(r.Context(), "username"))
+	}
+	if err != nil {
+		if wantsJSON(r) {
+			writeFailure(w, r, "saving retention policies", err)
+			return
+		}
+		h.renderRetentionSettings(w, r, publicMessage(err, "saving retention policies"))
+		return
+	}
+
+	if wantsJSON(r) {
+		h.renderRetentionSettings(w, r, "")
+		return
+	}
+	http.Redirect(w, r, "/settings/retention", http.StatusSeeOther)
+}
+
+// ApplyRetentionPolicy applies one retention policy in the background instead of waiting for
+// the next scheduled run
+func (h *Handler) ApplyRetentionPolicy(w http.ResponseWriter, r *http.Request) {
+	policies, err := models.GetRetentionPolicies(h.db(r))
+	if err != nil {
+		writeFailure(w, r, "getting retention policies", err)
+		return
+	}
+
+	rule := chi.URLParam(r, "rule")
+	for _, policy := range policies {
+		if policy.Rule != rule {
+			continue
+		}
+		if !policy.Enabled() {
+			writeError(w, r, http.StatusBadRequest, "No retention period is set for "+strings.ToLower(policy.Label))
+			return
+		}
+
+		// A backlog of years can outlast the request timeout, so the run is detached and recorded
+		// against the policy like scheduled ones
+		actor := h.Session.GetString(r.Context(), "username")
+		db := h.detachedDB(r)
+		go func() {
+			changed, err := models.ApplyRetention(db, policy)
+			if err != nil {
+				log.Printf("Manual %s retention run by %s failed: %v", policy.Rule, actor, err)
+				return
+			}
+			log.Printf("Manual %s retention run by %s removed or anonymized %d rows", policy.Rule, actor, changed)
+		}()
+
+		if wantsJSON(r) {
+			writeJSON(w, http.StatusAccepted, map[string]string{"status": "started", "rule": policy.Rule})
+			return
+		}
+		http.Redirect(w, r, "/settings/retention?started="+policy.Rule, http.StatusSeeOther)
+		return
+	}
+
+	writeError(w, r, http.StatusNotFound, "Unknown retention rule")
+}
@@ -0,0 +1,94 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/ngenohkevin/kuiper_admin/internal/httperr"
+	custommiddleware "github.com/ngenohkevin/kuiper_admin/internal/middleware"
+	"github.com/ngenohkevin/kuiper_admin/internal/models"
+)
+
+// reviewSubmission is the body of POST /api/v1/reviews
+type reviewSubmission struct {
+	ProductID    string `json:"product_id"`
+	SessionToken string `json:"session_token"` // The shopper's storefront session
+	Rating       int    `json:"rating"`
+	Comment      string `json:"comment"`
+	ReviewerName string `json:"reviewer_name"`
+}
+
+// SubmitReviewAPI lets the storefront submit a shopper's review. It is created pending and
+// only shows once approved from the moderation queue.
+func (h *Handler) SubmitReviewAPI(w http.ResponseWriter, r *http.Request) {
+	var body reviewSubmission
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 64<<10)).Decode(&body); err != nil {
+		writeError(w, r, http.StatusBadRequest, "Invalid JSON body")
+		return
+	}
+
+	body.Comment = strings.TrimSpace(body.Comment)
+	invalid := httperr.New(http.StatusUnprocessableEntity, "The review is invalid")
+	if body.ProductID == "" {
+		invalid.WithField("product_id", "is required")
+	}
+	if body.SessionToken == "" {
+		invalid.WithField("session_token", "is required")
+	}
+	if body.Rating < 1 || body.Rating > 5 {
+		invalid.WithField("rating", "must be between 1 and 5")
+	}
+	if len(body.Comment) > 5000 {
+		invalid.WithField("comment", "must be at most 5000 characters")
+	}
+	if len(invalid.Fields) > 0 {
+		writeHTTPError(w, r, invalid)
+		return
+	}
+
+	var tokenID string
+	if token, ok := custommiddleware.APITokenFromContext(r.Context()); ok {
+		tokenID = token.ID
+	}
+
+	review, err := models.SubmitReview(h.db(r), body.ProductID, body.SessionToken, body.Rating,
+		body.Comment, strings.TrimSpace(body.ReviewerName), tokenID)
+	if err != nil {
+		writeFailure(w, r, "submitting review", err)
+		return
+	}
+	h.recordActivity(r, models.ActivityReview, review.ID, models.ActivityCreated, "Submitted from the storefront")
+
+	writeJSON(w, http.StatusCreated, review)
+}
+
+// ModerateReview approves or rejects a review from the moderation queue
+func (h *Handler) ModerateReview(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	if id == "" {
+		writeError(w, r, http.StatusBadRequest, "Missing review ID")
+		return
+	}
+
+	// Parse form
+	if err := r.ParseForm(); err != nil {
+		writeError(w, r, http.StatusBadRequest, "Invalid form data")
+		return
+	}
+
+	actor := h.Session.GetString(r.Context(), "username")
+	if err := models.ModerateReview(h.db(r), id, r.FormValue("status"), actor); err != nil {
+		writeFailure(w, r, "moderating review", err)
+		return
+	}
+	h.recordActivity(r, models.ActivityReview, id, models.ActivityModerated, "Marked "+r.FormValue("status"))
+
+	if r.Header.Get("HX-Request") == "true" {
+		w.Header().Set("HX-Refresh", "true")
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+	http.Redirect(w, r, "/reviews?status="+models.ReviewPending, http.StatusSeeOther)
+}
@@ -0,0 +1,143 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/ngenohkevin/kuiper_admin/internal/httperr"
+	"github.com/ngenohkevin/kuiper_admin/internal/models"
+	"github.com/ngenohkevin/kuiper_admin/internal/templates"
+)
+
+// reviewReportSubmission is the body of POST /api/v1/reviews/{id}/reports
+type reviewReportSubmission struct {
+	SessionToken string `json:"session_token"` // The reporting shopper's storefront session
+	Reason       string `json:"reason"`
+	Note         string `json:"note"`
+}
+
+// ReportReviewAPI lets the storefront report a review on behalf of a shopper. It answers 201
+// with the report, or 200 with the shopper's earlier report of the same review.
+func (h *Handler) ReportReviewAPI(w http.ResponseWriter, r *http.Request) {
+	var body reviewReportSubmission
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 16<<10)).Decode(&body); err != nil {
+		writeError(w, r, http.StatusBadRequest, "Invalid JSON body")
+		return
+	}
+
+	invalid := httperr.New(http.StatusUnprocessableEntity, "The report is invalid")
+	if body.SessionToken == "" {
+		invalid.WithField("session_token", "is required")
+	}
+	if !slices.Contains(models.ReviewReportReasons, body.Reason) {
+		invalid.WithField("reason", "must be one of "+strings.Join(models.ReviewReportReasons, ", "))
+	}
+	if len(strings.TrimSpace(body.Note)) > 1000 {
+		invalid.WithField("note", "must be at most 1000 characters")
+	}
+	if len(invalid.Fields) > 0 {
+		writeHTTPError(w, r, invalid)
+		return
+	}
+
+	report, created, err := models.ReportReview(h.db(r), chi.URLParam(r, "id"), body.SessionToken, body.Reason, body.Note)
+	if err != nil {
+		writeFailure(w, r, "reporting review", err)
+		return
+	}
+
+	status := http.StatusOK
+	if created {
+		status = http.StatusCreated
+	}
+	writeJSON(w, status, report)
+}
+
+// ReviewReports shows the reviews shoppers have reported, the longest waiting first, with how
+// each stands against REVIEW_REPORT_SLA_HOURS
+func (h *Handler) ReviewReports(w http.ResponseWriter, r *http.Request) {
+	queue, err := models.GetReviewReportQueue(h.db(r), models.ReviewReportSLA())
+	if err != nil {
+		writeFailure(w, r, "getting review reports", err)
+		return
+	}
+
+	if wantsJSON(r) {
+		writeJSON(w, http.StatusOK, queue)
+		return
+	}
+
+	render(w, r, templates.ReviewReports(queue))
+}
+
+// ResolveReviewReports deals with every open report of a review: dismissing them, hiding the
+// review, or hiding it and banning the session that wrote it
+func (h *Handler) ResolveReviewReports(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	if id == "" {
+		writeError(w, r, http.StatusBadRequest, "Missing review ID")
+		return
+	}
+
+	// Parse form
+	if err := r.ParseForm(); err != nil {
+		writeError(w, r, http.StatusBadRequest, "Invalid form data")
+		return
+	}
+
+	resolution := r.FormValue("resolution")
+	resolved, err := models.ResolveReviewReports(h.db(r), id, resolution, h.Session.GetString(r.Context(), "username"))
+	if err != nil {
+		writeFailure(w, r, "resolving review reports", err)
+		return
+	}
+
+	reports := strconv.Itoa(resolved) + " report"
+	if resolved != 1 {
+		reports += "s"
+	}
+	switch resolution {
+	case models.ReportDismissed:
+		h.recordActivity(r, models.ActivityReview, id, models.ActivityModerated, "Dismissed "+reports)
+	case models.ReportHidden:
+		h.recordActivity(r, models.ActivityReview, id, models.ActivityModerated, "Hidden after "+reports)
+	case models.ReportBanned:
+		h.recordActivity(r, models.ActivityReview, id, models.ActivityModerated, "Hidden and its session banned after "+reports)
+	}
+
+	if wantsJSON(r) {
+		writeJSON(w, http.StatusOK, map[string]int{"resolved": resolved})
+		return
+	}
+	if r.Header.Get("HX-Request") == "true" {
+		w.Header().Set("HX-Refresh", "true")
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+	http.Redirect(w, r, "/reviews/reports", http.StatusSeeOther)
+}
+
+// UnbanSession lets a session banned from the report queue review and report again
+func (h *Handler) UnbanSession(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	if id == "" {
+		writeError(w, r, http.StatusBadRequest, "Missing session ID")
+		return
+	}
+
+	if err := models.UnbanSession(h.db(r), id); err != nil {
+		writeFailure(w, r, "unbanning session", err)
+		return
+	}
+
+	if r.Header.Get("HX-Request") == "true" {
+		w.Header().Set("HX-Refresh", "true")
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+	http.Redirect(w, r, "/reviews/reports", http.StatusSeeOther)
+}
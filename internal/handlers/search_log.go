@@ -0,0 +1,85 @@
+package handlers
+
+import (
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ngenohkevin/kuiper_admin/internal/models"
+	"github.com/ngenohkevin/kuiper_admin/internal/templates"
+)
+
+// searchTypingWindow is how soon after an admin's last product search a search that extends or
+// trims it counts as the same search still being typed
+const searchTypingWindow = 10 * time.Second
+
+// searchReportPeriods are the periods, in days, the search report can cover
+var searchReportPeriods = []int{7, 30, 90}
+
+// logAdminSearch logs a product search made on the product list and returns its ID, for the
+// result links to report which one was opened. The list searches as the admin types, so a
+// search that extends or trims the previous one within searchTypingWindow replaces it in the
+// log. Logging is best effort; a failure is logged and the ID left empty.
+func (h *Handler) logAdminSearch(r *http.Request, term string, results int) string {
+	ctx := r.Context()
+	normalized := strings.Join(strings.Fields(strings.ToLower(term)), " ")
+	lastID := h.Session.GetString(ctx, "search_log_id")
+	lastTerm := h.Session.GetString(ctx, "search_log_term")
+
+	id := ""
+	if lastID != "" && time.Since(h.Session.GetTime(ctx, "search_log_at")) < searchTypingWindow &&
+		(strings.HasPrefix(normalized, lastTerm) || strings.HasPrefix(lastTerm, normalized)) {
+		replaced, err := models.ReplaceLoggedSearch(h.db(r), lastID, term, results)
+		if err != nil {
+			log.Printf("Error logging search %q: %v", term, err)
+			return ""
+		}
+		if replaced {
+			id = lastID
+		}
+	}
+	if id == "" {
+		var err error
+		if id, err = models.LogSearch(h.db(r), models.SearchSourceAdmin, term, results, ""); err != nil {
+			log.Printf("Error logging search %q: %v", term, err)
+			return ""
+		}
+	}
+
+	h.Session.Put(ctx, "search_log_id", id)
+	h.Session.Put(ctx, "search_log_term", normalized)
+	h.Session.Put(ctx, "search_log_at", time.Now())
+	return id
+}
+
+// SearchReport shows the most searched terms and the searches that found nothing, from the
+// admin, the storefront or both, over the last 7, 30 or 90 days
+func (h *Handler) SearchReport(w http.ResponseWriter, r *http.Request) {
+	days := searchReportPeriods[1]
+	if d, err := strconv.Atoi(r.URL.Query().Get("days")); err == nil {
+		for _, period := range searchReportPeriods {
+			if d == period {
+				days = d
+			}
+		}
+	}
+	source := r.URL.Query().Get("source")
+	if source != models.SearchSourceAdmin && source != models.SearchSourceStorefront {
+		source = ""
+	}
+
+	report, err := models.GetSearchReport(h.db(r), time.Now().AddDate(0, 0, -days), source)
+	if err != nil {
+		writeFailure(w, r, "getting search report", err)
+		return
+	}
+
+	if wantsJSON(r) {
+		writeJSON(w, http.StatusOK, report)
+		return
+	}
+
+	render(w, r, templates.SearchReport(report, days, searchReportPeriods))
+}
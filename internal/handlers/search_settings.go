@@ -0,0 +1,109 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/ngenohkevin/kuiper_admin/internal/models"
+	"github.com/ngenohkevin/kuiper_admin/internal/templates"
+)
+
+// SearchSettings shows the synonyms and stop words applied to product searches. With q set it
+// also shows how a search for q is matched, to check the tuning, and terms fills in the synonym
+// form, as linked from the search report.
+func (h *Handler) SearchSettings(w http.ResponseWriter, r *http.Request) {
+	h.renderSearchSettings(w, r, "")
+}
+
+// renderSearchSettings shows the search tuning page, with formError above the forms when the
+// last change was rejected
+func (h *Handler) renderSearchSettings(w http.ResponseWriter, r *http.Request, formError string) {
+	synonyms, err := models.GetSearchSynonyms(h.db(r))
+	if err != nil {
+		writeFailure(w, r, "getting search synonyms", err)
+		return
+	}
+	stopWords, err := models.GetSearchStopWords(h.db(r))
+	if err != nil {
+		writeFailure(w, r, "getting stop words", err)
+		return
+	}
+
+	query := r.URL.Query().Get("q")
+	var terms [][]string
+	if query != "" {
+		if terms, err = models.ExplainSearch(h.db(r), query); err != nil {
+			writeFailure(w, r, "explaining search", err)
+			return
+		}
+	}
+
+	if wantsJSON(r) {
+		writeJSON(w, http.StatusOK, map[string]interface{}{"synonyms": synonyms, "stop_words": stopWords, "terms": terms})
+		return
+	}
+
+	if formError != "" {
+		w.WriteHeader(http.StatusUnprocessableEntity)
+	}
+	render(w, r, templates.SearchSettings(synonyms, stopWords, query, terms, r.FormValue("terms"), formError))
+}
+
+// CreateSearchSynonym handles the request to add a group of comma-separated synonyms
+func (h *Handler) CreateSearchSynonym(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		writeError(w, r, http.StatusBadRequest, "Invalid form data")
+		return
+	}
+
+	synonym, err := models.CreateSearchSynonym(h.db(r), r.FormValue("terms"))
+	if err != nil {
+		if wantsJSON(r) {
+			writeFailure(w, r, "creating search synonym", err)
+			return
+		}
+		h.renderSearchSettings(w, r, publicMessage(err, "creating search synonym"))
+		return
+	}
+
+	if wantsJSON(r) {
+		writeJSON(w, http.StatusCreated, synonym)
+		return
+	}
+	http.Redirect(w, r, "/settings/search", http.StatusSeeOther)
+}
+
+// DeleteSearchSynonym handles the request to remove a synonym group
+func (h *Handler) DeleteSearchSynonym(w http.ResponseWriter, r *http.Request) {
+	if err := models.DeleteSearchSynonym(h.db(r), chi.URLParam(r, "id")); err != nil {
+		writeFailure(w, r, "deleting search synonym", err)
+		return
+	}
+
+	// For HTMX requests, just return 200 OK so the row is removed
+	w.WriteHeader(http.StatusOK)
+}
+
+// SaveSearchStopWords handles the request to replace the stop words
+func (h *Handler) SaveSearchStopWords(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		writeError(w, r, http.StatusBadRequest, "Invalid form data")
+		return
+	}
+
+	words, err := models.SetSearchStopWords(h.db(r), r.FormValue("stop_words"))
+	if err != nil {
+		if wantsJSON(r) {
+			writeFailure(w, r, "saving stop words", err)
+			return
+		}
+		h.renderSearchSettings(w, r, publicMessage(err, "saving stop words"))
+		return
+	}
+
+	if wantsJSON(r) {
+		writeJSON(w, http.StatusOK, map[string]interface{}{"stop_words": words})
+		return
+	}
+	http.Redirect(w, r, "/settings/search", http.StatusSeeOther)
+}
@@ -0,0 +1,269 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/ngenohkevin/kuiper_admin/internal/models"
+	"github.com/ngenohkevin/kuiper_admin/internal/money"
+	"github.com/ngenohkevin/kuiper_admin/internal/templates"
+)
+
+// segmentPreviewSize is how many members the segment page lists; the export has them all
+const segmentPreviewSize = 50
+
+// segmentCSVHeader names the columns of a segment export
+var segmentCSVHeader = []string{
+	"session_id", "reviewer_name", "first_seen_at", "last_seen_at", "reviews", "last_reviewed_at",
+	"orders", "spent", "last_ordered_at",
+}
+
+// segmentCrumbs is the trail down to a segment
+func segmentCrumbs(segment models.Segment) []templates.Breadcrumb {
+	return []templates.Breadcrumb{
+		{Label: "Segments", URL: "/segments"},
+		{Label: segment.Name, URL: "/segments/" + segment.ID},
+	}
+}
+
+// parseSegment reads a segment from the form or, for JSON clients, a JSON body. Rules left empty
+// on the form don't apply.
+func parseSegment(r *http.Request) (models.Segment, error) {
+	var segment models.Segment
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "application/json") {
+		if err := json.NewDecoder(r.Body).Decode(&segment); err != nil {
+			return models.Segment{}, fmt.Errorf("Invalid JSON: expected name, description and rules")
+		}
+		return segment, nil
+	}
+
+	if err := r.ParseForm(); err != nil {
+		return models.Segment{}, fmt.Errorf("Invalid form data")
+	}
+	segment.Name = r.FormValue("name")
+	segment.Description = r.FormValue("description")
+
+	for _, field := range []struct {
+		name, label string
+		into        *int
+	}{
+		{"seen_within_days", "Seen within", &segment.Rules.SeenWithinDays},
+		{"reviewed_within_days", "Reviewed within", &segment.Rules.ReviewedWithinDays},
+		{"min_reviews", "Minimum reviews", &segment.Rules.MinReviews},
+		{"ordered_within_days", "Ordered within", &segment.Rules.OrderedWithinDays},
+		{"min_orders", "Minimum orders", &segment.Rules.MinOrders},
+	} {
+		value := strings.TrimSpace(r.FormValue(field.name))
+		if value == "" {
+			continue
+		}
+		n, err := strconv.Atoi(value)
+		if err != nil {
+			return segment, fmt.Errorf("%s must be a whole number", field.label)
+		}
+		*field.into = n
+	}
+	if value := strings.TrimSpace(r.FormValue("min_spent")); value != "" {
+		spent, err := money.ParseInput(value)
+		if err != nil {
+			return segment, fmt.Errorf("Minimum spent must be an amount such as 5000 or 49.99")
+		}
+		segment.Rules.MinSpent = spent
+	}
+	return segment, nil
+}
+
+// ListSegments shows every segment with how many shoppers are in it
+func (h *Handler) ListSegments(w http.ResponseWriter, r *http.Request) {
+	segments, err := models.GetSegments(h.db(r))
+	if err != nil {
+		writeFailure(w, r, "getting segments", err)
+		return
+	}
+	if wantsJSON(r) {
+		writeList(w, r, models.SinglePage(segments))
+		return
+	}
+
+	ctx := withCrumbs(r, templates.Breadcrumb{Label: "Segments"})
+	render(w, r.WithContext(ctx), templates.SegmentList(segments))
+}
+
+// NewSegmentForm shows the form for a new segment
+func (h *Handler) NewSegmentForm(w http.ResponseWriter, r *http.Request) {
+	crumbs := []templates.Breadcrumb{{Label: "Segments", URL: "/segments"}, {Label: "New"}}
+	render(w, r.WithContext(withCrumbs(r, crumbs...)), templates.SegmentForm(models.Segment{}, ""))
+}
+
+// CreateSegment saves a new segment and opens it, so its members can be checked
+func (h *Handler) CreateSegment(w http.ResponseWriter, r *http.Request) {
+	segment, err := parseSegment(r)
+	if err == nil {
+		segment, err = models.CreateSegment(h.db(r), segment, h.Session.GetString(r.Context(), "username"))
+	}
+	if err != nil {
+		segmentFormFailed(w, r, segment, "creating segment", err)
+		return
+	}
+
+	if wantsJSON(r) {
+		writeJSON(w, http.StatusCreated, segment)
+		return
+	}
+	http.Redirect(w, r, "/segments/"+segment.ID, http.StatusSeeOther)
+}
+
+// Segment shows a segment's rules and its first members
+func (h *Handler) Segment(w http.ResponseWriter, r *http.Request) {
+	segment, err := models.GetSegmentByID(h.db(r), chi.URLParam(r, "id"))
+	if err != nil {
+		writeFailure(w, r, "getting segment", err)
+		return
+	}
+	if wantsJSON(r) {
+		writeJSON(w, http.StatusOK, segment)
+		return
+	}
+
+	members, err := models.GetSegmentMembers(h.db(r), segment, models.ListQuery{Page: 1, PageSize: segmentPreviewSize})
+	if err != nil {
+		writeFailure(w, r, "getting segment members", err)
+		return
+	}
+
+	ctx := withCrumbs(r, current(segmentCrumbs(segment))...)
+	render(w, r.WithContext(ctx), templates.SegmentView(segment, members.Data))
+}
+
+// EditSegmentForm shows the form for changing a segment
+func (h *Handler) EditSegmentForm(w http.ResponseWriter, r *http.Request) {
+	segment, err := models.GetSegmentByID(h.db(r), chi.URLParam(r, "id"))
+	if err != nil {
+		writeFailure(w, r, "getting segment", err)
+		return
+	}
+
+	crumbs := append(segmentCrumbs(segment), templates.Breadcrumb{Label: "Edit"})
+	render(w, r.WithContext(withCrumbs(r, crumbs...)), templates.SegmentForm(segment, ""))
+}
+
+// UpdateSegment saves changes to a segment
+func (h *Handler) UpdateSegment(w http.ResponseWriter, r *http.Request) {
+	segment, err := parseSegment(r)
+	segment.ID = chi.URLParam(r, "id")
+	if err == nil {
+		segment, err = models.UpdateSegment(h.db(r), segment)
+	}
+	if err != nil {
+		segmentFormFailed(w, r, segment, "updating segment", err)
+		return
+	}
+
+	if wantsJSON(r) {
+		writeJSON(w, http.StatusOK, segment)
+		return
+	}
+	http.Redirect(w, r, "/segments/"+segment.ID, http.StatusSeeOther)
+}
+
+// segmentFormFailed shows the segment form again with what the admin entered and why it was
+// turned down. JSON clients and errors that aren't about the input get the usual error response.
+func segmentFormFailed(w http.ResponseWriter, r *http.Request, segment models.Segment, action string, err error) {
+	status, _ := classifyError(err)
+	if wantsJSON(r) || (status != http.StatusBadRequest && status != http.StatusConflict) {
+		writeFailure(w, r, action, err)
+		return
+	}
+
+	crumbs := []templates.Breadcrumb{{Label: "Segments", URL: "/segments"}, {Label: "New"}}
+	if segment.ID != "" {
+		crumbs = append(segmentCrumbs(segment), templates.Breadcrumb{Label: "Edit"})
+	}
+	w.WriteHeader(http.StatusUnprocessableEntity)
+	render(w, r.WithContext(withCrumbs(r, crumbs...)), templates.SegmentForm(segment, publicMessage(err, action)))
+}
+
+// DeleteSegment removes a segment
+func (h *Handler) DeleteSegment(w http.ResponseWriter, r *http.Request) {
+	if err := models.DeleteSegment(h.db(r), chi.URLParam(r, "id")); err != nil {
+		writeFailure(w, r, "deleting segment", err)
+		return
+	}
+
+	// For HTMX requests, just return 200 OK so the row is removed
+	if r.Header.Get("HX-Request") == "true" {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+	http.Redirect(w, r, "/segments", http.StatusSeeOther)
+}
+
+// ListSegmentsAPI lists every segment with its member count as JSON, for marketing tools
+func (h *Handler) ListSegmentsAPI(w http.ResponseWriter, r *http.Request) {
+	segments, err := models.GetSegments(h.db(r))
+	if err != nil {
+		writeFailure(w, r, "getting segments", err)
+		return
+	}
+
+	writeList(w, r, models.SinglePage(segments))
+}
+
+// SegmentMembers lists a page of a segment's members as JSON, for marketing tools
+func (h *Handler) SegmentMembers(w http.ResponseWriter, r *http.Request) {
+	segment, err := models.GetSegmentByID(h.db(r), chi.URLParam(r, "id"))
+	if err != nil {
+		writeFailure(w, r, "getting segment", err)
+		return
+	}
+
+	members, err := models.GetSegmentMembers(h.db(r), segment, listQuery(r, "", models.SortOptions{}))
+	if err != nil {
+		writeFailure(w, r, "getting segment members", err)
+		return
+	}
+
+	writeList(w, r, members)
+}
+
+// ExportSegment downloads every member of a segment as CSV, or as JSON with format=json,
+// streaming them from the database as they're written
+func (h *Handler) ExportSegment(w http.ResponseWriter, r *http.Request) {
+	segment, err := models.GetSegmentByID(h.db(r), chi.URLParam(r, "id"))
+	if err != nil {
+		writeFailure(w, r, "getting segment", err)
+		return
+	}
+
+	filename := exportFilename("segment-" + models.Slugify(segment.Name))
+	out := newExportStream(w, r, "Segment "+segment.Name, filename, segmentCSVHeader, segment.MemberCount)
+	out.Close(models.EachSegmentMember(h.db(r), segment, func(m models.SegmentMember) error {
+		return out.Write([]string{
+			m.SessionID, csvText(m.ReviewerName), csvTime(m.FirstSeenAt), csvTime(m.LastSeenAt),
+			strconv.Itoa(m.Reviews), csvTime(m.LastReviewedAt),
+			strconv.Itoa(m.Orders), m.Spent.String(), csvTime(m.LastOrderedAt),
+		}, m)
+	}))
+}
+
+// csvText keeps text shoppers typed from being read as a formula when the export is opened in a
+// spreadsheet
+func csvText(s string) string {
+	if s != "" && strings.ContainsRune("=+-@\t\r", rune(s[0])) {
+		return "'" + s
+	}
+	return s
+}
+
+// csvTime writes an optional time for a CSV export, empty when it isn't set
+func csvTime(t *time.Time) string {
+	if t == nil {
+		return ""
+	}
+	return t.UTC().Format(time.RFC3339)
+}
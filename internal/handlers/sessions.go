@@ -12,75 +12,70 @@ import (
 	"github.com/ngenohkevin/kuiper_admin/internal/templates"
 )
 
-// ListSessions handles the request to list all sessions
+// ListSessions handles the request to list sessions, a page at a time
 func (h *Handler) ListSessions(w http.ResponseWriter, r *http.Request) {
-	// Check if search query parameter exists
-	searchQuery := r.URL.Query().Get("q")
-
-	var sessions []models.Session
-	var err error
-
-	if searchQuery != "" {
-		// If search query exists, search for matching sessions
-		sessions, err = models.SearchSessions(h.DB, searchQuery)
-	} else {
-		// Otherwise, get all sessions
-		sessions, err = models.GetAllSessions(h.DB)
-	}
-
+	query := listQuery(r, "status", models.SessionSorts)
+	result, err := models.GetSessionsPaginated(h.db(r), query)
 	if err != nil {
-		http.Error(w, fmt.Sprintf("Error getting sessions: %v", err), http.StatusInternalServerError)
+		writeFailure(w, r, "getting sessions", err)
+		return
+	}
+	if wantsJSON(r) {
+		writeList(w, r, result)
 		return
 	}
 
-	templates.SessionList(sessions).Render(r.Context(), w)
+	state := templates.NewListState("/sessions", "sessions", "status", query, result)
+	h.rememberList(r, "/sessions")
+	render(w, r, templates.SessionList(state, result.Data))
 }
 
 // GetSession handles the request to view a single session
 func (h *Handler) GetSession(w http.ResponseWriter, r *http.Request) {
 	id := chi.URLParam(r, "id")
 	if id == "" {
-		http.Error(w, "Missing session ID", http.StatusBadRequest)
+		writeError(w, r, http.StatusBadRequest, "Missing session ID")
 		return
 	}
 
-	session, err := models.GetSessionByID(h.DB, id)
+	session, err := models.GetSessionByID(h.db(r), id)
 	if err != nil {
-		http.Error(w, fmt.Sprintf("Error getting session: %v", err), http.StatusInternalServerError)
+		writeFailure(w, r, "getting session", err)
 		return
 	}
 
-	templates.SessionView(session).Render(r.Context(), w)
+	render(w, r.WithContext(withCrumbs(r, current(h.sessionCrumbs(r, session))...)), templates.SessionView(session))
 }
 
 // EditSessionForm handles the request to show the form for editing a session
 func (h *Handler) EditSessionForm(w http.ResponseWriter, r *http.Request) {
 	id := chi.URLParam(r, "id")
 	if id == "" {
-		http.Error(w, "Missing session ID", http.StatusBadRequest)
+		writeError(w, r, http.StatusBadRequest, "Missing session ID")
 		return
 	}
 
-	session, err := models.GetSessionByID(h.DB, id)
+	session, err := models.GetSessionByID(h.db(r), id)
 	if err != nil {
-		http.Error(w, fmt.Sprintf("Error getting session: %v", err), http.StatusInternalServerError)
+		writeFailure(w, r, "getting session", err)
 		return
 	}
 
-	templates.SessionForm(session).Render(r.Context(), w)
+	ctx := withCrumbs(r, append(h.sessionCrumbs(r, session), templates.Breadcrumb{Label: "Edit"})...)
+	render(w, r.WithContext(ctx), templates.SessionForm(session))
 }
 
 // UpdateSession handles the request to update a session
 func (h *Handler) UpdateSession(w http.ResponseWriter, r *http.Request) {
 	id := chi.URLParam(r, "id")
 	if id == "" {
-		http.Error(w, "Missing session ID", http.StatusBadRequest)
+		writeError(w, r, http.StatusBadRequest, "Missing session ID")
 		return
 	}
 
 	// Parse form
 	if err := r.ParseForm(); err != nil {
-		http.Error(w, "Invalid form data", http.StatusBadRequest)
+		writeError(w, r, http.StatusBadRequest, "Invalid form data")
 		return
 	}
 
@@ -90,7 +85,7 @@ func (h *Handler) UpdateSession(w http.ResponseWriter, r *http.Request) {
 
 	// Validate required fields
 	if token == "" || expiresAtStr == "" {
-		http.Error(w, "Token and expires_at are required", http.StatusBadRequest)
+		writeError(w, r, http.StatusBadRequest, "Token and expires_at are required")
 		return
 	}
 
@@ -98,7 +93,7 @@ func (h *Handler) UpdateSession(w http.ResponseWriter, r *http.Request) {
 	var data json.RawMessage
 	if dataStr != "" {
 		if err := json.Unmarshal([]byte(dataStr), &data); err != nil {
-			http.Error(w, fmt.Sprintf("Invalid JSON data: %v", err), http.StatusBadRequest)
+			writeError(w, r, http.StatusBadRequest, fmt.Sprintf("Invalid JSON data: %v", err))
 			return
 		}
 	} else {
@@ -108,14 +103,14 @@ func (h *Handler) UpdateSession(w http.ResponseWriter, r *http.Request) {
 	// Parse expires_at datetime
 	expiresAt, err := time.Parse("2006-01-02T15:04", expiresAtStr)
 	if err != nil {
-		http.Error(w, "Invalid expires_at date format", http.StatusBadRequest)
+		writeError(w, r, http.StatusBadRequest, "Invalid expires_at date format")
 		return
 	}
 
 	// Update the session
-	_, err = models.UpdateSession(h.DB, id, token, data, expiresAt)
+	_, err = models.UpdateSession(h.db(r), id, token, data, expiresAt)
 	if err != nil {
-		http.Error(w, fmt.Sprintf("Error updating session: %v", err), http.StatusInternalServerError)
+		writeFailure(w, r, "updating session", err)
 		return
 	}
 
@@ -127,25 +122,25 @@ func (h *Handler) UpdateSession(w http.ResponseWriter, r *http.Request) {
 func (h *Handler) DeleteSession(w http.ResponseWriter, r *http.Request) {
 	id := chi.URLParam(r, "id")
 	if id == "" {
-		http.Error(w, "Missing session ID", http.StatusBadRequest)
+		writeError(w, r, http.StatusBadRequest, "Missing session ID")
 		return
 	}
 
 	// Delete the session
-	err := models.DeleteSession(h.DB, id)
+	err := models.DeleteSession(h.db(r), id)
 	if err != nil {
 		log.Printf("Error deleting session: %v", err)
-		http.Error(w, fmt.Sprintf("Error deleting session: %v", err), http.StatusInternalServerError)
+		writeFailure(w, r, "deleting session", err)
 		return
 	}
 
 	// For HTMX delete requests - always return a redirect to the sessions page
 	if r.Header.Get("HX-Request") == "true" {
-		w.Header().Set("HX-Redirect", "/sessions")
+		w.Header().Set("HX-Redirect", h.listURL(r, "/sessions"))
 		w.WriteHeader(http.StatusOK)
 		return
 	}
 
 	// For regular requests, redirect to the sessions list
-	http.Redirect(w, r, "/sessions", http.StatusSeeOther)
+	http.Redirect(w, r, h.listURL(r, "/sessions"), http.StatusSeeOther)
 }
@@ -0,0 +1,166 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/ngenohkevin/kuiper_admin/internal/models"
+	"github.com/ngenohkevin/kuiper_admin/internal/shipping"
+	"github.com/ngenohkevin/kuiper_admin/internal/templates"
+)
+
+// ShippingRates quotes the ways the shipping provider can send an order's parcel, from the
+// parcel's weight and size, for the admin to pick the label to buy
+func (h *Handler) ShippingRates(w http.ResponseWriter, r *http.Request) {
+	order, err := models.GetOrder(h.db(r), chi.URLParam(r, "id"))
+	if err != nil {
+		writeFailure(w, r, "getting order", err)
+		return
+	}
+
+	var parcel shipping.Parcel
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "application/json") {
+		if err = json.NewDecoder(r.Body).Decode(&parcel); err != nil {
+			err = fmt.Errorf("Invalid JSON: expected weight_grams, length_cm, width_cm and height_cm")
+		}
+	} else if err = r.ParseForm(); err != nil {
+		err = fmt.Errorf("Invalid form data")
+	} else {
+		measure := func(name string) float64 {
+			f, _ := strconv.ParseFloat(strings.TrimSpace(r.FormValue(name)), 64)
+			return f
+		}
+		parcel = shipping.Parcel{
+			WeightGrams: measure("weight_grams"), LengthCM: measure("length_cm"),
+			WidthCM: measure("width_cm"), HeightCM: measure("height_cm"),
+		}
+	}
+	if err == nil {
+		err = parcel.Validate()
+	}
+	if err == nil {
+		err = order.Shippable()
+	}
+	if err != nil {
+		if status, _ := classifyError(err); wantsJSON(r) || (status != http.StatusBadRequest && status != http.StatusConflict) {
+			writeFailure(w, r, "getting shipping rates", err)
+			return
+		}
+		h.renderOrder(w, r, http.StatusUnprocessableEntity, "", publicMessage(err, "getting shipping rates"))
+		return
+	}
+
+	cfg := shipping.ConfigFromEnv()
+	provider, _ := shipping.New(cfg) // A misconfigured provider says what is missing when asked
+	rates, err := provider.Rates(r.Context(), shipping.Shipment{From: cfg.From, To: *order.ShippingAddress, Parcel: parcel})
+	if err != nil {
+		h.shippingFailure(w, r, err)
+		return
+	}
+	if wantsJSON(r) {
+		writeJSON(w, http.StatusOK, rates)
+		return
+	}
+
+	labels, err := models.GetShippingLabels(h.db(r), order.ID)
+	if err != nil {
+		writeFailure(w, r, "getting shipping labels", err)
+		return
+	}
+
+	ctx := withCrumbs(r, append(h.orderCrumbs(r, order), templates.Breadcrumb{Label: "Shipping rates"})...)
+	render(w, r.WithContext(ctx), templates.ShippingRates(order, parcel, rates, len(labels) > 0))
+}
+
+// BuyShippingLabel buys the label for a rate ShippingRates quoted, and makes its tracking number
+// the order's
+func (h *Handler) BuyShippingLabel(w http.ResponseWriter, r *http.Request) {
+	order, err := models.GetOrder(h.db(r), chi.URLParam(r, "id"))
+	if err != nil {
+		writeFailure(w, r, "getting order", err)
+		return
+	}
+
+	// Only the rate's IDs are taken from the client; what it costs comes from the provider
+	body := struct {
+		shipping.Rate
+		Another bool `json:"another"` // Buy a label for an order that already has one
+	}{}
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "application/json") {
+		if err = json.NewDecoder(r.Body).Decode(&body); err != nil {
+			err = fmt.Errorf("Invalid JSON: expected a rate as the rates endpoint returned it")
+		}
+	} else if err = r.ParseForm(); err != nil {
+		err = fmt.Errorf("Invalid form data")
+	} else {
+		body.ID, body.ShipmentID = r.FormValue("rate_id"), r.FormValue("shipment_id")
+		body.Another = r.FormValue("another") != ""
+	}
+	rate := shipping.Rate{ID: body.ID, ShipmentID: body.ShipmentID}
+	if err == nil && (rate.ID == "" || rate.ShipmentID == "") {
+		err = fmt.Errorf("choose one of the quoted rates to buy")
+	}
+	if err == nil {
+		err = order.Shippable()
+	}
+	if err == nil {
+		err = models.StartLabelPurchase(h.db(r), order.ID, body.Another)
+	}
+	if err != nil {
+		if status, _ := classifyError(err); wantsJSON(r) || (status != http.StatusBadRequest && status != http.StatusConflict) {
+			writeFailure(w, r, "buying shipping label", err)
+			return
+		}
+		h.renderOrder(w, r, http.StatusUnprocessableEntity, "", publicMessage(err, "buying shipping label"))
+		return
+	}
+
+	provider, _ := shipping.FromEnv()
+	label, err := provider.Buy(r.Context(), rate)
+	if err != nil {
+		if err := models.EndLabelPurchase(h.db(r), order.ID); err != nil {
+			log.Printf("Error ending label purchase for order %s: %v", order.ID, err)
+		}
+		h.shippingFailure(w, r, err)
+		return
+	}
+
+	saved, err := models.RecordShippingLabel(h.db(r), order.ID, provider.Name(), label, h.requestActor(r))
+	if err != nil {
+		// The label is paid for, so keep what is needed to find it at the provider
+		log.Printf("Bought %s label %s (shipment %s, %s) for order %s but couldn't record it: %v",
+			provider.Name(), label.TrackingNumber, label.ShipmentID, label.LabelURL, order.ID, err)
+		writeFailure(w, r, "recording shipping label", err)
+		return
+	}
+
+	summary := "Bought a " + strings.TrimSpace(saved.Carrier+" "+saved.Service) + " label, tracking " + saved.TrackingNumber
+	if saved.Cost != "" {
+		summary += ", for " + saved.Cost + " " + saved.Currency
+	}
+	h.recordActivity(r, models.ActivityOrder, order.ID, models.ActivityLabelBought, summary)
+
+	if wantsJSON(r) {
+		writeJSON(w, http.StatusCreated, saved)
+		return
+	}
+	notice := "Bought a " + saved.Carrier + " label; the tracking number is " + saved.TrackingNumber
+	http.Redirect(w, r, orderURL(order.ID)+"?notice="+url.QueryEscape(notice), http.StatusSeeOther)
+}
+
+// shippingFailure reports an error from the shipping provider, which is neither the admin's
+// fault nor ours, as a bad gateway on the order page
+func (h *Handler) shippingFailure(w http.ResponseWriter, r *http.Request, err error) {
+	log.Printf("Shipping provider error: %v", err)
+	if wantsJSON(r) {
+		writeError(w, r, http.StatusBadGateway, err.Error())
+		return
+	}
+	h.renderOrder(w, r, http.StatusBadGateway, "", err.Error())
+}
@@ -1,7 +1,6 @@
 package handlers
 
 import (
-	"fmt"
 	"log"
 	"net/http"
 	"strconv"
@@ -9,6 +8,7 @@ import (
 
 	"github.com/go-chi/chi/v5"
 	"github.com/ngenohkevin/kuiper_admin/internal/models"
+	"github.com/ngenohkevin/kuiper_admin/internal/money"
 	"github.com/ngenohkevin/kuiper_admin/internal/templates"
 )
 
@@ -19,7 +19,7 @@ func (h *Handler) ListProductVariants(w http.ResponseWriter, r *http.Request) {
 	var err error
 
 	for retries := 0; retries < 3; retries++ {
-		variants, err = models.GetAllProductVariants(h.DB)
+		variants, err = models.GetAllProductVariants(h.db(r))
 		if err == nil {
 			break
 		}
@@ -30,7 +30,7 @@ func (h *Handler) ListProductVariants(w http.ResponseWriter, r *http.Request) {
 
 	if err != nil {
 		log.Printf("Failed to get product variants after retries: %v", err)
-		http.Error(w, fmt.Sprintf("Error getting product variants: %v", err), http.StatusInternalServerError)
+		writeFailure(w, r, "getting product variants", err)
 		return
 	}
 
@@ -38,7 +38,7 @@ func (h *Handler) ListProductVariants(w http.ResponseWriter, r *http.Request) {
 	var products []models.Product
 
 	for retries := 0; retries < 3; retries++ {
-		products, err = models.GetAllProducts(h.DB)
+		products, err = models.GetAllProducts(h.db(r))
 		if err == nil {
 			break
 		}
@@ -49,55 +49,67 @@ func (h *Handler) ListProductVariants(w http.ResponseWriter, r *http.Request) {
 
 	if err != nil {
 		log.Printf("Failed to get products after retries: %v", err)
-		http.Error(w, fmt.Sprintf("Error getting products: %v", err), http.StatusInternalServerError)
+		writeFailure(w, r, "getting products", err)
 		return
 	}
 
-	templates.ProductVariantList(variants, products).Render(r.Context(), w)
+	// Narrow to a unit and quantity range, e.g. ?unit=g&min=5&max=30
+	query := r.URL.Query()
+	filter := models.VariantFilter{Unit: query.Get("unit")}
+	filter.Min, _ = strconv.ParseFloat(query.Get("min"), 64)
+	filter.Max, _ = strconv.ParseFloat(query.Get("max"), 64)
+	filtered := variants[:0]
+	for _, variant := range variants {
+		if filter.Matches(variant) {
+			filtered = append(filtered, variant)
+		}
+	}
+
+	render(w, r, templates.ProductVariantList(filtered, products, filter))
 }
 
 // NewStandaloneVariantForm handles the request to show the form for creating a new product variant
 func (h *Handler) NewStandaloneVariantForm(w http.ResponseWriter, r *http.Request) {
 	// Get all products for dropdown
-	products, err := models.GetAllProducts(h.DB)
+	products, err := models.GetAllProducts(h.db(r))
 	if err != nil {
-		http.Error(w, fmt.Sprintf("Error getting products: %v", err), http.StatusInternalServerError)
+		writeFailure(w, r, "getting products", err)
 		return
 	}
 
-	templates.StandaloneProductVariantForm(nil, products, false).Render(r.Context(), w)
+	render(w, r, templates.StandaloneProductVariantForm(nil, products, false))
 }
 
 // EditStandaloneVariantForm handles the request to show the form for editing a product variant
 func (h *Handler) EditStandaloneVariantForm(w http.ResponseWriter, r *http.Request) {
 	id := chi.URLParam(r, "id")
 	if id == "" {
-		http.Error(w, "Missing variant ID", http.StatusBadRequest)
+		writeError(w, r, http.StatusBadRequest, "Missing variant ID")
 		return
 	}
 
 	// Get the variant
-	variant, err := models.GetProductVariantByID(h.DB, id)
+	variant, err := models.GetProductVariantByID(h.db(r), id)
 	if err != nil {
-		http.Error(w, fmt.Sprintf("Error getting product variant: %v", err), http.StatusInternalServerError)
+		writeFailure(w, r, "getting product variant", err)
 		return
 	}
 
 	// Get all products for dropdown
-	products, err := models.GetAllProducts(h.DB)
+	products, err := models.GetAllProducts(h.db(r))
 	if err != nil {
-		http.Error(w, fmt.Sprintf("Error getting products: %v", err), http.StatusInternalServerError)
+		writeFailure(w, r, "getting products", err)
 		return
 	}
 
-	templates.StandaloneProductVariantForm(&variant, products, true).Render(r.Context(), w)
+	render(w, r, templates.StandaloneProductVariantForm(&variant, products, true))
 }
 
 // CreateStandaloneVariant handles the request to create a new product variant
 func (h *Handler) CreateStandaloneVariant(w http.ResponseWriter, r *http.Request) {
 	// Parse form
 	if err := r.ParseForm(); err != nil {
-		http.Error(w, "Invalid form data", http.StatusBadRequest)
+		writeError(w, r, http.StatusBadRequest, "Invalid form data")
 		return
 	}
 
@@ -109,20 +121,20 @@ func (h *Handler) CreateStandaloneVariant(w http.ResponseWriter, r *http.Request
 
 	// Validate required fields
 	if productID == "" || name == "" || priceStr == "" || stockCountStr == "" {
-		http.Error(w, "Product, name, price, and stock count are required", http.StatusBadRequest)
+		writeError(w, r, http.StatusBadRequest, "Product, name, price, and stock count are required")
 		return
 	}
 
 	// Parse numeric values
-	price, err := strconv.ParseFloat(priceStr, 64)
+	price, err := money.ParseInput(priceStr)
 	if err != nil {
-		http.Error(w, "Invalid price", http.StatusBadRequest)
+		writeError(w, r, http.StatusBadRequest, "Invalid price: "+err.Error())
 		return
 	}
 
 	stockCount, err := strconv.Atoi(stockCountStr)
 	if err != nil {
-		http.Error(w, "Invalid stock count", http.StatusBadRequest)
+		writeError(w, r, http.StatusBadRequest, "Invalid stock count")
 		return
 	}
 
@@ -130,25 +142,25 @@ func (h *Handler) CreateStandaloneVariant(w http.ResponseWriter, r *http.Request
 	isAvailable := isAvailableStr == "true"
 
 	// Get the product to ensure it exists
-	_, err = models.GetProductByID(h.DB, productID)
+	_, err = models.GetProductByID(h.db(r), productID)
 	if err != nil {
-		http.Error(w, fmt.Sprintf("Error finding product: %v", err), http.StatusBadRequest)
+		writeError(w, r, http.StatusBadRequest, "Product not found")
 		return
 	}
 
 	// Ensure the product is set to have variants
-	err = models.UpdateProductHasVariants(h.DB, productID, true)
+	err = models.UpdateProductHasVariants(h.db(r), productID, true)
 	if err != nil {
 		log.Printf("Error updating product has_variants flag: %v", err)
-		http.Error(w, fmt.Sprintf("Error updating product has_variants flag: %v", err), http.StatusInternalServerError)
+		writeFailure(w, r, "updating product has_variants flag", err)
 		return
 	}
 
 	// Create the product variant
-	_, err = models.CreateProductVariant(h.DB, productID, name, price, stockCount, isAvailable)
+	_, err = models.CreateProductVariant(h.db(r), productID, name, price, stockCount, isAvailable)
 	if err != nil {
 		log.Printf("Error creating product variant: %v", err)
-		http.Error(w, fmt.Sprintf("Error creating product variant: %v", err), http.StatusInternalServerError)
+		writeFailure(w, r, "creating product variant", err)
 		return
 	}
 
@@ -160,13 +172,13 @@ func (h *Handler) CreateStandaloneVariant(w http.ResponseWriter, r *http.Request
 func (h *Handler) UpdateStandaloneVariant(w http.ResponseWriter, r *http.Request) {
 	id := chi.URLParam(r, "id")
 	if id == "" {
-		http.Error(w, "Missing variant ID", http.StatusBadRequest)
+		writeError(w, r, http.StatusBadRequest, "Missing variant ID")
 		return
 	}
 
 	// Parse form
 	if err := r.ParseForm(); err != nil {
-		http.Error(w, "Invalid form data", http.StatusBadRequest)
+		writeError(w, r, http.StatusBadRequest, "Invalid form data")
 		return
 	}
 
@@ -178,41 +190,41 @@ func (h *Handler) UpdateStandaloneVariant(w http.ResponseWriter, r *http.Request
 
 	// Validate required fields
 	if productID == "" || name == "" || priceStr == "" || stockCountStr == "" {
-		http.Error(w, "Product, name, price, and stock count are required", http.StatusBadRequest)
+		writeError(w, r, http.StatusBadRequest, "Product, name, price, and stock count are required")
 		return
 	}
 
 	// Get the current variant
-	currentVariant, err := models.GetProductVariantByID(h.DB, id)
+	currentVariant, err := models.GetProductVariantByID(h.db(r), id)
 	if err != nil {
-		http.Error(w, fmt.Sprintf("Error getting product variant: %v", err), http.StatusInternalServerError)
+		writeFailure(w, r, "getting product variant", err)
 		return
 	}
 
 	// If the product ID has changed, we need to handle that
 	if currentVariant.ProductID != productID {
 		// Make sure the new product exists
-		_, err = models.GetProductByID(h.DB, productID)
+		_, err = models.GetProductByID(h.db(r), productID)
 		if err != nil {
-			http.Error(w, fmt.Sprintf("Error finding new product: %v", err), http.StatusBadRequest)
+			writeError(w, r, http.StatusBadRequest, "New product not found")
 			return
 		}
 
 		// Ensure the new product is set to have variants
-		err = models.UpdateProductHasVariants(h.DB, productID, true)
+		err = models.UpdateProductHasVariants(h.db(r), productID, true)
 		if err != nil {
 			log.Printf("Error updating new product has_variants flag: %v", err)
-			http.Error(w, fmt.Sprintf("Error updating product has_variants flag: %v", err), http.StatusInternalServerError)
+			writeFailure(w, r, "updating product has_variants flag", err)
 			return
 		}
 
 		// Check if this was the last variant for the old product
-		oldProductVariants, err := models.GetProductVariantsByProductID(h.DB, currentVariant.ProductID)
+		oldProductVariants, err := models.GetProductVariantsByProductID(h.db(r), currentVariant.ProductID)
 		if err != nil {
 			log.Printf("Error checking variants for old product: %v", err)
 		} else if len(oldProductVariants) == 1 && oldProductVariants[0].ID == id {
 			// This is the only variant for the old product, so we can set has_variants to false
-			err = models.UpdateProductHasVariants(h.DB, currentVariant.ProductID, false)
+			err = models.UpdateProductHasVariants(h.db(r), currentVariant.ProductID, false)
 			if err != nil {
 				log.Printf("Error updating old product has_variants flag: %v", err)
 			}
@@ -220,15 +232,15 @@ func (h *Handler) UpdateStandaloneVariant(w http.ResponseWriter, r *http.Request
 	}
 
 	// Parse numeric values
-	price, err := strconv.ParseFloat(priceStr, 64)
+	price, err := money.ParseInput(priceStr)
 	if err != nil {
-		http.Error(w, "Invalid price", http.StatusBadRequest)
+		writeError(w, r, http.StatusBadRequest, "Invalid price: "+err.Error())
 		return
 	}
 
 	stockCount, err := strconv.Atoi(stockCountStr)
 	if err != nil {
-		http.Error(w, "Invalid stock count", http.StatusBadRequest)
+		writeError(w, r, http.StatusBadRequest, "Invalid stock count")
 		return
 	}
 
@@ -236,11 +248,12 @@ func (h *Handler) UpdateStandaloneVariant(w http.ResponseWriter, r *http.Request
 	isAvailable := isAvailableStr == "true"
 
 	// Update the product variant
-	_, err = models.UpdateProductVariantWithProductID(h.DB, id, productID, name, price, stockCount, isAvailable)
+	variant, err := models.UpdateProductVariantWithProductID(h.db(r), id, productID, name, price, stockCount, isAvailable)
 	if err != nil {
-		http.Error(w, fmt.Sprintf("Error updating product variant: %v", err), http.StatusInternalServerError)
+		writeFailure(w, r, "updating product variant", err)
 		return
 	}
+	h.recordVariantEdit(r, currentVariant, variant)
 
 	// Redirect to the variants list
 	http.Redirect(w, r, "/variants", http.StatusSeeOther)
@@ -250,31 +263,31 @@ func (h *Handler) UpdateStandaloneVariant(w http.ResponseWriter, r *http.Request
 func (h *Handler) DeleteStandaloneVariant(w http.ResponseWriter, r *http.Request) {
 	id := chi.URLParam(r, "id")
 	if id == "" {
-		http.Error(w, "Missing variant ID", http.StatusBadRequest)
+		writeError(w, r, http.StatusBadRequest, "Missing variant ID")
 		return
 	}
 
 	// Get the variant to find its product ID
-	variant, err := models.GetProductVariantByID(h.DB, id)
+	variant, err := models.GetProductVariantByID(h.db(r), id)
 	if err != nil {
-		http.Error(w, fmt.Sprintf("Error getting product variant: %v", err), http.StatusInternalServerError)
+		writeFailure(w, r, "getting product variant", err)
 		return
 	}
 
 	// Delete the variant
-	err = models.DeleteProductVariant(h.DB, id)
+	err = models.DeleteProductVariant(h.db(r), id)
 	if err != nil {
-		http.Error(w, fmt.Sprintf("Error deleting product variant: %v", err), http.StatusInternalServerError)
+		writeFailure(w, r, "deleting product variant", err)
 		return
 	}
 
 	// Check if this was the last variant for the product
-	variants, err := models.GetProductVariantsByProductID(h.DB, variant.ProductID)
+	variants, err := models.GetProductVariantsByProductID(h.db(r), variant.ProductID)
 	if err != nil {
 		log.Printf("Error checking remaining variants for product: %v", err)
 	} else if len(variants) == 0 {
 		// No more variants for this product, so set has_variants to false
-		err = models.UpdateProductHasVariants(h.DB, variant.ProductID, false)
+		err = models.UpdateProductHasVariants(h.db(r), variant.ProductID, false)
 		if err != nil {
 			log.Printf("Error updating product has_variants flag: %v", err)
 		}
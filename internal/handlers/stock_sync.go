@@ -0,0 +1,56 @@
+package handlers
+
+import (
+	"context"
+	"log"
+	"net/http"
+
+	"github.com/ngenohkevin/kuiper_admin/internal/jobs"
+	"github.com/ngenohkevin/kuiper_admin/internal/models"
+	"github.com/ngenohkevin/kuiper_admin/internal/templates"
+	"github.com/ngenohkevin/kuiper_admin/internal/wms"
+)
+
+// StockSyncSettings shows the warehouse sync configuration, recent runs and the corrections they made
+func (h *Handler) StockSyncSettings(w http.ResponseWriter, r *http.Request) {
+	runs, err := models.GetStockSyncRuns(h.db(r), 20)
+	if err != nil {
+		writeFailure(w, r, "getting stock sync runs", err)
+		return
+	}
+
+	corrections, err := models.GetStockMovements(h.db(r), models.MovementWMSSync, 50)
+	if err != nil {
+		writeFailure(w, r, "getting stock corrections", err)
+		return
+	}
+
+	if wantsJSON(r) {
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"runs":        runs,
+			"corrections": corrections,
+		})
+		return
+	}
+
+	render(w, r, templates.StockSyncSettings(wms.ConfigFromEnv(), runs, corrections, r.URL.Query().Get("started") != ""))
+}
+
+// RunStockSync starts a sync in the background instead of waiting for the next scheduled run
+func (h *Handler) RunStockSync(w http.ResponseWriter, r *http.Request) {
+	cfg := wms.ConfigFromEnv()
+	if !cfg.Enabled() {
+		writeError(w, r, http.StatusBadRequest, "Stock sync is not configured; set WMS_SYNC_URL")
+		return
+	}
+
+	// A full sync can outlast the request timeout, so it runs detached and is recorded like scheduled runs
+	db := h.detachedDB(r)
+	go func() {
+		if err := jobs.SyncStock(db, cfg)(context.Background()); err != nil {
+			log.Printf("Manual stock sync failed: %v", err)
+		}
+	}()
+
+	http.Redirect(w, r, "/settings/stock-sync?started=1", http.StatusSeeOther)
+}
@@ -0,0 +1,112 @@
+package handlers
+
+import (
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/ngenohkevin/kuiper_admin/internal/models"
+	"github.com/ngenohkevin/kuiper_admin/internal/preview"
+	"github.com/ngenohkevin/kuiper_admin/internal/templates"
+)
+
+// storefrontPreviewTTL is how long the preview links on product pages work for
+const storefrontPreviewTTL = 24 * time.Hour
+
+// storefrontBaseURL returns the storefront URL from the store settings, falling back to the
+// STOREFRONT_URL environment variable, or an empty string when neither is set
+func (h *Handler) storefrontBaseURL(r *http.Request) string {
+	settings, err := models.GetStoreSettings(h.db(r))
+	if err != nil {
+		log.Printf("Error getting store settings: %v", err)
+	}
+	if settings.StorefrontURL != "" {
+		return settings.StorefrontURL
+	}
+	return strings.TrimRight(os.Getenv("STOREFRONT_URL"), "/")
+}
+
+// storefrontLinks returns a product's storefront page and the page to preview it with.
+// Archived products are hidden from the storefront, so their preview carries a signed token
+// the storefront passes on to the catalog API. Both are empty when no storefront URL is set.
+func (h *Handler) storefrontLinks(r *http.Request, product models.Product) templates.StorefrontLinks {
+	base := h.storefrontBaseURL(r)
+	if base == "" {
+		return templates.StorefrontLinks{}
+	}
+
+	links := templates.StorefrontLinks{URL: base + "/products/" + url.PathEscape(product.Slug)}
+	links.Preview = links.URL
+	if product.IsArchived() {
+		settings, err := models.GetStoreSettings(h.db(r))
+		if err != nil {
+			log.Printf("Error getting store settings: %v", err)
+			return links
+		}
+		token := preview.Sign(settings.PreviewSecret, product.ID, time.Now().Add(storefrontPreviewTTL))
+		links.Preview = links.URL + "?preview=" + url.QueryEscape(token)
+	}
+	return links
+}
+
+// StoreSettings shows the settings that apply to the whole store
+func (h *Handler) StoreSettings(w http.ResponseWriter, r *http.Request) {
+	settings, err := models.GetStoreSettings(h.db(r))
+	if err != nil {
+		writeFailure(w, r, "getting store settings", err)
+		return
+	}
+
+	if wantsJSON(r) {
+		writeJSON(w, http.StatusOK, settings)
+		return
+	}
+
+	render(w, r, templates.StoreSettingsPage(settings, os.Getenv("STOREFRONT_URL"), h.tenantWebhookSecret(r), r.URL.Query().Get("saved") == "1", ""))
+}
+
+// tenantWebhookSecret is the webhook secret the store settings page shows a tenant's admins to
+// give their storefront, or empty on the main store, whose secret is set in the environment
+func (h *Handler) tenantWebhookSecret(r *http.Request) string {
+	if _, ok := models.TenantFromContext(r.Context()); !ok {
+		return ""
+	}
+	secret, err := h.webhookSecret(r)
+	if err != nil {
+		log.Printf("Error getting webhook secret: %v", err)
+	}
+	return secret
+}
+
+// UpdateStoreSettings saves the storefront URL and, on a tenant, where its order notifications go
+func (h *Handler) UpdateStoreSettings(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		writeError(w, r, http.StatusBadRequest, "Invalid form data")
+		return
+	}
+
+	submitted := models.StoreSettings{StorefrontURL: r.FormValue("storefront_url")}
+	if _, ok := models.TenantFromContext(r.Context()); ok {
+		submitted.NotifyURL, submitted.MailFrom = r.FormValue("notify_url"), r.FormValue("mail_from")
+	}
+	settings, err := models.SaveStoreSettings(h.db(r), submitted)
+	if err != nil {
+		if wantsJSON(r) {
+			writeFailure(w, r, "saving store settings", err)
+			return
+		}
+		// Show the problem on the page with what the admin typed
+		w.WriteHeader(http.StatusUnprocessableEntity)
+		render(w, r, templates.StoreSettingsPage(submitted, os.Getenv("STOREFRONT_URL"), h.tenantWebhookSecret(r), false, publicMessage(err, "saving store settings")))
+		return
+	}
+
+	if wantsJSON(r) {
+		writeJSON(w, http.StatusOK, settings)
+		return
+	}
+	http.Redirect(w, r, "/settings/store?saved=1", http.StatusSeeOther)
+}
@@ -0,0 +1,191 @@
+package handlers
+
+import (
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/ngenohkevin/kuiper_admin/internal/database"
+	custommiddleware "github.com/ngenohkevin/kuiper_admin/internal/middleware"
+	"github.com/ngenohkevin/kuiper_admin/internal/models"
+	"github.com/ngenohkevin/kuiper_admin/internal/templates"
+)
+
+// tenantsFailed goes back to the tenants page with what went wrong, or answers with it for JSON
+// requests
+func tenantsFailed(w http.ResponseWriter, r *http.Request, action string, err error) {
+	if wantsJSON(r) {
+		writeFailure(w, r, action, err)
+		return
+	}
+	http.Redirect(w, r, "/settings/tenants?error="+url.QueryEscape(publicMessage(err, action)), http.StatusSeeOther)
+}
+
+// tenantsAddress is the scheme and host tenants' subdomains go in front of, e.g.
+// https://admin.example.com, with the port the request came in on
+func tenantsAddress(r *http.Request) (scheme, host string) {
+	scheme = "http"
+	if r.TLS != nil || r.Header.Get("X-Forwarded-Proto") == "https" {
+		scheme = "https"
+	}
+	host = custommiddleware.TenantBaseDomain()
+	if _, port, err := net.SplitHostPort(r.Host); err == nil && host != "" {
+		host = net.JoinHostPort(host, port)
+	}
+	return scheme, host
+}
+
+// Tenants lists the stores kept in schemas of their own, with whether each is up to date
+func (h *Handler) Tenants(w http.ResponseWriter, r *http.Request) {
+	tenants, err := models.GetTenants(h.db(r))
+	if err != nil {
+		writeFailure(w, r, "getting tenants", err)
+		return
+	}
+	latest, err := models.LatestMigration(database.MigrationsDir)
+	if err != nil {
+		writeFailure(w, r, "reading migrations", err)
+		return
+	}
+
+	if wantsJSON(r) {
+		writeList(w, r, models.SinglePage(tenants))
+		return
+	}
+
+	scheme, host := tenantsAddress(r)
+	query := r.URL.Query()
+	render(w, r, templates.Tenants(tenants, latest, scheme, host, query.Get("notice"), query.Get("error")))
+}
+
+// CreateTenant registers a tenant on the subdomain from the form, creates and migrates its
+// schema and adds its first admin account, since it shares no accounts with the main store
+func (h *Handler) CreateTenant(w http.ResponseWriter, r *http.Request) {
+	// Parse form
+	if err := r.ParseForm(); err != nil {
+		writeError(w, r, http.StatusBadRequest, "Error parsing form")
+		return
+	}
+
+	// Check the first admin before anything is created, so a tenant isn't left without one
+	username, err := models.NormalizeAdminUsername(r.FormValue("admin_username"))
+	if err == nil {
+		err = models.CheckAdminPassword(r.FormValue("admin_password"))
+	}
+	if err != nil {
+		tenantsFailed(w, r, "creating tenant", err)
+		return
+	}
+
+	actor := h.Session.GetString(r.Context(), "username")
+	tenant, err := models.CreateTenant(h.db(r), r.FormValue("slug"), r.FormValue("name"), actor)
+	if err != nil {
+		tenantsFailed(w, r, "creating tenant", err)
+		return
+	}
+	if tenant, err = models.MigrateTenant(h.db(r), tenant, database.MigrationsDir); err != nil {
+		log.Printf("Error migrating new tenant %s: %v", tenant.Slug, err)
+		tenantsFailed(w, r, "creating tenant", fmt.Errorf("%s was added, but its schema couldn't be set up; see the error below and migrate it again", tenant.Name))
+		return
+	}
+	if _, err := h.createTenantAdmin(r, tenant, username, r.FormValue("admin_password")); err != nil {
+		tenantsFailed(w, r, "creating tenant's admin", err)
+		return
+	}
+
+	if wantsJSON(r) {
+		writeJSON(w, http.StatusCreated, tenant)
+		return
+	}
+	http.Redirect(w, r, "/settings/tenants?notice="+url.QueryEscape("Added "+tenant.Name+", whose admin "+username+" can sign in now"), http.StatusSeeOther)
+}
+
+// createTenantAdmin adds an admin account in a tenant's schema
+func (h *Handler) createTenantAdmin(r *http.Request, tenant models.Tenant, username, password string) (models.AdminUser, error) {
+	tenantDB, err := h.db(r).ForSchema(tenant.Schema)
+	if err != nil {
+		return models.AdminUser{}, err
+	}
+	return models.CreateAdminUser(tenantDB.WithContext(r.Context()), username, password, h.Session.GetString(r.Context(), "username"))
+}
+
+// CreateTenantAdmin adds an admin account to a tenant, for a tenant whose admins have lost access
+func (h *Handler) CreateTenantAdmin(w http.ResponseWriter, r *http.Request) {
+	tenant, err := models.GetTenant(h.db(r), chi.URLParam(r, "id"))
+	if err != nil {
+		tenantsFailed(w, r, "getting tenant", err)
+		return
+	}
+
+	// Parse form
+	if err := r.ParseForm(); err != nil {
+		writeError(w, r, http.StatusBadRequest, "Error parsing form")
+		return
+	}
+
+	user, err := h.createTenantAdmin(r, tenant, r.FormValue("admin_username"), r.FormValue("admin_password"))
+	if err != nil {
+		tenantsFailed(w, r, "creating tenant's admin", err)
+		return
+	}
+
+	if wantsJSON(r) {
+		writeJSON(w, http.StatusCreated, user)
+		return
+	}
+	http.Redirect(w, r, "/settings/tenants?notice="+url.QueryEscape("Added admin "+user.Username+" to "+tenant.Name), http.StatusSeeOther)
+}
+
+// MigrateTenant applies any migrations a tenant's schema is missing, such as after a failed run
+func (h *Handler) MigrateTenant(w http.ResponseWriter, r *http.Request) {
+	tenant, err := models.GetTenant(h.db(r), chi.URLParam(r, "id"))
+	if err != nil {
+		tenantsFailed(w, r, "getting tenant", err)
+		return
+	}
+
+	tenant, err = models.MigrateTenant(h.db(r), tenant, database.MigrationsDir)
+	if err != nil {
+		log.Printf("Error migrating tenant %s: %v", tenant.Slug, err)
+		tenantsFailed(w, r, "migrating tenant", fmt.Errorf("%s couldn't be migrated; see the error below", tenant.Name))
+		return
+	}
+
+	if wantsJSON(r) {
+		writeJSON(w, http.StatusOK, tenant)
+		return
+	}
+	http.Redirect(w, r, "/settings/tenants?notice="+url.QueryEscape("Migrated "+tenant.Name), http.StatusSeeOther)
+}
+
+// DisableTenant takes a tenant's subdomain offline and stops its jobs, keeping its data
+func (h *Handler) DisableTenant(w http.ResponseWriter, r *http.Request) {
+	h.setTenantEnabled(w, r, false)
+}
+
+// EnableTenant brings a disabled tenant back online
+func (h *Handler) EnableTenant(w http.ResponseWriter, r *http.Request) {
+	h.setTenantEnabled(w, r, true)
+}
+
+// setTenantEnabled turns a tenant off or back on
+func (h *Handler) setTenantEnabled(w http.ResponseWriter, r *http.Request, enabled bool) {
+	tenant, err := models.SetTenantEnabled(h.db(r), chi.URLParam(r, "id"), enabled)
+	if err != nil {
+		tenantsFailed(w, r, "updating tenant", err)
+		return
+	}
+
+	if wantsJSON(r) {
+		writeJSON(w, http.StatusOK, tenant)
+		return
+	}
+	notice := "Enabled " + tenant.Name
+	if !enabled {
+		notice = "Disabled " + tenant.Name
+	}
+	http.Redirect(w, r, "/settings/tenants?notice="+url.QueryEscape(notice), http.StatusSeeOther)
+}
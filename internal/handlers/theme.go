@@ -0,0 +1,60 @@
+package handlers
+
+import (
+	"log"
+	"net/http"
+
+	"github.com/ngenohkevin/kuiper_admin/internal/models"
+	"github.com/ngenohkevin/kuiper_admin/internal/templates"
+)
+
+// ApplyTheme is middleware that puts the session's theme into the request context for
+// the templates. The first request of a session picks up the admin's saved preference.
+func (h *Handler) ApplyTheme(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		theme := h.Session.GetString(r.Context(), "theme")
+		if theme == "" {
+			theme = models.PreferencesFromContext(r.Context()).Theme
+			h.Session.Put(r.Context(), "theme", theme)
+		}
+
+		next.ServeHTTP(w, r.WithContext(templates.WithTheme(r.Context(), theme)))
+	})
+}
+
+// ToggleTheme switches between the dark and light themes, or sets the one named
+// in the "theme" form value, and remembers the choice for the session and account
+func (h *Handler) ToggleTheme(w http.ResponseWriter, r *http.Request) {
+	theme := r.FormValue("theme")
+	if theme != "dark" && theme != "light" {
+		theme = "light"
+		if templates.ThemeFromContext(r.Context()) == "light" {
+			theme = "dark"
+		}
+	}
+
+	h.Session.Put(r.Context(), "theme", theme)
+
+	// Persist to the admin's preferences as well so it carries over to new sessions
+	if username := h.Session.GetString(r.Context(), "username"); username != "" {
+		prefs := models.PreferencesFromContext(r.Context())
+		prefs.Username = username
+		prefs.Theme = theme
+		if _, err := models.SaveAdminPreferences(h.db(r), prefs); err != nil {
+			log.Printf("Error saving theme preference for %s: %v", username, err)
+		}
+	}
+
+	// Re-render the page so the new theme is applied server-side
+	if r.Header.Get("HX-Request") == "true" {
+		w.Header().Set("HX-Refresh", "true")
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	redirectTo := r.Referer()
+	if redirectTo == "" {
+		redirectTo = "/"
+	}
+	http.Redirect(w, r, redirectTo, http.StatusSeeOther)
+}
@@ -0,0 +1,168 @@
+package handlers
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/ngenohkevin/kuiper_admin/internal/importer"
+	"github.com/ngenohkevin/kuiper_admin/internal/models"
+	"github.com/ngenohkevin/kuiper_admin/internal/templates"
+)
+
+// TrackingImportForm shows the upload form for tracking number CSVs
+func (h *Handler) TrackingImportForm(w http.ResponseWriter, r *http.Request) {
+	render(w, r, templates.TrackingImportForm(""))
+}
+
+// renderTrackingForm shows the upload form again with formError above it
+func (h *Handler) renderTrackingForm(w http.ResponseWriter, r *http.Request, formError string) {
+	if wantsJSON(r) {
+		writeError(w, r, http.StatusBadRequest, formError)
+		return
+	}
+	w.WriteHeader(http.StatusBadRequest)
+	render(w, r, templates.TrackingImportForm(formError))
+}
+
+// ImportTracking matches an uploaded CSV of tracking numbers to orders by order number, giving
+// each order its tracking number and moving it to shipped, or to the status the file gives. API
+// clients can send the lines as JSON instead.
+func (h *Handler) ImportTracking(w http.ResponseWriter, r *http.Request) {
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "application/json") {
+		body := struct {
+			Orders []models.TrackingImport `json:"orders"`
+			Notify *bool                   `json:"notify"` // Defaults to true
+			DryRun bool                    `json:"dry_run"`
+		}{}
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxImportSize)).Decode(&body); err != nil {
+			writeError(w, r, http.StatusBadRequest, "Invalid JSON: expected orders, notify and dry_run")
+			return
+		}
+		for i := range body.Orders {
+			if body.Orders[i].Row == 0 {
+				body.Orders[i].Row = i + 1
+			}
+		}
+		h.runTrackingImport(w, r, body.Orders, body.Notify == nil || *body.Notify, body.DryRun, "")
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, maxImportSize)
+	if err := r.ParseMultipartForm(maxImportSize); err != nil {
+		h.renderTrackingForm(w, r, "The upload is too large or invalid")
+		return
+	}
+	file, _, err := r.FormFile("file")
+	if err != nil {
+		h.renderTrackingForm(w, r, "Choose a tracking CSV to import")
+		return
+	}
+	defer file.Close()
+
+	// A dry run keeps the upload so the preview can be applied without uploading again
+	if r.FormValue("dry_run") != "" {
+		token, err := saveImportUpload(file)
+		if err != nil {
+			writeFailure(w, r, "saving upload", err)
+			return
+		}
+		h.importStoredTracking(w, r, token, true)
+		return
+	}
+
+	rows, err := importer.ParseTracking(file)
+	if err != nil {
+		h.renderTrackingForm(w, r, err.Error())
+		return
+	}
+	h.runTrackingImport(w, r, rows, r.FormValue("notify") != "", false, "")
+}
+
+// ApplyTrackingImport imports a tracking CSV kept by a dry run, as its preview showed
+func (h *Handler) ApplyTrackingImport(w http.ResponseWriter, r *http.Request) {
+	h.importStoredTracking(w, r, r.FormValue("token"), false)
+}
+
+// importStoredTracking imports the tracking CSV kept under token. The file is removed once it
+// has been imported for real.
+func (h *Handler) importStoredTracking(w http.ResponseWriter, r *http.Request, token string, dryRun bool) {
+	path, err := importUploadPath(token)
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		writeError(w, r, http.StatusNotFound, "This upload has expired; upload the file again")
+		return
+	}
+	defer file.Close()
+
+	rows, err := importer.ParseTracking(file)
+	if err != nil {
+		h.renderTrackingForm(w, r, err.Error())
+		return
+	}
+	applicable := h.runTrackingImport(w, r, rows, r.FormValue("notify") != "", dryRun, token)
+	if !dryRun || !applicable {
+		os.Remove(path)
+	}
+}
+
+// runTrackingImport imports the lines and shows what they did, recording each order updated.
+// It reports whether the import could be applied as previewed, so a dry run's upload is kept.
+func (h *Handler) runTrackingImport(w http.ResponseWriter, r *http.Request, rows []models.TrackingImport, notify, dryRun bool, token string) bool {
+	results, err := models.ImportTracking(h.db(r), rows, notify, dryRun, h.Session.GetString(r.Context(), "username"))
+	if err != nil {
+		if status, _ := classifyError(err); status == http.StatusBadRequest {
+			h.renderTrackingForm(w, r, publicMessage(err, "importing tracking numbers"))
+		} else {
+			writeFailure(w, r, "importing tracking numbers", err)
+		}
+		return false
+	}
+
+	failed := false
+	var events []models.ActivityEvent
+	var entries []models.AuditEntry
+	for _, result := range results {
+		failed = failed || result.Outcome == models.ImportFailed
+		if dryRun || result.Outcome != models.ImportUpdated {
+			continue
+		}
+		summary := "Tracking number " + strings.TrimSpace(result.Carrier+" "+result.TrackingNumber) + " imported"
+		action := models.ActivityUpdated
+		if result.StatusChanged() {
+			summary += "; marked " + result.Status + queuedSummary(result.Queued)
+			action = models.ActivityStatusChanged
+		}
+		events = append(events, models.ActivityEvent{EntityType: models.ActivityOrder, EntityID: result.OrderID, Action: action, Summary: summary})
+		entries = append(entries, models.AuditEntry{
+			EntityType: models.ActivityOrder, EntityID: result.OrderID, Action: models.AuditUpdate,
+			Changes: models.DiffFields(result.Previous, result.TrackingImport),
+		})
+	}
+	if len(events) > 0 {
+		h.recordActivities(r, events...)
+	}
+	h.audit(r, entries...)
+
+	if wantsJSON(r) {
+		writeJSON(w, http.StatusOK, results)
+		return !failed
+	}
+	render(w, r, templates.TrackingImportResults(results, dryRun, token, notify))
+	return !failed
+}
+
+// TrackingImportTemplate downloads the tracking CSV with its columns and an example row to fill in
+func (h *Handler) TrackingImportTemplate(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	w.Header().Set("Content-Disposition", `attachment; filename="tracking-template.csv"`)
+	if err := importer.WriteTrackingTemplate(w); err != nil {
+		log.Printf("Error writing tracking import template: %v", err)
+	}
+}
@@ -0,0 +1,57 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/ngenohkevin/kuiper_admin/internal/jobs"
+	"github.com/ngenohkevin/kuiper_admin/internal/models"
+	"github.com/ngenohkevin/kuiper_admin/internal/templates"
+)
+
+// ListTrash handles the request to show every soft-deleted item
+func (h *Handler) ListTrash(w http.ResponseWriter, r *http.Request) {
+	items, err := models.GetTrashItems(h.db(r))
+	if err != nil {
+		writeFailure(w, r, "getting trash", err)
+		return
+	}
+
+	render(w, r, templates.TrashList(items, jobs.TrashRetention()))
+}
+
+// RestoreTrashItem handles the request to restore an item from the trash
+func (h *Handler) RestoreTrashItem(w http.ResponseWriter, r *http.Request) {
+	itemType := chi.URLParam(r, "type")
+	id := chi.URLParam(r, "id")
+	if itemType == "" || id == "" {
+		writeError(w, r, http.StatusBadRequest, "Missing item type or ID")
+		return
+	}
+
+	if err := models.RestoreTrashItem(h.db(r), itemType, id); err != nil {
+		writeFailure(w, r, "restoring "+itemType, err)
+		return
+	}
+
+	// For HTMX requests, just return 200 OK so the row is removed
+	w.WriteHeader(http.StatusOK)
+}
+
+// PurgeTrashItem handles the request to permanently delete an item from the trash
+func (h *Handler) PurgeTrashItem(w http.ResponseWriter, r *http.Request) {
+	itemType := chi.URLParam(r, "type")
+	id := chi.URLParam(r, "id")
+	if itemType == "" || id == "" {
+		writeError(w, r, http.StatusBadRequest, "Missing item type or ID")
+		return
+	}
+
+	if err := models.PurgeTrashItem(h.db(r), itemType, id); err != nil {
+		writeFailure(w, r, "purging "+itemType, err)
+		return
+	}
+
+	// For HTMX delete requests, just return 200 OK
+	w.WriteHeader(http.StatusOK)
+}
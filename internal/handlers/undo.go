@@ -0,0 +1,115 @@
+package handlers
+
+import (
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/ngenohkevin/kuiper_admin/internal/models"
+	"github.com/ngenohkevin/kuiper_admin/internal/templates"
+)
+
+// undoWindowSeconds is how long the "Undo" toast stays up after a delete.
+// Override with UNDO_WINDOW_SECONDS.
+func undoWindowSeconds() int {
+	if s := os.Getenv("UNDO_WINDOW_SECONDS"); s != "" {
+		if seconds, err := strconv.Atoi(s); err == nil && seconds > 0 {
+			return seconds
+		}
+	}
+	return 10
+}
+
+// writeUndoToast finishes an HTMX delete: the empty main response removes the target
+// element, and the toast is swapped out-of-band into the layout's toast container
+func writeUndoToast(w http.ResponseWriter, r *http.Request, message, undoURL string) {
+	w.WriteHeader(http.StatusOK)
+	if r.Header.Get("HX-Request") != "true" {
+		return
+	}
+	if err := templates.UndoToast(message, undoURL, undoWindowSeconds()).Render(r.Context(), w); err != nil {
+		log.Printf("Error rendering undo toast: %v", err)
+	}
+}
+
+// finishRestore reloads the current page for HTMX requests so the restored item
+// reappears where it was, or redirects other clients to fallback
+func finishRestore(w http.ResponseWriter, r *http.Request, fallback string) {
+	if r.Header.Get("HX-Request") == "true" {
+		w.Header().Set("HX-Refresh", "true")
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+	http.Redirect(w, r, fallback, http.StatusSeeOther)
+}
+
+// RestoreCategory handles the request to undo a category delete
+func (h *Handler) RestoreCategory(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	if id == "" {
+		writeError(w, r, http.StatusBadRequest, "Missing category ID")
+		return
+	}
+
+	if err := models.RestoreCategory(h.db(r), id); err != nil {
+		writeFailure(w, r, "restoring category", err)
+		return
+	}
+	h.recordActivity(r, models.ActivityCategory, id, models.ActivityRestored, "Restored from the trash")
+
+	finishRestore(w, r, "/categories")
+}
+
+// RestoreProduct handles the request to undo a product delete
+func (h *Handler) RestoreProduct(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	if id == "" {
+		writeError(w, r, http.StatusBadRequest, "Missing product ID")
+		return
+	}
+
+	if err := models.RestoreProduct(h.db(r), id); err != nil {
+		writeFailure(w, r, "restoring product", err)
+		return
+	}
+	h.recordActivity(r, models.ActivityProduct, id, models.ActivityRestored, "Restored from the trash")
+
+	finishRestore(w, r, "/products/"+id)
+}
+
+// RestoreProductVariant handles the request to undo a variant delete
+func (h *Handler) RestoreProductVariant(w http.ResponseWriter, r *http.Request) {
+	productID := chi.URLParam(r, "id")
+	variantID := chi.URLParam(r, "variantID")
+	if productID == "" || variantID == "" {
+		writeError(w, r, http.StatusBadRequest, "Missing product ID or variant ID")
+		return
+	}
+
+	if err := models.RestoreProductVariant(h.db(r), variantID); err != nil {
+		log.Printf("Error restoring product variant: %v", err)
+		writeFailure(w, r, "restoring product variant", err)
+		return
+	}
+
+	finishRestore(w, r, "/products/"+productID)
+}
+
+// RestoreReview handles the request to undo a review delete
+func (h *Handler) RestoreReview(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	if id == "" {
+		writeError(w, r, http.StatusBadRequest, "Missing review ID")
+		return
+	}
+
+	if err := models.RestoreReview(h.db(r), id); err != nil {
+		writeFailure(w, r, "restoring review", err)
+		return
+	}
+	h.recordActivity(r, models.ActivityReview, id, models.ActivityRestored, "Restored from the trash")
+
+	finishRestore(w, r, "/reviews/"+id)
+}
@@ -0,0 +1,63 @@
+package handlers
+
+import (
+	"net/http"
+	"net/url"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/ngenohkevin/kuiper_admin/internal/models"
+	"github.com/ngenohkevin/kuiper_admin/internal/templates"
+)
+
+// VariantReport lists the problems the background validator found in product variants
+func (h *Handler) VariantReport(w http.ResponseWriter, r *http.Request) {
+	issues, err := models.GetVariantReport(h.db(r))
+	if err != nil {
+		writeFailure(w, r, "getting variant report", err)
+		return
+	}
+
+	if wantsJSON(r) {
+		writeList(w, r, models.SinglePage(issues))
+		return
+	}
+
+	render(w, r, templates.VariantReport(issues, r.URL.Query().Get("error")))
+}
+
+// RefreshVariantReport validates the variants now instead of waiting for the next scheduled run
+func (h *Handler) RefreshVariantReport(w http.ResponseWriter, r *http.Request) {
+	if _, err := models.RebuildVariantReport(h.db(r)); err != nil {
+		writeFailure(w, r, "validating variants", err)
+		return
+	}
+
+	http.Redirect(w, r, "/settings/variant-report", http.StatusSeeOther)
+}
+
+// FixVariantIssue repairs one issue from the report
+func (h *Handler) FixVariantIssue(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	if id == "" {
+		writeError(w, r, http.StatusBadRequest, "Missing issue ID")
+		return
+	}
+
+	actor := h.Session.GetString(r.Context(), "username")
+	if err := models.FixVariantIssue(h.db(r), id, actor); err != nil {
+		// Stale issues are common after edits, so show the problem on the report rather than a bare error
+		if wantsJSON(r) {
+			writeFailure(w, r, "fixing variant issue", err)
+			return
+		}
+		http.Redirect(w, r, "/settings/variant-report?error="+url.QueryEscape(publicMessage(err, "fixing variant issue")), http.StatusSeeOther)
+		return
+	}
+
+	if r.Header.Get("HX-Request") == "true" {
+		// For HTMX requests, just return 200 OK so the row is removed
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+	http.Redirect(w, r, "/settings/variant-report", http.StatusSeeOther)
+}
@@ -0,0 +1,43 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+
+	"github.com/ngenohkevin/kuiper_admin/internal/models"
+	"github.com/ngenohkevin/kuiper_admin/internal/templates"
+)
+
+// VariantStorage compares every product's variants JSON with its product_variants rows, to
+// check the rows are safe to read from before changing VARIANT_STORAGE
+func (h *Handler) VariantStorage(w http.ResponseWriter, r *http.Request) {
+	report, err := models.VerifyVariantStorage(h.db(r))
+	if err != nil {
+		writeFailure(w, r, "verifying variant storage", err)
+		return
+	}
+
+	if wantsJSON(r) {
+		writeJSON(w, http.StatusOK, report)
+		return
+	}
+
+	render(w, r, templates.VariantStoragePage(report, r.URL.Query().Get("notice")))
+}
+
+// BackfillVariantStorage rebuilds every product's variant rows from its JSON
+func (h *Handler) BackfillVariantStorage(w http.ResponseWriter, r *http.Request) {
+	count, err := models.BackfillVariantRows(h.db(r))
+	if err != nil {
+		writeFailure(w, r, "backfilling variant rows", err)
+		return
+	}
+
+	if wantsJSON(r) {
+		writeJSON(w, http.StatusOK, map[string]int{"products": count})
+		return
+	}
+	notice := fmt.Sprintf("Rebuilt the variant rows of %d products.", count)
+	http.Redirect(w, r, "/settings/variant-storage?notice="+url.QueryEscape(notice), http.StatusSeeOther)
+}
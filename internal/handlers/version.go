@@ -0,0 +1,49 @@
+package handlers
+
+import (
+	"log"
+	"net/http"
+
+	"github.com/ngenohkevin/kuiper_admin/internal/database"
+	"github.com/ngenohkevin/kuiper_admin/internal/templates"
+	"github.com/ngenohkevin/kuiper_admin/internal/version"
+)
+
+// Healthz answers load balancers and uptime checks with the build running and whether the
+// database is reachable, 503 when it isn't. It needs no sign-in.
+func (h *Handler) Healthz(w http.ResponseWriter, r *http.Request) {
+	build := version.Get()
+	status, code := "ok", http.StatusOK
+
+	db := h.db(r)
+	ctx, cancel := db.Context(database.Read)
+	defer cancel()
+	if err := db.Pool.Ping(ctx); err != nil {
+		log.Printf("Health check: database unreachable: %v", err)
+		status, code = "unavailable", http.StatusServiceUnavailable
+	}
+
+	writeJSON(w, code, map[string]string{
+		"status":  status,
+		"version": build.Version,
+		"commit":  build.Revision,
+	})
+}
+
+// WhatsNew shows the changelog compiled into this build: as a panel over the page when opened
+// from the footer, or as a page of its own
+func (h *Handler) WhatsNew(w http.ResponseWriter, r *http.Request) {
+	releases := version.Changelog()
+
+	switch {
+	case wantsJSON(r):
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"build":    version.Get(),
+			"releases": releases,
+		})
+	case r.Header.Get("HX-Request") == "true":
+		render(w, r, templates.WhatsNewPanel(version.Get(), releases))
+	default:
+		render(w, r, templates.WhatsNew(version.Get(), releases))
+	}
+}
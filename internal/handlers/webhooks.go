@@ -0,0 +1,213 @@
+package handlers
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/ngenohkevin/kuiper_admin/internal/models"
+	"github.com/ngenohkevin/kuiper_admin/internal/money"
+)
+
+// maxWebhookBytes caps the size of an inbound webhook body
+const maxWebhookBytes = 1 << 20
+
+// Inbound webhook event types
+const (
+	eventExperimentConversion = "experiment.conversion"
+	eventOrderPlaced          = "order.placed"
+	eventSearchPerformed      = "search.performed"
+	eventWishlistAdded        = "wishlist.added"
+	eventWishlistRemoved      = "wishlist.removed"
+)
+
+// webhookEvent is an event the storefront reports. id is unique per event and stays the same
+// when a delivery is retried.
+type webhookEvent struct {
+	ID   string          `json:"id"`
+	Type string          `json:"type"`
+	Data json.RawMessage `json:"data"`
+}
+
+// conversionEvent is the data of an experiment.conversion event: a session in an experiment
+// converted, for example by placing an order worth revenue
+type conversionEvent struct {
+	ExperimentID string       `json:"experiment_id"`
+	SessionID    string       `json:"session_id"`
+	Revenue      money.Amount `json:"revenue"`
+}
+
+// orderEvent is the data of an order.placed event: the shopper holding session_token placed an
+// order worth total, made up of items. placed_at defaults to when the event arrives; items and
+// the customer's email and name may be left out by storefronts that don't send them.
+type orderEvent struct {
+	OrderID      string             `json:"order_id"`
+	SessionToken string             `json:"session_token"`
+	Total        money.Amount       `json:"total"`
+	PlacedAt     time.Time          `json:"placed_at"`
+	Items        []models.OrderItem `json:"items"`
+	models.OrderCustomer
+}
+
+// searchEvent is the data of a search.performed event: a shopper searched the storefront for
+// term and got result_count results, opening clicked_product_id from them if anything
+type searchEvent struct {
+	Term             string `json:"term"`
+	ResultCount      int    `json:"result_count"`
+	ClickedProductID string `json:"clicked_product_id"`
+}
+
+// wishlistEvent is the data of a wishlist.added or wishlist.removed event: the shopper holding
+// session_token saved product_id, or its variant_id, to their wishlist or took it off. added_at
+// defaults to when the event arrives.
+type wishlistEvent struct {
+	SessionToken string    `json:"session_token"`
+	ProductID    string    `json:"product_id"`
+	VariantID    string    `json:"variant_id"`
+	AddedAt      time.Time `json:"added_at"`
+}
+
+// validWebhookSignature checks the X-Webhook-Signature header, "sha256=" and the hex HMAC-SHA256
+// of the body keyed with the shared secret
+func validWebhookSignature(secret string, body []byte, header string) bool {
+	given, err := hex.DecodeString(strings.TrimPrefix(header, "sha256="))
+	if err != nil || !strings.HasPrefix(header, "sha256=") {
+		return false
+	}
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return hmac.Equal(given, mac.Sum(nil))
+}
+
+// webhookSecret is the secret the storefront signs its webhooks with: STOREFRONT_WEBHOOK_SECRET
+// for the main store, and on a tenant's subdomain the tenant's own from its store settings, so
+// one tenant's storefront can't send events to another
+func (h *Handler) webhookSecret(r *http.Request) (string, error) {
+	if _, ok := models.TenantFromContext(r.Context()); !ok {
+		return os.Getenv("STOREFRONT_WEBHOOK_SECRET"), nil
+	}
+	settings, err := models.GetStoreSettings(h.db(r))
+	return settings.WebhookSecret, err
+}
+
+// StorefrontWebhook receives events from the storefront, signed with its webhook secret. Each
+// event is handled once however often it is delivered; event types it doesn't know are accepted
+// and ignored so the sender doesn't keep retrying them.
+func (h *Handler) StorefrontWebhook(w http.ResponseWriter, r *http.Request) {
+	secret, err := h.webhookSecret(r)
+	if err != nil {
+		writeFailure(w, r, "getting webhook secret", err)
+		return
+	}
+	if secret == "" {
+		writeError(w, r, http.StatusServiceUnavailable, "Storefront webhooks aren't set up")
+		return
+	}
+
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxWebhookBytes+1))
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, "Error reading the request body")
+		return
+	}
+	if len(body) > maxWebhookBytes {
+		writeError(w, r, http.StatusRequestEntityTooLarge, "The event is too large")
+		return
+	}
+	if !validWebhookSignature(secret, body, r.Header.Get("X-Webhook-Signature")) {
+		writeError(w, r, http.StatusUnauthorized, "Invalid webhook signature")
+		return
+	}
+
+	var event webhookEvent
+	if err := json.Unmarshal(body, &event); err != nil {
+		writeError(w, r, http.StatusBadRequest, "Invalid JSON: expected id, type and data")
+		return
+	}
+
+	// handle applies the event once it is known to be new
+	var handle func() error
+	var action string
+	switch event.Type {
+	case eventExperimentConversion:
+		var conversion conversionEvent
+		if err := json.Unmarshal(event.Data, &conversion); err != nil || conversion.ExperimentID == "" || conversion.SessionID == "" {
+			writeError(w, r, http.StatusBadRequest, "Invalid conversion: expected experiment_id, session_id and revenue")
+			return
+		}
+		action = "recording conversion"
+		handle = func() error {
+			return models.RecordConversion(h.db(r), conversion.ExperimentID, conversion.SessionID, conversion.Revenue)
+		}
+	case eventOrderPlaced:
+		var order orderEvent
+		if err := json.Unmarshal(event.Data, &order); err != nil || order.OrderID == "" || order.SessionToken == "" {
+			writeError(w, r, http.StatusBadRequest, "Invalid order: expected order_id, session_token, total and placed_at")
+			return
+		}
+		action = "recording order"
+		handle = func() error {
+			return models.RecordStorefrontOrder(h.db(r), order.OrderID, order.SessionToken, order.OrderCustomer, order.Total, order.PlacedAt, order.Items)
+		}
+	case eventSearchPerformed:
+		var search searchEvent
+		if err := json.Unmarshal(event.Data, &search); err != nil || strings.TrimSpace(search.Term) == "" || search.ResultCount < 0 {
+			writeError(w, r, http.StatusBadRequest, "Invalid search: expected term and result_count")
+			return
+		}
+		action = "logging search"
+		handle = func() error {
+			_, err := models.LogSearch(h.db(r), models.SearchSourceStorefront, search.Term, search.ResultCount, search.ClickedProductID)
+			return err
+		}
+	case eventWishlistAdded, eventWishlistRemoved:
+		var item wishlistEvent
+		if err := json.Unmarshal(event.Data, &item); err != nil || item.SessionToken == "" || item.ProductID == "" {
+			writeError(w, r, http.StatusBadRequest, "Invalid wishlist item: expected session_token and product_id")
+			return
+		}
+		if event.Type == eventWishlistAdded {
+			action = "adding wishlist item"
+			handle = func() error {
+				return models.AddWishlistItem(h.db(r), item.SessionToken, item.ProductID, item.VariantID, item.AddedAt)
+			}
+		} else {
+			action = "removing wishlist item"
+			handle = func() error {
+				return models.RemoveWishlistItem(h.db(r), item.SessionToken, item.ProductID, item.VariantID)
+			}
+		}
+	default:
+		writeJSON(w, http.StatusOK, map[string]string{"status": "ignored"})
+		return
+	}
+
+	fresh, err := models.RecordWebhookEvent(h.db(r), event.ID, event.Type)
+	if err != nil {
+		writeFailure(w, r, "recording webhook event", err)
+		return
+	}
+	if !fresh {
+		writeJSON(w, http.StatusOK, map[string]string{"status": "duplicate"})
+		return
+	}
+
+	if err := handle(); err != nil {
+		// Let a retry try again, unless it can only fail the same way
+		if status, _ := classifyError(err); status >= http.StatusInternalServerError {
+			if err := models.ForgetWebhookEvent(h.db(r), event.ID); err != nil {
+				log.Printf("Error forgetting webhook event %s: %v", event.ID, err)
+			}
+		}
+		writeFailure(w, r, action, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]string{"status": "recorded"})
+}
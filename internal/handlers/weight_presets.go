@@ -0,0 +1,80 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/ngenohkevin/kuiper_admin/internal/models"
+	"github.com/ngenohkevin/kuiper_admin/internal/templates"
+)
+
+// WeightPresets shows the weight presets offered by the bulk variant creator
+func (h *Handler) WeightPresets(w http.ResponseWriter, r *http.Request) {
+	presets, err := models.GetWeightPresets(h.db(r))
+	if err != nil {
+		writeFailure(w, r, "getting weight presets", err)
+		return
+	}
+
+	if wantsJSON(r) {
+		writeList(w, r, models.SinglePage(presets))
+		return
+	}
+
+	categories, ok := h.loadCategories(w, r)
+	if !ok {
+		return
+	}
+
+	render(w, r, templates.WeightPresets(presets, categories, ""))
+}
+
+// CreateWeightPreset handles the request to add a weight preset, globally or for one category
+func (h *Handler) CreateWeightPreset(w http.ResponseWriter, r *http.Request) {
+	// Parse form
+	if err := r.ParseForm(); err != nil {
+		writeError(w, r, http.StatusBadRequest, "Invalid form data")
+		return
+	}
+
+	var categoryID *string
+	if id := r.FormValue("category_id"); id != "" {
+		categoryID = &id
+	}
+
+	_, err := models.CreateWeightPreset(h.db(r), r.FormValue("name"), r.FormValue("weights"), categoryID)
+	if err != nil {
+		// Show validation problems on the page rather than a bare error
+		presets, listErr := models.GetWeightPresets(h.db(r))
+		if listErr != nil {
+			writeFailure(w, r, "getting weight presets", listErr)
+			return
+		}
+		categories, ok := h.loadCategories(w, r)
+		if !ok {
+			return
+		}
+		w.WriteHeader(http.StatusUnprocessableEntity)
+		render(w, r, templates.WeightPresets(presets, categories, publicMessage(err, "creating weight preset")))
+		return
+	}
+
+	http.Redirect(w, r, "/settings/weight-presets", http.StatusSeeOther)
+}
+
+// DeleteWeightPreset handles the request to remove a weight preset
+func (h *Handler) DeleteWeightPreset(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	if id == "" {
+		writeError(w, r, http.StatusBadRequest, "Missing preset ID")
+		return
+	}
+
+	if err := models.DeleteWeightPreset(h.db(r), id); err != nil {
+		writeFailure(w, r, "deleting weight preset", err)
+		return
+	}
+
+	// For HTMX requests, just return 200 OK so the row is removed
+	w.WriteHeader(http.StatusOK)
+}
@@ -0,0 +1,70 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/ngenohkevin/kuiper_admin/internal/models"
+	"github.com/ngenohkevin/kuiper_admin/internal/templates"
+)
+
+// wishlistDefaultDays is how far back the wishlist report counts recent additions when the
+// admin doesn't say
+const wishlistDefaultDays = 30
+
+// wishlistParams reads the wishlist report's days and sort from the query
+func wishlistParams(r *http.Request) (int, string) {
+	days := wishlistDefaultDays
+	if d, err := strconv.Atoi(r.URL.Query().Get("days")); err == nil && d > 0 && d <= 3650 {
+		days = d
+	}
+	sort := r.URL.Query().Get("sort")
+	if !models.IsWishlistSort(sort) {
+		sort = models.WishlistSortWishlists
+	}
+	return days, sort
+}
+
+// Wishlists lists the products and variants shoppers have on their wishlists with the stock on
+// hand, with what was added in the last ?days= days, sorted by ?sort=
+func (h *Handler) Wishlists(w http.ResponseWriter, r *http.Request) {
+	days, sort := wishlistParams(r)
+	report, err := models.GetWishlists(h.db(r), days, sort)
+	if err != nil {
+		writeFailure(w, r, "getting wishlists", err)
+		return
+	}
+
+	if wantsJSON(r) {
+		writeJSON(w, http.StatusOK, report)
+		return
+	}
+
+	render(w, r, templates.Wishlists(report))
+}
+
+// ExportWishlists downloads the wishlist report as CSV, or as JSON with format=json
+func (h *Handler) ExportWishlists(w http.ResponseWriter, r *http.Request) {
+	days, sort := wishlistParams(r)
+	report, err := models.GetWishlists(h.db(r), days, sort)
+	if err != nil {
+		writeFailure(w, r, "exporting wishlists", err)
+		return
+	}
+
+	header := []string{"product_id", "name", "variant_id", "variant", "sku", "stock", "available", "wishlists", "recent", "shortfall", "last_added_at"}
+	out := newExportStream(w, r, "Wishlists", exportFilename("wishlists"), header, int64(len(report.Rows)))
+	for _, row := range report.Rows {
+		record := []string{
+			row.ProductID, csvText(row.ProductName), row.VariantID, csvText(row.VariantName), csvText(row.SKU),
+			strconv.Itoa(row.Stock), strconv.FormatBool(row.Available), strconv.Itoa(row.Wishlists),
+			strconv.Itoa(row.Recent), strconv.Itoa(row.Shortfall), row.LastAddedAt.UTC().Format(time.RFC3339),
+		}
+		if err := out.Write(record, row); err != nil {
+			out.Close(err)
+			return
+		}
+	}
+	out.Close(nil)
+}
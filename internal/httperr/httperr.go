@@ -0,0 +1,84 @@
+// Package httperr defines the error body every JSON response uses:
+//
+//	{"error": {"code": "validation_failed", "message": "...", "fields": {"rating": "..."}}}
+//
+// Clients branch on code, which is stable; message is for people and may change.
+package httperr
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+// Error codes
+const (
+	CodeInvalidRequest = "invalid_request"   // Malformed input, such as bad JSON or a missing parameter
+	CodeValidation     = "validation_failed" // Well-formed input that breaks a rule; see fields
+	CodeUnauthorized   = "unauthorized"
+	CodeForbidden      = "forbidden"
+	CodeNotFound       = "not_found"
+	CodeConflict       = "conflict"
+	CodeRateLimited    = "rate_limited"
+	CodeUnavailable    = "unavailable" // An upstream service or the database didn't answer
+	CodeInternal       = "internal_error"
+)
+
+// Error is an error as sent to clients
+type Error struct {
+	Status  int               `json:"-"`
+	Code    string            `json:"code"`
+	Message string            `json:"message"`
+	Fields  map[string]string `json:"fields,omitempty"` // Problems with individual input fields, by field name
+}
+
+func (e *Error) Error() string {
+	return e.Message
+}
+
+// New creates an error with the code that matches the HTTP status
+func New(status int, message string) *Error {
+	return &Error{Status: status, Code: CodeFor(status), Message: message}
+}
+
+// WithField adds a problem with one input field
+func (e *Error) WithField(field, problem string) *Error {
+	if e.Fields == nil {
+		e.Fields = make(map[string]string)
+	}
+	e.Fields[field] = problem
+	return e
+}
+
+// CodeFor returns the default error code for an HTTP status
+func CodeFor(status int) string {
+	switch status {
+	case http.StatusBadRequest:
+		return CodeInvalidRequest
+	case http.StatusUnprocessableEntity:
+		return CodeValidation
+	case http.StatusUnauthorized:
+		return CodeUnauthorized
+	case http.StatusForbidden:
+		return CodeForbidden
+	case http.StatusNotFound:
+		return CodeNotFound
+	case http.StatusConflict:
+		return CodeConflict
+	case http.StatusTooManyRequests:
+		return CodeRateLimited
+	case http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return CodeUnavailable
+	}
+	if status >= 500 {
+		return CodeInternal
+	}
+	return CodeInvalidRequest
+}
+
+// WriteJSON writes e as the JSON error body with its status
+func WriteJSON(w http.ResponseWriter, e *Error) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(e.Status)
+	json.NewEncoder(w).Encode(map[string]*Error{"error": e})
+}
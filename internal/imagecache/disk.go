@@ -0,0 +1,195 @@
+package imagecache
+
+import (
+	"container/list"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// diskStore keeps each image in dir as <key>.img, with what is known about it in <key>.json,
+// so the cache outlives restarts and can be larger than memory allows. Reading an image bumps
+// its modification time, which is how the least recently used are found again after a restart.
+type diskStore struct {
+	dir      string
+	mu       sync.Mutex
+	items    map[string]*list.Element
+	lru      *list.List // Front is most recently used
+	bytes    int64
+	maxBytes int64
+}
+
+// diskItem is what the LRU list holds for each image
+type diskItem struct {
+	key  string
+	size int64
+}
+
+// newDiskStore opens dir, creating it if needed, and indexes the images already in it
+func newDiskStore(dir string, maxBytes int64) (*diskStore, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	type found struct {
+		key     string
+		size    int64
+		modTime time.Time
+	}
+	var images []found
+	for _, de := range entries {
+		k, ok := strings.CutSuffix(de.Name(), ".img")
+		if !ok || de.IsDir() {
+			continue
+		}
+		info, err := de.Info()
+		if err != nil {
+			continue
+		}
+		images = append(images, found{key: k, size: info.Size(), modTime: info.ModTime()})
+	}
+	slices.SortFunc(images, func(a, b found) int { return a.modTime.Compare(b.modTime) })
+
+	s := &diskStore{dir: dir, items: make(map[string]*list.Element), lru: list.New(), maxBytes: maxBytes}
+	for _, img := range images {
+		s.items[img.key] = s.lru.PushFront(&diskItem{key: img.key, size: img.size})
+		s.bytes += img.size
+	}
+	s.mu.Lock()
+	s.evict()
+	s.mu.Unlock()
+	return s, nil
+}
+
+func (s *diskStore) path(key, ext string) string {
+	return filepath.Join(s.dir, key+ext)
+}
+
+func (s *diskStore) get(key string) (Entry, bool) {
+	s.mu.Lock()
+	el, ok := s.items[key]
+	if ok {
+		s.lru.MoveToFront(el)
+	}
+	s.mu.Unlock()
+	if !ok {
+		return Entry{}, false
+	}
+
+	var e Entry
+	meta, err := os.ReadFile(s.path(key, ".json"))
+	if err == nil {
+		err = json.Unmarshal(meta, &e)
+	}
+	if err == nil {
+		e.Data, err = os.ReadFile(s.path(key, ".img"))
+	}
+	if err != nil {
+		s.mu.Lock()
+		if el, ok := s.items[key]; ok {
+			s.remove(el)
+		}
+		s.mu.Unlock()
+		return Entry{}, false
+	}
+
+	now := time.Now()
+	os.Chtimes(s.path(key, ".img"), now, now)
+	return e, true
+}
+
+func (s *diskStore) put(key string, e Entry) {
+	meta, err := json.Marshal(e)
+	if err == nil {
+		err = writeFile(s.path(key, ".img"), e.Data)
+	}
+	if err == nil {
+		err = writeFile(s.path(key, ".json"), meta)
+	}
+	if err != nil {
+		// An image that can't be cached is fetched again next time
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if el, ok := s.items[key]; ok {
+		item := s.lru.Remove(el).(*diskItem)
+		s.bytes -= item.size
+	}
+	s.items[key] = s.lru.PushFront(&diskItem{key: key, size: int64(len(e.Data))})
+	s.bytes += int64(len(e.Data))
+	s.evict()
+}
+
+// writeFile writes data to a temporary file and renames it into place, so a reader never sees
+// half an image
+func writeFile(path string, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".tmp-*")
+	if err != nil {
+		return err
+	}
+	_, err = tmp.Write(data)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), path)
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return fmt.Errorf("error writing %s: %w", path, err)
+	}
+	return nil
+}
+
+// evict removes the least recently used images until the cache is within its limit. Callers
+// must hold the lock.
+func (s *diskStore) evict() {
+	for s.bytes > s.maxBytes && s.lru.Len() > 0 {
+		s.remove(s.lru.Back())
+	}
+}
+
+// remove deletes an image and its details. Callers must hold the lock.
+func (s *diskStore) remove(el *list.Element) {
+	item := s.lru.Remove(el).(*diskItem)
+	delete(s.items, item.key)
+	s.bytes -= item.size
+	os.Remove(s.path(item.key, ".img"))
+	os.Remove(s.path(item.key, ".json"))
+}
+
+func (s *diskStore) clear() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var errs []error
+	for el := s.lru.Front(); el != nil; el = el.Next() {
+		k := el.Value.(*diskItem).key
+		for _, ext := range []string{".img", ".json"} {
+			if err := os.Remove(s.path(k, ext)); err != nil && !os.IsNotExist(err) {
+				errs = append(errs, err)
+			}
+		}
+	}
+	s.items = make(map[string]*list.Element)
+	s.lru.Init()
+	s.bytes = 0
+	return errors.Join(errs...)
+}
+
+func (s *diskStore) size() (int, int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.items), s.bytes
+}
@@ -0,0 +1,188 @@
+// Package imagecache keeps the images the image proxy fetches, in memory or on disk, so a page
+// of product thumbnails doesn't download every image from its host again on each view. Images
+// are evicted least recently used first once the cache is full, and served until they are
+// older than the TTL, when the proxy checks them with their host again.
+package imagecache
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"log"
+	"os"
+	"strconv"
+	"sync/atomic"
+	"time"
+)
+
+// Backends
+const (
+	BackendMemory = "memory"
+	BackendDisk   = "disk"
+	BackendOff    = "off"
+)
+
+// Config is where images are cached and for how long
+type Config struct {
+	Dir      string        // Directory to keep images in; empty keeps them in memory
+	TTL      time.Duration // How long an image is served before it is checked with its host again
+	MaxBytes int64         // Most space the images may take; zero turns the cache off
+}
+
+// ConfigFromEnv reads the cache settings: IMAGE_CACHE_DIR (in memory when unset),
+// IMAGE_CACHE_TTL_MINUTES (1440) and IMAGE_CACHE_MAX_MB (256, 0 to turn the cache off)
+func ConfigFromEnv() Config {
+	cfg := Config{
+		Dir:      os.Getenv("IMAGE_CACHE_DIR"),
+		TTL:      24 * time.Hour,
+		MaxBytes: 256 << 20,
+	}
+	if minutes, err := strconv.Atoi(os.Getenv("IMAGE_CACHE_TTL_MINUTES")); err == nil && minutes > 0 {
+		cfg.TTL = time.Duration(minutes) * time.Minute
+	}
+	if mb, err := strconv.Atoi(os.Getenv("IMAGE_CACHE_MAX_MB")); err == nil && mb >= 0 {
+		cfg.MaxBytes = int64(mb) << 20
+	}
+	return cfg
+}
+
+// Entry is a cached image with what is needed to serve it and to check it with its host
+type Entry struct {
+	Data         []byte    `json:"-"`
+	ContentType  string    `json:"content_type"`
+	ETag         string    `json:"etag"`          // The proxy's own, a hash of Data
+	UpstreamETag string    `json:"upstream_etag"` // The host's validators, sent when checking a stale image
+	LastModified string    `json:"last_modified"`
+	FetchedAt    time.Time `json:"fetched_at"`
+}
+
+// Fresh reports whether the image can be served without checking with its host
+func (e Entry) Fresh(ttl time.Duration, now time.Time) bool {
+	return now.Sub(e.FetchedAt) < ttl
+}
+
+// ETag is the entity tag the proxy serves an image with, quoted
+func ETag(data []byte) string {
+	sum := sha256.Sum256(data)
+	return `"` + hex.EncodeToString(sum[:12]) + `"`
+}
+
+// Stats is a snapshot of the cache for the settings page
+type Stats struct {
+	Backend  string        `json:"backend"`
+	Dir      string        `json:"dir,omitempty"`
+	TTL      time.Duration `json:"ttl"`
+	Entries  int           `json:"entries"`
+	Bytes    int64         `json:"bytes"`
+	MaxBytes int64         `json:"max_bytes"`
+	Hits     uint64        `json:"hits"`
+	Misses   uint64        `json:"misses"`
+}
+
+// HitRatio is the fraction of lookups answered from the cache
+func (s Stats) HitRatio() float64 {
+	if s.Hits+s.Misses == 0 {
+		return 0
+	}
+	return float64(s.Hits) / float64(s.Hits+s.Misses)
+}
+
+// store is where the cached images are kept
+type store interface {
+	get(key string) (Entry, bool)
+	put(key string, e Entry)
+	clear() error
+	size() (entries int, bytes int64)
+}
+
+// Cache holds the images the proxy has fetched. It is safe for concurrent use.
+type Cache struct {
+	cfg     Config
+	backend string
+	store   store
+	hits    atomic.Uint64
+	misses  atomic.Uint64
+}
+
+// New creates the cache cfg describes. A directory that can't be used is logged and the images
+// are kept in memory instead.
+func New(cfg Config) *Cache {
+	c := &Cache{cfg: cfg}
+	switch {
+	case cfg.MaxBytes <= 0:
+		c.backend = BackendOff
+	case cfg.Dir != "":
+		disk, err := newDiskStore(cfg.Dir, cfg.MaxBytes)
+		if err == nil {
+			c.backend, c.store = BackendDisk, disk
+			break
+		}
+		log.Printf("Image cache can't use %s, keeping images in memory: %v", cfg.Dir, err)
+		c.cfg.Dir = ""
+		fallthrough
+	default:
+		c.backend, c.store = BackendMemory, newMemoryStore(cfg.MaxBytes)
+	}
+	return c
+}
+
+// TTL is how long an image is served before it is checked with its host again
+func (c *Cache) TTL() time.Duration {
+	return c.cfg.TTL
+}
+
+// key turns what the caller caches an image under into a fixed-length name
+func key(k string) string {
+	sum := sha256.Sum256([]byte(k))
+	return hex.EncodeToString(sum[:])
+}
+
+// Get returns the image cached under k, fresh or not
+func (c *Cache) Get(k string) (Entry, bool) {
+	if c.store == nil {
+		return Entry{}, false
+	}
+	e, ok := c.store.get(key(k))
+	if ok {
+		c.hits.Add(1)
+	} else {
+		c.misses.Add(1)
+	}
+	return e, ok
+}
+
+// Put caches an image under k and returns it with its ETag and, unless set, the time it was
+// fetched filled in. Images too large to fit a quarter of the cache aren't kept.
+func (c *Cache) Put(k string, e Entry) Entry {
+	e.ETag = ETag(e.Data)
+	if e.FetchedAt.IsZero() {
+		e.FetchedAt = time.Now()
+	}
+	if c.store != nil && int64(len(e.Data)) <= c.cfg.MaxBytes/4 {
+		c.store.put(key(k), e)
+	}
+	return e
+}
+
+// Clear removes every cached image
+func (c *Cache) Clear() error {
+	if c.store == nil {
+		return nil
+	}
+	return c.store.clear()
+}
+
+// Stats reports how full the cache is and how often it has been used
+func (c *Cache) Stats() Stats {
+	s := Stats{
+		Backend:  c.backend,
+		Dir:      c.cfg.Dir,
+		TTL:      c.cfg.TTL,
+		MaxBytes: c.cfg.MaxBytes,
+		Hits:     c.hits.Load(),
+		Misses:   c.misses.Load(),
+	}
+	if c.store != nil {
+		s.Entries, s.Bytes = c.store.size()
+	}
+	return s
+}
@@ -0,0 +1,72 @@
+package imagecache
+
+import (
+	"container/list"
+	"sync"
+)
+
+// memoryStore keeps images in memory, evicting the least recently used past maxBytes. They are
+// lost when the server restarts.
+type memoryStore struct {
+	mu       sync.Mutex
+	items    map[string]*list.Element
+	lru      *list.List // Front is most recently used
+	bytes    int64
+	maxBytes int64
+}
+
+// memoryItem is what the LRU list holds for each image
+type memoryItem struct {
+	key   string
+	entry Entry
+}
+
+func newMemoryStore(maxBytes int64) *memoryStore {
+	return &memoryStore{items: make(map[string]*list.Element), lru: list.New(), maxBytes: maxBytes}
+}
+
+func (s *memoryStore) get(key string) (Entry, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	el, ok := s.items[key]
+	if !ok {
+		return Entry{}, false
+	}
+	s.lru.MoveToFront(el)
+	return el.Value.(*memoryItem).entry, true
+}
+
+func (s *memoryStore) put(key string, e Entry) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if el, ok := s.items[key]; ok {
+		s.remove(el)
+	}
+	s.items[key] = s.lru.PushFront(&memoryItem{key: key, entry: e})
+	s.bytes += int64(len(e.Data))
+	for s.bytes > s.maxBytes && s.lru.Len() > 0 {
+		s.remove(s.lru.Back())
+	}
+}
+
+// remove unlinks an image. Callers must hold the lock.
+func (s *memoryStore) remove(el *list.Element) {
+	item := s.lru.Remove(el).(*memoryItem)
+	delete(s.items, item.key)
+	s.bytes -= int64(len(item.entry.Data))
+}
+
+func (s *memoryStore) clear() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.items = make(map[string]*list.Element)
+	s.lru.Init()
+	s.bytes = 0
+	return nil
+}
+
+func (s *memoryStore) size() (int, int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.items), s.bytes
+}
@@ -0,0 +1,37 @@
+package importer
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+)
+
+// maxDownloadSize caps the size of a downloaded feed
+const maxDownloadSize = 50 << 20 // 50 MB
+
+var downloadClient = &http.Client{Timeout: time.Minute}
+
+// Download fetches a remote feed. The caller must close the returned body.
+func Download(ctx context.Context, url string) (io.ReadCloser, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, fmt.Errorf("error creating feed request: %w", err)
+	}
+
+	resp, err := downloadClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("error downloading feed: %w", err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, fmt.Errorf("feed returned %s", resp.Status)
+	}
+
+	return struct {
+		io.Reader
+		io.Closer
+	}{io.LimitReader(resp.Body, maxDownloadSize), resp.Body}, nil
+}
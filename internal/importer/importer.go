@@ -0,0 +1,147 @@
+// Package importer reads product catalogs exported from other e-commerce
+// platforms and converts them into models.ProductImport values.
+package importer
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/ngenohkevin/kuiper_admin/internal/models"
+	"github.com/ngenohkevin/kuiper_admin/internal/money"
+)
+
+// Supported export formats
+const (
+	FormatAuto        = "auto"
+	FormatShopify     = "shopify"
+	FormatWooCommerce = "woocommerce"
+	FormatProducts    = "products" // The dashboard's own product CSV, see ProductColumns
+)
+
+// Parse reads a CSV export in the given format. FormatAuto picks the format from the header row.
+func Parse(format string, r io.Reader) ([]models.ProductImport, error) {
+	rows, err := readCSV(r)
+	if err != nil {
+		return nil, err
+	}
+
+	if format == FormatAuto || format == "" {
+		format = DetectFormat(rows.header)
+	}
+
+	switch format {
+	case FormatShopify:
+		return parseShopify(rows)
+	case FormatWooCommerce:
+		return parseWooCommerce(rows)
+	case FormatProducts:
+		return parseProducts(rows)
+	}
+	return nil, fmt.Errorf("unrecognised export format; expected a Shopify or WooCommerce product CSV, or the product CSV template")
+}
+
+// DetectFormat guesses the export format from a CSV header row
+func DetectFormat(header []string) string {
+	columns := make(map[string]bool, len(header))
+	for _, name := range header {
+		columns[strings.ToLower(strings.TrimSpace(name))] = true
+	}
+	switch {
+	case columns["handle"] && columns["variant price"]:
+		return FormatShopify
+	case columns["type"] && columns["regular price"]:
+		return FormatWooCommerce
+	case columns["name"] && columns["price"] && columns["category_slug"]:
+		return FormatProducts
+	}
+	return ""
+}
+
+// table is a parsed CSV with columns looked up by header name
+type table struct {
+	header  []string
+	index   map[string]int
+	records [][]string
+}
+
+// readCSV parses a CSV file, tolerating a UTF-8 byte order mark and ragged rows
+func readCSV(r io.Reader) (*table, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.LazyQuotes = true
+
+	records, err := reader.ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("error reading CSV: %w", err)
+	}
+	if len(records) == 0 {
+		return nil, fmt.Errorf("the file is empty")
+	}
+
+	header := records[0]
+	if len(header) > 0 {
+		header[0] = strings.TrimPrefix(header[0], "\ufeff")
+	}
+	t := &table{header: header, index: make(map[string]int, len(header)), records: records[1:]}
+	for i, name := range header {
+		t.index[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+	return t, nil
+}
+
+// get returns a record's value for a column, or "" when the column or value is missing
+func (t *table) get(record []string, column string) string {
+	i, ok := t.index[strings.ToLower(column)]
+	if !ok || i >= len(record) {
+		return ""
+	}
+	return strings.TrimSpace(record[i])
+}
+
+// parsePrice reads a price column; empty values are zero
+func parsePrice(s string) (money.Amount, error) {
+	if s == "" {
+		return 0, nil
+	}
+	price, err := money.Parse(s)
+	if err != nil || price < 0 {
+		return 0, fmt.Errorf("invalid price %q", s)
+	}
+	return price, nil
+}
+
+// parseStock reads a stock column; empty or negative values are zero
+func parseStock(s string) int {
+	stock, err := strconv.Atoi(strings.SplitN(s, ".", 2)[0])
+	if err != nil || stock < 0 {
+		return 0
+	}
+	return stock
+}
+
+var htmlTags = regexp.MustCompile(`<[^>]*>`)
+
+// stripHTML turns an HTML product description into plain text
+func stripHTML(s string) string {
+	s = strings.NewReplacer("<br>", "\n", "<br/>", "\n", "<br />", "\n", "</p>", "\n").Replace(s)
+	s = htmlTags.ReplaceAllString(s, "")
+	s = strings.NewReplacer("&amp;", "&", "&lt;", "<", "&gt;", ">", "&quot;", `"`, "&#39;", "'", "&nbsp;", " ").Replace(s)
+	return strings.TrimSpace(s)
+}
+
+// appendImage adds an image URL unless it is empty or already present
+func appendImage(images []string, url string) []string {
+	if url == "" {
+		return images
+	}
+	for _, existing := range images {
+		if existing == url {
+			return images
+		}
+	}
+	return append(images, url)
+}
@@ -0,0 +1,286 @@
+package importer
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/ngenohkevin/kuiper_admin/internal/models"
+)
+
+// Generic formats, read through a field mapping
+const (
+	FormatCSV  = "csv"
+	FormatJSON = "json"
+)
+
+// FeedFormats are the formats a scheduled feed can use. Shopify and WooCommerce
+// feeds are read as exports and ignore the field mapping.
+var FeedFormats = []string{FormatCSV, FormatJSON, FormatShopify, FormatWooCommerce}
+
+// IsFeedFormat reports whether format is one of FeedFormats
+func IsFeedFormat(format string) bool {
+	for _, f := range FeedFormats {
+		if f == format {
+			return true
+		}
+	}
+	return false
+}
+
+// ParseFeed reads a supplier feed in any of the FeedFormats
+func ParseFeed(format string, r io.Reader, mapping models.FieldMapping) ([]models.ProductImport, error) {
+	switch format {
+	case FormatCSV, FormatJSON:
+		return ParseMapped(format, r, mapping)
+	}
+	return Parse(format, r)
+}
+
+// MappableFields are the product fields a mapping can fill, each from a CSV column
+// or JSON key. Name and price are required.
+var MappableFields = []string{"name", "slug", "description", "price", "stock_count", "image_urls", "category", "is_available"}
+
+// FieldLabels are the names shown for MappableFields in the mapping form
+var FieldLabels = map[string]string{
+	"name":         "Name",
+	"slug":         "Slug",
+	"description":  "Description",
+	"price":        "Price",
+	"stock_count":  "Stock",
+	"image_urls":   "Image URLs",
+	"category":     "Category",
+	"is_available": "Available",
+}
+
+// fieldAliases are column names commonly used for each field, normalized to lowercase letters and digits
+var fieldAliases = map[string][]string{
+	"name":         {"name", "title", "productname", "product", "itemname"},
+	"slug":         {"slug", "handle", "urlkey"},
+	"description":  {"description", "body", "bodyhtml", "details", "longdescription"},
+	"price":        {"price", "retailprice", "saleprice", "regularprice", "unitprice", "cost"},
+	"stock_count":  {"stock", "stockcount", "qty", "quantity", "inventory", "stockquantity"},
+	"image_urls":   {"images", "image", "imageurl", "imageurls", "imagesrc", "photo", "photos"},
+	"category":     {"category", "categories", "type", "producttype", "collection"},
+	"is_available": {"available", "isavailable", "instock", "active", "published", "status"},
+}
+
+// ValidateMapping checks that a mapping only names known fields and covers name and price
+func ValidateMapping(mapping models.FieldMapping) error {
+	for field, source := range mapping {
+		if _, ok := FieldLabels[field]; !ok {
+			return fmt.Errorf("unknown field %q", field)
+		}
+		for _, key := range source.Transforms {
+			if _, ok := transformsByKey[key]; !ok {
+				return fmt.Errorf("unknown transform %q", key)
+			}
+		}
+	}
+	if mapping["name"].Column == "" || mapping["price"].Column == "" {
+		return fmt.Errorf("map a column to at least name and price")
+	}
+	return nil
+}
+
+// GuessMapping maps each field to the first column whose name matches one of its usual names
+func GuessMapping(columns []string) models.FieldMapping {
+	mapping := make(models.FieldMapping)
+	for _, field := range MappableFields {
+		for _, alias := range fieldAliases[field] {
+			for _, column := range columns {
+				if normalizeColumn(column) == alias {
+					mapping[field] = models.FieldSource{Column: column}
+					break
+				}
+			}
+			if _, ok := mapping[field]; ok {
+				break
+			}
+		}
+	}
+	if source, ok := mapping["price"]; ok {
+		source.Transforms = []string{TransformStripCurrency}
+		mapping["price"] = source
+	}
+	return mapping
+}
+
+func normalizeColumn(column string) string {
+	return strings.Map(func(r rune) rune {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			return unicode.ToLower(r)
+		}
+		return -1
+	}, column)
+}
+
+// Preview reads a CSV or JSON file and returns its columns and up to limit rows,
+// for the admin to map columns to product fields
+func Preview(format string, r io.Reader, limit int) ([]string, []map[string]string, error) {
+	columns, rows, err := readRows(format, r)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(rows) > limit {
+		rows = rows[:limit]
+	}
+	return columns, rows, nil
+}
+
+// readRows reads a CSV file with a header row or a JSON array of objects as rows keyed by column.
+// JSON columns are the keys seen across all objects, in order of first appearance.
+func readRows(format string, r io.Reader) ([]string, []map[string]string, error) {
+	switch format {
+	case FormatCSV:
+		t, err := readCSV(r)
+		if err != nil {
+			return nil, nil, err
+		}
+		columns := make([]string, 0, len(t.header))
+		for _, name := range t.header {
+			columns = append(columns, strings.TrimSpace(name))
+		}
+		rows := make([]map[string]string, 0, len(t.records))
+		for _, record := range t.records {
+			row := make(map[string]string, len(columns))
+			for _, column := range columns {
+				row[column] = t.get(record, column)
+			}
+			rows = append(rows, row)
+		}
+		return columns, rows, nil
+
+	case FormatJSON:
+		var items []orderedObject
+		if err := json.NewDecoder(r).Decode(&items); err != nil {
+			return nil, nil, fmt.Errorf("error reading JSON; expected an array of objects: %w", err)
+		}
+		var columns []string
+		seen := make(map[string]bool)
+		rows := make([]map[string]string, 0, len(items))
+		for _, item := range items {
+			for _, key := range item.keys {
+				if !seen[key] {
+					seen[key] = true
+					columns = append(columns, key)
+				}
+			}
+			rows = append(rows, item.values)
+		}
+		return columns, rows, nil
+	}
+	return nil, nil, fmt.Errorf("unknown format %q", format)
+}
+
+// orderedObject is a flat JSON object decoded with its key order, values rendered as text
+type orderedObject struct {
+	keys   []string
+	values map[string]string
+}
+
+func (o *orderedObject) UnmarshalJSON(data []byte) error {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	if tok, err := dec.Token(); err != nil || tok != json.Delim('{') {
+		return fmt.Errorf("expected an object")
+	}
+	o.values = make(map[string]string)
+	for dec.More() {
+		tok, err := dec.Token()
+		if err != nil {
+			return err
+		}
+		key := tok.(string)
+		var value interface{}
+		if err := dec.Decode(&value); err != nil {
+			return err
+		}
+		o.keys = append(o.keys, key)
+		o.values[key] = jsonString(value)
+	}
+	return nil
+}
+
+// ParseMapped reads a CSV file or JSON array of objects, taking each product field from
+// the column the mapping names after applying its transforms. Each row is one product
+// without variants; rows without a name are skipped.
+func ParseMapped(format string, r io.Reader, mapping models.FieldMapping) ([]models.ProductImport, error) {
+	if err := ValidateMapping(mapping); err != nil {
+		return nil, err
+	}
+
+	_, rows, err := readRows(format, r)
+	if err != nil {
+		return nil, err
+	}
+
+	products := make([]models.ProductImport, 0, len(rows))
+	for i, row := range rows {
+		value := func(field string) string {
+			source := mapping[field]
+			return applyTransforms(strings.TrimSpace(row[source.Column]), source.Transforms)
+		}
+		if value("name") == "" {
+			continue
+		}
+
+		price, err := parsePrice(value("price"))
+		if err != nil {
+			return nil, fmt.Errorf("row %d: %w", i+1, err)
+		}
+
+		p := models.ProductImport{
+			Name:        value("name"),
+			Slug:        value("slug"),
+			Description: stripHTML(value("description")),
+			Price:       price,
+			StockCount:  parseStock(value("stock_count")),
+			Category:    value("category"),
+			IsAvailable: true,
+		}
+		if source, ok := mapping["is_available"]; ok && source.Column != "" {
+			p.IsAvailable = parseBool(value("is_available"))
+		}
+		for _, url := range strings.FieldsFunc(value("image_urls"), func(r rune) bool { return r == ',' || r == '|' }) {
+			p.ImageURLs = appendImage(p.ImageURLs, strings.TrimSpace(url))
+		}
+		products = append(products, p)
+	}
+
+	return products, nil
+}
+
+// jsonString renders a decoded JSON value as feed text; arrays become comma-separated lists
+func jsonString(v interface{}) string {
+	switch value := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return value
+	case float64:
+		return strconv.FormatFloat(value, 'f', -1, 64)
+	case bool:
+		return strconv.FormatBool(value)
+	case []interface{}:
+		parts := make([]string, 0, len(value))
+		for _, item := range value {
+			parts = append(parts, jsonString(item))
+		}
+		return strings.Join(parts, ",")
+	}
+	encoded, _ := json.Marshal(v)
+	return string(encoded)
+}
+
+// parseBool accepts the usual spellings of yes and no found in supplier feeds
+func parseBool(s string) bool {
+	switch strings.ToLower(s) {
+	case "1", "true", "yes", "y", "instock", "in stock", "active", "published":
+		return true
+	}
+	return false
+}
@@ -0,0 +1,88 @@
+package importer
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/ngenohkevin/kuiper_admin/internal/models"
+	"github.com/ngenohkevin/kuiper_admin/internal/money"
+)
+
+// ProductColumns are the columns of the dashboard's own product CSV. Only name and price are
+// required; the rest may be left out of the header or empty.
+var ProductColumns = []string{"name", "slug", "price", "stock", "category_slug", "image_urls", "description", "is_available"}
+
+// productExample is the example row of the product CSV template
+var productExample = []string{
+	"Blue Dream (3.5g)", "blue-dream-3-5g", "35.00", "12", "flower",
+	"https://images.example.com/blue-dream.jpg|https://images.example.com/blue-dream-2.jpg",
+	"Sweet berry aroma.", "true",
+}
+
+// WriteProductTemplate writes an empty product CSV with one example row to fill in
+func WriteProductTemplate(w io.Writer) error {
+	writer := csv.NewWriter(w)
+	writer.Write(ProductColumns)
+	writer.Write(productExample)
+	writer.Flush()
+	return writer.Error()
+}
+
+// parseProducts reads the dashboard's own product CSV, one product per row. Unlike the
+// platform exports it is strict: a row with a bad price, stock or image URL is kept with the
+// problem noted, so the import reports it against its line instead of guessing.
+func parseProducts(t *table) ([]models.ProductImport, error) {
+	for _, column := range []string{"name", "price"} {
+		if _, ok := t.index[column]; !ok {
+			return nil, fmt.Errorf("the file has no %s column; download the template for the expected columns", column)
+		}
+	}
+
+	var products []models.ProductImport
+	for line, record := range t.records {
+		if strings.TrimSpace(strings.Join(record, "")) == "" {
+			continue
+		}
+
+		p := models.ProductImport{
+			Row:          line + 2,
+			Name:         t.get(record, "name"),
+			Slug:         t.get(record, "slug"),
+			Description:  t.get(record, "description"),
+			CategorySlug: t.get(record, "category_slug"),
+			IsAvailable:  true,
+		}
+		var problems []string
+
+		if p.Slug != "" && p.Slug != models.Slugify(p.Slug) {
+			problems = append(problems, fmt.Sprintf("slug %q may only hold lowercase letters, digits and dashes", p.Slug))
+		}
+		if s := t.get(record, "price"); s == "" {
+			problems = append(problems, "price is required")
+		} else if price, err := money.Parse(s); err != nil || price < 0 {
+			problems = append(problems, fmt.Sprintf("invalid price %q", s))
+		} else {
+			p.Price = price
+		}
+		if s := t.get(record, "stock"); s != "" {
+			stock, err := strconv.Atoi(s)
+			if err != nil || stock < 0 {
+				problems = append(problems, fmt.Sprintf("stock %q must be a whole number, zero or more", s))
+			}
+			p.StockCount = stock
+		}
+		if s := t.get(record, "is_available"); s != "" {
+			p.IsAvailable = parseBool(s)
+		}
+		for _, url := range strings.FieldsFunc(t.get(record, "image_urls"), func(r rune) bool { return r == '|' || r == ' ' || r == '\n' }) {
+			p.ImageURLs = appendImage(p.ImageURLs, url)
+		}
+
+		p.Invalid = strings.Join(problems, "; ")
+		products = append(products, p)
+	}
+	return products, nil
+}
@@ -0,0 +1,95 @@
+package importer
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/ngenohkevin/kuiper_admin/internal/models"
+)
+
+// parseShopify converts a Shopify product CSV export. Shopify writes one row per
+// variant or extra image, grouped by Handle; only the first row of a product carries
+// its title and description.
+func parseShopify(t *table) ([]models.ProductImport, error) {
+	var products []models.ProductImport
+	byHandle := make(map[string]int)
+
+	for line, record := range t.records {
+		handle := t.get(record, "Handle")
+		if handle == "" {
+			continue
+		}
+
+		i, ok := byHandle[handle]
+		if !ok {
+			status := strings.ToLower(t.get(record, "Status"))
+			products = append(products, models.ProductImport{
+				Name:        t.get(record, "Title"),
+				Slug:        handle,
+				Description: stripHTML(t.get(record, "Body (HTML)")),
+				Category:    firstNonEmpty(t.get(record, "Type"), t.get(record, "Product Type")),
+				IsAvailable: status == "active" || (status == "" && strings.EqualFold(t.get(record, "Published"), "true")),
+			})
+			i = len(products) - 1
+			byHandle[handle] = i
+		}
+		p := &products[i]
+
+		p.ImageURLs = appendImage(p.ImageURLs, t.get(record, "Image Src"))
+		p.ImageURLs = appendImage(p.ImageURLs, t.get(record, "Variant Image"))
+
+		// Image-only rows have no variant price
+		priceStr := t.get(record, "Variant Price")
+		if priceStr == "" {
+			continue
+		}
+		price, err := parsePrice(priceStr)
+		if err != nil {
+			return nil, fmt.Errorf("row %d (%s): %w", line+2, handle, err)
+		}
+		stock := parseStock(t.get(record, "Variant Inventory Qty"))
+
+		name := shopifyVariantName(t, record)
+		if name == "" {
+			// "Default Title" products have a single implicit variant: it is the product itself
+			p.Price = price
+			p.StockCount = stock
+			continue
+		}
+
+		if len(p.Variants) == 0 || price < p.Price {
+			p.Price = price
+		}
+		p.StockCount += stock
+		p.Variants = append(p.Variants, models.VariantImport{
+			Name:        name,
+			Price:       price,
+			StockCount:  stock,
+			IsAvailable: p.IsAvailable,
+		})
+	}
+
+	return products, nil
+}
+
+// shopifyVariantName joins the option values of a variant row, e.g. "3.5g / Indoor".
+// Products without options export a single "Default Title" option, which means no variants.
+func shopifyVariantName(t *table, record []string) string {
+	var values []string
+	for _, column := range []string{"Option1 Value", "Option2 Value", "Option3 Value"} {
+		if value := t.get(record, column); value != "" && value != "Default Title" {
+			values = append(values, value)
+		}
+	}
+	return strings.Join(values, " / ")
+}
+
+// firstNonEmpty returns the first non-empty value
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
@@ -0,0 +1,80 @@
+package importer
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/ngenohkevin/kuiper_admin/internal/models"
+)
+
+// TrackingColumns are the columns of the tracking number CSV. order_number and tracking_number
+// are required; carrier and status may be left out of the header or empty.
+var TrackingColumns = []string{"order_number", "tracking_number", "carrier", "status"}
+
+// trackingExample is the example row of the tracking number CSV template
+var trackingExample = []string{"1001", "1Z999AA10123456784", "UPS", "shipped"}
+
+// trackingAliases are the other names label tools and carriers give the tracking CSV's columns
+// in their exports, tried in order after the column's own name
+var trackingAliases = map[string][]string{
+	"order_number":    {"order", "order_id", "order id", "order number", "order #", "reference"},
+	"tracking_number": {"tracking", "tracking number", "tracking_code", "tracking code", "tracking #"},
+	"carrier":         {"courier", "carrier name"},
+	"status":          {"order_status", "order status"},
+}
+
+// WriteTrackingTemplate writes an empty tracking number CSV with one example row to fill in
+func WriteTrackingTemplate(w io.Writer) error {
+	writer := csv.NewWriter(w)
+	writer.Write(TrackingColumns)
+	writer.Write(trackingExample)
+	writer.Flush()
+	return writer.Error()
+}
+
+// ParseTracking reads a tracking number CSV, one order per row. Rows are kept as they are, so
+// the import reports a missing value against its line.
+func ParseTracking(r io.Reader) ([]models.TrackingImport, error) {
+	t, err := readCSV(r)
+	if err != nil {
+		return nil, err
+	}
+
+	columns := make(map[string]string, len(TrackingColumns))
+	for _, column := range TrackingColumns {
+		for _, name := range append([]string{column}, trackingAliases[column]...) {
+			if _, ok := t.index[name]; ok {
+				columns[column] = name
+				break
+			}
+		}
+	}
+	for _, column := range []string{"order_number", "tracking_number"} {
+		if _, ok := columns[column]; !ok {
+			return nil, fmt.Errorf("the file has no %s column; download the template for the expected columns", column)
+		}
+	}
+	get := func(record []string, column string) string {
+		if name, ok := columns[column]; ok {
+			return t.get(record, name)
+		}
+		return ""
+	}
+
+	var rows []models.TrackingImport
+	for line, record := range t.records {
+		if strings.TrimSpace(strings.Join(record, "")) == "" {
+			continue
+		}
+		rows = append(rows, models.TrackingImport{
+			Row:            line + 2,
+			OrderID:        strings.TrimPrefix(get(record, "order_number"), "#"),
+			TrackingNumber: get(record, "tracking_number"),
+			Carrier:        get(record, "carrier"),
+			Status:         get(record, "status"),
+		})
+	}
+	return rows, nil
+}
@@ -0,0 +1,87 @@
+package importer
+
+import (
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/ngenohkevin/kuiper_admin/internal/money"
+)
+
+// Transforms that can be applied to a mapped column's value
+const (
+	TransformStripCurrency = "strip_currency"
+	TransformCentsToUnits  = "cents_to_units"
+	TransformStripHTML     = "strip_html"
+	TransformTitleCase     = "title_case"
+	TransformLowercase     = "lowercase"
+)
+
+// Transform is a named clean-up step for imported values
+type Transform struct {
+	Key   string
+	Label string
+	apply func(string) string
+}
+
+// Transforms lists the available transforms in the order the mapping form shows them
+var Transforms = []Transform{
+	{TransformStripCurrency, `Strip currency symbol ("KSh 1,200" → 1200)`, stripCurrency},
+	{TransformCentsToUnits, "Convert cents to units (1250 → 12.50)", centsToUnits},
+	{TransformStripHTML, "Strip HTML tags", stripHTML},
+	{TransformTitleCase, "Title Case", titleCase},
+	{TransformLowercase, "lowercase", strings.ToLower},
+}
+
+var transformsByKey = func() map[string]Transform {
+	byKey := make(map[string]Transform, len(Transforms))
+	for _, t := range Transforms {
+		byKey[t.Key] = t
+	}
+	return byKey
+}()
+
+// applyTransforms runs the transforms in order; unknown keys are ignored
+func applyTransforms(value string, keys []string) string {
+	for _, key := range keys {
+		if t, ok := transformsByKey[key]; ok {
+			value = strings.TrimSpace(t.apply(value))
+		}
+	}
+	return value
+}
+
+// stripCurrency keeps only the number in a price like "$1,299.00" or "1 200 KES".
+// A comma followed by exactly two digits at the end is read as a decimal comma, e.g. "1.299,00 €".
+func stripCurrency(s string) string {
+	s = strings.Map(func(r rune) rune {
+		if unicode.IsDigit(r) || r == '.' || r == ',' || r == '-' {
+			return r
+		}
+		return -1
+	}, s)
+	if i := strings.LastIndex(s, ","); i >= 0 && i == len(s)-3 && i > strings.LastIndex(s, ".") {
+		s = strings.ReplaceAll(s[:i], ".", "") + "." + s[i+1:]
+	}
+	return strings.ReplaceAll(s, ",", "")
+}
+
+// centsToUnits divides a whole number of cents by 100; other values are left alone
+func centsToUnits(s string) string {
+	cents, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		return s
+	}
+	return money.Amount(cents).String()
+}
+
+// titleCase capitalises the first letter of every word and lowercases the rest
+func titleCase(s string) string {
+	words := strings.Fields(strings.ToLower(s))
+	for i, word := range words {
+		runes := []rune(word)
+		runes[0] = unicode.ToUpper(runes[0])
+		words[i] = string(runes)
+	}
+	return strings.Join(words, " ")
+}
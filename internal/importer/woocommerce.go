@@ -0,0 +1,124 @@
+package importer
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/ngenohkevin/kuiper_admin/internal/models"
+)
+
+// parseWooCommerce converts a WooCommerce product CSV export. Simple and variable
+// products have their own rows; variations follow with a Parent column of
+// "id:<parent ID>" or the parent's SKU.
+func parseWooCommerce(t *table) ([]models.ProductImport, error) {
+	var products []models.ProductImport
+	byParent := make(map[string]int)
+
+	type variation struct {
+		line   int
+		record []string
+	}
+	var variations []variation
+
+	for line, record := range t.records {
+		switch strings.ToLower(t.get(record, "Type")) {
+		case "variation":
+			// Parents may come after their variations, so attach them once every product is known
+			variations = append(variations, variation{line, record})
+			continue
+		case "grouped", "external":
+			continue
+		}
+
+		name := t.get(record, "Name")
+		if name == "" {
+			continue
+		}
+		price, err := parsePrice(wooPrice(t, record))
+		if err != nil {
+			return nil, fmt.Errorf("row %d (%s): %w", line+2, name, err)
+		}
+
+		p := models.ProductImport{
+			Name:        name,
+			Slug:        models.Slugify(name),
+			Description: stripHTML(firstNonEmpty(t.get(record, "Description"), t.get(record, "Short description"))),
+			Price:       price,
+			StockCount:  parseStock(t.get(record, "Stock")),
+			IsAvailable: t.get(record, "Published") == "1" && t.get(record, "In stock?") != "0",
+			Category:    wooCategory(t.get(record, "Categories")),
+		}
+		for _, url := range strings.Split(t.get(record, "Images"), ",") {
+			p.ImageURLs = appendImage(p.ImageURLs, strings.TrimSpace(url))
+		}
+
+		products = append(products, p)
+		if id := t.get(record, "ID"); id != "" {
+			byParent["id:"+id] = len(products) - 1
+		}
+		if sku := t.get(record, "SKU"); sku != "" {
+			byParent[sku] = len(products) - 1
+		}
+	}
+
+	for _, v := range variations {
+		parent := t.get(v.record, "Parent")
+		i, ok := byParent[parent]
+		if !ok {
+			return nil, fmt.Errorf("row %d: variation parent %q not found in the file", v.line+2, parent)
+		}
+		price, err := parsePrice(wooPrice(t, v.record))
+		if err != nil {
+			return nil, fmt.Errorf("row %d: %w", v.line+2, err)
+		}
+
+		p := &products[i]
+		if len(p.Variants) == 0 {
+			// A variable product's own stock is the sum of its variations
+			p.StockCount = 0
+			p.Price = price
+		}
+		stock := parseStock(t.get(v.record, "Stock"))
+		if price < p.Price {
+			p.Price = price
+		}
+		p.StockCount += stock
+		p.Variants = append(p.Variants, models.VariantImport{
+			Name:        wooVariationName(t, v.record),
+			Price:       price,
+			StockCount:  stock,
+			IsAvailable: t.get(v.record, "Published") != "-1" && t.get(v.record, "In stock?") != "0",
+		})
+		for _, url := range strings.Split(t.get(v.record, "Images"), ",") {
+			p.ImageURLs = appendImage(p.ImageURLs, strings.TrimSpace(url))
+		}
+	}
+
+	return products, nil
+}
+
+// wooPrice prefers the sale price when one is set
+func wooPrice(t *table, record []string) string {
+	return firstNonEmpty(t.get(record, "Sale price"), t.get(record, "Regular price"))
+}
+
+// wooCategory takes the deepest level of the first category, e.g. "Flowers > Indica, Sale" gives "Indica"
+func wooCategory(categories string) string {
+	first := strings.TrimSpace(strings.SplitN(categories, ",", 2)[0])
+	levels := strings.Split(first, ">")
+	return strings.TrimSpace(levels[len(levels)-1])
+}
+
+// wooVariationName joins a variation's attribute values, falling back to its own name
+func wooVariationName(t *table, record []string) string {
+	var values []string
+	for n := 1; n <= 3; n++ {
+		if value := t.get(record, fmt.Sprintf("Attribute %d value(s)", n)); value != "" {
+			values = append(values, value)
+		}
+	}
+	if len(values) > 0 {
+		return strings.Join(values, " / ")
+	}
+	return t.get(record, "Name")
+}
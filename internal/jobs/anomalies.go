@@ -0,0 +1,43 @@
+package jobs
+
+import (
+	"context"
+	"log"
+
+	"github.com/ngenohkevin/kuiper_admin/internal/chat"
+	"github.com/ngenohkevin/kuiper_admin/internal/database"
+	"github.com/ngenohkevin/kuiper_admin/internal/models"
+)
+
+// DetectAnomalies returns a job that raises a notification for each burst of changes past the
+// alert thresholds, and posts it to the chat webhook when one is set. The webhook is the main
+// store's, so a tenant's alerts stay in its own notification center. The same anomaly isn't
+// raised again until a window has passed, and a failed chat post is logged, not retried: the
+// notification center still has it.
+func DetectAnomalies(db *database.DB, thresholds models.AnomalyThresholds, chatConfig chat.Config) func(ctx context.Context) error {
+	return func(ctx context.Context) error {
+		anomalies, err := models.DetectAnomalies(db, thresholds)
+		if err != nil {
+			return err
+		}
+
+		for _, a := range anomalies {
+			n, raised, err := models.RaiseNotification(db, a.Notification, a.Key, thresholds.Window)
+			if err != nil {
+				return err
+			}
+			if !raised || !chatConfig.Enabled() || db.Schema != "" {
+				continue
+			}
+			if err := chatConfig.Post(ctx, chatMessage(n)); err != nil {
+				log.Printf("Error posting %s alert to chat: %v", n.Kind, err)
+			}
+		}
+		return nil
+	}
+}
+
+// chatMessage is a notification as a chat message
+func chatMessage(n models.Notification) string {
+	return "Alert: " + n.Title + "\n" + n.Body
+}
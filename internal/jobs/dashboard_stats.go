@@ -0,0 +1,29 @@
+package jobs
+
+import (
+	"context"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/ngenohkevin/kuiper_admin/internal/database"
+	"github.com/ngenohkevin/kuiper_admin/internal/models"
+)
+
+// DashboardStatsInterval is how often the home page counts are worked out again.
+// Override with DASHBOARD_STATS_REFRESH_MINUTES.
+func DashboardStatsInterval() time.Duration {
+	if s := os.Getenv("DASHBOARD_STATS_REFRESH_MINUTES"); s != "" {
+		if minutes, err := strconv.Atoi(s); err == nil && minutes > 0 {
+			return time.Duration(minutes) * time.Minute
+		}
+	}
+	return 5 * time.Minute
+}
+
+// RefreshDashboardStats returns a job that recounts the home page stats into their table
+func RefreshDashboardStats(db *database.DB) func(ctx context.Context) error {
+	return func(ctx context.Context) error {
+		return models.RefreshDashboardStats(db)
+	}
+}
@@ -0,0 +1,49 @@
+package jobs
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/ngenohkevin/kuiper_admin/internal/database"
+	"github.com/ngenohkevin/kuiper_admin/internal/mailer"
+	"github.com/ngenohkevin/kuiper_admin/internal/models"
+)
+
+// SendDigests returns a job that emails each admin whose digest is due a summary of the catalog
+// changes since their last one. A quiet period sends nothing but still counts as sent, and a
+// failed send is tried again on the next run.
+func SendDigests(db *database.DB, mail mailer.Config) func(ctx context.Context) error {
+	return func(ctx context.Context) error {
+		subs, err := models.GetDigestSubscriptions(db)
+		if err != nil {
+			return err
+		}
+
+		now := time.Now()
+		for _, sub := range subs {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			if !sub.Due(now) {
+				continue
+			}
+
+			digest, err := models.BuildDigest(db, sub.Since(now), now)
+			if err != nil {
+				return err
+			}
+			if !digest.Empty() {
+				subject := "Catalog changes: " + sub.Frequency + " digest"
+				if err := mail.Send(sub.Email, subject, digest.Text()); err != nil {
+					log.Printf("Error sending digest to %s: %v", sub.Username, err)
+					continue
+				}
+			}
+			if err := models.MarkDigestSent(db, sub.Username, now); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
@@ -0,0 +1,89 @@
+package jobs
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/ngenohkevin/kuiper_admin/internal/database"
+	"github.com/ngenohkevin/kuiper_admin/internal/models"
+)
+
+// Limits on how much image hashing one duplicate detection run does
+const (
+	imagesPerRun  = 100
+	maxImageBytes = 20 << 20 // 20 MB
+)
+
+var imageClient = &http.Client{Timeout: 10 * time.Second}
+
+// DetectDuplicates returns a job that hashes new product images and rebuilds the duplicate report
+func DetectDuplicates(db *database.DB) func(ctx context.Context) error {
+	return func(ctx context.Context) error {
+		urls, err := models.GetUnhashedImageURLs(db, imagesPerRun)
+		if err != nil {
+			return err
+		}
+
+		for _, url := range urls {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+
+			hash, err := hashImage(ctx, db, url)
+			if err != nil {
+				// Stored as empty so a broken link isn't refetched on every run
+				log.Printf("Could not hash image %s: %v", url, err)
+			}
+			if err := models.SaveImageHash(db, url, hash); err != nil {
+				return err
+			}
+		}
+
+		found, err := models.RebuildDuplicateReport(db)
+		if err != nil {
+			return err
+		}
+		if found > 0 {
+			log.Printf("Duplicate report found %d groups of likely duplicate products", found)
+		}
+		return nil
+	}
+}
+
+// hashImage downloads an image, with the headers its host's image proxy profile sets, and
+// returns the hex SHA-256 of its content
+func hashImage(ctx context.Context, db *database.DB, url string) (string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return "", fmt.Errorf("invalid URL: %w", err)
+	}
+	profile, err := models.GetImageProxyProfile(db, req.URL.Hostname())
+	if err != nil {
+		log.Printf("Error getting image proxy profile for %s: %v", req.URL.Hostname(), err)
+	}
+	profile.Apply(req)
+
+	client := *imageClient
+	client.CheckRedirect = profile.CheckRedirect
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+
+	hasher := sha256.New()
+	if _, err := io.Copy(hasher, io.LimitReader(resp.Body, maxImageBytes)); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hasher.Sum(nil)), nil
+}
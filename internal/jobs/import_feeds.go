@@ -0,0 +1,62 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+
+	"github.com/ngenohkevin/kuiper_admin/internal/database"
+	"github.com/ngenohkevin/kuiper_admin/internal/importer"
+	"github.com/ngenohkevin/kuiper_admin/internal/models"
+)
+
+// ImportFeeds returns a job that runs every enabled feed whose interval has passed.
+// It is meant to be scheduled more often than any feed interval, e.g. every minute.
+func ImportFeeds(db *database.DB) func(ctx context.Context) error {
+	return func(ctx context.Context) error {
+		feeds, err := models.GetDueImportFeeds(db)
+		if err != nil {
+			return err
+		}
+
+		var errs []error
+		for _, feed := range feeds {
+			if err := RunImportFeed(ctx, db, feed); err != nil {
+				errs = append(errs, fmt.Errorf("feed %s: %w", feed.Name, err))
+			}
+		}
+		return errors.Join(errs...)
+	}
+}
+
+// RunImportFeed downloads and imports one feed, recording the run and its diff report
+func RunImportFeed(ctx context.Context, db *database.DB, feed models.ImportFeed) error {
+	run, err := models.StartImportRun(db, feed.ID)
+	if err != nil {
+		return err
+	}
+
+	products, importErr := fetchFeed(ctx, feed)
+	if importErr != nil {
+		run.Error = importErr.Error()
+	} else {
+		run.Results = models.ImportProducts(db, products, false)
+	}
+
+	if err := models.FinishImportRun(db, run); err != nil {
+		log.Printf("Error recording import run: %v", err)
+	}
+	return importErr
+}
+
+// fetchFeed downloads a feed and parses it with its format and field mapping
+func fetchFeed(ctx context.Context, feed models.ImportFeed) ([]models.ProductImport, error) {
+	body, err := importer.Download(ctx, feed.URL)
+	if err != nil {
+		return nil, err
+	}
+	defer body.Close()
+
+	return importer.ParseFeed(feed.Format, body, feed.FieldMapping)
+}
@@ -0,0 +1,32 @@
+package jobs
+
+import (
+	"context"
+	"log"
+	"time"
+)
+
+// Every runs fn once at startup and then on every tick of interval until ctx is cancelled.
+// Errors are logged; a failing run doesn't stop later ones. Each run is shown on the jobs page.
+func Every(ctx context.Context, name string, interval time.Duration, fn func(ctx context.Context) error) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			started := time.Now()
+			scheduleStarted(name, interval)
+			err := fn(ctx)
+			scheduleFinished(name, started, err)
+			if err != nil {
+				log.Printf("Job %s failed: %v", name, err)
+			}
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
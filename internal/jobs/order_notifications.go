@@ -0,0 +1,117 @@
+package jobs
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/ngenohkevin/kuiper_admin/internal/database"
+	"github.com/ngenohkevin/kuiper_admin/internal/mailer"
+	"github.com/ngenohkevin/kuiper_admin/internal/models"
+	"github.com/ngenohkevin/kuiper_admin/internal/storefront"
+)
+
+// orderNotificationBatch is how many notifications one run sends at most
+const orderNotificationBatch = 50
+
+// orderStatusChanged is the type of the event sent to the storefront
+const orderStatusChanged = "order.status_changed"
+
+// orderStatusEvent is the data of an order.status_changed event: the order moved from
+// previous_status to status, and subject and body are what the status's template rendered
+type orderStatusEvent struct {
+	OrderID        string    `json:"order_id"`
+	Status         string    `json:"status"`
+	PreviousStatus string    `json:"previous_status"`
+	CustomerEmail  string    `json:"customer_email"`
+	CustomerName   string    `json:"customer_name"`
+	Carrier        string    `json:"carrier"`
+	TrackingNumber string    `json:"tracking_number"`
+	Subject        string    `json:"subject"`
+	Body           string    `json:"body"`
+	ChangedAt      time.Time `json:"changed_at"`
+}
+
+// OrderNotificationChannels is how a store sends its order notifications: mail and hook, from
+// the environment, for the main store, and for a tenant the same SMTP server with the sender,
+// notification URL and webhook secret from its store settings
+func OrderNotificationChannels(db *database.DB, mail mailer.Config, hook storefront.Config) (mailer.Config, storefront.Config, error) {
+	if db.Schema == "" {
+		return mail, hook, nil
+	}
+	settings, err := models.GetStoreSettings(db)
+	if err != nil {
+		return mailer.Config{}, storefront.Config{}, err
+	}
+	mail.From = settings.MailFrom
+	return mail, storefront.Config{NotifyURL: settings.NotifyURL, Secret: settings.WebhookSecret}, nil
+}
+
+// SendOrderNotifications returns a job that sends the customer notifications order status
+// changes queued, by email or to the storefront. A tenant's go to the endpoint and from the
+// sender in its store settings, signed with its own webhook secret, never to the main store's.
+// A failed send is tried again on a later run; one whose channel isn't set up is logged as
+// skipped, saying what to set.
+func SendOrderNotifications(db *database.DB, mail mailer.Config, hook storefront.Config) func(ctx context.Context) error {
+	setEmail, setHook := "set SMTP_HOST and MAIL_FROM", "set STOREFRONT_NOTIFY_URL"
+	if db.Schema != "" {
+		setEmail, setHook = "set SMTP_HOST, and the sender under Settings → Store", "set it under Settings → Store"
+	}
+
+	return func(ctx context.Context) error {
+		due, err := models.DueOrderNotifications(db, orderNotificationBatch)
+		if err != nil || len(due) == 0 {
+			return err
+		}
+
+		mail, hook, err := OrderNotificationChannels(db, mail, hook)
+		if err != nil {
+			return err
+		}
+
+		for _, n := range due {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+
+			var skip string
+			switch {
+			case n.Channel == models.OrderNotifyEmail && !mail.Enabled():
+				skip = "Email isn't set up: " + setEmail
+			case n.Channel == models.OrderNotifyEmail && n.Recipient == "":
+				skip = "The storefront didn't send the customer's email"
+			case n.Channel == models.OrderNotifyWebhook && !hook.Enabled():
+				skip = "The storefront's notification endpoint isn't set up: " + setHook
+			}
+			if skip != "" {
+				if err := models.MarkOrderNotificationSkipped(db, n.ID, skip); err != nil {
+					return err
+				}
+				continue
+			}
+
+			var sendErr error
+			if n.Channel == models.OrderNotifyEmail {
+				sendErr = mail.Send(n.Recipient, n.Subject, n.Body)
+			} else {
+				sendErr = hook.Send(ctx, storefront.Event{ID: n.ID, Type: orderStatusChanged, Data: orderStatusEvent{
+					OrderID: n.OrderID, Status: n.Status, PreviousStatus: n.PreviousStatus,
+					CustomerEmail: n.Recipient, CustomerName: n.CustomerName,
+					Carrier: n.Carrier, TrackingNumber: n.TrackingNumber,
+					Subject: n.Subject, Body: n.Body, ChangedAt: n.CreatedAt,
+				}})
+			}
+
+			if sendErr != nil {
+				log.Printf("Error sending %s notification for order %s: %v", n.Channel, n.OrderID, sendErr)
+				err = models.MarkOrderNotificationFailed(db, n.ID, sendErr)
+			} else {
+				err = models.MarkOrderNotificationSent(db, n.ID)
+			}
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
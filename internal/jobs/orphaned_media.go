@@ -0,0 +1,54 @@
+package jobs
+
+import (
+	"context"
+	"log"
+
+	"github.com/ngenohkevin/kuiper_admin/internal/database"
+	"github.com/ngenohkevin/kuiper_admin/internal/media"
+	"github.com/ngenohkevin/kuiper_admin/internal/models"
+)
+
+// orphanedMediaBatch is how many images one run of the media cleanup deletes
+const orphanedMediaBatch = 100
+
+// RemoveOrphanedMedia returns a job that deletes uploaded images from storage once no product
+// or banner uses them, such as those of purged products. An image another store still uses is
+// taken off the queue but kept. Failed deletes are retried on later runs.
+func RemoveOrphanedMedia(db *database.DB, mediaCfg media.Config) func(ctx context.Context) error {
+	return func(ctx context.Context) error {
+		urls, err := models.TakeOrphanedMedia(db, orphanedMediaBatch)
+		if err != nil {
+			return err
+		}
+
+		removed := 0
+		for _, url := range urls {
+			if media.IsUpload(mediaCfg, url) {
+				elsewhere, err := models.MediaUsedByOtherStores(db, url)
+				if err != nil {
+					return err
+				}
+				if elsewhere {
+					if err := models.FinishOrphanedMedia(db, url, nil); err != nil {
+						return err
+					}
+					continue
+				}
+			}
+			removeErr := media.Remove(ctx, mediaCfg, url)
+			if removeErr != nil {
+				log.Printf("Error removing orphaned image %s: %v", url, removeErr)
+			} else if media.IsUpload(mediaCfg, url) {
+				removed++
+			}
+			if err := models.FinishOrphanedMedia(db, url, removeErr); err != nil {
+				return err
+			}
+		}
+		if removed > 0 {
+			log.Printf("Removed %d orphaned images from storage", removed)
+		}
+		return nil
+	}
+}
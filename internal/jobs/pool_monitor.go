@@ -0,0 +1,21 @@
+package jobs
+
+import (
+	"context"
+	"log"
+
+	"github.com/ngenohkevin/kuiper_admin/internal/database"
+)
+
+// MonitorPool returns a job that samples the database connection pool and logs intervals where
+// getting a connection was slow or given up on
+func MonitorPool(db *database.DB) func(ctx context.Context) error {
+	return func(ctx context.Context) error {
+		sample, ok := db.Monitor.Sample()
+		if ok && sample.Slow {
+			log.Printf("Database pool slow: %d of %d acquires waited, average wait %v, %d canceled, %d connections in use, %d opened",
+				sample.Waited, sample.Acquires, sample.AverageWait, sample.Canceled, sample.AcquiredPeak, sample.NewConns)
+		}
+		return nil
+	}
+}
@@ -0,0 +1,69 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+
+	"github.com/ngenohkevin/kuiper_admin/internal/database"
+	"github.com/ngenohkevin/kuiper_admin/internal/media"
+	"github.com/ngenohkevin/kuiper_admin/internal/models"
+)
+
+// imageJobBatch is how many image jobs one run takes on. Processing is CPU-heavy and may wait
+// on an external service, so the rest wait for the next tick.
+const imageJobBatch = 5
+
+// ProcessImages returns a job that works through queued image processing jobs, storing each
+// processed image and swapping it into the product's gallery in place of the original
+func ProcessImages(db *database.DB, mediaCfg media.Config, pipeline media.PipelineConfig) func(ctx context.Context) error {
+	return func(ctx context.Context) error {
+		queued, err := models.ClaimImageJobs(db, imageJobBatch)
+		if err != nil {
+			return err
+		}
+
+		var errs []error
+		for _, job := range queued {
+			resultURL, jobErr := RunImageJob(ctx, db, mediaCfg, pipeline, job)
+			if err := models.FinishImageJob(db, job, resultURL, jobErr); err != nil {
+				log.Printf("Error recording image job %s: %v", job.ID, err)
+			}
+			if jobErr != nil {
+				errs = append(errs, fmt.Errorf("image %s: %w", job.ImageURL, jobErr))
+			}
+		}
+		return errors.Join(errs...)
+	}
+}
+
+// RunImageJob processes one image and puts the result in the gallery, returning its URL
+func RunImageJob(ctx context.Context, db *database.DB, mediaCfg media.Config, pipeline media.PipelineConfig, job models.ImageJob) (string, error) {
+	steps, err := pipeline.BuildSteps(job.Steps)
+	if err != nil {
+		return "", err
+	}
+	data, err := media.Open(ctx, mediaCfg, job.ImageURL)
+	if err != nil {
+		return "", err
+	}
+	processed, err := media.Process(ctx, mediaCfg, data, steps)
+	if err != nil {
+		return "", err
+	}
+
+	replaced, err := models.ReplaceProductImage(db, job.ProductID, job.ImageURL, processed.URL)
+	if err != nil || !replaced {
+		if err := media.Remove(ctx, mediaCfg, processed.URL); err != nil {
+			log.Printf("Error removing unused processed image %s: %v", processed.URL, err)
+		}
+	}
+	if err != nil {
+		return "", err
+	}
+	if !replaced {
+		return "", fmt.Errorf("the image was removed from the product before processing finished")
+	}
+	return processed.URL, nil
+}
@@ -0,0 +1,24 @@
+package jobs
+
+import (
+	"context"
+	"log"
+
+	"github.com/ngenohkevin/kuiper_admin/internal/database"
+	"github.com/ngenohkevin/kuiper_admin/internal/models"
+)
+
+// PurgeProductViewSessions returns a job that forgets storefront sessions whose product views
+// can no longer be counted twice, keeping the table to the last couple of days of traffic
+func PurgeProductViewSessions(db *database.DB) func(ctx context.Context) error {
+	return func(ctx context.Context) error {
+		purged, err := models.PurgeProductViewSessions(db, models.ProductViewWindow())
+		if err != nil {
+			return err
+		}
+		if purged > 0 {
+			log.Printf("Purged %d product view sessions", purged)
+		}
+		return nil
+	}
+}
@@ -0,0 +1,170 @@
+package jobs
+
+import (
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// tasksKept is how many finished tasks the jobs page keeps listing
+const tasksKept = 20
+
+// Task is a long piece of work started from a request, such as a large export, followed on the
+// jobs page while it runs and for a while after
+type Task struct {
+	ID         string     `json:"id"`
+	Kind       string     `json:"kind"`
+	Name       string     `json:"name"`
+	Total      int64      `json:"total"` // Rows expected, 0 when unknown
+	Done       int64      `json:"done"`
+	StartedAt  time.Time  `json:"started_at"`
+	FinishedAt *time.Time `json:"finished_at"`
+	Error      string     `json:"error,omitempty"`
+}
+
+// Percent is how far through the task is, capped at 100, or -1 when the total isn't known
+func (t Task) Percent() int {
+	if t.Total <= 0 {
+		return -1
+	}
+	return int(min(t.Done*100/t.Total, 100))
+}
+
+// Schedule is how a job run by Every last went
+type Schedule struct {
+	Name         string        `json:"name"`
+	Interval     time.Duration `json:"interval"`
+	Running      bool          `json:"running"`
+	LastRun      *time.Time    `json:"last_run"`
+	LastDuration time.Duration `json:"last_duration"`
+	LastError    string        `json:"last_error,omitempty"`
+}
+
+// NextRun is when the job's next run is due, nil until its first run has finished
+func (s Schedule) NextRun() *time.Time {
+	if s.LastRun == nil {
+		return nil
+	}
+	next := s.LastRun.Add(s.Interval)
+	return &next
+}
+
+// FindSchedule finds a job started with Every by name
+func FindSchedule(name string) (Schedule, bool) {
+	registry.Lock()
+	defer registry.Unlock()
+
+	s, ok := registry.schedules[name]
+	if !ok {
+		return Schedule{}, false
+	}
+	return *s, true
+}
+
+// registry holds the tasks and schedules the jobs page shows
+var registry = struct {
+	sync.Mutex
+	nextID    int
+	tasks     []*Task
+	schedules map[string]*Schedule
+	order     []string
+}{schedules: map[string]*Schedule{}}
+
+// TaskProgress updates one task; it's safe to use from the goroutine doing the work
+type TaskProgress struct {
+	task *Task
+}
+
+// StartTask records a task so the jobs page shows it. total is how many rows it expects, or 0.
+func StartTask(kind, name string, total int64) TaskProgress {
+	registry.Lock()
+	defer registry.Unlock()
+
+	registry.nextID++
+	t := &Task{ID: strconv.Itoa(registry.nextID), Kind: kind, Name: name, Total: total, StartedAt: time.Now()}
+	registry.tasks = append(registry.tasks, t)
+
+	// Forget the oldest finished tasks beyond what the page lists
+	finished := 0
+	for i := len(registry.tasks) - 1; i >= 0; i-- {
+		if registry.tasks[i].FinishedAt == nil {
+			continue
+		}
+		if finished++; finished > tasksKept {
+			registry.tasks = slices.Delete(registry.tasks, i, i+1)
+		}
+	}
+	return TaskProgress{task: t}
+}
+
+// Add counts n more rows done
+func (p TaskProgress) Add(n int64) {
+	registry.Lock()
+	p.task.Done += n
+	registry.Unlock()
+}
+
+// Finish marks the task done, or failed with err
+func (p TaskProgress) Finish(err error) {
+	registry.Lock()
+	now := time.Now()
+	p.task.FinishedAt = &now
+	if err != nil {
+		p.task.Error = err.Error()
+	}
+	registry.Unlock()
+}
+
+// Tasks lists the running and recently finished tasks, newest first
+func Tasks() []Task {
+	registry.Lock()
+	defer registry.Unlock()
+
+	tasks := make([]Task, 0, len(registry.tasks))
+	for i := len(registry.tasks) - 1; i >= 0; i-- {
+		tasks = append(tasks, *registry.tasks[i])
+	}
+	return tasks
+}
+
+// Schedules lists the jobs started with Every, in the order they were started
+func Schedules() []Schedule {
+	registry.Lock()
+	defer registry.Unlock()
+
+	schedules := make([]Schedule, 0, len(registry.order))
+	for _, name := range registry.order {
+		schedules = append(schedules, *registry.schedules[name])
+	}
+	return schedules
+}
+
+// scheduleStarted records that a scheduled job's run has begun
+func scheduleStarted(name string, interval time.Duration) {
+	registry.Lock()
+	defer registry.Unlock()
+
+	s, ok := registry.schedules[name]
+	if !ok {
+		s = &Schedule{Name: name, Interval: interval}
+		registry.schedules[name] = s
+		registry.order = append(registry.order, name)
+	}
+	s.Running = true
+}
+
+// scheduleFinished records how a scheduled job's run went
+func scheduleFinished(name string, started time.Time, err error) {
+	registry.Lock()
+	defer registry.Unlock()
+
+	s := registry.schedules[name]
+	s.Running = false
+	s.LastRun = &started
+	s.LastDuration = time.Since(started)
+	s.LastError = ""
+	if err != nil {
+		s.LastError = err.Error()
+	}
+}
@@ -0,0 +1,45 @@
+package jobs
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/ngenohkevin/kuiper_admin/internal/database"
+	"github.com/ngenohkevin/kuiper_admin/internal/models"
+)
+
+// RetentionJob is the name the retention job runs under on the jobs page
+const RetentionJob = "apply-retention"
+
+// RetentionInterval is how often the retention policies are applied
+const RetentionInterval = 24 * time.Hour
+
+// ApplyRetention returns a job that removes or anonymizes the data each retention policy set
+// under Settings → Data Retention no longer keeps. A failing policy doesn't stop the others.
+func ApplyRetention(db *database.DB) func(ctx context.Context) error {
+	return func(ctx context.Context) error {
+		policies, err := models.GetRetentionPolicies(db)
+		if err != nil {
+			return err
+		}
+
+		var firstErr error
+		for _, policy := range policies {
+			if !policy.Enabled() {
+				continue
+			}
+			changed, err := models.ApplyRetention(db, policy)
+			if changed > 0 {
+				log.Printf("Retention policy %s removed or anonymized %d rows older than %d days", policy.Rule, changed, policy.Days)
+			}
+			if err != nil {
+				log.Printf("Error applying %s retention: %v", policy.Rule, err)
+				if firstErr == nil {
+					firstErr = err
+				}
+			}
+		}
+		return firstErr
+	}
+}
@@ -0,0 +1,37 @@
+package jobs
+
+import (
+	"context"
+	"log"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/ngenohkevin/kuiper_admin/internal/database"
+	"github.com/ngenohkevin/kuiper_admin/internal/models"
+)
+
+// SearchLogRetention is how long logged searches are kept for the search report.
+// Override with SEARCH_LOG_RETENTION_DAYS.
+func SearchLogRetention() time.Duration {
+	if s := os.Getenv("SEARCH_LOG_RETENTION_DAYS"); s != "" {
+		if days, err := strconv.Atoi(s); err == nil && days > 0 {
+			return time.Duration(days) * 24 * time.Hour
+		}
+	}
+	return 90 * 24 * time.Hour
+}
+
+// PurgeSearchLog returns a job that deletes logged searches older than the retention period
+func PurgeSearchLog(db *database.DB) func(ctx context.Context) error {
+	return func(ctx context.Context) error {
+		purged, err := models.PurgeSearchLog(db, time.Now().Add(-SearchLogRetention()))
+		if err != nil {
+			return err
+		}
+		if purged > 0 {
+			log.Printf("Purged %d searches from the search log", purged)
+		}
+		return nil
+	}
+}
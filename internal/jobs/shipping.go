@@ -0,0 +1,42 @@
+package jobs
+
+import (
+	"context"
+	"log"
+
+	"github.com/ngenohkevin/kuiper_admin/internal/database"
+	"github.com/ngenohkevin/kuiper_admin/internal/models"
+	"github.com/ngenohkevin/kuiper_admin/internal/shipping"
+)
+
+// trackingBatch is how many parcels one run tracks at most
+const trackingBatch = 100
+
+// TrackShipments returns a job that asks the shipping provider where the parcels of bought labels
+// have got to, putting each new status on its order's timeline. A parcel that can't be tracked is
+// logged and tried again on a later run.
+func TrackShipments(db *database.DB, cfg shipping.Config) func(ctx context.Context) error {
+	provider, _ := shipping.New(cfg)
+
+	return func(ctx context.Context) error {
+		due, err := models.DueTrackedLabels(db, cfg.TrackingInterval, trackingBatch)
+		if err != nil {
+			return err
+		}
+
+		for _, label := range due {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			tracking, err := provider.Track(ctx, label.CarrierCode, label.TrackingNumber)
+			if err != nil {
+				log.Printf("Error tracking %s for order %s: %v", label.TrackingNumber, label.OrderID, err)
+				continue
+			}
+			if err := models.UpdateLabelTracking(db, label, tracking); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
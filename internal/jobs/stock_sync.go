@@ -0,0 +1,97 @@
+package jobs
+
+import (
+	"context"
+	"fmt"
+	"log"
+
+	"github.com/ngenohkevin/kuiper_admin/internal/database"
+	"github.com/ngenohkevin/kuiper_admin/internal/models"
+	"github.com/ngenohkevin/kuiper_admin/internal/wms"
+)
+
+// SyncStock returns a job that reconciles stock with the external warehouse.
+// Every run is recorded; discrepancies are corrected through stock movements so they show up in the ledger.
+func SyncStock(db *database.DB, cfg wms.Config) func(ctx context.Context) error {
+	client := wms.NewClient(cfg)
+
+	return func(ctx context.Context) error {
+		run, err := models.StartStockSyncRun(db, cfg.Mode)
+		if err != nil {
+			return err
+		}
+
+		syncErr := syncStock(ctx, db, client, cfg, &run)
+		if syncErr != nil {
+			run.Error = syncErr.Error()
+		}
+		if err := models.FinishStockSyncRun(db, run); err != nil {
+			log.Printf("Error recording stock sync run: %v", err)
+		}
+		if run.Discrepancies > 0 || run.Unmatched > 0 {
+			log.Printf("Stock sync corrected %d discrepancies, %d warehouse items unmatched", run.Discrepancies, run.Unmatched)
+		}
+		return syncErr
+	}
+}
+
+// syncStock pulls and/or pushes stock levels according to the configured mode, counting into run
+func syncStock(ctx context.Context, db *database.DB, client *wms.Client, cfg wms.Config, run *models.StockSyncRun) error {
+	local, err := models.GetStockLevels(db)
+	if err != nil {
+		return err
+	}
+
+	if cfg.Pulls() {
+		remote, err := client.PullStock(ctx)
+		if err != nil {
+			return err
+		}
+
+		byKey := make(map[string]int, len(local))
+		for i, level := range local {
+			byKey[level.Key()] = i
+		}
+
+		for _, level := range remote {
+			i, ok := byKey[level.Key()]
+			if !ok {
+				run.Unmatched++
+				continue
+			}
+			run.Checked++
+
+			delta := level.StockCount - local[i].StockCount
+			if delta == 0 {
+				continue
+			}
+
+			change := models.StockChange{
+				Reason: models.MovementWMSSync,
+				Note:   fmt.Sprintf("Warehouse reported %d, admin had %d", level.StockCount, local[i].StockCount),
+			}
+			var stockCount int
+			if level.VariantID != "" {
+				stockCount, err = models.AdjustProductVariantStock(db, level.ProductID, level.VariantID, delta, change)
+			} else {
+				stockCount, err = models.AdjustProductStock(db, level.ProductID, delta, change)
+			}
+			if err != nil {
+				return fmt.Errorf("error correcting stock for %s: %w", level.Key(), err)
+			}
+			local[i].StockCount = stockCount
+			run.Discrepancies++
+		}
+	}
+
+	if cfg.Pushes() {
+		if err := client.PushStock(ctx, local); err != nil {
+			return err
+		}
+		if !cfg.Pulls() {
+			run.Checked = len(local)
+		}
+	}
+
+	return nil
+}
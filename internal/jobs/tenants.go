@@ -0,0 +1,56 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+
+	"github.com/ngenohkevin/kuiper_admin/internal/database"
+	"github.com/ngenohkevin/kuiper_admin/internal/models"
+)
+
+// ForEachTenant returns a job that runs the job build makes for the main schema and then, one
+// after another, for each enabled tenant whose schema is up to date. Each tenant's job is built
+// once and kept, so jobs that remember things between runs remember them per tenant. A tenant's
+// failure doesn't stop the others; the errors are returned together, naming the schema.
+func ForEachTenant(db *database.DB, build func(db *database.DB) func(ctx context.Context) error) func(ctx context.Context) error {
+	mainJob := build(db)
+	built := make(map[*database.DB]func(ctx context.Context) error)
+
+	return func(ctx context.Context) error {
+		var errs []error
+		if err := mainJob(ctx); err != nil {
+			errs = append(errs, err)
+		}
+
+		tenants, err := models.EnabledTenantDBs(db, database.MigrationsDir)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("finding tenants: %w", err))
+		}
+
+		// A tenant disabled and enabled again has a new connection pool, and its job is rebuilt
+		current := make(map[*database.DB]bool, len(tenants))
+		for _, schema := range slices.Sorted(maps.Keys(tenants)) {
+			if ctx.Err() != nil {
+				break
+			}
+			tenantDB := tenants[schema]
+			current[tenantDB] = true
+			job, ok := built[tenantDB]
+			if !ok {
+				job = build(tenantDB)
+				built[tenantDB] = job
+			}
+			if err := job(ctx); err != nil {
+				errs = append(errs, fmt.Errorf("tenant %s: %w", schema, err))
+			}
+		}
+		maps.DeleteFunc(built, func(tenantDB *database.DB, _ func(ctx context.Context) error) bool {
+			return !current[tenantDB]
+		})
+
+		return errors.Join(errs...)
+	}
+}
@@ -0,0 +1,37 @@
+package jobs
+
+import (
+	"context"
+	"log"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/ngenohkevin/kuiper_admin/internal/database"
+	"github.com/ngenohkevin/kuiper_admin/internal/models"
+)
+
+// TrashRetention is how long deleted items stay restorable before they are purged.
+// Override with TRASH_RETENTION_DAYS.
+func TrashRetention() time.Duration {
+	if s := os.Getenv("TRASH_RETENTION_DAYS"); s != "" {
+		if days, err := strconv.Atoi(s); err == nil && days > 0 {
+			return time.Duration(days) * 24 * time.Hour
+		}
+	}
+	return 30 * 24 * time.Hour
+}
+
+// PurgeTrash returns a job that permanently deletes trashed items older than the retention period
+func PurgeTrash(db *database.DB) func(ctx context.Context) error {
+	return func(ctx context.Context) error {
+		purged, err := models.PurgeExpiredTrash(db, TrashRetention())
+		if err != nil {
+			return err
+		}
+		if purged > 0 {
+			log.Printf("Purged %d items from the trash", purged)
+		}
+		return nil
+	}
+}
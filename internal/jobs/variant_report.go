@@ -0,0 +1,23 @@
+package jobs
+
+import (
+	"context"
+	"log"
+
+	"github.com/ngenohkevin/kuiper_admin/internal/database"
+	"github.com/ngenohkevin/kuiper_admin/internal/models"
+)
+
+// ValidateVariants returns a job that checks every product's variants JSON and rebuilds the variant report
+func ValidateVariants(db *database.DB) func(ctx context.Context) error {
+	return func(ctx context.Context) error {
+		found, err := models.RebuildVariantReport(db)
+		if err != nil {
+			return err
+		}
+		if found > 0 {
+			log.Printf("Variant report found %d problems in product variants", found)
+		}
+		return nil
+	}
+}
@@ -0,0 +1,134 @@
+// Package live passes changes made in the dashboard to the admins who have it open, so their
+// pages can catch up without reloading, and tells the storefront's stock stream which products'
+// price or stock changed. Events only reach subscribers connected to the same process that made
+// the change.
+package live
+
+import (
+	"sync"
+	"time"
+)
+
+// subscriberBuffer is how many events a slow browser can fall behind before it misses some
+const subscriberBuffer = 32
+
+// productChangeBuffer is how many product changes a slow subscriber can fall behind before it
+// misses some
+const productChangeBuffer = 1024
+
+// Event is a change to an entity, as sent to the browser
+type Event struct {
+	EntityType string    `json:"entity_type"` // One of the models.Activity* entity constants
+	EntityID   string    `json:"entity_id"`
+	Action     string    `json:"action"`
+	Summary    string    `json:"summary"`
+	Actor      string    `json:"actor"` // Admin username, empty for automated changes
+	At         time.Time `json:"at"`
+	Tenant     string    `json:"-"` // Schema of the tenant the change was made in, empty for the main one
+}
+
+// ProductChange says a product's price, stock or listing may have changed
+type ProductChange struct {
+	ProductID string
+	Tenant    string // Schema of the tenant the product is in, empty for the main one
+}
+
+// hub holds the open subscriptions to one kind of event
+type hub[T any] struct {
+	sync.Mutex
+	subscribers map[chan T]struct{}
+	closed      bool
+}
+
+func newHub[T any]() *hub[T] {
+	return &hub[T]{subscribers: map[chan T]struct{}{}}
+}
+
+var (
+	events   = newHub[Event]()
+	products = newHub[ProductChange]()
+)
+
+// publish sends events to every subscriber. It never blocks: a subscriber whose buffer is full
+// misses the events.
+func (h *hub[T]) publish(items ...T) {
+	h.Lock()
+	defer h.Unlock()
+
+	for ch := range h.subscribers {
+		for _, e := range items {
+			select {
+			case ch <- e:
+			default:
+			}
+		}
+	}
+}
+
+// subscribe starts receiving events, see Subscribe
+func (h *hub[T]) subscribe(buffer int) (<-chan T, func()) {
+	h.Lock()
+	defer h.Unlock()
+
+	ch := make(chan T, buffer)
+	if h.closed {
+		close(ch)
+		return ch, func() {}
+	}
+	h.subscribers[ch] = struct{}{}
+
+	return ch, func() {
+		h.Lock()
+		defer h.Unlock()
+		if _, ok := h.subscribers[ch]; ok {
+			delete(h.subscribers, ch)
+			close(ch)
+		}
+	}
+}
+
+// shutdown closes every subscription
+func (h *hub[T]) shutdown() {
+	h.Lock()
+	defer h.Unlock()
+
+	h.closed = true
+	for ch := range h.subscribers {
+		delete(h.subscribers, ch)
+		close(ch)
+	}
+}
+
+// Publish sends events to every subscriber. It never blocks: a subscriber whose buffer is full
+// misses the events.
+func Publish(e ...Event) {
+	events.publish(e...)
+}
+
+// Subscribe starts receiving events. The channel is closed by the returned function, which must
+// be called once the subscriber is done, or by Shutdown.
+func Subscribe() (<-chan Event, func()) {
+	return events.subscribe(subscriberBuffer)
+}
+
+// PublishProductChanges tells the stock stream's subscribers that products in a tenant, or the
+// main store when tenant is empty, have changed. Like Publish, it never blocks.
+func PublishProductChanges(tenant string, productIDs ...string) {
+	changes := make([]ProductChange, len(productIDs))
+	for i, id := range productIDs {
+		changes[i] = ProductChange{ProductID: id, Tenant: tenant}
+	}
+	products.publish(changes...)
+}
+
+// SubscribeProductChanges starts receiving product changes, as Subscribe does events. Its buffer
+// is larger, since a bulk edit or an import changes many products at once.
+func SubscribeProductChanges() (<-chan ProductChange, func()) {
+	return products.subscribe(productChangeBuffer)
+}
+
+// Shutdown closes every subscription, so open streams end and the server can stop
+func Shutdown() {
+	events.shutdown()
+	products.shutdown()
+}
@@ -0,0 +1,74 @@
+// Package mailer sends the admin's outgoing email, such as change digests, through an SMTP
+// server.
+package mailer
+
+import (
+	"bytes"
+	"fmt"
+	"mime"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"os"
+	"strings"
+	"time"
+)
+
+// Config holds the SMTP server settings
+type Config struct {
+	Host     string
+	Port     string
+	Username string
+	Password string
+	From     string
+}
+
+// ConfigFromEnv reads SMTP_HOST, SMTP_PORT, SMTP_USERNAME, SMTP_PASSWORD and MAIL_FROM.
+// Email is disabled while SMTP_HOST or MAIL_FROM is empty.
+func ConfigFromEnv() Config {
+	cfg := Config{
+		Host:     os.Getenv("SMTP_HOST"),
+		Port:     os.Getenv("SMTP_PORT"),
+		Username: os.Getenv("SMTP_USERNAME"),
+		Password: os.Getenv("SMTP_PASSWORD"),
+		From:     os.Getenv("MAIL_FROM"),
+	}
+	if cfg.Port == "" {
+		cfg.Port = "587"
+	}
+	return cfg
+}
+
+// Enabled reports whether an SMTP server and sender are configured
+func (c Config) Enabled() bool {
+	return c.Host != "" && c.From != ""
+}
+
+// Send emails a plain text message to one recipient. The server's STARTTLS is used when it
+// offers it, and the credentials only when a username is set.
+func (c Config) Send(to, subject, body string) error {
+	var msg bytes.Buffer
+	fmt.Fprintf(&msg, "From: %s\r\n", c.From)
+	fmt.Fprintf(&msg, "To: %s\r\n", to)
+	fmt.Fprintf(&msg, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", subject))
+	fmt.Fprintf(&msg, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	msg.WriteString("MIME-Version: 1.0\r\n")
+	msg.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	msg.WriteString("Content-Transfer-Encoding: 8bit\r\n\r\n")
+	msg.WriteString(strings.ReplaceAll(body, "\n", "\r\n"))
+
+	// MAIL_FROM may carry a display name, which the envelope sender can't
+	sender := c.From
+	if addr, err := mail.ParseAddress(c.From); err == nil {
+		sender = addr.Address
+	}
+
+	var auth smtp.Auth
+	if c.Username != "" {
+		auth = smtp.PlainAuth("", c.Username, c.Password, c.Host)
+	}
+	if err := smtp.SendMail(net.JoinHostPort(c.Host, c.Port), auth, sender, []string{to}, msg.Bytes()); err != nil {
+		return fmt.Errorf("error sending email to %s: %w", to, err)
+	}
+	return nil
+}
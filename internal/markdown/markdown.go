@@ -0,0 +1,165 @@
+// Package markdown renders the Markdown written for store pages to HTML. It covers what such
+// pages use — headings, paragraphs, lists, quotes, code, rules, links and emphasis — and escapes
+// everything else, so raw HTML in the source is shown as text rather than run.
+package markdown
+
+import (
+	"html"
+	"regexp"
+	"strings"
+)
+
+var (
+	headingLine = regexp.MustCompile(`^(#{1,6})\s+(.*?)\s*#*\s*$`)
+	bulletLine  = regexp.MustCompile(`^\s*[-*+]\s+(.*)$`)
+	numberLine  = regexp.MustCompile(`^\s*\d+[.)]\s+(.*)$`)
+	ruleLine    = regexp.MustCompile(`^\s*([-*_])(\s*[-*_]){2,}\s*$`)
+
+	link   = regexp.MustCompile(`\[([^\]]+)\]\(([^)\s]+)\)`)
+	strong = regexp.MustCompile(`\*\*(\S(?:.*?\S)?)\*\*`)
+	em     = regexp.MustCompile(`\*(\S(?:.*?\S)?)\*`)
+	emUnd  = regexp.MustCompile(`(^|[^\w])_(\S(?:.*?\S)?)_([^\w]|$)`)
+)
+
+// ToHTML renders Markdown source to HTML
+func ToHTML(src string) string {
+	lines := strings.Split(strings.ReplaceAll(src, "\r\n", "\n"), "\n")
+	var out strings.Builder
+
+	for i := 0; i < len(lines); {
+		line := lines[i]
+		trimmed := strings.TrimSpace(line)
+
+		switch {
+		case trimmed == "":
+			i++
+
+		case strings.HasPrefix(trimmed, "```"):
+			i++
+			var code []string
+			for i < len(lines) && !strings.HasPrefix(strings.TrimSpace(lines[i]), "```") {
+				code = append(code, lines[i])
+				i++
+			}
+			i++ // Closing fence
+			out.WriteString("<pre><code>" + html.EscapeString(strings.Join(code, "\n")) + "</code></pre>\n")
+
+		case headingLine.MatchString(trimmed):
+			m := headingLine.FindStringSubmatch(trimmed)
+			tag := "h" + string(rune('0'+len(m[1])))
+			out.WriteString("<" + tag + ">" + inline(m[2]) + "</" + tag + ">\n")
+			i++
+
+		case ruleLine.MatchString(trimmed):
+			out.WriteString("<hr>\n")
+			i++
+
+		case strings.HasPrefix(trimmed, ">"):
+			var quoted []string
+			for i < len(lines) && strings.HasPrefix(strings.TrimSpace(lines[i]), ">") {
+				quoted = append(quoted, strings.TrimPrefix(strings.TrimPrefix(strings.TrimSpace(lines[i]), ">"), " "))
+				i++
+			}
+			out.WriteString("<blockquote>\n" + ToHTML(strings.Join(quoted, "\n")) + "</blockquote>\n")
+
+		case bulletLine.MatchString(line), numberLine.MatchString(line):
+			pattern, tag := bulletLine, "ul"
+			if !bulletLine.MatchString(line) {
+				pattern, tag = numberLine, "ol"
+			}
+			out.WriteString("<" + tag + ">\n")
+			for i < len(lines) && pattern.MatchString(lines[i]) {
+				item := pattern.FindStringSubmatch(lines[i])[1]
+				i++
+				// Indented lines continue the item
+				for i < len(lines) && strings.HasPrefix(lines[i], "  ") && strings.TrimSpace(lines[i]) != "" && !pattern.MatchString(lines[i]) {
+					item += " " + strings.TrimSpace(lines[i])
+					i++
+				}
+				out.WriteString("<li>" + inline(item) + "</li>\n")
+			}
+			out.WriteString("</" + tag + ">\n")
+
+		default:
+			var para []string
+			for i < len(lines) && startsParagraph(lines[i]) {
+				para = append(para, strings.TrimSpace(lines[i]))
+				i++
+			}
+			out.WriteString("<p>" + inline(strings.Join(para, "\n")) + "</p>\n")
+		}
+	}
+	return out.String()
+}
+
+// startsParagraph reports whether line carries on a paragraph rather than ending it or
+// starting another block
+func startsParagraph(line string) bool {
+	trimmed := strings.TrimSpace(line)
+	return trimmed != "" &&
+		!strings.HasPrefix(trimmed, "```") &&
+		!strings.HasPrefix(trimmed, ">") &&
+		!headingLine.MatchString(trimmed) &&
+		!ruleLine.MatchString(trimmed) &&
+		!bulletLine.MatchString(line) &&
+		!numberLine.MatchString(line)
+}
+
+// inline renders code spans, links and emphasis within a block, escaping the rest
+func inline(s string) string {
+	var out strings.Builder
+	for {
+		start := strings.Index(s, "`")
+		if start < 0 {
+			break
+		}
+		end := strings.Index(s[start+1:], "`")
+		if end < 0 {
+			break
+		}
+		out.WriteString(links(s[:start]))
+		out.WriteString("<code>" + html.EscapeString(s[start+1:start+1+end]) + "</code>")
+		s = s[start+1+end+1:]
+	}
+	out.WriteString(links(s))
+	return out.String()
+}
+
+// links renders [text](url) links, dropping the link but keeping its text when the URL could
+// run script
+func links(s string) string {
+	var out strings.Builder
+	last := 0
+	for _, m := range link.FindAllStringSubmatchIndex(s, -1) {
+		out.WriteString(emphasis(html.EscapeString(s[last:m[0]])))
+		text, url := s[m[2]:m[3]], s[m[4]:m[5]]
+		if safeURL(url) {
+			out.WriteString(`<a href="` + html.EscapeString(url) + `">` + emphasis(html.EscapeString(text)) + "</a>")
+		} else {
+			out.WriteString(emphasis(html.EscapeString(text)))
+		}
+		last = m[1]
+	}
+	out.WriteString(emphasis(html.EscapeString(s[last:])))
+	return out.String()
+}
+
+// emphasis renders bold and italic text and turns the newlines kept inside a paragraph into
+// spaces. s is already escaped.
+func emphasis(s string) string {
+	s = strong.ReplaceAllString(s, "<strong>$1</strong>")
+	s = em.ReplaceAllString(s, "<em>$1</em>")
+	s = emUnd.ReplaceAllString(s, "$1<em>$2</em>$3")
+	return strings.ReplaceAll(s, "\n", " ")
+}
+
+// safeURL allows web and mail links and paths, turning down schemes such as javascript:
+func safeURL(url string) bool {
+	lower := strings.ToLower(url)
+	for _, prefix := range []string{"http://", "https://", "mailto:", "/", "#"} {
+		if strings.HasPrefix(lower, prefix) {
+			return true
+		}
+	}
+	return !strings.Contains(lower, ":")
+}
@@ -0,0 +1,92 @@
+package media
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	_ "image/gif" // Register the decoders image.DecodeConfig and image.Decode use
+	_ "image/jpeg"
+	_ "image/png"
+)
+
+// Formats accepted for upload. WebP and others are turned down because the standard library
+// can't decode them, so their size couldn't be checked or a thumbnail made.
+const (
+	FormatJPEG = "jpeg"
+	FormatPNG  = "png"
+	FormatGIF  = "gif"
+)
+
+// AcceptTypes lists the accepted formats as MIME types, for the file input's accept attribute
+const AcceptTypes = "image/jpeg,image/png,image/gif"
+
+// extensions are the file extensions stored files get, by format
+var extensions = map[string]string{
+	FormatJPEG: ".jpg",
+	FormatPNG:  ".png",
+	FormatGIF:  ".gif",
+}
+
+// signatures are the magic bytes each format starts with
+var signatures = []struct {
+	format string
+	magic  []byte
+}{
+	{FormatJPEG, []byte{0xFF, 0xD8, 0xFF}},
+	{FormatPNG, []byte("\x89PNG\r\n\x1a\n")},
+	{FormatGIF, []byte("GIF87a")},
+	{FormatGIF, []byte("GIF89a")},
+}
+
+// Sniff identifies an image format from its first bytes, ignoring the file name and the type
+// the browser claimed. It returns an empty string for anything else.
+func Sniff(data []byte) string {
+	for _, sig := range signatures {
+		if bytes.HasPrefix(data, sig.magic) {
+			return sig.format
+		}
+	}
+	return ""
+}
+
+// Check makes sure data is an image in an accepted format, size and resolution, reading only
+// its header for the dimensions so an oversized image is turned down before it is decoded
+func Check(cfg Config, data []byte) (string, error) {
+	if err := cfg.CheckSize(int64(len(data))); err != nil {
+		return "", err
+	}
+	format := Sniff(data)
+	if format == "" {
+		return "", fmt.Errorf("the file isn't a JPEG, PNG or GIF image")
+	}
+	config, decoded, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil || decoded != format {
+		return "", fmt.Errorf("the image is damaged or incomplete")
+	}
+	if config.Width < cfg.MinSide || config.Height < cfg.MinSide {
+		return "", fmt.Errorf("the image is %d×%d pixels; it must be at least %d pixels on each side", config.Width, config.Height, cfg.MinSide)
+	}
+	if config.Width > cfg.MaxSide || config.Height > cfg.MaxSide {
+		return "", fmt.Errorf("the image is %d×%d pixels; it can be at most %d pixels on each side", config.Width, config.Height, cfg.MaxSide)
+	}
+	return format, nil
+}
+
+// CheckSize turns down a file of size bytes that is empty or over the limit, before it is read
+func (c Config) CheckSize(size int64) error {
+	if size == 0 {
+		return fmt.Errorf("the file is empty")
+	}
+	if size > c.MaxBytes {
+		return fmt.Errorf("the file is %s; the limit is %s", formatSize(size), formatSize(c.MaxBytes))
+	}
+	return nil
+}
+
+// formatSize writes a byte count in KB or MB
+func formatSize(n int64) string {
+	if n < 1<<20 {
+		return fmt.Sprintf("%d KB", (n+1023)>>10)
+	}
+	return fmt.Sprintf("%.1f MB", float64(n)/(1<<20))
+}
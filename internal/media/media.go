@@ -0,0 +1,177 @@
+// Package media checks and stores the product images admins upload. Each upload is checked by
+// its content rather than its name, stored under a random name and given a thumbnail stored
+// alongside it, in whichever storage backend is configured (see the storage package):
+//
+//	<id>.jpg        the original, served at {base URL}/<id>.jpg
+//	<id>_thumb.jpg  its thumbnail
+//
+// Stored images can then be run through a pipeline of processing steps (see Process), whose
+// output is stored the same way under a new name.
+package media
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/ngenohkevin/kuiper_admin/internal/storage"
+)
+
+// Config holds the upload limits and where files go
+type Config struct {
+	Store     storage.Backend // Where the files are kept
+	URL       string          // URL the stored files are served at, without a trailing slash
+	LocalPath string          // Path local files used to be stored under, before URL had to be a full address
+	MaxBytes  int64           // Largest file accepted
+	MinSide   int             // Smallest width or height accepted, in pixels
+	MaxSide   int             // Largest width or height accepted, in pixels
+	ThumbSide int             // Longest side of a thumbnail, in pixels
+}
+
+// ConfigFromEnv reads the storage settings (see storage.ConfigFromEnv), MEDIA_MAX_MB,
+// MEDIA_MIN_PIXELS and MEDIA_MAX_PIXELS. By default files are kept on disk under
+// web/static/uploads, which the static file server already serves.
+func ConfigFromEnv() Config {
+	storeCfg := storage.ConfigFromEnv()
+	store, _ := storage.New(storeCfg) // A misconfigured store reports its error when used
+	cfg := Config{
+		Store:     store,
+		URL:       store.BaseURL(),
+		MaxBytes:  10 << 20,
+		MinSide:   100,
+		MaxSide:   8000,
+		ThumbSide: 400,
+	}
+	if mb, err := strconv.Atoi(os.Getenv("MEDIA_MAX_MB")); err == nil && mb > 0 {
+		cfg.MaxBytes = int64(mb) << 20
+	}
+	if px, err := strconv.Atoi(os.Getenv("MEDIA_MIN_PIXELS")); err == nil && px > 0 {
+		cfg.MinSide = px
+	}
+	if px, err := strconv.Atoi(os.Getenv("MEDIA_MAX_PIXELS")); err == nil && px > 0 {
+		cfg.MaxSide = px
+	}
+	if storeCfg.Backend == storage.BackendLocal {
+		cfg.LocalPath = storeCfg.URL
+	}
+	return cfg
+}
+
+// Image is an uploaded image once it has been stored
+type Image struct {
+	URL          string `json:"url"`
+	ThumbnailURL string `json:"thumbnail_url"`
+	Format       string `json:"format"`
+	Width        int    `json:"width"`
+	Height       int    `json:"height"`
+	Size         int64  `json:"size"`
+}
+
+// Save checks an uploaded file and, if it is acceptable, stores it and its thumbnail.
+// The error explains to the admin why a file was turned down.
+func Save(ctx context.Context, cfg Config, data []byte) (Image, error) {
+	format, err := Check(cfg, data)
+	if err != nil {
+		return Image{}, err
+	}
+	return store(ctx, cfg, data, format)
+}
+
+// store saves an image that has already been checked, and its thumbnail, under a new name
+func store(ctx context.Context, cfg Config, data []byte, format string) (Image, error) {
+	thumb, width, height, err := thumbnail(data, format, cfg.ThumbSide)
+	if err != nil {
+		return Image{}, err
+	}
+
+	id := uuid.NewString()
+	ext := extensions[format]
+	name, thumbName := id+ext, id+"_thumb"+ext
+	contentType := "image/" + format
+	if err := cfg.Store.Put(ctx, name, data, contentType); err != nil {
+		return Image{}, fmt.Errorf("error saving image: %w", err)
+	}
+	if err := cfg.Store.Put(ctx, thumbName, thumb, contentType); err != nil {
+		cfg.Store.Delete(ctx, name)
+		return Image{}, fmt.Errorf("error saving thumbnail: %w", err)
+	}
+
+	return Image{
+		URL:          cfg.URL + "/" + name,
+		ThumbnailURL: cfg.URL + "/" + thumbName,
+		Format:       format,
+		Width:        width,
+		Height:       height,
+		Size:         int64(len(data)),
+	}, nil
+}
+
+// ThumbnailURL returns the thumbnail of an image uploaded with cfg, or the image's own URL
+// when it was added as a link and has no thumbnail
+func ThumbnailURL(cfg Config, imageURL string) string {
+	name, ok := uploadName(cfg, imageURL)
+	if !ok {
+		return imageURL
+	}
+	ext := filepath.Ext(name)
+	if strings.HasSuffix(strings.TrimSuffix(name, ext), "_thumb") {
+		return imageURL
+	}
+	// Alongside the image, under whichever of its URLs it was stored with
+	return strings.TrimSuffix(imageURL, name) + strings.TrimSuffix(name, ext) + "_thumb" + ext
+}
+
+// uploadName returns the file name of an image uploaded with cfg, and whether it is one. Local
+// uploads stored under the bare path before are recognized too.
+func uploadName(cfg Config, imageURL string) (string, bool) {
+	for _, base := range []string{cfg.URL, cfg.LocalPath} {
+		if base == "" {
+			continue
+		}
+		name, ok := strings.CutPrefix(imageURL, base+"/")
+		if ok && name != "" && !strings.Contains(name, "/") && !strings.HasPrefix(name, ".") {
+			return name, true
+		}
+	}
+	return "", false
+}
+
+// IsUpload reports whether an image URL points at a file uploaded with cfg, as opposed to an
+// image added as a link
+func IsUpload(cfg Config, imageURL string) bool {
+	_, ok := uploadName(cfg, imageURL)
+	return ok
+}
+
+// Open reads back an image uploaded with cfg
+func Open(ctx context.Context, cfg Config, imageURL string) ([]byte, error) {
+	name, ok := uploadName(cfg, imageURL)
+	if !ok {
+		return nil, fmt.Errorf("%s isn't an uploaded image", imageURL)
+	}
+	data, err := cfg.Store.Get(ctx, name)
+	if err != nil {
+		return nil, fmt.Errorf("error reading image: %w", err)
+	}
+	return data, nil
+}
+
+// Remove deletes an image uploaded with cfg and its thumbnail. Links are left alone, and an
+// image that is already gone isn't an error.
+func Remove(ctx context.Context, cfg Config, imageURL string) error {
+	name, ok := uploadName(cfg, imageURL)
+	if !ok {
+		return nil
+	}
+	var errs []error
+	errs = append(errs, cfg.Store.Delete(ctx, name))
+	if thumbName, ok := uploadName(cfg, ThumbnailURL(cfg, imageURL)); ok && thumbName != name {
+		errs = append(errs, cfg.Store.Delete(ctx, thumbName))
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,256 @@
+package media
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"image"
+	"image/png"
+	"io"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Asset is an image on its way through a pipeline: its encoded bytes and their format
+type Asset struct {
+	Data   []byte
+	Format string
+}
+
+// Step is one stage of post-upload processing. Each step gets the output of the one before it
+// and returns the asset unchanged when it has nothing to do.
+type Step interface {
+	Name() string
+	Apply(ctx context.Context, asset Asset) (Asset, error)
+}
+
+// Step names, as written in MEDIA_PIPELINE and recorded on image jobs. Resizing takes a preset,
+// as in "resize:large".
+const (
+	StepCompress         = "compress"
+	StepResize           = "resize"
+	StepRemoveBackground = "remove-background"
+)
+
+// ResizePresets are the longest side, in pixels, each resize preset scales an image down to
+var ResizePresets = map[string]int{
+	"small":  600,
+	"medium": 1200,
+	"large":  2000,
+}
+
+// maxProcessedSize caps what an external service may send back for one image
+const maxProcessedSize = 50 << 20 // 50 MB
+
+// PipelineConfig holds the processing settings and the steps new uploads go through
+type PipelineConfig struct {
+	Steps                []string // Run on every upload; none means uploads are stored as they are
+	JPEGQuality          int      // Quality JPEGs are compressed to, 1-100
+	BackgroundRemovalURL string   // Endpoint the remove-background step posts images to
+	BackgroundRemovalKey string   // Sent as a bearer token when set
+}
+
+// PipelineConfigFromEnv reads MEDIA_PIPELINE, MEDIA_JPEG_QUALITY, BG_REMOVAL_URL and
+// BG_REMOVAL_API_KEY. MEDIA_PIPELINE is a comma-separated list of steps such as
+// "remove-background,resize:large,compress".
+func PipelineConfigFromEnv() PipelineConfig {
+	cfg := PipelineConfig{
+		Steps:                ParseSteps(os.Getenv("MEDIA_PIPELINE")),
+		JPEGQuality:          82,
+		BackgroundRemovalURL: strings.TrimSpace(os.Getenv("BG_REMOVAL_URL")),
+		BackgroundRemovalKey: os.Getenv("BG_REMOVAL_API_KEY"),
+	}
+	if q, err := strconv.Atoi(os.Getenv("MEDIA_JPEG_QUALITY")); err == nil && q >= 1 && q <= 100 {
+		cfg.JPEGQuality = q
+	}
+	return cfg
+}
+
+// ParseSteps splits a comma-separated list of step names, dropping blanks
+func ParseSteps(spec string) []string {
+	var names []string
+	for _, name := range strings.Split(spec, ",") {
+		if name = strings.ToLower(strings.TrimSpace(name)); name != "" {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// Enabled reports whether uploads are processed at all
+func (c PipelineConfig) Enabled() bool {
+	return len(c.Steps) > 0
+}
+
+// RemovesBackground reports whether the background removal service is configured
+func (c PipelineConfig) RemovesBackground() bool {
+	return c.BackgroundRemovalURL != ""
+}
+
+// ResizePresetNames lists the resize presets from smallest to largest
+func ResizePresetNames() []string {
+	names := make([]string, 0, len(ResizePresets))
+	for name := range ResizePresets {
+		names = append(names, name)
+	}
+	sort.Slice(names, func(i, j int) bool { return ResizePresets[names[i]] < ResizePresets[names[j]] })
+	return names
+}
+
+// BuildSteps turns step names into steps, turning down names it doesn't know
+func (c PipelineConfig) BuildSteps(names []string) ([]Step, error) {
+	steps := make([]Step, 0, len(names))
+	for _, name := range names {
+		step, arg, _ := strings.Cut(name, ":")
+		switch step {
+		case StepCompress:
+			steps = append(steps, compressStep{quality: c.JPEGQuality})
+		case StepResize:
+			side, ok := ResizePresets[arg]
+			if !ok {
+				return nil, fmt.Errorf("unknown resize preset %q", arg)
+			}
+			steps = append(steps, resizeStep{preset: arg, side: side, quality: c.JPEGQuality})
+		case StepRemoveBackground:
+			if !c.RemovesBackground() {
+				return nil, fmt.Errorf("background removal isn't configured; set BG_REMOVAL_URL")
+			}
+			steps = append(steps, backgroundRemovalStep{
+				url:    c.BackgroundRemovalURL,
+				apiKey: c.BackgroundRemovalKey,
+				http:   &http.Client{Timeout: 60 * time.Second},
+			})
+		default:
+			return nil, fmt.Errorf("unknown processing step %q", name)
+		}
+	}
+	return steps, nil
+}
+
+// Process runs an image through steps and stores the result the way an upload is stored, with
+// its own name and thumbnail. The original is left in place.
+func Process(ctx context.Context, cfg Config, data []byte, steps []Step) (Image, error) {
+	asset := Asset{Data: data, Format: Sniff(data)}
+	if asset.Format == "" {
+		return Image{}, fmt.Errorf("the file isn't a JPEG, PNG or GIF image")
+	}
+	for _, step := range steps {
+		next, err := step.Apply(ctx, asset)
+		if err != nil {
+			return Image{}, fmt.Errorf("%s: %w", step.Name(), err)
+		}
+		asset = next
+	}
+	return store(ctx, cfg, asset.Data, asset.Format)
+}
+
+// compressStep re-encodes JPEGs at a lower quality and PNGs at the best compression, keeping
+// the result only when it is smaller. GIFs are left alone, since re-encoding drops animation.
+type compressStep struct {
+	quality int
+}
+
+func (s compressStep) Name() string { return StepCompress }
+
+func (s compressStep) Apply(ctx context.Context, asset Asset) (Asset, error) {
+	if asset.Format == FormatGIF {
+		return asset, nil
+	}
+	img, _, err := image.Decode(bytes.NewReader(asset.Data))
+	if err != nil {
+		return asset, fmt.Errorf("the image is damaged or incomplete")
+	}
+	data, err := encode(img, asset.Format, s.quality, png.BestCompression)
+	if err != nil {
+		return asset, fmt.Errorf("error compressing image: %w", err)
+	}
+	if len(data) >= len(asset.Data) {
+		return asset, nil
+	}
+	return Asset{Data: data, Format: asset.Format}, nil
+}
+
+// resizeStep scales an image down to fit within a preset's side. Smaller images and GIFs keep
+// their size.
+type resizeStep struct {
+	preset  string
+	side    int
+	quality int
+}
+
+func (s resizeStep) Name() string { return StepResize + ":" + s.preset }
+
+func (s resizeStep) Apply(ctx context.Context, asset Asset) (Asset, error) {
+	if asset.Format == FormatGIF {
+		return asset, nil
+	}
+	img, _, err := image.Decode(bytes.NewReader(asset.Data))
+	if err != nil {
+		return asset, fmt.Errorf("the image is damaged or incomplete")
+	}
+	bounds := img.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+	if width <= s.side && height <= s.side {
+		return asset, nil
+	}
+	if width >= height {
+		width, height = s.side, max(1, height*s.side/width)
+	} else {
+		width, height = max(1, width*s.side/height), s.side
+	}
+	data, err := encode(scale(img, width, height), asset.Format, s.quality, png.DefaultCompression)
+	if err != nil {
+		return asset, fmt.Errorf("error resizing image: %w", err)
+	}
+	return Asset{Data: data, Format: asset.Format}, nil
+}
+
+// backgroundRemovalStep sends the image to an external service, which is expected to answer a
+// POST of the raw image with the cut-out image, usually a PNG with a transparent background
+type backgroundRemovalStep struct {
+	url    string
+	apiKey string
+	http   *http.Client
+}
+
+func (s backgroundRemovalStep) Name() string { return StepRemoveBackground }
+
+func (s backgroundRemovalStep) Apply(ctx context.Context, asset Asset) (Asset, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.url, bytes.NewReader(asset.Data))
+	if err != nil {
+		return asset, err
+	}
+	req.Header.Set("Content-Type", "image/"+asset.Format)
+	req.Header.Set("Accept", "image/png, image/*")
+	if s.apiKey != "" {
+		req.Header.Set("Authorization", "Bearer "+s.apiKey)
+	}
+
+	resp, err := s.http.Do(req)
+	if err != nil {
+		return asset, fmt.Errorf("error calling background removal service: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		snippet, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return asset, fmt.Errorf("background removal service returned status %d: %s", resp.StatusCode, strings.TrimSpace(string(snippet)))
+	}
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxProcessedSize+1))
+	if err != nil {
+		return asset, fmt.Errorf("error reading background removal response: %w", err)
+	}
+	if len(data) > maxProcessedSize {
+		return asset, fmt.Errorf("background removal service returned more than %s", formatSize(maxProcessedSize))
+	}
+	format := Sniff(data)
+	if format == "" {
+		return asset, fmt.Errorf("background removal service didn't return a JPEG, PNG or GIF image")
+	}
+	return Asset{Data: data, Format: format}, nil
+}
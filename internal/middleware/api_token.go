@@ -0,0 +1,206 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/alexedwards/scs/v2"
+	"github.com/ngenohkevin/kuiper_admin/internal/database"
+	"github.com/ngenohkevin/kuiper_admin/internal/httperr"
+	"github.com/ngenohkevin/kuiper_admin/internal/models"
+)
+
+type apiTokenKey struct{}
+
+// APITokenFromContext returns the token that authenticated the request, if any.
+// Requests from a signed-in admin have none.
+func APITokenFromContext(ctx context.Context) (models.APIToken, bool) {
+	t, ok := ctx.Value(apiTokenKey{}).(models.APIToken)
+	return t, ok
+}
+
+// bearerToken returns the token from an "Authorization: Bearer" header, or empty
+func bearerToken(r *http.Request) string {
+	header := r.Header.Get("Authorization")
+	if len(header) < 7 || !strings.EqualFold(header[:7], "Bearer ") {
+		return ""
+	}
+	return strings.TrimSpace(header[7:])
+}
+
+// isCatalogRequest reports whether the request only reads the public catalog or reports
+// product views to it, the things catalog-scoped tokens may do
+func isCatalogRequest(r *http.Request) bool {
+	if r.Method == http.MethodPost && r.URL.Path == "/api/v1/catalog/views" {
+		return true
+	}
+	return (r.Method == http.MethodGet || r.Method == http.MethodHead) && strings.HasPrefix(r.URL.Path, "/api/v1/catalog/")
+}
+
+// isStorefrontRequest reports whether the request is a catalog request or one of the writes a
+// shopper's actions make the storefront send, the things storefront-scoped tokens may do
+func isStorefrontRequest(r *http.Request) bool {
+	if isCatalogRequest(r) {
+		return true
+	}
+	if r.Method != http.MethodPost {
+		return false
+	}
+	switch r.URL.Path {
+	case "/api/v1/reviews", "/api/v1/gift-cards/validate", "/api/v1/gift-cards/redeem":
+		return true
+	}
+	matched, _ := path.Match("/api/v1/reviews/*/reports", r.URL.Path)
+	return matched
+}
+
+// minuteWindows counts each token's requests in the current minute. Counts are kept in memory,
+// so each server instance enforces the limit on its own.
+type minuteWindows struct {
+	mu      sync.Mutex
+	windows map[string]minuteWindow
+}
+
+type minuteWindow struct {
+	start time.Time
+	count int
+}
+
+// take counts a request and reports whether it is within limit, how many requests are left
+// and when the window resets
+func (m *minuteWindows) take(id string, limit int, now time.Time) (bool, int, time.Time) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	start := now.Truncate(time.Minute)
+	w := m.windows[id]
+	if !w.start.Equal(start) {
+		w = minuteWindow{start: start}
+	}
+	reset := start.Add(time.Minute)
+	if w.count >= limit {
+		return false, 0, reset
+	}
+	w.count++
+	m.windows[id] = w
+
+	// Drop finished windows now and then so revoked tokens don't linger
+	if len(m.windows) > 1000 {
+		for key, other := range m.windows {
+			if !other.start.Equal(start) {
+				delete(m.windows, key)
+			}
+		}
+	}
+	return true, limit - w.count, reset
+}
+
+// APIToken lets API requests authenticate with a bearer token instead of an admin session and
+// enforces each token's per-minute rate limit and daily quota. Responses carry RateLimit-Limit,
+// RateLimit-Remaining and RateLimit-Reset for whichever limit is closer to running out, and
+// RateLimit-Policy describing both. Signed-in admins are not limited.
+func APIToken(db *database.DB, sessionManager *scs.SessionManager) func(http.Handler) http.Handler {
+	limiter := &minuteWindows{windows: make(map[string]minuteWindow)}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			// Tokens belong to the tenant whose subdomain the request was made on
+			db := database.FromContext(r.Context(), db)
+			secret := bearerToken(r)
+			if secret == "" && SignedIn(db, sessionManager, r) {
+				next.ServeHTTP(w, r)
+				return
+			}
+			if secret == "" {
+				w.Header().Set("WWW-Authenticate", `Bearer realm="api"`)
+				httperr.WriteJSON(w, httperr.New(http.StatusUnauthorized, "API token required"))
+				return
+			}
+
+			token, err := models.GetAPITokenBySecret(db, secret)
+			if errors.Is(err, models.ErrNotFound) {
+				w.Header().Set("WWW-Authenticate", `Bearer realm="api", error="invalid_token"`)
+				httperr.WriteJSON(w, httperr.New(http.StatusUnauthorized, "Invalid or revoked API token"))
+				return
+			}
+			if err != nil {
+				// An outage isn't a bad token, and its details are for the log, not the client
+				log.Printf("Error checking API token: %v", err)
+				httperr.WriteJSON(w, httperr.New(http.StatusServiceUnavailable, "The API token couldn't be checked. Please try again."))
+				return
+			}
+
+			if token.Scope == models.APIScopeCatalog && !isCatalogRequest(r) {
+				httperr.WriteJSON(w, httperr.New(http.StatusForbidden, "This token can only read the catalog"))
+				return
+			}
+			if token.Scope == models.APIScopeStorefront && !isStorefrontRequest(r) {
+				httperr.WriteJSON(w, httperr.New(http.StatusForbidden, "This token can only read the catalog and send reviews and gift cards"))
+				return
+			}
+
+			now := time.Now().UTC()
+			var policies []string
+			limit, remaining, reset := -1, 0, time.Time{}
+
+			if token.RateLimit > 0 {
+				policies = append(policies, fmt.Sprintf("%d;w=60", token.RateLimit))
+				ok, left, windowReset := limiter.take(token.ID, token.RateLimit, now)
+				limit, remaining, reset = token.RateLimit, left, windowReset
+				if !ok {
+					if err := models.RecordAPITokenRejection(db, token.ID); err != nil {
+						log.Printf("Error recording rejected API request: %v", err)
+					}
+					writeRateLimitHeaders(w, policies, limit, remaining, reset, now)
+					w.Header().Set("Retry-After", strconv.Itoa(secondsUntil(reset, now)))
+					httperr.WriteJSON(w, httperr.New(http.StatusTooManyRequests, "Rate limit exceeded"))
+					return
+				}
+			}
+
+			used, err := models.CountAPITokenRequest(db, token)
+			if token.DailyQuota > 0 {
+				policies = append(policies, fmt.Sprintf("%d;w=86400", token.DailyQuota))
+				if left := token.DailyQuota - used; limit < 0 || left <= remaining {
+					limit, remaining, reset = token.DailyQuota, max(left, 0), now.Truncate(24*time.Hour).Add(24*time.Hour)
+				}
+			}
+			if errors.Is(err, models.ErrQuotaExceeded) {
+				writeRateLimitHeaders(w, policies, limit, 0, reset, now)
+				w.Header().Set("Retry-After", strconv.Itoa(secondsUntil(reset, now)))
+				httperr.WriteJSON(w, httperr.New(http.StatusTooManyRequests, "Daily quota exceeded"))
+				return
+			}
+			if err != nil {
+				// Don't turn clients away because usage couldn't be counted
+				log.Printf("Error counting API request: %v", err)
+			}
+
+			if limit >= 0 {
+				writeRateLimitHeaders(w, policies, limit, remaining, reset, now)
+			}
+			next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), apiTokenKey{}, token)))
+		})
+	}
+}
+
+// writeRateLimitHeaders sets the RateLimit-* headers from the IETF rate limit headers draft
+func writeRateLimitHeaders(w http.ResponseWriter, policies []string, limit, remaining int, reset, now time.Time) {
+	w.Header().Set("RateLimit-Limit", strconv.Itoa(limit))
+	w.Header().Set("RateLimit-Remaining", strconv.Itoa(remaining))
+	w.Header().Set("RateLimit-Reset", strconv.Itoa(secondsUntil(reset, now)))
+	w.Header().Set("RateLimit-Policy", strings.Join(policies, ", "))
+}
+
+// secondsUntil rounds up, so clients never retry a moment too early
+func secondsUntil(t, now time.Time) int {
+	return int((t.Sub(now) + time.Second - 1) / time.Second)
+}
@@ -1,24 +1,75 @@
 package middleware
 
 import (
+	"log"
 	"net/http"
 	"strings"
 
 	"github.com/alexedwards/scs/v2"
+	"github.com/ngenohkevin/kuiper_admin/internal/database"
+	"github.com/ngenohkevin/kuiper_admin/internal/models"
 )
 
-// Auth creates an authentication middleware with the given session manager
-func Auth(sessionManager *scs.SessionManager) func(http.Handler) http.Handler {
+// SignedIn reports whether the request's session is signed in to an account that is still
+// enabled. The session of a disabled account is ended. If the account can't be checked the
+// session is trusted, so a database hiccup doesn't sign everyone out. A session only counts on
+// the tenant it was signed in on.
+func SignedIn(db *database.DB, sessionManager *scs.SessionManager, r *http.Request) bool {
+	if !sessionManager.GetBool(r.Context(), "authenticated") {
+		return false
+	}
+
+	db = database.FromContext(r.Context(), db)
+	if sessionManager.GetString(r.Context(), "tenant") != db.Schema {
+		return false
+	}
+
+	username := sessionManager.GetString(r.Context(), "username")
+	active, err := models.AdminUserActive(db.WithContext(r.Context()), username)
+	if err != nil {
+		log.Printf("Error checking admin account %s: %v", username, err)
+		return true
+	}
+	if !active {
+		if err := sessionManager.Destroy(r.Context()); err != nil {
+			log.Printf("Error ending session of disabled admin %s: %v", username, err)
+		}
+		return false
+	}
+	return true
+}
+
+// Auth creates an authentication middleware with the given session manager, turning away
+// sessions whose admin account has since been disabled
+func Auth(db *database.DB, sessionManager *scs.SessionManager) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			// Exclude login page, static files, and image proxy from auth check
-			if r.URL.Path == "/login" || strings.HasPrefix(r.URL.Path, "/static/") || r.URL.Path == "/proxy/image" {
+			// Exclude login page, static files, image proxy and health check from auth check
+			if r.URL.Path == "/login" || strings.HasPrefix(r.URL.Path, "/static/") || r.URL.Path == "/proxy/image" || r.URL.Path == "/healthz" {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			// Preview links carry their own signed token
+			if strings.HasPrefix(r.URL.Path, "/preview/") {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			// Inbound webhooks are signed by their sender
+			if strings.HasPrefix(r.URL.Path, "/webhooks/") {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			// API requests are checked by the APIToken middleware instead, which answers in JSON
+			if strings.HasPrefix(r.URL.Path, "/api/") {
 				next.ServeHTTP(w, r)
 				return
 			}
 
 			// Check if user is authenticated using the session manager
-			if !sessionManager.GetBool(r.Context(), "authenticated") {
+			if !SignedIn(db, sessionManager, r) {
 				http.Redirect(w, r, "/login", http.StatusSeeOther)
 				return
 			}
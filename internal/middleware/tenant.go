@@ -0,0 +1,94 @@
+package middleware
+
+import (
+	"errors"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/ngenohkevin/kuiper_admin/internal/database"
+	"github.com/ngenohkevin/kuiper_admin/internal/models"
+)
+
+// TenantBaseDomain is the domain tenants' subdomains are under, e.g. admin.example.com for
+// acme.admin.example.com, from TENANT_BASE_DOMAIN. Empty turns tenancy off.
+func TenantBaseDomain() string {
+	return strings.ToLower(strings.Trim(strings.TrimSpace(os.Getenv("TENANT_BASE_DOMAIN")), "."))
+}
+
+// tenantSlug is the subdomain a request was made on, empty for the base domain itself or any
+// other host, which the main schema serves
+func tenantSlug(host, base string) string {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	slug, ok := strings.CutSuffix(strings.ToLower(host), "."+base)
+	if !ok || strings.Contains(slug, ".") {
+		return ""
+	}
+	return slug
+}
+
+// Tenant runs each request made on a tenant's subdomain against that tenant's schema: the
+// tenant goes in the request's context, where models.TenantFromContext finds it, along with its
+// database, which database.FromContext returns. It must come before anything that reads the
+// database for the request.
+func Tenant(db *database.DB) func(http.Handler) http.Handler {
+	base := TenantBaseDomain()
+	latest, err := models.LatestMigration(database.MigrationsDir)
+	if err != nil {
+		log.Printf("Error reading migrations, tenants can't be checked for being up to date: %v", err)
+	}
+
+	return func(next http.Handler) http.Handler {
+		if base == "" {
+			return next
+		}
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			slug := tenantSlug(r.Host, base)
+			if slug == "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			tenant, err := models.GetTenantBySlug(db, slug)
+			if errors.Is(err, models.ErrNotFound) || (err == nil && !tenant.Enabled) {
+				http.Error(w, "No store is set up at this address", http.StatusNotFound)
+				return
+			}
+			if err != nil {
+				log.Printf("Error finding tenant %s: %v", slug, err)
+				http.Error(w, "Error finding the store at this address", http.StatusInternalServerError)
+				return
+			}
+			if !tenant.Ready(latest) {
+				http.Error(w, "This store is being upgraded, try again shortly", http.StatusServiceUnavailable)
+				return
+			}
+
+			tenantDB, err := db.ForSchema(tenant.Schema)
+			if err != nil {
+				log.Printf("Error connecting to tenant %s: %v", slug, err)
+				http.Error(w, "Error connecting to the store's database", http.StatusServiceUnavailable)
+				return
+			}
+
+			ctx := models.WithTenant(database.NewContext(r.Context(), tenantDB), tenant)
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// MainHostOnly turns away requests made on a tenant's subdomain, for pages that manage the
+// tenants themselves
+func MainHostOnly(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, ok := models.TenantFromContext(r.Context()); ok {
+			http.NotFound(w, r)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
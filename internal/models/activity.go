@@ -0,0 +1,305 @@
+package models
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/ngenohkevin/kuiper_admin/internal/database"
+	"github.com/ngenohkevin/kuiper_admin/internal/live"
+	"github.com/ngenohkevin/kuiper_admin/internal/money"
+)
+
+// Entities that keep an activity timeline
+const (
+	ActivityProduct  = "product"
+	ActivityCategory = "category"
+	ActivityReview   = "review"
+	ActivityOrder    = "order"
+)
+
+// Actions recorded on activity events, and the kinds of entry merged in from other ledgers
+const (
+	ActivityCreated       = "created"
+	ActivityUpdated       = "updated"
+	ActivityPriceChanged  = "price_changed"
+	ActivityDeleted       = "deleted"
+	ActivityRestored      = "restored"
+	ActivityArchived      = "archived"
+	ActivityUnarchived    = "unarchived"
+	ActivityModerated     = "moderated"
+	ActivityStatusChanged = "status_changed" // An order moved to another status
+	ActivityLabelBought   = "label_bought"
+	ActivityTracking      = "tracking"     // The carrier reported a parcel's new status
+	ActivityStock         = "stock"        // From stock_movements
+	ActivityAvailability  = "availability" // From availability_changes
+)
+
+// ActivityEvent is one thing an admin, or the system, did to an entity. Summary says what
+// changed, e.g. "Price KSh 100.00 → KSh 120.00".
+type ActivityEvent struct {
+	ID         string    `json:"id"`
+	EntityType string    `json:"entity_type"` // One of the Activity* entity constants
+	EntityID   string    `json:"entity_id"`
+	Action     string    `json:"action"`
+	Summary    string    `json:"summary"`
+	Actor      string    `json:"actor"` // Admin username, empty for automated changes
+	CreatedAt  time.Time `json:"created_at"`
+	PriceDrop  float64   `json:"-"` // On price changes, the cut as a percentage of the old price
+}
+
+// PriceDrop is how far a price change cut the price, as a percentage of the old one, or 0 when
+// it went up
+func PriceDrop(before, after money.Amount) float64 {
+	if before <= 0 || after >= before {
+		return 0
+	}
+	return math.Round(float64(before-after)*10000/float64(before)) / 100
+}
+
+// RecordActivity adds events to their entities' timelines and passes them on to the admins
+// watching for live changes
+func RecordActivity(db *database.DB, events ...ActivityEvent) error {
+	if len(events) == 0 {
+		return nil
+	}
+
+	ctx, cancel := db.Context(database.Write)
+	defer cancel()
+
+	batch := &pgx.Batch{}
+	for _, e := range events {
+		batch.Queue(`
+			INSERT INTO activity_events (entity_type, entity_id, action, summary, actor, price_drop)
+			VALUES ($1, $2, $3, $4, $5, $6)
+		`, e.EntityType, e.EntityID, e.Action, e.Summary, e.Actor, e.PriceDrop)
+	}
+	if err := db.Pool.SendBatch(ctx, batch).Close(); err != nil {
+		return dbError("recording activity", err)
+	}
+
+	now := time.Now()
+	changes := make([]live.Event, len(events))
+	for i, e := range events {
+		changes[i] = live.Event{
+			EntityType: e.EntityType, EntityID: e.EntityID, Action: e.Action,
+			Summary: e.Summary, Actor: e.Actor, At: now, Tenant: db.Schema,
+		}
+	}
+	live.Publish(changes...)
+
+	return nil
+}
+
+// GetTimeline lists the most recent events on an entity, newest first. A product's timeline
+// also has its stock movements and automatic availability changes.
+func GetTimeline(db *database.DB, entityType, entityID string, limit int) ([]ActivityEvent, error) {
+	ctx, cancel := db.Context(database.List)
+	defer cancel()
+
+	events, err := queryActivity(ctx, db, `
+		SELECT id, entity_type, entity_id, action, summary, actor, created_at
+		FROM activity_events
+		WHERE entity_type = $1 AND entity_id = $2
+		ORDER BY created_at DESC
+		LIMIT $3
+	`, entityType, entityID, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	if entityType == ActivityProduct {
+		stock, err := queryActivity(ctx, db, `
+			SELECT m.id, 'product', m.product_id::text, 'stock',
+			       CASE WHEN m.delta > 0 THEN '+' ELSE '' END || m.delta || ', now ' || m.stock_after
+			       || COALESCE(' · ' || NULLIF(v->>'name', ''), '')
+			       || ' (' || replace(m.reason, '_', ' ') || COALESCE(': ' || NULLIF(m.note, ''), '') || ')',
+			       m.actor, m.created_at
+			FROM stock_movements m
+			JOIN products p ON p.id = m.product_id
+			LEFT JOIN LATERAL (
+				SELECT v FROM jsonb_array_elements(
+					CASE WHEN jsonb_typeof(p.variants) = 'array' THEN p.variants ELSE '[]'::jsonb END
+				) AS v WHERE v->>'id' = m.variant_id
+			) variant ON m.variant_id <> ''
+			WHERE m.product_id::text = $1
+			ORDER BY m.created_at DESC
+			LIMIT $2
+		`, entityID, limit)
+		if err != nil {
+			return nil, err
+		}
+		availability, err := queryActivity(ctx, db, `
+			SELECT c.id, 'product', c.product_id::text, 'availability',
+			       COALESCE(NULLIF(v->>'name', ''), 'Variant') || CASE WHEN c.is_available THEN ' made available' ELSE ' made unavailable' END
+			       || ' (' || replace(c.reason, '_', ' ') || ')',
+			       c.actor, c.created_at
+			FROM availability_changes c
+			JOIN products p ON p.id = c.product_id
+			LEFT JOIN LATERAL (
+				SELECT v FROM jsonb_array_elements(
+					CASE WHEN jsonb_typeof(p.variants) = 'array' THEN p.variants ELSE '[]'::jsonb END
+				) AS v WHERE v->>'id' = c.variant_id
+			) variant ON true
+			WHERE c.product_id::text = $1
+			ORDER BY c.created_at DESC
+			LIMIT $2
+		`, entityID, limit)
+		if err != nil {
+			return nil, err
+		}
+		events = append(append(events, stock...), availability...)
+	}
+
+	sort.SliceStable(events, func(i, j int) bool { return events[i].CreatedAt.After(events[j].CreatedAt) })
+	if len(events) > limit {
+		events = events[:limit]
+	}
+	return events, nil
+}
+
+// queryActivity selects timeline entries, each row in ActivityEvent's field order
+func queryActivity(ctx context.Context, db *database.DB, query string, args ...interface{}) ([]ActivityEvent, error) {
+	rows, err := db.Pool.Query(ctx, query, args...)
+	if err != nil {
+		return nil, dbError("getting activity", err)
+	}
+	defer rows.Close()
+
+	events := []ActivityEvent{}
+	for rows.Next() {
+		var e ActivityEvent
+		if err := rows.Scan(&e.ID, &e.EntityType, &e.EntityID, &e.Action, &e.Summary, &e.Actor, &e.CreatedAt); err != nil {
+			return nil, fmt.Errorf("error scanning activity: %w", err)
+		}
+		events = append(events, e)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating activity: %w", err)
+	}
+
+	return events, nil
+}
+
+// FieldChange is one field an edit changed, shown as "Label before → after"
+type FieldChange struct {
+	Label, Before, After string
+}
+
+// DescribeChanges lists the fields whose value differs, for an activity summary
+func DescribeChanges(fields ...FieldChange) []string {
+	var changes []string
+	for _, f := range fields {
+		if f.Before == f.After {
+			continue
+		}
+		before, after := f.Before, f.After
+		if before == "" {
+			before = "(none)"
+		}
+		if after == "" {
+			after = "(none)"
+		}
+		changes = append(changes, f.Label+" "+before+" → "+after)
+	}
+	return changes
+}
+
+// yesNo shows a flag in a change summary
+func yesNo(b bool) string {
+	if b {
+		return "yes"
+	}
+	return "no"
+}
+
+// optionalString shows an optional value in a change summary, empty when it isn't set
+func optionalString(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
+}
+
+// costLabel shows a product's unit cost in a change summary, empty when it isn't known
+func costLabel(cost *money.Amount) string {
+	if cost == nil {
+		return ""
+	}
+	return cost.Format()
+}
+
+// categoryLabel names a product's category in a change summary
+func categoryLabel(p Product) string {
+	if p.Category != nil {
+		return p.Category.Name
+	}
+	if p.CategoryID != nil {
+		return *p.CategoryID
+	}
+	return ""
+}
+
+// ProductChanges lists what an edit changed on a product other than its price, which gets its
+// own timeline entry. Descriptions are only noted as changed, since they can be long.
+func ProductChanges(before, after Product) []string {
+	changes := DescribeChanges(
+		FieldChange{"Name", before.Name, after.Name},
+		FieldChange{"Slug", before.Slug, after.Slug},
+		FieldChange{"SKU", before.SKU, after.SKU},
+		FieldChange{"Cost", costLabel(before.Cost), costLabel(after.Cost)},
+		FieldChange{"Category", categoryLabel(before), categoryLabel(after)},
+		FieldChange{"Stock", strconv.Itoa(before.StockCount), strconv.Itoa(after.StockCount)},
+		FieldChange{"Available", yesNo(before.IsAvailable), yesNo(after.IsAvailable)},
+	)
+	if before.Description != after.Description {
+		changes = append(changes, "Description edited")
+	}
+	return changes
+}
+
+// VariantChanges lists what an edit changed on a variant other than its price, each prefixed
+// with the variant's name
+func VariantChanges(before, after ProductVariant) []string {
+	changes := DescribeChanges(
+		FieldChange{"Name", before.Name, after.Name},
+		FieldChange{"Stock", strconv.Itoa(before.StockCount), strconv.Itoa(after.StockCount)},
+		FieldChange{"Available", yesNo(before.IsAvailable), yesNo(after.IsAvailable)},
+	)
+	for i := range changes {
+		changes[i] = before.Name + ": " + changes[i]
+	}
+	return changes
+}
+
+// CategoryChanges lists what an edit changed on a category
+func CategoryChanges(before, after Category) []string {
+	changes := DescribeChanges(
+		FieldChange{"Name", before.Name, after.Name},
+		FieldChange{"Slug", before.Slug, after.Slug},
+	)
+	if optionalString(before.ParentID) != optionalString(after.ParentID) {
+		changes = append(changes, "Parent category changed")
+	}
+	return changes
+}
+
+// ReviewChanges lists what an edit changed on a review. Comments are only noted as changed,
+// since they can be long.
+func ReviewChanges(before, after Review) []string {
+	changes := DescribeChanges(
+		FieldChange{"Rating", strconv.FormatFloat(before.Rating, 'g', -1, 64), strconv.FormatFloat(after.Rating, 'g', -1, 64)},
+		FieldChange{"Reviewer", optionalString(before.ReviewerName), optionalString(after.ReviewerName)},
+	)
+	if optionalString(before.ProductID) != optionalString(after.ProductID) {
+		changes = append(changes, "Moved to another product")
+	}
+	if before.Comment != after.Comment {
+		changes = append(changes, "Comment edited")
+	}
+	return changes
+}
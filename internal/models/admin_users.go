@@ -0,0 +1,307 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/ngenohkevin/kuiper_admin/internal/database"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// minAdminPasswordLength is the shortest password an admin account may have
+const minAdminPasswordLength = 10
+
+// adminUserActiveTTL is how long whether an admin's account is enabled is cached, which is how
+// long a disabled admin on another server instance may stay signed in
+const adminUserActiveTTL = time.Minute
+
+// adminUsernamePattern is what a username may be made of
+var adminUsernamePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9._-]{1,63}$`)
+
+// ErrInvalidLogin is returned for a wrong username or password, or a disabled account, without
+// saying which
+var ErrInvalidLogin = errors.New("invalid username or password")
+
+// dummyPasswordHash is compared against when the username doesn't exist, so a failed login
+// takes as long whether or not it does
+var dummyPasswordHash, _ = bcrypt.GenerateFromPassword([]byte("not a real password"), bcrypt.DefaultCost)
+
+// AdminUser is an account that can sign in to the dashboard
+type AdminUser struct {
+	ID          string     `json:"id"`
+	Username    string     `json:"username"`
+	DisabledAt  *time.Time `json:"disabled_at"`
+	LastLoginAt *time.Time `json:"last_login_at"`
+	CreatedBy   string     `json:"created_by"` // The admin who added it, or "command line"
+	CreatedAt   time.Time  `json:"created_at"`
+}
+
+// Disabled reports whether the account has been turned off
+func (u AdminUser) Disabled() bool {
+	return u.DisabledAt != nil
+}
+
+// NormalizeAdminUsername lowercases a username and checks it: 2 to 64 letters, digits, dots,
+// dashes and underscores, starting with a letter or digit
+func NormalizeAdminUsername(username string) (string, error) {
+	username = strings.ToLower(strings.TrimSpace(username))
+	if !adminUsernamePattern.MatchString(username) {
+		return "", fmt.Errorf("username must be 2 to 64 letters, digits, dots, dashes or underscores")
+	}
+	return username, nil
+}
+
+// CheckAdminPassword checks a password is long enough, and short enough for bcrypt
+func CheckAdminPassword(password string) error {
+	if len(password) < minAdminPasswordLength {
+		return fmt.Errorf("password must be at least %d characters", minAdminPasswordLength)
+	}
+	if len(password) > 72 {
+		return fmt.Errorf("password can be at most 72 characters")
+	}
+	return nil
+}
+
+// hashAdminPassword checks a password and hashes it with bcrypt
+func hashAdminPassword(password string) (string, error) {
+	if err := CheckAdminPassword(password); err != nil {
+		return "", err
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return "", fmt.Errorf("error hashing password: %w", err)
+	}
+	return string(hash), nil
+}
+
+// CreateAdminUser adds an account that can sign in with username and password
+func CreateAdminUser(db *database.DB, username, password, createdBy string) (AdminUser, error) {
+	username, err := NormalizeAdminUsername(username)
+	if err != nil {
+		return AdminUser{}, err
+	}
+	hash, err := hashAdminPassword(password)
+	if err != nil {
+		return AdminUser{}, err
+	}
+
+	ctx, cancel := db.Context(database.Write)
+	defer cancel()
+
+	u := AdminUser{Username: username, CreatedBy: createdBy}
+	err = db.Pool.QueryRow(ctx, `
+		INSERT INTO admin_users (username, password_hash, created_by)
+		VALUES ($1, $2, $3)
+		RETURNING id, created_at
+	`, username, hash, createdBy).Scan(&u.ID, &u.CreatedAt)
+	if err = dbError("creating admin user", err); errors.Is(err, ErrConflict) {
+		return AdminUser{}, conflict("there's already an admin called %s", username)
+	}
+	if err != nil {
+		return AdminUser{}, err
+	}
+	return u, nil
+}
+
+// BootstrapAdminUser creates the first account from ADMIN_USERNAME and ADMIN_PASSWORD when
+// there are none yet, so a new deployment can be signed in to. created is false when accounts
+// already exist or the variables aren't set.
+func BootstrapAdminUser(db *database.DB, username, password string) (created bool, err error) {
+	if username == "" || password == "" {
+		return false, nil
+	}
+	count, err := CountAdminUsers(db)
+	if err != nil || count > 0 {
+		return false, err
+	}
+	if _, err := CreateAdminUser(db, username, password, "ADMIN_USERNAME"); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// CountAdminUsers counts the accounts, enabled or not
+func CountAdminUsers(db *database.DB) (int, error) {
+	ctx, cancel := db.Context(database.Read)
+	defer cancel()
+
+	var count int
+	if err := db.Pool.QueryRow(ctx, `SELECT COUNT(*) FROM admin_users`).Scan(&count); err != nil {
+		return 0, dbError("counting admin users", err)
+	}
+	return count, nil
+}
+
+// GetAdminUsers lists the accounts, enabled ones first
+func GetAdminUsers(db *database.DB) ([]AdminUser, error) {
+	ctx, cancel := db.Context(database.List)
+	defer cancel()
+
+	rows, err := db.Pool.Query(ctx, `
+		SELECT id, username, disabled_at, last_login_at, created_by, created_at
+		FROM admin_users
+		ORDER BY disabled_at IS NOT NULL, username
+	`)
+	if err != nil {
+		return nil, dbError("getting admin users", err)
+	}
+	defer rows.Close()
+
+	users := []AdminUser{}
+	for rows.Next() {
+		var u AdminUser
+		if err := rows.Scan(&u.ID, &u.Username, &u.DisabledAt, &u.LastLoginAt, &u.CreatedBy, &u.CreatedAt); err != nil {
+			return nil, fmt.Errorf("error scanning admin user: %w", err)
+		}
+		users = append(users, u)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating admin users: %w", err)
+	}
+	return users, nil
+}
+
+// AuthenticateAdmin checks a username and password, and notes the sign-in. Any mismatch, or a
+// disabled account, is ErrInvalidLogin.
+func AuthenticateAdmin(db *database.DB, username, password string) (AdminUser, error) {
+	username = strings.ToLower(strings.TrimSpace(username))
+
+	ctx, cancel := db.Context(database.Write)
+	defer cancel()
+
+	var u AdminUser
+	var hash string
+	err := db.Pool.QueryRow(ctx, `
+		SELECT id, username, password_hash, disabled_at, last_login_at, created_by, created_at
+		FROM admin_users
+		WHERE username = $1
+	`, username).Scan(&u.ID, &u.Username, &hash, &u.DisabledAt, &u.LastLoginAt, &u.CreatedBy, &u.CreatedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		bcrypt.CompareHashAndPassword(dummyPasswordHash, []byte(password))
+		return AdminUser{}, ErrInvalidLogin
+	}
+	if err != nil {
+		return AdminUser{}, dbError("finding admin user", err)
+	}
+	if bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)) != nil || u.Disabled() {
+		return AdminUser{}, ErrInvalidLogin
+	}
+
+	if _, err := db.Pool.Exec(ctx, `UPDATE admin_users SET last_login_at = CURRENT_TIMESTAMP WHERE id = $1`, u.ID); err != nil {
+		return AdminUser{}, dbError("noting sign-in", err)
+	}
+	return u, nil
+}
+
+// AdminUserActive reports whether username has an enabled account, for checking signed-in
+// sessions on every request. The answer is cached briefly.
+func AdminUserActive(db *database.DB, username string) (bool, error) {
+	key := "admin-users:active:" + username
+	if cached, found := db.Cache.Get(key); found {
+		if active, ok := cached.(bool); ok {
+			return active, nil
+		}
+	}
+
+	ctx, cancel := db.Context(database.Read)
+	defer cancel()
+
+	var active bool
+	err := db.Pool.QueryRow(ctx, `
+		SELECT EXISTS (SELECT 1 FROM admin_users WHERE username = $1 AND disabled_at IS NULL)
+	`, username).Scan(&active)
+	if err != nil {
+		return false, dbError("checking admin user", err)
+	}
+
+	db.Cache.Set(key, active, adminUserActiveTTL)
+	return active, nil
+}
+
+// SetAdminUserDisabled turns an account off or back on. An admin can't disable their own
+// account, or the last enabled one, so someone can always sign in.
+func SetAdminUserDisabled(db *database.DB, id string, disabled bool, actor string) (AdminUser, error) {
+	ctx, cancel := db.Context(database.Write)
+	defer cancel()
+
+	tx, err := db.Pool.Begin(ctx)
+	if err != nil {
+		return AdminUser{}, fmt.Errorf("error starting transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	var u AdminUser
+	err = tx.QueryRow(ctx, `
+		SELECT id, username, disabled_at, last_login_at, created_by, created_at
+		FROM admin_users WHERE id = $1
+		FOR UPDATE
+	`, id).Scan(&u.ID, &u.Username, &u.DisabledAt, &u.LastLoginAt, &u.CreatedBy, &u.CreatedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return AdminUser{}, notFound("admin user not found")
+	}
+	if err != nil {
+		return AdminUser{}, dbError("finding admin user", err)
+	}
+
+	if disabled && !u.Disabled() {
+		if u.Username == actor {
+			return AdminUser{}, conflict("you can't disable your own account")
+		}
+		var others int
+		err := tx.QueryRow(ctx, `
+			SELECT COUNT(*) FROM admin_users WHERE disabled_at IS NULL AND id <> $1
+		`, u.ID).Scan(&others)
+		if err != nil {
+			return AdminUser{}, dbError("counting admin users", err)
+		}
+		if others == 0 {
+			return AdminUser{}, conflict("%s is the last enabled account", u.Username)
+		}
+	}
+
+	err = tx.QueryRow(ctx, `
+		UPDATE admin_users
+		SET disabled_at = CASE WHEN $2 THEN COALESCE(disabled_at, CURRENT_TIMESTAMP) END,
+		    updated_at = CURRENT_TIMESTAMP
+		WHERE id = $1
+		RETURNING disabled_at
+	`, u.ID, disabled).Scan(&u.DisabledAt)
+	if err != nil {
+		return AdminUser{}, dbError("updating admin user", err)
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return AdminUser{}, fmt.Errorf("error committing admin user: %w", err)
+	}
+
+	db.Cache.Delete("admin-users:active:" + u.Username)
+	return u, nil
+}
+
+// SetAdminUserPassword replaces an account's password
+func SetAdminUserPassword(db *database.DB, id, password string) (AdminUser, error) {
+	hash, err := hashAdminPassword(password)
+	if err != nil {
+		return AdminUser{}, err
+	}
+
+	ctx, cancel := db.Context(database.Write)
+	defer cancel()
+
+	var u AdminUser
+	err = db.Pool.QueryRow(ctx, `
+		UPDATE admin_users SET password_hash = $2, updated_at = CURRENT_TIMESTAMP
+		WHERE id = $1
+		RETURNING id, username, disabled_at, last_login_at, created_by, created_at
+	`, id, hash).Scan(&u.ID, &u.Username, &u.DisabledAt, &u.LastLoginAt, &u.CreatedBy, &u.CreatedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return AdminUser{}, notFound("admin user not found")
+	}
+	if err != nil {
+		return AdminUser{}, dbError("changing admin password", err)
+	}
+	return u, nil
+}
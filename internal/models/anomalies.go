@@ -0,0 +1,162 @@
+package models
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/ngenohkevin/kuiper_admin/internal/database"
+)
+
+// Kinds of anomaly, which are also the kinds of notification they raise
+const (
+	AnomalyDeletions   = "deletions"
+	AnomalyPriceDrops  = "price_drops"
+	AnomalyReviewBurst = "review_burst"
+)
+
+// AnomalyThresholds are the rates of change that raise an alert. A threshold of 0 turns its
+// check off.
+type AnomalyThresholds struct {
+	Window           time.Duration `json:"window"`             // How far back each check counts
+	Deletions        int           `json:"deletions"`          // Products, categories and reviews deleted
+	PriceDrops       int           `json:"price_drops"`        // Prices cut by at least PriceDropPercent
+	PriceDropPercent float64       `json:"price_drop_percent"` // What counts as a deep cut
+	SessionReviews   int           `json:"session_reviews"`    // Reviews from one storefront session
+}
+
+// AnomalyThresholdsFromEnv reads the alert thresholds: ALERT_WINDOW_MINUTES (15),
+// ALERT_DELETIONS (25), ALERT_PRICE_DROPS (10), ALERT_PRICE_DROP_PERCENT (30) and
+// ALERT_SESSION_REVIEWS (10).
+func AnomalyThresholdsFromEnv() AnomalyThresholds {
+	t := AnomalyThresholds{
+		Window:           15 * time.Minute,
+		Deletions:        envCount("ALERT_DELETIONS", 25),
+		PriceDrops:       envCount("ALERT_PRICE_DROPS", 10),
+		PriceDropPercent: 30,
+		SessionReviews:   envCount("ALERT_SESSION_REVIEWS", 10),
+	}
+	if minutes := envCount("ALERT_WINDOW_MINUTES", 15); minutes > 0 {
+		t.Window = time.Duration(minutes) * time.Minute
+	}
+	if s := os.Getenv("ALERT_PRICE_DROP_PERCENT"); s != "" {
+		if pct, err := strconv.ParseFloat(s, 64); err == nil && pct > 0 && pct <= 100 {
+			t.PriceDropPercent = pct
+		}
+	}
+	return t
+}
+
+// envCount reads a whole number from an environment variable, or fallback when it's unset or
+// not one
+func envCount(name string, fallback int) int {
+	if s := os.Getenv(name); s != "" {
+		if n, err := strconv.Atoi(s); err == nil && n >= 0 {
+			return n
+		}
+	}
+	return fallback
+}
+
+// Anomaly is an unusual burst of changes, found by DetectAnomalies
+type Anomaly struct {
+	Notification
+	Key string // Tells the same anomaly apart from others of its kind, for deduplication
+}
+
+// DetectAnomalies looks over the last window of activity for bursts past the thresholds: many
+// deletions, many deep price cuts, or many reviews from one storefront session
+func DetectAnomalies(db *database.DB, t AnomalyThresholds) ([]Anomaly, error) {
+	ctx, cancel := db.Context(database.List)
+	defer cancel()
+
+	since := time.Now().Add(-t.Window)
+	window := strconv.Itoa(int(t.Window.Minutes())) + " minutes"
+	var anomalies []Anomaly
+
+	if t.Deletions > 0 {
+		var deleted int
+		var actors string
+		err := db.Pool.QueryRow(ctx, `
+			SELECT COUNT(*), COALESCE(string_agg(DISTINCT NULLIF(actor, ''), ', '), '')
+			FROM activity_events
+			WHERE action = $1 AND created_at >= $2
+		`, ActivityDeleted, since).Scan(&deleted, &actors)
+		if err != nil {
+			return nil, dbError("counting deletions", err)
+		}
+		if deleted >= t.Deletions {
+			anomalies = append(anomalies, Anomaly{Key: AnomalyDeletions, Notification: Notification{
+				Kind:  AnomalyDeletions,
+				Title: strconv.Itoa(deleted) + " deletions in the last " + window,
+				Body:  "Products, categories and reviews deleted " + anomalyActors(actors) + ". They can be restored from the trash.",
+				Link:  "/trash",
+			}})
+		}
+	}
+
+	if t.PriceDrops > 0 {
+		var drops int
+		var deepest float64
+		var actors string
+		err := db.Pool.QueryRow(ctx, `
+			SELECT COUNT(*), COALESCE(MAX(price_drop), 0)::float8, COALESCE(string_agg(DISTINCT NULLIF(actor, ''), ', '), '')
+			FROM activity_events
+			WHERE action = $1 AND price_drop >= $2 AND created_at >= $3
+		`, ActivityPriceChanged, t.PriceDropPercent, since).Scan(&drops, &deepest, &actors)
+		if err != nil {
+			return nil, dbError("counting price drops", err)
+		}
+		if drops >= t.PriceDrops {
+			anomalies = append(anomalies, Anomaly{Key: AnomalyPriceDrops, Notification: Notification{
+				Kind:  AnomalyPriceDrops,
+				Title: fmt.Sprintf("%d prices cut by %s%% or more in the last %s", drops, strconv.FormatFloat(t.PriceDropPercent, 'f', -1, 64), window),
+				Body:  fmt.Sprintf("The deepest cut was %s%%, made %s.", strconv.FormatFloat(deepest, 'f', -1, 64), anomalyActors(actors)),
+				Link:  "/products",
+			}})
+		}
+	}
+
+	if t.SessionReviews > 0 {
+		rows, err := db.Pool.Query(ctx, `
+			SELECT session_id::text, COUNT(*), COUNT(DISTINCT product_id)
+			FROM reviews
+			WHERE session_id IS NOT NULL AND created_at >= $1
+			GROUP BY session_id
+			HAVING COUNT(*) >= $2
+			ORDER BY COUNT(*) DESC
+		`, since, t.SessionReviews)
+		if err != nil {
+			return nil, dbError("counting reviews per session", err)
+		}
+		defer rows.Close()
+		for rows.Next() {
+			var sessionID string
+			var reviews, products int
+			if err := rows.Scan(&sessionID, &reviews, &products); err != nil {
+				return nil, fmt.Errorf("error scanning review burst: %w", err)
+			}
+			anomalies = append(anomalies, Anomaly{Key: AnomalyReviewBurst + ":" + sessionID, Notification: Notification{
+				Kind:  AnomalyReviewBurst,
+				Title: strconv.Itoa(reviews) + " reviews from one session in the last " + window,
+				Body:  "Storefront session " + sessionID + " reviewed " + strconv.Itoa(products) + " products. Check the moderation queue for spam.",
+				Link:  "/sessions/" + sessionID,
+			}})
+		}
+		if err := rows.Err(); err != nil {
+			return nil, fmt.Errorf("error iterating review bursts: %w", err)
+		}
+	}
+
+	return anomalies, nil
+}
+
+// anomalyActors says who made the changes behind an anomaly, from a comma-separated list of
+// usernames
+func anomalyActors(actors string) string {
+	if actors == "" {
+		return "by the system"
+	}
+	return "by " + actors
+}
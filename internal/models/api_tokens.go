@@ -0,0 +1,270 @@
+package models
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/ngenohkevin/kuiper_admin/internal/database"
+)
+
+// apiTokenPrefix starts every token so leaked ones are easy to recognise
+const apiTokenPrefix = "kad_"
+
+// What an API token may call
+const (
+	APIScopeFull       = "full"       // The whole API
+	APIScopeCatalog    = "catalog"    // Only the read-only public catalog
+	APIScopeStorefront = "storefront" // The catalog and what shoppers send: reviews, review reports and gift cards
+)
+
+// APIToken lets a script or the storefront call /api/v1 without an admin session
+type APIToken struct {
+	ID         string          `json:"id"`
+	Name       string          `json:"name"`
+	Prefix     string          `json:"prefix"`      // First characters of the token, for telling tokens apart
+	Scope      string          `json:"scope"`       // One of the APIScope* constants
+	RateLimit  int             `json:"rate_limit"`  // Requests per minute, 0 for unlimited
+	DailyQuota int             `json:"daily_quota"` // Requests per UTC day, 0 for unlimited
+	CreatedBy  string          `json:"created_by"`
+	CreatedAt  time.Time       `json:"created_at"`
+	LastUsedAt *time.Time      `json:"last_used_at,omitempty"`
+	RevokedAt  *time.Time      `json:"revoked_at,omitempty"`
+	Usage      []APITokenUsage `json:"usage,omitempty"` // Recent days, oldest first, filled by GetAPITokens
+}
+
+// APITokenUsage counts one token's requests on one day
+type APITokenUsage struct {
+	Day      time.Time `json:"day"`
+	Requests int       `json:"requests"`
+	Rejected int       `json:"rejected"` // Turned away by the rate limit or quota
+}
+
+// ErrQuotaExceeded is returned by CountAPITokenRequest when the day's quota is used up
+var ErrQuotaExceeded = errors.New("daily quota exceeded")
+
+// hashAPIToken is how tokens are stored and looked up
+func hashAPIToken(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+// validateAPITokenLimits checks the limits an admin entered
+func validateAPITokenLimits(rateLimit, dailyQuota int) error {
+	if rateLimit < 0 || dailyQuota < 0 {
+		return fmt.Errorf("limits can't be negative; use 0 for unlimited")
+	}
+	return nil
+}
+
+// CreateAPIToken generates a token and returns it with its secret, which is not stored
+// and can't be shown again
+func CreateAPIToken(db *database.DB, name, scope string, rateLimit, dailyQuota int, actor string) (APIToken, string, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return APIToken{}, "", fmt.Errorf("token name is required")
+	}
+	if scope != APIScopeFull && scope != APIScopeCatalog && scope != APIScopeStorefront {
+		return APIToken{}, "", fmt.Errorf("unknown token scope %q", scope)
+	}
+	if err := validateAPITokenLimits(rateLimit, dailyQuota); err != nil {
+		return APIToken{}, "", err
+	}
+
+	random := make([]byte, 24)
+	if _, err := rand.Read(random); err != nil {
+		return APIToken{}, "", fmt.Errorf("error generating token: %w", err)
+	}
+	secret := apiTokenPrefix + hex.EncodeToString(random)
+
+	ctx, cancel := db.Context(database.Write)
+	defer cancel()
+
+	t := APIToken{Name: name, Prefix: secret[:len(apiTokenPrefix)+8], Scope: scope, RateLimit: rateLimit, DailyQuota: dailyQuota, CreatedBy: actor}
+	err := db.Pool.QueryRow(ctx, `
+		INSERT INTO api_tokens (name, prefix, scope, token_hash, rate_limit, daily_quota, created_by)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		RETURNING id, created_at
+	`, t.Name, t.Prefix, t.Scope, hashAPIToken(secret), t.RateLimit, t.DailyQuota, t.CreatedBy).Scan(&t.ID, &t.CreatedAt)
+	if err != nil {
+		return APIToken{}, "", fmt.Errorf("error creating API token: %w", err)
+	}
+
+	return t, secret, nil
+}
+
+// GetAPITokens lists every token, revoked ones last, with its usage over the last days
+func GetAPITokens(db *database.DB, days int) ([]APIToken, error) {
+	ctx, cancel := db.Context(database.List)
+	defer cancel()
+
+	rows, err := db.Pool.Query(ctx, `
+		SELECT id, name, prefix, scope, rate_limit, daily_quota, created_by, created_at, last_used_at, revoked_at
+		FROM api_tokens
+		ORDER BY revoked_at IS NOT NULL, created_at DESC
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("error querying API tokens: %w", err)
+	}
+
+	var tokens []APIToken
+	index := make(map[string]int)
+	for rows.Next() {
+		var t APIToken
+		if err := rows.Scan(&t.ID, &t.Name, &t.Prefix, &t.Scope, &t.RateLimit, &t.DailyQuota,
+			&t.CreatedBy, &t.CreatedAt, &t.LastUsedAt, &t.RevokedAt); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("error scanning API token: %w", err)
+		}
+		index[t.ID] = len(tokens)
+		tokens = append(tokens, t)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating API tokens: %w", err)
+	}
+
+	// One entry per day, including days without requests, so graphs line up
+	today := time.Now().UTC().Truncate(24 * time.Hour)
+	first := today.AddDate(0, 0, -(days - 1))
+	for i := range tokens {
+		tokens[i].Usage = make([]APITokenUsage, days)
+		for d := range tokens[i].Usage {
+			tokens[i].Usage[d].Day = first.AddDate(0, 0, d)
+		}
+	}
+
+	rows, err = db.Pool.Query(ctx, `
+		SELECT token_id, day, requests, rejected
+		FROM api_token_usage
+		WHERE day >= $1
+	`, first)
+	if err != nil {
+		return nil, fmt.Errorf("error querying API token usage: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var tokenID string
+		var usage APITokenUsage
+		if err := rows.Scan(&tokenID, &usage.Day, &usage.Requests, &usage.Rejected); err != nil {
+			return nil, fmt.Errorf("error scanning API token usage: %w", err)
+		}
+		i, ok := index[tokenID]
+		d := int(usage.Day.Sub(first).Hours() / 24)
+		if ok && d >= 0 && d < days {
+			tokens[i].Usage[d] = usage
+		}
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating API token usage: %w", err)
+	}
+
+	return tokens, nil
+}
+
+// GetAPITokenBySecret finds the live token for a secret sent by a client. A secret that matches
+// no live token is ErrNotFound; any other error means the token couldn't be checked.
+func GetAPITokenBySecret(db *database.DB, secret string) (APIToken, error) {
+	ctx, cancel := db.Context(database.Read)
+	defer cancel()
+
+	var t APIToken
+	err := db.Pool.QueryRow(ctx, `
+		SELECT id, name, prefix, scope, rate_limit, daily_quota, created_by, created_at, last_used_at
+		FROM api_tokens
+		WHERE token_hash = $1 AND revoked_at IS NULL
+	`, hashAPIToken(secret)).Scan(&t.ID, &t.Name, &t.Prefix, &t.Scope, &t.RateLimit, &t.DailyQuota,
+		&t.CreatedBy, &t.CreatedAt, &t.LastUsedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return APIToken{}, notFound("invalid or revoked API token")
+	}
+	if err != nil {
+		return APIToken{}, dbError("finding API token", err)
+	}
+
+	return t, nil
+}
+
+// UpdateAPITokenLimits changes a token's rate limit and daily quota
+func UpdateAPITokenLimits(db *database.DB, id string, rateLimit, dailyQuota int) error {
+	if err := validateAPITokenLimits(rateLimit, dailyQuota); err != nil {
+		return err
+	}
+
+	ctx, cancel := db.Context(database.Write)
+	defer cancel()
+
+	tag, err := db.Pool.Exec(ctx, `UPDATE api_tokens SET rate_limit = $2, daily_quota = $3 WHERE id = $1`,
+		id, rateLimit, dailyQuota)
+	if err != nil {
+		return dbError("updating API token", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return notFound("API token %s not found", id)
+	}
+	return nil
+}
+
+// RevokeAPIToken stops a token from working; it stays listed with its usage
+func RevokeAPIToken(db *database.DB, id string) error {
+	ctx, cancel := db.Context(database.Write)
+	defer cancel()
+
+	_, err := db.Pool.Exec(ctx, `UPDATE api_tokens SET revoked_at = NOW() WHERE id = $1 AND revoked_at IS NULL`, id)
+	if err != nil {
+		return fmt.Errorf("error revoking API token: %w", err)
+	}
+	return nil
+}
+
+// CountAPITokenRequest counts a request against the token's daily quota and returns how
+// many requests it has made today. Once the quota is used up it returns ErrQuotaExceeded
+// and the request is counted as rejected instead.
+func CountAPITokenRequest(db *database.DB, t APIToken) (int, error) {
+	ctx, cancel := db.Context(database.Write)
+	defer cancel()
+
+	var used int
+	err := db.Pool.QueryRow(ctx, `
+		WITH touched AS (UPDATE api_tokens SET last_used_at = NOW() WHERE id = $1)
+		INSERT INTO api_token_usage (token_id, day, requests)
+		VALUES ($1, (NOW() AT TIME ZONE 'UTC')::date, 1)
+		ON CONFLICT (token_id, day) DO UPDATE SET requests = api_token_usage.requests + 1
+		WHERE $2 = 0 OR api_token_usage.requests < $2
+		RETURNING requests
+	`, t.ID, t.DailyQuota).Scan(&used)
+	if errors.Is(err, pgx.ErrNoRows) {
+		if err := RecordAPITokenRejection(db, t.ID); err != nil {
+			return t.DailyQuota, err
+		}
+		return t.DailyQuota, ErrQuotaExceeded
+	}
+	if err != nil {
+		return 0, fmt.Errorf("error counting API request: %w", err)
+	}
+
+	return used, nil
+}
+
+// RecordAPITokenRejection counts a request turned away by a limit
+func RecordAPITokenRejection(db *database.DB, id string) error {
+	ctx, cancel := db.Context(database.Write)
+	defer cancel()
+
+	_, err := db.Pool.Exec(ctx, `
+		INSERT INTO api_token_usage (token_id, day, rejected)
+		VALUES ($1, (NOW() AT TIME ZONE 'UTC')::date, 1)
+		ON CONFLICT (token_id, day) DO UPDATE SET rejected = api_token_usage.rejected + 1
+	`, id)
+	if err != nil {
+		return fmt.Errorf("error recording rejected API request: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,333 @@
+package models
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/ngenohkevin/kuiper_admin/internal/database"
+)
+
+// Actions recorded in the audit log
+const (
+	AuditCreate = "create"
+	AuditUpdate = "update"
+	AuditDelete = "delete"
+)
+
+// auditRedacted stands in for the value of a field that holds a credential
+var auditRedacted = json.RawMessage(`"[redacted]"`)
+
+// auditSkippedFields are the fields diffs leave out: timestamps that change on every write,
+// entities loaded alongside the one changed, and values derived from other fields
+var auditSkippedFields = map[string]bool{
+	"created_at": true, "updated_at": true, "category": true, "product": true, "product_id": true,
+	"variants": true, "variants_json": true, "variant_summary": true, "sale": true, "images": true,
+	"_method": true,
+}
+
+// AuditChange is one field a change touched, with its JSON value before and after. Before is
+// null when there was no earlier value, on a create, or when it isn't known, as for a form
+// submitted to a handler that doesn't describe its changes itself.
+type AuditChange struct {
+	Field  string          `json:"field"`
+	Before json.RawMessage `json:"before"`
+	After  json.RawMessage `json:"after"`
+}
+
+// AuditEntry is one create, update or delete made through the admin
+type AuditEntry struct {
+	ID         string        `json:"id"`
+	EntityType string        `json:"entity_type"` // E.g. "product", or "api-token" for the settings it came from
+	EntityID   string        `json:"entity_id"`   // Empty for changes to many entities or to settings
+	Action     string        `json:"action"`      // One of the Audit* constants
+	Actor      string        `json:"actor"`       // Admin username, or the API token the request carried
+	Method     string        `json:"method"`
+	Path       string        `json:"path"`
+	Changes    []AuditChange `json:"changes"`
+	CreatedAt  time.Time     `json:"created_at"`
+}
+
+// auditCredentialFields are the fields that hold a credential without saying so in their name,
+// such as the image proxy's auth value, and the storage backends' keys
+var auditCredentialFields = map[string]bool{
+	"auth_value": true, "admin_password": true, "new_password": true, "current_password": true,
+	"access_key": true, "access_key_id": true, "secret_access_key": true, "service_key": true,
+	"service_role_key": true, "private_key": true, "credentials": true, "passphrase": true,
+}
+
+// sensitiveField reports whether a field holds a credential, whose value is never logged:
+// one of auditCredentialFields, or one named like a password, secret, token or API key
+func sensitiveField(field string) bool {
+	field = strings.ToLower(field)
+	if auditCredentialFields[field] {
+		return true
+	}
+	for _, word := range []string{"password", "secret", "token", "api_key"} {
+		if strings.Contains(field, word) {
+			return true
+		}
+	}
+	return false
+}
+
+// auditFields reads a value's JSON fields, or none when it is nil
+func auditFields(v interface{}) map[string]json.RawMessage {
+	fields := map[string]json.RawMessage{}
+	if v == nil {
+		return fields
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return fields
+	}
+	json.Unmarshal(data, &fields)
+	return fields
+}
+
+// DiffFields lists the top-level JSON fields whose value differs between two versions of an
+// entity, by field name. before is nil for an entity just created and after for one deleted.
+func DiffFields(before, after interface{}) []AuditChange {
+	old, cur := auditFields(before), auditFields(after)
+	names := map[string]bool{}
+	for name := range old {
+		names[name] = true
+	}
+	for name := range cur {
+		names[name] = true
+	}
+
+	changes := []AuditChange{}
+	for name := range names {
+		b, a := auditValue(old[name]), auditValue(cur[name])
+		if auditSkippedFields[name] || bytes.Equal(b, a) {
+			continue
+		}
+		if sensitiveField(name) {
+			b, a = auditRedacted, auditRedacted
+		}
+		changes = append(changes, AuditChange{Field: name, Before: b, After: a})
+	}
+	sort.Slice(changes, func(i, j int) bool { return changes[i].Field < changes[j].Field })
+	return changes
+}
+
+// FormChanges lists the fields of a submitted form as changed to the values sent, for changes
+// the handler didn't describe itself. A field sent more than once is recorded as a list.
+func FormChanges(form url.Values) []AuditChange {
+	changes := []AuditChange{}
+	for name, values := range form {
+		if auditSkippedFields[name] || len(values) == 0 {
+			continue
+		}
+		var after json.RawMessage
+		switch {
+		case sensitiveField(name):
+			after = auditRedacted
+		case len(values) == 1:
+			after, _ = json.Marshal(values[0])
+		default:
+			after, _ = json.Marshal(values)
+		}
+		changes = append(changes, AuditChange{Field: name, Before: auditValue(nil), After: after})
+	}
+	sort.Slice(changes, func(i, j int) bool { return changes[i].Field < changes[j].Field })
+	return changes
+}
+
+// JSONChanges lists the top-level fields of a JSON request body as changed to the values sent,
+// as FormChanges does for forms. A body that isn't a JSON object changes nothing listed.
+func JSONChanges(body []byte) []AuditChange {
+	var fields map[string]json.RawMessage
+	if json.Unmarshal(body, &fields) != nil {
+		return []AuditChange{}
+	}
+	changes := []AuditChange{}
+	for name, value := range fields {
+		if auditSkippedFields[name] {
+			continue
+		}
+		if sensitiveField(name) {
+			value = auditRedacted
+		}
+		changes = append(changes, AuditChange{Field: name, Before: auditValue(nil), After: auditValue(value)})
+	}
+	sort.Slice(changes, func(i, j int) bool { return changes[i].Field < changes[j].Field })
+	return changes
+}
+
+// PriceChangeAudit lists what a bulk price change did to each product it touched, a variant's
+// price as "variants[<name>].price"
+func PriceChangeAudit(rows []PriceChangeRow) []AuditEntry {
+	var entries []AuditEntry
+	byProduct := map[string]int{}
+	for _, row := range rows {
+		if row.Error != "" {
+			return nil
+		}
+		if row.OldPrice == row.NewPrice {
+			continue
+		}
+		field := "price"
+		if row.VariantID != "" {
+			field = "variants[" + row.VariantName + "].price"
+		}
+		change := AuditChange{Field: field, Before: auditValue(row.OldPrice), After: auditValue(row.NewPrice)}
+		i, ok := byProduct[row.ProductID]
+		if !ok {
+			i = len(entries)
+			byProduct[row.ProductID] = i
+			entries = append(entries, AuditEntry{EntityType: ActivityProduct, EntityID: row.ProductID, Action: AuditUpdate})
+		}
+		entries[i].Changes = append(entries[i].Changes, change)
+	}
+	return entries
+}
+
+// auditValue writes a value as JSON, with nothing written as null
+func auditValue(v interface{}) json.RawMessage {
+	if raw, ok := v.(json.RawMessage); ok {
+		if len(raw) == 0 {
+			return json.RawMessage("null")
+		}
+		return raw
+	}
+	if v == nil {
+		return json.RawMessage("null")
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return json.RawMessage("null")
+	}
+	return data
+}
+
+// RecordAudit adds entries to the audit log
+func RecordAudit(db *database.DB, entries ...AuditEntry) error {
+	if len(entries) == 0 {
+		return nil
+	}
+
+	ctx, cancel := db.Context(database.Write)
+	defer cancel()
+
+	batch := &pgx.Batch{}
+	for _, e := range entries {
+		if e.Changes == nil {
+			e.Changes = []AuditChange{}
+		}
+		changes, err := json.Marshal(e.Changes)
+		if err != nil {
+			return fmt.Errorf("error encoding audit changes: %w", err)
+		}
+		batch.Queue(`
+			INSERT INTO audit_log (entity_type, entity_id, action, actor, method, path, changes)
+			VALUES ($1, $2, $3, $4, $5, $6, $7::jsonb)
+		`, e.EntityType, e.EntityID, e.Action, e.Actor, e.Method, e.Path, string(changes))
+	}
+	if err := db.Pool.SendBatch(ctx, batch).Close(); err != nil {
+		return dbError("recording audit log", err)
+	}
+	return nil
+}
+
+// AuditSorts are the orders the audit log can be sorted in
+var AuditSorts = SortOptions{
+	Columns: map[string]string{
+		"at":    "created_at",
+		"actor": "actor",
+	},
+	Default: "-at",
+}
+
+// AuditFilter narrows the audit log to entries made in [From, To). A zero time leaves that end
+// of the range open.
+type AuditFilter struct {
+	From time.Time
+	To   time.Time
+}
+
+// GetAuditLog retrieves a page of the audit log. q.Filter is an entity type, or empty for every
+// entity, and the search matches the entity ID, actor, path and the fields and values changed.
+func GetAuditLog(db *database.DB, q ListQuery, f AuditFilter) (PaginatedResult[AuditEntry], error) {
+	ctx, cancel := db.Context(database.List)
+	defer cancel()
+
+	var b queryBuilder
+	if q.Search != "" {
+		pattern := "%" + q.Search + "%"
+		b.where("entity_id ILIKE ? OR actor ILIKE ? OR path ILIKE ? OR changes::text ILIKE ?", pattern, pattern, pattern, pattern)
+	}
+	if q.Filter != "" {
+		b.where("entity_type = ?", q.Filter)
+	}
+	if !f.From.IsZero() {
+		b.where("created_at >= ?", f.From)
+	}
+	if !f.To.IsZero() {
+		b.where("created_at < ?", f.To)
+	}
+	where := " FROM audit_log " + b.whereClause()
+
+	var totalCount int64
+	if err := db.Pool.QueryRow(ctx, "SELECT COUNT(*)"+where, b.args...).Scan(&totalCount); err != nil {
+		return PaginatedResult[AuditEntry]{}, dbError("counting audit log", err)
+	}
+
+	rows, err := db.Pool.Query(ctx, `
+		SELECT id, entity_type, entity_id, action, actor, method, path, changes, created_at`+where+`
+		ORDER BY `+AuditSorts.orderBy(q.Sort, "id")+`
+		LIMIT `+b.arg(q.PageSize)+` OFFSET `+b.arg(q.offset()), b.args...)
+	if err != nil {
+		return PaginatedResult[AuditEntry]{}, dbError("getting audit log", err)
+	}
+	defer rows.Close()
+
+	entries := []AuditEntry{}
+	for rows.Next() {
+		var e AuditEntry
+		var changes []byte
+		if err := rows.Scan(&e.ID, &e.EntityType, &e.EntityID, &e.Action, &e.Actor, &e.Method, &e.Path, &changes, &e.CreatedAt); err != nil {
+			return PaginatedResult[AuditEntry]{}, fmt.Errorf("error scanning audit entry: %w", err)
+		}
+		if err := json.Unmarshal(changes, &e.Changes); err != nil {
+			return PaginatedResult[AuditEntry]{}, fmt.Errorf("error decoding audit changes: %w", err)
+		}
+		entries = append(entries, e)
+	}
+	if err := rows.Err(); err != nil {
+		return PaginatedResult[AuditEntry]{}, fmt.Errorf("error iterating audit log: %w", err)
+	}
+
+	return newPage(entries, totalCount, q), nil
+}
+
+// AuditEntityTypes lists the entity types the audit log has entries for, for its filter
+func AuditEntityTypes(db *database.DB) ([]string, error) {
+	ctx, cancel := db.Context(database.List)
+	defer cancel()
+
+	rows, err := db.Pool.Query(ctx, `SELECT DISTINCT entity_type FROM audit_log ORDER BY entity_type`)
+	if err != nil {
+		return nil, dbError("getting audit entity types", err)
+	}
+	defer rows.Close()
+
+	types := []string{}
+	for rows.Next() {
+		var t string
+		if err := rows.Scan(&t); err != nil {
+			return nil, fmt.Errorf("error scanning audit entity type: %w", err)
+		}
+		types = append(types, t)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating audit entity types: %w", err)
+	}
+	return types, nil
+}
@@ -0,0 +1,164 @@
+package models
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/ngenohkevin/kuiper_admin/internal/database"
+)
+
+// What happens to a variant's availability when its stock runs out
+const (
+	AutoAvailabilityOff     = "off"     // Leave is_available alone
+	AutoAvailabilityHide    = "hide"    // Mark the variant unavailable when it sells out
+	AutoAvailabilityRestore = "restore" // Also mark it available again when it is restocked
+)
+
+// Reasons recorded on availability changes
+const (
+	AvailabilitySoldOut   = "sold_out"
+	AvailabilityRestocked = "restocked"
+)
+
+// AvailabilityChange is one automatic flip of a variant's is_available
+type AvailabilityChange struct {
+	ID          string    `json:"id"`
+	ProductID   string    `json:"product_id"`
+	VariantID   string    `json:"variant_id"`
+	IsAvailable bool      `json:"is_available"`
+	Reason      string    `json:"reason"` // One of the Availability* constants
+	Actor       string    `json:"actor,omitempty"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// IsAutoAvailabilityMode reports whether mode is one of the AutoAvailability* constants
+func IsAutoAvailabilityMode(mode string) bool {
+	return mode == AutoAvailabilityOff || mode == AutoAvailabilityHide || mode == AutoAvailabilityRestore
+}
+
+// DefaultAutoAvailability is the mode for products without their own setting.
+// Set it with STOCK_AUTO_AVAILABILITY; it is off unless configured.
+func DefaultAutoAvailability() string {
+	if mode := os.Getenv("STOCK_AUTO_AVAILABILITY"); IsAutoAvailabilityMode(mode) {
+		return mode
+	}
+	return AutoAvailabilityOff
+}
+
+// GetAutoAvailability returns the product's own mode, empty when it follows the default
+func GetAutoAvailability(db *database.DB, productID string) (string, error) {
+	ctx, cancel := db.Context(database.Read)
+	defer cancel()
+
+	var mode string
+	err := db.Pool.QueryRow(ctx, `SELECT auto_availability FROM products WHERE id = $1`, productID).Scan(&mode)
+	if err != nil {
+		return "", dbError("getting auto availability", err)
+	}
+	return mode, nil
+}
+
+// SetAutoAvailability sets the product's own mode; an empty mode follows the default again
+func SetAutoAvailability(db *database.DB, productID, mode string) error {
+	if mode != "" && !IsAutoAvailabilityMode(mode) {
+		return fmt.Errorf("unknown auto availability mode %q", mode)
+	}
+
+	ctx, cancel := db.Context(database.Write)
+	defer cancel()
+
+	tag, err := db.Pool.Exec(ctx, `UPDATE products SET auto_availability = $1 WHERE id = $2`, mode, productID)
+	if err != nil {
+		return dbError("updating auto availability", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return notFound("product %s not found", productID)
+	}
+	return nil
+}
+
+// GetAvailabilityChanges lists the most recent automatic availability changes for a product
+func GetAvailabilityChanges(db *database.DB, productID string, limit int) ([]AvailabilityChange, error) {
+	ctx, cancel := db.Context(database.List)
+	defer cancel()
+
+	query := `
+		SELECT id, product_id, variant_id, is_available, reason, actor, created_at
+		FROM availability_changes
+		WHERE product_id = $1
+		ORDER BY created_at DESC
+		LIMIT $2
+	`
+
+	rows, err := db.Pool.Query(ctx, query, productID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("error querying availability changes: %w", err)
+	}
+	defer rows.Close()
+
+	var changes []AvailabilityChange
+	for rows.Next() {
+		var c AvailabilityChange
+		if err := rows.Scan(&c.ID, &c.ProductID, &c.VariantID, &c.IsAvailable, &c.Reason, &c.Actor, &c.CreatedAt); err != nil {
+			return nil, fmt.Errorf("error scanning availability change: %w", err)
+		}
+		changes = append(changes, c)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating availability changes: %w", err)
+	}
+
+	return changes, nil
+}
+
+// applyAutoAvailability flips the variant's is_available after its stock went from previous to
+// its current count, recording the change inside the adjusting transaction. A restock only makes
+// the variant available again when it was the sell-out that hid it, not an admin.
+func applyAutoAvailability(ctx context.Context, tx pgx.Tx, productID string, variant *ProductVariant, previous int, mode, actor string) error {
+	if mode == "" {
+		mode = DefaultAutoAvailability()
+	}
+
+	var reason string
+	switch {
+	case mode == AutoAvailabilityOff:
+		return nil
+	case previous > 0 && variant.StockCount == 0 && variant.IsAvailable:
+		reason = AvailabilitySoldOut
+	case mode == AutoAvailabilityRestore && previous == 0 && variant.StockCount > 0 && !variant.IsAvailable:
+		var last string
+		err := tx.QueryRow(ctx, `
+			SELECT reason FROM availability_changes
+			WHERE product_id = $1 AND variant_id = $2
+			ORDER BY created_at DESC
+			LIMIT 1
+		`, productID, variant.ID).Scan(&last)
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil
+		}
+		if err != nil {
+			return dbError("getting last availability change", err)
+		}
+		if last != AvailabilitySoldOut {
+			return nil
+		}
+		reason = AvailabilityRestocked
+	default:
+		return nil
+	}
+
+	variant.IsAvailable = reason == AvailabilityRestocked
+	_, err := tx.Exec(ctx, `
+		INSERT INTO availability_changes (product_id, variant_id, is_available, reason, actor)
+		VALUES ($1, $2, $3, $4, $5)
+	`, productID, variant.ID, variant.IsAvailable, reason, actor)
+	if err != nil {
+		return fmt.Errorf("error recording availability change: %w", err)
+	}
+	return nil
+}
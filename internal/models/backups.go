@@ -0,0 +1,169 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/ngenohkevin/kuiper_admin/internal/database"
+)
+
+// Outcomes of a backup
+const (
+	BackupSucceeded = "succeeded"
+	BackupFailed    = "failed"
+)
+
+// backupHistoryLimit is how many backups the backups page lists
+const backupHistoryLimit = 30
+
+// BackupRun is one database backup, reported by whatever took it
+type BackupRun struct {
+	ID         string    `json:"id"`
+	Status     string    `json:"status"` // BackupSucceeded or BackupFailed
+	Source     string    `json:"source"` // What took it, e.g. "nightly pg_dump"
+	Note       string    `json:"note"`
+	FinishedAt time.Time `json:"finished_at"`
+	RecordedBy string    `json:"recorded_by"` // The admin or API token that reported it
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+// BackupMaxAge is how old the last successful backup may be before bulk deletes and merges
+// ask for confirmation. Override with BACKUP_MAX_AGE_HOURS.
+func BackupMaxAge() time.Duration {
+	if s := os.Getenv("BACKUP_MAX_AGE_HOURS"); s != "" {
+		if hours, err := strconv.Atoi(s); err == nil && hours > 0 {
+			return time.Duration(hours) * time.Hour
+		}
+	}
+	return 24 * time.Hour
+}
+
+// BackupCheck is whether there's a recent enough backup to undo a destructive operation from
+type BackupCheck struct {
+	LastSuccess *time.Time    `json:"last_success"` // nil when no successful backup has been reported
+	MaxAge      time.Duration `json:"max_age"`
+}
+
+// Stale reports whether the last successful backup is older than the window, or missing, so
+// the admin has to confirm they want to go ahead without one
+func (c BackupCheck) Stale() bool {
+	return c.LastSuccess == nil || time.Since(*c.LastSuccess) > c.MaxAge
+}
+
+// Describe says when the last successful backup was, e.g. "The last successful backup
+// finished 3 days ago"
+func (c BackupCheck) Describe() string {
+	if c.LastSuccess == nil {
+		return "No successful backup has been recorded"
+	}
+	return "The last successful backup finished " + backupAge(time.Since(*c.LastSuccess)) + " ago"
+}
+
+// Acknowledged is the note added to the activity history when an admin goes ahead without a
+// recent backup
+func (c BackupCheck) Acknowledged() string {
+	if c.LastSuccess == nil {
+		return "no backup on record, acknowledged"
+	}
+	return "last backup " + backupAge(time.Since(*c.LastSuccess)) + " old, acknowledged"
+}
+
+// backupAge renders how long ago a backup was, in hours below two days and days after
+func backupAge(d time.Duration) string {
+	if hours := int(d.Hours()); hours < 48 {
+		if hours == 1 {
+			return "1 hour"
+		}
+		return strconv.Itoa(max(hours, 0)) + " hours"
+	}
+	return strconv.Itoa(int(d.Hours()/24)) + " days"
+}
+
+// CheckBackup looks up the last successful backup against BackupMaxAge
+func CheckBackup(db *database.DB) (BackupCheck, error) {
+	ctx, cancel := db.Context(database.Read)
+	defer cancel()
+
+	check := BackupCheck{MaxAge: BackupMaxAge()}
+	var last time.Time
+	err := db.Pool.QueryRow(ctx, `
+		SELECT finished_at FROM backup_runs
+		WHERE status = $1
+		ORDER BY finished_at DESC
+		LIMIT 1
+	`, BackupSucceeded).Scan(&last)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return check, nil
+	}
+	if err != nil {
+		return check, dbError("checking last backup", err)
+	}
+	check.LastSuccess = &last
+	return check, nil
+}
+
+// RecordBackup notes a backup that has finished. A zero FinishedAt means now.
+func RecordBackup(db *database.DB, run BackupRun) (BackupRun, error) {
+	run.Source = strings.TrimSpace(run.Source)
+	run.Note = strings.TrimSpace(run.Note)
+	if run.Status == "" {
+		run.Status = BackupSucceeded
+	}
+	if run.Status != BackupSucceeded && run.Status != BackupFailed {
+		return BackupRun{}, fmt.Errorf("status must be %s or %s", BackupSucceeded, BackupFailed)
+	}
+	if run.FinishedAt.IsZero() {
+		run.FinishedAt = time.Now()
+	}
+	if run.FinishedAt.After(time.Now().Add(5 * time.Minute)) {
+		return BackupRun{}, fmt.Errorf("finished_at can't be in the future")
+	}
+
+	ctx, cancel := db.Context(database.Write)
+	defer cancel()
+
+	err := db.Pool.QueryRow(ctx, `
+		INSERT INTO backup_runs (status, source, note, finished_at, recorded_by)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING id, created_at
+	`, run.Status, run.Source, run.Note, run.FinishedAt, run.RecordedBy).Scan(&run.ID, &run.CreatedAt)
+	if err != nil {
+		return BackupRun{}, dbError("recording backup", err)
+	}
+	return run, nil
+}
+
+// GetBackupRuns lists the most recent backups, newest first
+func GetBackupRuns(db *database.DB) ([]BackupRun, error) {
+	ctx, cancel := db.Context(database.List)
+	defer cancel()
+
+	rows, err := db.Pool.Query(ctx, `
+		SELECT id, status, source, note, finished_at, recorded_by, created_at
+		FROM backup_runs
+		ORDER BY finished_at DESC
+		LIMIT $1
+	`, backupHistoryLimit)
+	if err != nil {
+		return nil, dbError("getting backups", err)
+	}
+	defer rows.Close()
+
+	runs := []BackupRun{}
+	for rows.Next() {
+		var b BackupRun
+		if err := rows.Scan(&b.ID, &b.Status, &b.Source, &b.Note, &b.FinishedAt, &b.RecordedBy, &b.CreatedAt); err != nil {
+			return nil, fmt.Errorf("error scanning backup: %w", err)
+		}
+		runs = append(runs, b)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating backups: %w", err)
+	}
+	return runs, nil
+}
@@ -0,0 +1,253 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/ngenohkevin/kuiper_admin/internal/database"
+)
+
+// Places on the storefront a banner can be shown
+const (
+	BannerAnnouncement = "announcement" // Thin bar across the top of every page
+	BannerHomeHero     = "home_hero"    // Large banner at the top of the home page
+	BannerHomePromo    = "home_promo"   // Smaller promos further down the home page
+	BannerProductPage  = "product_page" // Beside the product details
+)
+
+// BannerPlacements lists the placements in the order the admin offers them, with their labels
+var BannerPlacements = []struct{ Value, Label string }{
+	{BannerAnnouncement, "Announcement bar"},
+	{BannerHomeHero, "Home page hero"},
+	{BannerHomePromo, "Home page promo"},
+	{BannerProductPage, "Product pages"},
+}
+
+// Banner statuses, worked out from the enabled flag and the active window
+const (
+	BannerActive    = "active"
+	BannerScheduled = "scheduled"
+	BannerEnded     = "ended"
+	BannerDisabled  = "disabled"
+)
+
+// maxBannerTitleLength matches the title column
+const maxBannerTitleLength = 200
+
+// Banner is a storefront announcement or promo, shown in its placement while enabled and within
+// its window. Either end of the window may be left open.
+type Banner struct {
+	ID        string     `json:"id"`
+	Title     string     `json:"title"`
+	Body      string     `json:"body"`
+	ImageURL  string     `json:"image_url"`
+	LinkURL   string     `json:"link_url"`
+	Placement string     `json:"placement"`
+	StartsAt  *time.Time `json:"starts_at"`
+	EndsAt    *time.Time `json:"ends_at"`
+	Enabled   bool       `json:"enabled"`
+	CreatedAt time.Time  `json:"created_at"`
+	UpdatedAt time.Time  `json:"updated_at"`
+}
+
+// Status says whether the banner is showing at now, waiting for its window, past it or switched off
+func (b Banner) Status(now time.Time) string {
+	switch {
+	case !b.Enabled:
+		return BannerDisabled
+	case b.StartsAt != nil && now.Before(*b.StartsAt):
+		return BannerScheduled
+	case b.EndsAt != nil && !now.Before(*b.EndsAt):
+		return BannerEnded
+	}
+	return BannerActive
+}
+
+// ValidBannerPlacement reports whether placement is one of BannerPlacements
+func ValidBannerPlacement(placement string) bool {
+	for _, p := range BannerPlacements {
+		if p.Value == placement {
+			return true
+		}
+	}
+	return false
+}
+
+// validateBannerURL accepts an absolute http(s) URL or a path on the storefront, such as
+// /products/some-slug
+func validateBannerURL(field, raw string) (string, error) {
+	raw = strings.TrimSpace(raw)
+	if raw == "" || (strings.HasPrefix(raw, "/") && !strings.HasPrefix(raw, "//")) {
+		return raw, nil
+	}
+	u, err := url.Parse(raw)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return "", fmt.Errorf("%s must be a path such as /products or a full http(s) URL", field)
+	}
+	return raw, nil
+}
+
+// validate tidies the banner's fields and checks them
+func (b *Banner) validate() error {
+	b.Title = strings.TrimSpace(b.Title)
+	b.Body = strings.TrimSpace(b.Body)
+	if b.Title == "" {
+		return fmt.Errorf("title is required")
+	}
+	if len([]rune(b.Title)) > maxBannerTitleLength {
+		return fmt.Errorf("title can be at most %d characters", maxBannerTitleLength)
+	}
+	if !ValidBannerPlacement(b.Placement) {
+		return fmt.Errorf("choose where the banner is shown")
+	}
+	if b.StartsAt != nil && b.EndsAt != nil && !b.EndsAt.After(*b.StartsAt) {
+		return fmt.Errorf("the banner must end after it starts")
+	}
+	var err error
+	if b.ImageURL, err = validateBannerURL("image", b.ImageURL); err != nil {
+		return err
+	}
+	if b.LinkURL, err = validateBannerURL("link", b.LinkURL); err != nil {
+		return err
+	}
+	return nil
+}
+
+const bannerColumns = `id, title, body, image_url, link_url, placement, starts_at, ends_at, enabled, created_at, updated_at`
+
+// scanBanner reads a row selected with bannerColumns
+func scanBanner(row pgx.Row) (Banner, error) {
+	var b Banner
+	err := row.Scan(
+		&b.ID, &b.Title, &b.Body, &b.ImageURL, &b.LinkURL, &b.Placement,
+		&b.StartsAt, &b.EndsAt, &b.Enabled, &b.CreatedAt, &b.UpdatedAt,
+	)
+	return b, err
+}
+
+// GetBanners lists every banner by placement, soonest first
+func GetBanners(db *database.DB) ([]Banner, error) {
+	return queryBanners(db, `ORDER BY placement, starts_at NULLS FIRST, created_at`)
+}
+
+// GetActiveBanners lists the banners showing at now, in one placement or all of them when
+// placement is empty
+func GetActiveBanners(db *database.DB, placement string, now time.Time) ([]Banner, error) {
+	return queryBanners(db, `
+		WHERE enabled
+		  AND (starts_at IS NULL OR starts_at <= $1)
+		  AND (ends_at IS NULL OR ends_at > $1)
+		  AND ($2 = '' OR placement = $2)
+		ORDER BY placement, starts_at NULLS FIRST, created_at
+	`, now, placement)
+}
+
+// queryBanners selects banners with the given WHERE and ORDER BY clauses
+func queryBanners(db *database.DB, clauses string, args ...interface{}) ([]Banner, error) {
+	ctx, cancel := db.Context(database.List)
+	defer cancel()
+
+	rows, err := db.Pool.Query(ctx, `SELECT `+bannerColumns+` FROM banners `+clauses, args...)
+	if err != nil {
+		return nil, dbError("getting banners", err)
+	}
+	defer rows.Close()
+
+	banners := []Banner{}
+	for rows.Next() {
+		b, err := scanBanner(rows)
+		if err != nil {
+			return nil, fmt.Errorf("error scanning banner: %w", err)
+		}
+		banners = append(banners, b)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating banners: %w", err)
+	}
+
+	return banners, nil
+}
+
+// GetBannerByID retrieves a single banner
+func GetBannerByID(db *database.DB, id string) (Banner, error) {
+	ctx, cancel := db.Context(database.Read)
+	defer cancel()
+
+	b, err := scanBanner(db.Pool.QueryRow(ctx, `SELECT `+bannerColumns+` FROM banners WHERE id = $1`, id))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return Banner{}, notFound("banner not found")
+	}
+	if err != nil {
+		return Banner{}, dbError("finding banner", err)
+	}
+
+	return b, nil
+}
+
+// CreateBanner saves a new banner
+func CreateBanner(db *database.DB, b Banner) (Banner, error) {
+	if err := b.validate(); err != nil {
+		return Banner{}, err
+	}
+
+	ctx, cancel := db.Context(database.Write)
+	defer cancel()
+
+	created, err := scanBanner(db.Pool.QueryRow(ctx, `
+		INSERT INTO banners (title, body, image_url, link_url, placement, starts_at, ends_at, enabled)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		RETURNING `+bannerColumns,
+		b.Title, b.Body, b.ImageURL, b.LinkURL, b.Placement, b.StartsAt, b.EndsAt, b.Enabled))
+	if err != nil {
+		return Banner{}, dbError("creating banner", err)
+	}
+
+	return created, nil
+}
+
+// UpdateBanner saves changes to a banner
+func UpdateBanner(db *database.DB, b Banner) (Banner, error) {
+	if err := b.validate(); err != nil {
+		return Banner{}, err
+	}
+
+	ctx, cancel := db.Context(database.Write)
+	defer cancel()
+
+	updated, err := scanBanner(db.Pool.QueryRow(ctx, `
+		UPDATE banners
+		SET title = $2, body = $3, image_url = $4, link_url = $5, placement = $6,
+		    starts_at = $7, ends_at = $8, enabled = $9, updated_at = CURRENT_TIMESTAMP
+		WHERE id = $1
+		RETURNING `+bannerColumns,
+		b.ID, b.Title, b.Body, b.ImageURL, b.LinkURL, b.Placement, b.StartsAt, b.EndsAt, b.Enabled))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return Banner{}, notFound("banner not found")
+	}
+	if err != nil {
+		return Banner{}, dbError("updating banner", err)
+	}
+
+	return updated, nil
+}
+
+// DeleteBanner removes a banner
+func DeleteBanner(db *database.DB, id string) error {
+	ctx, cancel := db.Context(database.Write)
+	defer cancel()
+
+	tag, err := db.Pool.Exec(ctx, `DELETE FROM banners WHERE id = $1`, id)
+	if err != nil {
+		return dbError("deleting banner", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return notFound("banner not found")
+	}
+
+	return nil
+}
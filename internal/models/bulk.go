@@ -0,0 +1,275 @@
+package models
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/ngenohkevin/kuiper_admin/internal/database"
+	"github.com/ngenohkevin/kuiper_admin/internal/money"
+)
+
+// Ways a bulk price change can adjust prices
+const (
+	PriceChangePercent = "percent" // Raise or lower by a percentage, e.g. -10
+	PriceChangeAmount  = "amount"  // Add or subtract a fixed amount
+	PriceChangeSet     = "set"     // Set every price to the value
+)
+
+// PriceChange is a bulk price change applied to products and optionally their variants
+type PriceChange struct {
+	Mode            string  `json:"mode"`  // One of the PriceChange* constants
+	Value           float64 `json:"value"` // A percentage, or an amount in currency units
+	IncludeVariants bool    `json:"include_variants"`
+}
+
+// Validate checks the mode and value before anything is computed
+func (c PriceChange) Validate() error {
+	switch c.Mode {
+	case PriceChangePercent:
+		if c.Value <= -100 {
+			return fmt.Errorf("a percentage change must be above -100%%")
+		}
+	case PriceChangeAmount:
+	case PriceChangeSet:
+		if c.Value < 0 {
+			return fmt.Errorf("price cannot be negative")
+		}
+	default:
+		return fmt.Errorf("unknown price change %q", c.Mode)
+	}
+	return nil
+}
+
+// Apply returns the new price; percentage changes are rounded to the nearest cent
+func (c PriceChange) Apply(price money.Amount) money.Amount {
+	switch c.Mode {
+	case PriceChangePercent:
+		return price.Percent(c.Value)
+	case PriceChangeAmount:
+		return price + money.FromFloat(c.Value)
+	case PriceChangeSet:
+		return money.FromFloat(c.Value)
+	}
+	return price
+}
+
+// PriceChangeRow is one price a bulk change touches: a product's own price, or one of its variants'
+type PriceChangeRow struct {
+	ProductID   string       `json:"product_id"`
+	ProductName string       `json:"product_name"`
+	VariantID   string       `json:"variant_id,omitempty"`
+	VariantName string       `json:"variant_name,omitempty"`
+	OldPrice    money.Amount `json:"old_price"`
+	NewPrice    money.Amount `json:"new_price"`
+	Error       string       `json:"error,omitempty"`
+}
+
+// BulkChangePrices applies the change to the given live products in one transaction and returns
+// every price it touched. Nothing is written when any row fails validation or when dryRun is set,
+// so a dry run shows exactly what applying would do.
+func BulkChangePrices(db *database.DB, ids []string, change PriceChange, dryRun bool) ([]PriceChangeRow, error) {
+	if err := change.Validate(); err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := db.Context(database.Bulk)
+	defer cancel()
+
+	tx, err := db.Pool.Begin(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("error starting transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	rows, err := tx.Query(ctx, `
+		SELECT id, name, price, COALESCE(variants, '[]'::jsonb)
+		FROM products
+		WHERE id = ANY($1::uuid[]) AND deleted_at IS NULL
+		ORDER BY name
+		FOR UPDATE
+	`, ids)
+	if err != nil {
+		return nil, fmt.Errorf("error querying products: %w", err)
+	}
+
+	type update struct {
+		id       string
+		price    money.Amount
+		variants []ProductVariant
+	}
+	var changes []PriceChangeRow
+	var updates []update
+	failed := false
+	for rows.Next() {
+		var u update
+		var name string
+		var variantsJSON []byte
+		if err := rows.Scan(&u.id, &name, &u.price, &variantsJSON); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("error scanning product: %w", err)
+		}
+		if err := json.Unmarshal(variantsJSON, &u.variants); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("error parsing variants JSON of product %s: %w", u.id, err)
+		}
+
+		row := PriceChangeRow{ProductID: u.id, ProductName: name, OldPrice: u.price, NewPrice: change.Apply(u.price)}
+		u.price = row.NewPrice
+		if row.NewPrice < 0 {
+			row.Error = "price would be negative"
+			failed = true
+		}
+		changes = append(changes, row)
+
+		if change.IncludeVariants {
+			for i, v := range u.variants {
+				row := PriceChangeRow{
+					ProductID: u.id, ProductName: name, VariantID: v.ID, VariantName: v.Name,
+					OldPrice: v.Price, NewPrice: change.Apply(v.Price),
+				}
+				if row.NewPrice < 0 {
+					row.Error = "price would be negative"
+					failed = true
+				}
+				u.variants[i].Price = row.NewPrice
+				changes = append(changes, row)
+			}
+		}
+		updates = append(updates, u)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating products: %w", err)
+	}
+
+	if dryRun || failed {
+		return changes, nil
+	}
+
+	for _, u := range updates {
+		variantsJSON, err := json.Marshal(u.variants)
+		if err != nil {
+			return nil, fmt.Errorf("error marshaling variants to JSON: %w", err)
+		}
+		_, err = tx.Exec(ctx, `
+			UPDATE products SET price = $2, variants = $3::jsonb, updated_at = CURRENT_TIMESTAMP
+			WHERE id = $1
+		`, u.id, u.price, string(variantsJSON))
+		if err != nil {
+			return nil, fmt.Errorf("error updating product price: %w", err)
+		}
+		if err := syncVariantRows(ctx, tx, u.id); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, fmt.Errorf("error committing price change: %w", err)
+	}
+
+	invalidateProductCache(db)
+	changed := make([]string, len(updates))
+	for i, u := range updates {
+		changed[i] = u.id
+	}
+	announceProductChanges(db, changed...)
+	return changes, nil
+}
+
+// PriceChangeActivity is the timeline entry for each price a bulk change moved, without an
+// actor. A change with a failed row wasn't applied at all, so it has none.
+func PriceChangeActivity(rows []PriceChangeRow) []ActivityEvent {
+	var events []ActivityEvent
+	for _, row := range rows {
+		if row.Error != "" {
+			return nil
+		}
+		if row.OldPrice == row.NewPrice {
+			continue
+		}
+		summary := "Price " + row.OldPrice.Format() + " → " + row.NewPrice.Format() + " (bulk change)"
+		if row.VariantID != "" {
+			summary = row.VariantName + ": price " + row.OldPrice.Format() + " → " + row.NewPrice.Format() + " (bulk change)"
+		}
+		events = append(events, ActivityEvent{
+			EntityType: ActivityProduct, EntityID: row.ProductID, Action: ActivityPriceChanged, Summary: summary,
+			PriceDrop: PriceDrop(row.OldPrice, row.NewPrice),
+		})
+	}
+	return events
+}
+
+// BulkDeleteRow is one product a bulk delete would move to the trash
+type BulkDeleteRow struct {
+	ProductID   string `json:"product_id"`
+	ProductName string `json:"product_name"`
+	Variants    int    `json:"variants"`
+	Reviews     int    `json:"reviews"`
+}
+
+// BulkDeleteProducts moves the given live products to the trash in one transaction and lists them
+// with the variants and reviews that go with them. A dry run lists them without deleting anything.
+func BulkDeleteProducts(db *database.DB, ids []string, dryRun bool) ([]BulkDeleteRow, error) {
+	ctx, cancel := db.Context(database.Bulk)
+	defer cancel()
+
+	tx, err := db.Pool.Begin(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("error starting transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	rows, err := tx.Query(ctx, `
+		SELECT p.id, p.name, jsonb_array_length(COALESCE(p.variants, '[]'::jsonb)),
+		       (SELECT COUNT(*) FROM reviews r WHERE r.product_id = p.id AND r.deleted_at IS NULL)
+		FROM products p
+		WHERE p.id = ANY($1::uuid[]) AND p.deleted_at IS NULL
+		ORDER BY p.name
+		FOR UPDATE OF p
+	`, ids)
+	if err != nil {
+		return nil, fmt.Errorf("error querying products: %w", err)
+	}
+
+	var deletes []BulkDeleteRow
+	for rows.Next() {
+		var row BulkDeleteRow
+		if err := rows.Scan(&row.ProductID, &row.ProductName, &row.Variants, &row.Reviews); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("error scanning product: %w", err)
+		}
+		deletes = append(deletes, row)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating products: %w", err)
+	}
+
+	if dryRun || len(deletes) == 0 {
+		return deletes, nil
+	}
+
+	if _, err := tx.Exec(ctx, `
+		UPDATE products SET deleted_at = CURRENT_TIMESTAMP
+		WHERE id = ANY($1::uuid[]) AND deleted_at IS NULL
+	`, ids); err != nil {
+		return nil, fmt.Errorf("error deleting products: %w", err)
+	}
+
+	// Reviews go to the trash with their products so restoring a product brings them back
+	deleted := make([]string, 0, len(deletes))
+	for _, row := range deletes {
+		deleted = append(deleted, row.ProductID)
+	}
+	if err := handleProductDependents(ctx, tx, deleted, DependentsCascade); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, fmt.Errorf("error committing bulk delete: %w", err)
+	}
+
+	invalidateProductCache(db)
+	announceProductChanges(db, deleted...)
+	return deletes, nil
+}
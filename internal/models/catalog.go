@@ -0,0 +1,114 @@
+package models
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/ngenohkevin/kuiper_admin/internal/database"
+)
+
+// GetCatalogProducts lists the products the storefront may show: live and not archived, with
+// the sale price of any promotion running now. Variants are only loaded when withVariants is
+// set, with one query for the whole page.
+func GetCatalogProducts(db *database.DB, page, pageSize int, categoryID string, withVariants bool) (*PaginatedResult[Product], error) {
+	result, err := GetProductsPaginated(db, page, pageSize, categoryID, "", "", "", false)
+	if err != nil || len(result.Data) == 0 {
+		return result, err
+	}
+
+	// The paginated result is shared through the cache, so attach sales and variants to a copy
+	products := make([]Product, len(result.Data))
+	copy(products, result.Data)
+	if err := ApplyPromotions(db, products, time.Now()); err != nil {
+		return nil, err
+	}
+	paged := *result
+	paged.Data = products
+	if !withVariants {
+		return &paged, nil
+	}
+
+	ctx, cancel := db.Context(database.List)
+	defer cancel()
+
+	index := make(map[string]int, len(products))
+	ids := make([]string, len(products))
+	for i, p := range products {
+		index[p.ID] = i
+		ids[i] = p.ID
+	}
+
+	rows, err := db.Pool.Query(ctx, `SELECT id, variants FROM products WHERE id = ANY($1::uuid[])`, ids)
+	if err != nil {
+		return nil, fmt.Errorf("error querying product variants: %w", err)
+	}
+	defer rows.Close()
+
+	fromJSON := map[string][]ProductVariant{}
+	for rows.Next() {
+		var id string
+		var raw []byte
+		if err := rows.Scan(&id, &raw); err != nil {
+			return nil, fmt.Errorf("error scanning product variants: %w", err)
+		}
+		var variants []ProductVariant
+		if len(raw) > 0 {
+			if err := json.Unmarshal(raw, &variants); err != nil {
+				log.Printf("Error parsing variants JSON for product %s: %v", id, err)
+				continue
+			}
+		}
+		fromJSON[id] = variants
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating product variants: %w", err)
+	}
+	rows.Close()
+
+	// The variants table may be read instead, or checked against the JSONB, while it's rolled out
+	for id, variants := range readVariants(ctx, db, fromJSON) {
+		SortVariants(variants)
+		for i := range variants {
+			if variants[i].Name == "" {
+				variants[i].Name = variants[i].QuantityLabel()
+			}
+		}
+		products[index[id]].Variants = variants
+	}
+
+	return &paged, nil
+}
+
+// GetCatalogProduct finds a live, unarchived product by ID or slug, with its sale price while
+// a promotion applies
+func GetCatalogProduct(db *database.DB, idOrSlug string) (Product, error) {
+	ctx, cancel := db.Context(database.Read)
+	defer cancel()
+
+	var id string
+	err := db.Pool.QueryRow(ctx, `
+		SELECT id FROM products
+		WHERE (id::text = $1 OR slug = $1) AND deleted_at IS NULL AND archived_at IS NULL
+	`, idOrSlug).Scan(&id)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return Product{}, notFound("product %s not found", idOrSlug)
+	}
+	if err != nil {
+		return Product{}, dbError("finding product", err)
+	}
+
+	product, err := GetProductByID(db, id)
+	if err != nil {
+		return Product{}, err
+	}
+	promoted := []Product{product}
+	if err := ApplyPromotions(db, promoted, time.Now()); err != nil {
+		return Product{}, err
+	}
+	return promoted[0], nil
+}
@@ -0,0 +1,102 @@
+package models
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/ngenohkevin/kuiper_admin/internal/database"
+	"github.com/ngenohkevin/kuiper_admin/internal/live"
+	"github.com/ngenohkevin/kuiper_admin/internal/money"
+)
+
+// CatalogStock is what the storefront's stock stream sends for a changed product: enough to
+// update its price, sale and availability without fetching the whole product again
+type CatalogStock struct {
+	ProductID   string         `json:"product_id"`
+	Slug        string         `json:"slug,omitempty"`
+	Listed      bool           `json:"listed"` // False once the product is deleted or archived; the rest is then empty
+	Price       money.Amount   `json:"price"`
+	Sale        *Sale          `json:"sale,omitempty"`
+	StockCount  int            `json:"stock_count"`
+	IsAvailable bool           `json:"is_available"`
+	Summary     VariantSummary `json:"variant_summary"`
+}
+
+// GetCatalogStock reads the price, sale and stock of products, in the order of ids. Products
+// that are deleted, archived or don't exist come back unlisted.
+func GetCatalogStock(db *database.DB, ids []string) ([]CatalogStock, error) {
+	if len(ids) == 0 {
+		return nil, nil
+	}
+
+	ctx, cancel := db.Context(database.Read)
+	defer cancel()
+
+	rows, err := db.Pool.Query(ctx, `
+		SELECT p.id, p.category_id, p.slug, p.price, p.stock_count, p.is_available,
+		       vs.variant_count, vs.min_price, vs.max_price, vs.total_stock
+		FROM products p`+variantSummaryJoin+`
+		WHERE p.id = ANY($1::uuid[]) AND p.deleted_at IS NULL AND p.archived_at IS NULL
+	`, ids)
+	if err != nil {
+		return nil, dbError("querying product stock", err)
+	}
+	defer rows.Close()
+
+	var products []Product
+	for rows.Next() {
+		var p Product
+		if err := rows.Scan(
+			&p.ID, &p.CategoryID, &p.Slug, &p.Price, &p.StockCount, &p.IsAvailable,
+			&p.Summary.Count, &p.Summary.MinPrice, &p.Summary.MaxPrice, &p.Summary.TotalStock,
+		); err != nil {
+			return nil, fmt.Errorf("error scanning product stock: %w", err)
+		}
+		products = append(products, p)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating product stock: %w", err)
+	}
+	rows.Close()
+
+	if err := ApplyPromotions(db, products, time.Now()); err != nil {
+		return nil, err
+	}
+
+	listed := make(map[string]Product, len(products))
+	for _, p := range products {
+		listed[p.ID] = p
+	}
+	stock := make([]CatalogStock, len(ids))
+	for i, id := range ids {
+		p, ok := listed[id]
+		if !ok {
+			stock[i] = CatalogStock{ProductID: id}
+			continue
+		}
+		stock[i] = CatalogStock{
+			ProductID: p.ID, Slug: p.Slug, Listed: true, Price: p.Price, Sale: p.Sale,
+			StockCount: p.StockCount, IsAvailable: p.IsAvailable, Summary: p.Summary,
+		}
+	}
+	return stock, nil
+}
+
+// announceProductChanges tells the storefront's stock stream that products in db changed.
+// Call it once the change is committed, so the stream reads the new values.
+func announceProductChanges(db *database.DB, productIDs ...string) {
+	if len(productIDs) > 0 {
+		live.PublishProductChanges(db.Schema, productIDs...)
+	}
+}
+
+// announceImportedProducts announces the products an import created or updated
+func announceImportedProducts(db *database.DB, results []ImportRowResult) {
+	var ids []string
+	for _, r := range results {
+		if (r.Status == ImportCreated || r.Status == ImportUpdated) && r.ProductID != "" {
+			ids = append(ids, r.ProductID)
+		}
+	}
+	announceProductChanges(db, ids...)
+}
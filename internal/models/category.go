@@ -1,7 +1,6 @@
 package models
 
 import (
-	"context"
 	"fmt"
 	"log"
 	"time"
@@ -9,8 +8,11 @@ import (
 	"github.com/google/uuid"
 	"github.com/jackc/pgx/v5/pgtype"
 	"github.com/ngenohkevin/kuiper_admin/internal/database"
+	"github.com/ngenohkevin/kuiper_admin/internal/models/sqlcdb"
 )
 
+// Category is a product category. Its fields match the columns the queries in
+// queries/categories.sql return, in order, so their generated rows convert to it directly.
 type Category struct {
 	ID        string           `json:"id"`
 	Name      string           `json:"name"`
@@ -19,75 +21,181 @@ type Category struct {
 	CreatedAt pgtype.Timestamp `json:"created_at"`
 }
 
+// categoriesCacheKey is the cache key for the full category list
+const categoriesCacheKey = "categories:all"
+
+// invalidateCategoryCache drops the cached category list after a category changes.
+// Cached product pages embed category names, so those go too.
+func invalidateCategoryCache(db *database.DB) {
+	db.Cache.DeletePrefix("categories:")
+	invalidateProductCache(db)
+}
+
 // GetAllCategories retrieves all categories from the database
 func GetAllCategories(db *database.DB) ([]Category, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
-	defer cancel()
+	// Nearly every form and list page needs the categories, so keep them cached
+	// until a category is changed
+	if cached, found := db.Cache.Get(categoriesCacheKey); found {
+		if categories, ok := cached.([]Category); ok {
+			return categories, nil
+		}
+	}
 
-	query := `
-		SELECT id, name, slug, parent_id, created_at
-		FROM categories
-		ORDER BY name
-	`
+	ctx, cancel := db.Context(database.List)
+	defer cancel()
 
-	rows, err := db.Pool.Query(ctx, query)
+	rows, err := queries(db).ListCategories(ctx)
 	if err != nil {
 		return nil, fmt.Errorf("error querying categories: %w", err)
 	}
+
+	var categories []Category
+	for _, row := range rows {
+		categories = append(categories, Category(row))
+	}
+
+	db.Cache.Set(categoriesCacheKey, categories, 30*time.Minute)
+	return categories, nil
+}
+
+// CategorySorts are the orders the category list can be sorted in
+var CategorySorts = SortOptions{
+	Columns: map[string]string{
+		"name":    "name",
+		"slug":    "slug",
+		"created": "created_at",
+	},
+	Default: "name",
+}
+
+// categoryListFilters is the WHERE clause of the category list for q's search and filter
+func categoryListFilters(q ListQuery) queryBuilder {
+	var b queryBuilder
+	b.where("deleted_at IS NULL")
+	if q.Search != "" {
+		pattern := "%" + q.Search + "%"
+		b.where("name ILIKE ? OR slug ILIKE ?", pattern, pattern)
+	}
+	switch q.Filter {
+	case "top":
+		b.where("parent_id IS NULL")
+	case "sub":
+		b.where("parent_id IS NOT NULL")
+	}
+	return b
+}
+
+// GetCategoriesPaginated retrieves a page of categories whose name or slug matches the search.
+// q.Filter is "top" for categories without a parent, "sub" for the rest, or empty for all.
+func GetCategoriesPaginated(db *database.DB, q ListQuery) (PaginatedResult[Category], error) {
+	ctx, cancel := db.Context(database.List)
+	defer cancel()
+
+	offset := q.offset()
+	b := categoryListFilters(q)
+	where := " FROM categories " + b.whereClause()
+
+	var totalCount int64
+	if err := db.Pool.QueryRow(ctx, "SELECT COUNT(*)"+where, b.args...).Scan(&totalCount); err != nil {
+		return PaginatedResult[Category]{}, fmt.Errorf("error counting categories: %w", err)
+	}
+
+	query := `SELECT id, name, slug, parent_id, created_at` + where + `
+		ORDER BY ` + CategorySorts.orderBy(q.Sort, "id") + `
+		LIMIT ` + b.arg(q.PageSize) + ` OFFSET ` + b.arg(offset)
+
+	rows, err := db.Pool.Query(ctx, query, b.args...)
+	if err != nil {
+		return PaginatedResult[Category]{}, fmt.Errorf("error querying categories: %w", err)
+	}
 	defer rows.Close()
 
 	var categories []Category
 	for rows.Next() {
 		var c Category
 		if err := rows.Scan(&c.ID, &c.Name, &c.Slug, &c.ParentID, &c.CreatedAt); err != nil {
-			return nil, fmt.Errorf("error scanning category row: %w", err)
+			return PaginatedResult[Category]{}, fmt.Errorf("error scanning category row: %w", err)
 		}
 		categories = append(categories, c)
 	}
 
 	if err := rows.Err(); err != nil {
-		return nil, fmt.Errorf("error iterating category rows: %w", err)
+		return PaginatedResult[Category]{}, fmt.Errorf("error iterating category rows: %w", err)
 	}
 
-	return categories, nil
+	return newPage(categories, totalCount, q), nil
 }
 
 // GetCategoryByID retrieves a single category by ID
 func GetCategoryByID(db *database.DB, id string) (Category, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	ctx, cancel := db.Context(database.Read)
 	defer cancel()
 
-	query := `
-		SELECT id, name, slug, parent_id, created_at
-		FROM categories
-		WHERE id = $1
-	`
+	row, err := queries(db).GetCategory(ctx, id)
+	if err != nil {
+		return Category{}, dbError("finding category", err)
+	}
 
-	var c Category
-	err := db.Pool.QueryRow(ctx, query, id).Scan(
-		&c.ID, &c.Name, &c.Slug, &c.ParentID, &c.CreatedAt,
-	)
+	return Category(row), nil
+}
+
+// GetCategoriesByIDs retrieves the given categories in a single query, keyed by ID
+func GetCategoriesByIDs(db *database.DB, ids []string) (map[string]Category, error) {
+	categories := make(map[string]Category, len(ids))
+	if len(ids) == 0 {
+		return categories, nil
+	}
+
+	ctx, cancel := db.Context(database.Read)
+	defer cancel()
+
+	rows, err := queries(db).GetCategoriesByIDs(ctx, ids)
 	if err != nil {
-		return Category{}, fmt.Errorf("error finding category: %w", err)
+		return nil, fmt.Errorf("error querying categories: %w", err)
+	}
+
+	for _, row := range rows {
+		categories[row.ID] = Category(row)
 	}
 
-	return c, nil
+	return categories, nil
+}
+
+// attachCategories fills in Category on each product from one batched lookup
+func attachCategories(db *database.DB, products []Product) error {
+	seen := make(map[string]bool)
+	var ids []string
+	for _, p := range products {
+		if p.CategoryID != nil && *p.CategoryID != "" && !seen[*p.CategoryID] {
+			seen[*p.CategoryID] = true
+			ids = append(ids, *p.CategoryID)
+		}
+	}
+
+	categories, err := GetCategoriesByIDs(db, ids)
+	if err != nil {
+		return err
+	}
+
+	for i := range products {
+		if products[i].CategoryID == nil {
+			continue
+		}
+		if c, ok := categories[*products[i].CategoryID]; ok {
+			products[i].Category = &c
+		}
+	}
+	return nil
 }
 
 // CreateCategory creates a new category in the database
 func CreateCategory(db *database.DB, name, slug string, parentID *string) (Category, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	ctx, cancel := db.Context(database.Write)
 	defer cancel()
 
 	// Generate a UUID for the new category
 	newID := uuid.New().String()
 
-	query := `
-		INSERT INTO categories (id, name, slug, parent_id)
-		VALUES ($1, $2, $3, $4)
-		RETURNING id, name, slug, parent_id, created_at
-	`
-
 	// Log the query parameters for debugging
 	parentIDValue := "<nil>"
 	if parentID != nil {
@@ -95,53 +203,61 @@ func CreateCategory(db *database.DB, name, slug string, parentID *string) (Categ
 	}
 	log.Printf("Creating category with id=%s, name=%s, slug=%s, parent_id=%s", newID, name, slug, parentIDValue)
 
-	var c Category
-	err := db.Pool.QueryRow(ctx, query, newID, name, slug, parentID).Scan(
-		&c.ID, &c.Name, &c.Slug, &c.ParentID, &c.CreatedAt,
-	)
+	row, err := queries(db).CreateCategory(ctx, sqlcdb.CreateCategoryParams{ID: newID, Name: name, Slug: slug, ParentID: parentID})
 	if err != nil {
 		log.Printf("Database error creating category: %v", err)
 		return Category{}, fmt.Errorf("error creating category: %w", err)
 	}
 
-	log.Printf("Successfully created category with ID: %s", c.ID)
-	return c, nil
+	log.Printf("Successfully created category with ID: %s", row.ID)
+	invalidateCategoryCache(db)
+	return Category(row), nil
 }
 
 // UpdateCategory updates an existing category in the database
 func UpdateCategory(db *database.DB, id, name, slug string, parentID *string) (Category, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	ctx, cancel := db.Context(database.Write)
 	defer cancel()
 
-	query := `
-		UPDATE categories
-		SET name = $2, slug = $3, parent_id = $4
-		WHERE id = $1
-		RETURNING id, name, slug, parent_id, created_at
-	`
-
-	var c Category
-	err := db.Pool.QueryRow(ctx, query, id, name, slug, parentID).Scan(
-		&c.ID, &c.Name, &c.Slug, &c.ParentID, &c.CreatedAt,
-	)
+	row, err := queries(db).UpdateCategory(ctx, sqlcdb.UpdateCategoryParams{ID: id, Name: name, Slug: slug, ParentID: parentID})
 	if err != nil {
-		return Category{}, fmt.Errorf("error updating category: %w", err)
+		return Category{}, dbError("updating category", err)
 	}
 
-	return c, nil
+	invalidateCategoryCache(db)
+	return Category(row), nil
 }
 
-// DeleteCategory deletes a category from the database
+// DeleteCategory soft-deletes a category so it can be restored with RestoreCategory
 func DeleteCategory(db *database.DB, id string) error {
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	ctx, cancel := db.Context(database.Write)
 	defer cancel()
 
-	query := `DELETE FROM categories WHERE id = $1`
+	deleted, err := queries(db).DeleteCategory(ctx, id)
+	if err != nil {
+		return dbError("deleting category", err)
+	}
+	if deleted == 0 {
+		return notFound("category %s not found", id)
+	}
+
+	invalidateCategoryCache(db)
+	return nil
+}
 
-	_, err := db.Pool.Exec(ctx, query, id)
+// RestoreCategory brings back a soft-deleted category
+func RestoreCategory(db *database.DB, id string) error {
+	ctx, cancel := db.Context(database.Write)
+	defer cancel()
+
+	restored, err := queries(db).RestoreCategory(ctx, id)
 	if err != nil {
-		return fmt.Errorf("error deleting category: %w", err)
+		return dbError("restoring category", err)
+	}
+	if restored == 0 {
+		return conflict("category %s is not deleted", id)
 	}
 
+	invalidateCategoryCache(db)
 	return nil
 }
@@ -0,0 +1,163 @@
+package models
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/ngenohkevin/kuiper_admin/internal/database"
+	"github.com/ngenohkevin/kuiper_admin/internal/money"
+)
+
+// Orders the category comparison can be sorted in
+const (
+	CategorySortRevenue    = "revenue"
+	CategorySortProducts   = "products"
+	CategorySortStockValue = "stock_value"
+	CategorySortRating     = "rating"
+	CategorySortName       = "name"
+)
+
+// categoryPerformanceOrder is the ORDER BY of each category comparison sort
+var categoryPerformanceOrder = map[string]string{
+	CategorySortRevenue:    "revenue DESC, name",
+	CategorySortProducts:   "products DESC, name",
+	CategorySortStockValue: "stock_value DESC, name",
+	CategorySortRating:     "rating DESC NULLS LAST, reviews DESC, name",
+	CategorySortName:       "name",
+}
+
+// IsCategorySort reports whether sort is one of the CategorySort* constants
+func IsCategorySort(sort string) bool {
+	_, ok := categoryPerformanceOrder[sort]
+	return ok
+}
+
+// CategoryPerformance is how one category's products are doing: what it holds now, how
+// shoppers rate it and what it sold over a period. Products without a category are gathered
+// in one with an empty ID.
+type CategoryPerformance struct {
+	CategoryID string       `json:"category_id"`
+	Name       string       `json:"name"`
+	Products   int          `json:"products"`
+	StockUnits int          `json:"stock_units"`
+	StockValue money.Amount `json:"stock_value"` // Units in stock at their selling price
+	Rating     *float64     `json:"rating"`      // Average of approved reviews, nil without any
+	Reviews    int          `json:"reviews"`
+	Orders     int          `json:"orders"`
+	UnitsSold  int          `json:"units_sold"`
+	Revenue    money.Amount `json:"revenue"`
+}
+
+// CategoryComparison compares every category over the orders placed from From up to To
+type CategoryComparison struct {
+	From       time.Time             `json:"from"`
+	To         time.Time             `json:"to"`
+	Sort       string                `json:"sort"`
+	Categories []CategoryPerformance `json:"categories"`
+}
+
+// categoryPerformanceQuery works out CategoryPerformance for the categories not in the trash,
+// and the uncategorized products, filtered by the condition $4 puts on cats.id. Sales count
+// toward the category a product is in now, and products in the trash only count toward sales.
+const categoryPerformanceQuery = `
+	WITH product_stock AS (
+	    SELECT p.id, p.category_id,
+	           CASE WHEN COALESCE(p.has_variants, false) THEN vs.units ELSE GREATEST(p.stock_count, 0) END AS units,
+	           CASE WHEN COALESCE(p.has_variants, false) THEN vs.value ELSE p.price * GREATEST(p.stock_count, 0) END AS value
+	    FROM products p
+	    LEFT JOIN LATERAL (
+	        SELECT COALESCE(SUM(GREATEST(COALESCE((v->>'stock_count')::int, 0), 0)), 0) AS units,
+	               COALESCE(SUM(COALESCE((v->>'price')::numeric, 0) * GREATEST(COALESCE((v->>'stock_count')::int, 0), 0)), 0) AS value
+	        FROM jsonb_array_elements(
+	            CASE WHEN jsonb_typeof(p.variants) = 'array' THEN p.variants ELSE '[]'::jsonb END
+	        ) AS v
+	    ) vs ON true
+	    WHERE p.deleted_at IS NULL
+	),
+	cats AS (
+	    SELECT id, name FROM categories WHERE deleted_at IS NULL
+	    UNION ALL
+	    SELECT NULL, 'Uncategorized'
+	)
+	SELECT COALESCE(cats.id::text, '') AS category_id, cats.name,
+	       s.products, s.units, s.value AS stock_value,
+	       rv.rating, rv.reviews,
+	       sales.orders, sales.units_sold, sales.revenue AS revenue
+	FROM cats
+	LEFT JOIN LATERAL (
+	    SELECT COUNT(*)::int AS products, COALESCE(SUM(units), 0)::int AS units, COALESCE(SUM(value), 0) AS value
+	    FROM product_stock ps
+	    WHERE ps.category_id IS NOT DISTINCT FROM cats.id
+	) s ON true
+	LEFT JOIN LATERAL (
+	    SELECT AVG(r.rating)::float8 AS rating, COUNT(*)::int AS reviews
+	    FROM reviews r
+	    JOIN products p ON p.id = r.product_id
+	    WHERE p.deleted_at IS NULL AND p.category_id IS NOT DISTINCT FROM cats.id
+	      AND r.status = $3 AND r.deleted_at IS NULL
+	) rv ON true
+	LEFT JOIN LATERAL (
+	    SELECT COUNT(DISTINCT i.order_id)::int AS orders, COALESCE(SUM(i.quantity), 0)::int AS units_sold,
+	           COALESCE(SUM(i.quantity * i.unit_price), 0) AS revenue
+	    FROM storefront_order_items i
+	    JOIN storefront_orders o ON o.id = i.order_id
+	    JOIN products p ON p.id = i.product_id
+	    WHERE p.category_id IS NOT DISTINCT FROM cats.id AND o.placed_at >= $1 AND o.placed_at < $2
+	) sales ON true
+	WHERE ($4 = '*' OR COALESCE(cats.id::text, '') = $4)
+	  AND (cats.id IS NOT NULL OR s.products > 0 OR sales.units_sold > 0)
+`
+
+// queryCategoryPerformance runs categoryPerformanceQuery for one category's ID, "" for the
+// uncategorized products, or "*" for every category
+func queryCategoryPerformance(db *database.DB, from, to time.Time, categoryID, order string) ([]CategoryPerformance, error) {
+	ctx, cancel := db.Context(database.List)
+	defer cancel()
+
+	rows, err := db.Pool.Query(ctx, categoryPerformanceQuery+" ORDER BY "+order, from, to, ReviewApproved, categoryID)
+	if err != nil {
+		return nil, dbError("comparing categories", err)
+	}
+	defer rows.Close()
+
+	categories := []CategoryPerformance{}
+	for rows.Next() {
+		var c CategoryPerformance
+		if err := rows.Scan(&c.CategoryID, &c.Name, &c.Products, &c.StockUnits, &c.StockValue,
+			&c.Rating, &c.Reviews, &c.Orders, &c.UnitsSold, &c.Revenue); err != nil {
+			return nil, fmt.Errorf("error scanning category performance: %w", err)
+		}
+		categories = append(categories, c)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating category performance: %w", err)
+	}
+	return categories, nil
+}
+
+// CompareCategories compares every category by its products, stock value, rating and the
+// sales of orders placed from from up to to
+func CompareCategories(db *database.DB, from, to time.Time, sort string) (CategoryComparison, error) {
+	order, ok := categoryPerformanceOrder[sort]
+	if !ok {
+		sort, order = CategorySortRevenue, categoryPerformanceOrder[CategorySortRevenue]
+	}
+
+	categories, err := queryCategoryPerformance(db, from, to, "*", order)
+	if err != nil {
+		return CategoryComparison{}, err
+	}
+	return CategoryComparison{From: from, To: to, Sort: sort, Categories: categories}, nil
+}
+
+// GetCategoryPerformance is one category's line of the comparison
+func GetCategoryPerformance(db *database.DB, from, to time.Time, categoryID string) (CategoryPerformance, error) {
+	categories, err := queryCategoryPerformance(db, from, to, categoryID, categoryPerformanceOrder[CategorySortName])
+	if err != nil {
+		return CategoryPerformance{}, err
+	}
+	if len(categories) == 0 {
+		return CategoryPerformance{}, notFound("category not found")
+	}
+	return categories[0], nil
+}
@@ -0,0 +1,101 @@
+package models
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/ngenohkevin/kuiper_admin/internal/database"
+	"github.com/ngenohkevin/kuiper_admin/internal/money"
+)
+
+// DashboardStats holds the counts and totals shown on the home page, as of the last time the
+// refresh-dashboard-stats job worked them out
+type DashboardStats struct {
+	Categories     int          `json:"categories"`
+	Products       int          `json:"products"`
+	Variants       int          `json:"variants"`
+	Reviews        int          `json:"reviews"`
+	AverageRating  *float64     `json:"average_rating"` // Of approved reviews, nil when there are none
+	Sessions       int          `json:"sessions"`
+	ActiveSessions int          `json:"active_sessions"`
+	Orders         int          `json:"orders"`
+	Revenue        money.Amount `json:"revenue"` // Total of every order the storefront has reported
+	RefreshedAt    *time.Time   `json:"refreshed_at"`
+}
+
+// dashboardStatsCacheKey is the cache key for the home page counts
+const dashboardStatsCacheKey = "dashboard:stats"
+
+// GetDashboardStats reads the home page counts from the dashboard_stats table, so the home
+// page costs the same however many rows there are. Before the job's first refresh the counts
+// are worked out there and then.
+func GetDashboardStats(db *database.DB) (DashboardStats, error) {
+	if cached, found := db.Cache.Get(dashboardStatsCacheKey); found {
+		if stats, ok := cached.(DashboardStats); ok {
+			return stats, nil
+		}
+	}
+
+	ctx, cancel := db.Context(database.Read)
+	defer cancel()
+
+	var stats DashboardStats
+	err := db.Pool.QueryRow(ctx, `
+		SELECT categories, products, variants, reviews, average_rating::float8,
+		       sessions, active_sessions, orders, revenue, refreshed_at
+		FROM dashboard_stats
+	`).Scan(
+		&stats.Categories, &stats.Products, &stats.Variants, &stats.Reviews, &stats.AverageRating,
+		&stats.Sessions, &stats.ActiveSessions, &stats.Orders, &stats.Revenue, &stats.RefreshedAt,
+	)
+	if err != nil {
+		return DashboardStats{}, dbError("getting dashboard stats", err)
+	}
+	if stats.RefreshedAt == nil {
+		cancel()
+		if err := RefreshDashboardStats(db); err != nil {
+			return DashboardStats{}, err
+		}
+		return GetDashboardStats(db)
+	}
+
+	db.Cache.Set(dashboardStatsCacheKey, stats, 30*time.Second)
+	return stats, nil
+}
+
+// RefreshDashboardStats counts every entity and totals the orders and ratings into the
+// dashboard_stats table, in a single statement
+func RefreshDashboardStats(db *database.DB) error {
+	ctx, cancel := db.Context(database.Bulk)
+	defer cancel()
+
+	_, err := db.Pool.Exec(ctx, `
+		UPDATE dashboard_stats SET
+			categories = (SELECT COUNT(*) FROM categories WHERE deleted_at IS NULL),
+			products = (SELECT COUNT(*) FROM products WHERE deleted_at IS NULL),
+			variants = (SELECT COALESCE(SUM(jsonb_array_length(variants)), 0) FROM products
+			            WHERE deleted_at IS NULL AND has_variants = true AND jsonb_typeof(variants) = 'array'),
+			reviews = (SELECT COUNT(*) FROM reviews WHERE deleted_at IS NULL),
+			average_rating = (SELECT AVG(rating) FROM reviews WHERE deleted_at IS NULL AND status = $1),
+			sessions = (SELECT COUNT(*) FROM sessions),
+			active_sessions = (SELECT COUNT(*) FROM sessions WHERE expires_at > CURRENT_TIMESTAMP),
+			orders = (SELECT COUNT(*) FROM storefront_orders),
+			revenue = (SELECT COALESCE(SUM(total), 0) FROM storefront_orders),
+			refreshed_at = CURRENT_TIMESTAMP
+	`, ReviewApproved)
+	if err != nil {
+		return dbError("refreshing dashboard stats", err)
+	}
+
+	db.Cache.Delete(dashboardStatsCacheKey)
+	return nil
+}
+
+// RatingText formats the average rating for the dashboard, e.g. "4.3 / 5", or a dash without
+// approved reviews
+func (s DashboardStats) RatingText() string {
+	if s.AverageRating == nil {
+		return "—"
+	}
+	return fmt.Sprintf("%.1f / 5", *s.AverageRating)
+}
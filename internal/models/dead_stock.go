@@ -0,0 +1,132 @@
+package models
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/ngenohkevin/kuiper_admin/internal/database"
+	"github.com/ngenohkevin/kuiper_admin/internal/money"
+)
+
+// Orders the dead stock report can be sorted in
+const (
+	DeadStockSortCapital  = "capital"   // Most capital tied up first
+	DeadStockSortStock    = "stock"     // Most units first
+	DeadStockSortLastSold = "last_sold" // Never sold, then longest since a sale
+	DeadStockSortViews    = "views"     // Fewest storefront views in the period first
+	DeadStockSortName     = "name"
+)
+
+// deadStockOrder is the ORDER BY of each dead stock sort
+var deadStockOrder = map[string]string{
+	DeadStockSortCapital:  "COALESCE(s.stock * s.cost, 0) DESC, s.stock DESC, s.name, s.variant_name",
+	DeadStockSortStock:    "s.stock DESC, s.name, s.variant_name",
+	DeadStockSortLastSold: "last.sold_at ASC NULLS FIRST, s.name, s.variant_name",
+	DeadStockSortViews:    "viewed.views, COALESCE(s.stock * s.cost, 0) DESC, s.name, s.variant_name",
+	DeadStockSortName:     "s.name, s.variant_name",
+}
+
+// IsDeadStockSort reports whether sort is one of the DeadStockSort* constants
+func IsDeadStockSort(sort string) bool {
+	_, ok := deadStockOrder[sort]
+	return ok
+}
+
+// DeadStockRow is a product, or one variant of it, with units in stock that haven't sold
+type DeadStockRow struct {
+	ProductID   string        `json:"product_id"`
+	ProductName string        `json:"product_name"`
+	VariantID   string        `json:"variant_id"` // Empty for a product without variants
+	VariantName string        `json:"variant_name"`
+	SKU         string        `json:"sku"`
+	Stock       int           `json:"stock"`
+	UnitCost    *money.Amount `json:"unit_cost"` // The product's cost, nil when unknown
+	Capital     money.Amount  `json:"capital"`   // Stock at unit cost, 0 when the cost is unknown
+	LastSoldAt  *time.Time    `json:"last_sold_at"`
+	Views       int           `json:"views"` // Storefront views of the product during the period, all variants together
+}
+
+// DeadStock is the stock that hasn't sold in Days days
+type DeadStock struct {
+	Days          int            `json:"days"`
+	Sort          string         `json:"sort"`
+	Rows          []DeadStockRow `json:"rows"`
+	Units         int            `json:"units"`
+	Capital       money.Amount   `json:"capital"`        // Tied up in the rows whose cost is known
+	UncostedUnits int            `json:"uncosted_units"` // Units whose cost is unknown
+}
+
+// GetDeadStock lists the products, and the variants of those that have them, with stock but
+// no sale in the last days days, with the capital tied up in them at the product's cost and how
+// often shoppers looked at them meanwhile. Products added within the period haven't had the
+// chance to sell and are left out, as is anything in the trash.
+func GetDeadStock(db *database.DB, days int, sort string) (DeadStock, error) {
+	if days <= 0 {
+		return DeadStock{}, fmt.Errorf("days must be a positive number")
+	}
+	order, ok := deadStockOrder[sort]
+	if !ok {
+		sort, order = DeadStockSortCapital, deadStockOrder[DeadStockSortCapital]
+	}
+
+	ctx, cancel := db.Context(database.List)
+	defer cancel()
+
+	report := DeadStock{Days: days, Sort: sort, Rows: []DeadStockRow{}}
+	rows, err := db.Pool.Query(ctx, `
+		WITH stock AS (
+		    SELECT p.id AS product_id, p.name, p.sku, '' AS variant_id, '' AS variant_name,
+		           p.stock_count AS stock, p.cost, p.created_at
+		    FROM products p
+		    WHERE p.deleted_at IS NULL AND NOT COALESCE(p.has_variants, false)
+		    UNION ALL
+		    SELECT p.id, p.name, p.sku, COALESCE(v->>'id', ''), COALESCE(v->>'name', ''),
+		           COALESCE((v->>'stock_count')::int, 0), p.cost, p.created_at
+		    FROM products p
+		    CROSS JOIN LATERAL jsonb_array_elements(
+		        CASE WHEN jsonb_typeof(p.variants) = 'array' THEN p.variants ELSE '[]'::jsonb END
+		    ) AS v
+		    WHERE p.deleted_at IS NULL AND COALESCE(p.has_variants, false)
+		)
+		SELECT s.product_id::text, s.name, s.sku, s.variant_id, s.variant_name, s.stock, s.cost, last.sold_at, viewed.views
+		FROM stock s
+		LEFT JOIN LATERAL (
+		    SELECT MAX(o.placed_at) AS sold_at
+		    FROM storefront_order_items i
+		    JOIN storefront_orders o ON o.id = i.order_id
+		    WHERE i.product_id = s.product_id AND (s.variant_id = '' OR i.variant_id = s.variant_id)
+		) last ON true
+		CROSS JOIN LATERAL (
+		    SELECT COALESCE(SUM(d.views), 0)::int AS views
+		    FROM product_views_daily d
+		    WHERE d.product_id = s.product_id AND d.day >= ($1::timestamptz AT TIME ZONE 'UTC')::date
+		) viewed
+		WHERE s.stock > 0
+		  AND COALESCE(s.created_at, '-infinity') < $1
+		  AND (last.sold_at IS NULL OR last.sold_at < $1)
+		ORDER BY `+order, time.Now().AddDate(0, 0, -days))
+	if err != nil {
+		return report, dbError("getting dead stock", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var row DeadStockRow
+		if err := rows.Scan(&row.ProductID, &row.ProductName, &row.SKU, &row.VariantID, &row.VariantName,
+			&row.Stock, &row.UnitCost, &row.LastSoldAt, &row.Views); err != nil {
+			return report, fmt.Errorf("error scanning dead stock: %w", err)
+		}
+		report.Units += row.Stock
+		if row.UnitCost != nil {
+			row.Capital = *row.UnitCost * money.Amount(row.Stock)
+			report.Capital += row.Capital
+		} else {
+			report.UncostedUnits += row.Stock
+		}
+		report.Rows = append(report.Rows, row)
+	}
+	if err := rows.Err(); err != nil {
+		return report, fmt.Errorf("error iterating dead stock: %w", err)
+	}
+	return report, nil
+}
@@ -0,0 +1,145 @@
+package models
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/ngenohkevin/kuiper_admin/internal/database"
+)
+
+// How rows that still reference a product are handled when it is deleted
+const (
+	DependentsCascade = "cascade" // Move them to the trash with the product
+	DependentsNullify = "nullify" // Keep them, clearing their reference to the product
+	DependentsAbort   = "abort"   // Refuse to delete the product
+)
+
+// productDependency is a table whose live rows reference products. Statements take the
+// product IDs as $1; cascade runs in the delete's transaction so CURRENT_TIMESTAMP matches
+// the product's deleted_at, which is how restore finds the rows to bring back.
+// Tables added later that reference products, such as order lines, belong here too.
+type productDependency struct {
+	label   string
+	sample  string // Rows for one product ($1) shown on the confirmation page, at most $2
+	count   string
+	cascade string
+	nullify string
+	restore string // Brings back the rows deleted together with the product ($1)
+}
+
+var productDependencies = []productDependency{
+	{
+		label: "reviews",
+		sample: `
+			SELECT COALESCE(NULLIF(reviewer_name, ''), 'Anonymous') || ' (' || rating || '★): ' || LEFT(comment, 80)
+			FROM reviews
+			WHERE product_id = $1 AND deleted_at IS NULL
+			ORDER BY created_at DESC
+			LIMIT $2`,
+		count:   `SELECT COUNT(*) FROM reviews WHERE product_id = ANY($1::uuid[]) AND deleted_at IS NULL`,
+		cascade: `UPDATE reviews SET deleted_at = CURRENT_TIMESTAMP WHERE product_id = ANY($1::uuid[]) AND deleted_at IS NULL`,
+		nullify: `UPDATE reviews SET product_id = NULL WHERE product_id = ANY($1::uuid[]) AND deleted_at IS NULL`,
+		restore: `
+			UPDATE reviews SET deleted_at = NULL
+			WHERE product_id = $1 AND deleted_at = (SELECT deleted_at FROM products WHERE id = $1)`,
+	},
+}
+
+// dependentSamples is how many referencing rows of each kind the confirmation page lists
+const dependentSamples = 10
+
+// ProductDependents are the live rows of one kind that reference a product
+type ProductDependents struct {
+	Label   string   `json:"label"`
+	Count   int      `json:"count"`
+	Samples []string `json:"samples"`
+}
+
+// IsDependentsOption reports whether option is a known way of handling dependents
+func IsDependentsOption(option string) bool {
+	return option == DependentsCascade || option == DependentsNullify || option == DependentsAbort
+}
+
+// GetProductDependents lists the kinds of rows that reference a product, leaving out kinds with none
+func GetProductDependents(db *database.DB, id string) ([]ProductDependents, error) {
+	ctx, cancel := db.Context(database.List)
+	defer cancel()
+
+	var dependents []ProductDependents
+	for _, dep := range productDependencies {
+		d := ProductDependents{Label: dep.label}
+		if err := db.Pool.QueryRow(ctx, dep.count, []string{id}).Scan(&d.Count); err != nil {
+			return nil, fmt.Errorf("error counting %s: %w", dep.label, err)
+		}
+		if d.Count == 0 {
+			continue
+		}
+
+		rows, err := db.Pool.Query(ctx, dep.sample, id, dependentSamples)
+		if err != nil {
+			return nil, fmt.Errorf("error querying %s: %w", dep.label, err)
+		}
+		for rows.Next() {
+			var sample string
+			if err := rows.Scan(&sample); err != nil {
+				rows.Close()
+				return nil, fmt.Errorf("error scanning %s: %w", dep.label, err)
+			}
+			d.Samples = append(d.Samples, sample)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return nil, fmt.Errorf("error iterating %s: %w", dep.label, err)
+		}
+		dependents = append(dependents, d)
+	}
+	return dependents, nil
+}
+
+// handleProductDependents applies option to the rows referencing the products inside tx.
+// Without cascade or nullify it fails if any rows reference them, like DeleteSession does.
+func handleProductDependents(ctx context.Context, tx pgx.Tx, ids []string, option string) error {
+	for _, dep := range productDependencies {
+		switch option {
+		case DependentsCascade:
+			if _, err := tx.Exec(ctx, dep.cascade, ids); err != nil {
+				return fmt.Errorf("error deleting %s: %w", dep.label, err)
+			}
+		case DependentsNullify:
+			if _, err := tx.Exec(ctx, dep.nullify, ids); err != nil {
+				return fmt.Errorf("error detaching %s: %w", dep.label, err)
+			}
+		default:
+			var count int
+			if err := tx.QueryRow(ctx, dep.count, ids).Scan(&count); err != nil {
+				return fmt.Errorf("error counting %s: %w", dep.label, err)
+			}
+			if count > 0 {
+				return conflict("cannot delete product: it is referenced by %d %s", count, dep.label)
+			}
+		}
+	}
+	return nil
+}
+
+// restoreProductDependents brings back the rows that were cascaded into the trash with the product.
+// It must run before the product's deleted_at is cleared.
+func restoreProductDependents(ctx context.Context, tx pgx.Tx, id string) error {
+	for _, dep := range productDependencies {
+		if _, err := tx.Exec(ctx, dep.restore, id); err != nil {
+			return fmt.Errorf("error restoring %s: %w", dep.label, err)
+		}
+	}
+	return nil
+}
+
+// DependentsSummary describes dependents in a sentence fragment, e.g. "3 reviews"
+func DependentsSummary(dependents []ProductDependents) string {
+	parts := make([]string, 0, len(dependents))
+	for _, d := range dependents {
+		parts = append(parts, fmt.Sprintf("%d %s", d.Count, d.Label))
+	}
+	return strings.Join(parts, " and ")
+}
@@ -0,0 +1,102 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/ngenohkevin/kuiper_admin/internal/database"
+)
+
+// ConfigSetting is one environment variable the dashboard reads, with the value it's running
+// with. Secrets only say whether they're set.
+type ConfigSetting struct {
+	Group  string `json:"group"`
+	Name   string `json:"name"`
+	Value  string `json:"value"`
+	Set    bool   `json:"set"`              // The variable is set, rather than the default being used
+	Secret bool   `json:"secret"`           // The value is withheld
+	Source string `json:"source,omitempty"` // Where a secret was read from, when not the environment
+}
+
+// MigrationStatus compares the schema version the database is at with the migrations the
+// deployment ships
+type MigrationStatus struct {
+	Version uint   `json:"version"` // The last migration applied, 0 for none
+	Dirty   bool   `json:"dirty"`   // A migration failed partway and needs fixing by hand
+	Latest  uint   `json:"latest"`  // The newest migration shipped, 0 when the directory can't be read
+	Pending []uint `json:"pending"` // Shipped migrations newer than Version
+	Error   string `json:"error,omitempty"`
+}
+
+// UpToDate reports whether every migration shipped has been applied cleanly
+func (s MigrationStatus) UpToDate() bool {
+	return s.Error == "" && !s.Dirty && len(s.Pending) == 0
+}
+
+// GetMigrationStatus reads the schema version golang-migrate records and the migration files
+// in dir. A problem reading the files is reported in the status rather than as an error, since
+// the database's version is still worth showing.
+func GetMigrationStatus(db *database.DB, dir string) (MigrationStatus, error) {
+	ctx, cancel := db.Context(database.Read)
+	defer cancel()
+
+	var status MigrationStatus
+	var version int64
+	// A tenant's own table, since the main schema's is on its search path too
+	table := "schema_migrations"
+	if db.Schema != "" {
+		table = pgx.Identifier{db.Schema, "schema_migrations"}.Sanitize()
+	}
+	err := db.Pool.QueryRow(ctx, `SELECT version, dirty FROM `+table+` LIMIT 1`).Scan(&version, &status.Dirty)
+	var pgErr *pgconn.PgError
+	switch {
+	case errors.As(err, &pgErr) && pgErr.Code == "42P01": // undefined_table, migrations were never run
+	case errors.Is(err, pgx.ErrNoRows):
+	case err != nil:
+		return status, dbError("getting schema version", err)
+	default:
+		status.Version = uint(max(version, 0))
+	}
+
+	versions, err := migrationVersions(dir)
+	if err != nil {
+		status.Error = err.Error()
+		return status, nil
+	}
+	for _, v := range versions {
+		status.Latest = max(status.Latest, v)
+		if v > status.Version {
+			status.Pending = append(status.Pending, v)
+		}
+	}
+	return status, nil
+}
+
+// migrationVersions lists the versions of the up migrations in dir, oldest first
+func migrationVersions(dir string) ([]uint, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("can't read the migrations directory: %w", err)
+	}
+
+	var versions []uint
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasSuffix(name, ".up.sql") {
+			continue
+		}
+		prefix, _, _ := strings.Cut(filepath.Base(name), "_")
+		if v, err := strconv.ParseUint(prefix, 10, 64); err == nil {
+			versions = append(versions, uint(v))
+		}
+	}
+	sort.Slice(versions, func(i, j int) bool { return versions[i] < versions[j] })
+	return versions, nil
+}
@@ -0,0 +1,246 @@
+package models
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ngenohkevin/kuiper_admin/internal/database"
+)
+
+// How often an admin is emailed a digest of catalog changes
+const (
+	DigestOff    = "off"
+	DigestDaily  = "daily"
+	DigestWeekly = "weekly"
+)
+
+// digestPriceChangeLimit is how many price changes a digest lists before summing up the rest
+const digestPriceChangeLimit = 20
+
+// DigestPeriod is how much activity a digest sent at frequency covers, which is also how long
+// to wait between them. It's zero for DigestOff.
+func DigestPeriod(frequency string) time.Duration {
+	switch frequency {
+	case DigestDaily:
+		return 24 * time.Hour
+	case DigestWeekly:
+		return 7 * 24 * time.Hour
+	}
+	return 0
+}
+
+// DigestCounts is how many of one kind of entity were created, changed in any other way, and
+// deleted over a digest's period. An entity changed several times counts once.
+type DigestCounts struct {
+	EntityType string `json:"entity_type"` // One of the Activity* entity constants
+	Created    int    `json:"created"`
+	Updated    int    `json:"updated"`
+	Deleted    int    `json:"deleted"`
+}
+
+// Digest summarises the catalog changes in the activity log between Since and Until
+type Digest struct {
+	Since             time.Time       `json:"since"`
+	Until             time.Time       `json:"until"`
+	Counts            []DigestCounts  `json:"counts"`        // Products, categories and reviews, in that order
+	PriceChanges      []ActivityEvent `json:"price_changes"` // Newest first, with the product's name in the summary
+	MorePriceChanges  int             `json:"more_price_changes"`
+	NewPendingReviews int             `json:"new_pending_reviews"` // Submitted during the period and still waiting
+	PendingReviews    int             `json:"pending_reviews"`     // The whole moderation queue
+}
+
+// Empty reports whether nothing happened during the digest's period worth emailing about
+func (d Digest) Empty() bool {
+	for _, c := range d.Counts {
+		if c.Created+c.Updated+c.Deleted > 0 {
+			return false
+		}
+	}
+	return len(d.PriceChanges) == 0 && d.NewPendingReviews == 0
+}
+
+// BuildDigest summarises the activity log from since up to until
+func BuildDigest(db *database.DB, since, until time.Time) (Digest, error) {
+	ctx, cancel := db.Context(database.List)
+	defer cancel()
+
+	digest := Digest{Since: since, Until: until}
+	counts := map[string]*DigestCounts{}
+	for _, entityType := range []string{ActivityProduct, ActivityCategory, ActivityReview} {
+		digest.Counts = append(digest.Counts, DigestCounts{EntityType: entityType})
+		counts[entityType] = &digest.Counts[len(digest.Counts)-1]
+	}
+
+	rows, err := db.Pool.Query(ctx, `
+		SELECT entity_type,
+		       COUNT(DISTINCT entity_id) FILTER (WHERE action = $3),
+		       COUNT(DISTINCT entity_id) FILTER (WHERE action NOT IN ($3, $4)),
+		       COUNT(DISTINCT entity_id) FILTER (WHERE action = $4)
+		FROM activity_events
+		WHERE created_at >= $1 AND created_at < $2
+		GROUP BY entity_type
+	`, since, until, ActivityCreated, ActivityDeleted)
+	if err != nil {
+		return digest, dbError("building digest", err)
+	}
+	for rows.Next() {
+		var c DigestCounts
+		if err := rows.Scan(&c.EntityType, &c.Created, &c.Updated, &c.Deleted); err != nil {
+			rows.Close()
+			return digest, fmt.Errorf("error scanning digest counts: %w", err)
+		}
+		if target, ok := counts[c.EntityType]; ok {
+			*target = c
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return digest, fmt.Errorf("error iterating digest counts: %w", err)
+	}
+
+	var priceChanges int
+	err = db.Pool.QueryRow(ctx, `
+		SELECT COUNT(*) FROM activity_events
+		WHERE entity_type = $1 AND action = $2 AND created_at >= $3 AND created_at < $4
+	`, ActivityProduct, ActivityPriceChanged, since, until).Scan(&priceChanges)
+	if err != nil {
+		return digest, dbError("counting price changes", err)
+	}
+	digest.PriceChanges, err = queryActivity(ctx, db, `
+		SELECT e.id, e.entity_type, e.entity_id, e.action,
+		       COALESCE(p.name, 'Deleted product') || ' · ' || e.summary, e.actor, e.created_at
+		FROM activity_events e
+		LEFT JOIN products p ON p.id::text = e.entity_id
+		WHERE e.entity_type = $1 AND e.action = $2 AND e.created_at >= $3 AND e.created_at < $4
+		ORDER BY e.created_at DESC
+		LIMIT $5
+	`, ActivityProduct, ActivityPriceChanged, since, until, digestPriceChangeLimit)
+	if err != nil {
+		return digest, err
+	}
+	digest.MorePriceChanges = priceChanges - len(digest.PriceChanges)
+
+	err = db.Pool.QueryRow(ctx, `
+		SELECT COUNT(*) FILTER (WHERE created_at >= $2), COUNT(*)
+		FROM reviews
+		WHERE status = $1 AND deleted_at IS NULL
+	`, ReviewPending, since).Scan(&digest.NewPendingReviews, &digest.PendingReviews)
+	if err != nil {
+		return digest, dbError("counting pending reviews", err)
+	}
+
+	return digest, nil
+}
+
+// Text is the digest as the body of a plain text email
+func (d Digest) Text() string {
+	var b strings.Builder
+	layout := "Jan 2, 2006 15:04"
+	fmt.Fprintf(&b, "Catalog changes from %s to %s\n\n", d.Since.In(time.Local).Format(layout), d.Until.In(time.Local).Format(layout))
+
+	for _, c := range d.Counts {
+		fmt.Fprintf(&b, "%-12s %d created, %d updated, %d deleted\n", activityEntityPlural(c.EntityType)+":", c.Created, c.Updated, c.Deleted)
+	}
+
+	if len(d.PriceChanges) > 0 {
+		b.WriteString("\nPrice changes\n")
+		for _, e := range d.PriceChanges {
+			fmt.Fprintf(&b, "- %s (%s, %s)\n", e.Summary, activityActorName(e.Actor), e.CreatedAt.In(time.Local).Format(layout))
+		}
+		if d.MorePriceChanges > 0 {
+			fmt.Fprintf(&b, "- and %d more\n", d.MorePriceChanges)
+		}
+	}
+
+	b.WriteString("\nReviews waiting for moderation: " + strconv.Itoa(d.PendingReviews))
+	if d.NewPendingReviews > 0 {
+		b.WriteString(" (" + strconv.Itoa(d.NewPendingReviews) + " new)")
+	}
+	b.WriteString("\n")
+	return b.String()
+}
+
+// activityEntityPlural names a kind of entity in the plural, capitalised, e.g. "Products"
+func activityEntityPlural(entityType string) string {
+	switch entityType {
+	case ActivityCategory:
+		return "Categories"
+	case ActivityReview:
+		return "Reviews"
+	}
+	return "Products"
+}
+
+// activityActorName names who made a change, or "system" for automated ones
+func activityActorName(actor string) string {
+	if actor == "" {
+		return "system"
+	}
+	return actor
+}
+
+// DigestSubscription is an admin who has asked for change digests
+type DigestSubscription struct {
+	Username  string
+	Email     string
+	Frequency string
+	SentAt    *time.Time // When the last digest went out, nil before the first
+}
+
+// Due reports whether the admin's next digest should go out at now
+func (s DigestSubscription) Due(now time.Time) bool {
+	period := DigestPeriod(s.Frequency)
+	return period > 0 && (s.SentAt == nil || !now.Before(s.SentAt.Add(period)))
+}
+
+// Since is where the admin's next digest picks up: the last one, or a period ago for the first
+func (s DigestSubscription) Since(now time.Time) time.Time {
+	if s.SentAt != nil {
+		return *s.SentAt
+	}
+	return now.Add(-DigestPeriod(s.Frequency))
+}
+
+// GetDigestSubscriptions lists the admins with a digest turned on and an address to send it to
+func GetDigestSubscriptions(db *database.DB) ([]DigestSubscription, error) {
+	ctx, cancel := db.Context(database.List)
+	defer cancel()
+
+	rows, err := db.Pool.Query(ctx, `
+		SELECT username, digest_email, digest_frequency, digest_sent_at
+		FROM admin_preferences
+		WHERE digest_frequency <> $1 AND digest_email <> ''
+		ORDER BY username
+	`, DigestOff)
+	if err != nil {
+		return nil, dbError("getting digest subscriptions", err)
+	}
+	defer rows.Close()
+
+	var subs []DigestSubscription
+	for rows.Next() {
+		var s DigestSubscription
+		if err := rows.Scan(&s.Username, &s.Email, &s.Frequency, &s.SentAt); err != nil {
+			return nil, fmt.Errorf("error scanning digest subscription: %w", err)
+		}
+		subs = append(subs, s)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating digest subscriptions: %w", err)
+	}
+
+	return subs, nil
+}
+
+// MarkDigestSent records that an admin's digest covering activity up to at has gone out
+func MarkDigestSent(db *database.DB, username string, at time.Time) error {
+	ctx, cancel := db.Context(database.Write)
+	defer cancel()
+
+	if _, err := db.Pool.Exec(ctx, `UPDATE admin_preferences SET digest_sent_at = $2 WHERE username = $1`, username, at); err != nil {
+		return dbError("marking digest sent", err)
+	}
+	return nil
+}
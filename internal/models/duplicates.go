@@ -0,0 +1,200 @@
+package models
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/ngenohkevin/kuiper_admin/internal/database"
+)
+
+// Reasons a group of products is flagged as likely duplicates
+const (
+	DuplicateByName  = "name"
+	DuplicateBySlug  = "slug"
+	DuplicateByImage = "image"
+)
+
+// DuplicateGroup is a set of live products that look like the same item
+type DuplicateGroup struct {
+	ID         string    `json:"id"`
+	Reason     string    `json:"reason"`    // One of the DuplicateBy* constants
+	MatchKey   string    `json:"match_key"` // The normalized name, slug stem or image hash they share
+	Products   []Product `json:"products"`
+	DetectedAt time.Time `json:"detected_at"`
+}
+
+// duplicateQueries find the groups for each reason. Each returns (match_key, product_ids).
+var duplicateQueries = map[string]string{
+	// Names equal once case, spacing and punctuation are ignored
+	DuplicateByName: `
+		SELECT lower(regexp_replace(name, '[^[:alnum:]]+', '', 'g')) AS match_key, array_agg(id ORDER BY created_at)
+		FROM products
+		WHERE deleted_at IS NULL
+		GROUP BY 1
+		HAVING COUNT(*) > 1 AND lower(regexp_replace(name, '[^[:alnum:]]+', '', 'g')) <> ''`,
+	// Slugs equal once a trailing counter or "copy" suffix is dropped, e.g. blue-dream-2
+	DuplicateBySlug: `
+		SELECT regexp_replace(slug, '(-(copy|[0-9]+))+$', '') AS match_key, array_agg(id ORDER BY created_at)
+		FROM products
+		WHERE deleted_at IS NULL
+		GROUP BY 1
+		HAVING COUNT(*) > 1`,
+	// Any image whose content is identical
+	DuplicateByImage: `
+		SELECT h.sha256 AS match_key, array_agg(DISTINCT p.id)
+		FROM products p
+		CROSS JOIN LATERAL unnest(p.image_urls) AS u(url)
+		JOIN image_hashes h ON h.url = u.url AND h.sha256 <> ''
+		WHERE p.deleted_at IS NULL
+		GROUP BY h.sha256
+		HAVING COUNT(DISTINCT p.id) > 1`,
+}
+
+// duplicateReasons is the order reasons are rebuilt and listed in
+var duplicateReasons = []string{DuplicateByName, DuplicateBySlug, DuplicateByImage}
+
+// GetUnhashedImageURLs returns up to limit product image URLs that have no stored hash yet
+func GetUnhashedImageURLs(db *database.DB, limit int) ([]string, error) {
+	ctx, cancel := db.Context(database.List)
+	defer cancel()
+
+	query := `
+		SELECT DISTINCT u.url
+		FROM products p
+		CROSS JOIN LATERAL unnest(p.image_urls) AS u(url)
+		LEFT JOIN image_hashes h ON h.url = u.url
+		WHERE p.deleted_at IS NULL AND h.url IS NULL AND u.url <> ''
+		LIMIT $1
+	`
+
+	rows, err := db.Pool.Query(ctx, query, limit)
+	if err != nil {
+		return nil, fmt.Errorf("error querying unhashed images: %w", err)
+	}
+	defer rows.Close()
+
+	var urls []string
+	for rows.Next() {
+		var url string
+		if err := rows.Scan(&url); err != nil {
+			return nil, fmt.Errorf("error scanning image url: %w", err)
+		}
+		urls = append(urls, url)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating image urls: %w", err)
+	}
+
+	return urls, nil
+}
+
+// SaveImageHash stores the content hash of an image URL; an empty hash marks it as unfetchable
+func SaveImageHash(db *database.DB, url, sha256 string) error {
+	ctx, cancel := db.Context(database.Write)
+	defer cancel()
+
+	query := `
+		INSERT INTO image_hashes (url, sha256, fetched_at)
+		VALUES ($1, $2, CURRENT_TIMESTAMP)
+		ON CONFLICT (url) DO UPDATE SET sha256 = EXCLUDED.sha256, fetched_at = EXCLUDED.fetched_at
+	`
+
+	if _, err := db.Pool.Exec(ctx, query, url, sha256); err != nil {
+		return fmt.Errorf("error saving image hash: %w", err)
+	}
+
+	return nil
+}
+
+// RebuildDuplicateReport replaces the stored report with freshly detected groups
+// and returns how many were found
+func RebuildDuplicateReport(db *database.DB) (int, error) {
+	ctx, cancel := db.Context(database.Bulk)
+	defer cancel()
+
+	tx, err := db.Pool.Begin(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("error starting transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	if _, err := tx.Exec(ctx, `DELETE FROM duplicate_groups`); err != nil {
+		return 0, fmt.Errorf("error clearing duplicate report: %w", err)
+	}
+
+	found := 0
+	for _, reason := range duplicateReasons {
+		query := fmt.Sprintf(`
+			INSERT INTO duplicate_groups (reason, match_key, product_ids)
+			SELECT $1, match_key, ids FROM (%s) AS groups(match_key, ids)
+		`, duplicateQueries[reason])
+
+		tag, err := tx.Exec(ctx, query, reason)
+		if err != nil {
+			return 0, fmt.Errorf("error detecting duplicates by %s: %w", reason, err)
+		}
+		found += int(tag.RowsAffected())
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return 0, fmt.Errorf("error committing duplicate report: %w", err)
+	}
+
+	return found, nil
+}
+
+// GetDuplicateReport lists the stored duplicate groups with their products.
+// Products deleted or merged since the last run are left out, along with groups that no longer have two.
+func GetDuplicateReport(db *database.DB) ([]DuplicateGroup, error) {
+	ctx, cancel := db.Context(database.List)
+	defer cancel()
+
+	query := `
+		SELECT g.id, g.reason, g.match_key, g.detected_at,
+		       p.id, p.name, p.slug, p.price, p.image_urls, p.stock_count, p.is_available
+		FROM duplicate_groups g
+		CROSS JOIN LATERAL unnest(g.product_ids) WITH ORDINALITY AS ids(product_id, position)
+		JOIN products p ON p.id = ids.product_id AND p.deleted_at IS NULL
+		ORDER BY array_position(ARRAY['name', 'slug', 'image']::varchar[], g.reason), g.match_key, g.id, ids.position
+	`
+
+	rows, err := db.Pool.Query(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("error querying duplicate report: %w", err)
+	}
+	defer rows.Close()
+
+	var groups []DuplicateGroup
+	for rows.Next() {
+		var g DuplicateGroup
+		var p Product
+		if err := rows.Scan(
+			&g.ID, &g.Reason, &g.MatchKey, &g.DetectedAt,
+			&p.ID, &p.Name, &p.Slug, &p.Price, &p.ImageURLs, &p.StockCount, &p.IsAvailable,
+		); err != nil {
+			return nil, fmt.Errorf("error scanning duplicate row: %w", err)
+		}
+
+		if n := len(groups); n > 0 && groups[n-1].ID == g.ID {
+			groups[n-1].Products = append(groups[n-1].Products, p)
+			continue
+		}
+		g.Products = []Product{p}
+		groups = append(groups, g)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating duplicate rows: %w", err)
+	}
+
+	// Drop groups that were resolved since the report ran
+	live := groups[:0]
+	for _, g := range groups {
+		if len(g.Products) > 1 {
+			live = append(live, g)
+		}
+	}
+
+	return live, nil
+}
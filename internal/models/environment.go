@@ -0,0 +1,61 @@
+package models
+
+import (
+	"os"
+	"regexp"
+	"strings"
+)
+
+// Environments with a band colour of their own
+const (
+	EnvironmentProduction  = "production"
+	EnvironmentStaging     = "staging"
+	EnvironmentDevelopment = "development"
+)
+
+// environmentColorPattern is what APP_ENV_COLOR may be: a hex colour such as #7c3aed
+var environmentColorPattern = regexp.MustCompile(`^#(?:[0-9a-fA-F]{3}|[0-9a-fA-F]{6})$`)
+
+// Environment is the deployment the dashboard is running in, shown as a coloured band on every
+// page so an admin can see at a glance whether they're about to edit production
+type Environment struct {
+	Name  string `json:"name"`  // From APP_ENV, lower case; empty when not configured
+	Color string `json:"color"` // The band's colour
+}
+
+// CurrentEnvironment reads APP_ENV and APP_ENV_COLOR. Production is red, staging amber and
+// anything else blue, unless APP_ENV_COLOR sets a hex colour.
+func CurrentEnvironment() Environment {
+	env := Environment{Name: strings.ToLower(strings.TrimSpace(os.Getenv("APP_ENV")))}
+	if env.Name == "" {
+		return env
+	}
+
+	switch env.Name {
+	case EnvironmentProduction:
+		env.Color = "#dc2626"
+	case EnvironmentStaging:
+		env.Color = "#d97706"
+	default:
+		env.Color = "#2563eb"
+	}
+	if c := strings.TrimSpace(os.Getenv("APP_ENV_COLOR")); environmentColorPattern.MatchString(c) {
+		env.Color = c
+	}
+	return env
+}
+
+// Configured reports whether APP_ENV is set, and so whether there's a band to show
+func (e Environment) Configured() bool {
+	return e.Name != ""
+}
+
+// IsProduction reports whether this is the production deployment
+func (e Environment) IsProduction() bool {
+	return e.Name == EnvironmentProduction
+}
+
+// Label is the environment's name as the band shows it, e.g. "STAGING"
+func (e Environment) Label() string {
+	return strings.ToUpper(e.Name)
+}
@@ -0,0 +1,58 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// Errors the model functions return when a row doesn't exist or a change clashes with the
+// data already there. They always come wrapped with details; check them with errors.Is.
+var (
+	ErrNotFound = errors.New("not found")
+	ErrConflict = errors.New("conflict")
+)
+
+// modelError is a message written for the admin that carries one of the sentinel errors
+type modelError struct {
+	message string
+	kind    error
+}
+
+func (e modelError) Error() string {
+	return e.message
+}
+
+func (e modelError) Unwrap() error {
+	return e.kind
+}
+
+// notFound reports a missing row, as in notFound("product %s not found", id)
+func notFound(format string, args ...interface{}) error {
+	return modelError{message: fmt.Sprintf(format, args...), kind: ErrNotFound}
+}
+
+// conflict reports a change the current state of the data doesn't allow
+func conflict(format string, args ...interface{}) error {
+	return modelError{message: fmt.Sprintf(format, args...), kind: ErrConflict}
+}
+
+// dbError wraps an error from a query the way the rest of the models do, adding ErrNotFound
+// when the row is missing or the ID isn't valid, and ErrConflict when the change duplicates
+// a unique value or breaks a reference. action reads like "finding product". A nil err stays nil.
+func dbError(action string, err error) error {
+	if err == nil {
+		return nil
+	}
+	var pgErr *pgconn.PgError
+	isPg := errors.As(err, &pgErr)
+	switch {
+	case errors.Is(err, pgx.ErrNoRows), isPg && pgErr.Code == "22P02": // invalid_text_representation, a malformed UUID
+		return fmt.Errorf("error %s: %w (%w)", action, err, ErrNotFound)
+	case isPg && (pgErr.Code == "23505" || pgErr.Code == "23503"): // unique_violation, foreign_key_violation
+		return fmt.Errorf("error %s: %w (%w)", action, err, ErrConflict)
+	}
+	return fmt.Errorf("error %s: %w", action, err)
+}
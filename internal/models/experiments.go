@@ -0,0 +1,359 @@
+package models
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/ngenohkevin/kuiper_admin/internal/database"
+	"github.com/ngenohkevin/kuiper_admin/internal/money"
+)
+
+// Experiment statuses. A draft can be edited away freely; once started, an experiment runs
+// until stopped and can't be started again, so its results always cover one window.
+const (
+	ExperimentDraft   = "draft"
+	ExperimentRunning = "running"
+	ExperimentStopped = "stopped"
+)
+
+// Experiment arms
+const (
+	ArmControl = "control" // The product as it is
+	ArmVariant = "variant" // The alternate price or description
+)
+
+// maxSessionIDLength matches the assignments' session_id column
+const maxSessionIDLength = 255
+
+// Experiment shows a share of storefront sessions an alternate price or description for a
+// product. Nil variant fields keep the product's own.
+type Experiment struct {
+	ID                 string        `json:"id"`
+	ProductID          string        `json:"product_id"`
+	Name               string        `json:"name"`
+	VariantPrice       *money.Amount `json:"variant_price"`
+	VariantDescription *string       `json:"variant_description"`
+	TrafficSplit       int           `json:"traffic_split"` // Percent of sessions shown the variant
+	Status             string        `json:"status"`
+	StartedAt          *time.Time    `json:"started_at,omitempty"`
+	EndedAt            *time.Time    `json:"ended_at,omitempty"`
+	CreatedAt          time.Time     `json:"created_at"`
+	Control            ArmResult     `json:"control"`
+	Variant            ArmResult     `json:"variant"`
+}
+
+// ArmResult is how the sessions in one arm of an experiment did
+type ArmResult struct {
+	Sessions    int          `json:"sessions"`
+	Converted   int          `json:"converted"`   // Sessions with at least one conversion
+	Conversions int          `json:"conversions"` // All conversions, e.g. orders
+	Revenue     money.Amount `json:"revenue"`
+}
+
+// ConversionRate is the percentage of sessions that converted
+func (a ArmResult) ConversionRate() float64 {
+	if a.Sessions == 0 {
+		return 0
+	}
+	return float64(a.Converted) * 100 / float64(a.Sessions)
+}
+
+// RevenuePerSession is the average revenue each session brought in
+func (a ArmResult) RevenuePerSession() money.Amount {
+	if a.Sessions == 0 {
+		return money.Zero
+	}
+	return money.Amount(int64(a.Revenue) / int64(a.Sessions))
+}
+
+// ExperimentAssignment is the arm a storefront session is in, with the price and description
+// it should be shown
+type ExperimentAssignment struct {
+	ExperimentID string       `json:"experiment_id,omitempty"`
+	Arm          string       `json:"arm"`
+	Price        money.Amount `json:"price"`
+	Description  string       `json:"description"`
+}
+
+// validate tidies the experiment's fields and checks it changes something
+func (e *Experiment) validate() error {
+	e.Name = strings.TrimSpace(e.Name)
+	if e.Name == "" {
+		return fmt.Errorf("experiment name is required")
+	}
+	if len([]rune(e.Name)) > 100 {
+		return fmt.Errorf("experiment name can be at most 100 characters")
+	}
+	if e.VariantDescription != nil && strings.TrimSpace(*e.VariantDescription) == "" {
+		e.VariantDescription = nil
+	}
+	if e.VariantPrice == nil && e.VariantDescription == nil {
+		return fmt.Errorf("give the variant a different price, description or both")
+	}
+	if e.VariantPrice != nil && *e.VariantPrice <= 0 {
+		return fmt.Errorf("variant price must be greater than zero")
+	}
+	if e.TrafficSplit < 1 || e.TrafficSplit > 99 {
+		return fmt.Errorf("traffic split must be between 1%% and 99%%")
+	}
+	return nil
+}
+
+// armFor places a session in an arm. The choice is a hash of the experiment and session, so a
+// session lands in the same arm every time and the split holds over many sessions.
+func armFor(experimentID, sessionID string, split int) string {
+	sum := sha256.Sum256([]byte(experimentID + ":" + sessionID))
+	if binary.BigEndian.Uint32(sum[:4])%100 < uint32(split) {
+		return ArmVariant
+	}
+	return ArmControl
+}
+
+const experimentColumns = `e.id, e.product_id, e.name, e.variant_price, e.variant_description, e.traffic_split, e.status, e.started_at, e.ended_at, e.created_at`
+
+// scanExperiment reads a row selected with experimentColumns
+func scanExperiment(row pgx.Row) (Experiment, error) {
+	var e Experiment
+	err := row.Scan(
+		&e.ID, &e.ProductID, &e.Name, &e.VariantPrice, &e.VariantDescription,
+		&e.TrafficSplit, &e.Status, &e.StartedAt, &e.EndedAt, &e.CreatedAt,
+	)
+	return e, err
+}
+
+// GetProductExperiments lists a product's experiments, newest first, with their results so far
+func GetProductExperiments(db *database.DB, productID string) ([]Experiment, error) {
+	ctx, cancel := db.Context(database.List)
+	defer cancel()
+
+	rows, err := db.Pool.Query(ctx, `
+		SELECT `+experimentColumns+`
+		FROM experiments e
+		WHERE e.product_id = $1
+		ORDER BY e.created_at DESC
+	`, productID)
+	if err != nil {
+		return nil, dbError("getting experiments", err)
+	}
+	defer rows.Close()
+
+	experiments := []Experiment{}
+	index := make(map[string]int)
+	for rows.Next() {
+		e, err := scanExperiment(rows)
+		if err != nil {
+			return nil, fmt.Errorf("error scanning experiment: %w", err)
+		}
+		index[e.ID] = len(experiments)
+		experiments = append(experiments, e)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating experiments: %w", err)
+	}
+	rows.Close()
+
+	results, err := db.Pool.Query(ctx, `
+		SELECT a.experiment_id, a.arm, COUNT(*), COUNT(*) FILTER (WHERE a.conversions > 0),
+		       COALESCE(SUM(a.conversions), 0), COALESCE(SUM(a.revenue), 0)
+		FROM experiment_assignments a
+		JOIN experiments e ON e.id = a.experiment_id
+		WHERE e.product_id = $1
+		GROUP BY a.experiment_id, a.arm
+	`, productID)
+	if err != nil {
+		return nil, dbError("getting experiment results", err)
+	}
+	defer results.Close()
+
+	for results.Next() {
+		var id, arm string
+		var result ArmResult
+		if err := results.Scan(&id, &arm, &result.Sessions, &result.Converted, &result.Conversions, &result.Revenue); err != nil {
+			return nil, fmt.Errorf("error scanning experiment results: %w", err)
+		}
+		i, ok := index[id]
+		if !ok {
+			continue
+		}
+		if arm == ArmVariant {
+			experiments[i].Variant = result
+		} else {
+			experiments[i].Control = result
+		}
+	}
+	if err := results.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating experiment results: %w", err)
+	}
+
+	return experiments, nil
+}
+
+// CreateExperiment saves a draft experiment on a product
+func CreateExperiment(db *database.DB, e Experiment) (Experiment, error) {
+	if err := e.validate(); err != nil {
+		return Experiment{}, err
+	}
+
+	ctx, cancel := db.Context(database.Write)
+	defer cancel()
+
+	created, err := scanExperiment(db.Pool.QueryRow(ctx, `
+		INSERT INTO experiments AS e (product_id, name, variant_price, variant_description, traffic_split)
+		SELECT p.id, $2, $3, $4, $5
+		FROM products p
+		WHERE p.id = $1 AND p.deleted_at IS NULL
+		RETURNING `+experimentColumns,
+		e.ProductID, e.Name, e.VariantPrice, e.VariantDescription, e.TrafficSplit))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return Experiment{}, notFound("product %s not found", e.ProductID)
+	}
+	if err != nil {
+		return Experiment{}, dbError("creating experiment", err)
+	}
+
+	return created, nil
+}
+
+// StartExperiment starts a draft experiment. A product runs one experiment at a time.
+func StartExperiment(db *database.DB, productID, id string) error {
+	ctx, cancel := db.Context(database.Write)
+	defer cancel()
+
+	tag, err := db.Pool.Exec(ctx, `
+		UPDATE experiments
+		SET status = 'running', started_at = NOW()
+		WHERE id = $1 AND product_id = $2 AND status = 'draft'
+	`, id, productID)
+	if err != nil {
+		err = dbError("starting experiment", err)
+		if errors.Is(err, ErrConflict) {
+			return conflict("another experiment is already running on this product; stop it first")
+		}
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return conflict("only a draft experiment can be started")
+	}
+
+	return nil
+}
+
+// StopExperiment ends a running experiment. Its results are kept, and conversions reported for
+// its sessions afterwards still count.
+func StopExperiment(db *database.DB, productID, id string) error {
+	ctx, cancel := db.Context(database.Write)
+	defer cancel()
+
+	tag, err := db.Pool.Exec(ctx, `
+		UPDATE experiments
+		SET status = 'stopped', ended_at = NOW()
+		WHERE id = $1 AND product_id = $2 AND status = 'running'
+	`, id, productID)
+	if err != nil {
+		return dbError("stopping experiment", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return conflict("the experiment isn't running")
+	}
+
+	return nil
+}
+
+// DeleteExperiment removes an experiment that isn't running, with its results
+func DeleteExperiment(db *database.DB, productID, id string) error {
+	ctx, cancel := db.Context(database.Write)
+	defer cancel()
+
+	tag, err := db.Pool.Exec(ctx, `
+		DELETE FROM experiments
+		WHERE id = $1 AND product_id = $2 AND status <> 'running'
+	`, id, productID)
+	if err != nil {
+		return dbError("deleting experiment", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return conflict("stop the experiment before deleting it")
+	}
+
+	return nil
+}
+
+// AssignExperiment puts a storefront session in an arm of the product's running experiment and
+// returns what the session should be shown. Without a running experiment every session gets the
+// product as it is.
+func AssignExperiment(db *database.DB, product Product, sessionID string) (ExperimentAssignment, error) {
+	assignment := ExperimentAssignment{Arm: ArmControl, Price: product.Price, Description: product.Description}
+	sessionID = strings.TrimSpace(sessionID)
+	if sessionID == "" {
+		return assignment, fmt.Errorf("session is required")
+	}
+	if len(sessionID) > maxSessionIDLength {
+		return assignment, fmt.Errorf("session can be at most %d characters", maxSessionIDLength)
+	}
+
+	ctx, cancel := db.Context(database.Write)
+	defer cancel()
+
+	e, err := scanExperiment(db.Pool.QueryRow(ctx, `
+		SELECT `+experimentColumns+`
+		FROM experiments e
+		WHERE e.product_id = $1 AND e.status = 'running'
+	`, product.ID))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return assignment, nil
+	}
+	if err != nil {
+		return assignment, dbError("finding experiment", err)
+	}
+
+	// The stored arm wins, so a session keeps its arm even if the assignment rule ever changes
+	err = db.Pool.QueryRow(ctx, `
+		INSERT INTO experiment_assignments (experiment_id, session_id, arm)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (experiment_id, session_id) DO UPDATE SET arm = experiment_assignments.arm
+		RETURNING arm
+	`, e.ID, sessionID, armFor(e.ID, sessionID, e.TrafficSplit)).Scan(&assignment.Arm)
+	if err != nil {
+		return assignment, dbError("assigning experiment arm", err)
+	}
+
+	assignment.ExperimentID = e.ID
+	if assignment.Arm == ArmVariant {
+		if e.VariantPrice != nil {
+			assignment.Price = *e.VariantPrice
+		}
+		if e.VariantDescription != nil {
+			assignment.Description = *e.VariantDescription
+		}
+	}
+	return assignment, nil
+}
+
+// RecordConversion counts a conversion, such as an order, for a session in an experiment
+func RecordConversion(db *database.DB, experimentID, sessionID string, revenue money.Amount) error {
+	if revenue < 0 {
+		return fmt.Errorf("revenue can't be negative")
+	}
+
+	ctx, cancel := db.Context(database.Write)
+	defer cancel()
+
+	tag, err := db.Pool.Exec(ctx, `
+		UPDATE experiment_assignments
+		SET conversions = conversions + 1, revenue = revenue + $3, converted_at = COALESCE(converted_at, NOW())
+		WHERE experiment_id = $1 AND session_id = $2
+	`, experimentID, sessionID, revenue)
+	if err != nil {
+		return dbError("recording conversion", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return notFound("session %s isn't in experiment %s", sessionID, experimentID)
+	}
+
+	return nil
+}
@@ -0,0 +1,249 @@
+package models
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/ngenohkevin/kuiper_admin/internal/database"
+)
+
+// exportFetchSize is how many rows an export fetches from its cursor at a time, so neither the
+// server nor the admin holds the whole result at once
+const exportFetchSize = 500
+
+// streamRows runs query through a server-side cursor and calls fn for each row, fetching
+// exportFetchSize rows at a time. The cursor lives in a read-only transaction, which also
+// keeps the rows consistent from the first fetch to the last.
+func streamRows(ctx context.Context, db *database.DB, query string, args []interface{}, fn func(pgx.Rows) error) error {
+	tx, err := db.Pool.BeginTx(ctx, pgx.TxOptions{AccessMode: pgx.ReadOnly, IsoLevel: pgx.RepeatableRead})
+	if err != nil {
+		return fmt.Errorf("error starting transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	if _, err := tx.Exec(ctx, "DECLARE export_rows NO SCROLL CURSOR FOR "+query, args...); err != nil {
+		return dbError("starting export", err)
+	}
+	for {
+		rows, err := tx.Query(ctx, fmt.Sprintf("FETCH %d FROM export_rows", exportFetchSize))
+		if err != nil {
+			return dbError("fetching export rows", err)
+		}
+		fetched := 0
+		for rows.Next() {
+			fetched++
+			if err := fn(rows); err != nil {
+				rows.Close()
+				return err
+			}
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return fmt.Errorf("error iterating export rows: %w", err)
+		}
+		if fetched < exportFetchSize {
+			return nil
+		}
+	}
+}
+
+// ProductExport picks the products an export includes: the product list's filters
+type ProductExport struct {
+	Search          string
+	CategoryID      string
+	Sort            string
+	IncludeArchived bool
+	FavoritesOf     string // Only the products this admin has starred, when set
+}
+
+// query is the export's WHERE clause and arguments. The search matches like SearchProducts.
+func (e ProductExport) query(db *database.DB) (queryBuilder, error) {
+	var b queryBuilder
+	b.where("p.deleted_at IS NULL")
+	if !e.IncludeArchived {
+		b.where("p.archived_at IS NULL")
+	}
+	if e.CategoryID != "" {
+		b.where("p.category_id = ?", e.CategoryID)
+	}
+	if e.FavoritesOf != "" {
+		b.where("p.id IN (SELECT entity_id FROM favorites WHERE username = ? AND entity_type = ?)", e.FavoritesOf, ActivityProduct)
+	}
+	if e.Search != "" {
+		if err := b.matchProductSearch(db, e.Search); err != nil {
+			return b, err
+		}
+	}
+	return b, nil
+}
+
+// CountProductExport counts the products an export will write, to report its progress against
+func CountProductExport(db *database.DB, e ProductExport) (int64, error) {
+	ctx, cancel := db.Context(database.List)
+	defer cancel()
+
+	b, err := e.query(db)
+	if err != nil {
+		return 0, err
+	}
+	var count int64
+	if err := db.Pool.QueryRow(ctx, "SELECT COUNT(*) FROM products p "+b.whereClause(), b.args...).Scan(&count); err != nil {
+		return 0, dbError("counting products to export", err)
+	}
+	return count, nil
+}
+
+// EachProductExport calls fn with every product the export includes, in the export's sort, with
+// its category and variant summary, reading them from a cursor rather than all at once
+func EachProductExport(db *database.DB, e ProductExport, fn func(Product) error) error {
+	ctx, cancel := db.Context(database.Bulk)
+	defer cancel()
+
+	sortColumns, ok := ProductSortOptions[e.Sort]
+	if !ok {
+		sortColumns = ProductSortOptions["newest"]
+	}
+	b, err := e.query(db)
+	if err != nil {
+		return err
+	}
+	query := `
+		SELECT p.id, p.category_id, p.name, p.slug, p.description,
+		       p.price, p.image_urls, p.image_alt, p.stock_count, p.is_available, p.has_variants,
+		       p.created_at, p.updated_at, p.archived_at, p.backorder, p.preorder, p.expected_at, p.sku, p.cost,
+		       vs.variant_count, vs.min_price, vs.max_price, vs.total_stock,
+		       c.id, c.name, c.slug, c.parent_id, c.created_at
+		FROM products p
+		LEFT JOIN categories c ON p.category_id = c.id AND c.deleted_at IS NULL
+		` + variantSummaryJoin + `
+		` + b.whereClause() + `
+		ORDER BY ` + productOrderBy(sortColumns)
+
+	return streamRows(ctx, db, query, b.args, func(rows pgx.Rows) error {
+		var p Product
+		var imageAlt map[string]string
+		var catID, catName, catSlug, catParentID *string
+		var catCreatedAt *time.Time
+		if err := rows.Scan(
+			&p.ID, &p.CategoryID, &p.Name, &p.Slug, &p.Description,
+			&p.Price, &p.ImageURLs, &imageAlt, &p.StockCount, &p.IsAvailable, &p.HasVariants,
+			&p.CreatedAt, &p.UpdatedAt, &p.ArchivedAt, &p.Backorder, &p.Preorder, &p.ExpectedAt, &p.SKU, &p.Cost,
+			&p.Summary.Count, &p.Summary.MinPrice, &p.Summary.MaxPrice, &p.Summary.TotalStock,
+			&catID, &catName, &catSlug, &catParentID, &catCreatedAt,
+		); err != nil {
+			return fmt.Errorf("error scanning product row: %w", err)
+		}
+		p.setImages(imageAlt)
+		if catID != nil {
+			p.Category = &Category{ID: *catID, Name: *catName, Slug: *catSlug, ParentID: catParentID}
+			if catCreatedAt != nil {
+				p.Category.CreatedAt = pgtype.Timestamp{Time: *catCreatedAt, Valid: true}
+			}
+		}
+		return fn(p)
+	})
+}
+
+// EachSegmentMember calls fn with every shopper in a segment, reading them from a cursor rather
+// than all at once
+func EachSegmentMember(db *database.DB, segment Segment, fn func(SegmentMember) error) error {
+	ctx, cancel := db.Context(database.Bulk)
+	defer cancel()
+
+	query := `SELECT ` + segmentMemberColumns + segmentMembersFrom + `
+		ORDER BY COALESCE(o.spent, 0) DESC, s.last_accessed_at DESC NULLS LAST, s.id`
+
+	return streamRows(ctx, db, query, segment.Rules.args(), func(rows pgx.Rows) error {
+		var m SegmentMember
+		if err := rows.Scan(
+			&m.SessionID, &m.ReviewerName, &m.FirstSeenAt, &m.LastSeenAt,
+			&m.Reviews, &m.LastReviewedAt, &m.Orders, &m.Spent, &m.LastOrderedAt,
+		); err != nil {
+			return fmt.Errorf("error scanning segment member: %w", err)
+		}
+		return fn(m)
+	})
+}
+
+// CategoryExport is a category as exported, with its parent's name and how many live products
+// it holds
+type CategoryExport struct {
+	Category
+	Parent   string `json:"parent"`
+	Products int    `json:"products"`
+}
+
+// EachCategoryExport calls fn with every category not in the trash that matches the category
+// list's search and filter in q, in its sort, ignoring q's page
+func EachCategoryExport(db *database.DB, q ListQuery, fn func(CategoryExport) error) error {
+	ctx, cancel := db.Context(database.Bulk)
+	defer cancel()
+
+	b := categoryListFilters(q)
+	query := `
+		SELECT id, name, slug, parent_id, created_at,
+		       COALESCE((SELECT parent.name FROM categories parent WHERE parent.id = categories.parent_id), ''),
+		       (SELECT COUNT(*) FROM products p
+		        WHERE p.category_id = categories.id AND p.deleted_at IS NULL AND p.archived_at IS NULL)
+		FROM categories
+		` + b.whereClause() + `
+		ORDER BY ` + CategorySorts.orderBy(q.Sort, "id")
+
+	return streamRows(ctx, db, query, b.args, func(rows pgx.Rows) error {
+		var c CategoryExport
+		if err := rows.Scan(&c.ID, &c.Name, &c.Slug, &c.ParentID, &c.CreatedAt, &c.Parent, &c.Products); err != nil {
+			return fmt.Errorf("error scanning category row: %w", err)
+		}
+		return fn(c)
+	})
+}
+
+// CountReviewExport counts the reviews an export of the review list will write
+func CountReviewExport(db *database.DB, q ListQuery) (int64, error) {
+	ctx, cancel := db.Context(database.List)
+	defer cancel()
+
+	b := reviewListFilters(q)
+	var count int64
+	err := db.Pool.QueryRow(ctx, `
+		SELECT COUNT(*) FROM reviews r LEFT JOIN products p ON r.product_id = p.id
+	`+b.whereClause(), b.args...).Scan(&count)
+	if err != nil {
+		return 0, dbError("counting reviews to export", err)
+	}
+	return count, nil
+}
+
+// EachReviewExport calls fn with every review matching the review list's search and status in
+// q, in its sort, with its product's name and slug, ignoring q's page
+func EachReviewExport(db *database.DB, q ListQuery, fn func(Review) error) error {
+	ctx, cancel := db.Context(database.Bulk)
+	defer cancel()
+
+	b := reviewListFilters(q)
+	query := `
+		SELECT r.id, r.product_id, r.session_id, r.rating, r.comment, r.created_at, r.reviewer_name, r.status,
+		       p.id, p.name, p.slug
+		FROM reviews r
+		LEFT JOIN products p ON r.product_id = p.id
+		` + b.whereClause() + `
+		ORDER BY ` + ReviewSorts.orderBy(q.Sort, "r.id")
+
+	return streamRows(ctx, db, query, b.args, func(rows pgx.Rows) error {
+		var r Review
+		var productID, productName, productSlug *string
+		if err := rows.Scan(
+			&r.ID, &r.ProductID, &r.SessionID, &r.Rating, &r.Comment, &r.CreatedAt, &r.ReviewerName, &r.Status,
+			&productID, &productName, &productSlug,
+		); err != nil {
+			return fmt.Errorf("error scanning review row: %w", err)
+		}
+		if productID != nil {
+			r.Product = &Product{ID: *productID, Name: *productName, Slug: *productSlug}
+		}
+		return fn(r)
+	})
+}
@@ -0,0 +1,130 @@
+package models
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/ngenohkevin/kuiper_admin/internal/database"
+)
+
+// Favorite is a product or category an admin has starred
+type Favorite struct {
+	EntityType string    `json:"entity_type"` // ActivityProduct or ActivityCategory
+	ID         string    `json:"id"`
+	Name       string    `json:"name"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+// URL links to the favorite's page
+func (f Favorite) URL() string {
+	if f.EntityType == ActivityCategory {
+		return "/categories/" + f.ID
+	}
+	return "/products/" + f.ID
+}
+
+// SetFavorite stars or unstars a product or category for an admin
+func SetFavorite(db *database.DB, username, entityType, id string, favorite bool) error {
+	if entityType != ActivityProduct && entityType != ActivityCategory {
+		return fmt.Errorf("only products and categories can be favorites")
+	}
+
+	ctx, cancel := db.Context(database.Write)
+	defer cancel()
+
+	var err error
+	if favorite {
+		_, err = db.Pool.Exec(ctx, `
+			INSERT INTO favorites (username, entity_type, entity_id) VALUES ($1, $2, $3)
+			ON CONFLICT (username, entity_type, entity_id) DO NOTHING
+		`, username, entityType, id)
+	} else {
+		_, err = db.Pool.Exec(ctx, `DELETE FROM favorites WHERE username = $1 AND entity_type = $2 AND entity_id = $3`, username, entityType, id)
+	}
+	if err != nil {
+		return dbError("saving favorite", err)
+	}
+	return nil
+}
+
+// GetFavorites lists an admin's starred products and categories that still exist, categories
+// first, then by name
+func GetFavorites(db *database.DB, username string) ([]Favorite, error) {
+	ctx, cancel := db.Context(database.List)
+	defer cancel()
+
+	rows, err := db.Pool.Query(ctx, `
+		SELECT f.entity_type, f.entity_id, COALESCE(p.name, c.name) AS name, f.created_at
+		FROM favorites f
+		LEFT JOIN products p ON f.entity_type = 'product' AND p.id = f.entity_id AND p.deleted_at IS NULL
+		LEFT JOIN categories c ON f.entity_type = 'category' AND c.id = f.entity_id AND c.deleted_at IS NULL
+		WHERE f.username = $1 AND (p.id IS NOT NULL OR c.id IS NOT NULL)
+		ORDER BY f.entity_type = 'product', name
+	`, username)
+	if err != nil {
+		return nil, dbError("getting favorites", err)
+	}
+	defer rows.Close()
+
+	var favorites []Favorite
+	for rows.Next() {
+		var f Favorite
+		if err := rows.Scan(&f.EntityType, &f.ID, &f.Name, &f.CreatedAt); err != nil {
+			return nil, fmt.Errorf("error scanning favorite: %w", err)
+		}
+		favorites = append(favorites, f)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating favorites: %w", err)
+	}
+
+	return favorites, nil
+}
+
+// GetFavoriteIDs is the set of IDs of an admin's starred products or categories, to mark them
+// on a list
+func GetFavoriteIDs(db *database.DB, username, entityType string) (map[string]bool, error) {
+	ctx, cancel := db.Context(database.List)
+	defer cancel()
+
+	rows, err := db.Pool.Query(ctx, `SELECT entity_id FROM favorites WHERE username = $1 AND entity_type = $2`, username, entityType)
+	if err != nil {
+		return nil, dbError("getting favorites", err)
+	}
+	defer rows.Close()
+
+	ids := map[string]bool{}
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, fmt.Errorf("error scanning favorite: %w", err)
+		}
+		ids[id] = true
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating favorites: %w", err)
+	}
+
+	return ids, nil
+}
+
+// GetFavoriteProducts lists an admin's starred products by name, narrowed to those matching
+// search when it's set, the way SearchProducts matches
+func GetFavoriteProducts(db *database.DB, username, search string, includeArchived bool) ([]Product, error) {
+	ctx, cancel := db.Context(database.List)
+	defer cancel()
+
+	var b queryBuilder
+	b.where("p.deleted_at IS NULL")
+	if !includeArchived {
+		b.where("p.archived_at IS NULL")
+	}
+	b.where("p.id IN (SELECT entity_id FROM favorites WHERE username = ? AND entity_type = ?)", username, ActivityProduct)
+	if search != "" {
+		if err := b.matchProductSearch(db, search); err != nil {
+			return nil, err
+		}
+	}
+
+	return queryProductList(ctx, db, b, "p.name")
+}
@@ -0,0 +1,321 @@
+package models
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/ngenohkevin/kuiper_admin/internal/database"
+)
+
+// Limits matching the packing and location columns
+const (
+	maxCarrierLength        = 50
+	maxTrackingNumberLength = 100
+	maxPickLocationLength   = 50
+)
+
+// PickSorts are the orders the pick queue can be sorted in. The oldest order comes first, so
+// orders are shipped in the order they were placed.
+var PickSorts = SortOptions{
+	Columns: map[string]string{
+		"placed": "o.placed_at",
+		"total":  "o.total",
+	},
+	Default: "placed",
+}
+
+// QueuedOrder is an order waiting to be picked
+type QueuedOrder struct {
+	Order
+	LineCount  int `json:"line_count"`
+	ShortLines int `json:"short_lines"` // Lines there isn't enough stock for, or whose product or variant is gone
+}
+
+// PickLine is one line of an order as a picker walks it: what to take, from where, and how many
+// are on the shelf
+type PickLine struct {
+	ItemID      string `json:"item_id"`
+	ProductID   string `json:"product_id"`
+	ProductName string `json:"product_name"`
+	VariantID   string `json:"variant_id"`
+	VariantName string `json:"variant_name"`
+	SKU         string `json:"sku"`
+	Location    string `json:"location"` // Empty when nobody has said where it is shelved
+	Quantity    int    `json:"quantity"`
+	InStock     *int   `json:"in_stock"` // Nil when the product or variant no longer exists
+}
+
+// Short reports whether the line can't be picked in full from the stock on record
+func (l PickLine) Short() bool {
+	return l.InStock == nil || *l.InStock < l.Quantity
+}
+
+// Packing is what the packer confirms when an order leaves
+type Packing struct {
+	Picked         []string // Item IDs of the lines ticked off as picked; every line must be
+	Carrier        string
+	TrackingNumber string // Optional, for parcels sent without one
+	Notify         bool   // Queue the customer notifications the shipped template turns on
+}
+
+// orderLineStock joins an order line i to its live product p and, for a variant line, to the
+// variant v, whose stock is v.stock
+const orderLineStock = `
+	LEFT JOIN products p ON p.id = i.product_id AND p.deleted_at IS NULL
+	LEFT JOIN LATERAL (
+	    SELECT e->>'name' AS name, COALESCE((e->>'stock_count')::int, 0) AS stock
+	    FROM jsonb_array_elements(
+	        CASE WHEN jsonb_typeof(p.variants) = 'array' THEN p.variants ELSE '[]'::jsonb END
+	    ) AS e
+	    WHERE e->>'id' = i.variant_id
+	    LIMIT 1
+	) v ON i.variant_id <> ''`
+
+// orderLineInStock is the stock of an order line's product or variant, NULL when it is gone
+const orderLineInStock = `CASE WHEN p.id IS NULL THEN NULL WHEN i.variant_id = '' THEN p.stock_count ELSE v.stock END`
+
+// pickLinesQuery selects an order's lines as PickLines, in the order they are shelved. Lines
+// without a location come last.
+const pickLinesQuery = `
+	SELECT i.id, i.product_id, COALESCE(p.name, i.product_name), i.variant_id, COALESCE(v.name, ''),
+	       COALESCE(p.sku, ''), COALESCE(l.location, ''), i.quantity, ` + orderLineInStock + `
+	FROM storefront_order_items i` + orderLineStock + `
+	LEFT JOIN pick_locations l ON l.product_id = i.product_id AND l.variant_id = i.variant_id
+	WHERE i.order_id = $1
+	ORDER BY l.location IS NULL, l.location, 3, i.variant_id`
+
+// scanPickLines reads the rows of pickLinesQuery
+func scanPickLines(rows pgx.Rows) ([]PickLine, error) {
+	defer rows.Close()
+
+	lines := []PickLine{}
+	for rows.Next() {
+		var l PickLine
+		if err := rows.Scan(&l.ItemID, &l.ProductID, &l.ProductName, &l.VariantID, &l.VariantName,
+			&l.SKU, &l.Location, &l.Quantity, &l.InStock); err != nil {
+			return nil, fmt.Errorf("error scanning pick line: %w", err)
+		}
+		lines = append(lines, l)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating pick lines: %w", err)
+	}
+	return lines, nil
+}
+
+// readyToPick reports whether an order in status is still waiting to be packed
+func readyToPick(status string) bool {
+	return status == OrderPlaced || status == OrderProcessing
+}
+
+// GetPickQueue retrieves a page of the orders waiting to be picked: those placed or processing.
+// q.Filter narrows it to one of the two.
+func GetPickQueue(db *database.DB, q ListQuery) (PaginatedResult[QueuedOrder], error) {
+	ctx, cancel := db.Context(database.List)
+	defer cancel()
+
+	offset := q.offset()
+	var b queryBuilder
+	if readyToPick(q.Filter) {
+		b.where("o.status = ?", q.Filter)
+	} else {
+		b.where("o.status IN (?, ?)", OrderPlaced, OrderProcessing)
+	}
+	if q.Search != "" {
+		pattern := "%" + q.Search + "%"
+		b.where("o.id ILIKE ? OR o.customer_email ILIKE ? OR o.customer_name ILIKE ?", pattern, pattern, pattern)
+	}
+	where := " FROM storefront_orders o " + b.whereClause()
+
+	var totalCount int64
+	if err := db.Pool.QueryRow(ctx, "SELECT COUNT(*)"+where, b.args...).Scan(&totalCount); err != nil {
+		return PaginatedResult[QueuedOrder]{}, dbError("counting orders to pick", err)
+	}
+
+	rows, err := db.Pool.Query(ctx, `
+		SELECT `+orderColumns+`,
+		       (SELECT COUNT(*) FROM storefront_order_items i WHERE i.order_id = o.id)::int,
+		       (SELECT COUNT(*) FROM storefront_order_items i`+orderLineStock+`
+		        WHERE i.order_id = o.id AND COALESCE(`+orderLineInStock+`, 0) < i.quantity)::int`+where+`
+		ORDER BY `+PickSorts.orderBy(q.Sort, "o.id")+`
+		LIMIT `+b.arg(q.PageSize)+` OFFSET `+b.arg(offset), b.args...)
+	if err != nil {
+		return PaginatedResult[QueuedOrder]{}, dbError("getting orders to pick", err)
+	}
+	defer rows.Close()
+
+	orders := []QueuedOrder{}
+	for rows.Next() {
+		var o QueuedOrder
+		if err := rows.Scan(&o.ID, &o.SessionID, &o.CustomerEmail, &o.CustomerName, &o.Total, &o.Status, &o.PlacedAt,
+			&o.StatusChangedAt, &o.ItemCount, &o.PackedAt, &o.PackedBy, &o.Carrier, &o.TrackingNumber,
+			&o.LineCount, &o.ShortLines); err != nil {
+			return PaginatedResult[QueuedOrder]{}, fmt.Errorf("error scanning order to pick: %w", err)
+		}
+		orders = append(orders, o)
+	}
+	if err := rows.Err(); err != nil {
+		return PaginatedResult[QueuedOrder]{}, fmt.Errorf("error iterating orders to pick: %w", err)
+	}
+
+	return newPage(orders, totalCount, q), nil
+}
+
+// GetPickList retrieves an order with its lines in the order they are shelved
+func GetPickList(db *database.DB, id string) (Order, []PickLine, error) {
+	order, err := GetOrder(db, id)
+	if err != nil {
+		return Order{}, nil, err
+	}
+
+	ctx, cancel := db.Context(database.Read)
+	defer cancel()
+
+	rows, err := db.Pool.Query(ctx, pickLinesQuery, id)
+	if err != nil {
+		return Order{}, nil, dbError("getting pick list", err)
+	}
+	lines, err := scanPickLines(rows)
+	if err != nil {
+		return Order{}, nil, err
+	}
+	return order, lines, nil
+}
+
+// SetPickLocation records where a product, or one of its variants, is shelved. An empty
+// location forgets it.
+func SetPickLocation(db *database.DB, productID, variantID, location, actor string) error {
+	location = strings.TrimSpace(location)
+	if len([]rune(location)) > maxPickLocationLength {
+		return fmt.Errorf("location can be at most %d characters", maxPickLocationLength)
+	}
+
+	ctx, cancel := db.Context(database.Write)
+	defer cancel()
+
+	if location == "" {
+		_, err := db.Pool.Exec(ctx, `DELETE FROM pick_locations WHERE product_id = $1 AND variant_id = $2`, productID, variantID)
+		return dbError("clearing pick location", err)
+	}
+
+	_, err := db.Pool.Exec(ctx, `
+		INSERT INTO pick_locations (product_id, variant_id, location, updated_by)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (product_id, variant_id) DO UPDATE
+		SET location = EXCLUDED.location, updated_by = EXCLUDED.updated_by, updated_at = CURRENT_TIMESTAMP
+	`, productID, variantID, location, actor)
+	return dbError("setting pick location", err)
+}
+
+// shipStockTx takes an order's lines out of stock as shipped, and returns the products whose
+// stock it changed. Lines whose product or variant is gone are left alone.
+func shipStockTx(ctx context.Context, tx pgx.Tx, id string, lines []PickLine, actor string) ([]string, error) {
+	change := StockChange{Reason: MovementShipped, Note: "Order " + id, Actor: actor}
+	var changed []string
+	for _, line := range lines {
+		if line.InStock == nil {
+			continue
+		}
+		var err error
+		if line.VariantID == "" {
+			_, err = adjustProductStockTx(ctx, tx, line.ProductID, -line.Quantity, change)
+		} else {
+			_, err = adjustVariantStockTx(ctx, tx, line.ProductID, line.VariantID, -line.Quantity, change)
+		}
+		if err != nil {
+			return nil, err
+		}
+		changed = append(changed, line.ProductID)
+	}
+	return changed, nil
+}
+
+// PackOrder ships an order once every line is ticked off as picked: the stock of each line's
+// product or variant goes down by its quantity, the order moves to shipped with the carrier and
+// tracking number, and with p.Notify the shipped notifications are queued, all in one
+// transaction. Lines whose product or variant is gone are packed without touching stock.
+func PackOrder(db *database.DB, id string, p Packing, actor string) (Order, []OrderNotification, error) {
+	p.Carrier = strings.TrimSpace(p.Carrier)
+	p.TrackingNumber = strings.TrimSpace(p.TrackingNumber)
+	if len([]rune(p.Carrier)) > maxCarrierLength {
+		return Order{}, nil, fmt.Errorf("carrier can be at most %d characters", maxCarrierLength)
+	}
+	if len(p.TrackingNumber) > maxTrackingNumberLength {
+		return Order{}, nil, fmt.Errorf("tracking number can be at most %d characters", maxTrackingNumberLength)
+	}
+
+	ctx, cancel := db.Context(database.Write)
+	defer cancel()
+
+	tx, err := db.Pool.Begin(ctx)
+	if err != nil {
+		return Order{}, nil, fmt.Errorf("error starting transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	order, err := scanOrder(tx.QueryRow(ctx, `SELECT `+orderColumns+` FROM storefront_orders o WHERE o.id = $1 FOR UPDATE`, id))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return Order{}, nil, notFound("order %s not found", id)
+	}
+	if err != nil {
+		return Order{}, nil, dbError("getting order", err)
+	}
+	if !readyToPick(order.Status) {
+		return Order{}, nil, conflict("order %s is %s, so it can't be packed", id, order.Status)
+	}
+
+	rows, err := tx.Query(ctx, pickLinesQuery, id)
+	if err != nil {
+		return Order{}, nil, dbError("getting pick list", err)
+	}
+	lines, err := scanPickLines(rows)
+	if err != nil {
+		return Order{}, nil, err
+	}
+	missing := 0
+	for _, line := range lines {
+		if !slices.Contains(p.Picked, line.ItemID) {
+			missing++
+		}
+	}
+	if missing > 0 {
+		return Order{}, nil, fmt.Errorf("tick off every line as picked before packing; %d of %d aren't", missing, len(lines))
+	}
+
+	changed, err := shipStockTx(ctx, tx, id, lines, actor)
+	if err != nil {
+		return Order{}, nil, err
+	}
+
+	previous := order.Status
+	if err := tx.QueryRow(ctx, `
+		UPDATE storefront_orders
+		SET status = $2, status_changed_at = CURRENT_TIMESTAMP, packed_at = CURRENT_TIMESTAMP,
+		    packed_by = $3, carrier = $4, tracking_number = $5
+		WHERE id = $1
+		RETURNING status, status_changed_at, packed_at, packed_by, carrier, tracking_number
+	`, id, OrderShipped, actor, p.Carrier, p.TrackingNumber).Scan(
+		&order.Status, &order.StatusChangedAt, &order.PackedAt, &order.PackedBy, &order.Carrier, &order.TrackingNumber,
+	); err != nil {
+		return Order{}, nil, dbError("shipping order", err)
+	}
+
+	var queued []OrderNotification
+	if p.Notify {
+		queued, err = queueOrderNotifications(ctx, db, tx, order, previous, actor)
+		if err != nil {
+			return Order{}, nil, err
+		}
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return Order{}, nil, fmt.Errorf("error committing packed order: %w", err)
+	}
+
+	announceProductChanges(db, changed...)
+	return order, queued, nil
+}
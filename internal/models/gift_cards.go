@@ -0,0 +1,442 @@
+package models
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/ngenohkevin/kuiper_admin/internal/database"
+	"github.com/ngenohkevin/kuiper_admin/internal/money"
+)
+
+// Kinds of gift card transaction
+const (
+	GiftCardIssue  = "issue"  // The card's starting balance
+	GiftCardAdjust = "adjust" // An admin's correction, up or down
+	GiftCardRedeem = "redeem" // Spent at checkout
+)
+
+// Gift card statuses
+const (
+	GiftCardActive  = "active"
+	GiftCardEmpty   = "empty"
+	GiftCardExpired = "expired"
+)
+
+// Limits matching the gift card columns
+const (
+	maxGiftCardReferenceLength = 100
+	maxGiftCardNoteLength      = 500
+)
+
+// giftCardAlphabet leaves out letters and digits that are easy to mix up, such as O and 0. It
+// has 32 characters, so a random byte picks one without bias.
+const giftCardAlphabet = "ABCDEFGHJKLMNPQRSTUVWXYZ23456789"
+
+// giftCardCodeLength is the number of characters in a code, shown in groups of four
+const giftCardCodeLength = 16
+
+// GiftCard is store credit the storefront accepts at checkout until it runs out or expires
+type GiftCard struct {
+	ID             string       `json:"id"`
+	Code           string       `json:"code"`
+	InitialBalance money.Amount `json:"initial_balance"`
+	Balance        money.Amount `json:"balance"`
+	ExpiresAt      *time.Time   `json:"expires_at"` // Never expires when nil
+	Note           string       `json:"note"`
+	CreatedBy      string       `json:"created_by"`
+	CreatedAt      time.Time    `json:"created_at"`
+	UpdatedAt      time.Time    `json:"updated_at"`
+}
+
+// GiftCardTransaction is one change to a gift card's balance
+type GiftCardTransaction struct {
+	ID           string       `json:"id"`
+	GiftCardID   string       `json:"gift_card_id"`
+	Kind         string       `json:"kind"`
+	Amount       money.Amount `json:"amount"` // Negative when it takes from the balance
+	BalanceAfter money.Amount `json:"balance_after"`
+	Reason       string       `json:"reason"`
+	Reference    string       `json:"reference"` // The storefront's order, for redemptions
+	CreatedBy    string       `json:"created_by"`
+	CreatedAt    time.Time    `json:"created_at"`
+}
+
+// Status says whether the card can be spent at now
+func (g GiftCard) Status(now time.Time) string {
+	switch {
+	case g.ExpiresAt != nil && !now.Before(*g.ExpiresAt):
+		return GiftCardExpired
+	case g.Balance <= 0:
+		return GiftCardEmpty
+	}
+	return GiftCardActive
+}
+
+// FormattedCode is the code in groups of four, the way it is printed for customers
+func (g GiftCard) FormattedCode() string {
+	var b strings.Builder
+	for i, r := range g.Code {
+		if i > 0 && i%4 == 0 {
+			b.WriteByte('-')
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// NormalizeGiftCardCode turns a code as a customer typed it into the stored form, ignoring case,
+// spaces and dashes
+func NormalizeGiftCardCode(code string) string {
+	return strings.Map(func(r rune) rune {
+		if r == '-' || r == ' ' {
+			return -1
+		}
+		return r
+	}, strings.ToUpper(strings.TrimSpace(code)))
+}
+
+// generateGiftCardCode picks a random code from giftCardAlphabet
+func generateGiftCardCode() (string, error) {
+	random := make([]byte, giftCardCodeLength)
+	if _, err := rand.Read(random); err != nil {
+		return "", fmt.Errorf("error generating gift card code: %w", err)
+	}
+	code := make([]byte, giftCardCodeLength)
+	for i, b := range random {
+		code[i] = giftCardAlphabet[int(b)%len(giftCardAlphabet)]
+	}
+	return string(code), nil
+}
+
+const giftCardColumns = `id, code, initial_balance, balance, expires_at, note, created_by, created_at, updated_at`
+
+// scanGiftCard reads a row selected with giftCardColumns
+func scanGiftCard(row pgx.Row) (GiftCard, error) {
+	var g GiftCard
+	err := row.Scan(&g.ID, &g.Code, &g.InitialBalance, &g.Balance, &g.ExpiresAt, &g.Note, &g.CreatedBy, &g.CreatedAt, &g.UpdatedAt)
+	return g, err
+}
+
+const giftCardTransactionColumns = `id, gift_card_id, kind, amount, balance_after, reason, reference, created_by, created_at`
+
+// scanGiftCardTransaction reads a row selected with giftCardTransactionColumns
+func scanGiftCardTransaction(row pgx.Row) (GiftCardTransaction, error) {
+	var t GiftCardTransaction
+	err := row.Scan(&t.ID, &t.GiftCardID, &t.Kind, &t.Amount, &t.BalanceAfter, &t.Reason, &t.Reference, &t.CreatedBy, &t.CreatedAt)
+	return t, err
+}
+
+// recordGiftCardTransaction adds a transaction inside tx
+func recordGiftCardTransaction(ctx context.Context, tx pgx.Tx, t GiftCardTransaction) (GiftCardTransaction, error) {
+	saved, err := scanGiftCardTransaction(tx.QueryRow(ctx, `
+		INSERT INTO gift_card_transactions (gift_card_id, kind, amount, balance_after, reason, reference, created_by)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		RETURNING `+giftCardTransactionColumns,
+		t.GiftCardID, t.Kind, t.Amount, t.BalanceAfter, t.Reason, t.Reference, t.CreatedBy))
+	if err != nil {
+		return GiftCardTransaction{}, dbError("recording gift card transaction", err)
+	}
+	return saved, nil
+}
+
+// GetGiftCards lists gift cards, newest first, only those whose code starts with search when
+// it is set
+func GetGiftCards(db *database.DB, search string) ([]GiftCard, error) {
+	ctx, cancel := db.Context(database.List)
+	defer cancel()
+
+	rows, err := db.Pool.Query(ctx, `
+		SELECT `+giftCardColumns+`
+		FROM gift_cards
+		WHERE $1 = '' OR code LIKE $1 || '%'
+		ORDER BY created_at DESC
+		LIMIT 500
+	`, NormalizeGiftCardCode(search))
+	if err != nil {
+		return nil, dbError("getting gift cards", err)
+	}
+	defer rows.Close()
+
+	cards := []GiftCard{}
+	for rows.Next() {
+		g, err := scanGiftCard(rows)
+		if err != nil {
+			return nil, fmt.Errorf("error scanning gift card: %w", err)
+		}
+		cards = append(cards, g)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating gift cards: %w", err)
+	}
+
+	return cards, nil
+}
+
+// GetGiftCardByID retrieves a single gift card
+func GetGiftCardByID(db *database.DB, id string) (GiftCard, error) {
+	ctx, cancel := db.Context(database.Read)
+	defer cancel()
+
+	g, err := scanGiftCard(db.Pool.QueryRow(ctx, `SELECT `+giftCardColumns+` FROM gift_cards WHERE id = $1`, id))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return GiftCard{}, notFound("gift card not found")
+	}
+	if err != nil {
+		return GiftCard{}, dbError("finding gift card", err)
+	}
+
+	return g, nil
+}
+
+// GetGiftCardTransactions lists a card's transactions, newest first
+func GetGiftCardTransactions(db *database.DB, giftCardID string) ([]GiftCardTransaction, error) {
+	ctx, cancel := db.Context(database.List)
+	defer cancel()
+
+	rows, err := db.Pool.Query(ctx, `
+		SELECT `+giftCardTransactionColumns+`
+		FROM gift_card_transactions
+		WHERE gift_card_id = $1
+		ORDER BY created_at DESC
+	`, giftCardID)
+	if err != nil {
+		return nil, dbError("getting gift card transactions", err)
+	}
+	defer rows.Close()
+
+	transactions := []GiftCardTransaction{}
+	for rows.Next() {
+		t, err := scanGiftCardTransaction(rows)
+		if err != nil {
+			return nil, fmt.Errorf("error scanning gift card transaction: %w", err)
+		}
+		transactions = append(transactions, t)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating gift card transactions: %w", err)
+	}
+
+	return transactions, nil
+}
+
+// IssueGiftCard creates a card with a new random code and amount on it, credited to actor
+func IssueGiftCard(db *database.DB, amount money.Amount, expiresAt *time.Time, note, actor string) (GiftCard, error) {
+	note = strings.TrimSpace(note)
+	if amount <= 0 {
+		return GiftCard{}, fmt.Errorf("amount must be greater than zero")
+	}
+	if expiresAt != nil && !expiresAt.After(time.Now()) {
+		return GiftCard{}, fmt.Errorf("expiry must be in the future")
+	}
+	if len([]rune(note)) > maxGiftCardNoteLength {
+		return GiftCard{}, fmt.Errorf("note can be at most %d characters", maxGiftCardNoteLength)
+	}
+
+	ctx, cancel := db.Context(database.Write)
+	defer cancel()
+
+	tx, err := db.Pool.Begin(ctx)
+	if err != nil {
+		return GiftCard{}, fmt.Errorf("error starting transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	// A clash between random codes is next to impossible, but a duplicate must never be issued
+	var card GiftCard
+	for attempt := 0; ; attempt++ {
+		code, err := generateGiftCardCode()
+		if err != nil {
+			return GiftCard{}, err
+		}
+		card, err = scanGiftCard(tx.QueryRow(ctx, `
+			INSERT INTO gift_cards (code, initial_balance, balance, expires_at, note, created_by)
+			VALUES ($1, $2, $2, $3, $4, $5)
+			ON CONFLICT (code) DO NOTHING
+			RETURNING `+giftCardColumns,
+			code, amount, expiresAt, note, actor))
+		if err == nil {
+			break
+		}
+		if !errors.Is(err, pgx.ErrNoRows) || attempt == 2 {
+			return GiftCard{}, dbError("issuing gift card", err)
+		}
+	}
+
+	_, err = recordGiftCardTransaction(ctx, tx, GiftCardTransaction{
+		GiftCardID: card.ID, Kind: GiftCardIssue, Amount: amount, BalanceAfter: amount, Reason: note, CreatedBy: actor,
+	})
+	if err != nil {
+		return GiftCard{}, err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return GiftCard{}, fmt.Errorf("error committing gift card: %w", err)
+	}
+
+	return card, nil
+}
+
+// AdjustGiftCard adds amount to a card's balance, or takes it off when negative, recording why
+// and who did it
+func AdjustGiftCard(db *database.DB, id string, amount money.Amount, reason, actor string) (GiftCard, error) {
+	reason = strings.TrimSpace(reason)
+	if amount == 0 {
+		return GiftCard{}, fmt.Errorf("enter an amount to add or, with a minus sign, take off")
+	}
+	if reason == "" {
+		return GiftCard{}, fmt.Errorf("a reason is required for the audit trail")
+	}
+	if len([]rune(reason)) > maxGiftCardNoteLength {
+		return GiftCard{}, fmt.Errorf("reason can be at most %d characters", maxGiftCardNoteLength)
+	}
+
+	ctx, cancel := db.Context(database.Write)
+	defer cancel()
+
+	tx, err := db.Pool.Begin(ctx)
+	if err != nil {
+		return GiftCard{}, fmt.Errorf("error starting transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	card, err := scanGiftCard(tx.QueryRow(ctx, `SELECT `+giftCardColumns+` FROM gift_cards WHERE id = $1 FOR UPDATE`, id))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return GiftCard{}, notFound("gift card not found")
+	}
+	if err != nil {
+		return GiftCard{}, dbError("finding gift card", err)
+	}
+	if card.Balance+amount < 0 {
+		return GiftCard{}, conflict("the card only has %s left", card.Balance.Format())
+	}
+
+	card, err = scanGiftCard(tx.QueryRow(ctx, `
+		UPDATE gift_cards SET balance = balance + $2, updated_at = CURRENT_TIMESTAMP
+		WHERE id = $1
+		RETURNING `+giftCardColumns, id, amount))
+	if err != nil {
+		return GiftCard{}, dbError("adjusting gift card", err)
+	}
+
+	_, err = recordGiftCardTransaction(ctx, tx, GiftCardTransaction{
+		GiftCardID: card.ID, Kind: GiftCardAdjust, Amount: amount, BalanceAfter: card.Balance, Reason: reason, CreatedBy: actor,
+	})
+	if err != nil {
+		return GiftCard{}, err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return GiftCard{}, fmt.Errorf("error committing gift card adjustment: %w", err)
+	}
+
+	return card, nil
+}
+
+// usableGiftCard explains why a card can't be spent at now, or returns nil
+func usableGiftCard(card GiftCard, now time.Time) error {
+	switch card.Status(now) {
+	case GiftCardExpired:
+		return conflict("this gift card expired on %s", card.ExpiresAt.Format("Jan 2, 2006"))
+	case GiftCardEmpty:
+		return conflict("this gift card has no balance left")
+	}
+	return nil
+}
+
+// ValidateGiftCard finds the card for a code a customer entered and checks it can be spent at now
+func ValidateGiftCard(db *database.DB, code string, now time.Time) (GiftCard, error) {
+	ctx, cancel := db.Context(database.Read)
+	defer cancel()
+
+	card, err := scanGiftCard(db.Pool.QueryRow(ctx, `SELECT `+giftCardColumns+` FROM gift_cards WHERE code = $1`, NormalizeGiftCardCode(code)))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return GiftCard{}, notFound("gift card not found")
+	}
+	if err != nil {
+		return GiftCard{}, dbError("finding gift card", err)
+	}
+
+	return card, usableGiftCard(card, now)
+}
+
+// RedeemGiftCard spends amount from the card with code for the storefront order reference. Asking
+// again for the same order returns the first redemption instead of charging the card twice.
+func RedeemGiftCard(db *database.DB, code string, amount money.Amount, reference string, now time.Time) (GiftCardTransaction, GiftCard, error) {
+	reference = strings.TrimSpace(reference)
+	if amount <= 0 {
+		return GiftCardTransaction{}, GiftCard{}, fmt.Errorf("amount must be greater than zero")
+	}
+	if reference == "" {
+		return GiftCardTransaction{}, GiftCard{}, fmt.Errorf("reference is required")
+	}
+	if len(reference) > maxGiftCardReferenceLength {
+		return GiftCardTransaction{}, GiftCard{}, fmt.Errorf("reference can be at most %d characters", maxGiftCardReferenceLength)
+	}
+
+	ctx, cancel := db.Context(database.Write)
+	defer cancel()
+
+	tx, err := db.Pool.Begin(ctx)
+	if err != nil {
+		return GiftCardTransaction{}, GiftCard{}, fmt.Errorf("error starting transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	card, err := scanGiftCard(tx.QueryRow(ctx, `SELECT `+giftCardColumns+` FROM gift_cards WHERE code = $1 FOR UPDATE`, NormalizeGiftCardCode(code)))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return GiftCardTransaction{}, GiftCard{}, notFound("gift card not found")
+	}
+	if err != nil {
+		return GiftCardTransaction{}, GiftCard{}, dbError("finding gift card", err)
+	}
+
+	previous, err := scanGiftCardTransaction(tx.QueryRow(ctx, `
+		SELECT `+giftCardTransactionColumns+`
+		FROM gift_card_transactions
+		WHERE gift_card_id = $1 AND kind = 'redeem' AND reference = $2
+	`, card.ID, reference))
+	if err == nil {
+		if previous.Amount != -amount {
+			return GiftCardTransaction{}, GiftCard{}, conflict("order %s already redeemed %s from this card", reference, (-previous.Amount).Format())
+		}
+		return previous, card, nil
+	}
+	if !errors.Is(err, pgx.ErrNoRows) {
+		return GiftCardTransaction{}, GiftCard{}, dbError("finding gift card redemption", err)
+	}
+
+	if err := usableGiftCard(card, now); err != nil {
+		return GiftCardTransaction{}, GiftCard{}, err
+	}
+	if card.Balance < amount {
+		return GiftCardTransaction{}, GiftCard{}, conflict("the card only has %s left", card.Balance.Format())
+	}
+
+	card, err = scanGiftCard(tx.QueryRow(ctx, `
+		UPDATE gift_cards SET balance = balance - $2, updated_at = CURRENT_TIMESTAMP
+		WHERE id = $1
+		RETURNING `+giftCardColumns, card.ID, amount))
+	if err != nil {
+		return GiftCardTransaction{}, GiftCard{}, dbError("redeeming gift card", err)
+	}
+
+	redemption, err := recordGiftCardTransaction(ctx, tx, GiftCardTransaction{
+		GiftCardID: card.ID, Kind: GiftCardRedeem, Amount: -amount, BalanceAfter: card.Balance, Reference: reference,
+	})
+	if err != nil {
+		return GiftCardTransaction{}, GiftCard{}, err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return GiftCardTransaction{}, GiftCard{}, fmt.Errorf("error committing gift card redemption: %w", err)
+	}
+
+	return redemption, card, nil
+}
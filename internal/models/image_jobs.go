@@ -0,0 +1,205 @@
+package models
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/ngenohkevin/kuiper_admin/internal/database"
+)
+
+// Image job statuses
+const (
+	ImageJobPending = "pending"
+	ImageJobRunning = "running"
+	ImageJobDone    = "done"
+	ImageJobFailed  = "failed"
+)
+
+// MaxImageJobAttempts is how many times a job is tried before it is marked as failed
+const MaxImageJobAttempts = 3
+
+// imageJobStaleAfter is how long a job can stay running before it is taken to have been
+// abandoned, e.g. by a server that was stopped mid-run, and is run again
+const imageJobStaleAfter = 15 * time.Minute
+
+// ImageJob runs processing steps over one of a product's images. Once done, ResultURL has
+// taken ImageURL's place in the gallery.
+type ImageJob struct {
+	ID         string     `json:"id"`
+	ProductID  string     `json:"product_id"`
+	ImageURL   string     `json:"image_url"`
+	Steps      []string   `json:"steps"`
+	Status     string     `json:"status"`
+	Attempts   int        `json:"attempts"`
+	ResultURL  string     `json:"result_url,omitempty"`
+	Error      string     `json:"error,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+	StartedAt  *time.Time `json:"started_at,omitempty"`
+	FinishedAt *time.Time `json:"finished_at,omitempty"`
+}
+
+// Active reports whether the job is still waiting or running
+func (j ImageJob) Active() bool {
+	return j.Status == ImageJobPending || j.Status == ImageJobRunning
+}
+
+const imageJobColumns = `id, product_id, image_url, steps, status, attempts, result_url, error, created_at, started_at, finished_at`
+
+// scanImageJob reads a row selected with imageJobColumns
+func scanImageJob(row pgx.Row) (ImageJob, error) {
+	var job ImageJob
+	err := row.Scan(
+		&job.ID, &job.ProductID, &job.ImageURL, &job.Steps, &job.Status, &job.Attempts,
+		&job.ResultURL, &job.Error, &job.CreatedAt, &job.StartedAt, &job.FinishedAt,
+	)
+	return job, err
+}
+
+// QueueImageJobs queues the same steps for each of a product's images. Images that already
+// have a job waiting or running are skipped, so a double submit doesn't process them twice.
+func QueueImageJobs(db *database.DB, productID string, imageURLs []string, steps []string) (int, error) {
+	if len(steps) == 0 {
+		return 0, fmt.Errorf("choose at least one processing step")
+	}
+
+	ctx, cancel := db.Context(database.Write)
+	defer cancel()
+
+	tag, err := db.Pool.Exec(ctx, `
+		INSERT INTO image_jobs (product_id, image_url, steps)
+		SELECT $1, url, $3::text[]
+		FROM unnest($2::text[]) AS url
+		WHERE NOT EXISTS (
+			SELECT 1 FROM image_jobs
+			WHERE product_id = $1 AND image_url = url AND status IN ('pending', 'running')
+		)
+	`, productID, imageURLs, steps)
+	if err != nil {
+		return 0, dbError("queueing image processing", err)
+	}
+	return int(tag.RowsAffected()), nil
+}
+
+// ClaimImageJobs marks up to limit waiting jobs as running and returns them, oldest first.
+// Jobs left running for too long are claimed again. Rows locked by another claim are skipped.
+func ClaimImageJobs(db *database.DB, limit int) ([]ImageJob, error) {
+	ctx, cancel := db.Context(database.Write)
+	defer cancel()
+
+	rows, err := db.Pool.Query(ctx, `
+		UPDATE image_jobs
+		SET status = 'running', attempts = attempts + 1, started_at = NOW()
+		WHERE id IN (
+			SELECT id FROM image_jobs
+			WHERE status = 'pending'
+			   OR (status = 'running' AND started_at < NOW() - $2::interval)
+			ORDER BY created_at
+			LIMIT $1
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING `+imageJobColumns,
+		limit, fmt.Sprintf("%d seconds", int(imageJobStaleAfter.Seconds())))
+	if err != nil {
+		return nil, dbError("claiming image jobs", err)
+	}
+	defer rows.Close()
+
+	var jobs []ImageJob
+	for rows.Next() {
+		job, err := scanImageJob(rows)
+		if err != nil {
+			return nil, fmt.Errorf("error scanning image job: %w", err)
+		}
+		jobs = append(jobs, job)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating image jobs: %w", err)
+	}
+	return jobs, nil
+}
+
+// FinishImageJob records a job's outcome. A failed job goes back in the queue until it has
+// used up its attempts.
+func FinishImageJob(db *database.DB, job ImageJob, resultURL string, jobErr error) error {
+	status, message := ImageJobDone, ""
+	if jobErr != nil {
+		status, message = ImageJobPending, jobErr.Error()
+		if job.Attempts >= MaxImageJobAttempts {
+			status = ImageJobFailed
+		}
+	}
+
+	ctx, cancel := db.Context(database.Write)
+	defer cancel()
+
+	_, err := db.Pool.Exec(ctx, `
+		UPDATE image_jobs
+		SET status = $2, result_url = $3, error = $4,
+		    finished_at = CASE WHEN $2 IN ('done', 'failed') THEN NOW() END
+		WHERE id = $1
+	`, job.ID, status, resultURL, message)
+	if err != nil {
+		return dbError("finishing image job", err)
+	}
+	return nil
+}
+
+// GetImageJobs lists a product's most recent image jobs, newest first
+func GetImageJobs(db *database.DB, productID string, limit int) ([]ImageJob, error) {
+	ctx, cancel := db.Context(database.List)
+	defer cancel()
+
+	rows, err := db.Pool.Query(ctx, `
+		SELECT `+imageJobColumns+`
+		FROM image_jobs
+		WHERE product_id = $1
+		ORDER BY created_at DESC
+		LIMIT $2
+	`, productID, limit)
+	if err != nil {
+		return nil, dbError("getting image jobs", err)
+	}
+	defer rows.Close()
+
+	var jobs []ImageJob
+	for rows.Next() {
+		job, err := scanImageJob(rows)
+		if err != nil {
+			return nil, fmt.Errorf("error scanning image job: %w", err)
+		}
+		jobs = append(jobs, job)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating image jobs: %w", err)
+	}
+	return jobs, nil
+}
+
+// ReplaceProductImage swaps one gallery image for another in place, carrying its alt text over.
+// It reports false when the product no longer has the old image, e.g. because it was removed
+// while the replacement was being made.
+func ReplaceProductImage(db *database.DB, productID, oldURL, newURL string) (bool, error) {
+	ctx, cancel := db.Context(database.Write)
+	defer cancel()
+
+	tag, err := db.Pool.Exec(ctx, `
+		UPDATE products
+		SET image_urls = array_replace(image_urls, $2, $3),
+		    image_alt = CASE
+		        WHEN image_alt ? $2 THEN (image_alt - $2) || jsonb_build_object($3::text, image_alt -> $2)
+		        ELSE image_alt
+		    END,
+		    updated_at = CURRENT_TIMESTAMP
+		WHERE id = $1 AND deleted_at IS NULL AND $2 = ANY(image_urls)
+	`, productID, oldURL, newURL)
+	if err != nil {
+		return false, dbError("replacing product image", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return false, nil
+	}
+
+	invalidateProductCache(db)
+	return true, nil
+}
@@ -0,0 +1,211 @@
+package models
+
+import (
+	"fmt"
+	"log"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ngenohkevin/kuiper_admin/internal/database"
+)
+
+// imageURLMigrationHistoryLimit is how many past image host moves the maintenance page lists
+const imageURLMigrationHistoryLimit = 20
+
+// ImageURLMigration is one rewrite of product image URLs from one prefix to another, kept as a
+// record of when image hosting moved
+type ImageURLMigration struct {
+	ID        string    `json:"id"`
+	OldPrefix string    `json:"old_prefix"`
+	NewPrefix string    `json:"new_prefix"`
+	Products  int       `json:"products"`
+	URLs      int       `json:"urls"`
+	Actor     string    `json:"actor"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// ImageURLChange is one image URL a migration rewrites
+type ImageURLChange struct {
+	Old string `json:"old"`
+	New string `json:"new"`
+}
+
+// ImageURLMigrationRow is a product whose gallery a migration rewrites, with each URL it changes
+type ImageURLMigrationRow struct {
+	ProductID   string           `json:"product_id"`
+	ProductName string           `json:"product_name"`
+	Changes     []ImageURLChange `json:"changes"`
+}
+
+// NormalizeImageURLPrefix checks that a prefix is the start of a full http(s) URL. A bare host
+// gets a trailing slash, so https://cdn.example.com doesn't also match cdn.example.com.au.
+func NormalizeImageURLPrefix(raw string) (string, error) {
+	raw = strings.TrimSpace(raw)
+	u, err := url.Parse(raw)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return "", fmt.Errorf("prefixes must be full http(s) URLs such as https://cdn.example.com/")
+	}
+	if u.Path == "" && u.RawQuery == "" && !strings.HasSuffix(raw, "/") {
+		raw += "/"
+	}
+	return raw, nil
+}
+
+// normalizeOldImageURLPrefix is NormalizeImageURLPrefix for the prefix images move away from,
+// which may also be a path such as /static/uploads/, as local uploads were once stored under
+func normalizeOldImageURLPrefix(raw string) (string, error) {
+	raw = strings.TrimSpace(raw)
+	if strings.HasPrefix(raw, "/") && !strings.HasPrefix(raw, "//") {
+		return raw, nil
+	}
+	return NormalizeImageURLPrefix(raw)
+}
+
+// MigrateImageURLs rewrites every product image URL starting with oldPrefix to start with
+// newPrefix instead, alt text included, in one transaction, and returns the products it
+// touched. Archived and trashed products move too, so restoring one doesn't bring back the old
+// host. With dryRun nothing is written; otherwise the move is recorded for the maintenance page
+// and on each product's timeline.
+func MigrateImageURLs(db *database.DB, oldPrefix, newPrefix, actor string, dryRun bool) ([]ImageURLMigrationRow, error) {
+	oldPrefix, err := normalizeOldImageURLPrefix(oldPrefix)
+	if err != nil {
+		return nil, err
+	}
+	newPrefix, err = NormalizeImageURLPrefix(newPrefix)
+	if err != nil {
+		return nil, err
+	}
+	if oldPrefix == newPrefix {
+		return nil, fmt.Errorf("the new prefix is the same as the old one")
+	}
+
+	ctx, cancel := db.Context(database.Bulk)
+	defer cancel()
+
+	tx, err := db.Pool.Begin(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("error starting transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	rows, err := tx.Query(ctx, `
+		SELECT id, name, image_urls
+		FROM products
+		WHERE EXISTS (SELECT 1 FROM unnest(image_urls) AS u WHERE left(u, length($1)) = $1)
+		ORDER BY name, id
+		FOR UPDATE
+	`, oldPrefix)
+	if err != nil {
+		return nil, dbError("finding product images", err)
+	}
+
+	migrated := []ImageURLMigrationRow{}
+	ids := []string{}
+	urls := 0
+	for rows.Next() {
+		var row ImageURLMigrationRow
+		var images []string
+		if err := rows.Scan(&row.ProductID, &row.ProductName, &images); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("error scanning product images: %w", err)
+		}
+		for _, image := range images {
+			if strings.HasPrefix(image, oldPrefix) {
+				row.Changes = append(row.Changes, ImageURLChange{Old: image, New: newPrefix + image[len(oldPrefix):]})
+			}
+		}
+		ids = append(ids, row.ProductID)
+		urls += len(row.Changes)
+		migrated = append(migrated, row)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating product images: %w", err)
+	}
+
+	if dryRun || len(migrated) == 0 {
+		return migrated, nil
+	}
+
+	_, err = tx.Exec(ctx, `
+		UPDATE products
+		SET image_urls = ARRAY(
+		        SELECT CASE WHEN left(u.url, length($1)) = $1 THEN $2 || substr(u.url, length($1) + 1) ELSE u.url END
+		        FROM unnest(image_urls) WITH ORDINALITY AS u(url, n)
+		        ORDER BY u.n
+		    ),
+		    image_alt = (
+		        SELECT COALESCE(jsonb_object_agg(
+		            CASE WHEN left(key, length($1)) = $1 THEN $2 || substr(key, length($1) + 1) ELSE key END, value
+		        ), '{}'::jsonb)
+		        FROM jsonb_each(image_alt)
+		    ),
+		    updated_at = CURRENT_TIMESTAMP
+		WHERE id = ANY($3::uuid[])
+	`, oldPrefix, newPrefix, ids)
+	if err != nil {
+		return nil, dbError("rewriting product images", err)
+	}
+
+	_, err = tx.Exec(ctx, `
+		INSERT INTO image_url_migrations (old_prefix, new_prefix, products, urls, actor)
+		VALUES ($1, $2, $3, $4, $5)
+	`, oldPrefix, newPrefix, len(migrated), urls, actor)
+	if err != nil {
+		return nil, dbError("recording image host move", err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, fmt.Errorf("error committing image host move: %w", err)
+	}
+
+	invalidateProductCache(db)
+
+	events := make([]ActivityEvent, len(migrated))
+	for i, row := range migrated {
+		events[i] = ActivityEvent{
+			EntityType: ActivityProduct,
+			EntityID:   row.ProductID,
+			Action:     ActivityUpdated,
+			Summary:    "Image host " + oldPrefix + " → " + newPrefix + " (" + strconv.Itoa(len(row.Changes)) + " images)",
+			Actor:      actor,
+		}
+	}
+	if err := RecordActivity(db, events...); err != nil {
+		log.Printf("Error recording image host move on product timelines: %v", err)
+	}
+
+	return migrated, nil
+}
+
+// GetImageURLMigrations lists the most recent image host moves, newest first
+func GetImageURLMigrations(db *database.DB) ([]ImageURLMigration, error) {
+	ctx, cancel := db.Context(database.List)
+	defer cancel()
+
+	rows, err := db.Pool.Query(ctx, `
+		SELECT id, old_prefix, new_prefix, products, urls, actor, created_at
+		FROM image_url_migrations
+		ORDER BY created_at DESC
+		LIMIT $1
+	`, imageURLMigrationHistoryLimit)
+	if err != nil {
+		return nil, dbError("getting image host moves", err)
+	}
+	defer rows.Close()
+
+	migrations := []ImageURLMigration{}
+	for rows.Next() {
+		var m ImageURLMigration
+		if err := rows.Scan(&m.ID, &m.OldPrefix, &m.NewPrefix, &m.Products, &m.URLs, &m.Actor, &m.CreatedAt); err != nil {
+			return nil, fmt.Errorf("error scanning image host move: %w", err)
+		}
+		migrations = append(migrations, m)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating image host moves: %w", err)
+	}
+	return migrations, nil
+}
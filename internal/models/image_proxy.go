@@ -0,0 +1,240 @@
+package models
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/ngenohkevin/kuiper_admin/internal/database"
+)
+
+// ImageProxyAnyHost is the host of the profile used for hosts without one of their own
+const ImageProxyAnyHost = "*"
+
+// imageProxyUserAgent is sent to image hosts whose profile doesn't set a user agent
+const imageProxyUserAgent = "Mozilla/5.0 (compatible; GanymedeAdmin/1.0)"
+
+// imageProxyMaxRedirects is how many redirects a fetch for an image follows
+const imageProxyMaxRedirects = 10
+
+// imageProxyProfilesCacheKey is the cache key for the image proxy's header profiles
+const imageProxyProfilesCacheKey = "settings:image-proxy"
+
+// headerNamePattern is what an HTTP header name may be made of
+var headerNamePattern = regexp.MustCompile(`^[A-Za-z0-9-]+$`)
+
+// ImageProxyProfile is the headers sent when fetching images from a host and its subdomains,
+// for hosts that only serve images to requests that look like they came from their own site
+// or carry a key. The auth value is a secret and is never sent back to the browser, and it is
+// only sent to the profile's own host: not to its subdomains, nor wherever the host redirects.
+type ImageProxyProfile struct {
+	ID         string    `json:"id"`
+	Host       string    `json:"host"` // A host name, or ImageProxyAnyHost
+	Referer    string    `json:"referer"`
+	UserAgent  string    `json:"user_agent"`
+	AuthHeader string    `json:"auth_header"` // e.g. Authorization or X-Api-Key, empty for none; never on the ImageProxyAnyHost profile
+	AuthValue  string    `json:"-"`
+	CreatedAt  time.Time `json:"created_at"`
+	UpdatedAt  time.Time `json:"updated_at"`
+}
+
+// HasAuth reports whether the profile sends an auth header
+func (p ImageProxyProfile) HasAuth() bool {
+	return p.AuthHeader != "" && p.AuthValue != ""
+}
+
+// Matches reports whether the profile applies to an image on host
+func (p ImageProxyProfile) Matches(host string) bool {
+	host = strings.ToLower(host)
+	return p.Host == ImageProxyAnyHost || host == p.Host || strings.HasSuffix(host, "."+p.Host)
+}
+
+// SendsAuth reports whether the profile's auth header goes with a request to host, which is
+// only when host is exactly the one the profile was saved for
+func (p ImageProxyProfile) SendsAuth(host string) bool {
+	return p.HasAuth() && p.Host != ImageProxyAnyHost && strings.ToLower(host) == p.Host
+}
+
+// Apply sets the profile's headers on a request for an image
+func (p ImageProxyProfile) Apply(req *http.Request) {
+	userAgent := p.UserAgent
+	if userAgent == "" {
+		userAgent = imageProxyUserAgent
+	}
+	req.Header.Set("User-Agent", userAgent)
+	req.Header.Set("Accept", "image/*,*/*")
+	if p.Referer != "" {
+		req.Header.Set("Referer", p.Referer)
+	}
+	if p.SendsAuth(req.URL.Hostname()) {
+		req.Header.Set(p.AuthHeader, p.AuthValue)
+	}
+}
+
+// CheckRedirect is the http.Client redirect policy for requests the profile was applied to. The
+// client would copy the auth header to wherever the host redirects, so it is taken off.
+func (p ImageProxyProfile) CheckRedirect(req *http.Request, via []*http.Request) error {
+	if len(via) >= imageProxyMaxRedirects {
+		return fmt.Errorf("stopped after %d redirects", imageProxyMaxRedirects)
+	}
+	if p.AuthHeader != "" {
+		req.Header.Del(p.AuthHeader)
+	}
+	return nil
+}
+
+// validate tidies the profile's fields and checks them
+func (p *ImageProxyProfile) validate() error {
+	p.Host = strings.ToLower(strings.TrimSpace(p.Host))
+	if strings.Contains(p.Host, "://") {
+		if u, err := url.Parse(p.Host); err == nil {
+			p.Host = u.Hostname()
+		}
+	}
+	p.Host = strings.TrimPrefix(p.Host, "*.")
+	if p.Host == "" {
+		return fmt.Errorf("host is required, e.g. images.example.com, or * for every other host")
+	}
+	if p.Host != ImageProxyAnyHost && strings.ContainsAny(p.Host, "/:?# *") {
+		return fmt.Errorf("host must be a host name such as images.example.com")
+	}
+
+	p.Referer = strings.TrimSpace(p.Referer)
+	if p.Referer != "" {
+		u, err := url.Parse(p.Referer)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("referer must be a full http(s) URL such as https://shop.example.com")
+		}
+	}
+
+	p.UserAgent = strings.TrimSpace(p.UserAgent)
+	p.AuthHeader = strings.TrimSpace(p.AuthHeader)
+	p.AuthValue = strings.TrimSpace(p.AuthValue)
+	if p.AuthHeader != "" && !headerNamePattern.MatchString(p.AuthHeader) {
+		return fmt.Errorf("auth header must be a header name such as Authorization")
+	}
+	if p.Host == ImageProxyAnyHost && (p.AuthHeader != "" || p.AuthValue != "") {
+		return fmt.Errorf("the profile for every other host can't send an auth header; add a profile for the host that needs it")
+	}
+	if strings.ContainsAny(p.UserAgent+p.AuthValue, "\r\n") {
+		return fmt.Errorf("header values must fit on one line")
+	}
+	return nil
+}
+
+// GetImageProxyProfiles lists the image proxy's header profiles, the one for every other host
+// first
+func GetImageProxyProfiles(db *database.DB) ([]ImageProxyProfile, error) {
+	if cached, found := db.Cache.Get(imageProxyProfilesCacheKey); found {
+		if profiles, ok := cached.([]ImageProxyProfile); ok {
+			return profiles, nil
+		}
+	}
+
+	ctx, cancel := db.Context(database.List)
+	defer cancel()
+
+	rows, err := db.Pool.Query(ctx, `
+		SELECT id, host, referer, user_agent, auth_header, auth_value, created_at, updated_at
+		FROM image_proxy_profiles
+		ORDER BY host <> $1, host
+	`, ImageProxyAnyHost)
+	if err != nil {
+		return nil, dbError("getting image proxy profiles", err)
+	}
+	defer rows.Close()
+
+	profiles := []ImageProxyProfile{}
+	for rows.Next() {
+		var p ImageProxyProfile
+		if err := rows.Scan(&p.ID, &p.Host, &p.Referer, &p.UserAgent, &p.AuthHeader, &p.AuthValue, &p.CreatedAt, &p.UpdatedAt); err != nil {
+			return nil, fmt.Errorf("error scanning image proxy profile: %w", err)
+		}
+		profiles = append(profiles, p)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating image proxy profiles: %w", err)
+	}
+
+	db.Cache.Set(imageProxyProfilesCacheKey, profiles, 10*time.Minute)
+	return profiles, nil
+}
+
+// GetImageProxyProfile picks the profile for fetching an image on host: the most specific
+// one matching it, else the one for every other host. Without either it's an empty profile,
+// which sends only the default user agent.
+func GetImageProxyProfile(db *database.DB, host string) (ImageProxyProfile, error) {
+	profiles, err := GetImageProxyProfiles(db)
+	if err != nil {
+		return ImageProxyProfile{}, err
+	}
+
+	var best ImageProxyProfile
+	for _, p := range profiles {
+		if !p.Matches(host) {
+			continue
+		}
+		if best.Host == "" || best.Host == ImageProxyAnyHost || (p.Host != ImageProxyAnyHost && len(p.Host) > len(best.Host)) {
+			best = p
+		}
+	}
+	return best, nil
+}
+
+// SaveImageProxyProfile adds a profile for a host or replaces the one it has. An empty auth
+// value keeps the one already stored, so the secret needn't be typed again to change the
+// referer; clearAuth removes it.
+func SaveImageProxyProfile(db *database.DB, p ImageProxyProfile, clearAuth bool) (ImageProxyProfile, error) {
+	if err := p.validate(); err != nil {
+		return ImageProxyProfile{}, err
+	}
+	if clearAuth || p.Host == ImageProxyAnyHost {
+		p.AuthHeader, clearAuth = "", true
+	}
+
+	ctx, cancel := db.Context(database.Write)
+	defer cancel()
+
+	err := db.Pool.QueryRow(ctx, `
+		INSERT INTO image_proxy_profiles (host, referer, user_agent, auth_header, auth_value)
+		VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (host) DO UPDATE SET
+			referer = EXCLUDED.referer,
+			user_agent = EXCLUDED.user_agent,
+			auth_header = EXCLUDED.auth_header,
+			auth_value = CASE
+				WHEN $6::boolean THEN ''
+				WHEN EXCLUDED.auth_value = '' THEN image_proxy_profiles.auth_value
+				ELSE EXCLUDED.auth_value
+			END,
+			updated_at = CURRENT_TIMESTAMP
+		RETURNING id, auth_value, created_at, updated_at
+	`, p.Host, p.Referer, p.UserAgent, p.AuthHeader, p.AuthValue, clearAuth).Scan(&p.ID, &p.AuthValue, &p.CreatedAt, &p.UpdatedAt)
+	if err != nil {
+		return ImageProxyProfile{}, dbError("saving image proxy profile", err)
+	}
+
+	db.Cache.Delete(imageProxyProfilesCacheKey)
+	return p, nil
+}
+
+// DeleteImageProxyProfile removes a host's profile, so its images get the one for every other
+// host
+func DeleteImageProxyProfile(db *database.DB, id string) error {
+	ctx, cancel := db.Context(database.Write)
+	defer cancel()
+
+	tag, err := db.Pool.Exec(ctx, `DELETE FROM image_proxy_profiles WHERE id = $1`, id)
+	if err != nil {
+		return dbError("deleting image proxy profile", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return notFound("image proxy profile not found")
+	}
+
+	db.Cache.Delete(imageProxyProfilesCacheKey)
+	return nil
+}
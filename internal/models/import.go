@@ -0,0 +1,443 @@
+package models
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/ngenohkevin/kuiper_admin/internal/database"
+	"github.com/ngenohkevin/kuiper_admin/internal/money"
+)
+
+// Outcomes of importing one product
+const (
+	ImportCreated   = "created"
+	ImportUpdated   = "updated"
+	ImportUnchanged = "unchanged"
+	ImportFailed    = "failed"
+	ImportSkipped   = "skipped" // Would have imported, but other rows of an all-or-nothing import failed
+)
+
+// ProductImport is a product read from an external catalog export, matched to
+// existing products by slug
+type ProductImport struct {
+	Name        string          `json:"name"`
+	Slug        string          `json:"slug"`
+	Description string          `json:"description"`
+	Price       money.Amount    `json:"price"`
+	ImageURLs   []string        `json:"image_urls"`
+	StockCount  int             `json:"stock_count"`
+	IsAvailable bool            `json:"is_available"`
+	Category    string          `json:"category"` // Category name, created if it doesn't exist
+	Variants    []VariantImport `json:"variants"`
+
+	CategorySlug string `json:"category_slug,omitempty"` // Slug of an existing category, used instead of Category
+	Row          int    `json:"-"`                       // Line of the file the product came from, when known
+	Invalid      string `json:"-"`                       // Why the row couldn't be read, reported as its error
+}
+
+// VariantImport is a variant of an imported product, matched to existing variants by name
+type VariantImport struct {
+	Name        string       `json:"name"`
+	Price       money.Amount `json:"price"`
+	StockCount  int          `json:"stock_count"`
+	IsAvailable bool         `json:"is_available"`
+}
+
+// ImportRowResult is the outcome of importing one product
+type ImportRowResult struct {
+	Row       int      `json:"row,omitempty"` // Line of the file, when known
+	Name      string   `json:"name"`
+	Slug      string   `json:"slug"`
+	Status    string   `json:"status"` // One of the Import* constants
+	ProductID string   `json:"product_id,omitempty"`
+	Changes   []string `json:"changes,omitempty"` // Fields an update changed
+	Error     string   `json:"error,omitempty"`
+}
+
+var slugInvalidChars = regexp.MustCompile(`[^a-z0-9]+`)
+
+// Slugify turns a name into a URL slug, e.g. "Blue Dream (3.5g)" becomes "blue-dream-3-5g"
+func Slugify(name string) string {
+	return strings.Trim(slugInvalidChars.ReplaceAllString(strings.ToLower(name), "-"), "-")
+}
+
+// ImportProducts imports each product in its own transaction, so one bad row doesn't
+// stop the rest, and returns a result per product. A dry run does all the same work,
+// including database checks, but rolls every transaction back.
+//
+// Large imports first copy the products that don't exist yet into the table in one go, see
+// copyNewProducts; the rest are then matched and updated one by one.
+func ImportProducts(db *database.DB, products []ProductImport, dryRun bool) []ImportRowResult {
+	products = slices.Clone(products)
+	for i := range products {
+		if products[i].Slug == "" {
+			products[i].Slug = Slugify(products[i].Name)
+		}
+	}
+
+	var copied map[int]ImportRowResult
+	if !dryRun && len(products) >= importCopyMinRows {
+		var err error
+		if copied, err = copyNewProducts(db, products); err != nil {
+			log.Printf("Bulk copy of imported products failed, importing them one by one: %v", err)
+			copied = nil
+		}
+	}
+
+	results := make([]ImportRowResult, 0, len(products))
+	for i, p := range products {
+		if result, ok := copied[i]; ok {
+			results = append(results, result)
+			continue
+		}
+		result := ImportRowResult{Row: p.Row, Name: p.Name, Slug: p.Slug}
+		id, status, changes, err := importProduct(db, p, dryRun)
+		if err != nil {
+			result.Status = ImportFailed
+			result.Error = err.Error()
+		} else {
+			result.Status = status
+			result.ProductID = id
+			result.Changes = changes
+		}
+		results = append(results, result)
+	}
+
+	if dryRun {
+		return results
+	}
+	invalidateProductCache(db)
+	invalidateCategoryCache(db)
+	announceImportedProducts(db, results)
+	return results
+}
+
+// ImportProductsTogether imports every product in a single transaction, so either all of them
+// are saved or, when any row fails, none are; the rows that would have worked are then reported
+// as skipped. A dry run reports the same outcome without saving anything.
+func ImportProductsTogether(db *database.DB, products []ProductImport, dryRun bool) ([]ImportRowResult, error) {
+	ctx, cancel := db.Context(database.Bulk)
+	defer cancel()
+
+	tx, err := db.Pool.Begin(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("error starting transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	results := make([]ImportRowResult, 0, len(products))
+	failed := false
+	for _, p := range products {
+		if p.Slug == "" {
+			p.Slug = Slugify(p.Name)
+		}
+		result := ImportRowResult{Row: p.Row, Name: p.Name, Slug: p.Slug}
+
+		// Each row gets a savepoint, so after a failed one the rest are still checked
+		row, err := tx.Begin(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("error starting savepoint: %w", err)
+		}
+		id, status, changes, err := importProductTx(ctx, row, p)
+		if err != nil {
+			row.Rollback(ctx)
+			failed = true
+			result.Status = ImportFailed
+			result.Error = err.Error()
+		} else {
+			if err := row.Commit(ctx); err != nil {
+				return nil, fmt.Errorf("error releasing savepoint: %w", err)
+			}
+			result.Status = status
+			result.ProductID = id
+			result.Changes = changes
+		}
+		results = append(results, result)
+	}
+
+	if failed || dryRun {
+		for i := range results {
+			// A product that would be created has no ID to link to yet
+			if results[i].Status == ImportCreated {
+				results[i].ProductID = ""
+			}
+			if failed && results[i].Status != ImportFailed {
+				results[i].Status = ImportSkipped
+			}
+		}
+		return results, nil
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return nil, fmt.Errorf("error committing transaction: %w", err)
+	}
+
+	invalidateProductCache(db)
+	invalidateCategoryCache(db)
+	announceImportedProducts(db, results)
+	return results, nil
+}
+
+// importProduct creates or updates one product in its own transaction, see importProductTx
+func importProduct(db *database.DB, p ProductImport, dryRun bool) (string, string, []string, error) {
+	ctx, cancel := db.Context(database.Write)
+	defer cancel()
+
+	tx, err := db.Pool.Begin(ctx)
+	if err != nil {
+		return "", "", nil, fmt.Errorf("error starting transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	id, status, changes, err := importProductTx(ctx, tx, p)
+	if err != nil {
+		return "", "", nil, err
+	}
+
+	if dryRun {
+		// A product that would be created has no ID to link to yet
+		if status == ImportCreated {
+			id = ""
+		}
+		return id, status, changes, nil
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return "", "", nil, fmt.Errorf("error committing transaction: %w", err)
+	}
+
+	return id, status, changes, nil
+}
+
+// importProductTx creates the product, or updates the live product with the same slug when anything differs,
+// returning the fields that changed. Existing variant IDs are kept for variants whose names match.
+func importProductTx(ctx context.Context, tx pgx.Tx, p ProductImport) (string, string, []string, error) {
+	if err := validateProductImport(&p); err != nil {
+		return "", "", nil, err
+	}
+
+	categoryID, err := importProductCategory(ctx, tx, p)
+	if err != nil {
+		return "", "", nil, err
+	}
+
+	var existing Product
+	var variantsJSON []byte
+	var deletedAt *time.Time
+	err = tx.QueryRow(ctx, `
+		SELECT id, category_id, name, COALESCE(description, ''), price, COALESCE(image_urls, '{}'),
+		       stock_count, COALESCE(is_available, false), variants, deleted_at
+		FROM products
+		WHERE slug = $1
+		FOR UPDATE
+	`, p.Slug).Scan(
+		&existing.ID, &existing.CategoryID, &existing.Name, &existing.Description, &existing.Price,
+		&existing.ImageURLs, &existing.StockCount, &existing.IsAvailable, &variantsJSON, &deletedAt,
+	)
+	found := err == nil
+	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		return "", "", nil, dbError("finding product", err)
+	}
+	if found && deletedAt != nil {
+		return "", "", nil, fmt.Errorf("slug %q belongs to a product in the trash", p.Slug)
+	}
+
+	var existingVariants []ProductVariant
+	if found && variantsJSON != nil && string(variantsJSON) != "null" {
+		if err := json.Unmarshal(variantsJSON, &existingVariants); err != nil {
+			return "", "", nil, fmt.Errorf("error parsing variants JSON: %w", err)
+		}
+	}
+	variants := mergeImportedVariants(existingVariants, p.Variants)
+
+	var changes []string
+	if found {
+		for _, field := range []struct {
+			name    string
+			changed bool
+		}{
+			{"name", existing.Name != p.Name},
+			{"description", existing.Description != p.Description},
+			{"price", existing.Price != p.Price},
+			{"images", !slices.Equal(existing.ImageURLs, p.ImageURLs)},
+			{"stock", existing.StockCount != p.StockCount},
+			{"availability", existing.IsAvailable != p.IsAvailable},
+			{"category", !sameCategory(existing.CategoryID, categoryID)},
+			{"variants", !sameVariants(existingVariants, variants)},
+		} {
+			if field.changed {
+				changes = append(changes, field.name)
+			}
+		}
+		if len(changes) == 0 {
+			return existing.ID, ImportUnchanged, nil, nil
+		}
+	}
+
+	newVariantsJSON, err := json.Marshal(variants)
+	if err != nil {
+		return "", "", nil, fmt.Errorf("error marshaling variants to JSON: %w", err)
+	}
+
+	status := ImportUpdated
+	if found {
+		_, err = tx.Exec(ctx, `
+			UPDATE products
+			SET category_id = $2, name = $3, description = $4, price = $5, image_urls = $6,
+			    stock_count = $7, is_available = $8, variants = $9::jsonb, has_variants = $10,
+			    updated_at = CURRENT_TIMESTAMP
+			WHERE id = $1
+		`, existing.ID, categoryID, p.Name, p.Description, p.Price, p.ImageURLs,
+			p.StockCount, p.IsAvailable, string(newVariantsJSON), len(variants) > 0)
+	} else {
+		status = ImportCreated
+		existing.ID = uuid.New().String()
+		_, err = tx.Exec(ctx, `
+			INSERT INTO products (id, category_id, name, slug, description, price, image_urls,
+			                      stock_count, is_available, variants, has_variants)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10::jsonb, $11)
+		`, existing.ID, categoryID, p.Name, p.Slug, p.Description, p.Price, p.ImageURLs,
+			p.StockCount, p.IsAvailable, string(newVariantsJSON), len(variants) > 0)
+	}
+	if err != nil {
+		return "", "", nil, fmt.Errorf("error saving product: %w", err)
+	}
+	if err := syncVariantRows(ctx, tx, existing.ID); err != nil {
+		return "", "", nil, err
+	}
+
+	return existing.ID, status, changes, nil
+}
+
+// validateProductImport trims an imported product's name and checks it can be saved
+func validateProductImport(p *ProductImport) error {
+	if p.Invalid != "" {
+		return errors.New(p.Invalid)
+	}
+	p.Name = strings.TrimSpace(p.Name)
+	if p.Name == "" {
+		return fmt.Errorf("product name is required")
+	}
+	if p.Slug == "" {
+		return fmt.Errorf("product slug is required")
+	}
+	if p.Price < 0 {
+		return fmt.Errorf("price cannot be negative")
+	}
+	if p.StockCount < 0 {
+		return fmt.Errorf("stock cannot be negative")
+	}
+	for _, image := range p.ImageURLs {
+		if u, err := url.Parse(image); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("image %q is not a full http(s) URL", image)
+		}
+	}
+	return nil
+}
+
+// importProductCategory finds the category of an imported product: the live category with its
+// category slug, which must exist, or else the one named by its category, see importCategory
+func importProductCategory(ctx context.Context, tx pgx.Tx, p ProductImport) (*string, error) {
+	slug := strings.TrimSpace(p.CategorySlug)
+	if slug == "" {
+		return importCategory(ctx, tx, p.Category)
+	}
+
+	var id string
+	err := tx.QueryRow(ctx, `SELECT id FROM categories WHERE deleted_at IS NULL AND slug = $1`, slug).Scan(&id)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, fmt.Errorf("no category has the slug %q", slug)
+	}
+	if err != nil {
+		return nil, dbError("finding category", err)
+	}
+	return &id, nil
+}
+
+// importCategory finds a live category by name or slug, creating it when missing. An empty name means no category.
+func importCategory(ctx context.Context, tx pgx.Tx, name string) (*string, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return nil, nil
+	}
+	slug := Slugify(name)
+
+	var id string
+	err := tx.QueryRow(ctx, `
+		SELECT id FROM categories
+		WHERE deleted_at IS NULL AND (LOWER(name) = LOWER($1) OR slug = $2)
+		LIMIT 1
+	`, name, slug).Scan(&id)
+	if err == nil {
+		return &id, nil
+	}
+	if !errors.Is(err, pgx.ErrNoRows) {
+		return nil, dbError("finding category", err)
+	}
+
+	id = uuid.New().String()
+	_, err = tx.Exec(ctx, `INSERT INTO categories (id, name, slug) VALUES ($1, $2, $3)`, id, name, slug)
+	if err != nil {
+		return nil, fmt.Errorf("error creating category %q: %w", name, err)
+	}
+	return &id, nil
+}
+
+// mergeImportedVariants builds the variant list from the import, reusing the IDs of
+// existing variants with the same name so links and stock history stay attached.
+// Their backorder and preorder settings aren't part of the import and are kept too.
+func mergeImportedVariants(existing []ProductVariant, imported []VariantImport) []ProductVariant {
+	byName := make(map[string]ProductVariant, len(existing))
+	for _, v := range existing {
+		byName[strings.ToLower(v.Name)] = v
+	}
+
+	variants := make([]ProductVariant, 0, len(imported))
+	for _, v := range imported {
+		match, ok := byName[strings.ToLower(v.Name)]
+		if !ok {
+			match.ID = uuid.New().String()
+		}
+		variant := ProductVariant{
+			ID:           match.ID,
+			Name:         v.Name,
+			Price:        v.Price,
+			StockCount:   v.StockCount,
+			IsAvailable:  v.IsAvailable,
+			OrderOptions: match.OrderOptions,
+		}
+		variant.SetQuantityFromName()
+		variants = append(variants, variant)
+	}
+	return variants
+}
+
+// sameVariants reports whether two variant lists hold the same variants in the same order
+func sameVariants(a, b []ProductVariant) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i].ID != b[i].ID || a[i].Name != b[i].Name || a[i].Price != b[i].Price ||
+			a[i].StockCount != b[i].StockCount || a[i].IsAvailable != b[i].IsAvailable {
+			return false
+		}
+	}
+	return true
+}
+
+// sameCategory compares two optional category IDs
+func sameCategory(a, b *string) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
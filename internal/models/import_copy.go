@@ -0,0 +1,127 @@
+package models
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/ngenohkevin/kuiper_admin/internal/database"
+)
+
+// importCopyMinRows is how many products an import needs before new ones are copied into the
+// table in bulk. Smaller imports aren't worth the extra round trips to set it up.
+const importCopyMinRows = 50
+
+// importCopyColumns are the products columns a bulk copy fills, in the order of each row's values
+var importCopyColumns = []string{
+	"id", "category_id", "name", "slug", "description", "price", "image_urls",
+	"stock_count", "is_available", "variants", "has_variants",
+}
+
+// copyNewProducts creates the imported products whose slugs aren't taken with a single COPY,
+// returning their results by index in products. Everything else is left for importProduct:
+// products that already exist, later rows repeating a slug, and rows that don't validate, so
+// they get the same checks and error messages as a small import.
+//
+// The copy is one transaction, so an error creates none of them and the caller can fall back
+// to importing every row one by one.
+func copyNewProducts(db *database.DB, products []ProductImport) (map[int]ImportRowResult, error) {
+	ctx, cancel := db.Context(database.Bulk)
+	defer cancel()
+
+	candidates := map[string]int{}
+	slugs := []string{}
+	for i := range products {
+		p := products[i]
+		if validateProductImport(&p) != nil {
+			continue
+		}
+		if _, seen := candidates[p.Slug]; !seen {
+			candidates[p.Slug] = i
+			slugs = append(slugs, p.Slug)
+		}
+	}
+	if len(slugs) == 0 {
+		return nil, nil
+	}
+
+	tx, err := db.Pool.Begin(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("error starting transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	rows, err := tx.Query(ctx, `SELECT slug FROM products WHERE slug = ANY($1)`, slugs)
+	if err != nil {
+		return nil, dbError("finding existing slugs", err)
+	}
+	for rows.Next() {
+		var slug string
+		if err := rows.Scan(&slug); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("error scanning existing slug: %w", err)
+		}
+		delete(candidates, slug)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating existing slugs: %w", err)
+	}
+
+	categories := map[string]*string{}
+	results := make(map[int]ImportRowResult, len(candidates))
+	values := make([][]interface{}, 0, len(candidates))
+	ids := make([]string, 0, len(candidates))
+	for _, slug := range slugs {
+		i, ok := candidates[slug]
+		if !ok {
+			continue
+		}
+		p := products[i]
+		validateProductImport(&p)
+
+		// A category slug that doesn't exist fails the row, which importProduct reports
+		categoryKey := p.CategorySlug + "\x00" + p.Category
+		categoryID, ok := categories[categoryKey]
+		if !ok {
+			if p.CategorySlug != "" {
+				if categoryID, err = importProductCategory(ctx, tx, p); err != nil {
+					continue
+				}
+			} else if categoryID, err = importCategory(ctx, tx, p.Category); err != nil {
+				return nil, err
+			}
+			categories[categoryKey] = categoryID
+		}
+
+		variants := mergeImportedVariants(nil, p.Variants)
+		variantsJSON, err := json.Marshal(variants)
+		if err != nil {
+			return nil, fmt.Errorf("error marshaling variants to JSON: %w", err)
+		}
+
+		id := uuid.New().String()
+		values = append(values, []interface{}{
+			id, categoryID, p.Name, p.Slug, p.Description, p.Price, p.ImageURLs,
+			p.StockCount, p.IsAvailable, string(variantsJSON), len(variants) > 0,
+		})
+		ids = append(ids, id)
+		results[i] = ImportRowResult{Row: p.Row, Name: p.Name, Slug: p.Slug, Status: ImportCreated, ProductID: id}
+	}
+	if len(values) == 0 {
+		return nil, nil
+	}
+
+	if _, err := tx.CopyFrom(ctx, pgx.Identifier{"products"}, importCopyColumns, pgx.CopyFromRows(values)); err != nil {
+		return nil, dbError("copying imported products", err)
+	}
+	if err := syncVariantRows(ctx, tx, ids...); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return nil, fmt.Errorf("error committing transaction: %w", err)
+	}
+
+	return results, nil
+}
@@ -0,0 +1,338 @@
+package models
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/ngenohkevin/kuiper_admin/internal/database"
+)
+
+// ImportFeed is a supplier feed imported on a schedule
+type ImportFeed struct {
+	ID              string       `json:"id"`
+	Name            string       `json:"name"`
+	URL             string       `json:"url"`
+	Format          string       `json:"format"`
+	FieldMapping    FieldMapping `json:"field_mapping"` // Used by CSV and JSON feeds
+	IntervalMinutes int          `json:"interval_minutes"`
+	Enabled         bool         `json:"enabled"`
+	LastRunAt       *time.Time   `json:"last_run_at,omitempty"`
+	CreatedAt       time.Time    `json:"created_at"`
+}
+
+// ImportRun records one run of a feed. Results is the diff report: the outcome for every product in the feed.
+type ImportRun struct {
+	ID         string            `json:"id"`
+	FeedID     string            `json:"feed_id"`
+	StartedAt  time.Time         `json:"started_at"`
+	FinishedAt *time.Time        `json:"finished_at,omitempty"`
+	Created    int               `json:"created"`
+	Updated    int               `json:"updated"`
+	Unchanged  int               `json:"unchanged"`
+	Failed     int               `json:"failed"`
+	Error      string            `json:"error,omitempty"`
+	Results    []ImportRowResult `json:"results,omitempty"`
+}
+
+const importFeedColumns = `id, name, url, format, field_mapping, interval_minutes, enabled, last_run_at, created_at`
+
+// scanImportFeed reads a row selected with importFeedColumns
+func scanImportFeed(row pgx.Row) (ImportFeed, error) {
+	var feed ImportFeed
+	var mappingJSON []byte
+	if err := row.Scan(
+		&feed.ID, &feed.Name, &feed.URL, &feed.Format, &mappingJSON,
+		&feed.IntervalMinutes, &feed.Enabled, &feed.LastRunAt, &feed.CreatedAt,
+	); err != nil {
+		return ImportFeed{}, err
+	}
+	if err := json.Unmarshal(mappingJSON, &feed.FieldMapping); err != nil {
+		return ImportFeed{}, fmt.Errorf("error parsing field mapping JSON: %w", err)
+	}
+	return feed, nil
+}
+
+// GetImportFeeds lists all configured feeds
+func GetImportFeeds(db *database.DB) ([]ImportFeed, error) {
+	return queryImportFeeds(db, `SELECT `+importFeedColumns+` FROM import_feeds ORDER BY name`)
+}
+
+// GetDueImportFeeds lists the enabled feeds whose interval has passed since their last run
+func GetDueImportFeeds(db *database.DB) ([]ImportFeed, error) {
+	return queryImportFeeds(db, `
+		SELECT `+importFeedColumns+`
+		FROM import_feeds
+		WHERE enabled AND (last_run_at IS NULL OR last_run_at + interval_minutes * INTERVAL '1 minute' <= NOW())
+		ORDER BY last_run_at NULLS FIRST
+	`)
+}
+
+func queryImportFeeds(db *database.DB, query string) ([]ImportFeed, error) {
+	ctx, cancel := db.Context(database.List)
+	defer cancel()
+
+	rows, err := db.Pool.Query(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("error querying import feeds: %w", err)
+	}
+	defer rows.Close()
+
+	var feeds []ImportFeed
+	for rows.Next() {
+		feed, err := scanImportFeed(rows)
+		if err != nil {
+			return nil, fmt.Errorf("error scanning import feed: %w", err)
+		}
+		feeds = append(feeds, feed)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating import feeds: %w", err)
+	}
+
+	return feeds, nil
+}
+
+// GetImportFeedByID retrieves a feed by its ID
+func GetImportFeedByID(db *database.DB, id string) (ImportFeed, error) {
+	ctx, cancel := db.Context(database.Read)
+	defer cancel()
+
+	feed, err := scanImportFeed(db.Pool.QueryRow(ctx, `SELECT `+importFeedColumns+` FROM import_feeds WHERE id = $1`, id))
+	if err != nil {
+		return ImportFeed{}, dbError("getting import feed", err)
+	}
+
+	return feed, nil
+}
+
+// CreateImportFeed validates and stores a new feed. The format is checked by the importer beforehand.
+func CreateImportFeed(db *database.DB, feed ImportFeed) (ImportFeed, error) {
+	feed.Name = strings.TrimSpace(feed.Name)
+	feed.URL = strings.TrimSpace(feed.URL)
+	if feed.Name == "" {
+		return ImportFeed{}, fmt.Errorf("feed name is required")
+	}
+	if !strings.HasPrefix(feed.URL, "http://") && !strings.HasPrefix(feed.URL, "https://") {
+		return ImportFeed{}, fmt.Errorf("feed URL must start with http:// or https://")
+	}
+	if feed.IntervalMinutes < 5 {
+		return ImportFeed{}, fmt.Errorf("feeds can run at most every 5 minutes")
+	}
+	if feed.FieldMapping == nil {
+		feed.FieldMapping = FieldMapping{}
+	}
+
+	mappingJSON, err := json.Marshal(feed.FieldMapping)
+	if err != nil {
+		return ImportFeed{}, fmt.Errorf("error marshaling field mapping: %w", err)
+	}
+
+	ctx, cancel := db.Context(database.Write)
+	defer cancel()
+
+	err = db.Pool.QueryRow(ctx, `
+		INSERT INTO import_feeds (name, url, format, field_mapping, interval_minutes, enabled)
+		VALUES ($1, $2, $3, $4::jsonb, $5, true)
+		RETURNING id, enabled, created_at
+	`, feed.Name, feed.URL, feed.Format, string(mappingJSON), feed.IntervalMinutes).Scan(&feed.ID, &feed.Enabled, &feed.CreatedAt)
+	if err != nil {
+		return ImportFeed{}, fmt.Errorf("error creating import feed: %w", err)
+	}
+
+	return feed, nil
+}
+
+// SetImportFeedMapping replaces the field mapping a feed is read with
+func SetImportFeedMapping(db *database.DB, id string, mapping FieldMapping) error {
+	mappingJSON, err := json.Marshal(mapping)
+	if err != nil {
+		return fmt.Errorf("error marshaling field mapping: %w", err)
+	}
+
+	ctx, cancel := db.Context(database.Write)
+	defer cancel()
+
+	tag, err := db.Pool.Exec(ctx, `UPDATE import_feeds SET field_mapping = $2::jsonb WHERE id = $1`, id, string(mappingJSON))
+	if err != nil {
+		return dbError("updating import feed", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return notFound("import feed not found")
+	}
+
+	return nil
+}
+
+// SetImportFeedEnabled pauses or resumes a feed's schedule
+func SetImportFeedEnabled(db *database.DB, id string, enabled bool) error {
+	ctx, cancel := db.Context(database.Write)
+	defer cancel()
+
+	tag, err := db.Pool.Exec(ctx, `UPDATE import_feeds SET enabled = $2 WHERE id = $1`, id, enabled)
+	if err != nil {
+		return dbError("updating import feed", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return notFound("import feed not found")
+	}
+
+	return nil
+}
+
+// DeleteImportFeed removes a feed and its run history. Imported products are kept.
+func DeleteImportFeed(db *database.DB, id string) error {
+	ctx, cancel := db.Context(database.Write)
+	defer cancel()
+
+	tag, err := db.Pool.Exec(ctx, `DELETE FROM import_feeds WHERE id = $1`, id)
+	if err != nil {
+		return dbError("deleting import feed", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return notFound("import feed not found")
+	}
+
+	return nil
+}
+
+// StartImportRun records the start of a feed run and marks the feed as run,
+// so the next scheduler tick doesn't pick it up again while it is still going
+func StartImportRun(db *database.DB, feedID string) (ImportRun, error) {
+	ctx, cancel := db.Context(database.Write)
+	defer cancel()
+
+	tx, err := db.Pool.Begin(ctx)
+	if err != nil {
+		return ImportRun{}, fmt.Errorf("error starting transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	run := ImportRun{FeedID: feedID}
+	err = tx.QueryRow(ctx, `
+		INSERT INTO import_runs (feed_id) VALUES ($1)
+		RETURNING id, started_at
+	`, feedID).Scan(&run.ID, &run.StartedAt)
+	if err != nil {
+		return ImportRun{}, fmt.Errorf("error starting import run: %w", err)
+	}
+
+	if _, err := tx.Exec(ctx, `UPDATE import_feeds SET last_run_at = $2 WHERE id = $1`, feedID, run.StartedAt); err != nil {
+		return ImportRun{}, dbError("updating import feed", err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return ImportRun{}, fmt.Errorf("error committing import run: %w", err)
+	}
+
+	return run, nil
+}
+
+// FinishImportRun stores the outcome of a feed run, counting its results by status
+func FinishImportRun(db *database.DB, run ImportRun) error {
+	run.Created, run.Updated, run.Unchanged, run.Failed = 0, 0, 0, 0
+	for _, result := range run.Results {
+		switch result.Status {
+		case ImportCreated:
+			run.Created++
+		case ImportUpdated:
+			run.Updated++
+		case ImportUnchanged:
+			run.Unchanged++
+		case ImportFailed:
+			run.Failed++
+		}
+	}
+
+	results := run.Results
+	if results == nil {
+		results = []ImportRowResult{}
+	}
+	resultsJSON, err := json.Marshal(results)
+	if err != nil {
+		return fmt.Errorf("error marshaling import results: %w", err)
+	}
+
+	ctx, cancel := db.Context(database.Write)
+	defer cancel()
+
+	_, err = db.Pool.Exec(ctx, `
+		UPDATE import_runs
+		SET finished_at = NOW(), created = $2, updated = $3, unchanged = $4, failed = $5, error = $6, results = $7::jsonb
+		WHERE id = $1
+	`, run.ID, run.Created, run.Updated, run.Unchanged, run.Failed, run.Error, string(resultsJSON))
+	if err != nil {
+		return fmt.Errorf("error finishing import run: %w", err)
+	}
+
+	return nil
+}
+
+// GetImportRuns lists a feed's most recent runs, without their results
+func GetImportRuns(db *database.DB, feedID string, limit int) ([]ImportRun, error) {
+	ctx, cancel := db.Context(database.List)
+	defer cancel()
+
+	rows, err := db.Pool.Query(ctx, `
+		SELECT id, feed_id, started_at, finished_at, created, updated, unchanged, failed, error
+		FROM import_runs
+		WHERE feed_id = $1
+		ORDER BY started_at DESC
+		LIMIT $2
+	`, feedID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("error querying import runs: %w", err)
+	}
+	defer rows.Close()
+
+	var runs []ImportRun
+	for rows.Next() {
+		var run ImportRun
+		if err := rows.Scan(
+			&run.ID, &run.FeedID, &run.StartedAt, &run.FinishedAt,
+			&run.Created, &run.Updated, &run.Unchanged, &run.Failed, &run.Error,
+		); err != nil {
+			return nil, fmt.Errorf("error scanning import run: %w", err)
+		}
+		runs = append(runs, run)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating import runs: %w", err)
+	}
+
+	return runs, nil
+}
+
+// GetImportRunByID retrieves a run with its full diff report
+func GetImportRunByID(db *database.DB, id string) (ImportRun, error) {
+	ctx, cancel := db.Context(database.Read)
+	defer cancel()
+
+	var run ImportRun
+	var resultsJSON []byte
+	err := db.Pool.QueryRow(ctx, `
+		SELECT id, feed_id, started_at, finished_at, created, updated, unchanged, failed, error, results
+		FROM import_runs
+		WHERE id = $1
+	`, id).Scan(
+		&run.ID, &run.FeedID, &run.StartedAt, &run.FinishedAt,
+		&run.Created, &run.Updated, &run.Unchanged, &run.Failed, &run.Error, &resultsJSON,
+	)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return ImportRun{}, notFound("import run not found")
+	}
+	if err != nil {
+		return ImportRun{}, dbError("getting import run", err)
+	}
+
+	if err := json.Unmarshal(resultsJSON, &run.Results); err != nil {
+		return ImportRun{}, fmt.Errorf("error parsing import results JSON: %w", err)
+	}
+
+	return run, nil
+}
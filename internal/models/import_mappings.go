@@ -0,0 +1,138 @@
+package models
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/ngenohkevin/kuiper_admin/internal/database"
+)
+
+// FieldSource is where a product field comes from in an import: a CSV column or
+// JSON key, and the transforms applied to its value in order
+type FieldSource struct {
+	Column     string   `json:"column"`
+	Transforms []string `json:"transforms,omitempty"`
+}
+
+// FieldMapping maps product fields (name, price, ...) to their source in an import
+type FieldMapping map[string]FieldSource
+
+// ImportMapping is a named field mapping saved for reuse
+type ImportMapping struct {
+	ID        string       `json:"id"`
+	Name      string       `json:"name"`
+	Mapping   FieldMapping `json:"mapping"`
+	CreatedAt time.Time    `json:"created_at"`
+	UpdatedAt time.Time    `json:"updated_at"`
+}
+
+// GetImportMappings lists the saved mappings by name
+func GetImportMappings(db *database.DB) ([]ImportMapping, error) {
+	ctx, cancel := db.Context(database.List)
+	defer cancel()
+
+	rows, err := db.Pool.Query(ctx, `
+		SELECT id, name, mapping, created_at, updated_at
+		FROM import_mappings
+		ORDER BY name
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("error querying import mappings: %w", err)
+	}
+	defer rows.Close()
+
+	var mappings []ImportMapping
+	for rows.Next() {
+		mapping, err := scanImportMapping(rows)
+		if err != nil {
+			return nil, err
+		}
+		mappings = append(mappings, mapping)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating import mappings: %w", err)
+	}
+
+	return mappings, nil
+}
+
+// GetImportMappingByID retrieves a saved mapping by its ID
+func GetImportMappingByID(db *database.DB, id string) (ImportMapping, error) {
+	ctx, cancel := db.Context(database.Read)
+	defer cancel()
+
+	mapping, err := scanImportMapping(db.Pool.QueryRow(ctx, `
+		SELECT id, name, mapping, created_at, updated_at
+		FROM import_mappings
+		WHERE id = $1
+	`, id))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return ImportMapping{}, notFound("import mapping not found")
+	}
+	return mapping, err
+}
+
+func scanImportMapping(row pgx.Row) (ImportMapping, error) {
+	var mapping ImportMapping
+	var mappingJSON []byte
+	if err := row.Scan(&mapping.ID, &mapping.Name, &mappingJSON, &mapping.CreatedAt, &mapping.UpdatedAt); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return ImportMapping{}, err
+		}
+		return ImportMapping{}, fmt.Errorf("error scanning import mapping: %w", err)
+	}
+	if err := json.Unmarshal(mappingJSON, &mapping.Mapping); err != nil {
+		return ImportMapping{}, fmt.Errorf("error parsing import mapping JSON: %w", err)
+	}
+	return mapping, nil
+}
+
+// SaveImportMapping stores a mapping under name, replacing any saved mapping with the same name
+func SaveImportMapping(db *database.DB, name string, mapping FieldMapping) (ImportMapping, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return ImportMapping{}, fmt.Errorf("mapping name is required")
+	}
+
+	mappingJSON, err := json.Marshal(mapping)
+	if err != nil {
+		return ImportMapping{}, fmt.Errorf("error marshaling import mapping: %w", err)
+	}
+
+	ctx, cancel := db.Context(database.Write)
+	defer cancel()
+
+	saved := ImportMapping{Name: name, Mapping: mapping}
+	err = db.Pool.QueryRow(ctx, `
+		INSERT INTO import_mappings (name, mapping)
+		VALUES ($1, $2::jsonb)
+		ON CONFLICT (name) DO UPDATE SET mapping = EXCLUDED.mapping, updated_at = CURRENT_TIMESTAMP
+		RETURNING id, created_at, updated_at
+	`, name, string(mappingJSON)).Scan(&saved.ID, &saved.CreatedAt, &saved.UpdatedAt)
+	if err != nil {
+		return ImportMapping{}, fmt.Errorf("error saving import mapping: %w", err)
+	}
+
+	return saved, nil
+}
+
+// DeleteImportMapping removes a saved mapping. Feeds keep their own copy of the mapping they were set up with.
+func DeleteImportMapping(db *database.DB, id string) error {
+	ctx, cancel := db.Context(database.Write)
+	defer cancel()
+
+	tag, err := db.Pool.Exec(ctx, `DELETE FROM import_mappings WHERE id = $1`, id)
+	if err != nil {
+		return dbError("deleting import mapping", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return notFound("import mapping not found")
+	}
+
+	return nil
+}
@@ -0,0 +1,63 @@
+package models
+
+import "strings"
+
+// ListQuery is what a list page asks for: one page of the rows matching a search and a
+// filter, in a sort order. The meaning of Filter depends on the list.
+type ListQuery struct {
+	Page     int
+	PageSize int
+	Search   string
+	Filter   string
+	Sort     string
+}
+
+// offset clamps the page and page size to sensible values and returns the rows to skip
+func (q *ListQuery) offset() int {
+	if q.Page < 1 {
+		q.Page = 1
+	}
+	if q.PageSize < 1 || q.PageSize > 100 {
+		q.PageSize = 20
+	}
+	return (q.Page - 1) * q.PageSize
+}
+
+// SortOptions maps the sort keys a list accepts to the columns they order by. A key sorts
+// ascending, and descending with a leading "-", as in "-created".
+type SortOptions struct {
+	Columns map[string]string
+	Default string
+}
+
+// Normalize returns sort if the list accepts it, or the default otherwise
+func (o SortOptions) Normalize(sort string) string {
+	if _, ok := o.Columns[strings.TrimPrefix(sort, "-")]; ok {
+		return sort
+	}
+	return o.Default
+}
+
+// orderBy returns the ORDER BY clause for sort. tiebreak is appended so rows with equal
+// values keep their place from one page to the next.
+func (o SortOptions) orderBy(sort, tiebreak string) string {
+	sort = o.Normalize(sort)
+	if key, desc := strings.CutPrefix(sort, "-"); desc {
+		return o.Columns[key] + " DESC, " + tiebreak
+	}
+	return o.Columns[sort] + " ASC, " + tiebreak
+}
+
+// newPage wraps a page of rows with the pagination metadata for q
+func newPage[T any](data []T, totalCount int64, q ListQuery) PaginatedResult[T] {
+	totalPages := int((totalCount + int64(q.PageSize) - 1) / int64(q.PageSize))
+	return PaginatedResult[T]{
+		Data:       data,
+		TotalCount: totalCount,
+		Page:       q.Page,
+		PageSize:   q.PageSize,
+		TotalPages: totalPages,
+		HasNext:    q.Page < totalPages,
+		HasPrev:    q.Page > 1,
+	}
+}
@@ -0,0 +1,158 @@
+package models
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/ngenohkevin/kuiper_admin/internal/database"
+)
+
+// MergeProducts folds duplicateIDs into survivorID in one transaction: variants and
+// images are appended to the survivor, reviews and redirects are repointed, a redirect
+// is added for each duplicate slug, and the duplicates are soft-deleted.
+func MergeProducts(db *database.DB, survivorID string, duplicateIDs []string) error {
+	if len(duplicateIDs) == 0 {
+		return fmt.Errorf("no duplicate products to merge")
+	}
+	for _, id := range duplicateIDs {
+		if id == survivorID {
+			return fmt.Errorf("product %s cannot be merged into itself", id)
+		}
+	}
+
+	ctx, cancel := db.Context(database.Bulk)
+	defer cancel()
+
+	tx, err := db.Pool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("error starting transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	// Lock the survivor and the duplicates so concurrent edits can't slip in mid-merge
+	var variantsJSON []byte
+	var imageURLs []string
+	err = tx.QueryRow(ctx, `
+		SELECT COALESCE(variants, '[]'::jsonb), COALESCE(image_urls, '{}')
+		FROM products
+		WHERE id = $1 AND deleted_at IS NULL
+		FOR UPDATE
+	`, survivorID).Scan(&variantsJSON, &imageURLs)
+	if err != nil {
+		return dbError("finding survivor product", err)
+	}
+
+	var variants []json.RawMessage
+	if err := json.Unmarshal(variantsJSON, &variants); err != nil {
+		return fmt.Errorf("error parsing survivor variants JSON: %w", err)
+	}
+
+	rows, err := tx.Query(ctx, `
+		SELECT id, COALESCE(variants, '[]'::jsonb), COALESCE(image_urls, '{}')
+		FROM products
+		WHERE id = ANY($1::uuid[]) AND deleted_at IS NULL
+		ORDER BY created_at
+		FOR UPDATE
+	`, duplicateIDs)
+	if err != nil {
+		return dbError("finding duplicate products", err)
+	}
+
+	found := 0
+	for rows.Next() {
+		var id string
+		var dupVariantsJSON []byte
+		var dupImageURLs []string
+		if err := rows.Scan(&id, &dupVariantsJSON, &dupImageURLs); err != nil {
+			rows.Close()
+			return fmt.Errorf("error scanning duplicate product: %w", err)
+		}
+
+		var dupVariants []json.RawMessage
+		if err := json.Unmarshal(dupVariantsJSON, &dupVariants); err != nil {
+			rows.Close()
+			return fmt.Errorf("error parsing variants JSON of product %s: %w", id, err)
+		}
+		variants = append(variants, dupVariants...)
+		imageURLs = appendMissing(imageURLs, dupImageURLs...)
+		found++
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("error iterating duplicate products: %w", err)
+	}
+	if found != len(duplicateIDs) {
+		return conflict("some duplicate products were not found or are already deleted")
+	}
+
+	mergedVariantsJSON, err := json.Marshal(variants)
+	if err != nil {
+		return fmt.Errorf("error marshaling merged variants: %w", err)
+	}
+
+	statements := []struct {
+		query string
+		args  []interface{}
+	}{
+		{
+			`UPDATE products
+			 SET variants = $2, has_variants = $3, image_urls = $4, updated_at = CURRENT_TIMESTAMP,
+			     image_alt = (SELECT COALESCE(jsonb_object_agg(e.key, e.value), '{}'::jsonb)
+			                  FROM products d, jsonb_each(d.image_alt) e WHERE d.id = ANY($5::uuid[])) || image_alt
+			 WHERE id = $1`,
+			[]interface{}{survivorID, mergedVariantsJSON, len(variants) > 0, imageURLs, duplicateIDs},
+		},
+		{
+			`UPDATE reviews SET product_id = $1 WHERE product_id = ANY($2::uuid[])`,
+			[]interface{}{survivorID, duplicateIDs},
+		},
+		{
+			`UPDATE product_redirects SET product_id = $1 WHERE product_id = ANY($2::uuid[])`,
+			[]interface{}{survivorID, duplicateIDs},
+		},
+		{
+			`INSERT INTO product_redirects (from_slug, product_id)
+			 SELECT slug, $1 FROM products WHERE id = ANY($2::uuid[])
+			 ON CONFLICT (from_slug) DO UPDATE SET product_id = EXCLUDED.product_id`,
+			[]interface{}{survivorID, duplicateIDs},
+		},
+		{
+			// The variants now live on the survivor, so restoring a duplicate from the trash must not bring copies back
+			`UPDATE products
+			 SET variants = '[]'::jsonb, has_variants = false, deleted_at = NOW()
+			 WHERE id = ANY($1::uuid[])`,
+			[]interface{}{duplicateIDs},
+		},
+	}
+	for _, statement := range statements {
+		if _, err := tx.Exec(ctx, statement.query, statement.args...); err != nil {
+			return fmt.Errorf("error merging products: %w", err)
+		}
+	}
+	if err := syncVariantRows(ctx, tx, append([]string{survivorID}, duplicateIDs...)...); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("error committing merge: %w", err)
+	}
+
+	invalidateProductCache(db)
+	announceProductChanges(db, append([]string{survivorID}, duplicateIDs...)...)
+	return nil
+}
+
+// appendMissing appends the values not already in list, keeping their order
+func appendMissing(list []string, values ...string) []string {
+	seen := make(map[string]bool, len(list))
+	for _, v := range list {
+		seen[v] = true
+	}
+	for _, v := range values {
+		if !seen[v] {
+			seen[v] = true
+			list = append(list, v)
+		}
+	}
+	return list
+}
@@ -0,0 +1,131 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/ngenohkevin/kuiper_admin/internal/database"
+)
+
+// notificationListLimit is how many notifications the notification center lists
+const notificationListLimit = 100
+
+// Notification is an alert raised for every admin, shown in the notification center
+type Notification struct {
+	ID        string    `json:"id"`
+	Kind      string    `json:"kind"` // One of the Anomaly* constants
+	Title     string    `json:"title"`
+	Body      string    `json:"body"`
+	Link      string    `json:"link"` // Where to look into it, empty for nowhere in particular
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// RaiseNotification adds a notification unless one with the same dedupe key was raised within
+// quiet, so a condition that persists isn't announced on every check. raised is false when it
+// was held back.
+func RaiseNotification(db *database.DB, n Notification, dedupeKey string, quiet time.Duration) (Notification, bool, error) {
+	ctx, cancel := db.Context(database.Write)
+	defer cancel()
+
+	err := db.Pool.QueryRow(ctx, `
+		INSERT INTO notifications (kind, dedupe_key, title, body, link)
+		SELECT $1, $2, $3, $4, $5
+		WHERE $2 = '' OR NOT EXISTS (
+		    SELECT 1 FROM notifications WHERE dedupe_key = $2 AND created_at > $6
+		)
+		RETURNING id, created_at
+	`, n.Kind, dedupeKey, n.Title, n.Body, n.Link, time.Now().Add(-quiet)).Scan(&n.ID, &n.CreatedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return n, false, nil
+	}
+	if err != nil {
+		return n, false, dbError("raising notification", err)
+	}
+	return n, true, nil
+}
+
+// GetNotifications lists the most recent notifications, newest first, with when the admin last
+// opened the notification center, nil if they never have
+func GetNotifications(db *database.DB, username string) ([]Notification, *time.Time, error) {
+	seenAt, err := notificationsSeenAt(db, username)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	ctx, cancel := db.Context(database.List)
+	defer cancel()
+
+	rows, err := db.Pool.Query(ctx, `
+		SELECT id, kind, title, body, link, created_at
+		FROM notifications
+		ORDER BY created_at DESC
+		LIMIT $1
+	`, notificationListLimit)
+	if err != nil {
+		return nil, nil, dbError("getting notifications", err)
+	}
+	defer rows.Close()
+
+	notifications := []Notification{}
+	for rows.Next() {
+		var n Notification
+		if err := rows.Scan(&n.ID, &n.Kind, &n.Title, &n.Body, &n.Link, &n.CreatedAt); err != nil {
+			return nil, nil, fmt.Errorf("error scanning notification: %w", err)
+		}
+		notifications = append(notifications, n)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, nil, fmt.Errorf("error iterating notifications: %w", err)
+	}
+	return notifications, seenAt, nil
+}
+
+// CountUnreadNotifications counts the notifications raised since the admin last opened the
+// notification center
+func CountUnreadNotifications(db *database.DB, username string) (int, error) {
+	ctx, cancel := db.Context(database.Read)
+	defer cancel()
+
+	var unread int
+	err := db.Pool.QueryRow(ctx, `
+		SELECT COUNT(*) FROM notifications
+		WHERE created_at > COALESCE(
+		    (SELECT notifications_seen_at FROM admin_preferences WHERE username = $1), '-infinity'
+		)
+	`, username).Scan(&unread)
+	if err != nil {
+		return 0, dbError("counting unread notifications", err)
+	}
+	return unread, nil
+}
+
+// MarkNotificationsSeen records that the admin has read every notification raised so far
+func MarkNotificationsSeen(db *database.DB, username string) error {
+	ctx, cancel := db.Context(database.Write)
+	defer cancel()
+
+	_, err := db.Pool.Exec(ctx, `
+		INSERT INTO admin_preferences (username, notifications_seen_at)
+		VALUES ($1, CURRENT_TIMESTAMP)
+		ON CONFLICT (username) DO UPDATE SET notifications_seen_at = EXCLUDED.notifications_seen_at
+	`, username)
+	if err != nil {
+		return dbError("marking notifications seen", err)
+	}
+	return nil
+}
+
+// notificationsSeenAt is when the admin last opened the notification center
+func notificationsSeenAt(db *database.DB, username string) (*time.Time, error) {
+	ctx, cancel := db.Context(database.Read)
+	defer cancel()
+
+	var seenAt *time.Time
+	err := db.Pool.QueryRow(ctx, `SELECT notifications_seen_at FROM admin_preferences WHERE username = $1`, username).Scan(&seenAt)
+	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		return nil, dbError("getting notifications seen", err)
+	}
+	return seenAt, nil
+}
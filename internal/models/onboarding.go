@@ -0,0 +1,101 @@
+package models
+
+import (
+	"fmt"
+
+	"github.com/ngenohkevin/kuiper_admin/internal/database"
+)
+
+// OnboardingStep is one item of the setup checklist shown on the dashboard of a new store
+type OnboardingStep struct {
+	Title string `json:"title"`
+	Hint  string `json:"hint"`
+	URL   string `json:"url,omitempty"` // Where the step is done, empty when it's done outside the admin
+	Done  bool   `json:"done"`
+}
+
+// Onboarding is the setup checklist. Each step is worked out from the data in the store, so
+// it ticks itself off as the admin goes and comes back if the data is removed again.
+type Onboarding struct {
+	Steps []OnboardingStep `json:"steps"`
+}
+
+// Completed counts the steps that are done
+func (o Onboarding) Completed() int {
+	completed := 0
+	for _, step := range o.Steps {
+		if step.Done {
+			completed++
+		}
+	}
+	return completed
+}
+
+// Finished reports whether every step is done
+func (o Onboarding) Finished() bool {
+	return o.Completed() == len(o.Steps)
+}
+
+// GetOnboarding checks each setup step against the store. storefrontConfigured tells whether
+// a storefront URL is set, in the store settings or the environment, and storageConfigured
+// whether a storage backend is chosen with all its settings.
+func GetOnboarding(db *database.DB, storefrontConfigured, storageConfigured bool) (Onboarding, error) {
+	ctx, cancel := db.Context(database.Read)
+	defer cancel()
+
+	query := `
+		SELECT
+			EXISTS (SELECT 1 FROM categories WHERE deleted_at IS NULL),
+			EXISTS (SELECT 1 FROM products WHERE deleted_at IS NULL),
+			EXISTS (SELECT 1 FROM products WHERE deleted_at IS NULL AND cardinality(image_urls) > 0)
+	`
+
+	var hasCategory, hasProduct, hasImage bool
+	if err := db.Pool.QueryRow(ctx, query).Scan(&hasCategory, &hasProduct, &hasImage); err != nil {
+		return Onboarding{}, fmt.Errorf("error checking onboarding steps: %w", err)
+	}
+
+	admins, err := CountAdminUsers(db)
+	if err != nil {
+		return Onboarding{}, err
+	}
+
+	return Onboarding{Steps: []OnboardingStep{
+		{
+			Title: "Create your first category",
+			Hint:  "Categories group products on the storefront and in the admin.",
+			URL:   "/categories/new",
+			Done:  hasCategory,
+		},
+		{
+			Title: "Add your first product",
+			Hint:  "Give it a price, stock and a category so it can go on sale.",
+			URL:   "/products/new",
+			Done:  hasProduct,
+		},
+		{
+			Title: "Point the admin at your storefront",
+			Hint:  "Set the storefront URL so product pages and QR codes link to the live store.",
+			URL:   "/settings/store",
+			Done:  storefrontConfigured,
+		},
+		{
+			Title: "Add product images",
+			Hint:  "Images are stored where you host them; add their URLs to a product to check they load.",
+			URL:   "/products",
+			Done:  hasImage,
+		},
+		{
+			Title: "Configure storage for uploads",
+			Hint:  "Set STORAGE_BACKEND with its settings so uploaded images are kept in S3 or Supabase, or on purpose on this server.",
+			URL:   "/settings/diagnostics",
+			Done:  storageConfigured,
+		},
+		{
+			Title: "Invite a second admin",
+			Hint:  "Another account means the store isn't locked out when one password is lost.",
+			URL:   "/settings/admins",
+			Done:  admins > 1,
+		},
+	}}, nil
+}
@@ -0,0 +1,414 @@
+package models
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/ngenohkevin/kuiper_admin/internal/database"
+)
+
+// Ways a customer is told about their order
+const (
+	OrderNotifyEmail   = "email"   // An email to the customer
+	OrderNotifyWebhook = "webhook" // An order.status_changed event to the storefront's notification endpoint
+)
+
+// States of a queued order notification
+const (
+	OrderNotificationPending = "pending"
+	OrderNotificationSent    = "sent"
+	OrderNotificationFailed  = "failed"  // Gave up after maxOrderNotificationAttempts
+	OrderNotificationSkipped = "skipped" // Couldn't be sent at all, such as an email without an address
+)
+
+// maxOrderNotificationAttempts is how often a notification is tried before it is marked failed
+const maxOrderNotificationAttempts = 5
+
+// maxOrderSubjectLength matches the subject columns
+const maxOrderSubjectLength = 255
+
+// OrderStatusTemplate is what the customer is sent when an order reaches a status. Subject and
+// Body are Go text templates over OrderMessageData.
+type OrderStatusTemplate struct {
+	Status      string     `json:"status"`
+	SendEmail   bool       `json:"send_email"`
+	SendWebhook bool       `json:"send_webhook"`
+	Subject     string     `json:"subject"`
+	Body        string     `json:"body"`
+	UpdatedBy   string     `json:"updated_by"`
+	UpdatedAt   *time.Time `json:"updated_at,omitempty"`
+}
+
+// Enabled reports whether reaching the status sends anything
+func (t OrderStatusTemplate) Enabled() bool {
+	return t.SendEmail || t.SendWebhook
+}
+
+// OrderMessageData is what a status template can use, as in {{.OrderID}}
+type OrderMessageData struct {
+	OrderID        string
+	CustomerName   string // "there" when the storefront didn't send a name, for "Hi {{.CustomerName}}"
+	CustomerEmail  string
+	Status         string
+	PreviousStatus string
+	Total          string // Formatted, as in "$49.99"
+	ItemCount      int
+	PlacedAt       string // As in "Jan 2, 2006"
+	StorefrontURL  string // The store's base URL, empty until set
+	Carrier        string // Empty until the order is packed
+	TrackingNumber string // Empty until the order is packed, and when it was sent without one
+}
+
+// OrderNotification is one message queued for a customer when their order changed status
+type OrderNotification struct {
+	ID             string     `json:"id"`
+	OrderID        string     `json:"order_id"`
+	Status         string     `json:"status"`
+	PreviousStatus string     `json:"previous_status"`
+	Channel        string     `json:"channel"`   // One of the OrderNotify* constants
+	Recipient      string     `json:"recipient"` // The customer's email, if known
+	Subject        string     `json:"subject"`
+	Body           string     `json:"body"`
+	State          string     `json:"state"` // One of the OrderNotification* states
+	Attempts       int        `json:"attempts"`
+	Error          string     `json:"error,omitempty"`
+	CreatedBy      string     `json:"created_by"`
+	CreatedAt      time.Time  `json:"created_at"`
+	SentAt         *time.Time `json:"sent_at,omitempty"`
+	CustomerName   string     `json:"customer_name"`
+	Carrier        string     `json:"carrier"`         // The order's, as it is now
+	TrackingNumber string     `json:"tracking_number"` // The order's, as it is now
+}
+
+// orderMessageData fills in what a template can use for an order
+func orderMessageData(order Order, previous, storefrontURL string) OrderMessageData {
+	name := order.CustomerName
+	if name == "" {
+		name = "there"
+	}
+	return OrderMessageData{
+		OrderID:        order.ID,
+		CustomerName:   name,
+		CustomerEmail:  order.CustomerEmail,
+		Status:         order.Status,
+		PreviousStatus: previous,
+		Total:          order.Total.Format(),
+		ItemCount:      order.ItemCount,
+		PlacedAt:       order.PlacedAt.In(time.Local).Format("Jan 2, 2006"),
+		StorefrontURL:  storefrontURL,
+		Carrier:        order.Carrier,
+		TrackingNumber: order.TrackingNumber,
+	}
+}
+
+// sampleOrderMessage is what a template is tried on before it is saved
+var sampleOrderMessage = OrderMessageData{
+	OrderID: "1001", CustomerName: "Sam", CustomerEmail: "sam@example.com", Status: OrderShipped,
+	PreviousStatus: OrderProcessing, Total: "$49.99", ItemCount: 2, PlacedAt: "Jan 2, 2006",
+	StorefrontURL: "https://shop.example.com", Carrier: "DHL", TrackingNumber: "1234567890",
+}
+
+// Render fills the template's subject and body in for data. Fields that don't exist are an
+// error rather than left blank.
+func (t OrderStatusTemplate) Render(data OrderMessageData) (subject, body string, err error) {
+	subject, err = renderOrderText("subject", t.Subject, data)
+	if err != nil {
+		return "", "", err
+	}
+	body, err = renderOrderText("body", t.Body, data)
+	if err != nil {
+		return "", "", err
+	}
+	// A line break in a header would start another one
+	return strings.Join(strings.Fields(subject), " "), body, nil
+}
+
+// renderOrderText fills in one template, named for the field it came from
+func renderOrderText(name, text string, data OrderMessageData) (string, error) {
+	tmpl, err := template.New(name).Option("missingkey=error").Parse(text)
+	if err != nil {
+		return "", fmt.Errorf("the %s template is invalid: %w", name, err)
+	}
+	var out bytes.Buffer
+	if err := tmpl.Execute(&out, data); err != nil {
+		return "", fmt.Errorf("the %s template can't be filled in: %w", name, err)
+	}
+	return out.String(), nil
+}
+
+// NotifiableOrderStatuses are the statuses that can have a template. Orders only arrive as
+// placed, so the storefront's own confirmation covers that one.
+func NotifiableOrderStatuses() []string {
+	return slices.DeleteFunc(slices.Clone(OrderStatuses), func(s string) bool { return s == OrderPlaced })
+}
+
+// GetOrderStatusTemplates returns the template of each notifiable status, in status order.
+// Statuses without a saved template send nothing.
+func GetOrderStatusTemplates(db *database.DB) ([]OrderStatusTemplate, error) {
+	ctx, cancel := db.Context(database.Read)
+	defer cancel()
+
+	rows, err := db.Pool.Query(ctx, `
+		SELECT status, send_email, send_webhook, subject, body, updated_by, updated_at
+		FROM order_status_templates
+	`)
+	if err != nil {
+		return nil, dbError("getting order status templates", err)
+	}
+	defer rows.Close()
+
+	saved := make(map[string]OrderStatusTemplate)
+	for rows.Next() {
+		var t OrderStatusTemplate
+		if err := rows.Scan(&t.Status, &t.SendEmail, &t.SendWebhook, &t.Subject, &t.Body, &t.UpdatedBy, &t.UpdatedAt); err != nil {
+			return nil, fmt.Errorf("error scanning order status template: %w", err)
+		}
+		saved[t.Status] = t
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating order status templates: %w", err)
+	}
+
+	var templates []OrderStatusTemplate
+	for _, status := range NotifiableOrderStatuses() {
+		t, ok := saved[status]
+		if !ok {
+			t = OrderStatusTemplate{Status: status}
+		}
+		templates = append(templates, t)
+	}
+	return templates, nil
+}
+
+// SaveOrderStatusTemplate replaces a status's template, after checking it renders
+func SaveOrderStatusTemplate(db *database.DB, t OrderStatusTemplate, actor string) (OrderStatusTemplate, error) {
+	t.Subject = strings.TrimSpace(t.Subject)
+	t.Body = strings.TrimSpace(t.Body)
+	if !slices.Contains(NotifiableOrderStatuses(), t.Status) {
+		return OrderStatusTemplate{}, fmt.Errorf("%q isn't a status customers can be notified of", t.Status)
+	}
+	if len(t.Subject) > maxOrderSubjectLength {
+		return OrderStatusTemplate{}, fmt.Errorf("the subject can be at most %d characters", maxOrderSubjectLength)
+	}
+	if t.Enabled() && t.Subject == "" {
+		return OrderStatusTemplate{}, fmt.Errorf("a subject is required to send notifications")
+	}
+	if t.SendEmail && t.Body == "" {
+		return OrderStatusTemplate{}, fmt.Errorf("a body is required to send emails")
+	}
+	if _, _, err := t.Render(sampleOrderMessage); err != nil {
+		return OrderStatusTemplate{}, err
+	}
+
+	ctx, cancel := db.Context(database.Write)
+	defer cancel()
+
+	err := db.Pool.QueryRow(ctx, `
+		INSERT INTO order_status_templates (status, send_email, send_webhook, subject, body, updated_by, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, CURRENT_TIMESTAMP)
+		ON CONFLICT (status) DO UPDATE SET
+			send_email = EXCLUDED.send_email, send_webhook = EXCLUDED.send_webhook,
+			subject = EXCLUDED.subject, body = EXCLUDED.body,
+			updated_by = EXCLUDED.updated_by, updated_at = EXCLUDED.updated_at
+		RETURNING updated_by, updated_at
+	`, t.Status, t.SendEmail, t.SendWebhook, t.Subject, t.Body, actor).Scan(&t.UpdatedBy, &t.UpdatedAt)
+	if err != nil {
+		return OrderStatusTemplate{}, dbError("saving order status template", err)
+	}
+	return t, nil
+}
+
+// storefrontURL is the store's base URL from the store settings, or STOREFRONT_URL
+func storefrontURL(db *database.DB) string {
+	settings, err := GetStoreSettings(db)
+	if err == nil && settings.StorefrontURL != "" {
+		return settings.StorefrontURL
+	}
+	return strings.TrimRight(os.Getenv("STOREFRONT_URL"), "/")
+}
+
+// queueOrderNotifications queues what the template of the order's new status turns on. An email
+// to a customer without an address is logged as skipped, so the order page says why none went.
+func queueOrderNotifications(ctx context.Context, db *database.DB, tx pgx.Tx, order Order, previous, actor string) ([]OrderNotification, error) {
+	var t OrderStatusTemplate
+	err := tx.QueryRow(ctx, `
+		SELECT status, send_email, send_webhook, subject, body FROM order_status_templates WHERE status = $1
+	`, order.Status).Scan(&t.Status, &t.SendEmail, &t.SendWebhook, &t.Subject, &t.Body)
+	if errors.Is(err, pgx.ErrNoRows) || (err == nil && !t.Enabled()) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, dbError("getting order status template", err)
+	}
+
+	subject, body, err := t.Render(orderMessageData(order, previous, storefrontURL(db)))
+	if err != nil {
+		return nil, fmt.Errorf("the %s template couldn't be used: %w", order.Status, err)
+	}
+
+	var channels []string
+	if t.SendEmail {
+		channels = append(channels, OrderNotifyEmail)
+	}
+	if t.SendWebhook {
+		channels = append(channels, OrderNotifyWebhook)
+	}
+
+	var queued []OrderNotification
+	for _, channel := range channels {
+		n := OrderNotification{
+			OrderID: order.ID, Status: order.Status, PreviousStatus: previous, Channel: channel,
+			Recipient: order.CustomerEmail, Subject: subject, Body: body, State: OrderNotificationPending,
+			CreatedBy: actor, CustomerName: order.CustomerName, Carrier: order.Carrier, TrackingNumber: order.TrackingNumber,
+		}
+		if channel == OrderNotifyEmail && order.CustomerEmail == "" {
+			n.State, n.Error = OrderNotificationSkipped, "The storefront didn't send the customer's email"
+		}
+		err := tx.QueryRow(ctx, `
+			INSERT INTO order_notifications (order_id, status, previous_status, channel, recipient, subject, body, state, error, created_by)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+			RETURNING id, created_at
+		`, n.OrderID, n.Status, n.PreviousStatus, n.Channel, n.Recipient, n.Subject, n.Body, n.State, n.Error, n.CreatedBy,
+		).Scan(&n.ID, &n.CreatedAt)
+		if err != nil {
+			return nil, dbError("queueing order notification", err)
+		}
+		queued = append(queued, n)
+	}
+	return queued, nil
+}
+
+const orderNotificationColumns = `n.id, n.order_id, n.status, n.previous_status, n.channel, n.recipient, n.subject, n.body,
+	n.state, n.attempts, n.error, n.created_by, n.created_at, n.sent_at, o.customer_name, o.carrier, o.tracking_number`
+
+// scanOrderNotification reads a row selected with orderNotificationColumns
+func scanOrderNotification(row pgx.Row) (OrderNotification, error) {
+	var n OrderNotification
+	err := row.Scan(&n.ID, &n.OrderID, &n.Status, &n.PreviousStatus, &n.Channel, &n.Recipient, &n.Subject, &n.Body,
+		&n.State, &n.Attempts, &n.Error, &n.CreatedBy, &n.CreatedAt, &n.SentAt, &n.CustomerName, &n.Carrier, &n.TrackingNumber)
+	return n, err
+}
+
+// queryOrderNotifications runs a query selecting orderNotificationColumns
+func queryOrderNotifications(db *database.DB, action, query string, args ...interface{}) ([]OrderNotification, error) {
+	ctx, cancel := db.Context(database.List)
+	defer cancel()
+
+	rows, err := db.Pool.Query(ctx, query, args...)
+	if err != nil {
+		return nil, dbError(action, err)
+	}
+	defer rows.Close()
+
+	notifications := []OrderNotification{}
+	for rows.Next() {
+		n, err := scanOrderNotification(rows)
+		if err != nil {
+			return nil, fmt.Errorf("error scanning order notification: %w", err)
+		}
+		notifications = append(notifications, n)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating order notifications: %w", err)
+	}
+	return notifications, nil
+}
+
+// GetOrderNotifications is an order's send log, newest first
+func GetOrderNotifications(db *database.DB, orderID string) ([]OrderNotification, error) {
+	return queryOrderNotifications(db, "getting order notifications", `
+		SELECT `+orderNotificationColumns+`
+		FROM order_notifications n
+		JOIN storefront_orders o ON o.id = n.order_id
+		WHERE n.order_id = $1
+		ORDER BY n.created_at DESC
+	`, orderID)
+}
+
+// DueOrderNotifications returns up to limit pending notifications whose next attempt is due,
+// oldest first
+func DueOrderNotifications(db *database.DB, limit int) ([]OrderNotification, error) {
+	return queryOrderNotifications(db, "getting due order notifications", `
+		SELECT `+orderNotificationColumns+`
+		FROM order_notifications n
+		JOIN storefront_orders o ON o.id = n.order_id
+		WHERE n.state = 'pending' AND n.next_attempt_at <= CURRENT_TIMESTAMP
+		ORDER BY n.next_attempt_at
+		LIMIT $1
+	`, limit)
+}
+
+// MarkOrderNotificationSent records a delivered notification
+func MarkOrderNotificationSent(db *database.DB, id string) error {
+	ctx, cancel := db.Context(database.Write)
+	defer cancel()
+
+	_, err := db.Pool.Exec(ctx, `
+		UPDATE order_notifications
+		SET state = 'sent', attempts = attempts + 1, error = '', sent_at = CURRENT_TIMESTAMP
+		WHERE id = $1
+	`, id)
+	if err != nil {
+		return dbError("marking order notification sent", err)
+	}
+	return nil
+}
+
+// MarkOrderNotificationFailed records a failed attempt. The notification is tried again later,
+// waiting longer each time, until it has failed maxOrderNotificationAttempts times.
+func MarkOrderNotificationFailed(db *database.DB, id string, sendErr error) error {
+	ctx, cancel := db.Context(database.Write)
+	defer cancel()
+
+	_, err := db.Pool.Exec(ctx, `
+		UPDATE order_notifications
+		SET attempts = attempts + 1, error = $2,
+		    state = CASE WHEN attempts + 1 >= $3 THEN 'failed' ELSE 'pending' END,
+		    next_attempt_at = CURRENT_TIMESTAMP + (attempts + 1) * (attempts + 1) * INTERVAL '1 minute'
+		WHERE id = $1
+	`, id, sendErr.Error(), maxOrderNotificationAttempts)
+	if err != nil {
+		return dbError("marking order notification failed", err)
+	}
+	return nil
+}
+
+// MarkOrderNotificationSkipped records a notification that can't be sent, with why
+func MarkOrderNotificationSkipped(db *database.DB, id, reason string) error {
+	ctx, cancel := db.Context(database.Write)
+	defer cancel()
+
+	_, err := db.Pool.Exec(ctx, `UPDATE order_notifications SET state = 'skipped', error = $2 WHERE id = $1`, id, reason)
+	if err != nil {
+		return dbError("marking order notification skipped", err)
+	}
+	return nil
+}
+
+// RetryOrderNotification queues a failed or skipped notification of an order again, as it was
+// rendered the first time
+func RetryOrderNotification(db *database.DB, orderID, id string) error {
+	ctx, cancel := db.Context(database.Write)
+	defer cancel()
+
+	tag, err := db.Pool.Exec(ctx, `
+		UPDATE order_notifications
+		SET state = 'pending', attempts = 0, error = '', next_attempt_at = CURRENT_TIMESTAMP
+		WHERE id = $1 AND order_id = $2 AND state IN ('failed', 'skipped')
+	`, id, orderID)
+	if err != nil {
+		return dbError("retrying order notification", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return conflict("notification not found or not failed")
+	}
+	return nil
+}
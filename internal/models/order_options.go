@@ -0,0 +1,121 @@
+package models
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/ngenohkevin/kuiper_admin/internal/database"
+)
+
+// Ways a product or variant can be sold while it has no stock
+const (
+	OrderModeBackorder = "backorder" // Out of stock for now, shipped when restocked
+	OrderModePreorder  = "preorder"  // Not released yet, shipped on release
+)
+
+// OrderOptions let an out of stock product or variant be sold deliberately. They are
+// columns on products and fields in each variant's JSON, and appear in API responses.
+type OrderOptions struct {
+	Backorder  bool       `json:"backorder,omitempty"`
+	Preorder   bool       `json:"preorder,omitempty"`
+	ExpectedAt *time.Time `json:"expected_at,omitempty"` // When stock is expected to be available
+}
+
+// NewOrderOptions builds the options for a mode, which is empty or one of the OrderMode*
+// constants. A preorder needs the date stock is expected.
+func NewOrderOptions(mode string, expectedAt *time.Time) (OrderOptions, error) {
+	switch mode {
+	case "":
+		return OrderOptions{}, nil
+	case OrderModeBackorder:
+		return OrderOptions{Backorder: true, ExpectedAt: expectedAt}, nil
+	case OrderModePreorder:
+		if expectedAt == nil {
+			return OrderOptions{}, fmt.Errorf("a preorder needs an expected availability date")
+		}
+		return OrderOptions{Preorder: true, ExpectedAt: expectedAt}, nil
+	}
+	return OrderOptions{}, fmt.Errorf("unknown order mode %q", mode)
+}
+
+// Mode returns the OrderMode* constant the options are set to, or empty
+func (o OrderOptions) Mode() string {
+	switch {
+	case o.Preorder:
+		return OrderModePreorder
+	case o.Backorder:
+		return OrderModeBackorder
+	}
+	return ""
+}
+
+// Badge labels the options for the admin, e.g. "Preorder · Mar 3", or is empty
+func (o OrderOptions) Badge() string {
+	var label string
+	switch o.Mode() {
+	case OrderModePreorder:
+		label = "Preorder"
+	case OrderModeBackorder:
+		label = "Backorder"
+	default:
+		return ""
+	}
+	if o.ExpectedAt != nil {
+		label += " · " + o.ExpectedAt.Format("Jan 2")
+	}
+	return label
+}
+
+// SetProductOrderOptions replaces a product's backorder and preorder settings
+func SetProductOrderOptions(db *database.DB, id string, opts OrderOptions) error {
+	ctx, cancel := db.Context(database.Write)
+	defer cancel()
+
+	tag, err := db.Pool.Exec(ctx, `
+		UPDATE products SET backorder = $2, preorder = $3, expected_at = $4, updated_at = CURRENT_TIMESTAMP
+		WHERE id = $1 AND deleted_at IS NULL
+	`, id, opts.Backorder, opts.Preorder, opts.ExpectedAt)
+	if err != nil {
+		return dbError("updating order options", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return notFound("product %s not found", id)
+	}
+
+	invalidateProductCache(db)
+	return nil
+}
+
+// SetVariantOrderOptions replaces one variant's backorder and preorder settings in place,
+// leaving the rest of the variant and its position untouched
+func SetVariantOrderOptions(db *database.DB, productID, variantID string, opts OrderOptions) error {
+	ctx, cancel := db.Context(database.Write)
+	defer cancel()
+
+	optsJSON, err := json.Marshal(opts)
+	if err != nil {
+		return fmt.Errorf("error encoding order options: %w", err)
+	}
+
+	tag, err := db.Pool.Exec(ctx, `
+		UPDATE products p SET variants = (
+			SELECT jsonb_agg(
+				CASE WHEN v->>'id' = $2 THEN (v - 'backorder' - 'preorder' - 'expected_at') || $3::jsonb ELSE v END
+				ORDER BY ord)
+			FROM jsonb_array_elements(p.variants) WITH ORDINALITY AS t(v, ord)
+		), updated_at = CURRENT_TIMESTAMP
+		WHERE p.id = $1 AND p.deleted_at IS NULL
+		  AND p.variants @> jsonb_build_array(jsonb_build_object('id', $2::text))
+	`, productID, variantID, string(optsJSON))
+	if err != nil {
+		return dbError("updating variant order options", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return notFound("variant not found")
+	}
+	syncCommittedVariantRows(ctx, db, productID)
+
+	invalidateProductCache(db)
+	return nil
+}
@@ -0,0 +1,307 @@
+package models
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/mail"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/ngenohkevin/kuiper_admin/internal/database"
+	"github.com/ngenohkevin/kuiper_admin/internal/money"
+	"github.com/ngenohkevin/kuiper_admin/internal/shipping"
+)
+
+// Order statuses, in the order an order usually moves through them
+const (
+	OrderPlaced     = "placed"
+	OrderProcessing = "processing"
+	OrderShipped    = "shipped"
+	OrderDelivered  = "delivered"
+	OrderCancelled  = "cancelled"
+	OrderRefunded   = "refunded"
+)
+
+// OrderStatuses lists every status, in the order an order usually moves through them
+var OrderStatuses = []string{OrderPlaced, OrderProcessing, OrderShipped, OrderDelivered, OrderCancelled, OrderRefunded}
+
+// Order is an order the storefront reported, as admins work on it
+type Order struct {
+	ID              string            `json:"id"` // The storefront's order ID
+	SessionID       string            `json:"session_id"`
+	CustomerEmail   string            `json:"customer_email"`
+	CustomerName    string            `json:"customer_name"`
+	Total           money.Amount      `json:"total"`
+	Status          string            `json:"status"`
+	PlacedAt        time.Time         `json:"placed_at"`
+	StatusChangedAt *time.Time        `json:"status_changed_at,omitempty"` // Nil until an admin first changes the status
+	ItemCount       int               `json:"item_count"`                  // Units over all lines
+	PackedAt        *time.Time        `json:"packed_at,omitempty"`         // Nil until the order is packed
+	PackedBy        string            `json:"packed_by,omitempty"`
+	Carrier         string            `json:"carrier,omitempty"`
+	TrackingNumber  string            `json:"tracking_number,omitempty"`
+	Lines           []OrderLine       `json:"lines,omitempty"`            // Only loaded for a single order
+	ShippingAddress *shipping.Address `json:"shipping_address,omitempty"` // Only loaded for a single order; nil when the storefront didn't send one
+}
+
+// OrderLine is one line of an order as it was placed
+type OrderLine struct {
+	ProductID   string       `json:"product_id"`
+	ProductName string       `json:"product_name"`
+	VariantID   string       `json:"variant_id"`
+	Quantity    int          `json:"quantity"`
+	UnitPrice   money.Amount `json:"unit_price"`
+}
+
+// OrderCustomer is who placed an order and where it goes, when the storefront says. Every field
+// is optional, but without an email the customer can't be sent status emails, and without a
+// shipping address no label can be bought for the order.
+type OrderCustomer struct {
+	Email           string            `json:"customer_email"`
+	Name            string            `json:"customer_name"`
+	ShippingAddress *shipping.Address `json:"shipping_address"`
+}
+
+// Limits matching the customer columns
+const (
+	maxCustomerEmailLength = 255
+	maxCustomerNameLength  = 255
+	maxAddressFieldLength  = 255
+)
+
+// normalize trims the customer's details and checks the email is an address
+func (c *OrderCustomer) normalize() error {
+	c.Email = strings.TrimSpace(c.Email)
+	c.Name = strings.TrimSpace(c.Name)
+	if len(c.Email) > maxCustomerEmailLength {
+		return fmt.Errorf("customer email can be at most %d characters", maxCustomerEmailLength)
+	}
+	if len(c.Name) > maxCustomerNameLength {
+		return fmt.Errorf("customer name can be at most %d characters", maxCustomerNameLength)
+	}
+	if c.Email != "" {
+		addr, err := mail.ParseAddress(c.Email)
+		if err != nil || addr.Address != c.Email {
+			return fmt.Errorf("customer email %q isn't an email address", c.Email)
+		}
+	}
+	if c.ShippingAddress != nil {
+		return normalizeShippingAddress(c.ShippingAddress)
+	}
+	return nil
+}
+
+// normalizeShippingAddress trims an address and checks it has what a label needs: a street,
+// a city and a two-letter country code
+func normalizeShippingAddress(a *shipping.Address) error {
+	fields := []*string{&a.Name, &a.Street1, &a.Street2, &a.City, &a.State, &a.Zip, &a.Country, &a.Phone, &a.Email}
+	for _, f := range fields {
+		*f = strings.TrimSpace(*f)
+		if len(*f) > maxAddressFieldLength {
+			return fmt.Errorf("shipping address fields can be at most %d characters", maxAddressFieldLength)
+		}
+	}
+	a.Country = strings.ToUpper(a.Country)
+	if a.Street1 == "" || a.City == "" {
+		return fmt.Errorf("shipping address needs street1 and city")
+	}
+	if len(a.Country) != 2 {
+		return fmt.Errorf("shipping address country must be a two-letter code, as in KE")
+	}
+	return nil
+}
+
+// OrderSorts are the orders the order list can be sorted in
+var OrderSorts = SortOptions{
+	Columns: map[string]string{
+		"placed": "o.placed_at",
+		"total":  "o.total",
+		"status": "o.status",
+	},
+	Default: "-placed",
+}
+
+const orderColumns = `o.id, o.session_id, o.customer_email, o.customer_name, o.total, o.status, o.placed_at,
+	o.status_changed_at, COALESCE((SELECT SUM(i.quantity) FROM storefront_order_items i WHERE i.order_id = o.id), 0)::int,
+	o.packed_at, o.packed_by, o.carrier, o.tracking_number`
+
+// scanOrder reads a row selected with orderColumns
+func scanOrder(row pgx.Row) (Order, error) {
+	var o Order
+	err := row.Scan(&o.ID, &o.SessionID, &o.CustomerEmail, &o.CustomerName, &o.Total, &o.Status, &o.PlacedAt,
+		&o.StatusChangedAt, &o.ItemCount, &o.PackedAt, &o.PackedBy, &o.Carrier, &o.TrackingNumber)
+	return o, err
+}
+
+// GetOrdersPaginated retrieves a page of orders whose ID, customer email or customer name
+// matches the search. q.Filter is an order status, or empty for every order.
+func GetOrdersPaginated(db *database.DB, q ListQuery) (PaginatedResult[Order], error) {
+	ctx, cancel := db.Context(database.List)
+	defer cancel()
+
+	offset := q.offset()
+	var b queryBuilder
+	if q.Filter != "" {
+		b.where("o.status = ?", q.Filter)
+	}
+	if q.Search != "" {
+		pattern := "%" + q.Search + "%"
+		b.where("o.id ILIKE ? OR o.customer_email ILIKE ? OR o.customer_name ILIKE ?", pattern, pattern, pattern)
+	}
+	where := " FROM storefront_orders o " + b.whereClause()
+
+	var totalCount int64
+	if err := db.Pool.QueryRow(ctx, "SELECT COUNT(*)"+where, b.args...).Scan(&totalCount); err != nil {
+		return PaginatedResult[Order]{}, dbError("counting orders", err)
+	}
+
+	rows, err := db.Pool.Query(ctx, `SELECT `+orderColumns+where+`
+		ORDER BY `+OrderSorts.orderBy(q.Sort, "o.id")+`
+		LIMIT `+b.arg(q.PageSize)+` OFFSET `+b.arg(offset), b.args...)
+	if err != nil {
+		return PaginatedResult[Order]{}, dbError("getting orders", err)
+	}
+	defer rows.Close()
+
+	orders := []Order{}
+	for rows.Next() {
+		o, err := scanOrder(rows)
+		if err != nil {
+			return PaginatedResult[Order]{}, fmt.Errorf("error scanning order: %w", err)
+		}
+		orders = append(orders, o)
+	}
+	if err := rows.Err(); err != nil {
+		return PaginatedResult[Order]{}, fmt.Errorf("error iterating orders: %w", err)
+	}
+
+	return newPage(orders, totalCount, q), nil
+}
+
+// CountOrdersByStatus counts the orders in each status, for the filter chips
+func CountOrdersByStatus(db *database.DB) (map[string]int, error) {
+	ctx, cancel := db.Context(database.Read)
+	defer cancel()
+
+	rows, err := db.Pool.Query(ctx, `SELECT status, COUNT(*) FROM storefront_orders GROUP BY status`)
+	if err != nil {
+		return nil, dbError("counting orders", err)
+	}
+	defer rows.Close()
+
+	counts := make(map[string]int)
+	for rows.Next() {
+		var status string
+		var n int
+		if err := rows.Scan(&status, &n); err != nil {
+			return nil, fmt.Errorf("error scanning order count: %w", err)
+		}
+		counts[status] = n
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating order counts: %w", err)
+	}
+	return counts, nil
+}
+
+// GetOrder retrieves one order with its lines
+func GetOrder(db *database.DB, id string) (Order, error) {
+	ctx, cancel := db.Context(database.Read)
+	defer cancel()
+
+	o, err := scanOrder(db.Pool.QueryRow(ctx, `SELECT `+orderColumns+` FROM storefront_orders o WHERE o.id = $1`, id))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return Order{}, notFound("order %s not found", id)
+	}
+	if err != nil {
+		return Order{}, dbError("getting order", err)
+	}
+
+	var address []byte
+	if err := db.Pool.QueryRow(ctx, `SELECT shipping_address FROM storefront_orders WHERE id = $1`, id).Scan(&address); err != nil {
+		return Order{}, dbError("getting shipping address", err)
+	}
+	if address != nil {
+		if err := json.Unmarshal(address, &o.ShippingAddress); err != nil {
+			return Order{}, fmt.Errorf("error decoding shipping address: %w", err)
+		}
+	}
+
+	rows, err := db.Pool.Query(ctx, `
+		SELECT i.product_id, COALESCE(p.name, i.product_name), i.variant_id, i.quantity, i.unit_price
+		FROM storefront_order_items i
+		LEFT JOIN products p ON p.id = i.product_id
+		WHERE i.order_id = $1
+		ORDER BY i.product_name, i.variant_id
+	`, id)
+	if err != nil {
+		return Order{}, dbError("getting order lines", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var line OrderLine
+		if err := rows.Scan(&line.ProductID, &line.ProductName, &line.VariantID, &line.Quantity, &line.UnitPrice); err != nil {
+			return Order{}, fmt.Errorf("error scanning order line: %w", err)
+		}
+		o.Lines = append(o.Lines, line)
+	}
+	if err := rows.Err(); err != nil {
+		return Order{}, fmt.Errorf("error iterating order lines: %w", err)
+	}
+	return o, nil
+}
+
+// SetOrderStatus moves an order to status. With notify set, the customer notifications the
+// status's template turns on are queued in the same transaction, for the notification job to
+// send; they are returned with the order.
+func SetOrderStatus(db *database.DB, id, status string, notify bool, actor string) (Order, []OrderNotification, error) {
+	if !slices.Contains(OrderStatuses, status) {
+		return Order{}, nil, fmt.Errorf("%q isn't an order status", status)
+	}
+
+	ctx, cancel := db.Context(database.Write)
+	defer cancel()
+
+	tx, err := db.Pool.Begin(ctx)
+	if err != nil {
+		return Order{}, nil, fmt.Errorf("error starting transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	order, err := scanOrder(tx.QueryRow(ctx, `SELECT `+orderColumns+` FROM storefront_orders o WHERE o.id = $1 FOR UPDATE`, id))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return Order{}, nil, notFound("order %s not found", id)
+	}
+	if err != nil {
+		return Order{}, nil, dbError("getting order", err)
+	}
+	if order.Status == status {
+		return Order{}, nil, conflict("order %s is already %s", id, status)
+	}
+
+	previous := order.Status
+	if err := tx.QueryRow(ctx, `
+		UPDATE storefront_orders SET status = $2, status_changed_at = CURRENT_TIMESTAMP
+		WHERE id = $1
+		RETURNING status, status_changed_at
+	`, id, status).Scan(&order.Status, &order.StatusChangedAt); err != nil {
+		return Order{}, nil, dbError("updating order status", err)
+	}
+
+	var queued []OrderNotification
+	if notify {
+		queued, err = queueOrderNotifications(ctx, db, tx, order, previous, actor)
+		if err != nil {
+			return Order{}, nil, err
+		}
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return Order{}, nil, fmt.Errorf("error committing order status: %w", err)
+	}
+	return order, queued, nil
+}
@@ -0,0 +1,143 @@
+package models
+
+import (
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/ngenohkevin/kuiper_admin/internal/database"
+)
+
+// OrphanedMediaGrace is how long an image waits after it stops being used before the media
+// cleanup job deletes it, so an undo or a restored edit still finds its files
+const OrphanedMediaGrace = 24 * time.Hour
+
+// maxOrphanedMediaAttempts is how many times deleting an image is tried before it is left alone
+const maxOrphanedMediaAttempts = 5
+
+// orphanedMediaInUse matches the queued images a product, trashed or not, or a banner uses
+const orphanedMediaInUse = `
+	EXISTS (SELECT 1 FROM products p WHERE orphaned_media.url = ANY(p.image_urls))
+	OR EXISTS (SELECT 1 FROM banners b WHERE b.image_url = orphaned_media.url)
+`
+
+// QueueOrphanedMedia records image URLs that may no longer be used, for the media cleanup job
+// to delete from storage. Links to other sites can be included; the job leaves them alone.
+func QueueOrphanedMedia(db *database.DB, imageURLs []string) error {
+	if len(imageURLs) == 0 {
+		return nil
+	}
+
+	ctx, cancel := db.Context(database.Write)
+	defer cancel()
+
+	_, err := db.Pool.Exec(ctx, `
+		INSERT INTO orphaned_media (url)
+		SELECT DISTINCT url FROM unnest($1::text[]) AS url WHERE url <> ''
+		ON CONFLICT (url) DO UPDATE SET orphaned_at = CURRENT_TIMESTAMP, attempts = 0, error = ''
+	`, imageURLs)
+	if err != nil {
+		return dbError("recording orphaned images", err)
+	}
+	return nil
+}
+
+// TakeOrphanedMedia returns up to limit queued image URLs that have waited out the grace period
+// and are still unused. Those something has started using again are dropped from the queue.
+func TakeOrphanedMedia(db *database.DB, limit int) ([]string, error) {
+	ctx, cancel := db.Context(database.Bulk)
+	defer cancel()
+
+	_, err := db.Pool.Exec(ctx, `DELETE FROM orphaned_media WHERE `+orphanedMediaInUse)
+	if err != nil {
+		return nil, dbError("dropping images back in use", err)
+	}
+
+	rows, err := db.Pool.Query(ctx, `
+		SELECT url FROM orphaned_media
+		WHERE orphaned_at < $1 AND attempts < $2
+		ORDER BY orphaned_at
+		LIMIT $3
+	`, time.Now().Add(-OrphanedMediaGrace), maxOrphanedMediaAttempts, limit)
+	if err != nil {
+		return nil, dbError("getting orphaned images", err)
+	}
+	defer rows.Close()
+
+	var urls []string
+	for rows.Next() {
+		var url string
+		if err := rows.Scan(&url); err != nil {
+			return nil, dbError("scanning orphaned image", err)
+		}
+		urls = append(urls, url)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, dbError("iterating orphaned images", err)
+	}
+	return urls, nil
+}
+
+// MediaUsedByOtherStores reports whether a product or banner of another store in the database,
+// the main one or a tenant, enabled or not, uses an image. Every store uploads to the same
+// storage, so an image one store stopped using may be one another still shows.
+func MediaUsedByOtherStores(db *database.DB, url string) (bool, error) {
+	ctx, cancel := db.Context(database.Read)
+	defer cancel()
+
+	// Each store's schema has the media cleanup queue
+	rows, err := db.Pool.Query(ctx, `
+		SELECT table_schema FROM information_schema.tables
+		WHERE table_name = 'orphaned_media' AND table_schema <> current_schema()
+	`)
+	if err != nil {
+		return false, dbError("finding other stores", err)
+	}
+	defer rows.Close()
+
+	var schemas []string
+	for rows.Next() {
+		var schema string
+		if err := rows.Scan(&schema); err != nil {
+			return false, dbError("scanning store schema", err)
+		}
+		schemas = append(schemas, schema)
+	}
+	if err := rows.Err(); err != nil {
+		return false, dbError("iterating store schemas", err)
+	}
+	if len(schemas) == 0 {
+		return false, nil
+	}
+
+	uses := make([]string, 0, 2*len(schemas))
+	for _, schema := range schemas {
+		uses = append(uses,
+			`SELECT 1 FROM `+pgx.Identifier{schema, "products"}.Sanitize()+` WHERE $1 = ANY(image_urls)`,
+			`SELECT 1 FROM `+pgx.Identifier{schema, "banners"}.Sanitize()+` WHERE image_url = $1`,
+		)
+	}
+	var used bool
+	if err := db.Pool.QueryRow(ctx, `SELECT EXISTS (`+strings.Join(uses, " UNION ALL ")+`)`, url).Scan(&used); err != nil {
+		return false, dbError("checking other stores' images", err)
+	}
+	return used, nil
+}
+
+// FinishOrphanedMedia takes a deleted image off the queue, or records why deleting it failed so
+// it is tried again on a later run
+func FinishOrphanedMedia(db *database.DB, url string, deleteErr error) error {
+	ctx, cancel := db.Context(database.Write)
+	defer cancel()
+
+	var err error
+	if deleteErr == nil {
+		_, err = db.Pool.Exec(ctx, `DELETE FROM orphaned_media WHERE url = $1`, url)
+	} else {
+		_, err = db.Pool.Exec(ctx, `UPDATE orphaned_media SET attempts = attempts + 1, error = $2 WHERE url = $1`, url, deleteErr.Error())
+	}
+	if err != nil {
+		return dbError("recording orphaned image cleanup", err)
+	}
+	return nil
+}
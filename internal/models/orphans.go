@@ -0,0 +1,206 @@
+package models
+
+import (
+	"fmt"
+
+	"github.com/ngenohkevin/kuiper_admin/internal/database"
+)
+
+// OrphanCheck is one kind of orphaned data the maintenance page looks for
+type OrphanCheck struct {
+	Type        string `json:"type"`
+	Label       string `json:"label"`
+	Description string `json:"description"`
+	Fix         string `json:"fix"`
+	Count       int    `json:"count"`
+}
+
+// OrphanRow is a record found by an orphan check
+type OrphanRow struct {
+	ID     string `json:"id"`
+	Name   string `json:"name"`
+	Detail string `json:"detail"`
+}
+
+// orphanQuery finds and fixes one kind of orphaned data. list returns id, name and detail
+// for the matching rows, limited to the IDs in $1 when it is not NULL; cleanup fixes the
+// rows whose IDs are in $1 and must repeat the orphan condition so fixed rows are skipped.
+type orphanQuery struct {
+	check   OrphanCheck
+	list    string
+	cleanup string
+}
+
+// orphanLimit caps how many rows one cleanup looks at so it fits in the request timeout
+const orphanLimit = 1000
+
+var orphanQueries = []orphanQuery{
+	{
+		check: OrphanCheck{
+			Type:        "review-product",
+			Label:       "Reviews without a product",
+			Description: "Live reviews whose product is missing or in the trash.",
+			Fix:         "Move the reviews to the trash",
+		},
+		list: `
+			SELECT r.id::text, COALESCE(NULLIF(r.reviewer_name, ''), 'Anonymous') || ': ' || LEFT(r.comment, 80),
+			       CASE WHEN r.product_id IS NULL THEN 'no product'
+			            WHEN p.id IS NULL THEN 'product ' || r.product_id || ' does not exist'
+			            ELSE p.name || ' is in the trash' END
+			FROM reviews r
+			LEFT JOIN products p ON p.id = r.product_id
+			WHERE r.deleted_at IS NULL AND (p.id IS NULL OR p.deleted_at IS NOT NULL)
+			  AND ($1::text[] IS NULL OR r.id::text = ANY($1::text[]))
+			ORDER BY r.created_at DESC
+			LIMIT $2`,
+		cleanup: `
+			UPDATE reviews r SET deleted_at = CURRENT_TIMESTAMP
+			WHERE r.id::text = ANY($1::text[]) AND r.deleted_at IS NULL
+			  AND NOT EXISTS (SELECT 1 FROM products p WHERE p.id = r.product_id AND p.deleted_at IS NULL)`,
+	},
+	{
+		check: OrphanCheck{
+			Type:        "product-category",
+			Label:       "Products in a deleted category",
+			Description: "Live products whose category is missing or in the trash.",
+			Fix:         "Clear the products' category",
+		},
+		list: `
+			SELECT p.id::text, p.name,
+			       CASE WHEN c.id IS NULL THEN 'category ' || p.category_id || ' does not exist'
+			            ELSE c.name || ' is in the trash' END
+			FROM products p
+			LEFT JOIN categories c ON c.id = p.category_id
+			WHERE p.deleted_at IS NULL AND p.category_id IS NOT NULL AND (c.id IS NULL OR c.deleted_at IS NOT NULL)
+			  AND ($1::text[] IS NULL OR p.id::text = ANY($1::text[]))
+			ORDER BY p.name
+			LIMIT $2`,
+		cleanup: `
+			UPDATE products p SET category_id = NULL, updated_at = CURRENT_TIMESTAMP
+			WHERE p.id::text = ANY($1::text[]) AND p.category_id IS NOT NULL
+			  AND NOT EXISTS (SELECT 1 FROM categories c WHERE c.id = p.category_id AND c.deleted_at IS NULL)`,
+	},
+	{
+		check: OrphanCheck{
+			Type:        "variant-id",
+			Label:       "Variants without an ID",
+			Description: "Variants in a product's JSON with a missing or empty id, which can't be edited or deleted.",
+			Fix:         "Give each variant a new ID",
+		},
+		list: `
+			SELECT p.id::text, p.name,
+			       (SELECT COUNT(*) FROM jsonb_array_elements(p.variants) v WHERE COALESCE(v->>'id', '') = '') || ' variants without an ID'
+			FROM products p
+			WHERE jsonb_typeof(p.variants) = 'array'
+			  AND EXISTS (SELECT 1 FROM jsonb_array_elements(p.variants) v WHERE COALESCE(v->>'id', '') = '')
+			  AND ($1::text[] IS NULL OR p.id::text = ANY($1::text[]))
+			ORDER BY p.name
+			LIMIT $2`,
+		cleanup: `
+			UPDATE products p SET variants = (
+				SELECT jsonb_agg(
+					CASE WHEN COALESCE(v->>'id', '') = '' THEN v || jsonb_build_object('id', uuid_generate_v4()::text) ELSE v END
+					ORDER BY ord)
+				FROM jsonb_array_elements(p.variants) WITH ORDINALITY AS t(v, ord)
+			), updated_at = CURRENT_TIMESTAMP
+			WHERE p.id::text = ANY($1::text[]) AND jsonb_typeof(p.variants) = 'array'
+			  AND EXISTS (SELECT 1 FROM jsonb_array_elements(p.variants) v WHERE COALESCE(v->>'id', '') = '')`,
+	},
+}
+
+// GetOrphanChecks counts the rows each orphan check currently finds
+func GetOrphanChecks(db *database.DB) ([]OrphanCheck, error) {
+	ctx, cancel := db.Context(database.List)
+	defer cancel()
+
+	checks := make([]OrphanCheck, 0, len(orphanQueries))
+	for _, q := range orphanQueries {
+		check := q.check
+		// LIMIT NULL is no limit, so the count covers every orphan and not just one cleanup's worth
+		query := `SELECT COUNT(*) FROM (` + q.list + `) orphans`
+		if err := db.Pool.QueryRow(ctx, query, nil, nil).Scan(&check.Count); err != nil {
+			return nil, fmt.Errorf("error checking %s: %w", check.Type, err)
+		}
+		checks = append(checks, check)
+	}
+	return checks, nil
+}
+
+// GetOrphanCheck returns the check with the given type, without counting
+func GetOrphanCheck(checkType string) (OrphanCheck, error) {
+	for _, q := range orphanQueries {
+		if q.check.Type == checkType {
+			return q.check, nil
+		}
+	}
+	return OrphanCheck{}, notFound("unknown orphan check %q", checkType)
+}
+
+// CleanOrphans fixes the orphaned rows of one type in a transaction and lists them. With ids
+// only those rows are fixed, so a cleanup applies exactly what its dry run showed; rows fixed
+// in the meantime are skipped. A dry run lists the rows without changing anything.
+func CleanOrphans(db *database.DB, checkType string, ids []string, dryRun bool) ([]OrphanRow, error) {
+	var q *orphanQuery
+	for i := range orphanQueries {
+		if orphanQueries[i].check.Type == checkType {
+			q = &orphanQueries[i]
+		}
+	}
+	if q == nil {
+		return nil, notFound("unknown orphan check %q", checkType)
+	}
+
+	ctx, cancel := db.Context(database.Bulk)
+	defer cancel()
+
+	tx, err := db.Pool.Begin(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("error starting transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	rows, err := tx.Query(ctx, q.list, ids, orphanLimit)
+	if err != nil {
+		return nil, fmt.Errorf("error querying %s: %w", checkType, err)
+	}
+
+	var orphans []OrphanRow
+	for rows.Next() {
+		var row OrphanRow
+		if err := rows.Scan(&row.ID, &row.Name, &row.Detail); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("error scanning %s: %w", checkType, err)
+		}
+		orphans = append(orphans, row)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating %s: %w", checkType, err)
+	}
+
+	if dryRun || len(orphans) == 0 {
+		return orphans, nil
+	}
+
+	found := make([]string, 0, len(orphans))
+	for _, row := range orphans {
+		found = append(found, row.ID)
+	}
+	if _, err := tx.Exec(ctx, q.cleanup, found); err != nil {
+		return nil, fmt.Errorf("error cleaning up %s: %w", checkType, err)
+	}
+	if checkType == "variant-id" {
+		if err := syncVariantRows(ctx, tx, found...); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, fmt.Errorf("error committing %s cleanup: %w", checkType, err)
+	}
+
+	if checkType != "review-product" {
+		invalidateProductCache(db)
+	}
+	return orphans, nil
+}
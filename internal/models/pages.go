@@ -0,0 +1,279 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/ngenohkevin/kuiper_admin/internal/database"
+)
+
+// Limits matching the pages columns
+const (
+	maxPageSlugLength  = 100
+	maxPageTitleLength = 200
+)
+
+// Page is a piece of store content such as the shipping policy, with a Markdown body. Only
+// published pages are served to the storefront.
+type Page struct {
+	ID        string    `json:"id"`
+	Slug      string    `json:"slug"`
+	Title     string    `json:"title"`
+	Body      string    `json:"body"`
+	Published bool      `json:"published"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// PageRevision is a page as it was saved at one time
+type PageRevision struct {
+	ID        string    `json:"id"`
+	PageID    string    `json:"page_id"`
+	Title     string    `json:"title"`
+	Body      string    `json:"body"`
+	Published bool      `json:"published"`
+	CreatedBy string    `json:"created_by"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// validate tidies the page's fields, deriving the slug from the title when it is empty
+func (p *Page) validate() error {
+	p.Title = strings.TrimSpace(p.Title)
+	if p.Title == "" {
+		return fmt.Errorf("title is required")
+	}
+	if len([]rune(p.Title)) > maxPageTitleLength {
+		return fmt.Errorf("title can be at most %d characters", maxPageTitleLength)
+	}
+	p.Slug = Slugify(p.Slug)
+	if p.Slug == "" {
+		p.Slug = Slugify(p.Title)
+	}
+	if p.Slug == "" {
+		return fmt.Errorf("slug needs at least one letter or digit")
+	}
+	if len(p.Slug) > maxPageSlugLength {
+		return fmt.Errorf("slug can be at most %d characters", maxPageSlugLength)
+	}
+	return nil
+}
+
+const pageColumns = `id, slug, title, body, published, created_at, updated_at`
+
+// scanPage reads a row selected with pageColumns
+func scanPage(row pgx.Row) (Page, error) {
+	var p Page
+	err := row.Scan(&p.ID, &p.Slug, &p.Title, &p.Body, &p.Published, &p.CreatedAt, &p.UpdatedAt)
+	return p, err
+}
+
+// GetPages lists pages by title, only the published ones when publishedOnly is set
+func GetPages(db *database.DB, publishedOnly bool) ([]Page, error) {
+	ctx, cancel := db.Context(database.List)
+	defer cancel()
+
+	rows, err := db.Pool.Query(ctx, `
+		SELECT `+pageColumns+`
+		FROM pages
+		WHERE published OR NOT $1
+		ORDER BY title
+	`, publishedOnly)
+	if err != nil {
+		return nil, dbError("getting pages", err)
+	}
+	defer rows.Close()
+
+	pages := []Page{}
+	for rows.Next() {
+		p, err := scanPage(rows)
+		if err != nil {
+			return nil, fmt.Errorf("error scanning page: %w", err)
+		}
+		pages = append(pages, p)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating pages: %w", err)
+	}
+
+	return pages, nil
+}
+
+// GetPageByID retrieves a page, published or not
+func GetPageByID(db *database.DB, id string) (Page, error) {
+	ctx, cancel := db.Context(database.Read)
+	defer cancel()
+
+	p, err := scanPage(db.Pool.QueryRow(ctx, `SELECT `+pageColumns+` FROM pages WHERE id = $1`, id))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return Page{}, notFound("page not found")
+	}
+	if err != nil {
+		return Page{}, dbError("finding page", err)
+	}
+
+	return p, nil
+}
+
+// GetPublishedPage finds a published page by slug
+func GetPublishedPage(db *database.DB, slug string) (Page, error) {
+	ctx, cancel := db.Context(database.Read)
+	defer cancel()
+
+	p, err := scanPage(db.Pool.QueryRow(ctx, `SELECT `+pageColumns+` FROM pages WHERE slug = $1 AND published`, slug))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return Page{}, notFound("page %s not found", slug)
+	}
+	if err != nil {
+		return Page{}, dbError("finding page", err)
+	}
+
+	return p, nil
+}
+
+// CreatePage saves a new page and its first revision, credited to author
+func CreatePage(db *database.DB, page Page, author string) (Page, error) {
+	return savePage(db, page, author, `
+		INSERT INTO pages (slug, title, body, published)
+		VALUES ($1, $2, $3, $4)
+		RETURNING `+pageColumns)
+}
+
+// UpdatePage saves changes to a page and keeps them as a new revision, credited to author
+func UpdatePage(db *database.DB, page Page, author string) (Page, error) {
+	return savePage(db, page, author, `
+		UPDATE pages
+		SET slug = $1, title = $2, body = $3, published = $4, updated_at = CURRENT_TIMESTAMP
+		WHERE id = $5
+		RETURNING `+pageColumns)
+}
+
+// savePage runs query, an insert or update taking the page's slug, title, body, published flag
+// and, when it has one, ID, and records the result as a revision in the same transaction
+func savePage(db *database.DB, page Page, author, query string) (Page, error) {
+	if err := page.validate(); err != nil {
+		return Page{}, err
+	}
+
+	ctx, cancel := db.Context(database.Write)
+	defer cancel()
+
+	tx, err := db.Pool.Begin(ctx)
+	if err != nil {
+		return Page{}, fmt.Errorf("error starting transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	args := []interface{}{page.Slug, page.Title, page.Body, page.Published}
+	if page.ID != "" {
+		args = append(args, page.ID)
+	}
+	saved, err := scanPage(tx.QueryRow(ctx, query, args...))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return Page{}, notFound("page not found")
+	}
+	if err != nil {
+		return Page{}, dbError("saving page", err)
+	}
+
+	_, err = tx.Exec(ctx, `
+		INSERT INTO page_revisions (page_id, title, body, published, created_by)
+		VALUES ($1, $2, $3, $4, $5)
+	`, saved.ID, saved.Title, saved.Body, saved.Published, author)
+	if err != nil {
+		return Page{}, dbError("saving page revision", err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return Page{}, fmt.Errorf("error committing page: %w", err)
+	}
+
+	return saved, nil
+}
+
+// DeletePage removes a page and its revisions
+func DeletePage(db *database.DB, id string) error {
+	ctx, cancel := db.Context(database.Write)
+	defer cancel()
+
+	tag, err := db.Pool.Exec(ctx, `DELETE FROM pages WHERE id = $1`, id)
+	if err != nil {
+		return dbError("deleting page", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return notFound("page not found")
+	}
+
+	return nil
+}
+
+// GetPageRevisions lists a page's revisions, newest first, without their bodies
+func GetPageRevisions(db *database.DB, pageID string) ([]PageRevision, error) {
+	ctx, cancel := db.Context(database.List)
+	defer cancel()
+
+	rows, err := db.Pool.Query(ctx, `
+		SELECT id, page_id, title, published, created_by, created_at
+		FROM page_revisions
+		WHERE page_id = $1
+		ORDER BY created_at DESC
+	`, pageID)
+	if err != nil {
+		return nil, dbError("getting page revisions", err)
+	}
+	defer rows.Close()
+
+	revisions := []PageRevision{}
+	for rows.Next() {
+		var rev PageRevision
+		if err := rows.Scan(&rev.ID, &rev.PageID, &rev.Title, &rev.Published, &rev.CreatedBy, &rev.CreatedAt); err != nil {
+			return nil, fmt.Errorf("error scanning page revision: %w", err)
+		}
+		revisions = append(revisions, rev)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating page revisions: %w", err)
+	}
+
+	return revisions, nil
+}
+
+// GetPageRevision retrieves one of a page's revisions in full
+func GetPageRevision(db *database.DB, pageID, id string) (PageRevision, error) {
+	ctx, cancel := db.Context(database.Read)
+	defer cancel()
+
+	var rev PageRevision
+	err := db.Pool.QueryRow(ctx, `
+		SELECT id, page_id, title, body, published, created_by, created_at
+		FROM page_revisions
+		WHERE id = $1 AND page_id = $2
+	`, id, pageID).Scan(&rev.ID, &rev.PageID, &rev.Title, &rev.Body, &rev.Published, &rev.CreatedBy, &rev.CreatedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return PageRevision{}, notFound("revision not found")
+	}
+	if err != nil {
+		return PageRevision{}, dbError("finding page revision", err)
+	}
+
+	return rev, nil
+}
+
+// RestorePageRevision puts a revision's title and body back on its page as a new revision,
+// leaving the page's slug and published flag as they are
+func RestorePageRevision(db *database.DB, pageID, id, author string) (Page, error) {
+	rev, err := GetPageRevision(db, pageID, id)
+	if err != nil {
+		return Page{}, err
+	}
+	page, err := GetPageByID(db, pageID)
+	if err != nil {
+		return Page{}, err
+	}
+	page.Title, page.Body = rev.Title, rev.Body
+	return UpdatePage(db, page, author)
+}
@@ -0,0 +1,220 @@
+package models
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/mail"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/ngenohkevin/kuiper_admin/internal/database"
+)
+
+// AdminPreferences holds the UI settings an admin has chosen for themselves
+type AdminPreferences struct {
+	Username         string    `json:"username"`
+	PageSize         int       `json:"page_size"`
+	DefaultSort      string    `json:"default_sort"`
+	SidebarCollapsed bool      `json:"sidebar_collapsed"`
+	Theme            string    `json:"theme"`
+	HideOnboarding   bool      `json:"hide_onboarding"`
+	ProductColumns   []string  `json:"product_columns"`   // Optional product list columns, see ProductColumns
+	ProductListMode  string    `json:"product_list_mode"` // One of the ProductList* constants
+	DigestFrequency  string    `json:"digest_frequency"`  // One of the Digest* constants
+	DigestEmail      string    `json:"digest_email"`      // Where the digest is sent
+	UpdatedAt        time.Time `json:"updated_at"`
+}
+
+// ProductSortOptions maps the sort keys accepted in preferences and query strings to the
+// columns of the products table they order by. Ties are broken by id, so a cursor can pick up
+// after any row.
+var ProductSortOptions = map[string][]SortColumn{
+	"newest":     {{"p.created_at", "timestamptz", true}, {"p.name", "text", false}},
+	"oldest":     {{"p.created_at", "timestamptz", false}, {"p.name", "text", false}},
+	"name_asc":   {{"p.name", "text", false}},
+	"name_desc":  {{"p.name", "text", true}},
+	"price_asc":  {{"p.price", "numeric", false}, {"p.name", "text", false}},
+	"price_desc": {{"p.price", "numeric", true}, {"p.name", "text", false}},
+	"stock_asc":  {{"p.stock_count", "int", false}, {"p.name", "text", false}},
+}
+
+// Ways to move through the product list
+const (
+	ProductListPages  = "pages"  // Numbered pages
+	ProductListScroll = "scroll" // The next page loads at the bottom of the list
+)
+
+// Optional columns of the product list
+const (
+	ProductColumnSKU      = "sku"
+	ProductColumnMargin   = "margin"
+	ProductColumnCategory = "category"
+	ProductColumnVariants = "variants"
+	ProductColumnUpdated  = "updated_at"
+)
+
+// ProductColumns lists the optional product list columns in the order they're shown and
+// exported, with their labels
+var ProductColumns = []struct {
+	Key   string
+	Label string
+}{
+	{ProductColumnSKU, "SKU"},
+	{ProductColumnMargin, "Margin"},
+	{ProductColumnCategory, "Category"},
+	{ProductColumnVariants, "Variant count"},
+	{ProductColumnUpdated, "Updated at"},
+}
+
+// ShowsColumn reports whether the admin has the optional product list column turned on
+func (p AdminPreferences) ShowsColumn(key string) bool {
+	for _, c := range p.ProductColumns {
+		if c == key {
+			return true
+		}
+	}
+	return false
+}
+
+// DefaultPreferences returns the settings used until an admin saves their own
+func DefaultPreferences(username string) AdminPreferences {
+	return AdminPreferences{
+		Username:        username,
+		PageSize:        15,
+		DefaultSort:     "newest",
+		Theme:           "dark",
+		ProductColumns:  []string{ProductColumnCategory, ProductColumnVariants},
+		ProductListMode: ProductListPages,
+		DigestFrequency: DigestOff,
+	}
+}
+
+// Validate checks that the preferences hold values the UI knows how to apply
+func (p AdminPreferences) Validate() error {
+	if p.PageSize < 5 || p.PageSize > 100 {
+		return fmt.Errorf("page size must be between 5 and 100")
+	}
+	if _, ok := ProductSortOptions[p.DefaultSort]; !ok {
+		return fmt.Errorf("unknown sort option %q", p.DefaultSort)
+	}
+	if p.Theme != "dark" && p.Theme != "light" {
+		return fmt.Errorf("unknown theme %q", p.Theme)
+	}
+	if p.ProductListMode != ProductListPages && p.ProductListMode != ProductListScroll {
+		return fmt.Errorf("unknown product list mode %q", p.ProductListMode)
+	}
+	if DigestPeriod(p.DigestFrequency) == 0 && p.DigestFrequency != DigestOff {
+		return fmt.Errorf("unknown digest frequency %q", p.DigestFrequency)
+	}
+	if p.DigestEmail != "" {
+		if addr, err := mail.ParseAddress(p.DigestEmail); err != nil || addr.Address != p.DigestEmail {
+			return fmt.Errorf("digest email %q isn't a valid address", p.DigestEmail)
+		}
+	} else if p.DigestFrequency != DigestOff {
+		return fmt.Errorf("an email address is needed to send the digest to")
+	}
+	for _, key := range p.ProductColumns {
+		known := false
+		for _, c := range ProductColumns {
+			known = known || c.Key == key
+		}
+		if !known {
+			return fmt.Errorf("unknown product column %q", key)
+		}
+	}
+	return nil
+}
+
+// preferencesCacheKey is the cache key for an admin's preferences
+func preferencesCacheKey(username string) string {
+	return "preferences:" + username
+}
+
+// GetAdminPreferences retrieves an admin's preferences, falling back to the defaults
+// when nothing has been saved yet
+func GetAdminPreferences(db *database.DB, username string) (AdminPreferences, error) {
+	// Preferences are read on every page render, so keep them cached
+	if cached, found := db.Cache.Get(preferencesCacheKey(username)); found {
+		if prefs, ok := cached.(AdminPreferences); ok {
+			return prefs, nil
+		}
+	}
+
+	ctx, cancel := db.Context(database.Read)
+	defer cancel()
+
+	query := `
+		SELECT username, page_size, default_sort, sidebar_collapsed, theme, hide_onboarding, product_columns, product_list_mode, digest_frequency, digest_email, updated_at
+		FROM admin_preferences
+		WHERE username = $1
+	`
+
+	var prefs AdminPreferences
+	err := db.Pool.QueryRow(ctx, query, username).Scan(
+		&prefs.Username, &prefs.PageSize, &prefs.DefaultSort, &prefs.SidebarCollapsed, &prefs.Theme, &prefs.HideOnboarding, &prefs.ProductColumns, &prefs.ProductListMode, &prefs.DigestFrequency, &prefs.DigestEmail, &prefs.UpdatedAt,
+	)
+	if errors.Is(err, pgx.ErrNoRows) {
+		prefs = DefaultPreferences(username)
+	} else if err != nil {
+		return DefaultPreferences(username), fmt.Errorf("error getting preferences: %w", err)
+	}
+
+	db.Cache.Set(preferencesCacheKey(username), prefs, 10*time.Minute)
+	return prefs, nil
+}
+
+// SaveAdminPreferences creates or replaces an admin's preferences
+func SaveAdminPreferences(db *database.DB, prefs AdminPreferences) (AdminPreferences, error) {
+	if err := prefs.Validate(); err != nil {
+		return prefs, err
+	}
+	if prefs.ProductColumns == nil {
+		prefs.ProductColumns = []string{}
+	}
+
+	ctx, cancel := db.Context(database.Write)
+	defer cancel()
+
+	query := `
+		INSERT INTO admin_preferences (username, page_size, default_sort, sidebar_collapsed, theme, hide_onboarding, product_columns, product_list_mode, digest_frequency, digest_email)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+		ON CONFLICT (username) DO UPDATE SET
+			page_size = EXCLUDED.page_size,
+			default_sort = EXCLUDED.default_sort,
+			sidebar_collapsed = EXCLUDED.sidebar_collapsed,
+			theme = EXCLUDED.theme,
+			hide_onboarding = EXCLUDED.hide_onboarding,
+			product_columns = EXCLUDED.product_columns,
+			product_list_mode = EXCLUDED.product_list_mode,
+			digest_frequency = EXCLUDED.digest_frequency,
+			digest_email = EXCLUDED.digest_email,
+			updated_at = CURRENT_TIMESTAMP
+		RETURNING updated_at
+	`
+
+	err := db.Pool.QueryRow(ctx, query,
+		prefs.Username, prefs.PageSize, prefs.DefaultSort, prefs.SidebarCollapsed, prefs.Theme, prefs.HideOnboarding, prefs.ProductColumns, prefs.ProductListMode, prefs.DigestFrequency, prefs.DigestEmail,
+	).Scan(&prefs.UpdatedAt)
+	if err != nil {
+		return prefs, fmt.Errorf("error saving preferences: %w", err)
+	}
+
+	db.Cache.Set(preferencesCacheKey(prefs.Username), prefs, 10*time.Minute)
+	return prefs, nil
+}
+
+type preferencesContextKey struct{}
+
+// WithPreferences returns a copy of ctx carrying the current admin's preferences
+func WithPreferences(ctx context.Context, prefs AdminPreferences) context.Context {
+	return context.WithValue(ctx, preferencesContextKey{}, prefs)
+}
+
+// PreferencesFromContext returns the preferences stored in ctx, or the defaults
+func PreferencesFromContext(ctx context.Context) AdminPreferences {
+	if prefs, ok := ctx.Value(preferencesContextKey{}).(AdminPreferences); ok {
+		return prefs
+	}
+	return DefaultPreferences("")
+}
@@ -0,0 +1,114 @@
+package models
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/ngenohkevin/kuiper_admin/internal/database"
+)
+
+// PresenceTimeout is how long after its last heartbeat an admin still counts as being on a page.
+// Open pages send one every 20 seconds.
+const PresenceTimeout = time.Minute
+
+// presenceRetention is how long stale presence rows are kept before a heartbeat clears them out
+const presenceRetention = 10 * time.Minute
+
+// Presence is an admin with the dashboard open, on a product or category or on no record in
+// particular when EntityType is empty
+type Presence struct {
+	Username   string    `json:"username"`
+	EntityType string    `json:"entity_type,omitempty"` // ActivityProduct, ActivityCategory or empty
+	EntityID   string    `json:"entity_id,omitempty"`
+	Name       string    `json:"name,omitempty"` // The record's name
+	Editing    bool      `json:"editing"`
+	SeenAt     time.Time `json:"seen_at"`
+}
+
+// On reports whether the admin is on the given record
+func (p Presence) On(entityType, id string) bool {
+	return p.EntityType != "" && p.EntityType == entityType && p.EntityID == id
+}
+
+// URL links to the record the admin is on, or is empty when they aren't on one
+func (p Presence) URL() string {
+	if p.EntityType == "" {
+		return ""
+	}
+	return RecentItem{EntityType: p.EntityType, ID: p.EntityID}.URL()
+}
+
+// Heartbeat records that an admin is on a page, showing a record or not, and clears out rows
+// that have long gone stale. Records other than products and categories, and malformed IDs,
+// count as no record. The statement sees the table as it was before the upsert, so the row
+// being refreshed is kept out of the clear-out.
+func Heartbeat(db *database.DB, p Presence) error {
+	if p.Username == "" {
+		return nil
+	}
+	if _, err := uuid.Parse(p.EntityID); err != nil || (p.EntityType != ActivityProduct && p.EntityType != ActivityCategory) {
+		p.EntityType, p.EntityID, p.Editing = "", "", false
+	}
+
+	ctx, cancel := db.Context(database.Write)
+	defer cancel()
+
+	_, err := db.Pool.Exec(ctx, `
+		WITH beat AS (
+			INSERT INTO admin_presence (username, entity_type, entity_id, editing)
+			VALUES ($1, $2, $3, $4)
+			ON CONFLICT (username, entity_type, entity_id) DO UPDATE SET editing = EXCLUDED.editing, seen_at = CURRENT_TIMESTAMP
+		)
+		DELETE FROM admin_presence
+		WHERE seen_at < $5 AND NOT (username = $1 AND entity_type = $2 AND entity_id = $3)
+	`, p.Username, p.EntityType, p.EntityID, p.Editing, time.Now().Add(-presenceRetention))
+	if err != nil {
+		return dbError("recording presence", err)
+	}
+	return nil
+}
+
+// GetPresence lists the admins seen within PresenceTimeout, by username, each with the records
+// they're on. Records deleted since are left out.
+func GetPresence(db *database.DB) ([]Presence, error) {
+	ctx, cancel := db.Context(database.List)
+	defer cancel()
+
+	rows, err := db.Pool.Query(ctx, `
+		SELECT a.username, a.entity_type, a.entity_id, COALESCE(p.name, c.name, ''), a.editing, a.seen_at
+		FROM admin_presence a
+		LEFT JOIN products p ON a.entity_type = 'product' AND p.id::text = a.entity_id AND p.deleted_at IS NULL
+		LEFT JOIN categories c ON a.entity_type = 'category' AND c.id::text = a.entity_id AND c.deleted_at IS NULL
+		WHERE a.seen_at >= $1 AND (a.entity_type = '' OR p.id IS NOT NULL OR c.id IS NOT NULL)
+		ORDER BY a.username, a.entity_type = '', a.seen_at DESC
+	`, time.Now().Add(-PresenceTimeout))
+	if err != nil {
+		return nil, dbError("getting presence", err)
+	}
+	defer rows.Close()
+
+	presence := []Presence{}
+	for rows.Next() {
+		var p Presence
+		if err := rows.Scan(&p.Username, &p.EntityType, &p.EntityID, &p.Name, &p.Editing, &p.SeenAt); err != nil {
+			return nil, fmt.Errorf("error scanning presence: %w", err)
+		}
+		presence = append(presence, p)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating presence: %w", err)
+	}
+	return presence, nil
+}
+
+// ClearPresence forgets every page an admin is on, when they sign out
+func ClearPresence(db *database.DB, username string) error {
+	ctx, cancel := db.Context(database.Write)
+	defer cancel()
+
+	if _, err := db.Pool.Exec(ctx, `DELETE FROM admin_presence WHERE username = $1`, username); err != nil {
+		return dbError("clearing presence", err)
+	}
+	return nil
+}
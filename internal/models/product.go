@@ -7,11 +7,14 @@ import (
 	"encoding/json"
 	"fmt"
 	"log"
+	"strings"
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgtype"
 	"github.com/ngenohkevin/kuiper_admin/internal/database"
+	"github.com/ngenohkevin/kuiper_admin/internal/money"
 )
 
 type Product struct {
@@ -20,16 +23,87 @@ type Product struct {
 	Name         string           `json:"name"`
 	Slug         string           `json:"slug"`
 	Description  string           `json:"description"`
-	Price        float64          `json:"price"`
+	Price        money.Amount     `json:"price"`
 	ImageURLs    []string         `json:"image_urls"`
+	Images       []ProductImage   `json:"images"` // ImageURLs with their alt text
 	StockCount   int              `json:"stock_count"`
 	IsAvailable  bool             `json:"is_available"`
 	HasVariants  bool             `json:"has_variants"`
 	CreatedAt    pgtype.Timestamp `json:"created_at"`
 	UpdatedAt    pgtype.Timestamp `json:"updated_at"`
+	ArchivedAt   *time.Time       `json:"archived_at,omitempty"` // Set while the product is archived
 	Category     *Category        `json:"category,omitempty"`
 	Variants     []ProductVariant `json:"variants,omitempty"`
 	VariantsJSON string           `json:"variants_json,omitempty"`
+	Summary      VariantSummary   `json:"variant_summary"`
+	Sale         *Sale            `json:"sale,omitempty"` // Set by ApplyPromotions while a promotion applies
+	SKU          string           `json:"sku"`
+	Cost         *money.Amount    `json:"cost"` // What one unit costs the store, if known
+
+	OrderOptions // Backorder and preorder settings
+
+}
+
+// VariantSummary holds per-product variant aggregates computed in SQL, so list
+// views don't need to load and parse the full variants JSON for every row
+type VariantSummary struct {
+	Count      int          `json:"count"`
+	MinPrice   money.Amount `json:"min_price"`
+	MaxPrice   money.Amount `json:"max_price"`
+	TotalStock int          `json:"total_stock"`
+}
+
+// variantSummaryJoin aggregates the variants array of products aliased as p.
+// Select vs.variant_count, vs.min_price, vs.max_price, vs.total_stock to use it.
+const variantSummaryJoin = `
+		LEFT JOIN LATERAL (
+			SELECT COUNT(v)::int AS variant_count,
+			       COALESCE(MIN((v->>'price')::numeric), 0) AS min_price,
+			       COALESCE(MAX((v->>'price')::numeric), 0) AS max_price,
+			       COALESCE(SUM((v->>'stock_count')::int), 0)::int AS total_stock
+			FROM jsonb_array_elements(
+				CASE WHEN jsonb_typeof(p.variants) = 'array' THEN p.variants ELSE '[]'::jsonb END
+			) AS v
+		) vs ON true`
+
+// ProductImage is one gallery image with the text that describes it to screen readers and
+// search engines. Alt is empty until an admin writes it.
+type ProductImage struct {
+	URL string `json:"url"`
+	Alt string `json:"alt"`
+}
+
+// maxImageAltLength caps the alt text of one image
+const maxImageAltLength = 250
+
+// setImages pairs the product's image URLs with their alt text, stored as a map from URL
+func (p *Product) setImages(alt map[string]string) {
+	p.Images = make([]ProductImage, len(p.ImageURLs))
+	for i, url := range p.ImageURLs {
+		p.Images[i] = ProductImage{URL: url, Alt: alt[url]}
+	}
+}
+
+// ImageAlt is the alt text to show for an image: its own, or the product name without one
+func (p Product) ImageAlt(image ProductImage) string {
+	if image.Alt != "" {
+		return image.Alt
+	}
+	return p.Name
+}
+
+// IsArchived reports whether the product has been archived
+func (p Product) IsArchived() bool {
+	return p.ArchivedAt != nil
+}
+
+// Margin is how much of the price is left after the unit cost, as a percentage. It's false
+// when the cost isn't known or the product is free.
+func (p Product) Margin() (float64, bool) {
+	if p.Cost == nil || p.Price <= 0 {
+		return 0, false
+	}
+	return float64(p.Price-*p.Cost) / float64(p.Price) * 100, true
 }
 
 // StringArray is a custom type for handling string arrays from Postgres
@@ -45,19 +119,36 @@ func (a *StringArray) Scan(value interface{}) error {
 
 // PaginatedResult holds paginated data with metadata
 type PaginatedResult[T any] struct {
-	Data       []T   `json:"data"`
-	TotalCount int64 `json:"total_count"`
-	Page       int   `json:"page"`
-	PageSize   int   `json:"page_size"`
-	TotalPages int   `json:"total_pages"`
-	HasNext    bool  `json:"has_next"`
-	HasPrev    bool  `json:"has_prev"`
+	Data       []T    `json:"data"`
+	TotalCount int64  `json:"total_count"`
+	Page       int    `json:"page"`
+	PageSize   int    `json:"page_size"`
+	TotalPages int    `json:"total_pages"`
+	HasNext    bool   `json:"has_next"`
+	HasPrev    bool   `json:"has_prev"`
+	NextCursor string `json:"next_cursor,omitempty"` // Set on product pages that have a page after them
+}
+
+// SinglePage wraps a list that isn't paginated as its only page, so it can be returned
+// like any other list
+func SinglePage[T any](data []T) PaginatedResult[T] {
+	totalPages := 0
+	if len(data) > 0 {
+		totalPages = 1
+	}
+	return PaginatedResult[T]{
+		Data:       data,
+		TotalCount: int64(len(data)),
+		Page:       1,
+		PageSize:   len(data),
+		TotalPages: totalPages,
+	}
 }
 
 // GetAllProducts retrieves all products from the database (deprecated - use GetProductsPaginated)
 func GetAllProducts(db *database.DB) ([]Product, error) {
 	// Use pagination with a large page size for backward compatibility
-	result, err := GetProductsPaginated(db, 1, 1000, "", "")
+	result, err := GetProductsPaginated(db, 1, 1000, "", "", "", "", false)
 	if err != nil {
 		return nil, err
 	}
@@ -65,15 +156,18 @@ func GetAllProducts(db *database.DB) ([]Product, error) {
 }
 
 // generateCacheKey creates a cache key for the query parameters
-func generateCacheKey(page, pageSize int, categoryID, search string) string {
-	key := fmt.Sprintf("products:page=%d:size=%d:cat=%s:search=%s", page, pageSize, categoryID, search)
+func generateCacheKey(page, pageSize int, categoryID, search, sort, cursor string, includeArchived bool) string {
+	key := fmt.Sprintf("products:page=%d:size=%d:cat=%s:search=%s:sort=%s:cursor=%s:archived=%t", page, pageSize, categoryID, search, sort, cursor, includeArchived)
 	hash := fmt.Sprintf("%x", md5.Sum([]byte(key)))
 	return "products:" + hash
 }
 
-// GetProductsPaginated retrieves products with pagination and optional filtering
-func GetProductsPaginated(db *database.DB, page, pageSize int, categoryID, search string) (*PaginatedResult[Product], error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+// GetProductsPaginated retrieves products with pagination and optional filtering.
+// sort is one of the ProductSortOptions keys; unknown values fall back to newest first.
+// Archived products are left out unless includeArchived is set. With a cursor, the NextCursor
+// of an earlier result, the products after that page are returned instead of page.
+func GetProductsPaginated(db *database.DB, page, pageSize int, categoryID, search, sort, cursor string, includeArchived bool) (*PaginatedResult[Product], error) {
+	ctx, cancel := db.Context(database.List)
 	defer cancel()
 
 	if page < 1 {
@@ -85,9 +179,21 @@ func GetProductsPaginated(db *database.DB, page, pageSize int, categoryID, searc
 	if pageSize > 100 {
 		pageSize = 100 // Maximum page size
 	}
+	sortColumns, ok := ProductSortOptions[sort]
+	if !ok {
+		sort = "newest"
+		sortColumns = ProductSortOptions[sort]
+	}
+	var after productCursor
+	if cursor != "" {
+		var err error
+		if after, err = decodeProductCursor(cursor, sort); err != nil {
+			return nil, err
+		}
+	}
 
 	// Check cache first (cache for 5 minutes for frequently accessed data)
-	cacheKey := generateCacheKey(page, pageSize, categoryID, search)
+	cacheKey := generateCacheKey(page, pageSize, categoryID, search, sort, cursor, includeArchived)
 	if cached, found := db.Cache.Get(cacheKey); found {
 		if result, ok := cached.(*PaginatedResult[Product]); ok {
 			return result, nil
@@ -96,113 +202,100 @@ func GetProductsPaginated(db *database.DB, page, pageSize int, categoryID, searc
 
 	offset := (page - 1) * pageSize
 
-	// Build WHERE conditions
-	var whereConditions []string
-	var args []interface{}
-	argIndex := 1
-
+	// Build WHERE conditions, always leaving out soft-deleted products
+	var q queryBuilder
+	q.where("p.deleted_at IS NULL")
+	if !includeArchived {
+		q.where("p.archived_at IS NULL")
+	}
 	if categoryID != "" {
-		whereConditions = append(whereConditions, fmt.Sprintf("p.category_id = $%d", argIndex))
-		args = append(args, categoryID)
-		argIndex++
+		q.where("p.category_id = ?", categoryID)
 	}
-
 	if search != "" {
-		// Use ILIKE for search (fallback for compatibility)
-		whereConditions = append(whereConditions, fmt.Sprintf("(LOWER(p.name) ILIKE LOWER($%d) OR LOWER(p.description) ILIKE LOWER($%d))", argIndex, argIndex))
-		args = append(args, "%"+search+"%")
-		argIndex++
-	}
-
-	whereClause := ""
-	if len(whereConditions) > 0 {
-		whereClause = "WHERE " + fmt.Sprintf("(%s)", fmt.Sprintf("%s", whereConditions[0]))
-		for i := 1; i < len(whereConditions); i++ {
-			whereClause += fmt.Sprintf(" AND (%s)", whereConditions[i])
+		if err := q.matchProductSearch(db, search); err != nil {
+			return nil, err
 		}
 	}
 
 	// Count total records - simplified without JOIN
-	countQuery := fmt.Sprintf(`
+	countQuery := `
 		SELECT COUNT(*)
 		FROM products p
-		%s
-	`, whereClause)
+		` + q.whereClause()
 
 	var totalCount int64
-	err := db.Pool.QueryRow(ctx, countQuery, args...).Scan(&totalCount)
+	err := db.Pool.QueryRow(ctx, countQuery, q.args...).Scan(&totalCount)
 	if err != nil {
 		return nil, fmt.Errorf("error counting products: %w", err)
 	}
 
-	// Get paginated data - simplified without category JOIN for performance
-	query := fmt.Sprintf(`
+	// A cursor starts the page after the row it names rather than at an offset
+	if cursor != "" {
+		condition, cursorArgs := after.condition(sortColumns)
+		q.where(condition, cursorArgs...)
+		offset = 0
+	}
+
+	// Get paginated data - simplified without category JOIN for performance. One row more than
+	// the page is fetched to tell whether there's a page after it.
+	query := `
 		SELECT p.id, p.category_id, p.name, p.slug, p.description, 
-		       p.price, p.image_urls, p.stock_count, p.is_available, p.has_variants,
-		       p.created_at, p.updated_at, p.variants
+		       p.price, p.image_urls, p.image_alt, p.stock_count, p.is_available, p.has_variants,
+		       p.created_at, p.updated_at, p.archived_at, p.backorder, p.preorder, p.expected_at, p.sku, p.cost,
+		       vs.variant_count, vs.min_price, vs.max_price, vs.total_stock, ` + productSortKey(sortColumns) + `
 		FROM products p
-		%s
-		ORDER BY p.created_at DESC, p.name
-		LIMIT $%d OFFSET $%d
-	`, whereClause, argIndex, argIndex+1)
-
-	args = append(args, pageSize, offset)
+		` + variantSummaryJoin + `
+		` + q.whereClause() + `
+		ORDER BY ` + productOrderBy(sortColumns) + `
+		LIMIT ` + q.arg(pageSize+1) + ` OFFSET ` + q.arg(offset)
 
-	rows, err := db.Pool.Query(ctx, query, args...)
+	rows, err := db.Pool.Query(ctx, query, q.args...)
 	if err != nil {
 		return nil, fmt.Errorf("error querying products: %w", err)
 	}
 	defer rows.Close()
 
 	var products []Product
+	var sortKeys [][]string
 	for rows.Next() {
 		var p Product
-		var variantsJSON []byte
+		var imageAlt map[string]string
+		var sortKey []string
 
 		if err := rows.Scan(
 			&p.ID, &p.CategoryID, &p.Name, &p.Slug, &p.Description,
-			&p.Price, &p.ImageURLs, &p.StockCount, &p.IsAvailable, &p.HasVariants,
-			&p.CreatedAt, &p.UpdatedAt, &variantsJSON,
+			&p.Price, &p.ImageURLs, &imageAlt, &p.StockCount, &p.IsAvailable, &p.HasVariants,
+			&p.CreatedAt, &p.UpdatedAt, &p.ArchivedAt, &p.Backorder, &p.Preorder, &p.ExpectedAt, &p.SKU, &p.Cost,
+			&p.Summary.Count, &p.Summary.MinPrice, &p.Summary.MaxPrice, &p.Summary.TotalStock, &sortKey,
 		); err != nil {
 			return nil, fmt.Errorf("error scanning product row: %w", err)
 		}
-
-		// Load category separately if needed for better performance
-		if p.CategoryID != nil && *p.CategoryID != "" {
-			// We can optionally load category data here if the template requires it
-			// For now, we'll skip it to improve performance
-		}
-
-		// Parse variants from JSONB
-		if variantsJSON != nil && string(variantsJSON) != "[]" && string(variantsJSON) != "null" {
-			p.VariantsJSON = string(variantsJSON)
-			var variants []ProductVariant
-			if err := json.Unmarshal(variantsJSON, &variants); err != nil {
-				log.Printf("Error parsing variants JSON: %v", err)
-			} else {
-				// Set ProductID for each variant
-				for i := range variants {
-					variants[i].ProductID = p.ID
-					// If weight field is populated, use it as the name
-					if variants[i].Weight != "" && variants[i].Name == "" {
-						variants[i].Name = variants[i].Weight
-					}
-				}
-				p.Variants = variants
-			}
-		}
+		p.setImages(imageAlt)
 
 		products = append(products, p)
+		sortKeys = append(sortKeys, sortKey)
 	}
 
 	if err := rows.Err(); err != nil {
 		return nil, fmt.Errorf("error iterating product rows: %w", err)
 	}
 
+	hasNext := len(products) > pageSize
+	var nextCursor string
+	if hasNext {
+		products = products[:pageSize]
+		last := len(products) - 1
+		nextCursor = encodeProductCursor(sort, sortKeys[last], products[last].ID)
+	}
+
+	// Attach categories with one batched lookup instead of joining on every row
+	if err := attachCategories(db, products); err != nil {
+		log.Printf("Error loading categories for products: %v", err)
+	}
+
 	// Calculate pagination metadata
 	totalPages := int((totalCount + int64(pageSize) - 1) / int64(pageSize))
-	hasNext := page < totalPages
-	hasPrev := page > 1
+	hasPrev := page > 1 || cursor != ""
 
 	result := &PaginatedResult[Product]{
 		Data:       products,
@@ -212,6 +305,7 @@ func GetProductsPaginated(db *database.DB, page, pageSize int, categoryID, searc
 		TotalPages: totalPages,
 		HasNext:    hasNext,
 		HasPrev:    hasPrev,
+		NextCursor: nextCursor,
 	}
 
 	// Cache the result for 5 minutes
@@ -222,34 +316,36 @@ func GetProductsPaginated(db *database.DB, page, pageSize int, categoryID, searc
 
 // GetProductByID retrieves a single product by ID
 func GetProductByID(db *database.DB, id string) (Product, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	ctx, cancel := db.Context(database.Read)
 	defer cancel()
 
 	query := `
 		SELECT p.id, p.category_id, p.name, p.slug, p.description, 
-		       p.price, p.image_urls, p.stock_count, p.is_available, p.has_variants,
-		       p.created_at, p.updated_at, p.variants,
-		       c.id, c.name, c.slug, c.parent_id, c.created_at
+		       p.price, p.image_urls, p.image_alt, p.stock_count, p.is_available, p.has_variants,
+		       p.created_at, p.updated_at, p.archived_at, p.backorder, p.preorder, p.expected_at, p.variants,
+		       p.sku, p.cost, c.id, c.name, c.slug, c.parent_id, c.created_at
 		FROM products p
-		LEFT JOIN categories c ON p.category_id = c.id
-		WHERE p.id = $1
+		LEFT JOIN categories c ON p.category_id = c.id AND c.deleted_at IS NULL
+		WHERE p.id = $1 AND p.deleted_at IS NULL
 	`
 
 	var p Product
 	var variantsJSON []byte
+	var imageAlt map[string]string
 	// Use nullable types for category fields to handle LEFT JOIN NULLs
 	var catID, catName, catSlug, catParentID *string
 	var catCreatedAt *time.Time
 
 	err := db.Pool.QueryRow(ctx, query, id).Scan(
 		&p.ID, &p.CategoryID, &p.Name, &p.Slug, &p.Description,
-		&p.Price, &p.ImageURLs, &p.StockCount, &p.IsAvailable, &p.HasVariants,
-		&p.CreatedAt, &p.UpdatedAt, &variantsJSON,
-		&catID, &catName, &catSlug, &catParentID, &catCreatedAt,
+		&p.Price, &p.ImageURLs, &imageAlt, &p.StockCount, &p.IsAvailable, &p.HasVariants,
+		&p.CreatedAt, &p.UpdatedAt, &p.ArchivedAt, &p.Backorder, &p.Preorder, &p.ExpectedAt, &variantsJSON,
+		&p.SKU, &p.Cost, &catID, &catName, &catSlug, &catParentID, &catCreatedAt,
 	)
 	if err != nil {
-		return Product{}, fmt.Errorf("error finding product: %w", err)
+		return Product{}, dbError("finding product", err)
 	}
+	p.setImages(imageAlt)
 
 	// Only create Category if we have valid category data
 	if catID != nil && *catID != "" {
@@ -268,22 +364,28 @@ func GetProductByID(db *database.DB, id string) (Product, error) {
 	}
 
 	// Parse variants from JSONB
+	var variants []ProductVariant
 	if variantsJSON != nil && string(variantsJSON) != "[]" && string(variantsJSON) != "null" {
 		p.VariantsJSON = string(variantsJSON)
-		var variants []ProductVariant
 		if err := json.Unmarshal(variantsJSON, &variants); err != nil {
 			log.Printf("Error parsing variants JSON: %v", err)
-		} else {
-			// Set ProductID for each variant
-			for i := range variants {
-				variants[i].ProductID = p.ID
-				// If weight field is populated, use it as the name
-				if variants[i].Weight != "" && variants[i].Name == "" {
-					variants[i].Name = variants[i].Weight
-				}
+			variants = nil
+		}
+	}
+
+	// The variants table may be read instead, or checked against the JSONB, while it's rolled out
+	variants = readVariants(ctx, db, map[string][]ProductVariant{p.ID: variants})[p.ID]
+	if len(variants) > 0 {
+		// Set ProductID for each variant and list them smallest first
+		SortVariants(variants)
+		for i := range variants {
+			variants[i].ProductID = p.ID
+			// Unnamed variants are named after their quantity
+			if variants[i].Name == "" {
+				variants[i].Name = variants[i].QuantityLabel()
 			}
-			p.Variants = variants
 		}
+		p.Variants = variants
 	}
 
 	return p, nil
@@ -291,9 +393,9 @@ func GetProductByID(db *database.DB, id string) (Product, error) {
 
 // CreateProduct creates a new product in the database
 func CreateProduct(db *database.DB, categoryID *string, name, slug, description string,
-	price float64, imageURLs []string, stockCount int, isAvailable bool, hasVariants bool) (Product, error) {
+	price money.Amount, imageURLs []string, stockCount int, isAvailable bool, hasVariants bool) (Product, error) {
 
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	ctx, cancel := db.Context(database.Write)
 	defer cancel()
 
 	// Generate a UUID for the new product
@@ -304,7 +406,7 @@ func CreateProduct(db *database.DB, categoryID *string, name, slug, description
 	if categoryID != nil {
 		catIDValue = *categoryID
 	}
-	log.Printf("Creating product with id=%s, name=%s, slug=%s, category_id=%s, price=%.2f, stockCount=%d, isAvailable=%v, hasVariants=%v",
+	log.Printf("Creating product with id=%s, name=%s, slug=%s, category_id=%s, price=%s, stockCount=%d, isAvailable=%v, hasVariants=%v",
 		newID, name, slug, catIDValue, price, stockCount, isAvailable, hasVariants)
 	log.Printf("Image URLs: %v", imageURLs)
 
@@ -327,15 +429,17 @@ func CreateProduct(db *database.DB, categoryID *string, name, slug, description
 		return Product{}, fmt.Errorf("error creating product: %w", err)
 	}
 
+	p.setImages(nil)
+	invalidateProductCache(db)
 	log.Printf("Successfully created product with ID: %s", p.ID)
 	return p, nil
 }
 
 // UpdateProduct updates an existing product in the database
 func UpdateProduct(db *database.DB, id string, categoryID *string, name, slug, description string,
-	price float64, imageURLs []string, stockCount int, isAvailable bool, hasVariants bool) (Product, error) {
+	price money.Amount, imageURLs []string, stockCount int, isAvailable bool, hasVariants bool) (Product, error) {
 
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	ctx, cancel := db.Context(database.Write)
 	defer cancel()
 
 	// Get current product to preserve variants if not changing has_variants from true to false
@@ -352,22 +456,27 @@ func UpdateProduct(db *database.DB, id string, categoryID *string, name, slug, d
 	query := `
 		UPDATE products
 		SET category_id = $2, name = $3, slug = $4, description = $5, 
-			price = $6, image_urls = $7, stock_count = $8, is_available = $9, has_variants = $10, updated_at = CURRENT_TIMESTAMP
+			price = $6, image_urls = $7, stock_count = $8, is_available = $9, has_variants = $10, updated_at = CURRENT_TIMESTAMP,
+			image_alt = (SELECT COALESCE(jsonb_object_agg(key, value), '{}'::jsonb) FROM jsonb_each(image_alt) WHERE key = ANY($7::text[]))
 		WHERE id = $1
-		RETURNING id, category_id, name, slug, description, price, image_urls, stock_count, is_available, has_variants, created_at, updated_at, variants
+		RETURNING id, category_id, name, slug, description, price, image_urls, image_alt, stock_count, is_available, has_variants, created_at, updated_at, variants
 	`
 
 	var p Product
 	var variantsJSON []byte
+	var imageAlt map[string]string
 
 	err := db.Pool.QueryRow(ctx, query, id, categoryID, name, slug, description, price, imageURLs, stockCount, isAvailable, hasVariants).Scan(
 		&p.ID, &p.CategoryID, &p.Name, &p.Slug, &p.Description,
-		&p.Price, &p.ImageURLs, &p.StockCount, &p.IsAvailable, &p.HasVariants,
+		&p.Price, &p.ImageURLs, &imageAlt, &p.StockCount, &p.IsAvailable, &p.HasVariants,
 		&p.CreatedAt, &p.UpdatedAt, &variantsJSON,
 	)
 	if err != nil {
-		return Product{}, fmt.Errorf("error updating product: %w", err)
+		return Product{}, dbError("updating product", err)
 	}
+	p.setImages(imageAlt)
+	invalidateProductCache(db)
+	announceProductChanges(db, id)
 
 	// Parse variants from JSONB
 	if variantsJSON != nil && string(variantsJSON) != "[]" && string(variantsJSON) != "null" {
@@ -376,12 +485,13 @@ func UpdateProduct(db *database.DB, id string, categoryID *string, name, slug, d
 		if err := json.Unmarshal(variantsJSON, &variants); err != nil {
 			log.Printf("Error parsing variants JSON: %v", err)
 		} else {
-			// Set ProductID for each variant
+			// Set ProductID for each variant and list them smallest first
+			SortVariants(variants)
 			for i := range variants {
 				variants[i].ProductID = p.ID
-				// If weight field is populated, use it as the name
-				if variants[i].Weight != "" && variants[i].Name == "" {
-					variants[i].Name = variants[i].Weight
+				// Unnamed variants are named after their quantity
+				if variants[i].Name == "" {
+					variants[i].Name = variants[i].QuantityLabel()
 				}
 			}
 			p.Variants = variants
@@ -391,24 +501,209 @@ func UpdateProduct(db *database.DB, id string, categoryID *string, name, slug, d
 	return p, nil
 }
 
-// DeleteProduct deletes a product from the database
-func DeleteProduct(db *database.DB, id string) error {
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+// DeleteProduct soft-deletes a product so it can be restored with RestoreProduct.
+// dependents says what happens to rows that reference it (DependentsCascade or
+// DependentsNullify); anything else refuses the delete while such rows exist.
+func DeleteProduct(db *database.DB, id string, dependents string) error {
+	ctx, cancel := db.Context(database.Write)
 	defer cancel()
 
-	query := `DELETE FROM products WHERE id = $1`
+	tx, err := db.Pool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("error starting transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
 
-	_, err := db.Pool.Exec(ctx, query, id)
+	tag, err := tx.Exec(ctx, `UPDATE products SET deleted_at = CURRENT_TIMESTAMP WHERE id = $1 AND deleted_at IS NULL`, id)
 	if err != nil {
-		return fmt.Errorf("error deleting product: %w", err)
+		return dbError("deleting product", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return nil
 	}
 
+	if err := handleProductDependents(ctx, tx, []string{id}, dependents); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("error committing product delete: %w", err)
+	}
+
+	invalidateProductCache(db)
+	announceProductChanges(db, id)
+	return nil
+}
+
+// RestoreProduct brings back a soft-deleted product along with the rows deleted with it
+func RestoreProduct(db *database.DB, id string) error {
+	ctx, cancel := db.Context(database.Write)
+	defer cancel()
+
+	tx, err := db.Pool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("error starting transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	if err := restoreProductDependents(ctx, tx, id); err != nil {
+		return err
+	}
+
+	tag, err := tx.Exec(ctx, `UPDATE products SET deleted_at = NULL WHERE id = $1 AND deleted_at IS NOT NULL`, id)
+	if err != nil {
+		return dbError("restoring product", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return conflict("product %s is not deleted", id)
+	}
+
+	// A product that was merged away gets its slug back from the redirect
+	_, err = tx.Exec(ctx, `DELETE FROM product_redirects WHERE from_slug = (SELECT slug FROM products WHERE id = $1)`, id)
+	if err != nil {
+		return fmt.Errorf("error removing product redirect: %w", err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("error committing product restore: %w", err)
+	}
+
+	invalidateProductCache(db)
+	announceProductChanges(db, id)
+	return nil
+}
+
+// ArchiveProduct retires a product from listings while keeping it and its history
+func ArchiveProduct(db *database.DB, id string) error {
+	return setProductArchived(db, id, true)
+}
+
+// UnarchiveProduct brings an archived product back into listings
+func UnarchiveProduct(db *database.DB, id string) error {
+	return setProductArchived(db, id, false)
+}
+
+// setProductArchived sets or clears archived_at, failing if the product is already in that state
+func setProductArchived(db *database.DB, id string, archived bool) error {
+	ctx, cancel := db.Context(database.Write)
+	defer cancel()
+
+	query := `
+		UPDATE products
+		SET archived_at = CASE WHEN $2 THEN NOW() END, updated_at = CURRENT_TIMESTAMP
+		WHERE id = $1 AND deleted_at IS NULL AND (archived_at IS NOT NULL) <> $2
+	`
+
+	tag, err := db.Pool.Exec(ctx, query, id, archived)
+	if err != nil {
+		return dbError("updating product archive state", err)
+	}
+	if tag.RowsAffected() == 0 {
+		if archived {
+			return conflict("product %s not found or already archived", id)
+		}
+		return conflict("product %s not found or not archived", id)
+	}
+
+	invalidateProductCache(db)
+	announceProductChanges(db, id)
+	return nil
+}
+
+// AddProductImages appends image URLs to a product's gallery
+func AddProductImages(db *database.DB, id string, imageURLs []string) error {
+	ctx, cancel := db.Context(database.Write)
+	defer cancel()
+
+	tag, err := db.Pool.Exec(ctx, `
+		UPDATE products
+		SET image_urls = COALESCE(image_urls, '{}') || $2::text[], updated_at = CURRENT_TIMESTAMP
+		WHERE id = $1 AND deleted_at IS NULL
+	`, id, imageURLs)
+	if err != nil {
+		return dbError("adding product images", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return notFound("product %s not found", id)
+	}
+
+	invalidateProductCache(db)
+	return nil
+}
+
+// SetProductImageAlt saves the alt text of a product's images, given by image URL. Text for
+// URLs that aren't in the gallery is ignored, and empty text clears an image's description.
+func SetProductImageAlt(db *database.DB, id string, alt map[string]string) error {
+	cleaned := make(map[string]string, len(alt))
+	for url, text := range alt {
+		text = strings.Join(strings.Fields(text), " ")
+		if len([]rune(text)) > maxImageAltLength {
+			return fmt.Errorf("alt text can be at most %d characters", maxImageAltLength)
+		}
+		if text != "" {
+			cleaned[url] = text
+		}
+	}
+	altJSON, err := json.Marshal(cleaned)
+	if err != nil {
+		return fmt.Errorf("error encoding alt text: %w", err)
+	}
+
+	ctx, cancel := db.Context(database.Write)
+	defer cancel()
+
+	tag, err := db.Pool.Exec(ctx, `
+		UPDATE products
+		SET image_alt = (SELECT COALESCE(jsonb_object_agg(key, value), '{}'::jsonb) FROM jsonb_each($2::jsonb) WHERE key = ANY(image_urls)),
+			updated_at = CURRENT_TIMESTAMP
+		WHERE id = $1 AND deleted_at IS NULL
+	`, id, altJSON)
+	if err != nil {
+		return dbError("saving image alt text", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return notFound("product %s not found", id)
+	}
+
+	invalidateProductCache(db)
+	return nil
+}
+
+// invalidateProductCache drops the cached product list pages so changes show up immediately
+func invalidateProductCache(db *database.DB) {
+	db.Cache.DeletePrefix("products:")
+}
+
+// SetProductCosting replaces a product's SKU and unit cost. A nil cost means it isn't known.
+func SetProductCosting(db *database.DB, id, sku string, cost *money.Amount) error {
+	if len(sku) > 100 {
+		return fmt.Errorf("SKU must be 100 characters or fewer")
+	}
+	if cost != nil && *cost < 0 {
+		return fmt.Errorf("cost cannot be negative")
+	}
+
+	ctx, cancel := db.Context(database.Write)
+	defer cancel()
+
+	tag, err := db.Pool.Exec(ctx, `
+		UPDATE products SET sku = $2, cost = $3, updated_at = CURRENT_TIMESTAMP
+		WHERE id = $1 AND deleted_at IS NULL
+	`, id, strings.TrimSpace(sku), cost)
+	if err != nil {
+		return dbError("updating SKU and cost", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return notFound("product %s not found", id)
+	}
+
+	invalidateProductCache(db)
 	return nil
 }
 
 // UpdateProductHasVariants updates the has_variants flag on a product
 func UpdateProductHasVariants(db *database.DB, id string, hasVariants bool) error {
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	ctx, cancel := db.Context(database.Write)
 	defer cancel()
 
 	query := `
@@ -419,8 +714,56 @@ func UpdateProductHasVariants(db *database.DB, id string, hasVariants bool) erro
 
 	_, err := db.Pool.Exec(ctx, query, id, hasVariants)
 	if err != nil {
-		return fmt.Errorf("error updating product has_variants flag: %w", err)
+		return dbError("updating product has_variants flag", err)
 	}
 
 	return nil
 }
+
+// AdjustProductStock atomically changes a product's stock count by delta, never going below zero,
+// records the movement and returns the new stock count
+func AdjustProductStock(db *database.DB, id string, delta int, change StockChange) (int, error) {
+	ctx, cancel := db.Context(database.Write)
+	defer cancel()
+
+	tx, err := db.Pool.Begin(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("error starting transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	stockCount, err := adjustProductStockTx(ctx, tx, id, delta, change)
+	if err != nil {
+		return 0, err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return 0, fmt.Errorf("error committing transaction: %w", err)
+	}
+
+	announceProductChanges(db, id)
+	return stockCount, nil
+}
+
+// adjustProductStockTx is AdjustProductStock within the caller's transaction
+func adjustProductStockTx(ctx context.Context, tx pgx.Tx, id string, delta int, change StockChange) (int, error) {
+	query := `
+		WITH old AS (SELECT stock_count FROM products WHERE id = $1 FOR UPDATE)
+		UPDATE products p
+		SET stock_count = GREATEST(p.stock_count + $2, 0), updated_at = CURRENT_TIMESTAMP
+		FROM old
+		WHERE p.id = $1
+		RETURNING old.stock_count, p.stock_count
+	`
+
+	var previous, stockCount int
+	err := tx.QueryRow(ctx, query, id, delta).Scan(&previous, &stockCount)
+	if err != nil {
+		return 0, fmt.Errorf("error adjusting product stock: %w", err)
+	}
+
+	if err := recordStockMovement(ctx, tx, id, "", stockCount-previous, stockCount, change); err != nil {
+		return 0, err
+	}
+	return stockCount, nil
+}
@@ -0,0 +1,94 @@
+package models
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// SortColumn is one column a product sort orders by, with the type a cursor's text value for it
+// is read back as
+type SortColumn struct {
+	Expr string
+	Type string
+	Desc bool
+}
+
+// productCursor is where a page of products ended: the sort it was taken in and the last row's
+// values of the sort's columns and its id
+type productCursor struct {
+	Sort  string   `json:"s"`
+	After []string `json:"a"`
+	ID    string   `json:"id"`
+}
+
+// encodeProductCursor turns a page's last row into the cursor for the page after it
+func encodeProductCursor(sort string, after []string, id string) string {
+	data, _ := json.Marshal(productCursor{Sort: sort, After: after, ID: id})
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// decodeProductCursor reads a cursor from a product list URL, which must have been taken in sort
+func decodeProductCursor(cursor, sort string) (productCursor, error) {
+	var c productCursor
+	data, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err == nil {
+		err = json.Unmarshal(data, &c)
+	}
+	if err != nil || len(c.After) != len(ProductSortOptions[sort]) || c.ID == "" {
+		return productCursor{}, fmt.Errorf("invalid cursor")
+	}
+	if c.Sort != sort {
+		return productCursor{}, fmt.Errorf("cursor belongs to a different sort; start the list again")
+	}
+	return c, nil
+}
+
+// productOrderBy is the ORDER BY clause for a sort's columns, with id breaking ties
+func productOrderBy(columns []SortColumn) string {
+	parts := make([]string, 0, len(columns)+1)
+	for _, c := range columns {
+		if c.Desc {
+			parts = append(parts, c.Expr+" DESC")
+		} else {
+			parts = append(parts, c.Expr+" ASC")
+		}
+	}
+	return strings.Join(append(parts, "p.id ASC"), ", ")
+}
+
+// productSortKey selects a row's values of a sort's columns as text, to build a cursor from
+func productSortKey(columns []SortColumn) string {
+	parts := make([]string, len(columns))
+	for i, c := range columns {
+		parts[i] = c.Expr + "::text"
+	}
+	return "ARRAY[" + strings.Join(parts, ", ") + "]"
+}
+
+// condition is the WHERE condition for rows after the cursor in the order of columns, with a
+// placeholder for each of its values. Columns can sort in different directions, so it's spelled
+// out column by column rather than as a row comparison.
+func (c productCursor) condition(columns []SortColumn) (string, []interface{}) {
+	columns = append(columns[:len(columns):len(columns)], SortColumn{Expr: "p.id", Type: "uuid"})
+	values := append(append([]string{}, c.After...), c.ID)
+
+	var alternatives []string
+	var args []interface{}
+	for i, column := range columns {
+		var terms []string
+		for j, earlier := range columns[:i] {
+			terms = append(terms, fmt.Sprintf("%s = ?::%s", earlier.Expr, earlier.Type))
+			args = append(args, values[j])
+		}
+		op := ">"
+		if column.Desc {
+			op = "<"
+		}
+		terms = append(terms, fmt.Sprintf("%s %s ?::%s", column.Expr, op, column.Type))
+		args = append(args, values[i])
+		alternatives = append(alternatives, "("+strings.Join(terms, " AND ")+")")
+	}
+	return "(" + strings.Join(alternatives, " OR ") + ")", args
+}
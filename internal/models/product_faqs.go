@@ -0,0 +1,158 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/ngenohkevin/kuiper_admin/internal/database"
+)
+
+// Limits on FAQ text, generous for a storefront Q&A section
+const (
+	maxFAQQuestionLength = 300
+	maxFAQAnswerLength   = 5000
+)
+
+// ProductFAQ is a common customer question about a product and its answer. The storefront
+// shows published ones in sort order.
+type ProductFAQ struct {
+	ID        string    `json:"id"`
+	ProductID string    `json:"product_id"`
+	Question  string    `json:"question"`
+	Answer    string    `json:"answer"`
+	SortOrder int       `json:"sort_order"`
+	Published bool      `json:"published"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// validate trims the question and answer and checks they are there and not too long
+func (f *ProductFAQ) validate() error {
+	f.Question = strings.TrimSpace(f.Question)
+	f.Answer = strings.TrimSpace(f.Answer)
+	switch {
+	case f.Question == "":
+		return fmt.Errorf("question is required")
+	case f.Answer == "":
+		return fmt.Errorf("answer is required")
+	case len([]rune(f.Question)) > maxFAQQuestionLength:
+		return fmt.Errorf("question can be at most %d characters", maxFAQQuestionLength)
+	case len([]rune(f.Answer)) > maxFAQAnswerLength:
+		return fmt.Errorf("answer can be at most %d characters", maxFAQAnswerLength)
+	}
+	return nil
+}
+
+const productFAQColumns = `id, product_id, question, answer, sort_order, published, created_at, updated_at`
+
+// scanProductFAQ reads a row selected with productFAQColumns
+func scanProductFAQ(row pgx.Row) (ProductFAQ, error) {
+	var f ProductFAQ
+	err := row.Scan(&f.ID, &f.ProductID, &f.Question, &f.Answer, &f.SortOrder, &f.Published, &f.CreatedAt, &f.UpdatedAt)
+	return f, err
+}
+
+// GetProductFAQs lists a product's FAQs in sort order, only the published ones when
+// publishedOnly is set
+func GetProductFAQs(db *database.DB, productID string, publishedOnly bool) ([]ProductFAQ, error) {
+	ctx, cancel := db.Context(database.List)
+	defer cancel()
+
+	rows, err := db.Pool.Query(ctx, `
+		SELECT `+productFAQColumns+`
+		FROM product_faqs
+		WHERE product_id = $1 AND (published OR NOT $2)
+		ORDER BY sort_order, created_at
+	`, productID, publishedOnly)
+	if err != nil {
+		return nil, dbError("getting product FAQs", err)
+	}
+	defer rows.Close()
+
+	faqs := []ProductFAQ{}
+	for rows.Next() {
+		f, err := scanProductFAQ(rows)
+		if err != nil {
+			return nil, fmt.Errorf("error scanning product FAQ: %w", err)
+		}
+		faqs = append(faqs, f)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating product FAQs: %w", err)
+	}
+
+	return faqs, nil
+}
+
+// CreateProductFAQ adds a question to a product, after its existing ones
+func CreateProductFAQ(db *database.DB, faq ProductFAQ) (ProductFAQ, error) {
+	if err := faq.validate(); err != nil {
+		return ProductFAQ{}, err
+	}
+
+	ctx, cancel := db.Context(database.Write)
+	defer cancel()
+
+	created, err := scanProductFAQ(db.Pool.QueryRow(ctx, `
+		INSERT INTO product_faqs (product_id, question, answer, published, sort_order)
+		SELECT p.id, $2, $3, $4,
+		       COALESCE((SELECT MAX(sort_order) + 1 FROM product_faqs WHERE product_id = p.id), 0)
+		FROM products p
+		WHERE p.id = $1 AND p.deleted_at IS NULL
+		RETURNING `+productFAQColumns,
+		faq.ProductID, faq.Question, faq.Answer, faq.Published))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return ProductFAQ{}, notFound("product %s not found", faq.ProductID)
+	}
+	if err != nil {
+		return ProductFAQ{}, dbError("creating product FAQ", err)
+	}
+
+	return created, nil
+}
+
+// UpdateProductFAQ saves the question, answer, sort order and published flag of one of a
+// product's FAQs
+func UpdateProductFAQ(db *database.DB, faq ProductFAQ) (ProductFAQ, error) {
+	if err := faq.validate(); err != nil {
+		return ProductFAQ{}, err
+	}
+
+	ctx, cancel := db.Context(database.Write)
+	defer cancel()
+
+	updated, err := scanProductFAQ(db.Pool.QueryRow(ctx, `
+		UPDATE product_faqs
+		SET question = $3, answer = $4, sort_order = $5, published = $6, updated_at = CURRENT_TIMESTAMP
+		WHERE id = $1 AND product_id = $2
+		RETURNING `+productFAQColumns,
+		faq.ID, faq.ProductID, faq.Question, faq.Answer, faq.SortOrder, faq.Published))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return ProductFAQ{}, notFound("FAQ not found")
+	}
+	if err != nil {
+		return ProductFAQ{}, dbError("updating product FAQ", err)
+	}
+
+	return updated, nil
+}
+
+// DeleteProductFAQ removes one of a product's FAQs
+func DeleteProductFAQ(db *database.DB, productID, id string) error {
+	ctx, cancel := db.Context(database.Write)
+	defer cancel()
+
+	tag, err := db.Pool.Exec(ctx, `DELETE FROM product_faqs WHERE id = $1 AND product_id = $2`, id, productID)
+	if err != nil {
+		return dbError("deleting product FAQ", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return notFound("FAQ not found")
+	}
+
+	return nil
+}
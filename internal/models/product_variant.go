@@ -5,26 +5,30 @@ import (
 	"encoding/json"
 	"fmt"
 	"log"
-	"time"
 
 	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
 	"github.com/ngenohkevin/kuiper_admin/internal/database"
+	"github.com/ngenohkevin/kuiper_admin/internal/money"
 )
 
 type ProductVariant struct {
-	ID          string   `json:"id"`
-	ProductID   string   `json:"product_id,omitempty"` // Used for UI display, not in JSONB
-	Name        string   `json:"name,omitempty"`
-	Price       float64  `json:"price"`
-	StockCount  int      `json:"stock_count"`
-	IsAvailable bool     `json:"is_available"`
-	Weight      string   `json:"weight,omitempty"` // New field for weight/quantity
-	Product     *Product `json:"product,omitempty"`
+	ID          string       `json:"id"`
+	ProductID   string       `json:"product_id,omitempty"` // Used for UI display, not in JSONB
+	Name        string       `json:"name,omitempty"`
+	Price       money.Amount `json:"price"`
+	StockCount  int          `json:"stock_count"`
+	IsAvailable bool         `json:"is_available"`
+	Quantity    float64      `json:"quantity,omitempty"` // Size of the variant in Unit, parsed from the name
+	Unit        string       `json:"unit,omitempty"`     // One of the Unit* constants, empty when the name isn't a quantity
+	Product     *Product     `json:"product,omitempty"`
+
+	OrderOptions // Backorder and preorder settings, stored in the variant JSON
 }
 
 // GetAllProductVariants retrieves all product variants from the database
 func GetAllProductVariants(db *database.DB) ([]ProductVariant, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	ctx, cancel := db.Context(database.List)
 	defer cancel()
 
 	// Query all products that have variants
@@ -32,6 +36,7 @@ func GetAllProductVariants(db *database.DB) ([]ProductVariant, error) {
 		SELECT id, variants
 		FROM products
 		WHERE has_variants = true AND variants IS NOT NULL AND variants != '[]'::jsonb
+		  AND deleted_at IS NULL
 		ORDER BY name
 	`
 
@@ -41,7 +46,8 @@ func GetAllProductVariants(db *database.DB) ([]ProductVariant, error) {
 	}
 	defer rows.Close()
 
-	var allVariants []ProductVariant
+	var productIDs []string
+	fromJSON := map[string][]ProductVariant{}
 	for rows.Next() {
 		var productID string
 		var variantsJSON []byte
@@ -57,22 +63,33 @@ func GetAllProductVariants(db *database.DB) ([]ProductVariant, error) {
 				log.Printf("Error parsing variants JSON: %v", err)
 				continue
 			}
-
-			// Add product ID to each variant and append to all variants
-			for i := range variants {
-				variants[i].ProductID = productID
-				// If weight field is populated, use it as the name
-				if variants[i].Weight != "" && variants[i].Name == "" {
-					variants[i].Name = variants[i].Weight
-				}
-				allVariants = append(allVariants, variants[i])
-			}
+			productIDs = append(productIDs, productID)
+			fromJSON[productID] = variants
 		}
 	}
 
 	if err := rows.Err(); err != nil {
 		return nil, fmt.Errorf("error iterating product rows: %w", err)
 	}
+	rows.Close()
+
+	// The variants table may be read instead, or checked against the JSONB, while it's rolled out
+	read := readVariants(ctx, db, fromJSON)
+
+	var allVariants []ProductVariant
+	for _, productID := range productIDs {
+		// Add product ID to each variant and append to all variants, smallest first
+		variants := read[productID]
+		SortVariants(variants)
+		for i := range variants {
+			variants[i].ProductID = productID
+			// Unnamed variants are named after their quantity
+			if variants[i].Name == "" {
+				variants[i].Name = variants[i].QuantityLabel()
+			}
+			allVariants = append(allVariants, variants[i])
+		}
+	}
 
 	return allVariants, nil
 }
@@ -82,7 +99,7 @@ func GetProductVariantsByProductID(db *database.DB, productID string) ([]Product
 	// Use the GetProductByID function to get the product with variants
 	product, err := GetProductByID(db, productID)
 	if err != nil {
-		return nil, fmt.Errorf("error getting product: %w", err)
+		return nil, dbError("getting product", err)
 	}
 
 	// Return the variants from the product
@@ -91,7 +108,7 @@ func GetProductVariantsByProductID(db *database.DB, productID string) ([]Product
 
 // GetProductVariantByID retrieves a single product variant by ID
 func GetProductVariantByID(db *database.DB, id string) (ProductVariant, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	ctx, cancel := db.Context(database.List)
 	defer cancel()
 
 	log.Printf("Looking for variant with ID: %s", id)
@@ -103,6 +120,7 @@ func GetProductVariantByID(db *database.DB, id string) (ProductVariant, error) {
 		FROM products
 		WHERE has_variants = true 
 		  AND variants @> $1
+		  AND deleted_at IS NULL
 	`
 
 	log.Printf("Executing query with jsonPattern: %s", jsonPattern)
@@ -113,7 +131,7 @@ func GetProductVariantByID(db *database.DB, id string) (ProductVariant, error) {
 	err := db.Pool.QueryRow(ctx, rawQuery, jsonPattern).Scan(&productID, &variantsJSON)
 	if err != nil {
 		log.Printf("Error finding product with variant %s: %v", id, err)
-		return ProductVariant{}, fmt.Errorf("error finding product with variant: %w", err)
+		return ProductVariant{}, dbError("finding product with variant", err)
 	}
 
 	log.Printf("Found variant in product %s", productID)
@@ -130,25 +148,25 @@ func GetProductVariantByID(db *database.DB, id string) (ProductVariant, error) {
 		for _, v := range variants {
 			if v.ID == id {
 				v.ProductID = productID
-				// If weight field is populated, use it as the name
-				if v.Weight != "" && v.Name == "" {
-					v.Name = v.Weight
+				// Unnamed variants are named after their quantity
+				if v.Name == "" {
+					v.Name = v.QuantityLabel()
 				}
-				log.Printf("Found variant: %s, name: %s, price: %.2f", v.ID, v.Name, v.Price)
+				log.Printf("Found variant: %s, name: %s, price: %s", v.ID, v.Name, v.Price)
 				return v, nil
 			}
 		}
 	}
 
 	log.Printf("Variant %s not found in product %s", id, productID)
-	return ProductVariant{}, fmt.Errorf("variant not found")
+	return ProductVariant{}, notFound("variant not found")
 }
 
 // CreateProductVariant creates a new product variant in the database
 func CreateProductVariant(db *database.DB, productID, name string,
-	price float64, stockCount int, isAvailable bool) (ProductVariant, error) {
+	price money.Amount, stockCount int, isAvailable bool) (ProductVariant, error) {
 
-	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	ctx, cancel := db.Context(database.Write)
 	defer cancel()
 
 	// Generate a UUID for the new product variant
@@ -158,7 +176,7 @@ func CreateProductVariant(db *database.DB, productID, name string,
 	var variantsJSON []byte
 	err := db.Pool.QueryRow(ctx, "SELECT variants FROM products WHERE id = $1", productID).Scan(&variantsJSON)
 	if err != nil {
-		return ProductVariant{}, fmt.Errorf("error finding product: %w", err)
+		return ProductVariant{}, dbError("finding product", err)
 	}
 
 	// Parse the existing variants
@@ -173,11 +191,11 @@ func CreateProductVariant(db *database.DB, productID, name string,
 	newVariant := ProductVariant{
 		ID:          newID,
 		Name:        name,
-		Weight:      name, // Use name as weight since this is what you mentioned you need
 		Price:       price,
 		StockCount:  stockCount,
 		IsAvailable: isAvailable,
 	}
+	newVariant.SetQuantityFromName()
 
 	// Add the new variant to the array
 	variants = append(variants, newVariant)
@@ -198,8 +216,10 @@ func CreateProductVariant(db *database.DB, productID, name string,
 		string(updatedVariantsJSON), productID)
 	if err != nil {
 		log.Printf("Error updating variants for product %s: %v, JSON: %s", productID, err, string(updatedVariantsJSON))
-		return ProductVariant{}, fmt.Errorf("error updating product variants: %w", err)
+		return ProductVariant{}, dbError("updating product variants", err)
 	}
+	syncCommittedVariantRows(ctx, db, productID)
+	announceProductChanges(db, productID)
 
 	// Set the ProductID for the return value (it's not stored in the JSON)
 	newVariant.ProductID = productID
@@ -209,9 +229,9 @@ func CreateProductVariant(db *database.DB, productID, name string,
 
 // UpdateProductVariant updates an existing product variant in the database
 func UpdateProductVariant(db *database.DB, id, name string,
-	price float64, stockCount int, isAvailable bool) (ProductVariant, error) {
+	price money.Amount, stockCount int, isAvailable bool) (ProductVariant, error) {
 
-	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	ctx, cancel := db.Context(database.Write)
 	defer cancel()
 
 	// Try a different approach for Supabase - using a JSON object for comparison
@@ -221,6 +241,7 @@ func UpdateProductVariant(db *database.DB, id, name string,
 		FROM products
 		WHERE has_variants = true 
 		  AND variants @> $1
+		  AND deleted_at IS NULL
 	`
 
 	log.Printf("Update variant - executing query with jsonPattern: %s", jsonPattern)
@@ -231,7 +252,7 @@ func UpdateProductVariant(db *database.DB, id, name string,
 	err := db.Pool.QueryRow(ctx, rawQuery, jsonPattern).Scan(&productID, &variantsJSON)
 	if err != nil {
 		log.Printf("Error finding product with variant: %v", err)
-		return ProductVariant{}, fmt.Errorf("error finding product with variant: %w", err)
+		return ProductVariant{}, dbError("finding product with variant", err)
 	}
 
 	log.Printf("Update variant - found in product %s", productID)
@@ -248,7 +269,7 @@ func UpdateProductVariant(db *database.DB, id, name string,
 		if v.ID == id {
 			// Update the variant
 			variants[i].Name = name
-			variants[i].Weight = name // Use name as weight
+			variants[i].SetQuantityFromName()
 			variants[i].Price = price
 			variants[i].StockCount = stockCount
 			variants[i].IsAvailable = isAvailable
@@ -261,7 +282,7 @@ func UpdateProductVariant(db *database.DB, id, name string,
 	}
 
 	if updatedVariant.ID == "" {
-		return ProductVariant{}, fmt.Errorf("variant not found")
+		return ProductVariant{}, notFound("variant not found")
 	}
 
 	// Convert the updated variants array back to JSON
@@ -279,15 +300,17 @@ func UpdateProductVariant(db *database.DB, id, name string,
 		string(updatedVariantsJSON), productID)
 	if err != nil {
 		log.Printf("Error updating variant %s: %v, JSON: %s", id, err, string(updatedVariantsJSON))
-		return ProductVariant{}, fmt.Errorf("error updating product variants: %w", err)
+		return ProductVariant{}, dbError("updating product variants", err)
 	}
+	syncCommittedVariantRows(ctx, db, productID)
+	announceProductChanges(db, productID)
 
 	return updatedVariant, nil
 }
 
 // DeleteProductVariant deletes a product variant from the database
 func DeleteProductVariant(db *database.DB, id string) error {
-	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	ctx, cancel := db.Context(database.Write)
 	defer cancel()
 
 	// Try a different approach for Supabase - using a JSON object for comparison
@@ -297,6 +320,7 @@ func DeleteProductVariant(db *database.DB, id string) error {
 		FROM products
 		WHERE has_variants = true 
 		  AND variants @> $1
+		  AND deleted_at IS NULL
 	`
 
 	log.Printf("Delete variant - executing query with jsonPattern: %s", jsonPattern)
@@ -307,7 +331,7 @@ func DeleteProductVariant(db *database.DB, id string) error {
 	err := db.Pool.QueryRow(ctx, rawQuery, jsonPattern).Scan(&productID, &variantsJSON)
 	if err != nil {
 		log.Printf("Error finding product with variant: %v", err)
-		return fmt.Errorf("error finding product with variant: %w", err)
+		return dbError("finding product with variant", err)
 	}
 
 	log.Printf("Delete variant - found in product %s, JSON: %s", productID, string(variantsJSON))
@@ -319,11 +343,14 @@ func DeleteProductVariant(db *database.DB, id string) error {
 		return fmt.Errorf("error parsing variants JSON: %w", err)
 	}
 
-	// Filter out the variant to delete
+	// Filter out the variant to delete, keeping a copy so it can be restored
 	var newVariants []ProductVariant
+	var deletedVariant ProductVariant
 	for _, v := range variants {
 		if v.ID != id {
 			newVariants = append(newVariants, v)
+		} else {
+			deletedVariant = v
 		}
 	}
 
@@ -341,21 +368,111 @@ func DeleteProductVariant(db *database.DB, id string) error {
 	// Update the product with the new variants array
 	// Also update has_variants flag if there are no more variants
 	// Cast to jsonb explicitly to ensure proper type handling
+	deletedVariantJSON, err := json.Marshal(deletedVariant)
+	if err != nil {
+		return fmt.Errorf("error marshaling deleted variant to JSON: %w", err)
+	}
+
+	tx, err := db.Pool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("error starting transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	// Keep the removed variant in deleted_variants so the delete can be undone
+	_, err = tx.Exec(ctx,
+		"INSERT INTO deleted_variants (variant_id, product_id, variant) VALUES ($1, $2, $3::jsonb)",
+		id, productID, string(deletedVariantJSON))
+	if err != nil {
+		return fmt.Errorf("error saving deleted variant: %w", err)
+	}
+
 	hasVariants := len(newVariants) > 0
-	_, err = db.Pool.Exec(ctx,
+	_, err = tx.Exec(ctx,
 		"UPDATE products SET variants = $1::jsonb, has_variants = $2, updated_at = CURRENT_TIMESTAMP WHERE id = $3",
 		string(newVariantsJSON), hasVariants, productID)
 	if err != nil {
 		log.Printf("Error updating product variants after delete: %v, JSON: %s", err, string(newVariantsJSON))
-		return fmt.Errorf("error updating product variants: %w", err)
+		return dbError("updating product variants", err)
+	}
+	if err := syncVariantRows(ctx, tx, productID); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("error committing variant delete: %w", err)
+	}
+
+	announceProductChanges(db, productID)
+	return nil
+}
+
+// RestoreProductVariant puts a deleted variant back on its product
+func RestoreProductVariant(db *database.DB, id string) error {
+	ctx, cancel := db.Context(database.Write)
+	defer cancel()
+
+	tx, err := db.Pool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("error starting transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	var productID string
+	var variantJSON []byte
+	err = tx.QueryRow(ctx,
+		"DELETE FROM deleted_variants WHERE variant_id = $1 RETURNING product_id, variant",
+		id).Scan(&productID, &variantJSON)
+	if err != nil {
+		return dbError("finding deleted variant", err)
+	}
+
+	var variantsJSON []byte
+	err = tx.QueryRow(ctx, "SELECT variants FROM products WHERE id = $1 FOR UPDATE", productID).Scan(&variantsJSON)
+	if err != nil {
+		return dbError("finding product for variant", err)
+	}
+
+	var variants []ProductVariant
+	if variantsJSON != nil && string(variantsJSON) != "null" {
+		if err := json.Unmarshal(variantsJSON, &variants); err != nil {
+			return fmt.Errorf("error parsing variants JSON: %w", err)
+		}
+	}
+
+	var variant ProductVariant
+	if err := json.Unmarshal(variantJSON, &variant); err != nil {
+		return fmt.Errorf("error parsing deleted variant JSON: %w", err)
+	}
+	variants = append(variants, variant)
+
+	updatedVariantsJSON, err := json.Marshal(variants)
+	if err != nil {
+		return fmt.Errorf("error marshaling variants to JSON: %w", err)
 	}
 
+	_, err = tx.Exec(ctx,
+		"UPDATE products SET variants = $1::jsonb, has_variants = true, updated_at = CURRENT_TIMESTAMP WHERE id = $2",
+		string(updatedVariantsJSON), productID)
+	if err != nil {
+		return dbError("updating product variants", err)
+	}
+	if err := syncVariantRows(ctx, tx, productID); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("error committing variant restore: %w", err)
+	}
+
+	log.Printf("Restored variant %s on product %s", id, productID)
+	announceProductChanges(db, productID)
 	return nil
 }
 
 // DeleteProductVariantsByProductID deletes all variants for a product
 func DeleteProductVariantsByProductID(db *database.DB, productID string) error {
-	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	ctx, cancel := db.Context(database.Write)
 	defer cancel()
 
 	// Update the product to have an empty variants array and set has_variants to false
@@ -365,6 +482,8 @@ func DeleteProductVariantsByProductID(db *database.DB, productID string) error {
 	if err != nil {
 		return fmt.Errorf("error clearing product variants: %w", err)
 	}
+	syncCommittedVariantRows(ctx, db, productID)
+	announceProductChanges(db, productID)
 
 	return nil
 }
@@ -372,9 +491,9 @@ func DeleteProductVariantsByProductID(db *database.DB, productID string) error {
 // UpdateProductVariantWithProductID updates an existing product variant in the database including product ID
 // This is more complex as it involves moving the variant from one product to another
 func UpdateProductVariantWithProductID(db *database.DB, id, newProductID, name string,
-	price float64, stockCount int, isAvailable bool) (ProductVariant, error) {
+	price money.Amount, stockCount int, isAvailable bool) (ProductVariant, error) {
 
-	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	ctx, cancel := db.Context(database.Write)
 	defer cancel()
 
 	// First, find the current product that contains this variant
@@ -384,6 +503,7 @@ func UpdateProductVariantWithProductID(db *database.DB, id, newProductID, name s
 		FROM products
 		WHERE has_variants = true 
 		  AND variants @> $1
+		  AND deleted_at IS NULL
 	`
 
 	log.Printf("UpdateProductVariantWithProductID - executing query with jsonPattern: %s", jsonPattern)
@@ -393,7 +513,7 @@ func UpdateProductVariantWithProductID(db *database.DB, id, newProductID, name s
 
 	err := db.Pool.QueryRow(ctx, findQuery, jsonPattern).Scan(&currentProductID, &currentVariantsJSON)
 	if err != nil {
-		return ProductVariant{}, fmt.Errorf("error finding product with variant: %w", err)
+		return ProductVariant{}, dbError("finding product with variant", err)
 	}
 
 	// Parse the current variants
@@ -411,7 +531,7 @@ func UpdateProductVariantWithProductID(db *database.DB, id, newProductID, name s
 			variantToMove = v
 			// Update the variant data
 			variantToMove.Name = name
-			variantToMove.Weight = name // Use name as weight
+			variantToMove.SetQuantityFromName()
 			variantToMove.Price = price
 			variantToMove.StockCount = stockCount
 			variantToMove.IsAvailable = isAvailable
@@ -421,7 +541,7 @@ func UpdateProductVariantWithProductID(db *database.DB, id, newProductID, name s
 	}
 
 	if variantToMove.ID == "" {
-		return ProductVariant{}, fmt.Errorf("variant not found")
+		return ProductVariant{}, notFound("variant not found")
 	}
 
 	// Begin a transaction
@@ -447,14 +567,14 @@ func UpdateProductVariantWithProductID(db *database.DB, id, newProductID, name s
 		"UPDATE products SET variants = $1::jsonb, has_variants = $2, updated_at = CURRENT_TIMESTAMP WHERE id = $3",
 		string(currentVariantsJSON), hasVariants, currentProductID)
 	if err != nil {
-		return ProductVariant{}, fmt.Errorf("error updating current product variants: %w", err)
+		return ProductVariant{}, dbError("updating current product variants", err)
 	}
 
 	// Step 2: Get the new product's variants
 	var newVariantsJSON []byte
 	err = tx.QueryRow(ctx, "SELECT variants FROM products WHERE id = $1", newProductID).Scan(&newVariantsJSON)
 	if err != nil {
-		return ProductVariant{}, fmt.Errorf("error finding new product: %w", err)
+		return ProductVariant{}, dbError("finding new product", err)
 	}
 
 	// Parse the new product's variants
@@ -477,7 +597,10 @@ func UpdateProductVariantWithProductID(db *database.DB, id, newProductID, name s
 		"UPDATE products SET variants = $1::jsonb, has_variants = true, updated_at = CURRENT_TIMESTAMP WHERE id = $2",
 		string(updatedNewVariantsJSON), newProductID)
 	if err != nil {
-		return ProductVariant{}, fmt.Errorf("error updating new product variants: %w", err)
+		return ProductVariant{}, dbError("updating new product variants", err)
+	}
+	if err = syncVariantRows(ctx, tx, currentProductID, newProductID); err != nil {
+		return ProductVariant{}, err
 	}
 
 	// Commit the transaction
@@ -485,8 +608,95 @@ func UpdateProductVariantWithProductID(db *database.DB, id, newProductID, name s
 		return ProductVariant{}, fmt.Errorf("error committing transaction: %w", err)
 	}
 
+	announceProductChanges(db, currentProductID, newProductID)
+
 	// Set the ProductID for the return value
 	variantToMove.ProductID = newProductID
 
 	return variantToMove, nil
 }
+
+// AdjustProductVariantStock changes a variant's stock count by delta, never going below zero,
+// records the movement and returns the new stock count. The product row is locked while the variants
+// JSON is rewritten so concurrent adjustments from several devices don't overwrite each other.
+// Selling out or restocking may also flip the variant's availability; see applyAutoAvailability.
+func AdjustProductVariantStock(db *database.DB, productID, variantID string, delta int, change StockChange) (int, error) {
+	ctx, cancel := db.Context(database.Write)
+	defer cancel()
+
+	tx, err := db.Pool.Begin(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("error starting transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	stockCount, err := adjustVariantStockTx(ctx, tx, productID, variantID, delta, change)
+	if err != nil {
+		return 0, err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return 0, fmt.Errorf("error committing transaction: %w", err)
+	}
+
+	announceProductChanges(db, productID)
+	return stockCount, nil
+}
+
+// adjustVariantStockTx is AdjustProductVariantStock within the caller's transaction
+func adjustVariantStockTx(ctx context.Context, tx pgx.Tx, productID, variantID string, delta int, change StockChange) (int, error) {
+	var variantsJSON []byte
+	var autoAvailability string
+	err := tx.QueryRow(ctx, "SELECT variants, auto_availability FROM products WHERE id = $1 FOR UPDATE", productID).Scan(&variantsJSON, &autoAvailability)
+	if err != nil {
+		return 0, dbError("finding product", err)
+	}
+
+	var variants []ProductVariant
+	if variantsJSON != nil && string(variantsJSON) != "null" {
+		if err := json.Unmarshal(variantsJSON, &variants); err != nil {
+			return 0, fmt.Errorf("error parsing variants JSON: %w", err)
+		}
+	}
+
+	stockCount, previous := -1, 0
+	for i := range variants {
+		if variants[i].ID == variantID {
+			previous = variants[i].StockCount
+			variants[i].StockCount += delta
+			if variants[i].StockCount < 0 {
+				variants[i].StockCount = 0
+			}
+			stockCount = variants[i].StockCount
+			if err := applyAutoAvailability(ctx, tx, productID, &variants[i], previous, autoAvailability, change.Actor); err != nil {
+				return 0, err
+			}
+			break
+		}
+	}
+
+	if stockCount < 0 {
+		return 0, notFound("variant not found")
+	}
+
+	updatedVariantsJSON, err := json.Marshal(variants)
+	if err != nil {
+		return 0, fmt.Errorf("error marshaling variants to JSON: %w", err)
+	}
+
+	_, err = tx.Exec(ctx,
+		"UPDATE products SET variants = $1::jsonb, updated_at = CURRENT_TIMESTAMP WHERE id = $2",
+		string(updatedVariantsJSON), productID)
+	if err != nil {
+		return 0, dbError("updating product variants", err)
+	}
+
+	if err := recordStockMovement(ctx, tx, productID, variantID, stockCount-previous, stockCount, change); err != nil {
+		return 0, err
+	}
+	if err := syncVariantRows(ctx, tx, productID); err != nil {
+		return 0, err
+	}
+
+	return stockCount, nil
+}
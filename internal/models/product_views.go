@@ -0,0 +1,191 @@
+package models
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/ngenohkevin/kuiper_admin/internal/database"
+)
+
+// MaxProductViewBatch is the most views the storefront may report in one request
+const MaxProductViewBatch = 500
+
+// maxProductViewAge is how old a reported view may be. Older ones are dropped rather than added
+// to days the reports may already have been read for.
+const maxProductViewAge = 48 * time.Hour
+
+// ProductViewWindow is how long a storefront session's views of a product count as one, so
+// reloading a page or coming back to it doesn't inflate its views. Override with
+// PRODUCT_VIEW_WINDOW_MINUTES.
+func ProductViewWindow() time.Duration {
+	if s := os.Getenv("PRODUCT_VIEW_WINDOW_MINUTES"); s != "" {
+		if minutes, err := strconv.Atoi(s); err == nil && minutes > 0 {
+			return time.Duration(minutes) * time.Minute
+		}
+	}
+	return 30 * time.Minute
+}
+
+// ProductView is a storefront session looking at a product's page
+type ProductView struct {
+	ProductID    string    `json:"product_id"`
+	SessionToken string    `json:"session_token"`
+	ViewedAt     time.Time `json:"viewed_at"` // Zero for now
+}
+
+// RecordProductViews adds a batch of views from the storefront to the daily counts and returns
+// how many counted. A view doesn't count when its session already viewed the product within
+// window, when it's more than two days old or in the future, or when the product doesn't exist.
+func RecordProductViews(db *database.DB, views []ProductView, window time.Duration) (int, error) {
+	if len(views) > MaxProductViewBatch {
+		return 0, fmt.Errorf("at most %d views can be sent at once", MaxProductViewBatch)
+	}
+
+	now := time.Now().UTC()
+	var productIDs, sessions []string
+	var viewedAt []time.Time
+	for _, v := range views {
+		at := v.ViewedAt
+		if at.IsZero() {
+			at = now
+		}
+		if _, err := uuid.Parse(v.ProductID); err != nil || v.SessionToken == "" || len(v.SessionToken) > 128 ||
+			at.Before(now.Add(-maxProductViewAge)) || at.After(now.Add(time.Minute)) {
+			continue
+		}
+		productIDs = append(productIDs, v.ProductID)
+		sessions = append(sessions, v.SessionToken)
+		viewedAt = append(viewedAt, at.UTC())
+	}
+	if len(productIDs) == 0 {
+		return 0, nil
+	}
+
+	ctx, cancel := db.Context(database.Write)
+	defer cancel()
+
+	// A session's views of a product within the batch collapse into its first, which counts
+	// only if the session's last counted view is at least a window older
+	var counted int
+	err := db.Pool.QueryRow(ctx, `
+		WITH batch AS (
+		    SELECT DISTINCT ON (v.product_id, v.session_token) v.product_id, v.session_token, v.viewed_at
+		    FROM unnest($1::uuid[], $2::text[], $3::timestamptz[]) AS v(product_id, session_token, viewed_at)
+		    JOIN products p ON p.id = v.product_id
+		    ORDER BY v.product_id, v.session_token, v.viewed_at
+		),
+		counted AS (
+		    INSERT INTO product_view_sessions (product_id, session_token, counted_at)
+		    SELECT product_id, session_token, viewed_at FROM batch
+		    ON CONFLICT (product_id, session_token) DO UPDATE SET counted_at = EXCLUDED.counted_at
+		    WHERE product_view_sessions.counted_at <= EXCLUDED.counted_at - $4::interval
+		    RETURNING product_id, counted_at
+		),
+		daily AS (
+		    INSERT INTO product_views_daily (product_id, day, views)
+		    SELECT product_id, (counted_at AT TIME ZONE 'UTC')::date, COUNT(*)
+		    FROM counted
+		    GROUP BY 1, 2
+		    ON CONFLICT (product_id, day) DO UPDATE SET views = product_views_daily.views + EXCLUDED.views
+		    RETURNING views
+		)
+		SELECT COUNT(*) FROM counted
+	`, productIDs, sessions, viewedAt, fmt.Sprintf("%d seconds", int(window.Seconds()))).Scan(&counted)
+	if err != nil {
+		return 0, dbError("recording product views", err)
+	}
+	return counted, nil
+}
+
+// PurgeProductViewSessions forgets the sessions whose last counted view of a product is too old
+// for any view still accepted to fall within window of it, and returns how many it forgot
+func PurgeProductViewSessions(db *database.DB, window time.Duration) (int64, error) {
+	ctx, cancel := db.Context(database.Bulk)
+	defer cancel()
+
+	before := time.Now().Add(-maxProductViewAge - window)
+	tag, err := db.Pool.Exec(ctx, `DELETE FROM product_view_sessions WHERE counted_at < $1`, before)
+	if err != nil {
+		return 0, dbError("purging product view sessions", err)
+	}
+	return tag.RowsAffected(), nil
+}
+
+// ProductViewDay is a product's counted views on one UTC day
+type ProductViewDay struct {
+	Day   time.Time `json:"day"`
+	Views int       `json:"views"`
+}
+
+// ProductViewTrend is a product's daily views over the last few days, with the total for the
+// same number of days before them to compare against
+type ProductViewTrend struct {
+	Days     []ProductViewDay `json:"days"` // Oldest first, ending today, days without views included
+	Total    int              `json:"total"`
+	Previous int              `json:"previous"`
+}
+
+// Change is the percentage change in views from the previous period, and false when there were
+// none before to compare against
+func (t ProductViewTrend) Change() (float64, bool) {
+	if t.Previous == 0 {
+		return 0, false
+	}
+	return float64(t.Total-t.Previous) / float64(t.Previous) * 100, true
+}
+
+// Peak is the most views on any one day, which the chart scales to
+func (t ProductViewTrend) Peak() int {
+	peak := 0
+	for _, d := range t.Days {
+		peak = max(peak, d.Views)
+	}
+	return peak
+}
+
+// GetProductViewTrend gets a product's views for each of the last days days, today included
+func GetProductViewTrend(db *database.DB, productID string, days int) (ProductViewTrend, error) {
+	if days <= 0 {
+		return ProductViewTrend{}, fmt.Errorf("days must be a positive number")
+	}
+
+	today := time.Now().UTC().Truncate(24 * time.Hour)
+	start := today.AddDate(0, 0, -(days - 1))
+	trend := ProductViewTrend{Days: make([]ProductViewDay, days)}
+	for i := range trend.Days {
+		trend.Days[i].Day = start.AddDate(0, 0, i)
+	}
+
+	ctx, cancel := db.Context(database.Read)
+	defer cancel()
+
+	rows, err := db.Pool.Query(ctx, `
+		SELECT day, views
+		FROM product_views_daily
+		WHERE product_id = $1 AND day >= $2::date AND day <= $3::date
+	`, productID, start.AddDate(0, 0, -days).Format(time.DateOnly), today.Format(time.DateOnly))
+	if err != nil {
+		return trend, dbError("getting product views", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var d ProductViewDay
+		if err := rows.Scan(&d.Day, &d.Views); err != nil {
+			return trend, fmt.Errorf("error scanning product views: %w", err)
+		}
+		if i := int(d.Day.Sub(start).Hours() / 24); i >= 0 && i < days {
+			trend.Days[i].Views = d.Views
+			trend.Total += d.Views
+		} else {
+			trend.Previous += d.Views
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return trend, fmt.Errorf("error iterating product views: %w", err)
+	}
+	return trend, nil
+}
@@ -0,0 +1,105 @@
+package models
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/ngenohkevin/kuiper_admin/internal/database"
+	"github.com/ngenohkevin/kuiper_admin/internal/money"
+)
+
+// ProfitabilityRow is what one product sold over a period, from the lines of storefront orders,
+// and its contribution margin: what it left over after what those units cost the store. Units
+// of unknown cost count as free in the margin.
+type ProfitabilityRow struct {
+	ProductID     string       `json:"product_id"`
+	ProductName   string       `json:"product_name"`
+	SKU           string       `json:"sku"`
+	Orders        int          `json:"orders"`
+	Units         int          `json:"units"`
+	Revenue       money.Amount `json:"revenue"`
+	Cost          money.Amount `json:"cost"`           // Of the units whose cost is known
+	Margin        money.Amount `json:"margin"`         // Revenue less cost, too high unless Complete
+	UncostedUnits int          `json:"uncosted_units"` // Units sold while the product had no cost
+	Deleted       bool         `json:"deleted"`        // In the trash or purged since
+}
+
+// Complete reports whether the cost of every unit sold is known, so the margin is the whole
+// story
+func (r ProfitabilityRow) Complete() bool {
+	return r.UncostedUnits == 0
+}
+
+// MarginPercent is the margin as a percentage of revenue, false without revenue
+func (r ProfitabilityRow) MarginPercent() (float64, bool) {
+	if r.Revenue <= 0 {
+		return 0, false
+	}
+	return float64(r.Margin) / float64(r.Revenue) * 100, true
+}
+
+// Profitability is the profitability report for the orders placed from From up to To
+type Profitability struct {
+	From          time.Time          `json:"from"`
+	To            time.Time          `json:"to"`
+	Rows          []ProfitabilityRow `json:"rows"`
+	Revenue       money.Amount       `json:"revenue"`
+	Cost          money.Amount       `json:"cost"`
+	Margin        money.Amount       `json:"margin"`
+	UncostedUnits int                `json:"uncosted_units"`
+}
+
+// GetProfitability ranks the products sold in orders placed from from up to to by contribution
+// margin, highest first. Products with units of unknown cost come after those fully costed, by
+// revenue, since their margin can't be compared. A categoryID narrows it to the products now
+// in that category.
+func GetProfitability(db *database.DB, from, to time.Time, categoryID string) (Profitability, error) {
+	ctx, cancel := db.Context(database.List)
+	defer cancel()
+
+	report := Profitability{From: from, To: to, Rows: []ProfitabilityRow{}}
+	rows, err := db.Pool.Query(ctx, `
+		SELECT i.product_id::text,
+		       COALESCE(p.name, MAX(i.product_name), ''),
+		       COALESCE(p.sku, ''),
+		       COUNT(DISTINCT i.order_id),
+		       SUM(i.quantity),
+		       SUM(i.quantity * i.unit_price),
+		       COALESCE(SUM(i.quantity * i.unit_cost), 0),
+		       COALESCE(SUM(i.quantity) FILTER (WHERE i.unit_cost IS NULL), 0),
+		       p.id IS NULL OR p.deleted_at IS NOT NULL
+		FROM storefront_order_items i
+		JOIN storefront_orders o ON o.id = i.order_id
+		LEFT JOIN products p ON p.id = i.product_id
+		WHERE o.placed_at >= $1 AND o.placed_at < $2
+		  AND ($3 = '' OR p.category_id::text = $3)
+		GROUP BY i.product_id, p.id, p.name, p.sku, p.deleted_at
+		ORDER BY COUNT(*) FILTER (WHERE i.unit_cost IS NULL) > 0,
+		         CASE WHEN COUNT(*) FILTER (WHERE i.unit_cost IS NULL) = 0
+		              THEN SUM(i.quantity * i.unit_price) - COALESCE(SUM(i.quantity * i.unit_cost), 0)
+		              ELSE SUM(i.quantity * i.unit_price) END DESC,
+		         2
+	`, from, to, categoryID)
+	if err != nil {
+		return report, dbError("getting profitability", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var row ProfitabilityRow
+		if err := rows.Scan(&row.ProductID, &row.ProductName, &row.SKU, &row.Orders, &row.Units,
+			&row.Revenue, &row.Cost, &row.UncostedUnits, &row.Deleted); err != nil {
+			return report, fmt.Errorf("error scanning profitability: %w", err)
+		}
+		row.Margin = row.Revenue - row.Cost
+		report.Rows = append(report.Rows, row)
+		report.Revenue += row.Revenue
+		report.Cost += row.Cost
+		report.UncostedUnits += row.UncostedUnits
+	}
+	if err := rows.Err(); err != nil {
+		return report, fmt.Errorf("error iterating profitability: %w", err)
+	}
+	report.Margin = report.Revenue - report.Cost
+	return report, nil
+}
@@ -0,0 +1,281 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/ngenohkevin/kuiper_admin/internal/database"
+	"github.com/ngenohkevin/kuiper_admin/internal/money"
+)
+
+// Promotion statuses, worked out from the enabled flag and the window
+const (
+	PromotionActive    = "active"
+	PromotionScheduled = "scheduled"
+	PromotionEnded     = "ended"
+	PromotionDisabled  = "disabled"
+)
+
+// maxPromotionNameLength matches the name column
+const maxPromotionNameLength = 100
+
+// Promotion takes a percentage off one product, or every product in a category and its
+// subcategories, from StartsAt until EndsAt. Exactly one of ProductID and CategoryID is set.
+type Promotion struct {
+	ID              string    `json:"id"`
+	Name            string    `json:"name"`
+	DiscountPercent float64   `json:"discount_percent"`
+	ProductID       *string   `json:"product_id"`
+	CategoryID      *string   `json:"category_id"`
+	StartsAt        time.Time `json:"starts_at"`
+	EndsAt          time.Time `json:"ends_at"`
+	Enabled         bool      `json:"enabled"`
+	CreatedAt       time.Time `json:"created_at"`
+	UpdatedAt       time.Time `json:"updated_at"`
+	ScopeName       string    `json:"scope_name"` // The product's or category's name
+}
+
+// Sale is the promotion a product's price is discounted by right now
+type Sale struct {
+	PromotionID     string       `json:"promotion_id"`
+	Name            string       `json:"name"`
+	DiscountPercent float64      `json:"discount_percent"`
+	Price           money.Amount `json:"price"` // The discounted price
+	EndsAt          time.Time    `json:"ends_at"`
+}
+
+// Status says whether the promotion applies at now, is waiting for its window, is past it or is
+// switched off
+func (p Promotion) Status(now time.Time) string {
+	switch {
+	case !p.Enabled:
+		return PromotionDisabled
+	case now.Before(p.StartsAt):
+		return PromotionScheduled
+	case !now.Before(p.EndsAt):
+		return PromotionEnded
+	}
+	return PromotionActive
+}
+
+// validate tidies the promotion's fields and checks them
+func (p *Promotion) validate() error {
+	p.Name = strings.TrimSpace(p.Name)
+	if p.Name == "" {
+		return fmt.Errorf("name is required")
+	}
+	if len([]rune(p.Name)) > maxPromotionNameLength {
+		return fmt.Errorf("name can be at most %d characters", maxPromotionNameLength)
+	}
+	if p.DiscountPercent <= 0 || p.DiscountPercent >= 100 {
+		return fmt.Errorf("discount must be more than 0%% and less than 100%%")
+	}
+	if p.ProductID != nil && *p.ProductID == "" {
+		p.ProductID = nil
+	}
+	if p.CategoryID != nil && *p.CategoryID == "" {
+		p.CategoryID = nil
+	}
+	if (p.ProductID == nil) == (p.CategoryID == nil) {
+		return fmt.Errorf("choose a product or a category for the promotion")
+	}
+	if p.StartsAt.IsZero() || p.EndsAt.IsZero() {
+		return fmt.Errorf("the promotion needs a start and an end")
+	}
+	if !p.EndsAt.After(p.StartsAt) {
+		return fmt.Errorf("the promotion must end after it starts")
+	}
+	return nil
+}
+
+const promotionColumns = `pr.id, pr.name, pr.discount_percent, pr.product_id, pr.category_id, pr.starts_at, pr.ends_at,
+		pr.enabled, pr.created_at, pr.updated_at, COALESCE(p.name, c.name, '')`
+
+// promotionFrom joins the names promotionColumns reads
+const promotionFrom = `
+		FROM promotions pr
+		LEFT JOIN products p ON p.id = pr.product_id
+		LEFT JOIN categories c ON c.id = pr.category_id`
+
+// scanPromotion reads a row selected with promotionColumns
+func scanPromotion(row pgx.Row) (Promotion, error) {
+	var p Promotion
+	err := row.Scan(
+		&p.ID, &p.Name, &p.DiscountPercent, &p.ProductID, &p.CategoryID, &p.StartsAt, &p.EndsAt,
+		&p.Enabled, &p.CreatedAt, &p.UpdatedAt, &p.ScopeName,
+	)
+	return p, err
+}
+
+// GetPromotions lists every promotion, latest window first
+func GetPromotions(db *database.DB) ([]Promotion, error) {
+	return queryPromotions(db, `ORDER BY pr.starts_at DESC, pr.created_at DESC`)
+}
+
+// GetActivePromotions lists the enabled promotions whose window includes now
+func GetActivePromotions(db *database.DB, now time.Time) ([]Promotion, error) {
+	return queryPromotions(db, `
+		WHERE pr.enabled AND pr.starts_at <= $1 AND pr.ends_at > $1
+		ORDER BY pr.discount_percent DESC, pr.starts_at
+	`, now)
+}
+
+// queryPromotions selects promotions with the given WHERE and ORDER BY clauses
+func queryPromotions(db *database.DB, clauses string, args ...interface{}) ([]Promotion, error) {
+	ctx, cancel := db.Context(database.List)
+	defer cancel()
+
+	rows, err := db.Pool.Query(ctx, `SELECT `+promotionColumns+promotionFrom+` `+clauses, args...)
+	if err != nil {
+		return nil, dbError("getting promotions", err)
+	}
+	defer rows.Close()
+
+	promotions := []Promotion{}
+	for rows.Next() {
+		p, err := scanPromotion(rows)
+		if err != nil {
+			return nil, fmt.Errorf("error scanning promotion: %w", err)
+		}
+		promotions = append(promotions, p)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating promotions: %w", err)
+	}
+
+	return promotions, nil
+}
+
+// GetPromotionByID retrieves a single promotion
+func GetPromotionByID(db *database.DB, id string) (Promotion, error) {
+	ctx, cancel := db.Context(database.Read)
+	defer cancel()
+
+	p, err := scanPromotion(db.Pool.QueryRow(ctx, `SELECT `+promotionColumns+promotionFrom+` WHERE pr.id = $1`, id))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return Promotion{}, notFound("promotion not found")
+	}
+	if err != nil {
+		return Promotion{}, dbError("finding promotion", err)
+	}
+
+	return p, nil
+}
+
+// CreatePromotion saves a new promotion
+func CreatePromotion(db *database.DB, p Promotion) (Promotion, error) {
+	if err := p.validate(); err != nil {
+		return Promotion{}, err
+	}
+
+	ctx, cancel := db.Context(database.Write)
+	defer cancel()
+
+	var id string
+	err := db.Pool.QueryRow(ctx, `
+		INSERT INTO promotions (name, discount_percent, product_id, category_id, starts_at, ends_at, enabled)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		RETURNING id
+	`, p.Name, p.DiscountPercent, p.ProductID, p.CategoryID, p.StartsAt, p.EndsAt, p.Enabled).Scan(&id)
+	if err != nil {
+		return Promotion{}, dbError("creating promotion", err)
+	}
+
+	return GetPromotionByID(db, id)
+}
+
+// UpdatePromotion saves changes to a promotion
+func UpdatePromotion(db *database.DB, p Promotion) (Promotion, error) {
+	if err := p.validate(); err != nil {
+		return Promotion{}, err
+	}
+
+	ctx, cancel := db.Context(database.Write)
+	defer cancel()
+
+	tag, err := db.Pool.Exec(ctx, `
+		UPDATE promotions
+		SET name = $2, discount_percent = $3, product_id = $4, category_id = $5,
+		    starts_at = $6, ends_at = $7, enabled = $8, updated_at = CURRENT_TIMESTAMP
+		WHERE id = $1
+	`, p.ID, p.Name, p.DiscountPercent, p.ProductID, p.CategoryID, p.StartsAt, p.EndsAt, p.Enabled)
+	if err != nil {
+		return Promotion{}, dbError("updating promotion", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return Promotion{}, notFound("promotion not found")
+	}
+
+	return GetPromotionByID(db, p.ID)
+}
+
+// DeletePromotion removes a promotion
+func DeletePromotion(db *database.DB, id string) error {
+	ctx, cancel := db.Context(database.Write)
+	defer cancel()
+
+	tag, err := db.Pool.Exec(ctx, `DELETE FROM promotions WHERE id = $1`, id)
+	if err != nil {
+		return dbError("deleting promotion", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return notFound("promotion not found")
+	}
+
+	return nil
+}
+
+// ApplyPromotions sets the Sale of each product a promotion applies to at now, leaving the
+// others without one. The products are changed in place, so callers holding a cached slice
+// pass a copy.
+func ApplyPromotions(db *database.DB, products []Product, now time.Time) error {
+	if len(products) == 0 {
+		return nil
+	}
+	promotions, err := GetActivePromotions(db, now)
+	if err != nil || len(promotions) == 0 {
+		return err
+	}
+
+	// Category promotions cover subcategories too, so walk up each product's category chain
+	parents := make(map[string]string)
+	categories, err := GetAllCategories(db)
+	if err != nil {
+		return err
+	}
+	for _, c := range categories {
+		if c.ParentID != nil {
+			parents[c.ID] = *c.ParentID
+		}
+	}
+
+	for i := range products {
+		p := &products[i]
+		p.Sale = nil
+		inScope := make(map[string]bool)
+		if p.CategoryID != nil {
+			// The depth cap guards against a cycle in the category tree
+			for id, depth := *p.CategoryID, 0; id != "" && depth < 20; id, depth = parents[id], depth+1 {
+				inScope[id] = true
+			}
+		}
+		// Promotions come biggest discount first, so the first that applies wins
+		for _, promo := range promotions {
+			if (promo.ProductID != nil && *promo.ProductID == p.ID) || (promo.CategoryID != nil && inScope[*promo.CategoryID]) {
+				p.Sale = &Sale{
+					PromotionID:     promo.ID,
+					Name:            promo.Name,
+					DiscountPercent: promo.DiscountPercent,
+					Price:           p.Price.Percent(-promo.DiscountPercent),
+					EndsAt:          promo.EndsAt,
+				}
+				break
+			}
+		}
+	}
+	return nil
+}
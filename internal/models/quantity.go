@@ -0,0 +1,147 @@
+package models
+
+import (
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Units a variant's quantity can be measured in
+const (
+	UnitGram       = "g"
+	UnitKilogram   = "kg"
+	UnitMillilitre = "ml"
+	UnitPiece      = "piece"
+)
+
+// VariantUnits lists the units in the order they are offered in filters
+var VariantUnits = []string{UnitGram, UnitKilogram, UnitMillilitre, UnitPiece}
+
+// unitAliases maps the spellings found in variant names to a unit. A bare number is grams,
+// as the bulk variant creator has always assumed. Keep in sync with migration 000013.
+var unitAliases = map[string]string{
+	"":            UnitGram,
+	"g":           UnitGram,
+	"gr":          UnitGram,
+	"gram":        UnitGram,
+	"grams":       UnitGram,
+	"kg":          UnitKilogram,
+	"kgs":         UnitKilogram,
+	"kilo":        UnitKilogram,
+	"kilos":       UnitKilogram,
+	"kilogram":    UnitKilogram,
+	"kilograms":   UnitKilogram,
+	"ml":          UnitMillilitre,
+	"millilitre":  UnitMillilitre,
+	"millilitres": UnitMillilitre,
+	"milliliter":  UnitMillilitre,
+	"milliliters": UnitMillilitre,
+	"pc":          UnitPiece,
+	"pcs":         UnitPiece,
+	"piece":       UnitPiece,
+	"pieces":      UnitPiece,
+}
+
+var quantityPattern = regexp.MustCompile(`^([0-9]+(?:\.[0-9]+)?)\s*([a-z]*)$`)
+
+// ParseQuantity reads a quantity such as "3.5g", "1 kg", "250ml" or "2 pieces".
+// ok is false when s isn't a number followed by a known unit.
+func ParseQuantity(s string) (quantity float64, unit string, ok bool) {
+	m := quantityPattern.FindStringSubmatch(strings.ToLower(strings.TrimSpace(s)))
+	if m == nil {
+		return 0, "", false
+	}
+	unit, ok = unitAliases[m[2]]
+	if !ok {
+		return 0, "", false
+	}
+	quantity, err := strconv.ParseFloat(m[1], 64)
+	if err != nil {
+		return 0, "", false
+	}
+	return quantity, unit, true
+}
+
+// SetQuantityFromName fills Quantity and Unit from the variant's name, clearing them
+// when the name isn't a quantity, e.g. "Gift box"
+func (v *ProductVariant) SetQuantityFromName() {
+	v.Quantity, v.Unit, _ = ParseQuantity(v.Name)
+}
+
+// QuantityLabel formats the quantity for display, e.g. "3.5g", "1kg" or "2 pieces".
+// It is empty when the variant has no quantity.
+func (v ProductVariant) QuantityLabel() string {
+	if v.Unit == "" {
+		return ""
+	}
+	quantity := strconv.FormatFloat(v.Quantity, 'f', -1, 64)
+	if v.Unit == UnitPiece {
+		if v.Quantity == 1 {
+			return quantity + " piece"
+		}
+		return quantity + " pieces"
+	}
+	return quantity + v.Unit
+}
+
+// baseQuantity converts the quantity to the smallest unit of its kind, so 1kg compares
+// as 1000g. The first result groups units of the same kind.
+func (v ProductVariant) baseQuantity() (int, float64) {
+	switch v.Unit {
+	case UnitGram:
+		return 0, v.Quantity
+	case UnitKilogram:
+		return 0, v.Quantity * 1000
+	case UnitMillilitre:
+		return 1, v.Quantity
+	case UnitPiece:
+		return 2, v.Quantity
+	default:
+		return 3, 0
+	}
+}
+
+// SortVariants orders variants by quantity, weights before volumes and pieces, so "2g" comes
+// before "10g" and "500g" before "1kg". Variants without a quantity go last, by name.
+func SortVariants(variants []ProductVariant) {
+	sort.SliceStable(variants, func(i, j int) bool {
+		ki, qi := variants[i].baseQuantity()
+		kj, qj := variants[j].baseQuantity()
+		if ki != kj {
+			return ki < kj
+		}
+		if qi != qj {
+			return qi < qj
+		}
+		return strings.ToLower(variants[i].Name) < strings.ToLower(variants[j].Name)
+	})
+}
+
+// VariantFilter narrows the variant list to one unit and a quantity range in that unit.
+// Units of the same kind are converted, so filtering by 100-500g also finds "0.25kg".
+// An empty Unit matches every variant; a zero Min or Max is no bound.
+type VariantFilter struct {
+	Unit string
+	Min  float64
+	Max  float64
+}
+
+// Matches reports whether the variant passes the filter
+func (f VariantFilter) Matches(v ProductVariant) bool {
+	if f.Unit == "" {
+		return true
+	}
+	kind, quantity := v.baseQuantity()
+	filterKind, scale := ProductVariant{Quantity: 1, Unit: f.Unit}.baseQuantity()
+	if kind != filterKind {
+		return false
+	}
+	if f.Min > 0 && quantity < f.Min*scale {
+		return false
+	}
+	if f.Max > 0 && quantity > f.Max*scale {
+		return false
+	}
+	return true
+}
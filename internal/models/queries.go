@@ -0,0 +1,13 @@
+package models
+
+import (
+	"github.com/ngenohkevin/kuiper_admin/internal/database"
+	"github.com/ngenohkevin/kuiper_admin/internal/models/sqlcdb"
+)
+
+// queries is the sqlc-generated query set from the SQL files in queries/, run on the pool. The
+// model functions wrap them and return the model structs; queries whose WHERE clause depends on
+// filters still go through queryBuilder.
+func queries(db *database.DB) *sqlcdb.Queries {
+	return sqlcdb.New(db.Pool)
+}
@@ -0,0 +1,35 @@
+-- Every query returns the columns of models.Category in its field order, so the generated rows
+-- convert straight to it.
+
+-- name: ListCategories :many
+SELECT id, name, slug, parent_id, created_at
+FROM categories
+WHERE deleted_at IS NULL
+ORDER BY name;
+
+-- name: GetCategory :one
+SELECT id, name, slug, parent_id, created_at
+FROM categories
+WHERE id = $1 AND deleted_at IS NULL;
+
+-- name: GetCategoriesByIDs :many
+SELECT id, name, slug, parent_id, created_at
+FROM categories
+WHERE id = ANY(@ids::uuid[]) AND deleted_at IS NULL;
+
+-- name: CreateCategory :one
+INSERT INTO categories (id, name, slug, parent_id)
+VALUES ($1, $2, $3, $4)
+RETURNING id, name, slug, parent_id, created_at;
+
+-- name: UpdateCategory :one
+UPDATE categories
+SET name = $2, slug = $3, parent_id = $4
+WHERE id = $1
+RETURNING id, name, slug, parent_id, created_at;
+
+-- name: DeleteCategory :execrows
+UPDATE categories SET deleted_at = CURRENT_TIMESTAMP WHERE id = $1 AND deleted_at IS NULL;
+
+-- name: RestoreCategory :execrows
+UPDATE categories SET deleted_at = NULL WHERE id = $1 AND deleted_at IS NOT NULL;
@@ -0,0 +1,64 @@
+package models
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// queryBuilder collects the WHERE conditions of a list or search query with their arguments.
+// Conditions are written with ? for each argument, which is numbered $1, $2, ... in the order
+// arguments are added, so values are never spliced into the SQL. A literal ? (as in the JSONB
+// operators) is written ??.
+type queryBuilder struct {
+	conditions []string
+	args       []interface{}
+}
+
+// where adds a condition, which must have one ? per argument
+func (b *queryBuilder) where(condition string, args ...interface{}) {
+	b.conditions = append(b.conditions, b.bind(condition, args))
+}
+
+// arg adds one argument and returns its placeholder, for values outside the WHERE clause such
+// as LIMIT and OFFSET
+func (b *queryBuilder) arg(value interface{}) string {
+	b.args = append(b.args, value)
+	return "$" + strconv.Itoa(len(b.args))
+}
+
+// whereClause is the conditions joined with AND, or nothing when there are none
+func (b *queryBuilder) whereClause() string {
+	if len(b.conditions) == 0 {
+		return ""
+	}
+	return "WHERE (" + strings.Join(b.conditions, ") AND (") + ")"
+}
+
+// bind numbers the placeholders of a condition after the arguments already added and adds its
+// own. A mismatch between placeholders and arguments is a bug in the caller, so it panics
+// rather than sending a query that would bind the wrong values.
+func (b *queryBuilder) bind(condition string, args []interface{}) string {
+	var sql strings.Builder
+	used := 0
+	for i := 0; i < len(condition); i++ {
+		if condition[i] != '?' {
+			sql.WriteByte(condition[i])
+			continue
+		}
+		if i+1 < len(condition) && condition[i+1] == '?' {
+			sql.WriteByte('?')
+			i++
+			continue
+		}
+		if used == len(args) {
+			panic(fmt.Sprintf("query condition %q has more placeholders than its %d arguments", condition, len(args)))
+		}
+		sql.WriteString(b.arg(args[used]))
+		used++
+	}
+	if used != len(args) {
+		panic(fmt.Sprintf("query condition %q has %d placeholders for %d arguments", condition, used, len(args)))
+	}
+	return sql.String()
+}
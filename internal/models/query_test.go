@@ -0,0 +1,117 @@
+package models
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestQueryBuilder(t *testing.T) {
+	tests := []struct {
+		name      string
+		build     func(b *queryBuilder) string
+		wantWhere string
+		wantArgs  []interface{}
+		wantExtra string // What build returned, for arg
+	}{
+		{
+			name:      "no conditions",
+			build:     func(b *queryBuilder) string { return "" },
+			wantWhere: "",
+		},
+		{
+			name:      "one condition",
+			build:     func(b *queryBuilder) string { b.where("name = ?", "tea"); return "" },
+			wantWhere: "WHERE (name = $1)",
+			wantArgs:  []interface{}{"tea"},
+		},
+		{
+			name: "placeholders are numbered across conditions",
+			build: func(b *queryBuilder) string {
+				b.where("price >= ? AND price <= ?", 10, 20)
+				b.where("category_id = ?", "c1")
+				return ""
+			},
+			wantWhere: "WHERE (price >= $1 AND price <= $2) AND (category_id = $3)",
+			wantArgs:  []interface{}{10, 20, "c1"},
+		},
+		{
+			name:      "condition without arguments",
+			build:     func(b *queryBuilder) string { b.where("deleted_at IS NULL"); return "" },
+			wantWhere: "WHERE (deleted_at IS NULL)",
+		},
+		{
+			name: "arg numbers after the conditions",
+			build: func(b *queryBuilder) string {
+				b.where("status = ?", "paid")
+				return "LIMIT " + b.arg(50) + " OFFSET " + b.arg(100)
+			},
+			wantWhere: "WHERE (status = $1)",
+			wantArgs:  []interface{}{"paid", 50, 100},
+			wantExtra: "LIMIT $2 OFFSET $3",
+		},
+		{
+			name:      "?? is a literal ?",
+			build:     func(b *queryBuilder) string { b.where("tags ?? ? AND attrs ??| ?", "sale", []string{"a"}); return "" },
+			wantWhere: "WHERE (tags ? $1 AND attrs ?| $2)",
+			wantArgs:  []interface{}{"sale", []string{"a"}},
+		},
+		{
+			name:      "?? alone takes no argument",
+			build:     func(b *queryBuilder) string { b.where("attrs ?? 'colour'"); return "" },
+			wantWhere: "WHERE (attrs ? 'colour')",
+		},
+		{
+			name:      "??? is a literal ? then a placeholder",
+			build:     func(b *queryBuilder) string { b.where("attrs ???", "colour"); return "" },
+			wantWhere: "WHERE (attrs ?$1)",
+			wantArgs:  []interface{}{"colour"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var b queryBuilder
+			extra := tt.build(&b)
+			if got := b.whereClause(); got != tt.wantWhere {
+				t.Errorf("whereClause() = %q, want %q", got, tt.wantWhere)
+			}
+			if !reflect.DeepEqual(b.args, tt.wantArgs) {
+				t.Errorf("args = %#v, want %#v", b.args, tt.wantArgs)
+			}
+			if extra != tt.wantExtra {
+				t.Errorf("built %q, want %q", extra, tt.wantExtra)
+			}
+		})
+	}
+}
+
+func TestQueryBuilderMismatchPanics(t *testing.T) {
+	tests := []struct {
+		name      string
+		condition string
+		args      []interface{}
+		wantPanic string
+	}{
+		{"more placeholders than arguments", "a = ? AND b = ?", []interface{}{1}, "more placeholders than its 1 arguments"},
+		{"no arguments for a placeholder", "a = ?", nil, "more placeholders than its 0 arguments"},
+		{"more arguments than placeholders", "a = ?", []interface{}{1, 2}, "has 1 placeholders for 2 arguments"},
+		{"?? doesn't take an argument", "a ?? b", []interface{}{1}, "has 0 placeholders for 1 arguments"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			defer func() {
+				r := recover()
+				if r == nil {
+					t.Fatalf("where(%q) with %d arguments didn't panic", tt.condition, len(tt.args))
+				}
+				if msg, _ := r.(string); !strings.Contains(msg, tt.wantPanic) {
+					t.Errorf("panic %q, want it to say %q", r, tt.wantPanic)
+				}
+			}()
+			var b queryBuilder
+			b.where(tt.condition, tt.args...)
+		})
+	}
+}
@@ -0,0 +1,93 @@
+package models
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/ngenohkevin/kuiper_admin/internal/database"
+)
+
+// RecentlyViewedLimit is how many products and categories are remembered for each admin
+const RecentlyViewedLimit = 10
+
+// RecentItem is a product or category an admin opened recently
+type RecentItem struct {
+	EntityType string    `json:"entity_type"` // ActivityProduct or ActivityCategory
+	ID         string    `json:"id"`
+	Name       string    `json:"name"`
+	ViewedAt   time.Time `json:"viewed_at"`
+}
+
+// URL links to the item's page
+func (i RecentItem) URL() string {
+	if i.EntityType == ActivityCategory {
+		return "/categories/" + i.ID
+	}
+	return "/products/" + i.ID
+}
+
+// RecordView remembers that an admin opened a product or category, forgetting their oldest
+// views past RecentlyViewedLimit. The statement sees the table as it was before the insert, so
+// the item itself is kept out of the trim and the rest are cut to one fewer than the limit.
+func RecordView(db *database.DB, username, entityType, id string) error {
+	if username == "" {
+		return nil
+	}
+
+	ctx, cancel := db.Context(database.Write)
+	defer cancel()
+
+	_, err := db.Pool.Exec(ctx, `
+		WITH viewed AS (
+			INSERT INTO recently_viewed (username, entity_type, entity_id)
+			VALUES ($1, $2, $3)
+			ON CONFLICT (username, entity_type, entity_id) DO UPDATE SET viewed_at = CURRENT_TIMESTAMP
+		)
+		DELETE FROM recently_viewed
+		WHERE username = $1 AND (entity_type, entity_id) IN (
+			SELECT entity_type, entity_id FROM recently_viewed
+			WHERE username = $1 AND NOT (entity_type = $2 AND entity_id = $3)
+			ORDER BY viewed_at DESC
+			OFFSET $4
+		)
+	`, username, entityType, id, RecentlyViewedLimit-1)
+	if err != nil {
+		return dbError("recording view", err)
+	}
+	return nil
+}
+
+// GetRecentlyViewed lists the products and categories an admin opened last, newest first.
+// Ones deleted since are left out.
+func GetRecentlyViewed(db *database.DB, username string) ([]RecentItem, error) {
+	ctx, cancel := db.Context(database.List)
+	defer cancel()
+
+	rows, err := db.Pool.Query(ctx, `
+		SELECT v.entity_type, v.entity_id, COALESCE(p.name, c.name), v.viewed_at
+		FROM recently_viewed v
+		LEFT JOIN products p ON v.entity_type = 'product' AND p.id = v.entity_id AND p.deleted_at IS NULL
+		LEFT JOIN categories c ON v.entity_type = 'category' AND c.id = v.entity_id AND c.deleted_at IS NULL
+		WHERE v.username = $1 AND (p.id IS NOT NULL OR c.id IS NOT NULL)
+		ORDER BY v.viewed_at DESC
+		LIMIT $2
+	`, username, RecentlyViewedLimit)
+	if err != nil {
+		return nil, dbError("getting recently viewed", err)
+	}
+	defer rows.Close()
+
+	var items []RecentItem
+	for rows.Next() {
+		var item RecentItem
+		if err := rows.Scan(&item.EntityType, &item.ID, &item.Name, &item.ViewedAt); err != nil {
+			return nil, fmt.Errorf("error scanning recently viewed item: %w", err)
+		}
+		items = append(items, item)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating recently viewed items: %w", err)
+	}
+
+	return items, nil
+}
@@ -0,0 +1,379 @@
+package models
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/ngenohkevin/kuiper_admin/internal/database"
+)
+
+// Retention rules, each limiting how long one kind of data is kept
+const (
+	RetentionSessions = "sessions"
+	RetentionReviews  = "reviews"
+	RetentionActivity = "activity"
+	RetentionAudit    = "audit"
+)
+
+// maxRetentionDays bounds a retention period at ten years
+const maxRetentionDays = 3650
+
+// retentionSampleLimit is how many of the rows a run would touch the dry run lists
+const retentionSampleLimit = 20
+
+// retentionBatchSize is how many rows a run changes per statement, so deleting a backlog of
+// years doesn't hold locks on the whole table or run into the bulk timeout
+const retentionBatchSize = 5000
+
+// RetentionPolicy is how long one kind of data is kept before the retention job removes it.
+// A policy with zero days is off and keeps everything.
+type RetentionPolicy struct {
+	Rule        string     `json:"rule"` // One of the Retention* constants
+	Label       string     `json:"label"`
+	Description string     `json:"description"`
+	Action      string     `json:"action"`   // What happens to old rows, e.g. "Delete the sessions"
+	MinDays     int        `json:"min_days"` // The shortest period the rule accepts
+	Days        int        `json:"days"`
+	UpdatedBy   string     `json:"updated_by"`
+	UpdatedAt   *time.Time `json:"updated_at"`
+	LastRunAt   *time.Time `json:"last_run_at"`
+	LastRunRows int64      `json:"last_run_rows"`
+}
+
+// Enabled reports whether the policy removes anything
+func (p RetentionPolicy) Enabled() bool {
+	return p.Days > 0
+}
+
+// Cutoff is when data must have been last touched after to be kept, as of now
+func (p RetentionPolicy) Cutoff(now time.Time) time.Time {
+	return now.AddDate(0, 0, -p.Days)
+}
+
+// RetentionRow is one row a retention run would remove or anonymize
+type RetentionRow struct {
+	ID     string    `json:"id"`
+	Name   string    `json:"name"`
+	Detail string    `json:"detail"`
+	At     time.Time `json:"at"` // The date the rule goes by
+}
+
+// RetentionPreview is what the next run of a policy would remove as things stand: how many
+// rows, the oldest of them, and the first few
+type RetentionPreview struct {
+	Policy RetentionPolicy `json:"policy"`
+	Count  int64           `json:"count"`
+	Oldest *time.Time      `json:"oldest"`
+	Rows   []RetentionRow  `json:"rows"`
+}
+
+// retentionRule is the SQL behind a retention policy. from is the table and conditions picking
+// the rows the rule removes, with $1 the cutoff; id and at are the rows' ID and the date the rule
+// goes by, and sample their name and detail for the dry run. apply changes the rows whose IDs
+// are in $1 and must repeat the conditions with $2 the cutoff, so rows changed since the batch
+// was picked are skipped.
+type retentionRule struct {
+	policy RetentionPolicy
+	from   string
+	id     string
+	at     string
+	sample string
+	apply  string
+}
+
+var retentionRules = []retentionRule{
+	{
+		policy: RetentionPolicy{
+			Rule:        RetentionSessions,
+			Label:       "Storefront sessions",
+			Description: "Sessions not used for this long, along with their wishlists. Sessions that placed orders or still have reviews are kept, so sales history isn't lost.",
+			Action:      "Delete the sessions",
+			MinDays:     1,
+		},
+		from: `
+			FROM sessions s
+			WHERE COALESCE(s.last_accessed_at, s.created_at) < $1
+			  AND NOT EXISTS (SELECT 1 FROM reviews r WHERE r.session_id = s.id)
+			  AND NOT EXISTS (SELECT 1 FROM storefront_orders o WHERE o.session_id = s.id)`,
+		id:     "s.id::text",
+		at:     "COALESCE(s.last_accessed_at, s.created_at)",
+		sample: `'Session ' || LEFT(s.token, 12) || '…', CASE WHEN s.banned_at IS NOT NULL THEN 'banned' ELSE '' END`,
+		apply: `
+			DELETE FROM sessions s
+			WHERE s.id::text = ANY($1::text[])
+			  AND COALESCE(s.last_accessed_at, s.created_at) < $2
+			  AND NOT EXISTS (SELECT 1 FROM reviews r WHERE r.session_id = s.id)
+			  AND NOT EXISTS (SELECT 1 FROM storefront_orders o WHERE o.session_id = s.id)`,
+	},
+	{
+		policy: RetentionPolicy{
+			Rule:        RetentionReviews,
+			Label:       "Reviewer details",
+			Description: "Reviews written this long ago, trashed ones included. The rating and comment stay; the reviewer's name and their link to a storefront session go, so they stop counting towards customer segments.",
+			Action:      "Anonymize the reviews",
+			MinDays:     1,
+		},
+		from: `
+			FROM reviews r
+			LEFT JOIN products p ON p.id = r.product_id
+			WHERE r.created_at < $1
+			  AND (r.session_id IS NOT NULL OR COALESCE(r.reviewer_name, '') <> '')`,
+		id:     "r.id::text",
+		at:     "r.created_at",
+		sample: `COALESCE(NULLIF(r.reviewer_name, ''), 'Anonymous') || ': ' || LEFT(COALESCE(r.comment, ''), 80), COALESCE(p.name, '')`,
+		apply: `
+			UPDATE reviews r SET reviewer_name = NULL, session_id = NULL
+			WHERE r.id::text = ANY($1::text[])
+			  AND r.created_at < $2
+			  AND (r.session_id IS NOT NULL OR COALESCE(r.reviewer_name, '') <> '')`,
+	},
+	{
+		policy: RetentionPolicy{
+			Rule:        RetentionActivity,
+			Label:       "Activity log",
+			Description: "Entries on product, category, review and order timelines recorded this long ago. At least a week is kept so change digests and anomaly alerts still see recent changes.",
+			Action:      "Delete the entries",
+			MinDays:     7,
+		},
+		from: `
+			FROM activity_events e
+			WHERE e.created_at < $1`,
+		id:     "e.id::text",
+		at:     "e.created_at",
+		sample: `e.entity_type || ' ' || e.action || CASE WHEN e.summary <> '' THEN ': ' || LEFT(e.summary, 80) ELSE '' END, e.actor`,
+		apply: `
+			DELETE FROM activity_events e
+			WHERE e.id::text = ANY($1::text[]) AND e.created_at < $2`,
+	},
+	{
+		policy: RetentionPolicy{
+			Rule:        RetentionAudit,
+			Label:       "Audit log",
+			Description: "Audit log entries of who created, changed or deleted what, recorded this long ago. At least a month is kept so recent changes can always be traced.",
+			Action:      "Delete the entries",
+			MinDays:     30,
+		},
+		from: `
+			FROM audit_log a
+			WHERE a.created_at < $1`,
+		id:     "a.id::text",
+		at:     "a.created_at",
+		sample: `a.action || ' ' || a.entity_type || CASE WHEN a.entity_id <> '' THEN ' ' || a.entity_id ELSE '' END, a.actor`,
+		apply: `
+			DELETE FROM audit_log a
+			WHERE a.id::text = ANY($1::text[]) AND a.created_at < $2`,
+	},
+}
+
+// getRetentionRule finds the SQL behind a retention rule
+func getRetentionRule(rule string) (retentionRule, error) {
+	for _, r := range retentionRules {
+		if r.policy.Rule == rule {
+			return r, nil
+		}
+	}
+	return retentionRule{}, notFound("unknown retention rule %q", rule)
+}
+
+// GetRetentionPolicies lists every retention rule with the period it is set to, in the order
+// the settings page shows them
+func GetRetentionPolicies(db *database.DB) ([]RetentionPolicy, error) {
+	ctx, cancel := db.Context(database.List)
+	defer cancel()
+
+	rows, err := db.Pool.Query(ctx, `
+		SELECT rule, days, updated_by, updated_at, last_run_at, last_run_rows
+		FROM retention_policies
+	`)
+	if err != nil {
+		return nil, dbError("getting retention policies", err)
+	}
+	defer rows.Close()
+
+	saved := map[string]RetentionPolicy{}
+	for rows.Next() {
+		var p RetentionPolicy
+		if err := rows.Scan(&p.Rule, &p.Days, &p.UpdatedBy, &p.UpdatedAt, &p.LastRunAt, &p.LastRunRows); err != nil {
+			return nil, fmt.Errorf("error scanning retention policy: %w", err)
+		}
+		saved[p.Rule] = p
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating retention policies: %w", err)
+	}
+
+	policies := make([]RetentionPolicy, len(retentionRules))
+	for i, rule := range retentionRules {
+		policies[i] = rule.policy
+		if p, ok := saved[rule.policy.Rule]; ok {
+			policies[i].Days = p.Days
+			policies[i].UpdatedBy = p.UpdatedBy
+			policies[i].UpdatedAt = p.UpdatedAt
+			policies[i].LastRunAt = p.LastRunAt
+			policies[i].LastRunRows = p.LastRunRows
+		}
+	}
+	return policies, nil
+}
+
+// SetRetentionDays sets how many days each rule in days keeps data for, zero to keep
+// everything. Every period is checked before any is saved, so a rejected form changes nothing.
+func SetRetentionDays(db *database.DB, days map[string]int, actor string) error {
+	for rule, d := range days {
+		r, err := getRetentionRule(rule)
+		if err != nil {
+			return err
+		}
+		if d < 0 || d > maxRetentionDays {
+			return fmt.Errorf("%s: days must be between 0 and %d", r.policy.Label, maxRetentionDays)
+		}
+		if d > 0 && d < r.policy.MinDays {
+			return fmt.Errorf("%s must be kept for at least %d days", r.policy.Label, r.policy.MinDays)
+		}
+	}
+
+	ctx, cancel := db.Context(database.Write)
+	defer cancel()
+
+	tx, err := db.Pool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("error starting transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	for rule, d := range days {
+		_, err = tx.Exec(ctx, `
+			INSERT INTO retention_policies (rule, days, updated_by) VALUES ($1, $2, $3)
+			ON CONFLICT (rule) DO UPDATE SET
+				days = EXCLUDED.days,
+				updated_by = EXCLUDED.updated_by,
+				updated_at = CURRENT_TIMESTAMP
+			WHERE retention_policies.days <> EXCLUDED.days
+		`, rule, d, actor)
+		if err != nil {
+			return dbError("saving retention policy", err)
+		}
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("error committing retention policies: %w", err)
+	}
+	return nil
+}
+
+// PreviewRetention is the dry run of a policy: what applying it now would remove, without
+// changing anything. An off policy removes nothing.
+func PreviewRetention(db *database.DB, policy RetentionPolicy) (RetentionPreview, error) {
+	preview := RetentionPreview{Policy: policy, Rows: []RetentionRow{}}
+	if !policy.Enabled() {
+		return preview, nil
+	}
+	rule, err := getRetentionRule(policy.Rule)
+	if err != nil {
+		return preview, err
+	}
+
+	ctx, cancel := db.Context(database.List)
+	defer cancel()
+
+	cutoff := policy.Cutoff(time.Now())
+	err = db.Pool.QueryRow(ctx, "SELECT COUNT(*), MIN("+rule.at+")"+rule.from, cutoff).Scan(&preview.Count, &preview.Oldest)
+	if err != nil {
+		return preview, dbError("previewing "+policy.Rule+" retention", err)
+	}
+	if preview.Count == 0 {
+		return preview, nil
+	}
+
+	rows, err := db.Pool.Query(ctx, "SELECT "+rule.id+", "+rule.sample+", "+rule.at+rule.from+" ORDER BY "+rule.at+" LIMIT $2", cutoff, retentionSampleLimit)
+	if err != nil {
+		return preview, dbError("previewing "+policy.Rule+" retention", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var row RetentionRow
+		if err := rows.Scan(&row.ID, &row.Name, &row.Detail, &row.At); err != nil {
+			return preview, fmt.Errorf("error scanning retention row: %w", err)
+		}
+		preview.Rows = append(preview.Rows, row)
+	}
+	if err := rows.Err(); err != nil {
+		return preview, fmt.Errorf("error iterating retention rows: %w", err)
+	}
+	return preview, nil
+}
+
+// ApplyRetention removes or anonymizes everything a policy no longer keeps, in batches, and
+// records the run against the policy. It returns how many rows it changed.
+func ApplyRetention(db *database.DB, policy RetentionPolicy) (int64, error) {
+	if !policy.Enabled() {
+		return 0, nil
+	}
+	rule, err := getRetentionRule(policy.Rule)
+	if err != nil {
+		return 0, err
+	}
+
+	cutoff := policy.Cutoff(time.Now())
+	var total int64
+	for {
+		changed, err := applyRetentionBatch(db, rule, cutoff)
+		total += changed
+		if err != nil {
+			return total, err
+		}
+		if changed == 0 {
+			break
+		}
+	}
+
+	ctx, cancel := db.Context(database.Write)
+	defer cancel()
+
+	_, err = db.Pool.Exec(ctx, `
+		INSERT INTO retention_policies (rule, days, last_run_at, last_run_rows) VALUES ($1, $2, CURRENT_TIMESTAMP, $3)
+		ON CONFLICT (rule) DO UPDATE SET last_run_at = EXCLUDED.last_run_at, last_run_rows = EXCLUDED.last_run_rows
+	`, policy.Rule, policy.Days, total)
+	if err != nil {
+		return total, dbError("recording retention run", err)
+	}
+	return total, nil
+}
+
+// applyRetentionBatch changes the next batch of rows a rule no longer keeps, returning how many
+func applyRetentionBatch(db *database.DB, rule retentionRule, cutoff time.Time) (int64, error) {
+	ctx, cancel := db.Context(database.Bulk)
+	defer cancel()
+
+	rows, err := db.Pool.Query(ctx, "SELECT "+rule.id+rule.from+" LIMIT $2", cutoff, retentionBatchSize)
+	if err != nil {
+		return 0, dbError("finding "+rule.policy.Rule+" past retention", err)
+	}
+	ids := []string{}
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return 0, fmt.Errorf("error scanning retention row: %w", err)
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, fmt.Errorf("error iterating retention rows: %w", err)
+	}
+	if len(ids) == 0 {
+		return 0, nil
+	}
+
+	tag, err := db.Pool.Exec(ctx, rule.apply, ids, cutoff)
+	if err != nil {
+		return 0, dbError("applying "+rule.policy.Rule+" retention", err)
+	}
+	if tag.RowsAffected() == 0 {
+		// Every row picked was changed by someone else in between; the next batch would be the same
+		return 0, nil
+	}
+	return tag.RowsAffected(), nil
+}
@@ -1,16 +1,21 @@
 package models
 
 import (
-	"context"
 	"fmt"
 	"log"
-	"time"
 
 	"github.com/google/uuid"
 	"github.com/jackc/pgx/v5/pgtype"
 	"github.com/ngenohkevin/kuiper_admin/internal/database"
 )
 
+// Moderation states of a review
+const (
+	ReviewPending  = "pending" // Submitted through the API, not shown until approved
+	ReviewApproved = "approved"
+	ReviewRejected = "rejected"
+)
+
 type Review struct {
 	ID           string           `json:"id"`
 	ProductID    *string          `json:"product_id"`
@@ -19,19 +24,21 @@ type Review struct {
 	Comment      string           `json:"comment"`
 	CreatedAt    pgtype.Timestamp `json:"created_at"`
 	ReviewerName *string          `json:"reviewer_name"`
+	Status       string           `json:"status"` // One of the Review* constants
 	Product      *Product         `json:"product,omitempty"`
 }
 
 // GetAllReviews retrieves all reviews from the database
 func GetAllReviews(db *database.DB) ([]Review, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	ctx, cancel := db.Context(database.List)
 	defer cancel()
 
 	query := `
-		SELECT r.id, r.product_id, r.session_id, r.rating, r.comment, r.created_at, r.reviewer_name,
+		SELECT r.id, r.product_id, r.session_id, r.rating, r.comment, r.created_at, r.reviewer_name, r.status,
 		       p.id, p.name, p.slug
 		FROM reviews r
 		LEFT JOIN products p ON r.product_id = p.id
+		WHERE r.deleted_at IS NULL
 		ORDER BY r.created_at DESC
 	`
 
@@ -49,7 +56,7 @@ func GetAllReviews(db *database.DB) ([]Review, error) {
 		var productID, productName, productSlug string
 
 		if err := rows.Scan(
-			&r.ID, &r.ProductID, &r.SessionID, &r.Rating, &r.Comment, &r.CreatedAt, &r.ReviewerName,
+			&r.ID, &r.ProductID, &r.SessionID, &r.Rating, &r.Comment, &r.CreatedAt, &r.ReviewerName, &r.Status,
 			&productID, &productName, &productSlug,
 		); err != nil {
 			log.Printf("Scan error: %v", err)
@@ -74,43 +81,61 @@ func GetAllReviews(db *database.DB) ([]Review, error) {
 	return reviews, nil
 }
 
-// GetReviewsPaginated retrieves reviews with pagination
-func GetReviewsPaginated(db *database.DB, page, pageSize int) (PaginatedResult[Review], error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-	defer cancel()
+// ReviewSorts are the orders the review list can be sorted in
+var ReviewSorts = SortOptions{
+	Columns: map[string]string{
+		"created": "r.created_at",
+		"rating":  "r.rating",
+		"product": "p.name",
+	},
+	Default: "-created",
+}
 
-	// Validate page and pageSize
-	if page < 1 {
-		page = 1
+// reviewListFilters is the WHERE clause of the review list for q's search and status, over
+// reviews r joined to their products p
+func reviewListFilters(q ListQuery) queryBuilder {
+	var b queryBuilder
+	b.where("r.deleted_at IS NULL")
+	if q.Filter != "" {
+		b.where("r.status = ?", q.Filter)
 	}
-	if pageSize < 1 || pageSize > 100 {
-		pageSize = 20
+	if q.Search != "" {
+		pattern := "%" + q.Search + "%"
+		b.where("r.comment ILIKE ? OR p.name ILIKE ? OR r.reviewer_name ILIKE ?", pattern, pattern, pattern)
 	}
+	return b
+}
 
-	offset := (page - 1) * pageSize
+// GetReviewsPaginated retrieves a page of reviews matching the search in their comment, product
+// or reviewer name. q.Filter is a review status, or empty for every review.
+func GetReviewsPaginated(db *database.DB, q ListQuery) (PaginatedResult[Review], error) {
+	ctx, cancel := db.Context(database.List)
+	defer cancel()
+
+	offset := q.offset()
+	b := reviewListFilters(q)
+	where := `
+		FROM reviews r
+		LEFT JOIN products p ON r.product_id = p.id
+		` + b.whereClause()
 
 	// Get total count
-	countQuery := "SELECT COUNT(*) FROM reviews"
 	var totalCount int64
-	err := db.Pool.QueryRow(ctx, countQuery).Scan(&totalCount)
+	err := db.Pool.QueryRow(ctx, "SELECT COUNT(*)"+where, b.args...).Scan(&totalCount)
 	if err != nil {
 		return PaginatedResult[Review]{}, fmt.Errorf("error counting reviews: %w", err)
 	}
 
 	// Get paginated reviews
 	query := `
-		SELECT r.id, r.product_id, r.session_id, r.rating, r.comment, r.created_at, r.reviewer_name,
+		SELECT r.id, r.product_id, r.session_id, r.rating, r.comment, r.created_at, r.reviewer_name, r.status,
 		       p.id, p.name, p.slug
-		FROM reviews r
-		LEFT JOIN products p ON r.product_id = p.id
-		ORDER BY r.created_at DESC
-		LIMIT $1 OFFSET $2
-	`
+	` + where + `
+		ORDER BY ` + ReviewSorts.orderBy(q.Sort, "r.id") + `
+		LIMIT ` + b.arg(q.PageSize) + ` OFFSET ` + b.arg(offset)
 
-	log.Printf("Executing paginated SQL query: %s with LIMIT %d OFFSET %d", query, pageSize, offset)
-	rows, err := db.Pool.Query(ctx, query, pageSize, offset)
+	rows, err := db.Pool.Query(ctx, query, b.args...)
 	if err != nil {
-		log.Printf("Database error: %v", err)
 		return PaginatedResult[Review]{}, fmt.Errorf("error querying reviews: %w", err)
 	}
 	defer rows.Close()
@@ -118,21 +143,20 @@ func GetReviewsPaginated(db *database.DB, page, pageSize int) (PaginatedResult[R
 	var reviews []Review
 	for rows.Next() {
 		var r Review
-		var productID, productName, productSlug string
+		var productID, productName, productSlug *string
 
 		if err := rows.Scan(
-			&r.ID, &r.ProductID, &r.SessionID, &r.Rating, &r.Comment, &r.CreatedAt, &r.ReviewerName,
+			&r.ID, &r.ProductID, &r.SessionID, &r.Rating, &r.Comment, &r.CreatedAt, &r.ReviewerName, &r.Status,
 			&productID, &productName, &productSlug,
 		); err != nil {
-			log.Printf("Scan error: %v", err)
 			return PaginatedResult[Review]{}, fmt.Errorf("error scanning review row: %w", err)
 		}
 
-		if productID != "" {
+		if productID != nil {
 			r.Product = &Product{
-				ID:   productID,
-				Name: productName,
-				Slug: productSlug,
+				ID:   *productID,
+				Name: *productName,
+				Slug: *productSlug,
 			}
 		}
 
@@ -143,33 +167,20 @@ func GetReviewsPaginated(db *database.DB, page, pageSize int) (PaginatedResult[R
 		return PaginatedResult[Review]{}, fmt.Errorf("error iterating review rows: %w", err)
 	}
 
-	// Calculate pagination metadata
-	totalPages := int((totalCount + int64(pageSize) - 1) / int64(pageSize))
-	hasNext := page < totalPages
-	hasPrev := page > 1
-
-	return PaginatedResult[Review]{
-		Data:       reviews,
-		TotalCount: totalCount,
-		Page:       page,
-		PageSize:   pageSize,
-		TotalPages: totalPages,
-		HasNext:    hasNext,
-		HasPrev:    hasPrev,
-	}, nil
+	return newPage(reviews, totalCount, q), nil
 }
 
 // GetReviewByID retrieves a single review by ID
 func GetReviewByID(db *database.DB, id string) (Review, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	ctx, cancel := db.Context(database.Read)
 	defer cancel()
 
 	query := `
-		SELECT r.id, r.product_id, r.session_id, r.rating, r.comment, r.created_at, r.reviewer_name,
+		SELECT r.id, r.product_id, r.session_id, r.rating, r.comment, r.created_at, r.reviewer_name, r.status,
 		       p.id, p.name, p.slug
 		FROM reviews r
 		LEFT JOIN products p ON r.product_id = p.id
-		WHERE r.id = $1
+		WHERE r.id = $1 AND r.deleted_at IS NULL
 	`
 
 	log.Printf("Executing SQL query for review ID %s: %s", id, query)
@@ -178,12 +189,12 @@ func GetReviewByID(db *database.DB, id string) (Review, error) {
 	var productID, productName, productSlug string
 
 	err := db.Pool.QueryRow(ctx, query, id).Scan(
-		&r.ID, &r.ProductID, &r.SessionID, &r.Rating, &r.Comment, &r.CreatedAt, &r.ReviewerName,
+		&r.ID, &r.ProductID, &r.SessionID, &r.Rating, &r.Comment, &r.CreatedAt, &r.ReviewerName, &r.Status,
 		&productID, &productName, &productSlug,
 	)
 	if err != nil {
 		log.Printf("Database error finding review %s: %v", id, err)
-		return Review{}, fmt.Errorf("error finding review: %w", err)
+		return Review{}, dbError("finding review", err)
 	}
 
 	if productID != "" {
@@ -199,7 +210,7 @@ func GetReviewByID(db *database.DB, id string) (Review, error) {
 
 // CreateReview creates a new review in the database
 func CreateReview(db *database.DB, productID *string, sessionID *string, rating float64, comment string, reviewerName string) (Review, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	ctx, cancel := db.Context(database.Write)
 	defer cancel()
 
 	// Generate a UUID for the new review
@@ -233,12 +244,12 @@ func CreateReview(db *database.DB, productID *string, sessionID *string, rating
 	query := `
 		INSERT INTO reviews (id, product_id, session_id, rating, comment, reviewer_name, created_at)
 		VALUES ($1, $2, $3, $4, $5, $6, CURRENT_TIMESTAMP)
-		RETURNING id, product_id, session_id, rating, comment, created_at, reviewer_name
+		RETURNING id, product_id, session_id, rating, comment, created_at, reviewer_name, status
 	`
 
 	var r Review
 	err := db.Pool.QueryRow(ctx, query, newID, productID, sessionID, rating, comment, reviewerNamePtr).Scan(
-		&r.ID, &r.ProductID, &r.SessionID, &r.Rating, &r.Comment, &r.CreatedAt, &r.ReviewerName,
+		&r.ID, &r.ProductID, &r.SessionID, &r.Rating, &r.Comment, &r.CreatedAt, &r.ReviewerName, &r.Status,
 	)
 	if err != nil {
 		log.Printf("Database error creating review: %v", err)
@@ -251,7 +262,7 @@ func CreateReview(db *database.DB, productID *string, sessionID *string, rating
 
 // UpdateReview updates an existing review in the database
 func UpdateReview(db *database.DB, id string, productID *string, sessionID *string, rating float64, comment string, reviewerName string) (Review, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	ctx, cancel := db.Context(database.Write)
 	defer cancel()
 
 	// Handle optional reviewer_name
@@ -264,31 +275,139 @@ func UpdateReview(db *database.DB, id string, productID *string, sessionID *stri
 		UPDATE reviews
 		SET product_id = $2, session_id = $3, rating = $4, comment = $5, reviewer_name = $6
 		WHERE id = $1
-		RETURNING id, product_id, session_id, rating, comment, created_at, reviewer_name
+		RETURNING id, product_id, session_id, rating, comment, created_at, reviewer_name, status
 	`
 
 	var r Review
 	err := db.Pool.QueryRow(ctx, query, id, productID, sessionID, rating, comment, reviewerNamePtr).Scan(
-		&r.ID, &r.ProductID, &r.SessionID, &r.Rating, &r.Comment, &r.CreatedAt, &r.ReviewerName,
+		&r.ID, &r.ProductID, &r.SessionID, &r.Rating, &r.Comment, &r.CreatedAt, &r.ReviewerName, &r.Status,
 	)
 	if err != nil {
-		return Review{}, fmt.Errorf("error updating review: %w", err)
+		return Review{}, dbError("updating review", err)
 	}
 
 	return r, nil
 }
 
-// DeleteReview deletes a review from the database
+// DeleteReview soft-deletes a review so it can be restored with RestoreReview
 func DeleteReview(db *database.DB, id string) error {
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	ctx, cancel := db.Context(database.Write)
+	defer cancel()
+
+	query := `UPDATE reviews SET deleted_at = CURRENT_TIMESTAMP WHERE id = $1 AND deleted_at IS NULL`
+
+	tag, err := db.Pool.Exec(ctx, query, id)
+	if err != nil {
+		return dbError("deleting review", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return notFound("review %s not found", id)
+	}
+
+	return nil
+}
+
+// RestoreReview brings back a soft-deleted review
+func RestoreReview(db *database.DB, id string) error {
+	ctx, cancel := db.Context(database.Write)
+	defer cancel()
+
+	query := `UPDATE reviews SET deleted_at = NULL WHERE id = $1 AND deleted_at IS NOT NULL`
+
+	tag, err := db.Pool.Exec(ctx, query, id)
+	if err != nil {
+		return dbError("restoring review", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return conflict("review %s is not deleted", id)
+	}
+
+	return nil
+}
+
+// SubmitReview adds a review sent by the storefront on behalf of a shopper. It is tied to the
+// shopper's live session, which mustn't be banned, and waits in the moderation queue until an
+// admin approves it.
+func SubmitReview(db *database.DB, productID, sessionToken string, rating int, comment, reviewerName, apiTokenID string) (Review, error) {
+	if rating < 1 || rating > 5 {
+		return Review{}, fmt.Errorf("rating must be between 1 and 5")
+	}
+	if sessionToken == "" {
+		return Review{}, fmt.Errorf("session_token is required")
+	}
+
+	ctx, cancel := db.Context(database.Write)
 	defer cancel()
 
-	query := `DELETE FROM reviews WHERE id = $1`
+	sessionID, err := liveSessionID(ctx, db, sessionToken)
+	if err != nil {
+		return Review{}, err
+	}
 
-	_, err := db.Pool.Exec(ctx, query, id)
+	var exists bool
+	err = db.Pool.QueryRow(ctx, `SELECT EXISTS (SELECT 1 FROM products WHERE id::text = $1 AND deleted_at IS NULL)`, productID).Scan(&exists)
 	if err != nil {
-		return fmt.Errorf("error deleting review: %w", err)
+		return Review{}, dbError("finding product", err)
+	}
+	if !exists {
+		return Review{}, notFound("product %s not found", productID)
+	}
+
+	var reviewerNamePtr, apiTokenPtr *string
+	if reviewerName != "" {
+		reviewerNamePtr = &reviewerName
+	}
+	if apiTokenID != "" {
+		apiTokenPtr = &apiTokenID
+	}
+
+	var r Review
+	err = db.Pool.QueryRow(ctx, `
+		INSERT INTO reviews (product_id, session_id, rating, comment, reviewer_name, status, api_token_id)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		RETURNING id, product_id, session_id, rating, comment, created_at, reviewer_name, status
+	`, productID, sessionID, rating, comment, reviewerNamePtr, ReviewPending, apiTokenPtr).Scan(
+		&r.ID, &r.ProductID, &r.SessionID, &r.Rating, &r.Comment, &r.CreatedAt, &r.ReviewerName, &r.Status,
+	)
+	if err != nil {
+		return Review{}, fmt.Errorf("error creating review: %w", err)
+	}
+
+	return r, nil
+}
+
+// ModerateReview approves or rejects a review
+func ModerateReview(db *database.DB, id, status, actor string) error {
+	if status != ReviewApproved && status != ReviewRejected {
+		return fmt.Errorf("unknown review status %q", status)
+	}
+
+	ctx, cancel := db.Context(database.Write)
+	defer cancel()
+
+	tag, err := db.Pool.Exec(ctx, `
+		UPDATE reviews SET status = $2, moderated_by = $3, moderated_at = NOW()
+		WHERE id = $1 AND deleted_at IS NULL
+	`, id, status, actor)
+	if err != nil {
+		return fmt.Errorf("error moderating review: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return notFound("review %s not found", id)
 	}
 
 	return nil
 }
+
+// CountPendingReviews returns the size of the moderation queue
+func CountPendingReviews(db *database.DB) (int, error) {
+	ctx, cancel := db.Context(database.Read)
+	defer cancel()
+
+	var count int
+	err := db.Pool.QueryRow(ctx, `SELECT COUNT(*) FROM reviews WHERE status = $1 AND deleted_at IS NULL`, ReviewPending).Scan(&count)
+	if err != nil {
+		return 0, fmt.Errorf("error counting pending reviews: %w", err)
+	}
+	return count, nil
+}
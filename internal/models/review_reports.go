@@ -0,0 +1,396 @@
+package models
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/ngenohkevin/kuiper_admin/internal/database"
+)
+
+// Why a shopper reports a review
+const (
+	ReportSpam         = "spam"
+	ReportOffensive    = "offensive"
+	ReportOffTopic     = "off_topic"
+	ReportFake         = "fake"          // Not a genuine customer's opinion
+	ReportPersonalInfo = "personal_info" // Names, addresses or phone numbers
+	ReportOther        = "other"
+)
+
+// ReviewReportReasons lists the reasons in the order the queue shows them
+var ReviewReportReasons = []string{ReportSpam, ReportOffensive, ReportOffTopic, ReportFake, ReportPersonalInfo, ReportOther}
+
+// What was done about a review's reports
+const (
+	ReportDismissed = "dismissed" // The review stays as it is
+	ReportHidden    = "hidden"    // The review was rejected, taking it off the storefront
+	ReportBanned    = "banned"    // Hidden, and the session that wrote it can't review or report again
+)
+
+// reviewReportHistoryLimit is how many handled reviews the queue lists under the open ones
+const reviewReportHistoryLimit = 20
+
+// ReviewReportSLA is how long a reported review may wait in the queue before it shows as
+// overdue. Override with REVIEW_REPORT_SLA_HOURS.
+func ReviewReportSLA() time.Duration {
+	if s := os.Getenv("REVIEW_REPORT_SLA_HOURS"); s != "" {
+		if hours, err := strconv.Atoi(s); err == nil && hours > 0 {
+			return time.Duration(hours) * time.Hour
+		}
+	}
+	return 24 * time.Hour
+}
+
+// ReviewReport is one shopper's report of a review
+type ReviewReport struct {
+	ID        string    `json:"id"`
+	ReviewID  string    `json:"review_id"`
+	Reason    string    `json:"reason"` // One of the Report* reasons
+	Note      string    `json:"note"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// liveSessionID finds the unexpired storefront session holding token, and fails for one that
+// has been banned
+func liveSessionID(ctx context.Context, db *database.DB, token string) (string, error) {
+	var sessionID string
+	var bannedAt *time.Time
+	err := db.Pool.QueryRow(ctx, `
+		SELECT id, banned_at FROM sessions WHERE token = $1 AND expires_at > NOW()
+	`, token).Scan(&sessionID, &bannedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return "", fmt.Errorf("unknown or expired session")
+	}
+	if err != nil {
+		return "", dbError("finding session", err)
+	}
+	if bannedAt != nil {
+		return "", conflict("this session has been banned from reviews")
+	}
+	return sessionID, nil
+}
+
+// ReportReview records a shopper's report of a review from the storefront. A session reports a
+// review once; reporting it again returns the first report with created false.
+func ReportReview(db *database.DB, reviewID, sessionToken, reason, note string) (ReviewReport, bool, error) {
+	if !slices.Contains(ReviewReportReasons, reason) {
+		return ReviewReport{}, false, fmt.Errorf("reason must be one of %s", strings.Join(ReviewReportReasons, ", "))
+	}
+	note = strings.TrimSpace(note)
+	if len(note) > 1000 {
+		return ReviewReport{}, false, fmt.Errorf("note can be at most 1000 characters")
+	}
+	if sessionToken == "" {
+		return ReviewReport{}, false, fmt.Errorf("session_token is required")
+	}
+
+	ctx, cancel := db.Context(database.Write)
+	defer cancel()
+
+	sessionID, err := liveSessionID(ctx, db, sessionToken)
+	if err != nil {
+		return ReviewReport{}, false, err
+	}
+
+	var exists bool
+	err = db.Pool.QueryRow(ctx, `SELECT EXISTS (SELECT 1 FROM reviews WHERE id::text = $1 AND deleted_at IS NULL)`, reviewID).Scan(&exists)
+	if err != nil {
+		return ReviewReport{}, false, dbError("finding review", err)
+	}
+	if !exists {
+		return ReviewReport{}, false, notFound("review %s not found", reviewID)
+	}
+
+	report := ReviewReport{ReviewID: reviewID}
+	err = db.Pool.QueryRow(ctx, `
+		INSERT INTO review_reports (review_id, session_id, reason, note)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (review_id, session_id) DO NOTHING
+		RETURNING id, reason, note, created_at
+	`, reviewID, sessionID, reason, note).Scan(&report.ID, &report.Reason, &report.Note, &report.CreatedAt)
+	if err == nil {
+		return report, true, nil
+	}
+	if !errors.Is(err, pgx.ErrNoRows) {
+		return ReviewReport{}, false, dbError("reporting review", err)
+	}
+
+	err = db.Pool.QueryRow(ctx, `
+		SELECT id, reason, note, created_at FROM review_reports WHERE review_id = $1 AND session_id = $2
+	`, reviewID, sessionID).Scan(&report.ID, &report.Reason, &report.Note, &report.CreatedAt)
+	if err != nil {
+		return ReviewReport{}, false, dbError("finding review report", err)
+	}
+	return report, false, nil
+}
+
+// ReasonCount is how many reports gave a reason
+type ReasonCount struct {
+	Reason string `json:"reason"`
+	Count  int    `json:"count"`
+}
+
+// ReportedReview is a review in the report queue with its open reports summed up
+type ReportedReview struct {
+	ReviewID        string        `json:"review_id"`
+	Comment         string        `json:"comment"`
+	Rating          float64       `json:"rating"`
+	ReviewerName    string        `json:"reviewer_name"`
+	Status          string        `json:"status"`
+	ProductID       string        `json:"product_id"`
+	ProductName     string        `json:"product_name"`
+	SessionID       string        `json:"session_id"` // Who wrote it, empty for reviews added by an admin
+	SessionBanned   bool          `json:"session_banned"`
+	Reports         int           `json:"reports"`
+	Reasons         []ReasonCount `json:"reasons"` // Most given first
+	Notes           []string      `json:"notes"`
+	FirstReportedAt time.Time     `json:"first_reported_at"`
+	DueAt           time.Time     `json:"due_at"` // When it passes the SLA
+}
+
+// Overdue reports whether the review has waited longer than the SLA at now
+func (r ReportedReview) Overdue(now time.Time) bool {
+	return now.After(r.DueAt)
+}
+
+// DueSoon reports whether the review is within the last quarter of its SLA at now
+func (r ReportedReview) DueSoon(now time.Time) bool {
+	return !r.Overdue(now) && now.After(r.DueAt.Add(-r.DueAt.Sub(r.FirstReportedAt)/4))
+}
+
+// HandledReport is a review whose reports were dealt with
+type HandledReport struct {
+	ReviewID    string    `json:"review_id"`
+	ProductName string    `json:"product_name"`
+	SessionID   string    `json:"session_id"`
+	Banned      bool      `json:"banned"` // The session is still banned
+	Resolution  string    `json:"resolution"`
+	Reports     int       `json:"reports"`
+	ResolvedBy  string    `json:"resolved_by"`
+	ResolvedAt  time.Time `json:"resolved_at"`
+	WaitedFor   string    `json:"waited_for"` // From the first report to being handled, e.g. "3h"
+}
+
+// ReviewReportQueue is the reported reviews waiting for an admin, oldest first, and the most
+// recently handled
+type ReviewReportQueue struct {
+	SLA     time.Duration    `json:"-"`
+	Open    []ReportedReview `json:"open"`
+	Overdue int              `json:"overdue"`
+	Handled []HandledReport  `json:"handled"`
+}
+
+// CountOpenReviewReports counts the reviews waiting in the report queue and how many of them
+// are past sla
+func CountOpenReviewReports(db *database.DB, sla time.Duration) (open, overdue int, err error) {
+	ctx, cancel := db.Context(database.Read)
+	defer cancel()
+
+	err = db.Pool.QueryRow(ctx, `
+		SELECT COUNT(*), COUNT(*) FILTER (WHERE first_reported_at < $1)
+		FROM (
+		    SELECT MIN(rr.created_at) AS first_reported_at
+		    FROM review_reports rr
+		    JOIN reviews r ON r.id = rr.review_id AND r.deleted_at IS NULL
+		    WHERE rr.resolved_at IS NULL
+		    GROUP BY rr.review_id
+		) open
+	`, time.Now().Add(-sla)).Scan(&open, &overdue)
+	if err != nil {
+		return 0, 0, dbError("counting review reports", err)
+	}
+	return open, overdue, nil
+}
+
+// GetReviewReportQueue gets the reviews with open reports, the longest waiting first, with
+// their due times under sla
+func GetReviewReportQueue(db *database.DB, sla time.Duration) (ReviewReportQueue, error) {
+	ctx, cancel := db.Context(database.List)
+	defer cancel()
+
+	queue := ReviewReportQueue{SLA: sla, Open: []ReportedReview{}, Handled: []HandledReport{}}
+	rows, err := db.Pool.Query(ctx, `
+		SELECT r.id, r.comment, r.rating, COALESCE(r.reviewer_name, ''), r.status,
+		       COALESCE(p.id::text, ''), COALESCE(p.name, 'Deleted product'),
+		       COALESCE(s.id::text, ''), COALESCE(s.banned_at IS NOT NULL, false),
+		       COUNT(*), MIN(rr.created_at),
+		       array_agg(rr.reason ORDER BY rr.created_at),
+		       array_remove(array_agg(NULLIF(rr.note, '') ORDER BY rr.created_at), NULL)
+		FROM review_reports rr
+		JOIN reviews r ON r.id = rr.review_id AND r.deleted_at IS NULL
+		LEFT JOIN products p ON p.id = r.product_id
+		LEFT JOIN sessions s ON s.id = r.session_id
+		WHERE rr.resolved_at IS NULL
+		GROUP BY r.id, p.id, s.id
+		ORDER BY MIN(rr.created_at)
+	`)
+	if err != nil {
+		return queue, dbError("getting review reports", err)
+	}
+	now := time.Now()
+	for rows.Next() {
+		var item ReportedReview
+		var reasons []string
+		if err := rows.Scan(&item.ReviewID, &item.Comment, &item.Rating, &item.ReviewerName, &item.Status,
+			&item.ProductID, &item.ProductName, &item.SessionID, &item.SessionBanned,
+			&item.Reports, &item.FirstReportedAt, &reasons, &item.Notes); err != nil {
+			rows.Close()
+			return queue, fmt.Errorf("error scanning review reports: %w", err)
+		}
+		item.Reasons = countReasons(reasons)
+		item.DueAt = item.FirstReportedAt.Add(sla)
+		if item.Overdue(now) {
+			queue.Overdue++
+		}
+		queue.Open = append(queue.Open, item)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return queue, fmt.Errorf("error iterating review reports: %w", err)
+	}
+
+	rows, err = db.Pool.Query(ctx, `
+		SELECT rr.review_id, COALESCE(p.name, 'Deleted product'), COALESCE(s.id::text, ''),
+		       COALESCE(s.banned_at IS NOT NULL, false), rr.resolution, COUNT(*), rr.resolved_by,
+		       rr.resolved_at, EXTRACT(EPOCH FROM rr.resolved_at - MIN(rr.created_at))::bigint
+		FROM review_reports rr
+		JOIN reviews r ON r.id = rr.review_id
+		LEFT JOIN products p ON p.id = r.product_id
+		LEFT JOIN sessions s ON s.id = r.session_id
+		WHERE rr.resolved_at IS NOT NULL
+		GROUP BY rr.review_id, p.name, s.id, rr.resolution, rr.resolved_by, rr.resolved_at
+		ORDER BY rr.resolved_at DESC
+		LIMIT $1
+	`, reviewReportHistoryLimit)
+	if err != nil {
+		return queue, dbError("getting handled review reports", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var item HandledReport
+		var waited int64
+		if err := rows.Scan(&item.ReviewID, &item.ProductName, &item.SessionID, &item.Banned, &item.Resolution,
+			&item.Reports, &item.ResolvedBy, &item.ResolvedAt, &waited); err != nil {
+			return queue, fmt.Errorf("error scanning handled review reports: %w", err)
+		}
+		item.WaitedFor = shortDuration(time.Duration(waited) * time.Second)
+		queue.Handled = append(queue.Handled, item)
+	}
+	if err := rows.Err(); err != nil {
+		return queue, fmt.Errorf("error iterating handled review reports: %w", err)
+	}
+	return queue, nil
+}
+
+// countReasons tallies the reasons reports gave, the most given first
+func countReasons(reasons []string) []ReasonCount {
+	counts := []ReasonCount{}
+	for _, reason := range reasons {
+		i := slices.IndexFunc(counts, func(c ReasonCount) bool { return c.Reason == reason })
+		if i < 0 {
+			counts = append(counts, ReasonCount{Reason: reason})
+			i = len(counts) - 1
+		}
+		counts[i].Count++
+	}
+	slices.SortStableFunc(counts, func(a, b ReasonCount) int { return b.Count - a.Count })
+	return counts
+}
+
+// shortDuration writes d the way the queue shows waits, e.g. "45m", "3h" or "2d"
+func shortDuration(d time.Duration) string {
+	switch {
+	case d < time.Hour:
+		return strconv.Itoa(int(d.Minutes())) + "m"
+	case d < 48*time.Hour:
+		return strconv.Itoa(int(d.Hours())) + "h"
+	}
+	return strconv.Itoa(int(d.Hours()/24)) + "d"
+}
+
+// ResolveReviewReports deals with every open report of a review at once: dismissing them,
+// hiding the review by rejecting it, or hiding it and banning the session that wrote it from
+// reviewing and reporting. It returns how many reports it resolved.
+func ResolveReviewReports(db *database.DB, reviewID, resolution, actor string) (int, error) {
+	if resolution != ReportDismissed && resolution != ReportHidden && resolution != ReportBanned {
+		return 0, fmt.Errorf("unknown resolution %q", resolution)
+	}
+
+	ctx, cancel := db.Context(database.Write)
+	defer cancel()
+
+	tx, err := db.Pool.Begin(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("error starting transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	var sessionID *string
+	err = tx.QueryRow(ctx, `
+		SELECT session_id::text FROM reviews WHERE id::text = $1 AND deleted_at IS NULL FOR UPDATE
+	`, reviewID).Scan(&sessionID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return 0, notFound("review %s not found", reviewID)
+	}
+	if err != nil {
+		return 0, dbError("finding review", err)
+	}
+
+	if resolution == ReportHidden || resolution == ReportBanned {
+		_, err := tx.Exec(ctx, `
+			UPDATE reviews SET status = $2, moderated_by = $3, moderated_at = NOW() WHERE id = $1
+		`, reviewID, ReviewRejected, actor)
+		if err != nil {
+			return 0, dbError("hiding review", err)
+		}
+	}
+	if resolution == ReportBanned {
+		if sessionID == nil {
+			return 0, conflict("this review wasn't written from a storefront session, so there's nobody to ban")
+		}
+		_, err := tx.Exec(ctx, `
+			UPDATE sessions SET banned_at = COALESCE(banned_at, NOW()), banned_by = $2 WHERE id = $1
+		`, *sessionID, actor)
+		if err != nil {
+			return 0, dbError("banning session", err)
+		}
+	}
+
+	tag, err := tx.Exec(ctx, `
+		UPDATE review_reports SET resolution = $2, resolved_by = $3, resolved_at = NOW()
+		WHERE review_id = $1 AND resolved_at IS NULL
+	`, reviewID, resolution, actor)
+	if err != nil {
+		return 0, dbError("resolving review reports", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return 0, conflict("this review has no open reports")
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return 0, fmt.Errorf("error committing review reports: %w", err)
+	}
+	return int(tag.RowsAffected()), nil
+}
+
+// UnbanSession lets a banned session review and report again
+func UnbanSession(db *database.DB, sessionID string) error {
+	ctx, cancel := db.Context(database.Write)
+	defer cancel()
+
+	tag, err := db.Pool.Exec(ctx, `UPDATE sessions SET banned_at = NULL, banned_by = '' WHERE id = $1`, sessionID)
+	if err != nil {
+		return dbError("unbanning session", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return notFound("session %s not found", sessionID)
+	}
+	return nil
+}
@@ -13,7 +13,7 @@ import (
 
 // SearchCategories searches for categories matching the query
 func SearchCategories(db *database.DB, query string) ([]Category, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	ctx, cancel := db.Context(database.List)
 	defer cancel()
 
 	// Create a search pattern that matches the beginning of words
@@ -22,7 +22,7 @@ func SearchCategories(db *database.DB, query string) ([]Category, error) {
 	sqlQuery := `
 		SELECT id, name, slug, parent_id, created_at
 		FROM categories
-		WHERE LOWER(name) LIKE $1 OR LOWER(slug) LIKE $1
+		WHERE deleted_at IS NULL AND (LOWER(name) LIKE $1 OR LOWER(slug) LIKE $1)
 		ORDER BY name
 	`
 
@@ -48,48 +48,65 @@ func SearchCategories(db *database.DB, query string) ([]Category, error) {
 	return categories, nil
 }
 
-// SearchProducts searches for products matching the query
-func SearchProducts(db *database.DB, query string) ([]Product, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+// SearchProducts searches for products matching every term of the query, or one of its
+// synonyms, leaving out stop words.
+// Archived products are only included when includeArchived is set.
+func SearchProducts(db *database.DB, query string, includeArchived bool) ([]Product, error) {
+	ctx, cancel := db.Context(database.List)
 	defer cancel()
 
-	// Create a search pattern
-	searchPattern := "%" + strings.ToLower(query) + "%"
+	var b queryBuilder
+	b.where("p.deleted_at IS NULL")
+	if !includeArchived {
+		b.where("p.archived_at IS NULL")
+	}
+	if err := b.matchProductSearch(db, query); err != nil {
+		return nil, err
+	}
 
+	return queryProductList(ctx, db, b, "p.name")
+}
+
+// queryProductList runs a product query with the WHERE clause b and the given order, returning
+// the products with their category and variant summary
+func queryProductList(ctx context.Context, db *database.DB, b queryBuilder, orderBy string) ([]Product, error) {
 	sqlQuery := `
 		SELECT p.id, p.category_id, p.name, p.slug, p.description, 
-		       p.price, p.image_urls, p.stock_count, p.is_available, p.has_variants,
-		       p.created_at, p.updated_at,
+		       p.price, p.image_urls, p.image_alt, p.stock_count, p.is_available, p.has_variants,
+		       p.created_at, p.updated_at, p.archived_at, p.backorder, p.preorder, p.expected_at, p.sku, p.cost,
+		       vs.variant_count, vs.min_price, vs.max_price, vs.total_stock,
 		       c.id, c.name, c.slug, c.parent_id, c.created_at
 		FROM products p
-		LEFT JOIN categories c ON p.category_id = c.id
-		WHERE LOWER(p.name) LIKE $1 
-		   OR LOWER(p.slug) LIKE $1 
-		   OR LOWER(p.description) LIKE $1
-		ORDER BY p.name
+		LEFT JOIN categories c ON p.category_id = c.id AND c.deleted_at IS NULL
+		` + variantSummaryJoin + `
+		` + b.whereClause() + `
+		ORDER BY ` + orderBy + `
 	`
 
-	rows, err := db.Pool.Query(ctx, sqlQuery, searchPattern)
+	rows, err := db.Pool.Query(ctx, sqlQuery, b.args...)
 	if err != nil {
-		return nil, fmt.Errorf("error searching products: %w", err)
+		return nil, fmt.Errorf("error querying products: %w", err)
 	}
 	defer rows.Close()
 
 	var products []Product
 	for rows.Next() {
 		var p Product
+		var imageAlt map[string]string
 		// Use nullable types for category fields to handle LEFT JOIN NULLs
 		var catID, catName, catSlug, catParentID *string
 		var catCreatedAt *time.Time
 
 		if err := rows.Scan(
 			&p.ID, &p.CategoryID, &p.Name, &p.Slug, &p.Description,
-			&p.Price, &p.ImageURLs, &p.StockCount, &p.IsAvailable, &p.HasVariants,
-			&p.CreatedAt, &p.UpdatedAt,
+			&p.Price, &p.ImageURLs, &imageAlt, &p.StockCount, &p.IsAvailable, &p.HasVariants,
+			&p.CreatedAt, &p.UpdatedAt, &p.ArchivedAt, &p.Backorder, &p.Preorder, &p.ExpectedAt, &p.SKU, &p.Cost,
+			&p.Summary.Count, &p.Summary.MinPrice, &p.Summary.MaxPrice, &p.Summary.TotalStock,
 			&catID, &catName, &catSlug, &catParentID, &catCreatedAt,
 		); err != nil {
 			return nil, fmt.Errorf("error scanning product row: %w", err)
 		}
+		p.setImages(imageAlt)
 
 		// Only create Category if we have valid category data
 		if catID != nil && *catID != "" {
@@ -119,20 +136,21 @@ func SearchProducts(db *database.DB, query string) ([]Product, error) {
 
 // SearchReviews searches for reviews matching the query
 func SearchReviews(db *database.DB, query string) ([]Review, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	ctx, cancel := db.Context(database.List)
 	defer cancel()
 
 	// Create a search pattern
 	searchPattern := "%" + strings.ToLower(query) + "%"
 
 	sqlQuery := `
-		SELECT r.id, r.product_id, r.session_id, r.rating, r.comment, r.created_at, r.reviewer_name,
+		SELECT r.id, r.product_id, r.session_id, r.rating, r.comment, r.created_at, r.reviewer_name, r.status,
 		       p.id, p.name, p.slug
 		FROM reviews r
 		LEFT JOIN products p ON r.product_id = p.id
-		WHERE LOWER(r.comment) LIKE $1
+		WHERE r.deleted_at IS NULL
+		  AND (LOWER(r.comment) LIKE $1
 		   OR LOWER(p.name) LIKE $1
-		   OR LOWER(r.reviewer_name) LIKE $1
+		   OR LOWER(r.reviewer_name) LIKE $1)
 		ORDER BY r.created_at DESC
 	`
 
@@ -150,7 +168,7 @@ func SearchReviews(db *database.DB, query string) ([]Review, error) {
 		var productID, productName, productSlug string
 
 		if err := rows.Scan(
-			&r.ID, &r.ProductID, &r.SessionID, &r.Rating, &r.Comment, &r.CreatedAt, &r.ReviewerName,
+			&r.ID, &r.ProductID, &r.SessionID, &r.Rating, &r.Comment, &r.CreatedAt, &r.ReviewerName, &r.Status,
 			&productID, &productName, &productSlug,
 		); err != nil {
 			log.Printf("Search scan error: %v", err)
@@ -0,0 +1,183 @@
+package models
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/ngenohkevin/kuiper_admin/internal/database"
+)
+
+// Where a logged search was made
+const (
+	SearchSourceAdmin      = "admin"
+	SearchSourceStorefront = "storefront"
+)
+
+// searchReportLimit is how many terms each list of the search report shows
+const searchReportLimit = 50
+
+// SearchTermStats is how one search term was used over a search report's period
+type SearchTermStats struct {
+	Term           string    `json:"term"`
+	Searches       int       `json:"searches"`
+	AverageResults float64   `json:"average_results"`
+	Clicks         int       `json:"clicks"` // Searches a result was opened from
+	LastSearched   time.Time `json:"last_searched"`
+}
+
+// ClickRate is the percentage of the term's searches a result was opened from
+func (s SearchTermStats) ClickRate() float64 {
+	if s.Searches == 0 {
+		return 0
+	}
+	return float64(s.Clicks) * 100 / float64(s.Searches)
+}
+
+// SearchReport summarises the searches made since Since, from one source or both
+type SearchReport struct {
+	Since       time.Time         `json:"since"`
+	Source      string            `json:"source"` // One of the SearchSource* constants, empty for both
+	Searches    int               `json:"searches"`
+	ZeroResults int               `json:"zero_results"` // Searches that found nothing
+	Top         []SearchTermStats `json:"top"`          // Most searched terms first
+	NoResults   []SearchTermStats `json:"no_results"`   // Terms whose last search found nothing, most searched first
+}
+
+// LogSearch records a search and returns its ID, so a click on one of its results can be added
+// with RecordSearchClick. clickedProductID may be empty, or the product the storefront reports
+// the shopper went on to open. Empty terms aren't logged.
+func LogSearch(db *database.DB, source, term string, results int, clickedProductID string) (string, error) {
+	term = normalizeSearchTerm(term)
+	if term == "" {
+		return "", nil
+	}
+	if runes := []rune(term); len(runes) > 200 {
+		term = string(runes[:200])
+	}
+	// A click on something that isn't a product ID is dropped rather than failing the log
+	var clicked *string
+	if _, err := uuid.Parse(clickedProductID); err == nil {
+		clicked = &clickedProductID
+	}
+
+	ctx, cancel := db.Context(database.Write)
+	defer cancel()
+
+	var id string
+	err := db.Pool.QueryRow(ctx, `
+		INSERT INTO search_queries (source, term, result_count, clicked_product_id)
+		VALUES ($1, $2, $3, (SELECT id FROM products WHERE id = $4))
+		RETURNING id
+	`, source, term, results, clicked).Scan(&id)
+	if err != nil {
+		return "", dbError("logging search", err)
+	}
+	return id, nil
+}
+
+// ReplaceLoggedSearch changes the term and result count of a logged search no result has been
+// opened from, reporting whether there was one to change. The admin's product list searches as
+// the admin types, and this keeps one search from being logged once per pause.
+func ReplaceLoggedSearch(db *database.DB, id, term string, results int) (bool, error) {
+	term = normalizeSearchTerm(term)
+	if runes := []rune(term); len(runes) > 200 {
+		term = string(runes[:200])
+	}
+
+	ctx, cancel := db.Context(database.Write)
+	defer cancel()
+
+	tag, err := db.Pool.Exec(ctx, `
+		UPDATE search_queries SET term = $2, result_count = $3, searched_at = CURRENT_TIMESTAMP
+		WHERE id = $1 AND clicked_product_id IS NULL
+	`, id, term, results)
+	if err != nil {
+		return false, dbError("replacing logged search", err)
+	}
+	return tag.RowsAffected() > 0, nil
+}
+
+// RecordSearchClick records that productID was opened from the results of a logged search.
+// Only the first result opened counts.
+func RecordSearchClick(db *database.DB, searchID, productID string) error {
+	if _, err := uuid.Parse(searchID); err != nil {
+		return nil
+	}
+
+	ctx, cancel := db.Context(database.Write)
+	defer cancel()
+
+	_, err := db.Pool.Exec(ctx, `
+		UPDATE search_queries SET clicked_product_id = $2
+		WHERE id = $1 AND clicked_product_id IS NULL
+	`, searchID, productID)
+	if err != nil {
+		return dbError("recording search click", err)
+	}
+	return nil
+}
+
+// GetSearchReport summarises the searches made since since, from source or from both when
+// source is empty: the most searched terms, and the terms that last found nothing
+func GetSearchReport(db *database.DB, since time.Time, source string) (SearchReport, error) {
+	ctx, cancel := db.Context(database.List)
+	defer cancel()
+
+	report := SearchReport{Since: since, Source: source}
+	err := db.Pool.QueryRow(ctx, `
+		SELECT COUNT(*), COUNT(*) FILTER (WHERE result_count = 0)
+		FROM search_queries
+		WHERE searched_at >= $1 AND ($2 = '' OR source = $2)
+	`, since, source).Scan(&report.Searches, &report.ZeroResults)
+	if err != nil {
+		return report, dbError("counting searches", err)
+	}
+
+	for _, list := range []struct {
+		having string
+		into   *[]SearchTermStats
+	}{
+		{"", &report.Top},
+		{"HAVING (array_agg(result_count ORDER BY searched_at DESC))[1] = 0", &report.NoResults},
+	} {
+		rows, err := db.Pool.Query(ctx, `
+			SELECT term, COUNT(*), AVG(result_count)::float8, COUNT(clicked_product_id), MAX(searched_at)
+			FROM search_queries
+			WHERE searched_at >= $1 AND ($2 = '' OR source = $2)
+			GROUP BY term
+			`+list.having+`
+			ORDER BY COUNT(*) DESC, MAX(searched_at) DESC
+			LIMIT $3
+		`, since, source, searchReportLimit)
+		if err != nil {
+			return report, dbError("getting search terms", err)
+		}
+		for rows.Next() {
+			var s SearchTermStats
+			if err := rows.Scan(&s.Term, &s.Searches, &s.AverageResults, &s.Clicks, &s.LastSearched); err != nil {
+				rows.Close()
+				return report, fmt.Errorf("error scanning search term: %w", err)
+			}
+			*list.into = append(*list.into, s)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return report, fmt.Errorf("error iterating search terms: %w", err)
+		}
+	}
+
+	return report, nil
+}
+
+// PurgeSearchLog deletes the searches logged before before, returning how many
+func PurgeSearchLog(db *database.DB, before time.Time) (int64, error) {
+	ctx, cancel := db.Context(database.Bulk)
+	defer cancel()
+
+	tag, err := db.Pool.Exec(ctx, `DELETE FROM search_queries WHERE searched_at < $1`, before)
+	if err != nil {
+		return 0, dbError("purging search log", err)
+	}
+	return tag.RowsAffected(), nil
+}
@@ -0,0 +1,287 @@
+package models
+
+import (
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/ngenohkevin/kuiper_admin/internal/database"
+)
+
+// SearchSynonym is a group of terms product search treats as the same, e.g. "og" and
+// "original", or a brand and its aliases. Terms are lower case and can be several words.
+type SearchSynonym struct {
+	ID        string    `json:"id"`
+	Terms     []string  `json:"terms"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// searchTuning is the synonyms and stop words applied to product searches
+type searchTuning struct {
+	synonyms  map[string][]string // Each term of each group, to every term it matches
+	stopWords map[string]bool
+	maxWords  int // Words in the longest synonym, how far ahead a query is matched against them
+}
+
+// searchTuningCacheKey is the cache key for the synonyms and stop words
+const searchTuningCacheKey = "search:tuning"
+
+// productSearchColumns are the product columns a search term is looked for in
+var productSearchColumns = []string{"LOWER(p.name)", "LOWER(p.slug)", "LOWER(p.sku)", "LOWER(p.description)"}
+
+// normalizeSearchTerm lower-cases a term and collapses its whitespace
+func normalizeSearchTerm(term string) string {
+	return strings.Join(strings.Fields(strings.ToLower(term)), " ")
+}
+
+// NormalizeSynonymTerms reads a comma-separated synonym group, e.g. "OG, original", into its
+// distinct terms
+func NormalizeSynonymTerms(input string) ([]string, error) {
+	var terms []string
+	for _, term := range strings.Split(input, ",") {
+		term = normalizeSearchTerm(term)
+		if term != "" && !slices.Contains(terms, term) {
+			terms = append(terms, term)
+		}
+	}
+	if len(terms) < 2 {
+		return nil, fmt.Errorf("a synonym group needs at least two different terms")
+	}
+	return terms, nil
+}
+
+// GetSearchSynonyms lists every synonym group, alphabetically by first term
+func GetSearchSynonyms(db *database.DB) ([]SearchSynonym, error) {
+	ctx, cancel := db.Context(database.List)
+	defer cancel()
+
+	rows, err := db.Pool.Query(ctx, `SELECT id, terms, created_at FROM search_synonyms ORDER BY terms[1]`)
+	if err != nil {
+		return nil, dbError("getting search synonyms", err)
+	}
+	defer rows.Close()
+
+	var synonyms []SearchSynonym
+	for rows.Next() {
+		var s SearchSynonym
+		if err := rows.Scan(&s.ID, &s.Terms, &s.CreatedAt); err != nil {
+			return nil, fmt.Errorf("error scanning search synonym: %w", err)
+		}
+		synonyms = append(synonyms, s)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating search synonyms: %w", err)
+	}
+
+	return synonyms, nil
+}
+
+// CreateSearchSynonym saves a group of terms, given comma-separated, that match each other
+func CreateSearchSynonym(db *database.DB, input string) (SearchSynonym, error) {
+	terms, err := NormalizeSynonymTerms(input)
+	if err != nil {
+		return SearchSynonym{}, err
+	}
+
+	ctx, cancel := db.Context(database.Write)
+	defer cancel()
+
+	s := SearchSynonym{Terms: terms}
+	err = db.Pool.QueryRow(ctx, `INSERT INTO search_synonyms (terms) VALUES ($1) RETURNING id, created_at`, terms).Scan(&s.ID, &s.CreatedAt)
+	if err != nil {
+		return SearchSynonym{}, dbError("creating search synonym", err)
+	}
+
+	invalidateSearchTuning(db)
+	return s, nil
+}
+
+// DeleteSearchSynonym removes a synonym group
+func DeleteSearchSynonym(db *database.DB, id string) error {
+	ctx, cancel := db.Context(database.Write)
+	defer cancel()
+
+	tag, err := db.Pool.Exec(ctx, `DELETE FROM search_synonyms WHERE id = $1`, id)
+	if err != nil {
+		return dbError("deleting search synonym", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return notFound("synonym group not found")
+	}
+
+	invalidateSearchTuning(db)
+	return nil
+}
+
+// GetSearchStopWords lists the words left out of searches, alphabetically
+func GetSearchStopWords(db *database.DB) ([]string, error) {
+	ctx, cancel := db.Context(database.List)
+	defer cancel()
+
+	rows, err := db.Pool.Query(ctx, `SELECT word FROM search_stop_words ORDER BY word`)
+	if err != nil {
+		return nil, dbError("getting stop words", err)
+	}
+	defer rows.Close()
+
+	var words []string
+	for rows.Next() {
+		var word string
+		if err := rows.Scan(&word); err != nil {
+			return nil, fmt.Errorf("error scanning stop word: %w", err)
+		}
+		words = append(words, word)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating stop words: %w", err)
+	}
+
+	return words, nil
+}
+
+// SetSearchStopWords replaces the stop words with the words of input, separated by commas or
+// whitespace
+func SetSearchStopWords(db *database.DB, input string) ([]string, error) {
+	var words []string
+	for _, word := range strings.FieldsFunc(strings.ToLower(input), func(r rune) bool { return r == ',' || r == ' ' || r == '\n' || r == '\r' || r == '\t' }) {
+		if len(word) > 50 {
+			return nil, fmt.Errorf("stop word %q is longer than 50 characters", word)
+		}
+		if !slices.Contains(words, word) {
+			words = append(words, word)
+		}
+	}
+	sort.Strings(words)
+
+	ctx, cancel := db.Context(database.Write)
+	defer cancel()
+
+	tx, err := db.Pool.Begin(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("error starting transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	if _, err := tx.Exec(ctx, `DELETE FROM search_stop_words`); err != nil {
+		return nil, dbError("clearing stop words", err)
+	}
+	if _, err := tx.Exec(ctx, `INSERT INTO search_stop_words (word) SELECT unnest($1::text[])`, words); err != nil {
+		return nil, dbError("saving stop words", err)
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return nil, fmt.Errorf("error committing transaction: %w", err)
+	}
+
+	invalidateSearchTuning(db)
+	return words, nil
+}
+
+// invalidateSearchTuning drops the cached synonyms and stop words, and the product lists
+// searched with them
+func invalidateSearchTuning(db *database.DB) {
+	db.Cache.Delete(searchTuningCacheKey)
+	invalidateProductCache(db)
+}
+
+// loadSearchTuning reads the synonyms and stop words, from the cache when it has them
+func loadSearchTuning(db *database.DB) (searchTuning, error) {
+	if cached, found := db.Cache.Get(searchTuningCacheKey); found {
+		if tuning, ok := cached.(searchTuning); ok {
+			return tuning, nil
+		}
+	}
+
+	synonyms, err := GetSearchSynonyms(db)
+	if err != nil {
+		return searchTuning{}, err
+	}
+	stopWords, err := GetSearchStopWords(db)
+	if err != nil {
+		return searchTuning{}, err
+	}
+
+	tuning := searchTuning{synonyms: map[string][]string{}, stopWords: map[string]bool{}, maxWords: 1}
+	for _, group := range synonyms {
+		for _, term := range group.Terms {
+			for _, other := range group.Terms {
+				if !slices.Contains(tuning.synonyms[term], other) {
+					tuning.synonyms[term] = append(tuning.synonyms[term], other)
+				}
+			}
+			tuning.maxWords = max(tuning.maxWords, len(strings.Fields(term)))
+		}
+	}
+	for _, word := range stopWords {
+		tuning.stopWords[word] = true
+	}
+
+	db.Cache.Set(searchTuningCacheKey, tuning, 10*time.Minute)
+	return tuning, nil
+}
+
+// terms splits a search query into the terms a product must match, each with the
+// alternatives that count as a match: the term and its synonyms. Synonyms of several words
+// are matched before the single words in them. Stop words are left out, unless the query is
+// nothing but stop words.
+func (t searchTuning) terms(query string) [][]string {
+	words := strings.Fields(strings.ToLower(query))
+
+	var terms [][]string
+	for i := 0; i < len(words); {
+		n := min(t.maxWords, len(words)-i)
+		for ; n > 1; n-- {
+			if _, ok := t.synonyms[strings.Join(words[i:i+n], " ")]; ok {
+				break
+			}
+		}
+		term := strings.Join(words[i:i+n], " ")
+		i += n
+
+		if alternatives, ok := t.synonyms[term]; ok {
+			terms = append(terms, alternatives)
+		} else if !t.stopWords[term] {
+			terms = append(terms, []string{term})
+		}
+	}
+
+	if len(terms) == 0 {
+		for _, word := range words {
+			terms = append(terms, []string{word})
+		}
+	}
+	return terms
+}
+
+// ExplainSearch shows how a product search for query is matched: one entry per term a product
+// must contain, listing the alternatives that count
+func ExplainSearch(db *database.DB, query string) ([][]string, error) {
+	tuning, err := loadSearchTuning(db)
+	if err != nil {
+		return nil, err
+	}
+	return tuning.terms(query), nil
+}
+
+// matchProductSearch adds a condition for each term of a product search, that one of the
+// product's searched columns contains the term or one of its synonyms
+func (b *queryBuilder) matchProductSearch(db *database.DB, query string) error {
+	terms, err := ExplainSearch(db, query)
+	if err != nil {
+		return err
+	}
+
+	for _, alternatives := range terms {
+		var conditions []string
+		var args []interface{}
+		for _, term := range alternatives {
+			for _, column := range productSearchColumns {
+				conditions = append(conditions, column+" LIKE ?")
+				args = append(args, "%"+term+"%")
+			}
+		}
+		b.where(strings.Join(conditions, " OR "), args...)
+	}
+	return nil
+}
@@ -0,0 +1,442 @@
+package models
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/ngenohkevin/kuiper_admin/internal/database"
+	"github.com/ngenohkevin/kuiper_admin/internal/money"
+)
+
+// maxSegmentNameLength matches the name column
+const maxSegmentNameLength = 100
+
+// maxSegmentDays bounds the "within the last N days" rules at ten years
+const maxSegmentDays = 3650
+
+// Segment is a named set of rules picking out storefront shoppers. Its members are worked out
+// whenever they are asked for, so a segment follows what shoppers do.
+type Segment struct {
+	ID          string       `json:"id"`
+	Name        string       `json:"name"`
+	Description string       `json:"description"`
+	Rules       SegmentRules `json:"rules"`
+	CreatedBy   string       `json:"created_by"`
+	CreatedAt   time.Time    `json:"created_at"`
+	UpdatedAt   time.Time    `json:"updated_at"`
+	MemberCount int64        `json:"member_count"`
+}
+
+// SegmentRules are the conditions a shopper must all meet to be in a segment. A zero rule
+// doesn't apply.
+type SegmentRules struct {
+	SeenWithinDays     int          `json:"seen_within_days,omitempty"`
+	ReviewedWithinDays int          `json:"reviewed_within_days,omitempty"`
+	MinReviews         int          `json:"min_reviews,omitempty"`
+	OrderedWithinDays  int          `json:"ordered_within_days,omitempty"`
+	MinOrders          int          `json:"min_orders,omitempty"`
+	MinSpent           money.Amount `json:"min_spent,omitempty"`
+}
+
+// SegmentMember is a shopper in a segment with the activity the rules look at
+type SegmentMember struct {
+	SessionID      string       `json:"session_id"`
+	ReviewerName   string       `json:"reviewer_name"` // The name on their latest review, if any
+	FirstSeenAt    *time.Time   `json:"first_seen_at"`
+	LastSeenAt     *time.Time   `json:"last_seen_at"`
+	Reviews        int          `json:"reviews"`
+	LastReviewedAt *time.Time   `json:"last_reviewed_at"`
+	Orders         int          `json:"orders"`
+	Spent          money.Amount `json:"spent"`
+	LastOrderedAt  *time.Time   `json:"last_ordered_at"`
+}
+
+// Describe lists the rules in words, e.g. "Reviewed in the last 30 days"
+func (r SegmentRules) Describe() []string {
+	var rules []string
+	if r.SeenWithinDays > 0 {
+		rules = append(rules, fmt.Sprintf("Seen in the last %d days", r.SeenWithinDays))
+	}
+	if r.ReviewedWithinDays > 0 {
+		rules = append(rules, fmt.Sprintf("Reviewed in the last %d days", r.ReviewedWithinDays))
+	}
+	if r.MinReviews > 0 {
+		rules = append(rules, fmt.Sprintf("Wrote at least %d reviews", r.MinReviews))
+	}
+	if r.OrderedWithinDays > 0 {
+		rules = append(rules, fmt.Sprintf("Ordered in the last %d days", r.OrderedWithinDays))
+	}
+	if r.MinOrders > 0 {
+		rules = append(rules, fmt.Sprintf("Placed at least %d orders", r.MinOrders))
+	}
+	if r.MinSpent > 0 {
+		rules = append(rules, "Spent at least "+r.MinSpent.Format())
+	}
+	return rules
+}
+
+// validate checks the rules make sense and that at least one applies
+func (r SegmentRules) validate() error {
+	for _, days := range []int{r.SeenWithinDays, r.ReviewedWithinDays, r.OrderedWithinDays} {
+		if days < 0 || days > maxSegmentDays {
+			return fmt.Errorf("days can't be negative or more than %d", maxSegmentDays)
+		}
+	}
+	if r.MinReviews < 0 || r.MinOrders < 0 || r.MinSpent < 0 {
+		return fmt.Errorf("minimums can't be negative")
+	}
+	if len(r.Describe()) == 0 {
+		return fmt.Errorf("a segment needs at least one rule")
+	}
+	return nil
+}
+
+// args are the rules as the parameters of segmentMembersFrom
+func (r SegmentRules) args() []interface{} {
+	return []interface{}{r.SeenWithinDays, r.ReviewedWithinDays, r.MinReviews, r.OrderedWithinDays, r.MinOrders, r.MinSpent}
+}
+
+// validate tidies the segment's fields and checks them
+func (s *Segment) validate() error {
+	s.Name = strings.TrimSpace(s.Name)
+	s.Description = strings.TrimSpace(s.Description)
+	if s.Name == "" {
+		return fmt.Errorf("name is required")
+	}
+	if len([]rune(s.Name)) > maxSegmentNameLength {
+		return fmt.Errorf("name can be at most %d characters", maxSegmentNameLength)
+	}
+	return s.Rules.validate()
+}
+
+// segmentMembersFrom picks out the sessions meeting a segment's rules, passed as SegmentRules.args
+const segmentMembersFrom = `
+		FROM sessions s
+		LEFT JOIN (
+			SELECT session_id, COUNT(*) AS reviews, MAX(created_at) AS last_reviewed_at,
+			       (array_agg(reviewer_name ORDER BY created_at DESC) FILTER (WHERE reviewer_name IS NOT NULL))[1] AS reviewer_name
+			FROM reviews
+			WHERE deleted_at IS NULL AND session_id IS NOT NULL
+			GROUP BY session_id
+		) rv ON rv.session_id = s.id
+		LEFT JOIN (
+			SELECT session_id, COUNT(*) AS orders, SUM(total) AS spent, MAX(placed_at) AS last_ordered_at
+			FROM storefront_orders
+			GROUP BY session_id
+		) o ON o.session_id = s.id
+		WHERE ($1 = 0 OR s.last_accessed_at >= NOW() - make_interval(days => $1))
+		  AND ($2 = 0 OR rv.last_reviewed_at >= NOW() - make_interval(days => $2))
+		  AND COALESCE(rv.reviews, 0) >= $3
+		  AND ($4 = 0 OR o.last_ordered_at >= NOW() - make_interval(days => $4))
+		  AND COALESCE(o.orders, 0) >= $5
+		  AND COALESCE(o.spent, 0) >= $6`
+
+const segmentMemberColumns = `s.id, COALESCE(rv.reviewer_name, ''), s.created_at, s.last_accessed_at,
+		COALESCE(rv.reviews, 0), rv.last_reviewed_at, COALESCE(o.orders, 0), COALESCE(o.spent, 0), o.last_ordered_at`
+
+const segmentColumns = `id, name, description, rules, created_by, created_at, updated_at`
+
+// scanSegment reads a row selected with segmentColumns
+func scanSegment(row pgx.Row) (Segment, error) {
+	var s Segment
+	var rules []byte
+	if err := row.Scan(&s.ID, &s.Name, &s.Description, &rules, &s.CreatedBy, &s.CreatedAt, &s.UpdatedAt); err != nil {
+		return Segment{}, err
+	}
+	if err := json.Unmarshal(rules, &s.Rules); err != nil {
+		return Segment{}, fmt.Errorf("error reading rules of segment %s: %w", s.ID, err)
+	}
+	return s, nil
+}
+
+// countSegmentMembers counts the shoppers meeting the rules right now
+func countSegmentMembers(ctx context.Context, db *database.DB, rules SegmentRules) (int64, error) {
+	var count int64
+	if err := db.Pool.QueryRow(ctx, `SELECT COUNT(*)`+segmentMembersFrom, rules.args()...).Scan(&count); err != nil {
+		return 0, dbError("counting segment members", err)
+	}
+	return count, nil
+}
+
+// GetSegments lists every segment by name, with how many shoppers are in each
+func GetSegments(db *database.DB) ([]Segment, error) {
+	ctx, cancel := db.Context(database.List)
+	defer cancel()
+
+	rows, err := db.Pool.Query(ctx, `SELECT `+segmentColumns+` FROM customer_segments ORDER BY name`)
+	if err != nil {
+		return nil, dbError("getting segments", err)
+	}
+	defer rows.Close()
+
+	segments := []Segment{}
+	for rows.Next() {
+		s, err := scanSegment(rows)
+		if err != nil {
+			return nil, fmt.Errorf("error scanning segment: %w", err)
+		}
+		segments = append(segments, s)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating segments: %w", err)
+	}
+
+	for i := range segments {
+		if segments[i].MemberCount, err = countSegmentMembers(ctx, db, segments[i].Rules); err != nil {
+			return nil, err
+		}
+	}
+	return segments, nil
+}
+
+// GetSegmentByID retrieves a single segment with how many shoppers are in it
+func GetSegmentByID(db *database.DB, id string) (Segment, error) {
+	ctx, cancel := db.Context(database.Read)
+	defer cancel()
+
+	s, err := scanSegment(db.Pool.QueryRow(ctx, `SELECT `+segmentColumns+` FROM customer_segments WHERE id = $1`, id))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return Segment{}, notFound("segment not found")
+	}
+	if err != nil {
+		return Segment{}, dbError("finding segment", err)
+	}
+
+	if s.MemberCount, err = countSegmentMembers(ctx, db, s.Rules); err != nil {
+		return Segment{}, err
+	}
+	return s, nil
+}
+
+// CreateSegment saves a new segment
+func CreateSegment(db *database.DB, s Segment, actor string) (Segment, error) {
+	if err := s.validate(); err != nil {
+		return Segment{}, err
+	}
+	rules, err := json.Marshal(s.Rules)
+	if err != nil {
+		return Segment{}, fmt.Errorf("error encoding segment rules: %w", err)
+	}
+
+	ctx, cancel := db.Context(database.Write)
+	defer cancel()
+
+	var id string
+	err = db.Pool.QueryRow(ctx, `
+		INSERT INTO customer_segments (name, description, rules, created_by)
+		VALUES ($1, $2, $3, $4)
+		RETURNING id
+	`, s.Name, s.Description, rules, actor).Scan(&id)
+	if err != nil {
+		err = dbError("creating segment", err)
+		if errors.Is(err, ErrConflict) {
+			return Segment{}, conflict("a segment named %q already exists", s.Name)
+		}
+		return Segment{}, err
+	}
+
+	return GetSegmentByID(db, id)
+}
+
+// UpdateSegment saves changes to a segment's name, description and rules
+func UpdateSegment(db *database.DB, s Segment) (Segment, error) {
+	if err := s.validate(); err != nil {
+		return Segment{}, err
+	}
+	rules, err := json.Marshal(s.Rules)
+	if err != nil {
+		return Segment{}, fmt.Errorf("error encoding segment rules: %w", err)
+	}
+
+	ctx, cancel := db.Context(database.Write)
+	defer cancel()
+
+	tag, err := db.Pool.Exec(ctx, `
+		UPDATE customer_segments
+		SET name = $2, description = $3, rules = $4, updated_at = NOW()
+		WHERE id = $1
+	`, s.ID, s.Name, s.Description, rules)
+	if err != nil {
+		err = dbError("updating segment", err)
+		if errors.Is(err, ErrConflict) {
+			return Segment{}, conflict("a segment named %q already exists", s.Name)
+		}
+		return Segment{}, err
+	}
+	if tag.RowsAffected() == 0 {
+		return Segment{}, notFound("segment not found")
+	}
+
+	return GetSegmentByID(db, s.ID)
+}
+
+// DeleteSegment removes a segment. Its shoppers aren't touched.
+func DeleteSegment(db *database.DB, id string) error {
+	ctx, cancel := db.Context(database.Write)
+	defer cancel()
+
+	tag, err := db.Pool.Exec(ctx, `DELETE FROM customer_segments WHERE id = $1`, id)
+	if err != nil {
+		return dbError("deleting segment", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return notFound("segment not found")
+	}
+
+	return nil
+}
+
+// querySegmentMembers selects shoppers meeting the rules, biggest spenders first. A nil limit
+// selects all of them.
+func querySegmentMembers(ctx context.Context, db *database.DB, rules SegmentRules, limit *int, offset int) ([]SegmentMember, error) {
+	args := append(rules.args(), limit, offset)
+	rows, err := db.Pool.Query(ctx, `SELECT `+segmentMemberColumns+segmentMembersFrom+`
+		ORDER BY COALESCE(o.spent, 0) DESC, s.last_accessed_at DESC NULLS LAST, s.id
+		LIMIT $7 OFFSET $8
+	`, args...)
+	if err != nil {
+		return nil, dbError("getting segment members", err)
+	}
+	defer rows.Close()
+
+	members := []SegmentMember{}
+	for rows.Next() {
+		var m SegmentMember
+		if err := rows.Scan(
+			&m.SessionID, &m.ReviewerName, &m.FirstSeenAt, &m.LastSeenAt,
+			&m.Reviews, &m.LastReviewedAt, &m.Orders, &m.Spent, &m.LastOrderedAt,
+		); err != nil {
+			return nil, fmt.Errorf("error scanning segment member: %w", err)
+		}
+		members = append(members, m)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating segment members: %w", err)
+	}
+
+	return members, nil
+}
+
+// GetSegmentMembers retrieves a page of the shoppers in a segment. Only q's page and page size
+// are used.
+func GetSegmentMembers(db *database.DB, segment Segment, q ListQuery) (PaginatedResult[SegmentMember], error) {
+	ctx, cancel := db.Context(database.List)
+	defer cancel()
+
+	offset := q.offset()
+	members, err := querySegmentMembers(ctx, db, segment.Rules, &q.PageSize, offset)
+	if err != nil {
+		return PaginatedResult[SegmentMember]{}, err
+	}
+
+	return newPage(members, segment.MemberCount, q), nil
+}
+
+// OrderItem is one line of a storefront order: quantity units of a product, or of one of its
+// variants, sold at unit_price each. unit_cost is what one unit cost the store, when the
+// storefront knows; otherwise the product's cost is used.
+type OrderItem struct {
+	ProductID string        `json:"product_id"`
+	VariantID string        `json:"variant_id"`
+	Quantity  int           `json:"quantity"`
+	UnitPrice money.Amount  `json:"unit_price"`
+	UnitCost  *money.Amount `json:"unit_cost"`
+}
+
+// sessionIDForToken finds the storefront session holding token
+func sessionIDForToken(ctx context.Context, db *database.DB, token string) (string, error) {
+	var sessionID string
+	err := db.Pool.QueryRow(ctx, `SELECT id FROM sessions WHERE token = $1`, token).Scan(&sessionID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return "", notFound("unknown session")
+	}
+	if err != nil {
+		return "", dbError("finding session", err)
+	}
+	return sessionID, nil
+}
+
+// RecordStorefrontOrder stores an order the storefront placed for the shopper holding
+// sessionToken, with its lines, so segments can pick out shoppers by what they ordered and the
+// profitability report can tell what sold. The customer's email, when given, is where status
+// emails go. An order already recorded is left as it is.
+func RecordStorefrontOrder(db *database.DB, orderID, sessionToken string, customer OrderCustomer, total money.Amount, placedAt time.Time, items []OrderItem) error {
+	orderID = strings.TrimSpace(orderID)
+	if orderID == "" {
+		return fmt.Errorf("order id is required")
+	}
+	if len(orderID) > 255 {
+		return fmt.Errorf("order id can be at most 255 characters")
+	}
+	if total < 0 {
+		return fmt.Errorf("order total can't be negative")
+	}
+	if err := customer.normalize(); err != nil {
+		return err
+	}
+	for i, item := range items {
+		if item.ProductID == "" || item.Quantity <= 0 || item.UnitPrice < 0 || (item.UnitCost != nil && *item.UnitCost < 0) {
+			return fmt.Errorf("item %d needs a product_id, a positive quantity and a unit_price that isn't negative", i+1)
+		}
+	}
+	if placedAt.IsZero() {
+		placedAt = time.Now()
+	}
+	var address *string
+	if customer.ShippingAddress != nil {
+		encoded, err := json.Marshal(customer.ShippingAddress)
+		if err != nil {
+			return fmt.Errorf("error encoding shipping address: %w", err)
+		}
+		encodedAddress := string(encoded)
+		address = &encodedAddress
+	}
+
+	ctx, cancel := db.Context(database.Write)
+	defer cancel()
+
+	sessionID, err := sessionIDForToken(ctx, db, sessionToken)
+	if err != nil {
+		return err
+	}
+
+	tx, err := db.Pool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("error starting transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	tag, err := tx.Exec(ctx, `
+		INSERT INTO storefront_orders (id, session_id, total, placed_at, customer_email, customer_name, shipping_address)
+		VALUES ($1, $2, $3, $4, $5, $6, $7::jsonb)
+		ON CONFLICT (id) DO NOTHING
+	`, orderID, sessionID, total, placedAt, customer.Email, customer.Name, address)
+	if err != nil {
+		return dbError("recording order", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return nil
+	}
+
+	for _, item := range items {
+		_, err := tx.Exec(ctx, `
+			INSERT INTO storefront_order_items (order_id, product_id, product_name, variant_id, quantity, unit_price, unit_cost)
+			SELECT $1, $2, COALESCE(p.name, ''), $3, $4, $5, COALESCE($6, p.cost)
+			FROM (SELECT 1) AS one
+			LEFT JOIN products p ON p.id = $2
+		`, orderID, item.ProductID, item.VariantID, item.Quantity, item.UnitPrice, item.UnitCost)
+		if err != nil {
+			return dbError("recording order item", err)
+		}
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("error committing order: %w", err)
+	}
+	return nil
+}
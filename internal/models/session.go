@@ -1,7 +1,6 @@
 package models
 
 import (
-	"context"
 	"database/sql"
 	"encoding/json"
 	"errors"
@@ -23,7 +22,7 @@ type Session struct {
 
 // GetAllSessions retrieves all sessions from the database
 func GetAllSessions(db *database.DB) ([]Session, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	ctx, cancel := db.Context(database.List)
 	defer cancel()
 
 	query := `
@@ -54,9 +53,70 @@ func GetAllSessions(db *database.DB) ([]Session, error) {
 	return sessions, nil
 }
 
+// SessionSorts are the orders the session list can be sorted in
+var SessionSorts = SortOptions{
+	Columns: map[string]string{
+		"created":       "created_at",
+		"expires":       "expires_at",
+		"last_accessed": "last_accessed_at",
+	},
+	Default: "-created",
+}
+
+// GetSessionsPaginated retrieves a page of sessions whose ID or token matches the search.
+// q.Filter is "active" or "expired", or empty for every session.
+func GetSessionsPaginated(db *database.DB, q ListQuery) (PaginatedResult[Session], error) {
+	ctx, cancel := db.Context(database.List)
+	defer cancel()
+
+	offset := q.offset()
+	var b queryBuilder
+	if q.Search != "" {
+		pattern := "%" + q.Search + "%"
+		b.where("id::text ILIKE ? OR token ILIKE ?", pattern, pattern)
+	}
+	switch q.Filter {
+	case "active":
+		b.where("expires_at IS NULL OR expires_at > NOW()")
+	case "expired":
+		b.where("expires_at <= NOW()")
+	}
+	where := " FROM sessions " + b.whereClause()
+
+	var totalCount int64
+	if err := db.Pool.QueryRow(ctx, "SELECT COUNT(*)"+where, b.args...).Scan(&totalCount); err != nil {
+		return PaginatedResult[Session]{}, fmt.Errorf("error counting sessions: %w", err)
+	}
+
+	query := `SELECT id, token, data, created_at, expires_at, last_accessed_at` + where + `
+		ORDER BY ` + SessionSorts.orderBy(q.Sort, "id") + `
+		LIMIT ` + b.arg(q.PageSize) + ` OFFSET ` + b.arg(offset)
+
+	rows, err := db.Pool.Query(ctx, query, b.args...)
+	if err != nil {
+		return PaginatedResult[Session]{}, fmt.Errorf("error querying sessions: %w", err)
+	}
+	defer rows.Close()
+
+	var sessions []Session
+	for rows.Next() {
+		var s Session
+		if err := rows.Scan(&s.ID, &s.Token, &s.Data, &s.CreatedAt, &s.ExpiresAt, &s.LastAccessedAt); err != nil {
+			return PaginatedResult[Session]{}, fmt.Errorf("error scanning session row: %w", err)
+		}
+		sessions = append(sessions, s)
+	}
+
+	if err := rows.Err(); err != nil {
+		return PaginatedResult[Session]{}, fmt.Errorf("error iterating session rows: %w", err)
+	}
+
+	return newPage(sessions, totalCount, q), nil
+}
+
 // GetSessionByID retrieves a single session by ID
 func GetSessionByID(db *database.DB, id string) (Session, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	ctx, cancel := db.Context(database.Read)
 	defer cancel()
 
 	query := `
@@ -70,7 +130,7 @@ func GetSessionByID(db *database.DB, id string) (Session, error) {
 		&s.ID, &s.Token, &s.Data, &s.CreatedAt, &s.ExpiresAt, &s.LastAccessedAt,
 	)
 	if err != nil {
-		return Session{}, fmt.Errorf("error finding session: %w", err)
+		return Session{}, dbError("finding session", err)
 	}
 
 	return s, nil
@@ -78,7 +138,7 @@ func GetSessionByID(db *database.DB, id string) (Session, error) {
 
 // UpdateSession updates an existing session in the database
 func UpdateSession(db *database.DB, id, token string, data json.RawMessage, expiresAt time.Time) (Session, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	ctx, cancel := db.Context(database.Write)
 	defer cancel()
 
 	query := `
@@ -93,15 +153,16 @@ func UpdateSession(db *database.DB, id, token string, data json.RawMessage, expi
 		&s.ID, &s.Token, &s.Data, &s.CreatedAt, &s.ExpiresAt, &s.LastAccessedAt,
 	)
 	if err != nil {
-		return Session{}, fmt.Errorf("error updating session: %w", err)
+		return Session{}, dbError("updating session", err)
 	}
 
 	return s, nil
 }
 
-// DeleteSession deletes a session from the database
+// DeleteSession deletes a session from the database. Sessions reviews were left under or that
+// placed orders are refused, so neither is lost with them.
 func DeleteSession(db *database.DB, id string) error {
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	ctx, cancel := db.Context(database.Write)
 	defer cancel()
 
 	// Check if there are any reviews referencing this session
@@ -112,21 +173,58 @@ func DeleteSession(db *database.DB, id string) error {
 	}
 
 	if count > 0 {
-		return fmt.Errorf("cannot delete session: it is referenced by %d reviews", count)
+		return conflict("cannot delete session: it is referenced by %d reviews", count)
+	}
+
+	if err := db.Pool.QueryRow(ctx, "SELECT COUNT(*) FROM storefront_orders WHERE session_id = $1", id).Scan(&count); err != nil {
+		return dbError("checking orders placed in this session", err)
+	}
+	if count > 0 {
+		return conflict("cannot delete session: it placed %d orders", count)
 	}
 
 	// Delete the session
-	_, err = db.Pool.Exec(ctx, "DELETE FROM sessions WHERE id = $1", id)
+	tag, err := db.Pool.Exec(ctx, "DELETE FROM sessions WHERE id = $1", id)
 	if err != nil {
-		return fmt.Errorf("error deleting session: %w", err)
+		return dbError("deleting session", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return notFound("session %s not found", id)
 	}
 
 	return nil
 }
 
+// PurgeExpiredSessions deletes the sessions that have expired and returns how many. Sessions
+// reviews were left under or that placed storefront orders are kept, as DeleteSession keeps
+// them. With dryRun it only counts them.
+func PurgeExpiredSessions(db *database.DB, dryRun bool) (int64, error) {
+	ctx, cancel := db.Context(database.Bulk)
+	defer cancel()
+
+	where := `
+		WHERE s.expires_at < NOW()
+		  AND NOT EXISTS (SELECT 1 FROM reviews r WHERE r.session_id = s.id)
+		  AND NOT EXISTS (SELECT 1 FROM storefront_orders o WHERE o.session_id = s.id)
+	`
+	if dryRun {
+		var count int64
+		if err := db.Pool.QueryRow(ctx, "SELECT COUNT(*) FROM sessions s"+where).Scan(&count); err != nil {
+			return 0, dbError("counting expired sessions", err)
+		}
+		return count, nil
+	}
+
+	tag, err := db.Pool.Exec(ctx, "DELETE FROM sessions s"+where)
+	if err != nil {
+		return 0, dbError("purging expired sessions", err)
+	}
+	return tag.RowsAffected(), nil
+}
+
 // SearchSessions searches for sessions by token or ID
 func SearchSessions(db *database.DB, searchQuery string) ([]Session, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	ctx, cancel := db.Context(database.List)
 	defer cancel()
 
 	query := `
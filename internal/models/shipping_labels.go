@@ -0,0 +1,280 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/ngenohkevin/kuiper_admin/internal/database"
+	"github.com/ngenohkevin/kuiper_admin/internal/shipping"
+)
+
+// labelTrackingDays is how long after a label is bought its parcel is tracked, in case the
+// carrier never reports it delivered
+const labelTrackingDays = 60
+
+// labelPurchaseTimeout is how long a label purchase holds its order before another may start, in
+// case it was cut off before it finished
+const labelPurchaseTimeout = 2 * time.Minute
+
+// ShippingLabel is a postage label bought for an order, with where its parcel has got to
+type ShippingLabel struct {
+	ID                string     `json:"id"`
+	OrderID           string     `json:"order_id"`
+	Provider          string     `json:"provider"` // One of the shipping.Provider* constants
+	Carrier           string     `json:"carrier"`
+	CarrierCode       string     `json:"carrier_code"`
+	Service           string     `json:"service"`
+	TrackingNumber    string     `json:"tracking_number"`
+	LabelURL          string     `json:"label_url"`
+	Cost              string     `json:"cost"` // Decimal, in Currency, which may not be the store's
+	Currency          string     `json:"currency"`
+	ShipmentID        string     `json:"shipment_id"`
+	TrackingStatus    string     `json:"tracking_status"` // One of the shipping.Status* constants
+	TrackingDetail    string     `json:"tracking_detail"`
+	TrackingCheckedAt *time.Time `json:"tracking_checked_at,omitempty"` // Nil until the tracking job first reads it
+	CreatedBy         string     `json:"created_by"`
+	CreatedAt         time.Time  `json:"created_at"`
+}
+
+// Shippable says why no label can be bought for an order, or nil when one can
+func (o Order) Shippable() error {
+	switch o.Status {
+	case OrderDelivered, OrderCancelled, OrderRefunded:
+		return conflict("order %s is %s, so it can't be shipped", o.ID, o.Status)
+	}
+	if o.ShippingAddress == nil {
+		return fmt.Errorf("the storefront didn't send a shipping address for order %s", o.ID)
+	}
+	return nil
+}
+
+const shippingLabelColumns = `id, order_id, provider, carrier, carrier_code, service, tracking_number, label_url,
+	COALESCE(cost::text, ''), currency, shipment_id, tracking_status, tracking_detail, tracking_checked_at,
+	created_by, created_at`
+
+// scanShippingLabel reads a row selected with shippingLabelColumns
+func scanShippingLabel(row pgx.Row) (ShippingLabel, error) {
+	var l ShippingLabel
+	err := row.Scan(&l.ID, &l.OrderID, &l.Provider, &l.Carrier, &l.CarrierCode, &l.Service, &l.TrackingNumber, &l.LabelURL,
+		&l.Cost, &l.Currency, &l.ShipmentID, &l.TrackingStatus, &l.TrackingDetail, &l.TrackingCheckedAt,
+		&l.CreatedBy, &l.CreatedAt)
+	return l, err
+}
+
+// StartLabelPurchase claims an order for buying a label, so a double submit or a second click
+// can't buy and pay for another while the first is with the provider. An order that already has
+// a label is refused unless another is asked for. The claim ends when RecordShippingLabel
+// records the label or EndLabelPurchase gives up on it.
+func StartLabelPurchase(db *database.DB, orderID string, another bool) error {
+	ctx, cancel := db.Context(database.Write)
+	defer cancel()
+
+	var bought bool
+	err := db.Pool.QueryRow(ctx, `
+		SELECT EXISTS (SELECT 1 FROM shipping_labels WHERE order_id = $1)
+	`, orderID).Scan(&bought)
+	if err != nil {
+		return dbError("checking shipping labels", err)
+	}
+	if bought && !another {
+		return conflict("order %s already has a label; confirm to buy another", orderID)
+	}
+
+	tag, err := db.Pool.Exec(ctx, `
+		UPDATE storefront_orders SET label_purchase_started_at = CURRENT_TIMESTAMP
+		WHERE id = $1
+		  AND (label_purchase_started_at IS NULL OR label_purchase_started_at < CURRENT_TIMESTAMP - make_interval(secs => $2))
+	`, orderID, labelPurchaseTimeout.Seconds())
+	if err != nil {
+		return dbError("starting label purchase", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return conflict("a label is already being bought for order %s", orderID)
+	}
+	return nil
+}
+
+// EndLabelPurchase lets go of an order claimed by StartLabelPurchase whose label wasn't bought
+func EndLabelPurchase(db *database.DB, orderID string) error {
+	ctx, cancel := db.Context(database.Write)
+	defer cancel()
+
+	if _, err := db.Pool.Exec(ctx, `UPDATE storefront_orders SET label_purchase_started_at = NULL WHERE id = $1`, orderID); err != nil {
+		return dbError("ending label purchase", err)
+	}
+	return nil
+}
+
+// labelCost is the cost a provider reported for a label as a decimal, or empty when it isn't one,
+// so a label already paid for is recorded even if the provider's figure can't be
+func labelCost(amount string) string {
+	amount = strings.TrimSpace(amount)
+	if f, err := strconv.ParseFloat(amount, 64); err != nil || f < 0 || f >= 1e10 {
+		return ""
+	}
+	return amount
+}
+
+// labelCurrency is a label's ISO currency code, or empty when the provider didn't send one
+func labelCurrency(currency string) string {
+	currency = strings.ToUpper(strings.TrimSpace(currency))
+	if len(currency) != 3 {
+		return ""
+	}
+	return currency
+}
+
+// RecordShippingLabel stores a label bought from provider for an order, and makes its carrier and
+// tracking number the order's, so the shipped notification and the pick list use them. It ends
+// the order's label purchase.
+func RecordShippingLabel(db *database.DB, orderID, provider string, label shipping.Label, actor string) (ShippingLabel, error) {
+	if label.TrackingNumber == "" {
+		return ShippingLabel{}, fmt.Errorf("the label %s sold has no tracking number", provider)
+	}
+	carrier := label.Carrier
+	if len(carrier) > maxCarrierLength {
+		carrier = carrier[:maxCarrierLength]
+	}
+
+	ctx, cancel := db.Context(database.Write)
+	defer cancel()
+
+	tx, err := db.Pool.Begin(ctx)
+	if err != nil {
+		return ShippingLabel{}, fmt.Errorf("error starting transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	tag, err := tx.Exec(ctx, `
+		UPDATE storefront_orders SET carrier = $2, tracking_number = $3, label_purchase_started_at = NULL WHERE id = $1
+	`, orderID, carrier, label.TrackingNumber)
+	if err != nil {
+		return ShippingLabel{}, dbError("updating order tracking number", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return ShippingLabel{}, notFound("order %s not found", orderID)
+	}
+
+	saved, err := scanShippingLabel(tx.QueryRow(ctx, `
+		INSERT INTO shipping_labels (order_id, provider, carrier, carrier_code, service, tracking_number, label_url,
+		                             cost, currency, shipment_id, created_by)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, NULLIF($8, '')::numeric, $9, $10, $11)
+		RETURNING `+shippingLabelColumns,
+		orderID, provider, carrier, label.CarrierCode, label.Service, label.TrackingNumber, label.LabelURL,
+		labelCost(label.Amount), labelCurrency(label.Currency), label.ShipmentID, actor))
+	if err != nil {
+		return ShippingLabel{}, dbError("recording shipping label", err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return ShippingLabel{}, fmt.Errorf("error committing shipping label: %w", err)
+	}
+	return saved, nil
+}
+
+// GetShippingLabels lists the labels bought for an order, newest first
+func GetShippingLabels(db *database.DB, orderID string) ([]ShippingLabel, error) {
+	return queryShippingLabels(db, "getting shipping labels", `
+		SELECT `+shippingLabelColumns+`
+		FROM shipping_labels
+		WHERE order_id = $1
+		ORDER BY created_at DESC
+	`, orderID)
+}
+
+// DueTrackedLabels returns up to limit labels whose parcels are still moving and weren't tracked
+// in the last interval, least recently tracked first. Labels older than labelTrackingDays are
+// left alone.
+func DueTrackedLabels(db *database.DB, interval time.Duration, limit int) ([]ShippingLabel, error) {
+	return queryShippingLabels(db, "getting labels to track", `
+		SELECT `+shippingLabelColumns+`
+		FROM shipping_labels
+		WHERE tracking_status NOT IN ($1, $2, $3)
+		  AND (tracking_checked_at IS NULL OR tracking_checked_at <= CURRENT_TIMESTAMP - make_interval(secs => $4))
+		  AND created_at > CURRENT_TIMESTAMP - make_interval(days => $5)
+		ORDER BY tracking_checked_at NULLS FIRST
+		LIMIT $6
+	`, shipping.StatusDelivered, shipping.StatusReturned, shipping.StatusFailure, interval.Seconds(), labelTrackingDays, limit)
+}
+
+// queryShippingLabels runs a query selecting shippingLabelColumns
+func queryShippingLabels(db *database.DB, action, query string, args ...interface{}) ([]ShippingLabel, error) {
+	ctx, cancel := db.Context(database.List)
+	defer cancel()
+
+	rows, err := db.Pool.Query(ctx, query, args...)
+	if err != nil {
+		return nil, dbError(action, err)
+	}
+	defer rows.Close()
+
+	labels := []ShippingLabel{}
+	for rows.Next() {
+		l, err := scanShippingLabel(rows)
+		if err != nil {
+			return nil, fmt.Errorf("error scanning shipping label: %w", err)
+		}
+		labels = append(labels, l)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating shipping labels: %w", err)
+	}
+	return labels, nil
+}
+
+// UpdateLabelTracking records where a label's parcel has got to. A new status goes on the order's
+// timeline, and a parcel delivered for an order still marked shipped marks the order delivered,
+// queueing the customer notifications the delivered template turns on.
+func UpdateLabelTracking(db *database.DB, label ShippingLabel, t shipping.Tracking) error {
+	ctx, cancel := db.Context(database.Write)
+	defer cancel()
+
+	var orderStatus string
+	err := db.Pool.QueryRow(ctx, `
+		UPDATE shipping_labels l
+		SET tracking_status = $2, tracking_detail = $3, tracking_checked_at = CURRENT_TIMESTAMP
+		FROM storefront_orders o
+		WHERE l.id = $1 AND o.id = l.order_id
+		RETURNING o.status
+	`, label.ID, t.Status, t.Detail).Scan(&orderStatus)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return notFound("shipping label %s not found", label.ID)
+	}
+	if err != nil {
+		return dbError("updating label tracking", err)
+	}
+	if t.Status == label.TrackingStatus {
+		return nil
+	}
+
+	summary := label.Carrier + " " + label.TrackingNumber + ": " + strings.ReplaceAll(t.Status, "_", " ")
+	if t.Detail != "" {
+		summary += " · " + t.Detail
+	}
+	if n := len(t.Events); n > 0 && t.Events[n-1].Location != "" {
+		summary += " (" + t.Events[n-1].Location + ")"
+	}
+	events := []ActivityEvent{{EntityType: ActivityOrder, EntityID: label.OrderID, Action: ActivityTracking, Summary: summary}}
+
+	if t.Status == shipping.StatusDelivered && orderStatus == OrderShipped {
+		_, queued, err := SetOrderStatus(db, label.OrderID, OrderDelivered, true, "")
+		if err != nil {
+			return err
+		}
+		summary := "Marked delivered when the carrier reported the parcel delivered"
+		if len(queued) > 0 {
+			summary += "; customer notifications were queued"
+		}
+		events = append(events, ActivityEvent{EntityType: ActivityOrder, EntityID: label.OrderID, Action: ActivityStatusChanged, Summary: summary})
+	}
+
+	if err := RecordActivity(db, events...); err != nil {
+		log.Printf("Error recording tracking of order %s: %v", label.OrderID, err)
+	}
+	return nil
+}
@@ -0,0 +1,149 @@
+package models
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/ngenohkevin/kuiper_admin/internal/database"
+)
+
+// Reasons recorded on stock movements
+const (
+	MovementManual       = "manual"        // Adjusted by an admin, e.g. on the quick stock page
+	MovementWMSSync      = "wms_sync"      // Corrected to match the external warehouse system
+	MovementIntegrityFix = "integrity_fix" // Negative stock reset from the variant report
+	MovementShipped      = "shipped"       // Picked and packed for an order
+)
+
+// StockChange describes why a stock adjustment is being made; it is stored with the movement
+type StockChange struct {
+	Reason string // One of the Movement* constants
+	Note   string
+	Actor  string // Admin username, empty for automated changes
+}
+
+// StockMovement is one recorded change to a product or variant stock count
+type StockMovement struct {
+	ID          string    `json:"id"`
+	ProductID   string    `json:"product_id"`
+	ProductName string    `json:"product_name,omitempty"`
+	VariantID   string    `json:"variant_id,omitempty"` // Empty for the product's own stock
+	Delta       int       `json:"delta"`
+	StockAfter  int       `json:"stock_after"`
+	Reason      string    `json:"reason"`
+	Note        string    `json:"note,omitempty"`
+	Actor       string    `json:"actor,omitempty"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// StockLevel is the current stock of a product, or of one variant when VariantID is set
+type StockLevel struct {
+	ProductID  string `json:"product_id"`
+	VariantID  string `json:"variant_id,omitempty"`
+	StockCount int    `json:"stock_count"`
+}
+
+// Key identifies the product or variant a level belongs to
+func (l StockLevel) Key() string {
+	return l.ProductID + "/" + l.VariantID
+}
+
+// recordStockMovement stores a movement inside the adjusting transaction. No-op changes aren't recorded.
+func recordStockMovement(ctx context.Context, tx pgx.Tx, productID, variantID string, delta, stockAfter int, change StockChange) error {
+	if delta == 0 {
+		return nil
+	}
+
+	_, err := tx.Exec(ctx, `
+		INSERT INTO stock_movements (product_id, variant_id, delta, stock_after, reason, note, actor)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+	`, productID, variantID, delta, stockAfter, change.Reason, change.Note, change.Actor)
+	if err != nil {
+		return fmt.Errorf("error recording stock movement: %w", err)
+	}
+
+	return nil
+}
+
+// GetStockLevels returns the stock of every live product without variants and of every variant
+func GetStockLevels(db *database.DB) ([]StockLevel, error) {
+	ctx, cancel := db.Context(database.List)
+	defer cancel()
+
+	query := `
+		SELECT p.id, '' AS variant_id, p.stock_count
+		FROM products p
+		WHERE p.deleted_at IS NULL AND NOT COALESCE(p.has_variants, false)
+		UNION ALL
+		SELECT p.id, v->>'id', COALESCE((v->>'stock_count')::int, 0)
+		FROM products p
+		CROSS JOIN LATERAL jsonb_array_elements(
+			CASE WHEN jsonb_typeof(p.variants) = 'array' THEN p.variants ELSE '[]'::jsonb END
+		) AS v
+		WHERE p.deleted_at IS NULL AND COALESCE(p.has_variants, false)
+		ORDER BY 1, 2
+	`
+
+	rows, err := db.Pool.Query(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("error querying stock levels: %w", err)
+	}
+	defer rows.Close()
+
+	var levels []StockLevel
+	for rows.Next() {
+		var l StockLevel
+		if err := rows.Scan(&l.ProductID, &l.VariantID, &l.StockCount); err != nil {
+			return nil, fmt.Errorf("error scanning stock level: %w", err)
+		}
+		levels = append(levels, l)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating stock levels: %w", err)
+	}
+
+	return levels, nil
+}
+
+// GetStockMovements lists the most recent movements, optionally only those with the given reason
+func GetStockMovements(db *database.DB, reason string, limit int) ([]StockMovement, error) {
+	ctx, cancel := db.Context(database.List)
+	defer cancel()
+
+	query := `
+		SELECT m.id, m.product_id, p.name, m.variant_id, m.delta, m.stock_after,
+		       m.reason, m.note, m.actor, m.created_at
+		FROM stock_movements m
+		JOIN products p ON p.id = m.product_id
+		WHERE ($1 = '' OR m.reason = $1)
+		ORDER BY m.created_at DESC
+		LIMIT $2
+	`
+
+	rows, err := db.Pool.Query(ctx, query, reason, limit)
+	if err != nil {
+		return nil, fmt.Errorf("error querying stock movements: %w", err)
+	}
+	defer rows.Close()
+
+	var movements []StockMovement
+	for rows.Next() {
+		var m StockMovement
+		if err := rows.Scan(
+			&m.ID, &m.ProductID, &m.ProductName, &m.VariantID, &m.Delta, &m.StockAfter,
+			&m.Reason, &m.Note, &m.Actor, &m.CreatedAt,
+		); err != nil {
+			return nil, fmt.Errorf("error scanning stock movement: %w", err)
+		}
+		movements = append(movements, m)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating stock movements: %w", err)
+	}
+
+	return movements, nil
+}
@@ -0,0 +1,89 @@
+package models
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/ngenohkevin/kuiper_admin/internal/database"
+)
+
+// StockSyncRun records one reconciliation with the external warehouse system
+type StockSyncRun struct {
+	ID            string     `json:"id"`
+	Mode          string     `json:"mode"`
+	StartedAt     time.Time  `json:"started_at"`
+	FinishedAt    *time.Time `json:"finished_at,omitempty"`
+	Checked       int        `json:"checked"`       // Levels compared or pushed
+	Discrepancies int        `json:"discrepancies"` // Levels corrected to match the warehouse
+	Unmatched     int        `json:"unmatched"`     // Warehouse levels for unknown products or variants
+	Error         string     `json:"error,omitempty"`
+}
+
+// StartStockSyncRun records the start of a sync run and returns it
+func StartStockSyncRun(db *database.DB, mode string) (StockSyncRun, error) {
+	ctx, cancel := db.Context(database.Write)
+	defer cancel()
+
+	run := StockSyncRun{Mode: mode}
+	err := db.Pool.QueryRow(ctx, `
+		INSERT INTO stock_sync_runs (mode) VALUES ($1)
+		RETURNING id, started_at
+	`, mode).Scan(&run.ID, &run.StartedAt)
+	if err != nil {
+		return StockSyncRun{}, fmt.Errorf("error starting stock sync run: %w", err)
+	}
+
+	return run, nil
+}
+
+// FinishStockSyncRun stores the outcome of a sync run
+func FinishStockSyncRun(db *database.DB, run StockSyncRun) error {
+	ctx, cancel := db.Context(database.Write)
+	defer cancel()
+
+	_, err := db.Pool.Exec(ctx, `
+		UPDATE stock_sync_runs
+		SET finished_at = NOW(), checked = $2, discrepancies = $3, unmatched = $4, error = $5
+		WHERE id = $1
+	`, run.ID, run.Checked, run.Discrepancies, run.Unmatched, run.Error)
+	if err != nil {
+		return fmt.Errorf("error finishing stock sync run: %w", err)
+	}
+
+	return nil
+}
+
+// GetStockSyncRuns lists the most recent sync runs
+func GetStockSyncRuns(db *database.DB, limit int) ([]StockSyncRun, error) {
+	ctx, cancel := db.Context(database.List)
+	defer cancel()
+
+	rows, err := db.Pool.Query(ctx, `
+		SELECT id, mode, started_at, finished_at, checked, discrepancies, unmatched, error
+		FROM stock_sync_runs
+		ORDER BY started_at DESC
+		LIMIT $1
+	`, limit)
+	if err != nil {
+		return nil, fmt.Errorf("error querying stock sync runs: %w", err)
+	}
+	defer rows.Close()
+
+	var runs []StockSyncRun
+	for rows.Next() {
+		var run StockSyncRun
+		if err := rows.Scan(
+			&run.ID, &run.Mode, &run.StartedAt, &run.FinishedAt,
+			&run.Checked, &run.Discrepancies, &run.Unmatched, &run.Error,
+		); err != nil {
+			return nil, fmt.Errorf("error scanning stock sync run: %w", err)
+		}
+		runs = append(runs, run)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating stock sync runs: %w", err)
+	}
+
+	return runs, nil
+}
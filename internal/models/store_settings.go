@@ -0,0 +1,140 @@
+package models
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"net/mail"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/ngenohkevin/kuiper_admin/internal/database"
+)
+
+// StoreSettings holds the settings that apply to the whole store rather than to one admin
+type StoreSettings struct {
+	StorefrontURL string     `json:"storefront_url"` // The public store's base URL, empty until set
+	PreviewSecret string     `json:"-"`              // Signs preview links to unpublished products
+	WebhookSecret string     `json:"-"`              // Signs a tenant's storefront webhooks; the main store uses STOREFRONT_WEBHOOK_SECRET
+	NotifyURL     string     `json:"notify_url"`     // Where a tenant's order events go; the main store uses STOREFRONT_NOTIFY_URL
+	MailFrom      string     `json:"mail_from"`      // Sender of a tenant's customer emails; the main store uses MAIL_FROM
+	UpdatedAt     *time.Time `json:"updated_at,omitempty"`
+}
+
+// storeSettingsCacheKey is the cache key for the store settings
+const storeSettingsCacheKey = "settings:store"
+
+// NormalizeStorefrontURL checks a storefront base URL and returns it without a trailing
+// slash. An empty URL is allowed and turns the storefront links off.
+func NormalizeStorefrontURL(raw string) (string, error) {
+	raw = strings.TrimRight(strings.TrimSpace(raw), "/")
+	if raw == "" {
+		return "", nil
+	}
+	u, err := url.Parse(raw)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return "", fmt.Errorf("storefront URL must be a full http or https address, such as https://shop.example.com")
+	}
+	if u.RawQuery != "" || u.Fragment != "" {
+		return "", fmt.Errorf("storefront URL can't have a query or fragment")
+	}
+	return raw, nil
+}
+
+// normalizeNotifyURL checks the URL order events are posted to. An empty URL turns them off.
+func normalizeNotifyURL(raw string) (string, error) {
+	raw = strings.TrimSpace(raw)
+	if raw == "" {
+		return "", nil
+	}
+	u, err := url.Parse(raw)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return "", fmt.Errorf("notification URL must be a full http or https address, such as https://shop.example.com/hooks/admin")
+	}
+	return raw, nil
+}
+
+// normalizeMailFrom checks the sender of customer emails, which may carry a display name. An
+// empty sender turns the emails off.
+func normalizeMailFrom(raw string) (string, error) {
+	raw = strings.TrimSpace(raw)
+	if raw == "" {
+		return "", nil
+	}
+	if _, err := mail.ParseAddress(raw); err != nil {
+		return "", fmt.Errorf("sender must be an email address, such as Acme <orders@acme.example>")
+	}
+	return raw, nil
+}
+
+// GetStoreSettings retrieves the store settings, creating the preview and webhook secrets the
+// first time
+func GetStoreSettings(db *database.DB) (StoreSettings, error) {
+	if cached, found := db.Cache.Get(storeSettingsCacheKey); found {
+		if settings, ok := cached.(StoreSettings); ok {
+			return settings, nil
+		}
+	}
+
+	ctx, cancel := db.Context(database.Read)
+	defer cancel()
+
+	random := make([]byte, 64)
+	if _, err := rand.Read(random); err != nil {
+		return StoreSettings{}, fmt.Errorf("error generating store secrets: %w", err)
+	}
+
+	// The upsert only fills in a missing secret, so concurrent first requests agree on one
+	query := `
+		INSERT INTO store_settings (id, preview_secret, webhook_secret) VALUES (TRUE, $1, $2)
+		ON CONFLICT (id) DO UPDATE SET
+			preview_secret = CASE WHEN store_settings.preview_secret = '' THEN EXCLUDED.preview_secret ELSE store_settings.preview_secret END,
+			webhook_secret = CASE WHEN store_settings.webhook_secret = '' THEN EXCLUDED.webhook_secret ELSE store_settings.webhook_secret END
+		RETURNING storefront_url, preview_secret, webhook_secret, notify_url, mail_from, updated_at
+	`
+
+	var settings StoreSettings
+	err := db.Pool.QueryRow(ctx, query, hex.EncodeToString(random[:32]), hex.EncodeToString(random[32:])).Scan(
+		&settings.StorefrontURL, &settings.PreviewSecret, &settings.WebhookSecret, &settings.NotifyURL, &settings.MailFrom, &settings.UpdatedAt,
+	)
+	if err != nil {
+		return StoreSettings{}, fmt.Errorf("error getting store settings: %w", err)
+	}
+
+	db.Cache.Set(storeSettingsCacheKey, settings, 10*time.Minute)
+	return settings, nil
+}
+
+// SaveStoreSettings sets the storefront base URL and, for a tenant, where its order
+// notifications go. The secrets are kept.
+func SaveStoreSettings(db *database.DB, submitted StoreSettings) (StoreSettings, error) {
+	storefrontURL, err := NormalizeStorefrontURL(submitted.StorefrontURL)
+	if err != nil {
+		return StoreSettings{}, err
+	}
+	notifyURL, err := normalizeNotifyURL(submitted.NotifyURL)
+	if err != nil {
+		return StoreSettings{}, err
+	}
+	mailFrom, err := normalizeMailFrom(submitted.MailFrom)
+	if err != nil {
+		return StoreSettings{}, err
+	}
+
+	ctx, cancel := db.Context(database.Write)
+	defer cancel()
+
+	_, err = db.Pool.Exec(ctx, `
+		INSERT INTO store_settings (id, storefront_url, notify_url, mail_from) VALUES (TRUE, $1, $2, $3)
+		ON CONFLICT (id) DO UPDATE SET
+			storefront_url = EXCLUDED.storefront_url, notify_url = EXCLUDED.notify_url, mail_from = EXCLUDED.mail_from,
+			updated_at = CURRENT_TIMESTAMP
+	`, storefrontURL, notifyURL, mailFrom)
+	if err != nil {
+		return StoreSettings{}, fmt.Errorf("error saving store settings: %w", err)
+	}
+
+	db.Cache.Delete(storeSettingsCacheKey)
+	return GetStoreSettings(db)
+}
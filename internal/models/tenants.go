@@ -0,0 +1,294 @@
+package models
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/ngenohkevin/kuiper_admin/internal/database"
+)
+
+// tenantSlugPattern is what a tenant's subdomain may be: a DNS label of lowercase letters,
+// digits and dashes, short enough that its schema name fits Postgres's limit
+var tenantSlugPattern = regexp.MustCompile(`^[a-z0-9]([a-z0-9-]{0,54}[a-z0-9])?$`)
+
+// reservedTenantSlugs are subdomains that usually point somewhere else
+var reservedTenantSlugs = []string{"www", "api", "admin", "mail", "static"}
+
+// tenantCacheTTL is how long a tenant looked up by subdomain is cached, which is how long a
+// disabled tenant may stay reachable on other server instances
+const tenantCacheTTL = 30 * time.Second
+
+// Tenant is a store kept in a Postgres schema of its own and reached on its own subdomain
+type Tenant struct {
+	ID             string     `json:"id"`
+	Slug           string     `json:"slug"` // The subdomain
+	Name           string     `json:"name"`
+	Schema         string     `json:"schema"`
+	Enabled        bool       `json:"enabled"`
+	SchemaVersion  uint       `json:"schema_version"` // The last migration applied to its schema
+	MigrationError string     `json:"migration_error,omitempty"`
+	MigratedAt     *time.Time `json:"migrated_at,omitempty"`
+	CreatedBy      string     `json:"created_by"`
+	CreatedAt      time.Time  `json:"created_at"`
+}
+
+// Ready reports whether the tenant can be served: enabled, and with its schema migrated up to
+// latest. A schema behind would fall through to the main schema's tables for what it lacks.
+func (t Tenant) Ready(latest uint) bool {
+	return t.Enabled && t.MigrationError == "" && t.SchemaVersion >= latest
+}
+
+type tenantContextKey struct{}
+
+// WithTenant returns a copy of ctx carrying the tenant the request was made for
+func WithTenant(ctx context.Context, t Tenant) context.Context {
+	return context.WithValue(ctx, tenantContextKey{}, t)
+}
+
+// TenantFromContext returns the tenant the request was made for, and false on the main host
+func TenantFromContext(ctx context.Context) (Tenant, bool) {
+	t, ok := ctx.Value(tenantContextKey{}).(Tenant)
+	return t, ok
+}
+
+// TenantSchema is the schema a tenant's data goes in, named after its subdomain
+func TenantSchema(slug string) string {
+	return "tenant_" + strings.ReplaceAll(slug, "-", "_")
+}
+
+const tenantColumns = `id, slug, name, schema_name, enabled, schema_version, migration_error, migrated_at, created_by, created_at`
+
+// scanTenant reads a row selected with tenantColumns
+func scanTenant(row pgx.Row) (Tenant, error) {
+	var t Tenant
+	var version int64
+	err := row.Scan(&t.ID, &t.Slug, &t.Name, &t.Schema, &t.Enabled, &version, &t.MigrationError, &t.MigratedAt, &t.CreatedBy, &t.CreatedAt)
+	t.SchemaVersion = uint(max(version, 0))
+	return t, err
+}
+
+// invalidateTenantCache forgets the tenants looked up by subdomain
+func invalidateTenantCache(db *database.DB) {
+	db.Cache.DeletePrefix("tenants:")
+}
+
+// GetTenants lists the tenants by name. Tenants are always read from the main schema.
+func GetTenants(db *database.DB) ([]Tenant, error) {
+	db = db.Main()
+	ctx, cancel := db.Context(database.List)
+	defer cancel()
+
+	rows, err := db.Pool.Query(ctx, `SELECT `+tenantColumns+` FROM tenants ORDER BY lower(name), slug`)
+	if err != nil {
+		return nil, dbError("getting tenants", err)
+	}
+	defer rows.Close()
+
+	var tenants []Tenant
+	for rows.Next() {
+		t, err := scanTenant(rows)
+		if err != nil {
+			return nil, dbError("scanning tenant", err)
+		}
+		tenants = append(tenants, t)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, dbError("iterating tenants", err)
+	}
+	return tenants, nil
+}
+
+// GetTenant finds a tenant by ID
+func GetTenant(db *database.DB, id string) (Tenant, error) {
+	db = db.Main()
+	ctx, cancel := db.Context(database.Read)
+	defer cancel()
+
+	t, err := scanTenant(db.Pool.QueryRow(ctx, `SELECT `+tenantColumns+` FROM tenants WHERE id = $1`, id))
+	if err = dbError("finding tenant", err); errors.Is(err, ErrNotFound) {
+		return Tenant{}, notFound("tenant %s not found", id)
+	}
+	return t, err
+}
+
+// GetTenantBySlug finds the tenant on a subdomain, for every request made on one. The answer,
+// found or not, is cached briefly.
+func GetTenantBySlug(db *database.DB, slug string) (Tenant, error) {
+	db = db.Main()
+	key := "tenants:slug:" + slug
+	if cached, found := db.Cache.Get(key); found {
+		if t, ok := cached.(Tenant); ok {
+			return t, nil
+		}
+		return Tenant{}, notFound("no tenant on %s", slug)
+	}
+
+	ctx, cancel := db.Context(database.Read)
+	defer cancel()
+
+	t, err := scanTenant(db.Pool.QueryRow(ctx, `SELECT `+tenantColumns+` FROM tenants WHERE slug = $1`, slug))
+	if err = dbError("finding tenant", err); errors.Is(err, ErrNotFound) {
+		db.Cache.Set(key, false, tenantCacheTTL)
+		return Tenant{}, notFound("no tenant on %s", slug)
+	}
+	if err != nil {
+		return Tenant{}, err
+	}
+	db.Cache.Set(key, t, tenantCacheTTL)
+	return t, nil
+}
+
+// CreateTenant registers a tenant on a subdomain. Its schema is created and migrated separately,
+// by MigrateTenant.
+func CreateTenant(db *database.DB, slug, name, createdBy string) (Tenant, error) {
+	slug = strings.ToLower(strings.TrimSpace(slug))
+	name = strings.TrimSpace(name)
+	switch {
+	case !tenantSlugPattern.MatchString(slug):
+		return Tenant{}, fmt.Errorf("the subdomain may only hold lowercase letters, digits and dashes, up to 56 of them")
+	case slices.Contains(reservedTenantSlugs, slug):
+		return Tenant{}, fmt.Errorf("the subdomain %s is reserved", slug)
+	case name == "":
+		return Tenant{}, fmt.Errorf("the tenant needs a name")
+	case len(name) > 255:
+		return Tenant{}, fmt.Errorf("the name must be at most 255 characters")
+	}
+
+	db = db.Main()
+	ctx, cancel := db.Context(database.Write)
+	defer cancel()
+
+	t, err := scanTenant(db.Pool.QueryRow(ctx, `
+		INSERT INTO tenants (slug, name, schema_name, created_by)
+		VALUES ($1, $2, $3, $4)
+		RETURNING `+tenantColumns,
+		slug, name, TenantSchema(slug), createdBy))
+	if err = dbError("creating tenant", err); errors.Is(err, ErrConflict) {
+		return Tenant{}, conflict("there's already a tenant on %s", slug)
+	}
+	if err != nil {
+		return Tenant{}, err
+	}
+	invalidateTenantCache(db)
+	return t, nil
+}
+
+// SetTenantEnabled turns a tenant off, which takes its subdomain offline and stops its jobs,
+// or back on. Its schema and data are kept either way.
+func SetTenantEnabled(db *database.DB, id string, enabled bool) (Tenant, error) {
+	db = db.Main()
+	ctx, cancel := db.Context(database.Write)
+	defer cancel()
+
+	t, err := scanTenant(db.Pool.QueryRow(ctx, `
+		UPDATE tenants SET enabled = $2 WHERE id = $1
+		RETURNING `+tenantColumns, id, enabled))
+	if err = dbError("updating tenant", err); errors.Is(err, ErrNotFound) {
+		return Tenant{}, notFound("tenant %s not found", id)
+	}
+	if err != nil {
+		return Tenant{}, err
+	}
+	invalidateTenantCache(db)
+	if !enabled {
+		db.CloseSchema(t.Schema)
+	}
+	return t, nil
+}
+
+// MigrateTenant creates the tenant's schema if needed, applies the migrations in dir to it and
+// records the version it ends up at, or why it couldn't get there
+func MigrateTenant(db *database.DB, t Tenant, dir string) (Tenant, error) {
+	db = db.Main()
+	migrateErr := db.MigrateSchema(t.Schema)
+
+	var version uint
+	if tenantDB, err := db.ForSchema(t.Schema); err != nil {
+		migrateErr = errors.Join(migrateErr, err)
+	} else if status, err := GetMigrationStatus(tenantDB, dir); err != nil {
+		migrateErr = errors.Join(migrateErr, err)
+	} else {
+		version = status.Version
+		if status.Dirty && migrateErr == nil {
+			migrateErr = fmt.Errorf("migration %d failed partway and needs fixing by hand", status.Version)
+		}
+	}
+
+	message := ""
+	if migrateErr != nil {
+		message = migrateErr.Error()
+	}
+
+	ctx, cancel := db.Context(database.Write)
+	defer cancel()
+	updated, err := scanTenant(db.Pool.QueryRow(ctx, `
+		UPDATE tenants SET schema_version = $2, migration_error = $3, migrated_at = CURRENT_TIMESTAMP
+		WHERE id = $1
+		RETURNING `+tenantColumns, t.ID, int64(version), message))
+	if err != nil {
+		return t, dbError("recording tenant migration", err)
+	}
+	invalidateTenantCache(db)
+	return updated, migrateErr
+}
+
+// MigrateTenants brings every tenant's schema up to date with the migrations in dir, carrying on
+// past tenants that fail, whose errors are returned together
+func MigrateTenants(db *database.DB, dir string) error {
+	tenants, err := GetTenants(db)
+	if err != nil {
+		return err
+	}
+	var errs []error
+	for _, t := range tenants {
+		if _, err := MigrateTenant(db, t, dir); err != nil {
+			errs = append(errs, fmt.Errorf("tenant %s: %w", t.Slug, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// EnabledTenantDBs returns the database of each enabled tenant whose schema is up to date with
+// the migrations in dir, keyed by schema, for jobs to run over. Tenants that can't be connected
+// to are left out and their errors returned alongside.
+func EnabledTenantDBs(db *database.DB, dir string) (map[string]*database.DB, error) {
+	tenants, err := GetTenants(db)
+	if err != nil || len(tenants) == 0 {
+		return nil, err
+	}
+	latest, err := LatestMigration(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	dbs := make(map[string]*database.DB)
+	var errs []error
+	for _, t := range tenants {
+		if !t.Ready(latest) {
+			continue
+		}
+		tenantDB, err := db.ForSchema(t.Schema)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		dbs[t.Schema] = tenantDB
+	}
+	return dbs, errors.Join(errs...)
+}
+
+// LatestMigration is the newest migration in dir, the version a tenant's schema must be at to
+// be served
+func LatestMigration(dir string) (uint, error) {
+	versions, err := migrationVersions(dir)
+	if err != nil || len(versions) == 0 {
+		return 0, err
+	}
+	return versions[len(versions)-1], nil
+}
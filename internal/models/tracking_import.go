@@ -0,0 +1,185 @@
+package models
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/ngenohkevin/kuiper_admin/internal/database"
+)
+
+// TrackingImport is one line of a tracking number upload: the order it is for, the tracking
+// number and carrier of its parcel, and the status to move the order to
+type TrackingImport struct {
+	Row            int    `json:"row,omitempty"` // Line of the file, when known
+	OrderID        string `json:"order_id"`
+	TrackingNumber string `json:"tracking_number"`
+	Carrier        string `json:"carrier"` // The order's own carrier is kept when blank
+	Status         string `json:"status"`  // Shipped when the file doesn't say, or delivered for orders already delivered
+}
+
+// TrackingImportResult is what importing a line did to its order. Previous is the order's
+// carrier, tracking number and status before.
+type TrackingImportResult struct {
+	TrackingImport
+	Previous TrackingImport      `json:"previous"`
+	Outcome  string              `json:"outcome"` // ImportUpdated, ImportUnchanged, ImportFailed or ImportSkipped
+	Queued   []OrderNotification `json:"queued_notifications,omitempty"`
+	Error    string              `json:"error,omitempty"`
+}
+
+// StatusChanged reports whether the line moved its order to another status
+func (r TrackingImportResult) StatusChanged() bool {
+	return r.Outcome == ImportUpdated && r.Status != r.Previous.Status
+}
+
+// ImportTracking gives each order in rows its tracking number and carrier and moves it to the
+// row's status, queueing the customer notifications the new status turns on when notify is set.
+// An order still waiting to be packed has its stock taken out as packing would, since its parcel
+// went out without it. The file is imported all or nothing: nothing is written when any row fails or when dryRun is set, so a
+// dry run shows exactly what importing would do.
+func ImportTracking(db *database.DB, rows []TrackingImport, notify, dryRun bool, actor string) ([]TrackingImportResult, error) {
+	if len(rows) == 0 {
+		return nil, fmt.Errorf("the file has no orders in it")
+	}
+
+	ctx, cancel := db.Context(database.Bulk)
+	defer cancel()
+
+	tx, err := db.Pool.Begin(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("error starting transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	results := make([]TrackingImportResult, 0, len(rows))
+	var changed []string
+	lines := map[string]int{}
+	failed := false
+	for _, row := range rows {
+		row.OrderID = strings.TrimSpace(row.OrderID)
+		row.TrackingNumber = strings.TrimSpace(row.TrackingNumber)
+		row.Carrier = strings.TrimSpace(row.Carrier)
+		row.Status = strings.ToLower(strings.TrimSpace(row.Status))
+		result := TrackingImportResult{TrackingImport: row, Outcome: ImportFailed}
+
+		switch line, seen := lines[row.OrderID]; {
+		case row.OrderID == "":
+			result.Error = "the order number is missing"
+		case row.TrackingNumber == "":
+			result.Error = "the tracking number is missing"
+		case len(row.TrackingNumber) > maxTrackingNumberLength:
+			result.Error = fmt.Sprintf("the tracking number can be at most %d characters", maxTrackingNumberLength)
+		case len([]rune(row.Carrier)) > maxCarrierLength:
+			result.Error = fmt.Sprintf("the carrier can be at most %d characters", maxCarrierLength)
+		case row.Status != "" && !slices.Contains(OrderStatuses, row.Status):
+			result.Error = fmt.Sprintf("%q isn't an order status", row.Status)
+		case seen:
+			result.Error = fmt.Sprintf("order %s is on line %d too", row.OrderID, line)
+		}
+		lines[row.OrderID] = row.Row
+		if result.Error == "" {
+			var products []string
+			result, products, err = importTrackingTx(ctx, db, tx, result, notify, actor)
+			if err != nil {
+				return nil, err
+			}
+			changed = append(changed, products...)
+		}
+		if result.Outcome == ImportFailed {
+			failed = true
+		}
+		results = append(results, result)
+	}
+
+	if failed || dryRun {
+		for i := range results {
+			if failed && results[i].Outcome != ImportFailed {
+				results[i].Outcome = ImportSkipped
+			}
+		}
+		return results, nil
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return nil, fmt.Errorf("error committing tracking import: %w", err)
+	}
+
+	announceProductChanges(db, changed...)
+	return results, nil
+}
+
+// importTrackingTx updates the order of one checked line, and returns the products whose stock
+// shipping it took out. An order that can't take the line fails it; only database errors are
+// returned.
+func importTrackingTx(ctx context.Context, db *database.DB, tx pgx.Tx, result TrackingImportResult, notify bool, actor string) (TrackingImportResult, []string, error) {
+	order, err := scanOrder(tx.QueryRow(ctx, `SELECT `+orderColumns+` FROM storefront_orders o WHERE o.id = $1 FOR UPDATE`, result.OrderID))
+	if errors.Is(err, pgx.ErrNoRows) {
+		result.Error = fmt.Sprintf("order %s not found", result.OrderID)
+		return result, nil, nil
+	}
+	if err != nil {
+		return result, nil, dbError("getting order", err)
+	}
+	result.Previous = TrackingImport{
+		Row: result.Row, OrderID: order.ID, TrackingNumber: order.TrackingNumber, Carrier: order.Carrier, Status: order.Status,
+	}
+
+	if result.Carrier == "" {
+		result.Carrier = order.Carrier
+	}
+	if result.Status == "" {
+		result.Status = OrderShipped
+		if order.Status == OrderDelivered {
+			result.Status = OrderDelivered
+		}
+	}
+	if order.Status == OrderCancelled || order.Status == OrderRefunded {
+		result.Error = fmt.Sprintf("order %s is %s, so it can't be shipped", order.ID, order.Status)
+		return result, nil, nil
+	}
+	if result.TrackingImport == result.Previous {
+		result.Outcome = ImportUnchanged
+		return result, nil, nil
+	}
+
+	// An order leaving the pick queue for shipped or delivered wasn't packed, so its stock is
+	// still in
+	var changed []string
+	if readyToPick(order.Status) && (result.Status == OrderShipped || result.Status == OrderDelivered) {
+		rows, err := tx.Query(ctx, pickLinesQuery, order.ID)
+		if err != nil {
+			return result, nil, dbError("getting order lines", err)
+		}
+		lines, err := scanPickLines(rows)
+		if err != nil {
+			return result, nil, err
+		}
+		if changed, err = shipStockTx(ctx, tx, order.ID, lines, actor); err != nil {
+			return result, nil, err
+		}
+	}
+
+	previous := order.Status
+	if err := tx.QueryRow(ctx, `
+		UPDATE storefront_orders
+		SET carrier = $2, tracking_number = $3, status = $4,
+		    status_changed_at = CASE WHEN status <> $4 THEN CURRENT_TIMESTAMP ELSE status_changed_at END
+		WHERE id = $1
+		RETURNING status, status_changed_at, carrier, tracking_number
+	`, order.ID, result.Carrier, result.TrackingNumber, result.Status).Scan(
+		&order.Status, &order.StatusChangedAt, &order.Carrier, &order.TrackingNumber,
+	); err != nil {
+		return result, nil, dbError("importing tracking number", err)
+	}
+	result.Outcome = ImportUpdated
+
+	if notify && order.Status != previous {
+		if result.Queued, err = queueOrderNotifications(ctx, db, tx, order, previous, actor); err != nil {
+			return result, nil, err
+		}
+	}
+	return result, changed, nil
+}
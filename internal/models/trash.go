@@ -0,0 +1,181 @@
+package models
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/ngenohkevin/kuiper_admin/internal/database"
+)
+
+// TrashItem is a soft-deleted record of any type, as listed on the trash page
+type TrashItem struct {
+	Type      string    `json:"type"` // "product", "variant", "category" or "review"
+	ID        string    `json:"id"`
+	ProductID string    `json:"product_id,omitempty"` // Set for variants
+	Name      string    `json:"name"`
+	DeletedAt time.Time `json:"deleted_at"`
+}
+
+// GetTrashItems lists everything currently soft-deleted, most recent first
+func GetTrashItems(db *database.DB) ([]TrashItem, error) {
+	ctx, cancel := db.Context(database.List)
+	defer cancel()
+
+	query := `
+		SELECT 'product', id::text, '', name, deleted_at
+		FROM products WHERE deleted_at IS NOT NULL
+		UNION ALL
+		SELECT 'variant', dv.variant_id, dv.product_id::text,
+		       p.name || ' – ' || COALESCE(NULLIF(dv.variant->>'name', ''), (dv.variant->>'quantity') || (dv.variant->>'unit'), 'Variant'),
+		       dv.deleted_at
+		FROM deleted_variants dv
+		JOIN products p ON p.id = dv.product_id
+		UNION ALL
+		SELECT 'category', id::text, '', name, deleted_at
+		FROM categories WHERE deleted_at IS NOT NULL
+		UNION ALL
+		SELECT 'review', r.id::text, '',
+		       COALESCE(NULLIF(r.reviewer_name, ''), 'Anonymous') || ' on ' || COALESCE(p.name, 'unknown product'),
+		       r.deleted_at
+		FROM reviews r
+		LEFT JOIN products p ON r.product_id = p.id
+		WHERE r.deleted_at IS NOT NULL
+		ORDER BY 5 DESC
+	`
+
+	rows, err := db.Pool.Query(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("error querying trash: %w", err)
+	}
+	defer rows.Close()
+
+	var items []TrashItem
+	for rows.Next() {
+		var item TrashItem
+		if err := rows.Scan(&item.Type, &item.ID, &item.ProductID, &item.Name, &item.DeletedAt); err != nil {
+			return nil, fmt.Errorf("error scanning trash row: %w", err)
+		}
+		items = append(items, item)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating trash rows: %w", err)
+	}
+
+	return items, nil
+}
+
+// RestoreTrashItem restores a soft-deleted record of the given type
+func RestoreTrashItem(db *database.DB, itemType, id string) error {
+	switch itemType {
+	case "product":
+		return RestoreProduct(db, id)
+	case "variant":
+		return RestoreProductVariant(db, id)
+	case "category":
+		return RestoreCategory(db, id)
+	case "review":
+		return RestoreReview(db, id)
+	}
+	return fmt.Errorf("unknown trash item type %q", itemType)
+}
+
+// purgeStatements permanently delete trashed records. Each takes the record ID as $1,
+// or NULL to purge everything deleted before the cutoff in $2.
+// References from live rows are cleared first so the foreign keys don't block the delete.
+var purgeStatements = map[string][]string{
+	"review": {
+		`DELETE FROM reviews WHERE deleted_at < $2 AND ($1::uuid IS NULL OR id = $1::uuid)`,
+	},
+	"variant": {
+		`DELETE FROM deleted_variants WHERE deleted_at < $2 AND ($1::text IS NULL OR variant_id = $1::text)`,
+	},
+	"product": {
+		`UPDATE reviews SET product_id = NULL WHERE product_id IN (
+			SELECT id FROM products WHERE deleted_at < $2 AND ($1::uuid IS NULL OR id = $1::uuid))`,
+		// Their images are deleted from storage later, once nothing else uses them
+		`INSERT INTO orphaned_media (url)
+		SELECT DISTINCT url FROM products, unnest(image_urls) AS url
+		WHERE deleted_at < $2 AND ($1::uuid IS NULL OR id = $1::uuid)
+		ON CONFLICT (url) DO NOTHING`,
+		`DELETE FROM products WHERE deleted_at < $2 AND ($1::uuid IS NULL OR id = $1::uuid)`,
+	},
+	"category": {
+		`UPDATE products SET category_id = NULL WHERE category_id IN (
+			SELECT id FROM categories WHERE deleted_at < $2 AND ($1::uuid IS NULL OR id = $1::uuid))`,
+		`UPDATE categories SET parent_id = NULL WHERE parent_id IN (
+			SELECT id FROM categories WHERE deleted_at < $2 AND ($1::uuid IS NULL OR id = $1::uuid))`,
+		`DELETE FROM categories WHERE deleted_at < $2 AND ($1::uuid IS NULL OR id = $1::uuid)`,
+	},
+}
+
+// purgeOrder deletes dependants before the records they point at
+var purgeOrder = []string{"review", "variant", "product", "category"}
+
+// purge runs the purge statements for one type inside a transaction and returns
+// how many trashed records were permanently deleted
+func purge(db *database.DB, itemType string, id *string, cutoff time.Time) (int64, error) {
+	statements, ok := purgeStatements[itemType]
+	if !ok {
+		return 0, fmt.Errorf("unknown trash item type %q", itemType)
+	}
+
+	ctx, cancel := db.Context(database.Bulk)
+	defer cancel()
+
+	tx, err := db.Pool.Begin(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("error starting transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	var deleted int64
+	for _, statement := range statements {
+		tag, err := tx.Exec(ctx, statement, id, cutoff)
+		if err != nil {
+			return 0, fmt.Errorf("error purging %s: %w", itemType, err)
+		}
+		// The last statement is always the delete itself
+		deleted = tag.RowsAffected()
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return 0, fmt.Errorf("error committing %s purge: %w", itemType, err)
+	}
+
+	if itemType == "product" || itemType == "category" {
+		invalidateProductCache(db)
+	}
+	if itemType == "category" {
+		invalidateCategoryCache(db)
+	}
+	return deleted, nil
+}
+
+// PurgeTrashItem permanently deletes a single trashed record
+func PurgeTrashItem(db *database.DB, itemType, id string) error {
+	deleted, err := purge(db, itemType, &id, time.Now().Add(time.Minute))
+	if err != nil {
+		return err
+	}
+	if deleted == 0 {
+		return fmt.Errorf("%s %s is not in the trash", itemType, id)
+	}
+	return nil
+}
+
+// PurgeExpiredTrash permanently deletes everything that has been in the trash longer
+// than retention, returning the number of records removed
+func PurgeExpiredTrash(db *database.DB, retention time.Duration) (int64, error) {
+	cutoff := time.Now().Add(-retention)
+
+	var total int64
+	for _, itemType := range purgeOrder {
+		deleted, err := purge(db, itemType, nil, cutoff)
+		if err != nil {
+			return total, err
+		}
+		total += deleted
+	}
+	return total, nil
+}
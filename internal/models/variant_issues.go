@@ -0,0 +1,286 @@
+package models
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/ngenohkevin/kuiper_admin/internal/database"
+	"github.com/ngenohkevin/kuiper_admin/internal/money"
+)
+
+// Kinds of problem the variant validator reports
+const (
+	VariantIssueMalformed     = "malformed"      // Not an array, an entry that isn't an object or a field of the wrong type
+	VariantIssueMissingID     = "missing_id"     // No id, so the variant can't be edited or deleted
+	VariantIssueDuplicateID   = "duplicate_id"   // Same id as an earlier variant, so lookups find the wrong one
+	VariantIssueNegativeStock = "negative_stock" // stock_count below zero
+)
+
+// VariantIssue is one problem found in a product's variants JSON
+type VariantIssue struct {
+	ID           string    `json:"id"`
+	ProductID    string    `json:"product_id"`
+	ProductName  string    `json:"product_name"`
+	VariantIndex int       `json:"variant_index"` // Position in the variants array, -1 for the whole column
+	VariantID    string    `json:"variant_id,omitempty"`
+	Kind         string    `json:"kind"`
+	Detail       string    `json:"detail"`
+	DetectedAt   time.Time `json:"detected_at"`
+}
+
+// Fixable reports whether FixVariantIssue can repair the issue; malformed JSON has to be fixed by hand
+func (i VariantIssue) Fixable() bool {
+	return i.Kind != VariantIssueMalformed
+}
+
+// validateVariants checks one product's raw variants JSON. seen maps variant IDs already
+// used by earlier products, or earlier in this product, to the product that uses them.
+func validateVariants(productID string, raw []byte, seen map[string]string) []VariantIssue {
+	if len(raw) == 0 || string(raw) == "null" {
+		return nil
+	}
+
+	issue := func(index int, variantID, kind, detail string) VariantIssue {
+		return VariantIssue{ProductID: productID, VariantIndex: index, VariantID: variantID, Kind: kind, Detail: detail}
+	}
+
+	var entries []json.RawMessage
+	if err := json.Unmarshal(raw, &entries); err != nil {
+		return []VariantIssue{issue(-1, "", VariantIssueMalformed, "variants is not a JSON array")}
+	}
+
+	var issues []VariantIssue
+	for i, entry := range entries {
+		var fields map[string]json.RawMessage
+		if err := json.Unmarshal(entry, &fields); err != nil || fields == nil {
+			issues = append(issues, issue(i, "", VariantIssueMalformed, "entry is not a JSON object"))
+			continue
+		}
+
+		var id string
+		if rawID, ok := fields["id"]; ok && string(rawID) != "null" {
+			if err := json.Unmarshal(rawID, &id); err != nil {
+				issues = append(issues, issue(i, "", VariantIssueMalformed, "id is not a string"))
+				continue
+			}
+		}
+		switch owner, dup := seen[id]; {
+		case id == "":
+			issues = append(issues, issue(i, "", VariantIssueMissingID, "variant has no id"))
+		case dup && owner == productID:
+			issues = append(issues, issue(i, id, VariantIssueDuplicateID, "id is used twice in this product"))
+		case dup:
+			issues = append(issues, issue(i, id, VariantIssueDuplicateID, "id is also used by product "+owner))
+		default:
+			seen[id] = productID
+		}
+
+		if rawPrice, ok := fields["price"]; ok && string(rawPrice) != "null" {
+			var price money.Amount
+			if err := json.Unmarshal(rawPrice, &price); err != nil {
+				issues = append(issues, issue(i, id, VariantIssueMalformed, "price is not a number"))
+			}
+		}
+		if rawStock, ok := fields["stock_count"]; ok && string(rawStock) != "null" {
+			var stock int
+			if err := json.Unmarshal(rawStock, &stock); err != nil {
+				issues = append(issues, issue(i, id, VariantIssueMalformed, "stock_count is not a whole number"))
+			} else if stock < 0 {
+				issues = append(issues, issue(i, id, VariantIssueNegativeStock, fmt.Sprintf("stock_count is %d", stock)))
+			}
+		}
+		if rawUnit, ok := fields["unit"]; ok && string(rawUnit) != "null" {
+			var unit string
+			if err := json.Unmarshal(rawUnit, &unit); err != nil || !slices.Contains(VariantUnits, unit) {
+				issues = append(issues, issue(i, id, VariantIssueMalformed, "unit is not one of "+strings.Join(VariantUnits, ", ")))
+			}
+		}
+		if rawAvailable, ok := fields["is_available"]; ok && string(rawAvailable) != "null" {
+			var available bool
+			if err := json.Unmarshal(rawAvailable, &available); err != nil {
+				issues = append(issues, issue(i, id, VariantIssueMalformed, "is_available is not true or false"))
+			}
+		}
+	}
+	return issues
+}
+
+// RebuildVariantReport validates every live product's variants and replaces the stored
+// report with what it finds, returning the number of issues
+func RebuildVariantReport(db *database.DB) (int, error) {
+	ctx, cancel := db.Context(database.Bulk)
+	defer cancel()
+
+	// Oldest first, so when two variants share an ID the newer one is reported
+	rows, err := db.Pool.Query(ctx, `SELECT id, variants FROM products WHERE deleted_at IS NULL ORDER BY created_at, id`)
+	if err != nil {
+		return 0, fmt.Errorf("error querying product variants: %w", err)
+	}
+
+	var issues []VariantIssue
+	seen := make(map[string]string)
+	for rows.Next() {
+		var productID string
+		var raw []byte
+		if err := rows.Scan(&productID, &raw); err != nil {
+			rows.Close()
+			return 0, fmt.Errorf("error scanning product variants: %w", err)
+		}
+		issues = append(issues, validateVariants(productID, raw, seen)...)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, fmt.Errorf("error iterating product variants: %w", err)
+	}
+
+	tx, err := db.Pool.Begin(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("error starting transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	if _, err := tx.Exec(ctx, `DELETE FROM variant_issues`); err != nil {
+		return 0, fmt.Errorf("error clearing variant report: %w", err)
+	}
+
+	for _, issue := range issues {
+		_, err := tx.Exec(ctx, `
+			INSERT INTO variant_issues (product_id, variant_index, variant_id, kind, detail)
+			VALUES ($1, $2, $3, $4, $5)
+		`, issue.ProductID, issue.VariantIndex, issue.VariantID, issue.Kind, issue.Detail)
+		if err != nil {
+			return 0, fmt.Errorf("error saving variant issue: %w", err)
+		}
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return 0, fmt.Errorf("error committing variant report: %w", err)
+	}
+
+	return len(issues), nil
+}
+
+// GetVariantReport lists the stored variant issues with their product names.
+// Issues on products deleted since the last run are left out.
+func GetVariantReport(db *database.DB) ([]VariantIssue, error) {
+	ctx, cancel := db.Context(database.List)
+	defer cancel()
+
+	query := `
+		SELECT i.id, i.product_id, p.name, i.variant_index, i.variant_id, i.kind, i.detail, i.detected_at
+		FROM variant_issues i
+		JOIN products p ON p.id = i.product_id AND p.deleted_at IS NULL
+		ORDER BY p.name, i.variant_index
+	`
+
+	rows, err := db.Pool.Query(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("error querying variant report: %w", err)
+	}
+	defer rows.Close()
+
+	var issues []VariantIssue
+	for rows.Next() {
+		var issue VariantIssue
+		if err := rows.Scan(&issue.ID, &issue.ProductID, &issue.ProductName, &issue.VariantIndex,
+			&issue.VariantID, &issue.Kind, &issue.Detail, &issue.DetectedAt); err != nil {
+			return nil, fmt.Errorf("error scanning variant issue: %w", err)
+		}
+		issues = append(issues, issue)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating variant issues: %w", err)
+	}
+
+	return issues, nil
+}
+
+// FixVariantIssue repairs one reported issue: variants without a unique ID get a new one and
+// negative stock is reset to zero with a stock movement. It fails if the variant has changed
+// since the report was built, in which case the report needs refreshing.
+func FixVariantIssue(db *database.DB, id, actor string) error {
+	ctx, cancel := db.Context(database.Write)
+	defer cancel()
+
+	tx, err := db.Pool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("error starting transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	var issue VariantIssue
+	var raw []byte
+	err = tx.QueryRow(ctx, `
+		SELECT i.product_id, i.variant_index, i.variant_id, i.kind, p.variants
+		FROM variant_issues i
+		JOIN products p ON p.id = i.product_id
+		WHERE i.id = $1
+		FOR UPDATE OF p
+	`, id).Scan(&issue.ProductID, &issue.VariantIndex, &issue.VariantID, &issue.Kind, &raw)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return notFound("variant issue %s not found", id)
+	}
+	if err != nil {
+		return dbError("getting variant issue", err)
+	}
+	if !issue.Fixable() {
+		return fmt.Errorf("malformed variants have to be fixed by editing the product")
+	}
+
+	var variants []map[string]json.RawMessage
+	if err := json.Unmarshal(raw, &variants); err != nil || issue.VariantIndex < 0 || issue.VariantIndex >= len(variants) {
+		return fmt.Errorf("the product's variants have changed; refresh the report")
+	}
+	variant := variants[issue.VariantIndex]
+
+	var currentID string
+	json.Unmarshal(variant["id"], &currentID)
+	if currentID != issue.VariantID {
+		return fmt.Errorf("the product's variants have changed; refresh the report")
+	}
+
+	switch issue.Kind {
+	case VariantIssueMissingID, VariantIssueDuplicateID:
+		newID, _ := json.Marshal(uuid.New().String())
+		variant["id"] = newID
+	case VariantIssueNegativeStock:
+		var stock int
+		if err := json.Unmarshal(variant["stock_count"], &stock); err != nil || stock >= 0 {
+			return fmt.Errorf("the product's variants have changed; refresh the report")
+		}
+		variant["stock_count"] = json.RawMessage("0")
+		change := StockChange{Reason: MovementIntegrityFix, Note: "Negative stock reset by the variant report", Actor: actor}
+		if err := recordStockMovement(ctx, tx, issue.ProductID, currentID, -stock, 0, change); err != nil {
+			return err
+		}
+	}
+
+	updated, err := json.Marshal(variants)
+	if err != nil {
+		return fmt.Errorf("error encoding variants: %w", err)
+	}
+	if _, err := tx.Exec(ctx, `UPDATE products SET variants = $1, updated_at = CURRENT_TIMESTAMP WHERE id = $2`, updated, issue.ProductID); err != nil {
+		return dbError("updating product variants", err)
+	}
+	if err := syncVariantRows(ctx, tx, issue.ProductID); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(ctx, `DELETE FROM variant_issues WHERE id = $1`, id); err != nil {
+		return fmt.Errorf("error clearing variant issue: %w", err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("error committing variant fix: %w", err)
+	}
+
+	invalidateProductCache(db)
+	announceProductChanges(db, issue.ProductID)
+	return nil
+}
@@ -0,0 +1,357 @@
+package models
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/ngenohkevin/kuiper_admin/internal/database"
+)
+
+// Where variants are kept while they move from products.variants to the product_variants table
+const (
+	VariantStorageJSONB = "jsonb" // Only the JSONB; the table is left alone
+	VariantStorageDual  = "dual"  // Writes go to both; reads come from the JSONB and are checked against the table
+	VariantStorageTable = "table" // Writes go to both; reads come from the table
+)
+
+// VariantStorage is the variant storage mode, set with VARIANT_STORAGE. It is VariantStorageJSONB
+// unless configured. Every mode keeps writing the JSONB, so moving back a step is always safe.
+func VariantStorage() string {
+	switch mode := os.Getenv("VARIANT_STORAGE"); mode {
+	case VariantStorageDual, VariantStorageTable:
+		return mode
+	}
+	return VariantStorageJSONB
+}
+
+// variantWriter runs statements on the pool or inside a transaction
+type variantWriter interface {
+	Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error)
+	SendBatch(ctx context.Context, b *pgx.Batch) pgx.BatchResults
+	Exec(ctx context.Context, sql string, args ...any) (pgconn.CommandTag, error)
+}
+
+// syncVariantRows copies a write to products' variants JSON to their product_variants rows,
+// unless the JSONB is the only storage. Called with the writer's transaction the rows change
+// with the JSONB; otherwise the copy is one implicit transaction of its own.
+func syncVariantRows(ctx context.Context, w variantWriter, productIDs ...string) error {
+	if VariantStorage() == VariantStorageJSONB {
+		return nil
+	}
+	return rebuildVariantRows(ctx, w, productIDs...)
+}
+
+// syncCommittedVariantRows is syncVariantRows after a JSONB write that has already been
+// committed, which a failed copy can't undo. The failure is logged, and the verification report
+// shows the product until its rows are rebuilt.
+func syncCommittedVariantRows(ctx context.Context, db *database.DB, productIDs ...string) {
+	if err := syncVariantRows(ctx, db.Pool, productIDs...); err != nil {
+		log.Printf("Error syncing variant rows of products %v: %v", productIDs, err)
+	}
+}
+
+// rebuildVariantRows replaces the product_variants rows of products with their variants JSON.
+// A product whose JSON doesn't parse is left without rows and shows up in the verification
+// report.
+func rebuildVariantRows(ctx context.Context, w variantWriter, productIDs ...string) error {
+	if len(productIDs) == 0 {
+		return nil
+	}
+
+	rows, err := w.Query(ctx, `SELECT id, COALESCE(variants, '[]'::jsonb) FROM products WHERE id = ANY($1::uuid[])`, productIDs)
+	if err != nil {
+		return dbError("reading variants to sync", err)
+	}
+	variants := map[string][]ProductVariant{}
+	for rows.Next() {
+		var id string
+		var raw []byte
+		if err := rows.Scan(&id, &raw); err != nil {
+			rows.Close()
+			return fmt.Errorf("error scanning variants to sync: %w", err)
+		}
+		var parsed []ProductVariant
+		if err := json.Unmarshal(raw, &parsed); err != nil {
+			log.Printf("Not syncing variant rows of product %s: %v", id, err)
+		}
+		variants[id] = parsed
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("error iterating variants to sync: %w", err)
+	}
+
+	batch := &pgx.Batch{}
+	batch.Queue(`DELETE FROM product_variants WHERE product_id = ANY($1::uuid[])`, productIDs)
+	for productID, list := range variants {
+		for i, v := range list {
+			var quantity *float64
+			if v.Quantity != 0 {
+				quantity = &v.Quantity
+			}
+			batch.Queue(`
+				INSERT INTO product_variants (product_id, position, variant_id, name, price, stock_count, is_available, quantity, unit, backorder, preorder, expected_at)
+				VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)
+			`, productID, i, v.ID, v.Name, v.Price, v.StockCount, v.IsAvailable, quantity, v.Unit, v.Backorder, v.Preorder, v.ExpectedAt)
+		}
+	}
+	if err := w.SendBatch(ctx, batch).Close(); err != nil {
+		return dbError("syncing variant rows", err)
+	}
+	return nil
+}
+
+// getVariantRows reads the product_variants rows of products, in the order of their JSON
+func getVariantRows(ctx context.Context, db *database.DB, productIDs []string) (map[string][]ProductVariant, error) {
+	rows, err := db.Pool.Query(ctx, `
+		SELECT product_id::text, variant_id, name, price, stock_count, is_available, quantity, unit, backorder, preorder, expected_at
+		FROM product_variants
+		WHERE product_id = ANY($1::uuid[])
+		ORDER BY product_id, position
+	`, productIDs)
+	if err != nil {
+		return nil, dbError("getting variant rows", err)
+	}
+	defer rows.Close()
+
+	variants := map[string][]ProductVariant{}
+	for rows.Next() {
+		var productID string
+		var v ProductVariant
+		var quantity *float64
+		if err := rows.Scan(&productID, &v.ID, &v.Name, &v.Price, &v.StockCount, &v.IsAvailable, &quantity, &v.Unit, &v.Backorder, &v.Preorder, &v.ExpectedAt); err != nil {
+			return nil, fmt.Errorf("error scanning variant row: %w", err)
+		}
+		if quantity != nil {
+			v.Quantity = *quantity
+		}
+		variants[productID] = append(variants[productID], v)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating variant rows: %w", err)
+	}
+
+	return variants, nil
+}
+
+// readVariants picks the variants to show for products whose JSON has already been parsed into
+// fromJSON, by product ID, following the storage mode. In dual mode the table is read too and
+// any difference is logged; in table mode the rows are used, falling back to the JSON if the
+// table can't be read.
+func readVariants(ctx context.Context, db *database.DB, fromJSON map[string][]ProductVariant) map[string][]ProductVariant {
+	mode := VariantStorage()
+	if mode == VariantStorageJSONB || len(fromJSON) == 0 {
+		return fromJSON
+	}
+
+	ids := make([]string, 0, len(fromJSON))
+	for id := range fromJSON {
+		ids = append(ids, id)
+	}
+	fromTable, err := getVariantRows(ctx, db, ids)
+	if err != nil {
+		log.Printf("Error reading variant rows, using the JSONB: %v", err)
+		return fromJSON
+	}
+
+	if mode == VariantStorageDual {
+		for id, list := range fromJSON {
+			if diff := variantListDifference(list, fromTable[id]); diff != "" {
+				log.Printf("Variant storage mismatch on product %s: %s", id, diff)
+			}
+		}
+		return fromJSON
+	}
+	for _, id := range ids {
+		if _, ok := fromTable[id]; !ok {
+			fromTable[id] = nil
+		}
+	}
+	return fromTable
+}
+
+// variantListDifference describes the first way two lists of a product's variants differ, in
+// JSON order, or is empty when they match
+func variantListDifference(fromJSON, fromTable []ProductVariant) string {
+	if len(fromJSON) != len(fromTable) {
+		return fmt.Sprintf("%d variants in the JSONB, %d rows in the table", len(fromJSON), len(fromTable))
+	}
+	for i := range fromJSON {
+		if field := variantDifference(fromJSON[i], fromTable[i]); field != "" {
+			return fmt.Sprintf("variant %d (%s) differs in %s", i+1, fromJSON[i].ID, field)
+		}
+	}
+	return ""
+}
+
+// variantDifference names the first field two copies of a variant differ in, or is empty
+func variantDifference(a, b ProductVariant) string {
+	switch {
+	case a.ID != b.ID:
+		return "id"
+	case a.Name != b.Name:
+		return "name"
+	case a.Price != b.Price:
+		return "price"
+	case a.StockCount != b.StockCount:
+		return "stock_count"
+	case a.IsAvailable != b.IsAvailable:
+		return "is_available"
+	case a.Quantity != b.Quantity:
+		return "quantity"
+	case a.Unit != b.Unit:
+		return "unit"
+	case a.Backorder != b.Backorder:
+		return "backorder"
+	case a.Preorder != b.Preorder:
+		return "preorder"
+	case (a.ExpectedAt == nil) != (b.ExpectedAt == nil) || (a.ExpectedAt != nil && !a.ExpectedAt.Equal(*b.ExpectedAt)):
+		return "expected_at"
+	}
+	return ""
+}
+
+// VariantStorageMismatch is a product whose variant rows don't match its JSON
+type VariantStorageMismatch struct {
+	ProductID   string `json:"product_id"`
+	ProductName string `json:"product_name"`
+	Problem     string `json:"problem"`
+}
+
+// VariantStorageReport compares every product's variants JSON with its product_variants rows
+type VariantStorageReport struct {
+	Mode         string                   `json:"mode"`
+	Products     int                      `json:"products"`      // Products checked, including deleted ones awaiting purge
+	JSONVariants int                      `json:"json_variants"` // Variants in the JSONB
+	TableRows    int                      `json:"table_rows"`    // Rows in product_variants
+	Unparsable   int                      `json:"unparsable"`    // Products whose JSON doesn't parse
+	Mismatches   []VariantStorageMismatch `json:"mismatches"`
+	CheckedAt    time.Time                `json:"checked_at"`
+}
+
+// InSync reports whether every product's rows match its JSON
+func (r VariantStorageReport) InSync() bool {
+	return len(r.Mismatches) == 0
+}
+
+// VerifyVariantStorage compares the variants JSON of every product with its rows
+func VerifyVariantStorage(db *database.DB) (VariantStorageReport, error) {
+	ctx, cancel := db.Context(database.Bulk)
+	defer cancel()
+
+	report := VariantStorageReport{Mode: VariantStorage(), Mismatches: []VariantStorageMismatch{}, CheckedAt: time.Now()}
+
+	rows, err := db.Pool.Query(ctx, `SELECT id, name, COALESCE(variants, '[]'::jsonb) FROM products ORDER BY name`)
+	if err != nil {
+		return report, dbError("reading variants to verify", err)
+	}
+	type product struct {
+		id, name string
+		variants []ProductVariant
+		err      error
+	}
+	var products []product
+	for rows.Next() {
+		var p product
+		var raw []byte
+		if err := rows.Scan(&p.id, &p.name, &raw); err != nil {
+			rows.Close()
+			return report, fmt.Errorf("error scanning variants to verify: %w", err)
+		}
+		p.err = json.Unmarshal(raw, &p.variants)
+		products = append(products, p)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return report, fmt.Errorf("error iterating variants to verify: %w", err)
+	}
+
+	ids := make([]string, len(products))
+	for i, p := range products {
+		ids[i] = p.id
+	}
+	fromTable, err := getVariantRows(ctx, db, ids)
+	if err != nil {
+		return report, err
+	}
+	if err := db.Pool.QueryRow(ctx, `SELECT COUNT(*) FROM product_variants`).Scan(&report.TableRows); err != nil {
+		return report, dbError("counting variant rows", err)
+	}
+
+	report.Products = len(products)
+	for _, p := range products {
+		report.JSONVariants += len(p.variants)
+		problem := variantListDifference(p.variants, fromTable[p.id])
+		if p.err != nil {
+			report.Unparsable++
+			problem = "variants JSON doesn't parse: " + p.err.Error()
+		}
+		if problem != "" {
+			report.Mismatches = append(report.Mismatches, VariantStorageMismatch{ProductID: p.id, ProductName: p.name, Problem: problem})
+		}
+	}
+
+	return report, nil
+}
+
+// BackfillVariantRows rebuilds the rows of every product from its JSON, in batches, and returns
+// how many products it went through. Run it before switching VARIANT_STORAGE away from jsonb,
+// and to repair mismatches the report finds.
+func BackfillVariantRows(db *database.DB) (int, error) {
+	ctx, cancel := db.Context(database.Bulk)
+	defer cancel()
+
+	rows, err := db.Pool.Query(ctx, `SELECT id FROM products ORDER BY id`)
+	if err != nil {
+		return 0, dbError("listing products to backfill", err)
+	}
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return 0, fmt.Errorf("error scanning product to backfill: %w", err)
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, fmt.Errorf("error iterating products to backfill: %w", err)
+	}
+
+	const batchSize = 200
+	for start := 0; start < len(ids); start += batchSize {
+		end := min(start+batchSize, len(ids))
+		if err := backfillVariantBatch(ctx, db, ids[start:end]); err != nil {
+			return start, err
+		}
+	}
+	return len(ids), nil
+}
+
+// backfillVariantBatch rebuilds the rows of some products in one transaction, locking them so a
+// write to their JSON can't slip in between reading it and writing the rows
+func backfillVariantBatch(ctx context.Context, db *database.DB, ids []string) error {
+	tx, err := db.Pool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("error starting transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	if _, err := tx.Exec(ctx, `SELECT id FROM products WHERE id = ANY($1::uuid[]) FOR UPDATE`, ids); err != nil {
+		return dbError("locking products to backfill", err)
+	}
+	if err := rebuildVariantRows(ctx, tx, ids...); err != nil {
+		return err
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("error committing variant backfill: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,47 @@
+package models
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/ngenohkevin/kuiper_admin/internal/database"
+)
+
+// RecordWebhookEvent notes that an inbound webhook event is being handled, reporting false when
+// it was handled before, so a delivery the sender retries has no effect the second time
+func RecordWebhookEvent(db *database.DB, id, eventType string) (bool, error) {
+	id = strings.TrimSpace(id)
+	if id == "" {
+		return false, fmt.Errorf("event id is required")
+	}
+	if len(id) > 255 {
+		return false, fmt.Errorf("event id can be at most 255 characters")
+	}
+
+	ctx, cancel := db.Context(database.Write)
+	defer cancel()
+
+	tag, err := db.Pool.Exec(ctx, `
+		INSERT INTO webhook_events (id, type)
+		VALUES ($1, $2)
+		ON CONFLICT (id) DO NOTHING
+	`, id, eventType)
+	if err != nil {
+		return false, dbError("recording webhook event", err)
+	}
+
+	return tag.RowsAffected() == 1, nil
+}
+
+// ForgetWebhookEvent removes an event that couldn't be handled, so the sender's retry is
+// handled afresh
+func ForgetWebhookEvent(db *database.DB, id string) error {
+	ctx, cancel := db.Context(database.Write)
+	defer cancel()
+
+	if _, err := db.Pool.Exec(ctx, `DELETE FROM webhook_events WHERE id = $1`, id); err != nil {
+		return dbError("forgetting webhook event", err)
+	}
+
+	return nil
+}
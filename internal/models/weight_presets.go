@@ -0,0 +1,149 @@
+package models
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ngenohkevin/kuiper_admin/internal/database"
+)
+
+// WeightPreset is a named list of weights, e.g. "Standard grams: 1,3.5,7,14,28",
+// applied in one click by the bulk variant creator
+type WeightPreset struct {
+	ID           string    `json:"id"`
+	Name         string    `json:"name"`
+	Weights      string    `json:"weights"`     // Comma-separated, as accepted by the bulk variant creator
+	CategoryID   *string   `json:"category_id"` // Nil for presets offered on every product
+	CategoryName string    `json:"category_name,omitempty"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+// NormalizeWeights checks a comma-separated weight list and returns it in canonical form,
+// e.g. " 1, 3.5g ,7" becomes "1,3.5,7"
+func NormalizeWeights(weights string) (string, error) {
+	var values []string
+	for _, weight := range strings.Split(weights, ",") {
+		weight = strings.TrimSuffix(strings.ToLower(strings.TrimSpace(weight)), "g")
+		if weight == "" {
+			continue
+		}
+		value, err := strconv.ParseFloat(weight, 64)
+		if err != nil || value <= 0 {
+			return "", fmt.Errorf("invalid weight %q", weight)
+		}
+		values = append(values, strconv.FormatFloat(value, 'f', -1, 64))
+	}
+	if len(values) == 0 {
+		return "", fmt.Errorf("at least one weight is required")
+	}
+	return strings.Join(values, ","), nil
+}
+
+// GetWeightPresets lists every preset, global ones first
+func GetWeightPresets(db *database.DB) ([]WeightPreset, error) {
+	return queryWeightPresets(db, `WHERE w.category_id IS NULL OR c.id IS NOT NULL`)
+}
+
+// GetWeightPresetsForCategory lists the global presets plus those for categoryID
+func GetWeightPresetsForCategory(db *database.DB, categoryID *string) ([]WeightPreset, error) {
+	return queryWeightPresets(db, `WHERE w.category_id IS NULL OR (c.id IS NOT NULL AND w.category_id = $1)`, categoryID)
+}
+
+// queryWeightPresets runs the preset query with the given WHERE clause.
+// Presets of soft-deleted categories are hidden by the join.
+func queryWeightPresets(db *database.DB, where string, args ...interface{}) ([]WeightPreset, error) {
+	ctx, cancel := db.Context(database.List)
+	defer cancel()
+
+	query := `
+		SELECT w.id, w.name, w.weights, w.category_id, COALESCE(c.name, ''), w.created_at
+		FROM weight_presets w
+		LEFT JOIN categories c ON c.id = w.category_id AND c.deleted_at IS NULL
+		` + where + `
+		ORDER BY w.category_id IS NOT NULL, c.name, w.name
+	`
+
+	rows, err := db.Pool.Query(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("error querying weight presets: %w", err)
+	}
+	defer rows.Close()
+
+	var presets []WeightPreset
+	for rows.Next() {
+		var p WeightPreset
+		if err := rows.Scan(&p.ID, &p.Name, &p.Weights, &p.CategoryID, &p.CategoryName, &p.CreatedAt); err != nil {
+			return nil, fmt.Errorf("error scanning weight preset row: %w", err)
+		}
+		presets = append(presets, p)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating weight preset rows: %w", err)
+	}
+
+	return presets, nil
+}
+
+// GetWeightPresetByID retrieves a single preset
+func GetWeightPresetByID(db *database.DB, id string) (WeightPreset, error) {
+	ctx, cancel := db.Context(database.Read)
+	defer cancel()
+
+	var p WeightPreset
+	err := db.Pool.QueryRow(ctx, `
+		SELECT id, name, weights, category_id, created_at
+		FROM weight_presets
+		WHERE id = $1
+	`, id).Scan(&p.ID, &p.Name, &p.Weights, &p.CategoryID, &p.CreatedAt)
+	if err != nil {
+		return WeightPreset{}, dbError("finding weight preset", err)
+	}
+
+	return p, nil
+}
+
+// CreateWeightPreset saves a new preset; categoryID nil makes it global
+func CreateWeightPreset(db *database.DB, name, weights string, categoryID *string) (WeightPreset, error) {
+	ctx, cancel := db.Context(database.Write)
+	defer cancel()
+
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return WeightPreset{}, fmt.Errorf("preset name is required")
+	}
+	weights, err := NormalizeWeights(weights)
+	if err != nil {
+		return WeightPreset{}, err
+	}
+
+	p := WeightPreset{Name: name, Weights: weights, CategoryID: categoryID}
+	err = db.Pool.QueryRow(ctx, `
+		INSERT INTO weight_presets (name, weights, category_id)
+		VALUES ($1, $2, $3)
+		RETURNING id, created_at
+	`, name, weights, categoryID).Scan(&p.ID, &p.CreatedAt)
+	if err != nil {
+		return WeightPreset{}, fmt.Errorf("error creating weight preset: %w", err)
+	}
+
+	return p, nil
+}
+
+// DeleteWeightPreset removes a preset
+func DeleteWeightPreset(db *database.DB, id string) error {
+	ctx, cancel := db.Context(database.Write)
+	defer cancel()
+
+	tag, err := db.Pool.Exec(ctx, `DELETE FROM weight_presets WHERE id = $1`, id)
+	if err != nil {
+		return dbError("deleting weight preset", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return notFound("weight preset not found")
+	}
+
+	return nil
+}
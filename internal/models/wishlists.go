@@ -0,0 +1,177 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/ngenohkevin/kuiper_admin/internal/database"
+)
+
+// Orders the wishlist report can be sorted in
+const (
+	WishlistSortWishlists = "wishlists" // Most wishlisted first
+	WishlistSortRecent    = "recent"    // Most added during the period first
+	WishlistSortShortfall = "shortfall" // Most wishlists beyond the stock on hand first
+	WishlistSortName      = "name"
+)
+
+// wishlistOrder is the ORDER BY of each wishlist sort
+var wishlistOrder = map[string]string{
+	WishlistSortWishlists: "wishlists DESC, name, variant_name",
+	WishlistSortRecent:    "recent DESC, wishlists DESC, name, variant_name",
+	WishlistSortShortfall: "GREATEST(wishlists - GREATEST(stock, 0), 0) DESC, wishlists DESC, name, variant_name",
+	WishlistSortName:      "name, variant_name",
+}
+
+// IsWishlistSort reports whether sort is one of the WishlistSort* constants
+func IsWishlistSort(sort string) bool {
+	_, ok := wishlistOrder[sort]
+	return ok
+}
+
+// AddWishlistItem records that the shopper holding sessionToken saved a product, or one of its
+// variants, to their wishlist at addedAt (now when zero). Saving it again keeps the first time.
+func AddWishlistItem(db *database.DB, sessionToken, productID, variantID string, addedAt time.Time) error {
+	productID, variantID = strings.TrimSpace(productID), strings.TrimSpace(variantID)
+	if productID == "" {
+		return fmt.Errorf("product id is required")
+	}
+	if addedAt.IsZero() {
+		addedAt = time.Now()
+	}
+
+	ctx, cancel := db.Context(database.Write)
+	defer cancel()
+
+	sessionID, err := sessionIDForToken(ctx, db, sessionToken)
+	if err != nil {
+		return err
+	}
+
+	_, err = db.Pool.Exec(ctx, `
+		INSERT INTO wishlist_items (session_id, product_id, variant_id, added_at)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (session_id, product_id, variant_id) DO NOTHING
+	`, sessionID, productID, variantID, addedAt)
+	if err = dbError("adding wishlist item", err); errors.Is(err, ErrConflict) {
+		return notFound("unknown product")
+	}
+	return err
+}
+
+// RemoveWishlistItem records that the shopper holding sessionToken took a product, or one of its
+// variants, off their wishlist. Removing something that isn't on it does nothing.
+func RemoveWishlistItem(db *database.DB, sessionToken, productID, variantID string) error {
+	ctx, cancel := db.Context(database.Write)
+	defer cancel()
+
+	sessionID, err := sessionIDForToken(ctx, db, sessionToken)
+	if err != nil {
+		return err
+	}
+
+	_, err = db.Pool.Exec(ctx, `
+		DELETE FROM wishlist_items
+		WHERE session_id = $1 AND product_id::text = $2 AND variant_id = $3
+	`, sessionID, strings.TrimSpace(productID), strings.TrimSpace(variantID))
+	if err != nil {
+		return dbError("removing wishlist item", err)
+	}
+	return nil
+}
+
+// WishlistRow is a product, or one variant of it, on shoppers' wishlists
+type WishlistRow struct {
+	ProductID   string    `json:"product_id"`
+	ProductName string    `json:"product_name"`
+	VariantID   string    `json:"variant_id"` // Empty when saved as the product rather than a variant
+	VariantName string    `json:"variant_name"`
+	SKU         string    `json:"sku"`
+	Stock       int       `json:"stock"`
+	Available   bool      `json:"available"`
+	Wishlists   int       `json:"wishlists"` // Shoppers with it on their wishlist now
+	Recent      int       `json:"recent"`    // Of those, how many added it during the period
+	LastAddedAt time.Time `json:"last_added_at"`
+	Shortfall   int       `json:"shortfall"` // Wishlists beyond the stock on hand
+}
+
+// Wishlists is the wishlist report: what shoppers have saved, with Recent counting what was
+// added in the last Days days
+type Wishlists struct {
+	Days     int           `json:"days"`
+	Sort     string        `json:"sort"`
+	Rows     []WishlistRow `json:"rows"`
+	Shoppers int           `json:"shoppers"` // With anything on their wishlist
+	Items    int           `json:"items"`
+}
+
+// GetWishlists lists the products and variants on shoppers' wishlists with the stock on hand,
+// for deciding what to restock. Products in the trash are left out.
+func GetWishlists(db *database.DB, days int, sort string) (Wishlists, error) {
+	if days <= 0 {
+		return Wishlists{}, fmt.Errorf("days must be a positive number")
+	}
+	order, ok := wishlistOrder[sort]
+	if !ok {
+		sort, order = WishlistSortWishlists, wishlistOrder[WishlistSortWishlists]
+	}
+
+	ctx, cancel := db.Context(database.List)
+	defer cancel()
+
+	report := Wishlists{Days: days, Sort: sort, Rows: []WishlistRow{}}
+	err := db.Pool.QueryRow(ctx, `
+		SELECT COUNT(DISTINCT w.session_id), COUNT(*)
+		FROM wishlist_items w
+		JOIN products p ON p.id = w.product_id
+		WHERE p.deleted_at IS NULL
+	`).Scan(&report.Shoppers, &report.Items)
+	if err != nil {
+		return report, dbError("counting wishlists", err)
+	}
+
+	rows, err := db.Pool.Query(ctx, `
+		SELECT product_id, name, variant_id, variant_name, sku, stock, available, wishlists, recent, last_added_at
+		FROM (
+		    SELECT p.id::text AS product_id, p.name, w.variant_id, COALESCE(v.name, '') AS variant_name,
+		           COALESCE(p.sku, '') AS sku,
+		           CASE WHEN w.variant_id = '' THEN COALESCE(p.stock_count, 0) ELSE COALESCE(v.stock, 0) END AS stock,
+		           COALESCE(p.is_available, false) AND p.archived_at IS NULL AS available,
+		           COUNT(*) AS wishlists,
+		           COUNT(*) FILTER (WHERE w.added_at >= $1) AS recent,
+		           MAX(w.added_at) AS last_added_at
+		    FROM wishlist_items w
+		    JOIN products p ON p.id = w.product_id
+		    LEFT JOIN LATERAL (
+		        SELECT e->>'name' AS name, COALESCE((e->>'stock_count')::int, 0) AS stock
+		        FROM jsonb_array_elements(
+		            CASE WHEN jsonb_typeof(p.variants) = 'array' THEN p.variants ELSE '[]'::jsonb END
+		        ) AS e
+		        WHERE e->>'id' = w.variant_id
+		        LIMIT 1
+		    ) v ON w.variant_id <> ''
+		    WHERE p.deleted_at IS NULL
+		    GROUP BY p.id, p.name, p.sku, p.stock_count, p.is_available, p.archived_at, w.variant_id, v.name, v.stock
+		) wished
+		ORDER BY `+order, time.Now().AddDate(0, 0, -days))
+	if err != nil {
+		return report, dbError("getting wishlists", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var row WishlistRow
+		if err := rows.Scan(&row.ProductID, &row.ProductName, &row.VariantID, &row.VariantName, &row.SKU,
+			&row.Stock, &row.Available, &row.Wishlists, &row.Recent, &row.LastAddedAt); err != nil {
+			return report, fmt.Errorf("error scanning wishlists: %w", err)
+		}
+		row.Shortfall = max(row.Wishlists-max(row.Stock, 0), 0)
+		report.Rows = append(report.Rows, row)
+	}
+	if err := rows.Err(); err != nil {
+		return report, fmt.Errorf("error iterating wishlists: %w", err)
+	}
+	return report, nil
+}
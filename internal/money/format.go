@@ -0,0 +1,58 @@
+package money
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// Symbol is the currency symbol prices are shown with. Override with CURRENCY_SYMBOL.
+func Symbol() string {
+	if s := os.Getenv("CURRENCY_SYMBOL"); s != "" {
+		return s
+	}
+	return "$"
+}
+
+// Format renders the amount for display with the currency symbol and thousand
+// separators, e.g. "$1,234.50" or "-$0.05"
+func (a Amount) Format() string {
+	sign := ""
+	cents := int64(a)
+	if cents < 0 {
+		sign = "-"
+		cents = -cents
+	}
+
+	whole := fmt.Sprintf("%d", cents/100)
+	var grouped strings.Builder
+	for i, digit := range whole {
+		if i > 0 && (len(whole)-i)%3 == 0 {
+			grouped.WriteByte(',')
+		}
+		grouped.WriteRune(digit)
+	}
+	return fmt.Sprintf("%s%s%s.%02d", sign, Symbol(), grouped.String(), cents%100)
+}
+
+// inputPattern is a price typed into a form: digits with at most two decimals after a dot
+var inputPattern = regexp.MustCompile(`^\d+(\.\d{1,2})?$`)
+
+// ParseInput reads a price typed by an admin. Unlike Parse it rejects anything that could
+// be read two ways: "1,500" is 1500 in some locales and 1.5 in others, so commas, spaces,
+// currency symbols and more than two decimals are refused rather than guessed at.
+func ParseInput(s string) (Amount, error) {
+	s = strings.TrimSpace(s)
+	switch {
+	case s == "":
+		return 0, fmt.Errorf("price is required")
+	case strings.Contains(s, ","):
+		return 0, fmt.Errorf("price %q is ambiguous: use a dot for decimals and no thousand separators", s)
+	case strings.HasPrefix(s, "-"):
+		return 0, fmt.Errorf("price cannot be negative")
+	case !inputPattern.MatchString(s):
+		return 0, fmt.Errorf("price %q must be a number with at most two decimals, e.g. 1500 or 12.99", s)
+	}
+	return Parse(s)
+}
@@ -0,0 +1,156 @@
+// Package money holds prices as a whole number of cents so sums, comparisons and
+// round trips through forms, JSON and the database are exact.
+package money
+
+import (
+	"database/sql/driver"
+	"fmt"
+	"math"
+	"math/big"
+	"strconv"
+	"strings"
+
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+// Amount is a price in cents
+type Amount int64
+
+// Zero is no money
+const Zero Amount = 0
+
+// Parse reads a decimal price such as "12", "12.5" or "-3.99". Digits past the cents
+// are rounded half away from zero, decimal by decimal, without going through a float.
+func Parse(s string) (Amount, error) {
+	s = strings.TrimSpace(s)
+	if strings.ContainsAny(s, "eE") {
+		// Exponents only come from JSON numbers written by other tools
+		f, err := strconv.ParseFloat(s, 64)
+		if err != nil || math.IsInf(f, 0) || math.IsNaN(f) {
+			return 0, fmt.Errorf("invalid amount %q", s)
+		}
+		return FromFloat(f), nil
+	}
+
+	negative := strings.HasPrefix(s, "-")
+	digits := strings.TrimPrefix(strings.TrimPrefix(s, "-"), "+")
+	whole, frac, _ := strings.Cut(digits, ".")
+	if (whole == "" && frac == "") || !allDigits(whole) || !allDigits(frac) {
+		return 0, fmt.Errorf("invalid amount %q", s)
+	}
+
+	roundUp := len(frac) > 2 && frac[2] >= '5'
+	frac = (frac + "00")[:2]
+	if whole == "" {
+		whole = "0"
+	}
+	if len(whole) > 16 {
+		return 0, fmt.Errorf("amount %q is too large", s)
+	}
+
+	cents, err := strconv.ParseInt(whole+frac, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid amount %q", s)
+	}
+	if roundUp {
+		cents++
+	}
+	if negative {
+		cents = -cents
+	}
+	return Amount(cents), nil
+}
+
+func allDigits(s string) bool {
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// FromFloat converts a float price to the nearest cent
+func FromFloat(f float64) Amount {
+	return Amount(math.Round(f * 100))
+}
+
+// Cents returns the amount as a whole number of cents
+func (a Amount) Cents() int64 {
+	return int64(a)
+}
+
+// Float64 returns the amount in currency units, for display maths such as percentages
+func (a Amount) Float64() float64 {
+	return float64(a) / 100
+}
+
+// String formats the amount with two decimals, e.g. "12.50" or "-0.05"
+func (a Amount) String() string {
+	sign := ""
+	cents := int64(a)
+	if cents < 0 {
+		sign = "-"
+		cents = -cents
+	}
+	return fmt.Sprintf("%s%d.%02d", sign, cents/100, cents%100)
+}
+
+// Percent changes the amount by pct percent, rounded to the nearest cent
+func (a Amount) Percent(pct float64) Amount {
+	return Amount(math.Round(float64(a) * (100 + pct) / 100))
+}
+
+// MarshalJSON writes the amount as a JSON number with two decimals, as prices always were
+func (a Amount) MarshalJSON() ([]byte, error) {
+	return []byte(a.String()), nil
+}
+
+// UnmarshalJSON reads a JSON number, or a string holding one, exactly
+func (a *Amount) UnmarshalJSON(data []byte) error {
+	s := strings.Trim(string(data), `"`)
+	if s == "null" || s == "" {
+		*a = 0
+		return nil
+	}
+	parsed, err := Parse(s)
+	if err != nil {
+		return err
+	}
+	*a = parsed
+	return nil
+}
+
+// Scan reads a NUMERIC column, which pgx hands over as its text form
+func (a *Amount) Scan(src any) error {
+	switch v := src.(type) {
+	case nil:
+		*a = 0
+	case string:
+		parsed, err := Parse(v)
+		if err != nil {
+			return err
+		}
+		*a = parsed
+	case []byte:
+		return a.Scan(string(v))
+	case int64:
+		*a = Amount(v * 100)
+	case float64:
+		*a = FromFloat(v)
+	default:
+		return fmt.Errorf("cannot scan %T into money.Amount", src)
+	}
+	return nil
+}
+
+// NumericValue lets pgx write the amount to a NUMERIC column as an exact decimal.
+// Without it pgx would see an int64 and store the cents as whole units.
+func (a Amount) NumericValue() (pgtype.Numeric, error) {
+	return pgtype.Numeric{Int: big.NewInt(int64(a)), Exp: -2, Valid: true}, nil
+}
+
+// Value writes the amount as a decimal string for database/sql drivers
+func (a Amount) Value() (driver.Value, error) {
+	return a.String(), nil
+}
@@ -0,0 +1,268 @@
+// Package secrets fills in the dashboard's secret settings from where deployments keep them
+// other than plain environment variables: a file named by NAME_FILE, a Docker secret, or a
+// HashiCorp Vault KV secret. A secret found in one of them is set in the environment, so the
+// code reading it with os.Getenv doesn't need to know where it came from.
+package secrets
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Where a secret was found, in the order they're tried
+const (
+	SourceEnv     = "environment"
+	SourceFile    = "file"
+	SourceDocker  = "docker secret"
+	SourceVault   = "vault"
+	SourceMissing = "" // Not found anywhere
+)
+
+// defaultDockerDir is where Docker and Compose mount secrets. Override with SECRETS_DIR.
+const defaultDockerDir = "/run/secrets"
+
+// Secret describes where one secret setting was found. The value itself is never kept here.
+type Secret struct {
+	Name     string `json:"name"`
+	Required bool   `json:"required"`           // The dashboard can't start without it
+	Source   string `json:"source"`             // One of the Source* constants
+	Location string `json:"location,omitempty"` // The file or Vault path it was read from
+	Error    string `json:"error,omitempty"`    // Why a source that should have held it couldn't be read
+}
+
+// Found reports whether the secret has a value
+func (s Secret) Found() bool {
+	return s.Source != SourceMissing
+}
+
+// Describe says where the secret came from, e.g. "file /run/secrets/smtp_password"
+func (s Secret) Describe() string {
+	switch {
+	case !s.Found():
+		return "not set"
+	case s.Location != "":
+		return s.Source + " " + s.Location
+	}
+	return s.Source
+}
+
+// Settings are the secret settings, in the order the report lists them
+var Settings = []struct {
+	Name     string
+	Required bool
+}{
+	{"DATABASE_URL", true},
+	{"ADMIN_PASSWORD", false},
+	{"STOREFRONT_WEBHOOK_SECRET", false},
+	{"SMTP_USERNAME", false},
+	{"SMTP_PASSWORD", false},
+	{"BG_REMOVAL_API_KEY", false},
+	{"CHAT_WEBHOOK_URL", false},
+	{"WMS_API_KEY", false},
+	{"SHIPPING_API_KEY", false},
+	{"S3_SECRET_ACCESS_KEY", false},
+	{"SUPABASE_SERVICE_KEY", false},
+}
+
+var (
+	mu     sync.RWMutex
+	report []Secret
+)
+
+// Load looks for each secret setting that isn't in the environment already, in a file named by
+// NAME_FILE, then among the Docker secrets, then in Vault when VAULT_ADDR is set, and sets the
+// ones it finds. It returns where each was found, which Report returns from then on.
+func Load() []Secret {
+	secrets := make([]Secret, len(Settings))
+	missing := false
+	for i, setting := range Settings {
+		s := Secret{Name: setting.Name, Required: setting.Required}
+		if os.Getenv(setting.Name) != "" {
+			s.Source = SourceEnv
+		} else if value, location, err := fromFile(setting.Name); err != nil {
+			s.Error = err.Error()
+		} else if location != "" {
+			s.Source, s.Location = SourceFile, location
+			os.Setenv(setting.Name, value)
+		} else if value, location := fromDocker(setting.Name); location != "" {
+			s.Source, s.Location = SourceDocker, location
+			os.Setenv(setting.Name, value)
+		}
+		missing = missing || !s.Found()
+		secrets[i] = s
+	}
+
+	// Vault is only asked for what nothing local provided, so it needn't be up for a
+	// deployment that has everything it needs
+	if missing && os.Getenv("VAULT_ADDR") != "" {
+		ctx, cancel := context.WithTimeout(context.Background(), vaultTimeout)
+		defer cancel()
+		values, path, err := fromVault(ctx)
+		if err != nil {
+			log.Printf("Error reading secrets from Vault: %v", err)
+		}
+		for i := range secrets {
+			s := &secrets[i]
+			if value, ok := lookupKey(values, s.Name); ok && !s.Found() {
+				s.Source, s.Location = SourceVault, path
+				os.Setenv(s.Name, value)
+			}
+		}
+	}
+
+	mu.Lock()
+	report = secrets
+	mu.Unlock()
+	return secrets
+}
+
+// Report is where each secret setting was found by the last Load
+func Report() []Secret {
+	mu.RLock()
+	defer mu.RUnlock()
+	return report
+}
+
+// Lookup is where the last Load found the named secret, and whether it's a secret setting
+func Lookup(name string) (Secret, bool) {
+	for _, s := range Report() {
+		if s.Name == name {
+			return s, true
+		}
+	}
+	return Secret{}, false
+}
+
+// LogReport logs where each secret was found, and any that couldn't be read or are required
+// and missing. It returns false when a required secret is missing.
+func LogReport(secrets []Secret) bool {
+	ok := true
+	var found []string
+	for _, s := range secrets {
+		if s.Error != "" {
+			log.Printf("Secret %s couldn't be read: %s", s.Name, s.Error)
+		}
+		if s.Found() {
+			found = append(found, s.Name+" from "+s.Describe())
+		} else if s.Required {
+			log.Printf("Secret %s is required but was not found in the environment, a %s_FILE, Docker secrets or Vault", s.Name, s.Name)
+			ok = false
+		}
+	}
+	if len(found) > 0 {
+		log.Printf("Secrets: %s", strings.Join(found, ", "))
+	}
+	return ok
+}
+
+// fromFile reads the secret from the file NAME_FILE names, if it's set. A trailing newline, as
+// most editors and echo leave, isn't part of the value.
+func fromFile(name string) (string, string, error) {
+	path := strings.TrimSpace(os.Getenv(name + "_FILE"))
+	if path == "" {
+		return "", "", nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", "", fmt.Errorf("%s_FILE: %w", name, err)
+	}
+	value := strings.TrimRight(string(data), "\r\n")
+	if value == "" {
+		return "", "", fmt.Errorf("%s_FILE: %s is empty", name, path)
+	}
+	return value, path, nil
+}
+
+// fromDocker reads the secret from the Docker secrets directory, named as the setting is in
+// lowercase or as it is
+func fromDocker(name string) (string, string) {
+	dir := os.Getenv("SECRETS_DIR")
+	if dir == "" {
+		dir = defaultDockerDir
+	}
+	for _, file := range []string{strings.ToLower(name), name} {
+		path := filepath.Join(dir, file)
+		data, err := os.ReadFile(path)
+		if err != nil {
+			continue
+		}
+		if value := strings.TrimRight(string(data), "\r\n"); value != "" {
+			return value, path
+		}
+	}
+	return "", ""
+}
+
+// vaultTimeout bounds the request to Vault at startup
+const vaultTimeout = 10 * time.Second
+
+// fromVault reads the key-value secret at VAULT_SECRET_PATH from the Vault server at
+// VAULT_ADDR with VAULT_TOKEN, or the token in VAULT_TOKEN_FILE. The path is read as given,
+// so a version 2 KV engine needs its data segment, e.g. secret/data/ganymede-admin.
+func fromVault(ctx context.Context) (map[string]interface{}, string, error) {
+	addr := strings.TrimRight(os.Getenv("VAULT_ADDR"), "/")
+	path := strings.Trim(os.Getenv("VAULT_SECRET_PATH"), "/")
+	if path == "" {
+		return nil, "", fmt.Errorf("vault: VAULT_SECRET_PATH is not set")
+	}
+	token := os.Getenv("VAULT_TOKEN")
+	if token == "" {
+		var err error
+		if token, _, err = fromFile("VAULT_TOKEN"); err != nil {
+			return nil, path, fmt.Errorf("vault: %w", err)
+		}
+	}
+	if token == "" {
+		return nil, path, fmt.Errorf("vault: set VAULT_TOKEN or VAULT_TOKEN_FILE")
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, addr+"/v1/"+path, nil)
+	if err != nil {
+		return nil, path, fmt.Errorf("vault: %w", err)
+	}
+	req.Header.Set("X-Vault-Token", token)
+	if namespace := os.Getenv("VAULT_NAMESPACE"); namespace != "" {
+		req.Header.Set("X-Vault-Namespace", namespace)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, path, fmt.Errorf("vault: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return nil, path, fmt.Errorf("vault returned %s for %s: %s", resp.Status, path, strings.TrimSpace(string(msg)))
+	}
+
+	var body struct {
+		Data map[string]interface{} `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return nil, path, fmt.Errorf("vault: error reading %s: %w", path, err)
+	}
+	// Version 2 KV engines nest the values under data.data along with metadata
+	if nested, ok := body.Data["data"].(map[string]interface{}); ok {
+		return nested, path, nil
+	}
+	return body.Data, path, nil
+}
+
+// lookupKey finds a setting among a Vault secret's keys, named as it is or in lowercase
+func lookupKey(values map[string]interface{}, name string) (string, bool) {
+	for _, key := range []string{name, strings.ToLower(name)} {
+		if value, ok := values[key].(string); ok && value != "" {
+			return value, true
+		}
+	}
+	return "", false
+}
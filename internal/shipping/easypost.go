@@ -0,0 +1,214 @@
+package shipping
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// easyPostURL is EasyPost's API
+const easyPostURL = "https://api.easypost.com/v2"
+
+// easyPost buys labels through EasyPost, authenticating with the API key as the basic-auth user.
+// EasyPost measures parcels in ounces and inches.
+type easyPost struct {
+	apiKey string
+}
+
+func (p *easyPost) Name() string { return ProviderEasyPost }
+
+// easyPostRate is a rate as EasyPost sends it, on a shipment or as the one bought
+type easyPostRate struct {
+	ID           string `json:"id"`
+	ShipmentID   string `json:"shipment_id"`
+	Carrier      string `json:"carrier"`
+	Service      string `json:"service"`
+	Rate         string `json:"rate"`
+	Currency     string `json:"currency"`
+	DeliveryDays *int   `json:"delivery_days"`
+}
+
+// easyPostShipment is the part of an EasyPost shipment read back
+type easyPostShipment struct {
+	ID           string         `json:"id"`
+	Rates        []easyPostRate `json:"rates"`
+	TrackingCode string         `json:"tracking_code"`
+	PostageLabel struct {
+		LabelURL string `json:"label_url"`
+	} `json:"postage_label"`
+	SelectedRate easyPostRate `json:"selected_rate"`
+}
+
+func (p *easyPost) Rates(ctx context.Context, s Shipment) ([]Rate, error) {
+	req := map[string]interface{}{"shipment": map[string]interface{}{
+		"from_address": s.From,
+		"to_address":   s.To,
+		"parcel": map[string]float64{
+			"weight": roundTenth(s.Parcel.WeightGrams / 28.3495),
+			"length": roundTenth(s.Parcel.LengthCM / 2.54),
+			"width":  roundTenth(s.Parcel.WidthCM / 2.54),
+			"height": roundTenth(s.Parcel.HeightCM / 2.54),
+		},
+	}}
+	var shipment easyPostShipment
+	if err := p.do(ctx, http.MethodPost, "/shipments", req, &shipment); err != nil {
+		return nil, fmt.Errorf("error getting EasyPost rates: %w", err)
+	}
+
+	rates := make([]Rate, 0, len(shipment.Rates))
+	for _, r := range shipment.Rates {
+		rate := Rate{
+			ID: r.ID, ShipmentID: shipment.ID, Carrier: r.Carrier, CarrierCode: r.Carrier,
+			Service: r.Service, Amount: r.Rate, Currency: r.Currency,
+		}
+		if r.DeliveryDays != nil {
+			rate.Days = *r.DeliveryDays
+		}
+		rates = append(rates, rate)
+	}
+	sortByAmount(rates)
+	return rates, nil
+}
+
+func (p *easyPost) Buy(ctx context.Context, rate Rate) (Label, error) {
+	var shipment easyPostShipment
+	req := map[string]interface{}{"rate": map[string]string{"id": rate.ID}}
+	if err := p.do(ctx, http.MethodPost, "/shipments/"+rate.ShipmentID+"/buy", req, &shipment); err != nil {
+		return Label{}, fmt.Errorf("error buying EasyPost label: %w", err)
+	}
+	return Label{
+		Carrier:        shipment.SelectedRate.Carrier,
+		CarrierCode:    shipment.SelectedRate.Carrier,
+		Service:        shipment.SelectedRate.Service,
+		TrackingNumber: shipment.TrackingCode,
+		LabelURL:       shipment.PostageLabel.LabelURL,
+		Amount:         shipment.SelectedRate.Rate,
+		Currency:       shipment.SelectedRate.Currency,
+		ShipmentID:     shipment.ID,
+	}, nil
+}
+
+// easyPostStatuses maps EasyPost's tracking statuses to ours
+var easyPostStatuses = map[string]string{
+	"pre_transit":          StatusPreTransit,
+	"in_transit":           StatusInTransit,
+	"out_for_delivery":     StatusOutForDelivery,
+	"available_for_pickup": StatusOutForDelivery,
+	"delivered":            StatusDelivered,
+	"return_to_sender":     StatusReturned,
+	"failure":              StatusFailure,
+	"cancelled":            StatusFailure,
+	"error":                StatusFailure,
+}
+
+func (p *easyPost) Track(ctx context.Context, carrierCode, trackingNumber string) (Tracking, error) {
+	// Creating a tracker for a code EasyPost already tracks returns the existing one
+	req := map[string]interface{}{"tracker": map[string]string{"tracking_code": trackingNumber, "carrier": carrierCode}}
+	var tracker struct {
+		Status          string    `json:"status"`
+		StatusDetail    string    `json:"status_detail"`
+		UpdatedAt       time.Time `json:"updated_at"`
+		TrackingDetails []struct {
+			Datetime time.Time `json:"datetime"`
+			Message  string    `json:"message"`
+			Status   string    `json:"status"`
+			Location struct {
+				City    string `json:"city"`
+				State   string `json:"state"`
+				Country string `json:"country"`
+			} `json:"tracking_location"`
+		} `json:"tracking_details"`
+	}
+	if err := p.do(ctx, http.MethodPost, "/trackers", req, &tracker); err != nil {
+		return Tracking{}, fmt.Errorf("error tracking %s with EasyPost: %w", trackingNumber, err)
+	}
+
+	t := Tracking{Status: mapStatus(easyPostStatuses, tracker.Status), Detail: tracker.StatusDetail, UpdatedAt: tracker.UpdatedAt}
+	for _, d := range tracker.TrackingDetails {
+		t.Events = append(t.Events, TrackingEvent{
+			At: d.Datetime, Status: mapStatus(easyPostStatuses, d.Status), Message: d.Message,
+			Location: joinLocation(d.Location.City, d.Location.State, d.Location.Country),
+		})
+	}
+	if n := len(t.Events); n > 0 && t.Events[n-1].Message != "" {
+		t.Detail = t.Events[n-1].Message
+	}
+	return t, nil
+}
+
+// do sends a JSON request to EasyPost and decodes the response into out
+func (p *easyPost) do(ctx context.Context, method, path string, body, out interface{}) error {
+	payload, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, method, easyPostURL+path, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.SetBasicAuth(p.apiKey, "")
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, 4<<20))
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return apiError("EasyPost", resp, data)
+	}
+	return json.Unmarshal(data, out)
+}
+
+// roundTenth rounds to one decimal place, as the providers expect measurements
+func roundTenth(f float64) float64 {
+	return math.Round(f*10) / 10
+}
+
+// sortByAmount puts the cheapest rate first. Amounts that don't parse go last.
+func sortByAmount(rates []Rate) {
+	amount := func(r Rate) float64 {
+		f, err := strconv.ParseFloat(r.Amount, 64)
+		if err != nil {
+			return math.Inf(1)
+		}
+		return f
+	}
+	sort.SliceStable(rates, func(i, j int) bool { return amount(rates[i]) < amount(rates[j]) })
+}
+
+// mapStatus looks a provider's status up in statuses, falling back to StatusUnknown
+func mapStatus(statuses map[string]string, status string) string {
+	if s, ok := statuses[status]; ok {
+		return s
+	}
+	return StatusUnknown
+}
+
+// joinLocation writes a place as "City, State, Country", leaving out the parts not given
+func joinLocation(parts ...string) string {
+	location := ""
+	for _, part := range parts {
+		if part == "" {
+			continue
+		}
+		if location != "" {
+			location += ", "
+		}
+		location += part
+	}
+	return location
+}
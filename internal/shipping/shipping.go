@@ -0,0 +1,244 @@
+// Package shipping buys postage labels and follows parcels through a shipping API: EasyPost or
+// Shippo, chosen by SHIPPING_PROVIDER. Both are asked the same three things: the rates to send
+// a parcel from the store to an address, the label for one of those rates, and where a tracking
+// number has got to.
+package shipping
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// The providers SHIPPING_PROVIDER chooses between
+const (
+	ProviderEasyPost = "easypost"
+	ProviderShippo   = "shippo"
+)
+
+// Tracking statuses, the same whichever provider reported them
+const (
+	StatusPreTransit     = "pre_transit" // Label bought, parcel not yet with the carrier
+	StatusInTransit      = "in_transit"
+	StatusOutForDelivery = "out_for_delivery"
+	StatusDelivered      = "delivered"
+	StatusReturned       = "returned"
+	StatusFailure        = "failure" // Lost, damaged or undeliverable
+	StatusUnknown        = "unknown" // The carrier hasn't said anything yet
+)
+
+// Done reports whether a parcel in status has stopped moving, so it needn't be tracked any more
+func Done(status string) bool {
+	return status == StatusDelivered || status == StatusReturned || status == StatusFailure
+}
+
+// ErrDisabled is returned by the provider New gives while SHIPPING_PROVIDER is empty
+var ErrDisabled = errors.New("shipping labels aren't set up: set SHIPPING_PROVIDER and SHIPPING_API_KEY")
+
+// Address is where a parcel is sent from or to
+type Address struct {
+	Name    string `json:"name"`
+	Street1 string `json:"street1"`
+	Street2 string `json:"street2,omitempty"`
+	City    string `json:"city"`
+	State   string `json:"state,omitempty"`
+	Zip     string `json:"zip"`
+	Country string `json:"country"` // ISO 3166 alpha-2, as in "KE"
+	Phone   string `json:"phone,omitempty"`
+	Email   string `json:"email,omitempty"`
+}
+
+// Parcel is the packed box, in grams and centimetres
+type Parcel struct {
+	WeightGrams float64 `json:"weight_grams"`
+	LengthCM    float64 `json:"length_cm"`
+	WidthCM     float64 `json:"width_cm"`
+	HeightCM    float64 `json:"height_cm"`
+}
+
+// Validate checks the parcel has a weight and all three dimensions
+func (p Parcel) Validate() error {
+	if p.WeightGrams <= 0 || p.LengthCM <= 0 || p.WidthCM <= 0 || p.HeightCM <= 0 {
+		return errors.New("a parcel needs a weight, length, width and height above zero")
+	}
+	return nil
+}
+
+// Shipment is a parcel going from one address to another
+type Shipment struct {
+	From   Address
+	To     Address
+	Parcel Parcel
+}
+
+// Rate is one way a provider offers to send a shipment. It is passed back to Buy as it came.
+type Rate struct {
+	ID          string `json:"id"`
+	ShipmentID  string `json:"shipment_id"`  // The provider's shipment the rate belongs to
+	Carrier     string `json:"carrier"`      // For people, as in "USPS" or "DHL Express"
+	CarrierCode string `json:"carrier_code"` // For the provider's tracking API
+	Service     string `json:"service"`
+	Amount      string `json:"amount"` // Decimal, in Currency
+	Currency    string `json:"currency"`
+	Days        int    `json:"days,omitempty"` // Estimated days in transit, 0 when not known
+}
+
+// Label is a bought postage label
+type Label struct {
+	Carrier        string `json:"carrier"`
+	CarrierCode    string `json:"carrier_code"`
+	Service        string `json:"service"`
+	TrackingNumber string `json:"tracking_number"`
+	LabelURL       string `json:"label_url"` // Where the printable label is downloaded from
+	Amount         string `json:"amount"`    // What was paid, decimal, in Currency
+	Currency       string `json:"currency"`
+	ShipmentID     string `json:"shipment_id"`
+}
+
+// Tracking is where a parcel has got to
+type Tracking struct {
+	Status    string          `json:"status"` // One of the Status* constants
+	Detail    string          `json:"detail"` // The carrier's latest message
+	UpdatedAt time.Time       `json:"updated_at"`
+	Events    []TrackingEvent `json:"events"` // Oldest first
+}
+
+// TrackingEvent is one scan or message in a parcel's history
+type TrackingEvent struct {
+	At       time.Time `json:"at"`
+	Status   string    `json:"status"`
+	Message  string    `json:"message"`
+	Location string    `json:"location,omitempty"`
+}
+
+// Provider is a shipping API
+type Provider interface {
+	// Name is the kind of provider, one of the Provider* constants
+	Name() string
+	// Rates quotes the ways the provider can send a shipment, cheapest first
+	Rates(ctx context.Context, s Shipment) ([]Rate, error)
+	// Buy buys the label for a rate Rates returned
+	Buy(ctx context.Context, rate Rate) (Label, error)
+	// Track reads where a parcel has got to
+	Track(ctx context.Context, carrierCode, trackingNumber string) (Tracking, error)
+}
+
+// Config holds the shipping settings
+type Config struct {
+	Provider         string // One of the Provider* constants, empty to turn labels off
+	APIKey           string
+	From             Address       // The store's return address, printed on every label
+	TrackingInterval time.Duration // How often a parcel's tracking is read
+}
+
+// ConfigFromEnv reads SHIPPING_PROVIDER, SHIPPING_API_KEY, the return address from
+// SHIPPING_FROM_NAME, SHIPPING_FROM_STREET1, SHIPPING_FROM_STREET2, SHIPPING_FROM_CITY,
+// SHIPPING_FROM_STATE, SHIPPING_FROM_ZIP, SHIPPING_FROM_COUNTRY, SHIPPING_FROM_PHONE and
+// SHIPPING_FROM_EMAIL, and SHIPPING_TRACKING_INTERVAL_MINUTES (60 by default)
+func ConfigFromEnv() Config {
+	cfg := Config{
+		Provider: strings.ToLower(strings.TrimSpace(os.Getenv("SHIPPING_PROVIDER"))),
+		APIKey:   os.Getenv("SHIPPING_API_KEY"),
+		From: Address{
+			Name:    os.Getenv("SHIPPING_FROM_NAME"),
+			Street1: os.Getenv("SHIPPING_FROM_STREET1"),
+			Street2: os.Getenv("SHIPPING_FROM_STREET2"),
+			City:    os.Getenv("SHIPPING_FROM_CITY"),
+			State:   os.Getenv("SHIPPING_FROM_STATE"),
+			Zip:     os.Getenv("SHIPPING_FROM_ZIP"),
+			Country: strings.ToUpper(os.Getenv("SHIPPING_FROM_COUNTRY")),
+			Phone:   os.Getenv("SHIPPING_FROM_PHONE"),
+			Email:   os.Getenv("SHIPPING_FROM_EMAIL"),
+		},
+		TrackingInterval: time.Hour,
+	}
+	if s := os.Getenv("SHIPPING_TRACKING_INTERVAL_MINUTES"); s != "" {
+		if minutes, err := strconv.Atoi(s); err == nil && minutes > 0 {
+			cfg.TrackingInterval = time.Duration(minutes) * time.Minute
+		}
+	}
+	return cfg
+}
+
+// Enabled reports whether a provider is chosen
+func (c Config) Enabled() bool {
+	return c.Provider != ""
+}
+
+// New returns the provider cfg chooses. When a setting it needs is missing, the error says
+// which and the provider returned fails every call with it, so the dashboard still starts and
+// only labels are affected.
+func New(cfg Config) (Provider, error) {
+	var missing []string
+	need := func(name, value string) {
+		if value == "" {
+			missing = append(missing, name)
+		}
+	}
+
+	var provider Provider
+	switch cfg.Provider {
+	case "":
+		return brokenProvider{err: ErrDisabled}, nil
+	case ProviderEasyPost:
+		provider = &easyPost{apiKey: cfg.APIKey}
+	case ProviderShippo:
+		provider = &shippo{apiKey: cfg.APIKey}
+	default:
+		err := fmt.Errorf("unknown SHIPPING_PROVIDER %q; use easypost or shippo", cfg.Provider)
+		return brokenProvider{name: cfg.Provider, err: err}, err
+	}
+	need("SHIPPING_API_KEY", cfg.APIKey)
+	need("SHIPPING_FROM_STREET1", cfg.From.Street1)
+	need("SHIPPING_FROM_CITY", cfg.From.City)
+	need("SHIPPING_FROM_ZIP", cfg.From.Zip)
+	need("SHIPPING_FROM_COUNTRY", cfg.From.Country)
+
+	if len(missing) > 0 {
+		err := fmt.Errorf("%s labels need %s", cfg.Provider, strings.Join(missing, ", "))
+		return brokenProvider{name: cfg.Provider, err: err}, err
+	}
+	return provider, nil
+}
+
+// FromEnv returns the provider the environment chooses; see ConfigFromEnv and New
+func FromEnv() (Provider, error) {
+	return New(ConfigFromEnv())
+}
+
+// client makes the requests to the providers. Buying a label can take a few seconds.
+var client = &http.Client{Timeout: 30 * time.Second}
+
+// brokenProvider stands in for a provider that is turned off or missing settings
+type brokenProvider struct {
+	name string
+	err  error
+}
+
+func (p brokenProvider) Name() string { return p.name }
+
+func (p brokenProvider) Rates(ctx context.Context, s Shipment) ([]Rate, error) {
+	return nil, p.err
+}
+
+func (p brokenProvider) Buy(ctx context.Context, rate Rate) (Label, error) {
+	return Label{}, p.err
+}
+
+func (p brokenProvider) Track(ctx context.Context, carrierCode, trackingNumber string) (Tracking, error) {
+	return Tracking{}, p.err
+}
+
+// apiError reads what went wrong from a provider's error response
+func apiError(provider string, resp *http.Response, body []byte) error {
+	msg := strings.TrimSpace(string(body))
+	if len(msg) > 512 {
+		msg = msg[:512]
+	}
+	return fmt.Errorf("%s returned %s: %s", provider, resp.Status, msg)
+}
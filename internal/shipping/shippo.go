@@ -0,0 +1,211 @@
+package shipping
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// shippoURL is Shippo's API
+const shippoURL = "https://api.goshippo.com"
+
+// shippo buys labels through Shippo, authenticating with a ShippoToken header. Shippo takes
+// parcels in grams and centimetres as they are.
+type shippo struct {
+	apiKey string
+}
+
+func (p *shippo) Name() string { return ProviderShippo }
+
+func (p *shippo) Rates(ctx context.Context, s Shipment) ([]Rate, error) {
+	measure := func(f float64) string { return strconv.FormatFloat(roundTenth(f), 'f', -1, 64) }
+	req := map[string]interface{}{
+		"address_from": s.From,
+		"address_to":   s.To,
+		"parcels": []map[string]string{{
+			"weight": measure(s.Parcel.WeightGrams), "mass_unit": "g",
+			"length": measure(s.Parcel.LengthCM), "width": measure(s.Parcel.WidthCM),
+			"height": measure(s.Parcel.HeightCM), "distance_unit": "cm",
+		}},
+		"async": false,
+	}
+	var shipment struct {
+		ObjectID string       `json:"object_id"`
+		Rates    []shippoRate `json:"rates"`
+	}
+	if err := p.do(ctx, http.MethodPost, "/shipments/", req, &shipment); err != nil {
+		return nil, fmt.Errorf("error getting Shippo rates: %w", err)
+	}
+
+	rates := make([]Rate, 0, len(shipment.Rates))
+	for _, r := range shipment.Rates {
+		rates = append(rates, r.rate(shipment.ObjectID))
+	}
+	sortByAmount(rates)
+	return rates, nil
+}
+
+func (p *shippo) Buy(ctx context.Context, rate Rate) (Label, error) {
+	// The transaction only names the rate, so what it costs is read from Shippo before buying
+	// rather than taken from the rate as the client sent it
+	var quoted shippoRate
+	if err := p.do(ctx, http.MethodGet, "/rates/"+url.PathEscape(rate.ID), nil, &quoted); err != nil {
+		return Label{}, fmt.Errorf("error getting Shippo rate %s: %w", rate.ID, err)
+	}
+	rate = quoted.rate(rate.ShipmentID)
+
+	req := map[string]interface{}{"rate": rate.ID, "label_file_type": "PDF", "async": false}
+	var transaction struct {
+		Status         string `json:"status"`
+		TrackingNumber string `json:"tracking_number"`
+		LabelURL       string `json:"label_url"`
+		Messages       []struct {
+			Text string `json:"text"`
+		} `json:"messages"`
+	}
+	if err := p.do(ctx, http.MethodPost, "/transactions/", req, &transaction); err != nil {
+		return Label{}, fmt.Errorf("error buying Shippo label: %w", err)
+	}
+	if transaction.Status != "SUCCESS" {
+		// A failed purchase still comes back 201, with the reasons in messages
+		reasons := make([]string, 0, len(transaction.Messages))
+		for _, m := range transaction.Messages {
+			reasons = append(reasons, m.Text)
+		}
+		return Label{}, fmt.Errorf("Shippo couldn't buy the label (%s): %s", strings.ToLower(transaction.Status), strings.Join(reasons, "; "))
+	}
+
+	return Label{
+		Carrier:        rate.Carrier,
+		CarrierCode:    rate.CarrierCode,
+		Service:        rate.Service,
+		TrackingNumber: transaction.TrackingNumber,
+		LabelURL:       transaction.LabelURL,
+		Amount:         rate.Amount,
+		Currency:       rate.Currency,
+		ShipmentID:     rate.ShipmentID,
+	}, nil
+}
+
+// shippoRate is a rate as Shippo quotes it
+type shippoRate struct {
+	ObjectID     string `json:"object_id"`
+	Provider     string `json:"provider"`
+	ServiceLevel struct {
+		Name string `json:"name"`
+	} `json:"servicelevel"`
+	Amount        string `json:"amount"`
+	Currency      string `json:"currency"`
+	EstimatedDays *int   `json:"estimated_days"`
+}
+
+// rate is the Shippo rate as one of ours, for the shipment it was quoted for
+func (r shippoRate) rate(shipmentID string) Rate {
+	rate := Rate{
+		ID: r.ObjectID, ShipmentID: shipmentID, Carrier: r.Provider, CarrierCode: shippoCarrier(r.Provider),
+		Service: r.ServiceLevel.Name, Amount: r.Amount, Currency: r.Currency,
+	}
+	if r.EstimatedDays != nil {
+		rate.Days = *r.EstimatedDays
+	}
+	return rate
+}
+
+// shippoStatuses maps Shippo's tracking statuses to ours
+var shippoStatuses = map[string]string{
+	"PRE_TRANSIT": StatusPreTransit,
+	"TRANSIT":     StatusInTransit,
+	"DELIVERED":   StatusDelivered,
+	"RETURNED":    StatusReturned,
+	"FAILURE":     StatusFailure,
+}
+
+// shippoTrackingStatus is one status in a Shippo track, the latest or one from its history
+type shippoTrackingStatus struct {
+	Status        string    `json:"status"`
+	StatusDetails string    `json:"status_details"`
+	StatusDate    time.Time `json:"status_date"`
+	Location      *struct {
+		City    string `json:"city"`
+		State   string `json:"state"`
+		Country string `json:"country"`
+	} `json:"location"`
+}
+
+func (s shippoTrackingStatus) event() TrackingEvent {
+	e := TrackingEvent{At: s.StatusDate, Status: mapStatus(shippoStatuses, s.Status), Message: s.StatusDetails}
+	if s.Location != nil {
+		e.Location = joinLocation(s.Location.City, s.Location.State, s.Location.Country)
+	}
+	return e
+}
+
+func (p *shippo) Track(ctx context.Context, carrierCode, trackingNumber string) (Tracking, error) {
+	var track struct {
+		TrackingStatus  *shippoTrackingStatus  `json:"tracking_status"`
+		TrackingHistory []shippoTrackingStatus `json:"tracking_history"`
+	}
+	path := "/tracks/" + url.PathEscape(carrierCode) + "/" + url.PathEscape(trackingNumber)
+	if err := p.do(ctx, http.MethodGet, path, nil, &track); err != nil {
+		return Tracking{}, fmt.Errorf("error tracking %s with Shippo: %w", trackingNumber, err)
+	}
+
+	t := Tracking{Status: StatusUnknown}
+	if track.TrackingStatus != nil {
+		latest := track.TrackingStatus.event()
+		t.Status, t.Detail, t.UpdatedAt = latest.Status, latest.Message, latest.At
+	}
+	for _, s := range track.TrackingHistory {
+		t.Events = append(t.Events, s.event())
+	}
+	return t, nil
+}
+
+// shippoCarrier turns a rate's provider, as in "DHL Express", into the carrier token Shippo's
+// tracking API takes, as in "dhl_express"
+func shippoCarrier(provider string) string {
+	return strings.ReplaceAll(strings.ToLower(strings.TrimSpace(provider)), " ", "_")
+}
+
+// do sends a request to Shippo, with body as JSON unless it is nil, and decodes the response into out
+func (p *shippo) do(ctx context.Context, method, path string, body, out interface{}) error {
+	var reader io.Reader
+	if body != nil {
+		payload, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(payload)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, shippoURL+path, reader)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "ShippoToken "+p.apiKey)
+	req.Header.Set("Accept", "application/json")
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, 4<<20))
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return apiError("Shippo", resp, data)
+	}
+	return json.Unmarshal(data, out)
+}
@@ -0,0 +1,56 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+// localBackend keeps files in a directory the dashboard serves itself
+type localBackend struct {
+	dir string
+	url string // The full address of the directory, STORAGE_PUBLIC_URL
+}
+
+func (b *localBackend) Name() string    { return BackendLocal }
+func (b *localBackend) BaseURL() string { return b.url }
+
+func (b *localBackend) Put(ctx context.Context, name string, data []byte, contentType string) error {
+	if err := checkName(name); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(b.dir, 0o755); err != nil {
+		return fmt.Errorf("error creating media directory: %w", err)
+	}
+	if err := os.WriteFile(filepath.Join(b.dir, name), data, 0o644); err != nil {
+		return fmt.Errorf("error writing %s: %w", name, err)
+	}
+	return nil
+}
+
+func (b *localBackend) Get(ctx context.Context, name string) ([]byte, error) {
+	if err := checkName(name); err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(filepath.Join(b.dir, name))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error reading %s: %w", name, err)
+	}
+	return data, nil
+}
+
+func (b *localBackend) Delete(ctx context.Context, name string) error {
+	if err := checkName(name); err != nil {
+		return err
+	}
+	if err := os.Remove(filepath.Join(b.dir, name)); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("error deleting %s: %w", name, err)
+	}
+	return nil
+}
@@ -0,0 +1,199 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// s3Backend keeps files in an S3 bucket, signing each request with AWS Signature Version 4.
+// Objects aren't given an ACL, so the bucket's policy (or a CDN in front of it, named by
+// STORAGE_PUBLIC_URL) has to let the storefront read them.
+type s3Backend struct {
+	bucket    string
+	region    string
+	endpoint  string // Without a path; the bucket goes in the path when set
+	accessKey string
+	secretKey string
+	prefix    string
+	publicURL string
+}
+
+func newS3Backend(cfg Config) *s3Backend {
+	return &s3Backend{
+		bucket:    cfg.S3Bucket,
+		region:    cfg.S3Region,
+		endpoint:  cfg.S3Endpoint,
+		accessKey: cfg.S3AccessKeyID,
+		secretKey: cfg.S3SecretAccessKey,
+		prefix:    cfg.Prefix,
+		publicURL: cfg.PublicURL,
+	}
+}
+
+func (b *s3Backend) Name() string { return BackendS3 }
+
+func (b *s3Backend) BaseURL() string {
+	if b.publicURL != "" {
+		return b.publicURL
+	}
+	return strings.TrimSuffix(b.objectURL(b.prefix), "/")
+}
+
+// objectURL is where an object is read and written: path-style on a custom endpoint, and
+// virtual-hosted on AWS itself
+func (b *s3Backend) objectURL(key string) string {
+	if b.endpoint != "" {
+		return b.endpoint + "/" + s3Escape(b.bucket) + "/" + s3Escape(key)
+	}
+	return "https://" + b.bucket + ".s3." + b.region + ".amazonaws.com/" + s3Escape(key)
+}
+
+func (b *s3Backend) Put(ctx context.Context, name string, data []byte, contentType string) error {
+	if err := checkName(name); err != nil {
+		return err
+	}
+	header := http.Header{}
+	header.Set("Content-Type", contentType)
+	// Names are never reused, so caches can keep a file for good
+	header.Set("Cache-Control", "public, max-age=31536000, immutable")
+	resp, err := b.do(ctx, http.MethodPut, joinKey(b.prefix, name), data, header)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return s3Error(resp, "storing "+name)
+	}
+	return nil
+}
+
+func (b *s3Backend) Get(ctx context.Context, name string) ([]byte, error) {
+	if err := checkName(name); err != nil {
+		return nil, err
+	}
+	resp, err := b.do(ctx, http.MethodGet, joinKey(b.prefix, name), nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, ErrNotFound
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, s3Error(resp, "reading "+name)
+	}
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("s3: error reading %s: %w", name, err)
+	}
+	return data, nil
+}
+
+func (b *s3Backend) Delete(ctx context.Context, name string) error {
+	if err := checkName(name); err != nil {
+		return err
+	}
+	resp, err := b.do(ctx, http.MethodDelete, joinKey(b.prefix, name), nil, nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	// S3 answers 204 whether or not the object was there
+	if resp.StatusCode != http.StatusNoContent && resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusNotFound {
+		return s3Error(resp, "deleting "+name)
+	}
+	return nil
+}
+
+// do sends a signed request for an object
+func (b *s3Backend) do(ctx context.Context, method, key string, body []byte, header http.Header) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, b.objectURL(key), bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("s3: %w", err)
+	}
+	for name, values := range header {
+		req.Header[name] = values
+	}
+	b.sign(req, body, time.Now().UTC())
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("s3: %w", err)
+	}
+	return resp, nil
+}
+
+// sign adds the Signature Version 4 headers. Only host and the x-amz headers are signed, which
+// is all S3 requires.
+func (b *s3Backend) sign(req *http.Request, body []byte, now time.Time) {
+	amzDate := now.Format("20060102T150405Z")
+	day := now.Format("20060102")
+	payloadHash := sha256Hex(body)
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+
+	const signedHeaders = "host;x-amz-content-sha256;x-amz-date"
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		"", // No query string
+		"host:" + req.URL.Host,
+		"x-amz-content-sha256:" + payloadHash,
+		"x-amz-date:" + amzDate,
+		"",
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+
+	scope := day + "/" + b.region + "/s3/aws4_request"
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + sha256Hex([]byte(canonicalRequest))
+
+	key := hmacSHA256([]byte("AWS4"+b.secretKey), day)
+	key = hmacSHA256(key, b.region)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", "AWS4-HMAC-SHA256 Credential="+b.accessKey+"/"+scope+
+		", SignedHeaders="+signedHeaders+", Signature="+signature)
+}
+
+// s3Error turns a failed response into an error carrying S3's message
+func s3Error(resp *http.Response, action string) error {
+	msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+	return fmt.Errorf("s3 returned %s %s: %s", resp.Status, action, strings.TrimSpace(string(msg)))
+}
+
+// s3Escape percent-encodes a key the way Signature Version 4 expects: everything but
+// unreserved characters, with slashes left as separators
+func s3Escape(key string) string {
+	var b strings.Builder
+	for i := 0; i < len(key); i++ {
+		c := key[i]
+		if 'A' <= c && c <= 'Z' || 'a' <= c && c <= 'z' || '0' <= c && c <= '9' || strings.IndexByte("-_.~/", c) >= 0 {
+			b.WriteByte(c)
+		} else {
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
+
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
@@ -0,0 +1,195 @@
+// Package storage keeps uploaded files where they can be served from: a local directory, an
+// S3 bucket (or anything that speaks the S3 API, such as Cloudflare R2 or MinIO), or a
+// Supabase Storage bucket. Files are addressed by a flat name and each backend serves them
+// under one base URL, so a stored file is always at BaseURL()+"/"+name.
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+// The backends STORAGE_BACKEND chooses between
+const (
+	BackendLocal    = "local"
+	BackendS3       = "s3"
+	BackendSupabase = "supabase"
+)
+
+// ErrNotFound is returned by Get for a name nothing is stored under
+var ErrNotFound = errors.New("file not found in storage")
+
+// Backend stores files by name
+type Backend interface {
+	// Name is the kind of backend, one of the Backend* constants
+	Name() string
+	// BaseURL is the URL stored files are served under, without a trailing slash
+	BaseURL() string
+	// Put stores data under name, replacing anything already there
+	Put(ctx context.Context, name string, data []byte, contentType string) error
+	// Get reads back what is stored under name, or ErrNotFound
+	Get(ctx context.Context, name string) ([]byte, error)
+	// Delete removes what is stored under name. Deleting a missing file isn't an error.
+	Delete(ctx context.Context, name string) error
+}
+
+// Config holds the settings of every backend; only those of the chosen one are used
+type Config struct {
+	Backend   string // One of the Backend* constants
+	Prefix    string // Folder within the bucket files go in, for the remote backends
+	PublicURL string // Overrides the URL files are served from, e.g. a CDN in front of the bucket; required for local
+
+	Dir string // Local: directory files are written to
+	URL string // Local: URL path the directory is served at, which PublicURL points at
+
+	S3Bucket          string
+	S3Region          string
+	S3Endpoint        string // Set for services other than AWS; requests then use path-style URLs
+	S3AccessKeyID     string
+	S3SecretAccessKey string
+
+	SupabaseURL        string
+	SupabaseServiceKey string
+	SupabaseBucket     string
+}
+
+// ConfigFromEnv reads STORAGE_BACKEND (local by default), STORAGE_PREFIX and STORAGE_PUBLIC_URL,
+// MEDIA_DIR and MEDIA_URL for local files, S3_BUCKET, S3_REGION, S3_ENDPOINT, S3_ACCESS_KEY_ID
+// and S3_SECRET_ACCESS_KEY for S3, and SUPABASE_URL, SUPABASE_SERVICE_KEY and SUPABASE_BUCKET
+// for Supabase. Local files are kept under web/static/uploads, which the static file server
+// already serves.
+func ConfigFromEnv() Config {
+	cfg := Config{
+		Backend:            strings.ToLower(strings.TrimSpace(os.Getenv("STORAGE_BACKEND"))),
+		Prefix:             strings.Trim(os.Getenv("STORAGE_PREFIX"), "/"),
+		PublicURL:          strings.TrimRight(os.Getenv("STORAGE_PUBLIC_URL"), "/"),
+		Dir:                "./web/static/uploads",
+		URL:                "/static/uploads",
+		S3Bucket:           os.Getenv("S3_BUCKET"),
+		S3Region:           os.Getenv("S3_REGION"),
+		S3Endpoint:         strings.TrimRight(os.Getenv("S3_ENDPOINT"), "/"),
+		S3AccessKeyID:      os.Getenv("S3_ACCESS_KEY_ID"),
+		S3SecretAccessKey:  os.Getenv("S3_SECRET_ACCESS_KEY"),
+		SupabaseURL:        strings.TrimRight(os.Getenv("SUPABASE_URL"), "/"),
+		SupabaseServiceKey: os.Getenv("SUPABASE_SERVICE_KEY"),
+		SupabaseBucket:     os.Getenv("SUPABASE_BUCKET"),
+	}
+	if cfg.Backend == "" {
+		cfg.Backend = BackendLocal
+	}
+	if s := os.Getenv("MEDIA_DIR"); s != "" {
+		cfg.Dir = s
+	}
+	if s := os.Getenv("MEDIA_URL"); s != "" {
+		cfg.URL = strings.TrimRight(s, "/")
+	}
+	if cfg.S3Region == "" {
+		cfg.S3Region = "us-east-1"
+	}
+	return cfg
+}
+
+// New returns the backend cfg chooses. When a setting it needs is missing, the error says which
+// and the backend returned fails every call with it, so the dashboard still starts and only
+// uploads are affected. Local files need PublicURL, the full address the dashboard serves them
+// at, since the storefront, duplicate detection and product imports can't use a bare path.
+func New(cfg Config) (Backend, error) {
+	var missing []string
+	need := func(name, value string) {
+		if value == "" {
+			missing = append(missing, name)
+		}
+	}
+
+	var backend Backend
+	switch cfg.Backend {
+	case BackendLocal:
+		need("STORAGE_PUBLIC_URL", cfg.PublicURL)
+		backend = &localBackend{dir: cfg.Dir, url: cfg.PublicURL}
+	case BackendS3:
+		need("S3_BUCKET", cfg.S3Bucket)
+		need("S3_ACCESS_KEY_ID", cfg.S3AccessKeyID)
+		need("S3_SECRET_ACCESS_KEY", cfg.S3SecretAccessKey)
+		backend = newS3Backend(cfg)
+	case BackendSupabase:
+		need("SUPABASE_URL", cfg.SupabaseURL)
+		need("SUPABASE_SERVICE_KEY", cfg.SupabaseServiceKey)
+		need("SUPABASE_BUCKET", cfg.SupabaseBucket)
+		backend = newSupabaseBackend(cfg)
+	default:
+		err := fmt.Errorf("unknown STORAGE_BACKEND %q; use local, s3 or supabase", cfg.Backend)
+		return brokenBackend{name: cfg.Backend, err: err}, err
+	}
+
+	if len(missing) > 0 {
+		err := fmt.Errorf("%s storage needs %s", cfg.Backend, strings.Join(missing, ", "))
+		return brokenBackend{name: cfg.Backend, url: backend.BaseURL(), err: err}, err
+	}
+	if u, err := url.Parse(cfg.PublicURL); cfg.PublicURL != "" && (err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "") {
+		err := fmt.Errorf("STORAGE_PUBLIC_URL must be a full http or https address, such as https://admin.example.com/static/uploads")
+		return brokenBackend{name: cfg.Backend, err: err}, err
+	}
+	return backend, nil
+}
+
+// FromEnv returns the backend the environment chooses; see ConfigFromEnv and New
+func FromEnv() (Backend, error) {
+	return New(ConfigFromEnv())
+}
+
+// Configured reports whether STORAGE_BACKEND chooses where uploads are kept, rather than leaving
+// them on the local default, and the backend chosen has every setting it needs
+func Configured() bool {
+	if strings.TrimSpace(os.Getenv("STORAGE_BACKEND")) == "" {
+		return false
+	}
+	_, err := FromEnv()
+	return err == nil
+}
+
+// client makes the requests to the remote backends. Uploads are at most a few megabytes.
+var client = &http.Client{Timeout: 60 * time.Second}
+
+// checkName refuses names that could reach outside the backend's folder
+func checkName(name string) error {
+	if name == "" || strings.ContainsAny(name, `/\`) || strings.HasPrefix(name, ".") {
+		return fmt.Errorf("invalid file name %q", name)
+	}
+	return nil
+}
+
+// joinKey puts a name in the prefix folder
+func joinKey(prefix, name string) string {
+	if prefix == "" {
+		return name
+	}
+	return prefix + "/" + name
+}
+
+// brokenBackend stands in for a backend that is missing settings
+type brokenBackend struct {
+	name string
+	url  string
+	err  error
+}
+
+func (b brokenBackend) Name() string    { return b.name }
+func (b brokenBackend) BaseURL() string { return b.url }
+
+func (b brokenBackend) Put(ctx context.Context, name string, data []byte, contentType string) error {
+	return b.err
+}
+
+func (b brokenBackend) Get(ctx context.Context, name string) ([]byte, error) {
+	return nil, b.err
+}
+
+func (b brokenBackend) Delete(ctx context.Context, name string) error {
+	return b.err
+}
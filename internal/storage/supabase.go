@@ -0,0 +1,129 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// supabaseBackend keeps files in a Supabase Storage bucket through its REST API, using the
+// project's service role key. The bucket has to be public for the storefront to show the images.
+type supabaseBackend struct {
+	url       string // The project URL, e.g. https://abcd.supabase.co
+	key       string
+	bucket    string
+	prefix    string
+	publicURL string
+}
+
+func newSupabaseBackend(cfg Config) *supabaseBackend {
+	return &supabaseBackend{
+		url:       cfg.SupabaseURL,
+		key:       cfg.SupabaseServiceKey,
+		bucket:    cfg.SupabaseBucket,
+		prefix:    cfg.Prefix,
+		publicURL: cfg.PublicURL,
+	}
+}
+
+func (b *supabaseBackend) Name() string { return BackendSupabase }
+
+func (b *supabaseBackend) BaseURL() string {
+	if b.publicURL != "" {
+		return b.publicURL
+	}
+	return strings.TrimSuffix(b.url+"/storage/v1/object/public/"+s3Escape(joinKey(b.bucket, b.prefix)), "/")
+}
+
+// objectURL is where the API reads, writes and deletes an object
+func (b *supabaseBackend) objectURL(name string) string {
+	return b.url + "/storage/v1/object/" + s3Escape(b.bucket+"/"+joinKey(b.prefix, name))
+}
+
+func (b *supabaseBackend) Put(ctx context.Context, name string, data []byte, contentType string) error {
+	if err := checkName(name); err != nil {
+		return err
+	}
+	header := http.Header{}
+	header.Set("Content-Type", contentType)
+	header.Set("Cache-Control", "max-age=31536000")
+	header.Set("X-Upsert", "true")
+	resp, err := b.do(ctx, http.MethodPost, name, data, header)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return supabaseError(resp, "storing "+name)
+	}
+	return nil
+}
+
+func (b *supabaseBackend) Get(ctx context.Context, name string) ([]byte, error) {
+	if err := checkName(name); err != nil {
+		return nil, err
+	}
+	resp, err := b.do(ctx, http.MethodGet, name, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, supabaseError(resp, "reading "+name)
+	}
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("supabase: error reading %s: %w", name, err)
+	}
+	return data, nil
+}
+
+func (b *supabaseBackend) Delete(ctx context.Context, name string) error {
+	if err := checkName(name); err != nil {
+		return err
+	}
+	resp, err := b.do(ctx, http.MethodDelete, name, nil, nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		if err := supabaseError(resp, "deleting "+name); err != ErrNotFound {
+			return err
+		}
+	}
+	return nil
+}
+
+// do sends an authenticated request for an object
+func (b *supabaseBackend) do(ctx context.Context, method, name string, body []byte, header http.Header) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, b.objectURL(name), bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("supabase: %w", err)
+	}
+	for name, values := range header {
+		req.Header[name] = values
+	}
+	req.Header.Set("Authorization", "Bearer "+b.key)
+	req.Header.Set("apikey", b.key)
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("supabase: %w", err)
+	}
+	return resp, nil
+}
+
+// supabaseError turns a failed response into an error, or ErrNotFound when the object isn't
+// there. Supabase reports a missing object as a 400 or 404 whose body says so.
+func supabaseError(resp *http.Response, action string) error {
+	msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+	text := strings.TrimSpace(string(msg))
+	if resp.StatusCode == http.StatusNotFound || strings.Contains(strings.ToLower(text), "not found") {
+		return ErrNotFound
+	}
+	return fmt.Errorf("supabase returned %s %s: %s", resp.Status, action, text)
+}
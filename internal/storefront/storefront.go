@@ -0,0 +1,87 @@
+// Package storefront sends events to the storefront's notification endpoint, such as an order's
+// status changing, for it to pass on to the customer however it likes. Events have the same
+// shape and signature as the ones the storefront sends the admin: {"id", "type", "data"}, with
+// X-Webhook-Signature the hex HMAC-SHA256 of the body keyed with STOREFRONT_WEBHOOK_SECRET.
+package storefront
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// Config holds the notification endpoint settings
+type Config struct {
+	NotifyURL string
+	Secret    string
+}
+
+// ConfigFromEnv reads STOREFRONT_NOTIFY_URL and STOREFRONT_WEBHOOK_SECRET. Sending events is
+// disabled while STOREFRONT_NOTIFY_URL is empty.
+func ConfigFromEnv() Config {
+	return Config{
+		NotifyURL: strings.TrimSpace(os.Getenv("STOREFRONT_NOTIFY_URL")),
+		Secret:    os.Getenv("STOREFRONT_WEBHOOK_SECRET"),
+	}
+}
+
+// Enabled reports whether a notification endpoint is configured
+func (c Config) Enabled() bool {
+	return c.NotifyURL != ""
+}
+
+// Event is one event sent to the storefront. ID stays the same when a delivery is retried, so
+// the storefront can drop repeats.
+type Event struct {
+	ID   string      `json:"id"`
+	Type string      `json:"type"`
+	Data interface{} `json:"data"`
+}
+
+// client posts events, giving up on a storefront that doesn't answer
+var client = &http.Client{Timeout: 10 * time.Second}
+
+// Sign is the X-Webhook-Signature header for body: "sha256=" and its hex HMAC-SHA256
+func Sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Send posts an event to the notification endpoint. Any answer other than 2xx is an error.
+func (c Config) Send(ctx context.Context, e Event) error {
+	body, err := json.Marshal(e)
+	if err != nil {
+		return fmt.Errorf("error encoding storefront event: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.NotifyURL, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("error creating storefront request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if c.Secret != "" {
+		req.Header.Set("X-Webhook-Signature", Sign(c.Secret, body))
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("error posting to the storefront: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("storefront returned %s: %s", resp.Status, strings.TrimSpace(string(msg)))
+	}
+	return nil
+}
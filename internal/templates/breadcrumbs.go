@@ -0,0 +1,32 @@
+package templates
+
+import "context"
+
+// Breadcrumb is one step of the trail shown above a page. The last step is the page itself
+// and has no URL.
+type Breadcrumb struct {
+	Label string
+	URL   string
+}
+
+type breadcrumbsContextKey struct{}
+
+// WithBreadcrumbs returns a copy of ctx carrying the trail Layout shows above the page
+func WithBreadcrumbs(ctx context.Context, crumbs ...Breadcrumb) context.Context {
+	return context.WithValue(ctx, breadcrumbsContextKey{}, crumbs)
+}
+
+// breadcrumbsFromContext returns the trail for the page, if the handler set one
+func breadcrumbsFromContext(ctx context.Context) []Breadcrumb {
+	crumbs, _ := ctx.Value(breadcrumbsContextKey{}).([]Breadcrumb)
+	return crumbs
+}
+
+// backURL links back to the list the page was reached from, the first step of its trail,
+// keeping that list's search, filters and page
+func backURL(ctx context.Context, fallback string) string {
+	if crumbs := breadcrumbsFromContext(ctx); len(crumbs) > 0 && crumbs[0].URL != "" {
+		return crumbs[0].URL
+	}
+	return fallback
+}
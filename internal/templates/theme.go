@@ -0,0 +1,25 @@
+package templates
+
+import "context"
+
+type themeContextKey struct{}
+
+// WithTheme returns a copy of ctx carrying the UI theme ("dark" or "light") to render with
+func WithTheme(ctx context.Context, theme string) context.Context {
+	return context.WithValue(ctx, themeContextKey{}, theme)
+}
+
+// ThemeFromContext returns the theme to render with, defaulting to dark. Anything that
+// renders templates outside a page request (emails, PDFs) can use it to match the admin's UI.
+func ThemeFromContext(ctx context.Context) string {
+	if theme, ok := ctx.Value(themeContextKey{}).(string); ok && theme == "light" {
+		return "light"
+	}
+	return "dark"
+}
+
+// htmlClass returns the class list for the root <html> element, so the theme is
+// applied before first paint instead of being switched in by JavaScript
+func htmlClass(ctx context.Context) string {
+	return ThemeFromContext(ctx) + " h-full"
+}
@@ -0,0 +1,42 @@
+package version
+
+import (
+	_ "embed"
+	"strings"
+)
+
+// changelog is CHANGELOG.md, compiled into the binary so the dashboard can say what this build
+// includes wherever it's deployed
+//
+//go:embed CHANGELOG.md
+var changelog string
+
+// Release is one section of the changelog: a version, or Unreleased, and the notes under it
+type Release struct {
+	Title string `json:"title"`
+	Notes string `json:"notes"` // Markdown
+}
+
+// Running reports whether the release is the version this build was stamped with
+func (r Release) Running() bool {
+	return r.Title == Version || strings.HasPrefix(r.Title, Version+" ")
+}
+
+// Changelog splits the embedded changelog into its releases, newest first, at its "## "
+// headings. Anything before the first one is left out.
+func Changelog() []Release {
+	var releases []Release
+	for _, line := range strings.Split(changelog, "\n") {
+		if title, ok := strings.CutPrefix(line, "## "); ok {
+			releases = append(releases, Release{Title: strings.TrimSpace(title)})
+			continue
+		}
+		if len(releases) > 0 {
+			releases[len(releases)-1].Notes += line + "\n"
+		}
+	}
+	for i := range releases {
+		releases[i].Notes = strings.TrimSpace(releases[i].Notes)
+	}
+	return releases
+}
@@ -0,0 +1,70 @@
+// Package version describes the build that is running, so operators can tell which code a
+// deployment has
+package version
+
+import (
+	"runtime/debug"
+	"time"
+)
+
+// Version and Commit are stamped in at build time, which the Makefile and Dockerfile do:
+//
+//	go build -ldflags "-X github.com/ngenohkevin/kuiper_admin/internal/version.Version=v1.2.0 -X github.com/ngenohkevin/kuiper_admin/internal/version.Commit=$(git rev-parse HEAD)"
+//
+// Without them the version is "dev" and the commit is whatever the Go toolchain recorded.
+var (
+	Version = "dev"
+	Commit  = ""
+)
+
+// Info describes the build: its version, and what the Go toolchain recorded about it
+type Info struct {
+	Version   string     `json:"version"`
+	GoVersion string     `json:"go_version"`
+	Revision  string     `json:"revision,omitempty"`    // The VCS commit built from, empty when unknown
+	Time      *time.Time `json:"commit_time,omitempty"` // When that commit was made
+	Modified  bool       `json:"modified"`              // The working tree had uncommitted changes
+}
+
+// Get reads the build's info. The revision is Commit when stamped, else the one go build records
+// inside a git checkout, and unknown for builds from a copy of the source such as Docker's.
+func Get() Info {
+	info := Info{Version: Version, Revision: Commit}
+	build, ok := debug.ReadBuildInfo()
+	if !ok {
+		return info
+	}
+
+	info.GoVersion = build.GoVersion
+	for _, s := range build.Settings {
+		switch s.Key {
+		case "vcs.revision":
+			if info.Revision == "" {
+				info.Revision = s.Value
+			}
+		case "vcs.time":
+			if t, err := time.Parse(time.RFC3339, s.Value); err == nil {
+				info.Time = &t
+			}
+		case "vcs.modified":
+			info.Modified = s.Value == "true"
+		}
+	}
+	return info
+}
+
+// ShortRevision is the first few characters of the revision, as git shows it
+func (i Info) ShortRevision() string {
+	if len(i.Revision) > 12 {
+		return i.Revision[:12]
+	}
+	return i.Revision
+}
+
+// String names the build as the footer shows it, e.g. "v1.2.0 (3f17c47a1b2c)"
+func (i Info) String() string {
+	if i.Revision == "" {
+		return i.Version
+	}
+	return i.Version + " (" + i.ShortRevision() + ")"
+}
@@ -0,0 +1,140 @@
+// Package wms talks to the external warehouse management system that is the
+// source of truth for physical stock.
+//
+// The warehouse is expected to expose GET {WMS_SYNC_URL}/stock, returning a JSON
+// array of stock levels keyed by our product and variant IDs, and to accept the
+// same array on PUT {WMS_SYNC_URL}/stock when pushing.
+package wms
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ngenohkevin/kuiper_admin/internal/models"
+)
+
+// Sync modes
+const (
+	ModePull = "pull" // Correct local stock to match the warehouse
+	ModePush = "push" // Send local stock to the warehouse
+	ModeBoth = "both" // Pull corrections, then push the result
+)
+
+// Config holds the warehouse integration settings
+type Config struct {
+	URL      string
+	APIKey   string
+	Mode     string
+	Interval time.Duration
+}
+
+// ConfigFromEnv reads WMS_SYNC_URL, WMS_API_KEY, WMS_SYNC_MODE and WMS_SYNC_INTERVAL_MINUTES.
+// Sync is disabled while WMS_SYNC_URL is empty.
+func ConfigFromEnv() Config {
+	cfg := Config{
+		URL:      strings.TrimRight(os.Getenv("WMS_SYNC_URL"), "/"),
+		APIKey:   os.Getenv("WMS_API_KEY"),
+		Mode:     os.Getenv("WMS_SYNC_MODE"),
+		Interval: 15 * time.Minute,
+	}
+	if cfg.Mode != ModePush && cfg.Mode != ModeBoth {
+		cfg.Mode = ModePull
+	}
+	if s := os.Getenv("WMS_SYNC_INTERVAL_MINUTES"); s != "" {
+		if minutes, err := strconv.Atoi(s); err == nil && minutes > 0 {
+			cfg.Interval = time.Duration(minutes) * time.Minute
+		}
+	}
+	return cfg
+}
+
+// Enabled reports whether a warehouse endpoint is configured
+func (c Config) Enabled() bool {
+	return c.URL != ""
+}
+
+// Pulls reports whether the mode corrects local stock from the warehouse
+func (c Config) Pulls() bool {
+	return c.Mode == ModePull || c.Mode == ModeBoth
+}
+
+// Pushes reports whether the mode sends local stock to the warehouse
+func (c Config) Pushes() bool {
+	return c.Mode == ModePush || c.Mode == ModeBoth
+}
+
+// Client calls the warehouse stock endpoint
+type Client struct {
+	cfg  Config
+	http *http.Client
+}
+
+// NewClient creates a client for the configured warehouse
+func NewClient(cfg Config) *Client {
+	return &Client{cfg: cfg, http: &http.Client{Timeout: 30 * time.Second}}
+}
+
+// PullStock fetches the warehouse's stock levels
+func (c *Client) PullStock(ctx context.Context) ([]models.StockLevel, error) {
+	var levels []models.StockLevel
+	if err := c.do(ctx, http.MethodGet, nil, &levels); err != nil {
+		return nil, fmt.Errorf("error pulling warehouse stock: %w", err)
+	}
+	return levels, nil
+}
+
+// PushStock sends local stock levels to the warehouse
+func (c *Client) PushStock(ctx context.Context, levels []models.StockLevel) error {
+	if err := c.do(ctx, http.MethodPut, levels, nil); err != nil {
+		return fmt.Errorf("error pushing stock to warehouse: %w", err)
+	}
+	return nil
+}
+
+// do sends a JSON request to the stock endpoint and decodes the response into out when set
+func (c *Client) do(ctx context.Context, method string, body, out interface{}) error {
+	var reader io.Reader
+	if body != nil {
+		payload, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(payload)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, c.cfg.URL+"/stock", reader)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if c.cfg.APIKey != "" {
+		req.Header.Set("Authorization", "Bearer "+c.cfg.APIKey)
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		snippet, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("warehouse returned status %d: %s", resp.StatusCode, strings.TrimSpace(string(snippet)))
+	}
+
+	if out == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
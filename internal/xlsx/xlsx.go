@@ -0,0 +1,190 @@
+// Package xlsx writes single-sheet Excel workbooks a row at a time, so exports can be
+// streamed to the browser as they're read from the database. It covers what exports need:
+// text and numbers, with a bold header row, and nothing more.
+package xlsx
+
+import (
+	"archive/zip"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// ContentType is the MIME type of a workbook
+const ContentType = "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet"
+
+// maxCellLength is the most characters Excel holds in a cell
+const maxCellLength = 32767
+
+// numberPattern matches the values written as numbers: plain decimals without leading zeros,
+// short enough that Excel doesn't round them. Anything else, such as an SKU of 007, stays text.
+var numberPattern = regexp.MustCompile(`^-?(0|[1-9][0-9]{0,14})(\.[0-9]+)?$`)
+
+// fixedParts are the workbook's files other than the sheet, which never change
+var fixedParts = []struct{ name, body string }{
+	{"[Content_Types].xml", `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types">
+<Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/>
+<Default Extension="xml" ContentType="application/xml"/>
+<Override PartName="/xl/workbook.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.sheet.main+xml"/>
+<Override PartName="/xl/worksheets/sheet1.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.worksheet+xml"/>
+<Override PartName="/xl/styles.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.styles+xml"/>
+</Types>`},
+	{"_rels/.rels", `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">
+<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/officeDocument" Target="xl/workbook.xml"/>
+</Relationships>`},
+	{"xl/_rels/workbook.xml.rels", `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">
+<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="worksheets/sheet1.xml"/>
+<Relationship Id="rId2" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/styles" Target="styles.xml"/>
+</Relationships>`},
+	{"xl/styles.xml", `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<styleSheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main">
+<fonts count="2"><font><sz val="11"/><name val="Calibri"/></font><font><b/><sz val="11"/><name val="Calibri"/></font></fonts>
+<fills count="2"><fill><patternFill patternType="none"/></fill><fill><patternFill patternType="gray125"/></fill></fills>
+<borders count="1"><border><left/><right/><top/><bottom/><diagonal/></border></borders>
+<cellStyleXfs count="1"><xf numFmtId="0" fontId="0" fillId="0" borderId="0"/></cellStyleXfs>
+<cellXfs count="2"><xf numFmtId="0" fontId="0" fillId="0" borderId="0" xfId="0"/><xf numFmtId="0" fontId="1" fillId="0" borderId="0" xfId="0" applyFont="1"/></cellXfs>
+<cellStyles count="1"><cellStyle name="Normal" xfId="0" builtinId="0"/></cellStyles>
+</styleSheet>`},
+}
+
+// Writer writes a workbook with one sheet. Like csv.Writer it keeps the first error, which
+// Error and Close return.
+type Writer struct {
+	zip   *zip.Writer
+	sheet io.Writer
+	rows  int
+	err   error
+}
+
+// NewWriter starts a workbook on w whose only sheet is called sheetName
+func NewWriter(w io.Writer, sheetName string) *Writer {
+	x := &Writer{zip: zip.NewWriter(w)}
+	for _, part := range fixedParts {
+		x.writePart(part.name, part.body)
+	}
+	x.writePart("xl/workbook.xml", `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships">
+<sheets><sheet name="`+escape(sheetTitle(sheetName))+`" sheetId="1" r:id="rId1"/></sheets>
+</workbook>`)
+
+	if x.err == nil {
+		x.sheet, x.err = x.zip.Create("xl/worksheets/sheet1.xml")
+	}
+	x.write(`<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main"><sheetData>`)
+	return x
+}
+
+// WriteHeader adds a row in bold, for the column names
+func (x *Writer) WriteHeader(record []string) error {
+	return x.writeRow(record, true)
+}
+
+// Write adds a row. Values that look like plain numbers are stored as numbers so they can be
+// summed; everything else is text.
+func (x *Writer) Write(record []string) error {
+	return x.writeRow(record, false)
+}
+
+// Flush sends what has been written so far to the underlying writer
+func (x *Writer) Flush() {
+	if x.err == nil {
+		x.err = x.zip.Flush()
+	}
+}
+
+// Error is the first error writing the workbook, if any
+func (x *Writer) Error() error {
+	return x.err
+}
+
+// Close finishes the sheet and the workbook. It doesn't close the underlying writer.
+func (x *Writer) Close() error {
+	x.write(`</sheetData></worksheet>`)
+	if x.err == nil {
+		x.err = x.zip.Close()
+	}
+	return x.err
+}
+
+// writeRow adds a row, in the bold style when header is set
+func (x *Writer) writeRow(record []string, header bool) error {
+	x.rows++
+	var b strings.Builder
+	fmt.Fprintf(&b, `<row r="%d">`, x.rows)
+	for i, value := range record {
+		ref := columnName(i) + strconv.Itoa(x.rows)
+		switch {
+		case header:
+			fmt.Fprintf(&b, `<c r="%s" t="inlineStr" s="1"><is><t xml:space="preserve">%s</t></is></c>`, ref, escape(value))
+		case value == "":
+		case numberPattern.MatchString(value):
+			fmt.Fprintf(&b, `<c r="%s"><v>%s</v></c>`, ref, value)
+		default:
+			if runes := []rune(value); len(runes) > maxCellLength {
+				value = string(runes[:maxCellLength])
+			}
+			fmt.Fprintf(&b, `<c r="%s" t="inlineStr"><is><t xml:space="preserve">%s</t></is></c>`, ref, escape(value))
+		}
+	}
+	b.WriteString(`</row>`)
+	x.write(b.String())
+	return x.err
+}
+
+// writePart adds a whole file to the workbook
+func (x *Writer) writePart(name, body string) {
+	if x.err != nil {
+		return
+	}
+	var part io.Writer
+	if part, x.err = x.zip.Create(name); x.err == nil {
+		_, x.err = io.WriteString(part, body)
+	}
+}
+
+// write adds to the sheet
+func (x *Writer) write(s string) {
+	if x.err == nil {
+		_, x.err = io.WriteString(x.sheet, s)
+	}
+}
+
+// escape makes text safe inside XML, replacing characters XML can't hold
+func escape(s string) string {
+	var b strings.Builder
+	xml.EscapeText(&b, []byte(s))
+	return b.String()
+}
+
+// sheetTitle makes a name Excel accepts for a sheet: at most 31 characters, none of []:*?/\
+func sheetTitle(name string) string {
+	name = strings.Map(func(r rune) rune {
+		if strings.ContainsRune(`[]:*?/\`, r) {
+			return '-'
+		}
+		return r
+	}, name)
+	if runes := []rune(name); len(runes) > 31 {
+		name = string(runes[:31])
+	}
+	if name == "" {
+		return "Sheet1"
+	}
+	return name
+}
+
+// columnName is the letters of the zero-based column i: A to Z, then AA and on
+func columnName(i int) string {
+	name := ""
+	for i++; i > 0; i = (i - 1) / 26 {
+		name = string(rune('A'+(i-1)%26)) + name
+	}
+	return name
+}
@@ -0,0 +1,3 @@
+-- Remove per-admin UI preferences
+
+DROP TABLE IF EXISTS admin_preferences;
@@ -0,0 +1,11 @@
+-- Per-admin UI preferences, keyed by the session username
+
+CREATE TABLE IF NOT EXISTS admin_preferences (
+    username VARCHAR(255) PRIMARY KEY,
+    page_size INTEGER NOT NULL DEFAULT 15 CHECK (page_size BETWEEN 5 AND 100),
+    default_sort VARCHAR(50) NOT NULL DEFAULT 'newest',
+    sidebar_collapsed BOOLEAN NOT NULL DEFAULT FALSE,
+    theme VARCHAR(20) NOT NULL DEFAULT 'dark',
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
@@ -0,0 +1,11 @@
+-- Remove soft delete support. Anything still soft-deleted becomes visible again.
+
+DROP TABLE IF EXISTS deleted_variants;
+
+DROP INDEX IF EXISTS idx_reviews_deleted_at;
+DROP INDEX IF EXISTS idx_categories_deleted_at;
+DROP INDEX IF EXISTS idx_products_deleted_at;
+
+ALTER TABLE reviews DROP COLUMN IF EXISTS deleted_at;
+ALTER TABLE categories DROP COLUMN IF EXISTS deleted_at;
+ALTER TABLE products DROP COLUMN IF EXISTS deleted_at;
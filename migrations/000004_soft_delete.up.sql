@@ -0,0 +1,21 @@
+-- Soft deletes so destructive actions can be undone.
+-- The marketplace shares these tables and must also filter on deleted_at IS NULL.
+
+ALTER TABLE products ADD COLUMN IF NOT EXISTS deleted_at TIMESTAMP WITH TIME ZONE;
+ALTER TABLE categories ADD COLUMN IF NOT EXISTS deleted_at TIMESTAMP WITH TIME ZONE;
+ALTER TABLE reviews ADD COLUMN IF NOT EXISTS deleted_at TIMESTAMP WITH TIME ZONE;
+
+CREATE INDEX IF NOT EXISTS idx_products_deleted_at ON products(deleted_at) WHERE deleted_at IS NOT NULL;
+CREATE INDEX IF NOT EXISTS idx_categories_deleted_at ON categories(deleted_at) WHERE deleted_at IS NOT NULL;
+CREATE INDEX IF NOT EXISTS idx_reviews_deleted_at ON reviews(deleted_at) WHERE deleted_at IS NOT NULL;
+
+-- Variants live in the products.variants JSONB array, so deleted ones are moved here
+CREATE TABLE IF NOT EXISTS deleted_variants (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    variant_id VARCHAR(255) NOT NULL,
+    product_id UUID NOT NULL REFERENCES products(id) ON DELETE CASCADE,
+    variant JSONB NOT NULL,
+    deleted_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_deleted_variants_variant_id ON deleted_variants(variant_id);
@@ -0,0 +1,10 @@
+-- Slugs of products merged into another product, so old storefront links keep working.
+-- The marketplace should redirect /products/<from_slug> to the product it points at.
+
+CREATE TABLE IF NOT EXISTS product_redirects (
+    from_slug VARCHAR(255) PRIMARY KEY,
+    product_id UUID NOT NULL REFERENCES products(id) ON DELETE CASCADE,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_product_redirects_product_id ON product_redirects(product_id);
@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS duplicate_groups;
+DROP TABLE IF EXISTS image_hashes;
@@ -0,0 +1,20 @@
+-- Background duplicate detection.
+-- image_hashes caches a content hash per image URL so each image is only fetched once;
+-- an empty sha256 marks a URL that couldn't be fetched.
+-- duplicate_groups holds the latest report and is rebuilt on every run.
+
+CREATE TABLE IF NOT EXISTS image_hashes (
+    url TEXT PRIMARY KEY,
+    sha256 VARCHAR(64) NOT NULL,
+    fetched_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_image_hashes_sha256 ON image_hashes(sha256) WHERE sha256 <> '';
+
+CREATE TABLE IF NOT EXISTS duplicate_groups (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    reason VARCHAR(20) NOT NULL,
+    match_key TEXT NOT NULL,
+    product_ids UUID[] NOT NULL,
+    detected_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
@@ -0,0 +1,7 @@
+-- Archived products are retired from the catalog but keep their reviews and history.
+-- Unlike is_available = false they should not be listed at all: the marketplace API
+-- must filter on archived_at IS NULL, the same way it does for deleted_at.
+
+ALTER TABLE products ADD COLUMN IF NOT EXISTS archived_at TIMESTAMP WITH TIME ZONE;
+
+CREATE INDEX IF NOT EXISTS idx_products_archived_at ON products(archived_at) WHERE archived_at IS NOT NULL;
@@ -0,0 +1,17 @@
+-- Named lists of weights applied by the bulk variant creator.
+-- Presets without a category are offered for every product.
+
+CREATE TABLE IF NOT EXISTS weight_presets (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    name VARCHAR(100) NOT NULL,
+    weights TEXT NOT NULL,
+    category_id UUID REFERENCES categories(id) ON DELETE CASCADE,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_weight_presets_category_id ON weight_presets(category_id);
+
+-- The quick add templates that used to be hard-coded on the product page
+INSERT INTO weight_presets (name, weights) VALUES
+    ('Standard Weights', '5,15,25,35'),
+    ('Small Weights', '3,5,10');
@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS stock_sync_runs;
+DROP TABLE IF EXISTS stock_movements;
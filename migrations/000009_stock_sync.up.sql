@@ -0,0 +1,31 @@
+-- Ledger of stock changes, so every correction can be traced back to where it came from.
+-- variant_id is empty for products without variants.
+
+CREATE TABLE IF NOT EXISTS stock_movements (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    product_id UUID NOT NULL REFERENCES products(id) ON DELETE CASCADE,
+    variant_id VARCHAR(255) NOT NULL DEFAULT '',
+    delta INTEGER NOT NULL,
+    stock_after INTEGER NOT NULL,
+    reason VARCHAR(50) NOT NULL,
+    note TEXT NOT NULL DEFAULT '',
+    actor VARCHAR(255) NOT NULL DEFAULT '',
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_stock_movements_product_id ON stock_movements(product_id, created_at DESC);
+CREATE INDEX IF NOT EXISTS idx_stock_movements_reason ON stock_movements(reason, created_at DESC);
+
+-- One row per reconciliation with the external warehouse system
+CREATE TABLE IF NOT EXISTS stock_sync_runs (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    mode VARCHAR(10) NOT NULL,
+    started_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    finished_at TIMESTAMP WITH TIME ZONE,
+    checked INTEGER NOT NULL DEFAULT 0,
+    discrepancies INTEGER NOT NULL DEFAULT 0,
+    unmatched INTEGER NOT NULL DEFAULT 0,
+    error TEXT NOT NULL DEFAULT ''
+);
+
+CREATE INDEX IF NOT EXISTS idx_stock_sync_runs_started_at ON stock_sync_runs(started_at DESC);
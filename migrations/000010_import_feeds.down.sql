@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS import_runs;
+DROP TABLE IF EXISTS import_feeds;
@@ -0,0 +1,30 @@
+-- Supplier feeds imported on a schedule. field_mapping maps product fields
+-- (name, price, ...) to the feed's CSV columns or JSON keys.
+
+CREATE TABLE IF NOT EXISTS import_feeds (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    name VARCHAR(100) NOT NULL,
+    url TEXT NOT NULL,
+    format VARCHAR(20) NOT NULL,
+    field_mapping JSONB NOT NULL DEFAULT '{}'::jsonb,
+    interval_minutes INTEGER NOT NULL CHECK (interval_minutes > 0),
+    enabled BOOLEAN NOT NULL DEFAULT true,
+    last_run_at TIMESTAMP WITH TIME ZONE,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+-- One row per feed run, with the per-product outcome kept as the run's diff report
+CREATE TABLE IF NOT EXISTS import_runs (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    feed_id UUID NOT NULL REFERENCES import_feeds(id) ON DELETE CASCADE,
+    started_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    finished_at TIMESTAMP WITH TIME ZONE,
+    created INTEGER NOT NULL DEFAULT 0,
+    updated INTEGER NOT NULL DEFAULT 0,
+    unchanged INTEGER NOT NULL DEFAULT 0,
+    failed INTEGER NOT NULL DEFAULT 0,
+    error TEXT NOT NULL DEFAULT '',
+    results JSONB NOT NULL DEFAULT '[]'::jsonb
+);
+
+CREATE INDEX IF NOT EXISTS idx_import_runs_feed_id ON import_runs(feed_id, started_at DESC);
@@ -0,0 +1,8 @@
+UPDATE import_feeds
+SET field_mapping = (
+    SELECT COALESCE(jsonb_object_agg(key, value->'column'), '{}'::jsonb)
+    FROM jsonb_each(field_mapping)
+)
+WHERE field_mapping <> '{}'::jsonb;
+
+DROP TABLE IF EXISTS import_mappings;
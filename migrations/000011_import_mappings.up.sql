@@ -0,0 +1,18 @@
+-- Named column mappings that can be reused across uploads and feeds.
+-- A mapping is {"field": {"column": "...", "transforms": ["strip_currency", ...]}}.
+
+CREATE TABLE IF NOT EXISTS import_mappings (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    name VARCHAR(100) NOT NULL UNIQUE,
+    mapping JSONB NOT NULL DEFAULT '{}'::jsonb,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Feed mappings used to be {"field": "column"}
+UPDATE import_feeds
+SET field_mapping = (
+    SELECT COALESCE(jsonb_object_agg(key, jsonb_build_object('column', value)), '{}'::jsonb)
+    FROM jsonb_each_text(field_mapping)
+)
+WHERE field_mapping <> '{}'::jsonb;
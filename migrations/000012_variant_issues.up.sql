@@ -0,0 +1,15 @@
+-- Scheduled validation of the products.variants JSONB.
+-- variant_issues holds the latest report and is rebuilt on every run.
+-- variant_index is the element's position in the array, or -1 when the column itself is malformed.
+
+CREATE TABLE IF NOT EXISTS variant_issues (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    product_id UUID NOT NULL REFERENCES products(id) ON DELETE CASCADE,
+    variant_index INTEGER NOT NULL,
+    variant_id TEXT NOT NULL DEFAULT '',
+    kind VARCHAR(20) NOT NULL,
+    detail TEXT NOT NULL,
+    detected_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_variant_issues_product_id ON variant_issues(product_id);
@@ -0,0 +1,21 @@
+-- Put the quantity back into the free-text "weight" field, e.g. 3.5 and "g" become "3.5g"
+
+CREATE OR REPLACE FUNCTION variant_weight(v JSONB) RETURNS JSONB AS $$
+BEGIN
+    IF jsonb_typeof(v) <> 'object' OR NOT (v ? 'unit') THEN
+        RETURN v;
+    END IF;
+    RETURN (v - 'quantity' - 'unit') || jsonb_build_object('weight',
+        (v->>'quantity') || CASE WHEN v->>'unit' = 'piece' THEN ' pieces' ELSE v->>'unit' END);
+END;
+$$ LANGUAGE plpgsql;
+
+UPDATE products p SET variants = (
+    SELECT jsonb_agg(variant_weight(v) ORDER BY ord)
+    FROM jsonb_array_elements(p.variants) WITH ORDINALITY AS t(v, ord)
+)
+WHERE jsonb_typeof(p.variants) = 'array' AND jsonb_array_length(p.variants) > 0;
+
+UPDATE deleted_variants SET variant = variant_weight(variant);
+
+DROP FUNCTION variant_weight(JSONB);
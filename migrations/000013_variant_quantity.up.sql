@@ -0,0 +1,50 @@
+-- Replace the free-text variant "weight" with a structured quantity and unit.
+-- The weight, or the name when there is no weight, is parsed as a number followed by a unit;
+-- a bare number is grams. Anything else keeps its name and gets no quantity.
+-- The unit spellings match unitAliases in internal/models/quantity.go.
+
+CREATE OR REPLACE FUNCTION variant_quantity(v JSONB) RETURNS JSONB AS $$
+DECLARE
+    legacy TEXT;
+    m TEXT[];
+    unit TEXT;
+BEGIN
+    IF jsonb_typeof(v) <> 'object' THEN
+        RETURN v;
+    END IF;
+
+    legacy := COALESCE(NULLIF(v->>'weight', ''), v->>'name', '');
+    v := v - 'weight';
+    IF COALESCE(v->>'name', '') = '' AND legacy <> '' THEN
+        v := v || jsonb_build_object('name', legacy);
+    END IF;
+
+    m := regexp_match(lower(trim(legacy)), '^([0-9]+(\.[0-9]+)?)\s*([a-z]*)$');
+    IF m IS NULL THEN
+        RETURN v;
+    END IF;
+
+    unit := CASE
+        WHEN m[3] IN ('', 'g', 'gr', 'gram', 'grams') THEN 'g'
+        WHEN m[3] IN ('kg', 'kgs', 'kilo', 'kilos', 'kilogram', 'kilograms') THEN 'kg'
+        WHEN m[3] IN ('ml', 'millilitre', 'millilitres', 'milliliter', 'milliliters') THEN 'ml'
+        WHEN m[3] IN ('pc', 'pcs', 'piece', 'pieces') THEN 'piece'
+    END;
+    IF unit IS NULL THEN
+        RETURN v;
+    END IF;
+
+    RETURN v || jsonb_build_object('quantity', m[1]::numeric, 'unit', unit);
+END;
+$$ LANGUAGE plpgsql;
+
+UPDATE products p SET variants = (
+    SELECT jsonb_agg(variant_quantity(v) ORDER BY ord)
+    FROM jsonb_array_elements(p.variants) WITH ORDINALITY AS t(v, ord)
+)
+WHERE jsonb_typeof(p.variants) = 'array' AND jsonb_array_length(p.variants) > 0;
+
+-- Deleted variants are restored as they were saved, so convert them too
+UPDATE deleted_variants SET variant = variant_quantity(variant);
+
+DROP FUNCTION variant_quantity(JSONB);
@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS availability_changes;
+
+ALTER TABLE products DROP COLUMN IF EXISTS auto_availability;
@@ -0,0 +1,17 @@
+-- Variants can be marked unavailable automatically when they sell out.
+-- auto_availability is the product's own setting; empty follows STOCK_AUTO_AVAILABILITY.
+
+ALTER TABLE products ADD COLUMN IF NOT EXISTS auto_availability VARCHAR(10) NOT NULL DEFAULT '';
+
+-- Audit trail of availability flips made by stock adjustments
+CREATE TABLE IF NOT EXISTS availability_changes (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    product_id UUID NOT NULL REFERENCES products(id) ON DELETE CASCADE,
+    variant_id VARCHAR(255) NOT NULL,
+    is_available BOOLEAN NOT NULL,
+    reason VARCHAR(20) NOT NULL,
+    actor VARCHAR(255) NOT NULL DEFAULT '',
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_availability_changes_variant ON availability_changes(product_id, variant_id, created_at DESC);
@@ -0,0 +1,3 @@
+ALTER TABLE products DROP COLUMN IF EXISTS expected_at;
+ALTER TABLE products DROP COLUMN IF EXISTS preorder;
+ALTER TABLE products DROP COLUMN IF EXISTS backorder;
@@ -0,0 +1,6 @@
+-- Backorder and preorder settings let out of stock products be sold deliberately.
+-- Variants keep the same settings as backorder, preorder and expected_at keys in their JSON.
+
+ALTER TABLE products ADD COLUMN IF NOT EXISTS backorder BOOLEAN NOT NULL DEFAULT FALSE;
+ALTER TABLE products ADD COLUMN IF NOT EXISTS preorder BOOLEAN NOT NULL DEFAULT FALSE;
+ALTER TABLE products ADD COLUMN IF NOT EXISTS expected_at DATE;
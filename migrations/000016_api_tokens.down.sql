@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS api_token_usage;
+DROP TABLE IF EXISTS api_tokens;
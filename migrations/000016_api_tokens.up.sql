@@ -0,0 +1,25 @@
+-- Bearer tokens for scripts and the storefront calling /api/v1 without an admin session.
+-- Only a SHA-256 hash of each token is stored; prefix is its first characters, for telling tokens apart.
+-- rate_limit is requests per minute and daily_quota requests per UTC day; 0 means unlimited.
+
+CREATE TABLE IF NOT EXISTS api_tokens (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    name VARCHAR(100) NOT NULL,
+    prefix VARCHAR(16) NOT NULL,
+    token_hash VARCHAR(64) NOT NULL UNIQUE,
+    rate_limit INTEGER NOT NULL DEFAULT 60 CHECK (rate_limit >= 0),
+    daily_quota INTEGER NOT NULL DEFAULT 10000 CHECK (daily_quota >= 0),
+    created_by VARCHAR(255) NOT NULL DEFAULT '',
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    last_used_at TIMESTAMP WITH TIME ZONE,
+    revoked_at TIMESTAMP WITH TIME ZONE
+);
+
+-- Requests per token per day, counting those turned away by a limit separately
+CREATE TABLE IF NOT EXISTS api_token_usage (
+    token_id UUID NOT NULL REFERENCES api_tokens(id) ON DELETE CASCADE,
+    day DATE NOT NULL,
+    requests INTEGER NOT NULL DEFAULT 0,
+    rejected INTEGER NOT NULL DEFAULT 0,
+    PRIMARY KEY (token_id, day)
+);
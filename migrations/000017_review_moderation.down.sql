@@ -0,0 +1,6 @@
+DROP INDEX IF EXISTS idx_reviews_pending;
+
+ALTER TABLE reviews DROP COLUMN IF EXISTS api_token_id;
+ALTER TABLE reviews DROP COLUMN IF EXISTS moderated_at;
+ALTER TABLE reviews DROP COLUMN IF EXISTS moderated_by;
+ALTER TABLE reviews DROP COLUMN IF EXISTS status;
@@ -0,0 +1,11 @@
+-- Reviews submitted through the API wait in a moderation queue until an admin approves them.
+-- Existing reviews, and those added in the admin, are approved.
+
+ALTER TABLE reviews ADD COLUMN IF NOT EXISTS status VARCHAR(20) NOT NULL DEFAULT 'approved'
+    CHECK (status IN ('pending', 'approved', 'rejected'));
+ALTER TABLE reviews ADD COLUMN IF NOT EXISTS moderated_by VARCHAR(255) NOT NULL DEFAULT '';
+ALTER TABLE reviews ADD COLUMN IF NOT EXISTS moderated_at TIMESTAMP WITH TIME ZONE;
+-- The API token the review was submitted with
+ALTER TABLE reviews ADD COLUMN IF NOT EXISTS api_token_id UUID REFERENCES api_tokens(id) ON DELETE SET NULL;
+
+CREATE INDEX IF NOT EXISTS idx_reviews_pending ON reviews(created_at) WHERE status = 'pending' AND deleted_at IS NULL;
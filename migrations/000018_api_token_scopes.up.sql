@@ -0,0 +1,5 @@
+-- What an API token may call: full tokens reach the whole API, catalog tokens only the
+-- read-only public catalog under /api/v1/catalog.
+
+ALTER TABLE api_tokens ADD COLUMN IF NOT EXISTS scope VARCHAR(20) NOT NULL DEFAULT 'full'
+    CHECK (scope IN ('full', 'catalog'));
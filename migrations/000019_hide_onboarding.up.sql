@@ -0,0 +1,3 @@
+-- Lets an admin put away the setup checklist on the dashboard
+
+ALTER TABLE admin_preferences ADD COLUMN IF NOT EXISTS hide_onboarding BOOLEAN NOT NULL DEFAULT FALSE;
@@ -0,0 +1,12 @@
+-- Store-wide settings edited under Settings → Store. The table only ever holds one row.
+-- preview_secret signs the links that show unpublished products on the storefront; it is
+-- filled in by the admin the first time it is needed.
+
+CREATE TABLE IF NOT EXISTS store_settings (
+    id BOOLEAN PRIMARY KEY DEFAULT TRUE CHECK (id),
+    storefront_url TEXT NOT NULL DEFAULT '',
+    preview_secret TEXT NOT NULL DEFAULT '',
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+INSERT INTO store_settings (id) VALUES (TRUE) ON CONFLICT (id) DO NOTHING;
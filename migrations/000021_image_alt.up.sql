@@ -0,0 +1,4 @@
+-- Alt text for product images, keyed by image URL. image_urls stays the ordered gallery, so
+-- reordering or removing an image keeps its description without a second list to keep in step.
+
+ALTER TABLE products ADD COLUMN IF NOT EXISTS image_alt JSONB NOT NULL DEFAULT '{}'::jsonb;
@@ -0,0 +1,20 @@
+-- Post-upload processing of product images. Each job runs its steps over one gallery image and,
+-- once done, swaps the processed copy in for image_url. Jobs left running by a stopped server
+-- are picked up again after a while.
+
+CREATE TABLE IF NOT EXISTS image_jobs (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    product_id UUID NOT NULL REFERENCES products(id) ON DELETE CASCADE,
+    image_url TEXT NOT NULL,
+    steps TEXT[] NOT NULL,
+    status VARCHAR(20) NOT NULL DEFAULT 'pending',
+    attempts INTEGER NOT NULL DEFAULT 0,
+    result_url TEXT NOT NULL DEFAULT '',
+    error TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    started_at TIMESTAMP WITH TIME ZONE,
+    finished_at TIMESTAMP WITH TIME ZONE
+);
+
+CREATE INDEX IF NOT EXISTS idx_image_jobs_status ON image_jobs(status, created_at);
+CREATE INDEX IF NOT EXISTS idx_image_jobs_product_id ON image_jobs(product_id, created_at DESC);
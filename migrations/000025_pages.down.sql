@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS page_revisions;
+DROP TABLE IF EXISTS pages;
@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS webhook_events;
+DROP TABLE IF EXISTS experiment_assignments;
+DROP TABLE IF EXISTS experiments;
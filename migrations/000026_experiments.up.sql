@@ -0,0 +1,39 @@
+-- A/B experiments on a product's price or description. traffic_split is the percentage of
+-- storefront sessions shown the variant; the rest see the product as it is. A product runs at
+-- most one experiment at a time.
+
+CREATE TABLE IF NOT EXISTS experiments (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    product_id UUID NOT NULL REFERENCES products(id) ON DELETE CASCADE,
+    name VARCHAR(100) NOT NULL,
+    variant_price NUMERIC(10, 2),
+    variant_description TEXT,
+    traffic_split INTEGER NOT NULL DEFAULT 50 CHECK (traffic_split BETWEEN 1 AND 99),
+    status VARCHAR(20) NOT NULL DEFAULT 'draft',
+    started_at TIMESTAMP WITH TIME ZONE,
+    ended_at TIMESTAMP WITH TIME ZONE,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    CHECK (variant_price IS NOT NULL OR variant_description IS NOT NULL)
+);
+
+CREATE INDEX IF NOT EXISTS idx_experiments_product_id ON experiments(product_id, created_at DESC);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_experiments_running ON experiments(product_id) WHERE status = 'running';
+
+-- Which arm each storefront session was put in, and the conversions reported for it
+CREATE TABLE IF NOT EXISTS experiment_assignments (
+    experiment_id UUID NOT NULL REFERENCES experiments(id) ON DELETE CASCADE,
+    session_id VARCHAR(255) NOT NULL,
+    arm VARCHAR(10) NOT NULL,
+    assigned_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    conversions INTEGER NOT NULL DEFAULT 0,
+    revenue NUMERIC(12, 2) NOT NULL DEFAULT 0,
+    converted_at TIMESTAMP WITH TIME ZONE,
+    PRIMARY KEY (experiment_id, session_id)
+);
+
+-- Inbound webhook events already handled, so a delivery the sender retries isn't counted twice
+CREATE TABLE IF NOT EXISTS webhook_events (
+    id VARCHAR(255) PRIMARY KEY,
+    type VARCHAR(100) NOT NULL,
+    received_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
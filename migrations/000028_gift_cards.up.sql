@@ -0,0 +1,32 @@
+-- Gift cards and store credit. Every change to a card's balance is kept in
+-- gift_card_transactions: its issue, admin adjustments and redemptions at checkout.
+
+CREATE TABLE IF NOT EXISTS gift_cards (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    code VARCHAR(32) NOT NULL UNIQUE,
+    initial_balance NUMERIC(10, 2) NOT NULL CHECK (initial_balance > 0),
+    balance NUMERIC(10, 2) NOT NULL CHECK (balance >= 0),
+    expires_at TIMESTAMP WITH TIME ZONE,
+    note TEXT NOT NULL DEFAULT '',
+    created_by VARCHAR(100) NOT NULL DEFAULT '',
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+-- amount is signed: positive adds to the balance, negative takes from it. reference is the
+-- storefront's order for redemptions; a retried redemption for the same order isn't charged twice.
+CREATE TABLE IF NOT EXISTS gift_card_transactions (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    gift_card_id UUID NOT NULL REFERENCES gift_cards(id) ON DELETE CASCADE,
+    kind VARCHAR(20) NOT NULL,
+    amount NUMERIC(10, 2) NOT NULL,
+    balance_after NUMERIC(10, 2) NOT NULL,
+    reason TEXT NOT NULL DEFAULT '',
+    reference VARCHAR(100) NOT NULL DEFAULT '',
+    created_by VARCHAR(100) NOT NULL DEFAULT '',
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_gift_card_transactions_card ON gift_card_transactions(gift_card_id, created_at DESC);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_gift_card_transactions_redeem_ref
+    ON gift_card_transactions(gift_card_id, reference) WHERE kind = 'redeem';
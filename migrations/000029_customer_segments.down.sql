@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS storefront_orders;
+DROP TABLE IF EXISTS customer_segments;
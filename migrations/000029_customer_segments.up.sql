@@ -0,0 +1,23 @@
+-- Customer segments pick out storefront shoppers, tracked as sessions, by what they have done:
+-- when they were last seen, the reviews they wrote and the orders they placed. rules holds the
+-- conditions, all of which a shopper must meet.
+
+CREATE TABLE IF NOT EXISTS customer_segments (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    name VARCHAR(100) NOT NULL UNIQUE,
+    description TEXT NOT NULL DEFAULT '',
+    rules JSONB NOT NULL DEFAULT '{}'::jsonb,
+    created_by VARCHAR(255) NOT NULL DEFAULT '',
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Orders the storefront reports through its webhook, keyed by the storefront's order ID
+CREATE TABLE IF NOT EXISTS storefront_orders (
+    id VARCHAR(255) PRIMARY KEY,
+    session_id UUID NOT NULL REFERENCES sessions(id) ON DELETE CASCADE,
+    total NUMERIC(12, 2) NOT NULL CHECK (total >= 0),
+    placed_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_storefront_orders_session_id ON storefront_orders(session_id, placed_at);
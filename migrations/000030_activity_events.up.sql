@@ -0,0 +1,15 @@
+-- What admins did to products, categories and reviews, newest first on each one's timeline.
+-- Stock movements and availability changes keep their own ledgers and are merged in when a
+-- timeline is shown.
+
+CREATE TABLE IF NOT EXISTS activity_events (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    entity_type VARCHAR(20) NOT NULL,
+    entity_id VARCHAR(255) NOT NULL,
+    action VARCHAR(30) NOT NULL,
+    summary TEXT NOT NULL DEFAULT '',
+    actor VARCHAR(255) NOT NULL DEFAULT '',
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_activity_events_entity ON activity_events(entity_type, entity_id, created_at DESC);
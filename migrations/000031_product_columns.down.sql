@@ -0,0 +1,3 @@
+ALTER TABLE admin_preferences DROP COLUMN IF EXISTS product_columns;
+ALTER TABLE products DROP COLUMN IF EXISTS cost;
+ALTER TABLE products DROP COLUMN IF EXISTS sku;
@@ -0,0 +1,7 @@
+-- SKUs and unit costs on products, and the columns each admin shows on the product list
+
+ALTER TABLE products ADD COLUMN IF NOT EXISTS sku VARCHAR(100) NOT NULL DEFAULT '';
+ALTER TABLE products ADD COLUMN IF NOT EXISTS cost NUMERIC(10, 2) CHECK (cost >= 0);
+
+ALTER TABLE admin_preferences
+    ADD COLUMN IF NOT EXISTS product_columns TEXT[] NOT NULL DEFAULT '{category,variants}';
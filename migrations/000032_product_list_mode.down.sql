@@ -0,0 +1 @@
+ALTER TABLE admin_preferences DROP COLUMN IF EXISTS product_list_mode;
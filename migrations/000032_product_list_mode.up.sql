@@ -0,0 +1,3 @@
+-- Lets an admin scroll through the product list instead of paging through it
+
+ALTER TABLE admin_preferences ADD COLUMN IF NOT EXISTS product_list_mode VARCHAR(20) NOT NULL DEFAULT 'pages';
@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS idx_activity_events_created;
+ALTER TABLE admin_preferences DROP COLUMN IF EXISTS digest_sent_at;
+ALTER TABLE admin_preferences DROP COLUMN IF EXISTS digest_email;
+ALTER TABLE admin_preferences DROP COLUMN IF EXISTS digest_frequency;
@@ -0,0 +1,7 @@
+-- Lets each admin have a summary of catalog changes emailed to them daily or weekly
+
+ALTER TABLE admin_preferences ADD COLUMN IF NOT EXISTS digest_frequency VARCHAR(10) NOT NULL DEFAULT 'off';
+ALTER TABLE admin_preferences ADD COLUMN IF NOT EXISTS digest_email VARCHAR(255) NOT NULL DEFAULT '';
+ALTER TABLE admin_preferences ADD COLUMN IF NOT EXISTS digest_sent_at TIMESTAMP WITH TIME ZONE;
+
+CREATE INDEX IF NOT EXISTS idx_activity_events_created ON activity_events(created_at);
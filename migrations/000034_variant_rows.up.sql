@@ -0,0 +1,23 @@
+-- The new home of product variants: one row each instead of an element of products.variants.
+-- While VARIANT_STORAGE is "dual" or "table" every write to the JSONB is copied here, so the
+-- two can be compared and reads moved over, and moved back, without downtime. The JSONB stays
+-- the source the rows are rebuilt from until it is dropped.
+
+CREATE TABLE IF NOT EXISTS product_variants (
+    product_id UUID NOT NULL REFERENCES products(id) ON DELETE CASCADE,
+    position INTEGER NOT NULL,
+    variant_id VARCHAR(255) NOT NULL,
+    name TEXT NOT NULL DEFAULT '',
+    price NUMERIC(10,2) NOT NULL DEFAULT 0,
+    stock_count INTEGER NOT NULL DEFAULT 0,
+    is_available BOOLEAN NOT NULL DEFAULT FALSE,
+    quantity NUMERIC,
+    unit VARCHAR(20) NOT NULL DEFAULT '',
+    backorder BOOLEAN NOT NULL DEFAULT FALSE,
+    preorder BOOLEAN NOT NULL DEFAULT FALSE,
+    expected_at TIMESTAMP WITH TIME ZONE,
+    synced_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (product_id, position)
+);
+
+CREATE INDEX IF NOT EXISTS idx_product_variants_variant ON product_variants(variant_id);
@@ -0,0 +1,18 @@
+-- Home page counts and totals, worked out by a scheduled job so the dashboard reads one row
+-- however large the tables grow. refreshed_at is NULL until the first refresh.
+
+CREATE TABLE IF NOT EXISTS dashboard_stats (
+    id BOOLEAN PRIMARY KEY DEFAULT TRUE CHECK (id),
+    categories INTEGER NOT NULL DEFAULT 0,
+    products INTEGER NOT NULL DEFAULT 0,
+    variants INTEGER NOT NULL DEFAULT 0,
+    reviews INTEGER NOT NULL DEFAULT 0,
+    average_rating NUMERIC(3, 2),
+    sessions INTEGER NOT NULL DEFAULT 0,
+    active_sessions INTEGER NOT NULL DEFAULT 0,
+    orders INTEGER NOT NULL DEFAULT 0,
+    revenue NUMERIC(14, 2) NOT NULL DEFAULT 0,
+    refreshed_at TIMESTAMP WITH TIME ZONE
+);
+
+INSERT INTO dashboard_stats (id) VALUES (TRUE) ON CONFLICT (id) DO NOTHING;
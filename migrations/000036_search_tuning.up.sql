@@ -0,0 +1,17 @@
+-- Admin-managed tuning of product search. A synonym group is a set of terms that match each
+-- other, e.g. {og, original}: searching for any of them finds products mentioning any. Stop
+-- words are left out of searches.
+
+CREATE TABLE IF NOT EXISTS search_synonyms (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    terms TEXT[] NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS search_stop_words (
+    word VARCHAR(50) PRIMARY KEY
+);
+
+INSERT INTO search_stop_words (word) VALUES
+    ('a'), ('an'), ('and'), ('the'), ('of'), ('for'), ('with')
+ON CONFLICT (word) DO NOTHING;
@@ -0,0 +1,14 @@
+-- Searches made in the admin and on the storefront, with how many results they found and the
+-- product opened from them, for the search report. term is lower-cased with its whitespace
+-- collapsed, so the same search groups together.
+
+CREATE TABLE IF NOT EXISTS search_queries (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    source VARCHAR(20) NOT NULL CHECK (source IN ('admin', 'storefront')),
+    term TEXT NOT NULL,
+    result_count INTEGER NOT NULL CHECK (result_count >= 0),
+    clicked_product_id UUID REFERENCES products(id) ON DELETE SET NULL,
+    searched_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_search_queries_searched_at ON search_queries(searched_at);
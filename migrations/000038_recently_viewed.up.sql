@@ -0,0 +1,12 @@
+-- The products and categories each admin opened last, for the dashboard and the command
+-- palette. Only the latest few per admin are kept.
+
+CREATE TABLE IF NOT EXISTS recently_viewed (
+    username VARCHAR(255) NOT NULL,
+    entity_type VARCHAR(20) NOT NULL CHECK (entity_type IN ('product', 'category')),
+    entity_id UUID NOT NULL,
+    viewed_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (username, entity_type, entity_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_recently_viewed_username ON recently_viewed(username, viewed_at DESC);
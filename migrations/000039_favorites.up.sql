@@ -0,0 +1,10 @@
+-- Products and categories an admin has starred, for the product list's favorites filter and
+-- the dashboard's shortcuts
+
+CREATE TABLE IF NOT EXISTS favorites (
+    username VARCHAR(255) NOT NULL,
+    entity_type VARCHAR(20) NOT NULL CHECK (entity_type IN ('product', 'category')),
+    entity_id UUID NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (username, entity_type, entity_id)
+);
@@ -0,0 +1,12 @@
+-- Image host moves: each rewrite of product image URLs from one prefix to another, who ran it
+-- and how much it changed, so a move can be traced or reversed later
+
+CREATE TABLE IF NOT EXISTS image_url_migrations (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    old_prefix TEXT NOT NULL,
+    new_prefix TEXT NOT NULL,
+    products INTEGER NOT NULL DEFAULT 0,
+    urls INTEGER NOT NULL DEFAULT 0,
+    actor VARCHAR(255) NOT NULL DEFAULT '',
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
@@ -0,0 +1,17 @@
+-- Headers the image proxy sends when fetching from a protected image host. A profile for a host
+-- also covers its subdomains; '*' applies to every host without a profile of its own, and starts
+-- out with the Referer the proxy used to send everywhere.
+
+CREATE TABLE IF NOT EXISTS image_proxy_profiles (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    host VARCHAR(255) NOT NULL UNIQUE,
+    referer TEXT NOT NULL DEFAULT '',
+    user_agent TEXT NOT NULL DEFAULT '',
+    auth_header VARCHAR(100) NOT NULL DEFAULT '',
+    auth_value TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+INSERT INTO image_proxy_profiles (host, referer) VALUES ('*', 'https://pixshelf.perigrine.cloud')
+ON CONFLICT (host) DO NOTHING;
@@ -0,0 +1,14 @@
+-- Which admins have the dashboard open and which record each is on, from a heartbeat every
+-- open page sends. A row is one admin on one record, or on no record in particular with an
+-- empty entity; rows that stop being refreshed go stale and are cleared out.
+
+CREATE TABLE IF NOT EXISTS admin_presence (
+    username VARCHAR(255) NOT NULL,
+    entity_type VARCHAR(20) NOT NULL DEFAULT '' CHECK (entity_type IN ('', 'product', 'category')),
+    entity_id TEXT NOT NULL DEFAULT '',
+    editing BOOLEAN NOT NULL DEFAULT FALSE,
+    seen_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (username, entity_type, entity_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_admin_presence_seen_at ON admin_presence(seen_at);
@@ -0,0 +1,14 @@
+-- Database backups as reported by whatever takes them (a pg_dump cron, the hosting provider's
+-- snapshots), so bulk deletes and merges can check there's a recent one to restore from
+
+CREATE TABLE IF NOT EXISTS backup_runs (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    status VARCHAR(20) NOT NULL CHECK (status IN ('succeeded', 'failed')),
+    source VARCHAR(255) NOT NULL DEFAULT '',
+    note TEXT NOT NULL DEFAULT '',
+    finished_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    recorded_by VARCHAR(255) NOT NULL DEFAULT '',
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_backup_runs_finished_at ON backup_runs(finished_at DESC);
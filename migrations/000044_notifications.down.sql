@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS idx_activity_events_action;
+ALTER TABLE activity_events DROP COLUMN IF EXISTS price_drop;
+ALTER TABLE admin_preferences DROP COLUMN IF EXISTS notifications_seen_at;
+DROP TABLE IF EXISTS notifications;
@@ -0,0 +1,23 @@
+-- The notification center: alerts raised for every admin, such as unusual bursts of deletions,
+-- price drops or reviews. Each admin's notifications_seen_at marks what they've already read.
+-- price_drop on activity_events is how far a price_changed event cut the price, as a
+-- percentage of the old one, so bursts of deep cuts can be counted.
+
+CREATE TABLE IF NOT EXISTS notifications (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    kind VARCHAR(30) NOT NULL,
+    dedupe_key VARCHAR(255) NOT NULL DEFAULT '',
+    title VARCHAR(255) NOT NULL,
+    body TEXT NOT NULL DEFAULT '',
+    link TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_notifications_created_at ON notifications(created_at DESC);
+CREATE INDEX IF NOT EXISTS idx_notifications_dedupe_key ON notifications(dedupe_key, created_at DESC);
+
+ALTER TABLE admin_preferences ADD COLUMN IF NOT EXISTS notifications_seen_at TIMESTAMP WITH TIME ZONE;
+
+ALTER TABLE activity_events ADD COLUMN IF NOT EXISTS price_drop NUMERIC(5,2) NOT NULL DEFAULT 0;
+
+CREATE INDEX IF NOT EXISTS idx_activity_events_action ON activity_events(action, created_at DESC);
@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS idx_storefront_orders_placed_at;
+DROP TABLE IF EXISTS storefront_order_items;
@@ -0,0 +1,19 @@
+-- The lines of the orders the storefront reports, for the profitability report. unit_cost is
+-- what one unit cost the store when the order came in, from the event or else the product's
+-- cost at the time, so later cost changes don't rewrite past margins; NULL when unknown.
+-- product_name keeps the name for products since purged from the trash.
+
+CREATE TABLE IF NOT EXISTS storefront_order_items (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    order_id VARCHAR(255) NOT NULL REFERENCES storefront_orders(id) ON DELETE CASCADE,
+    product_id UUID NOT NULL,
+    product_name VARCHAR(255) NOT NULL DEFAULT '',
+    variant_id VARCHAR(255) NOT NULL DEFAULT '',
+    quantity INTEGER NOT NULL CHECK (quantity > 0),
+    unit_price NUMERIC(12, 2) NOT NULL CHECK (unit_price >= 0),
+    unit_cost NUMERIC(12, 2) CHECK (unit_cost >= 0)
+);
+
+CREATE INDEX IF NOT EXISTS idx_storefront_order_items_order_id ON storefront_order_items(order_id);
+CREATE INDEX IF NOT EXISTS idx_storefront_order_items_product_id ON storefront_order_items(product_id);
+CREATE INDEX IF NOT EXISTS idx_storefront_orders_placed_at ON storefront_orders(placed_at);
@@ -0,0 +1,21 @@
+-- Product views reported by the storefront. Each storefront session counts once per product per
+-- window (product_view_sessions remembers when it last did), and counted views are summed by
+-- UTC day, which is all the reports read. Sessions are purged once their window has passed.
+
+CREATE TABLE IF NOT EXISTS product_view_sessions (
+    product_id UUID NOT NULL REFERENCES products(id) ON DELETE CASCADE,
+    session_token VARCHAR(128) NOT NULL,
+    counted_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    PRIMARY KEY (product_id, session_token)
+);
+
+CREATE INDEX IF NOT EXISTS idx_product_view_sessions_counted_at ON product_view_sessions(counted_at);
+
+CREATE TABLE IF NOT EXISTS product_views_daily (
+    product_id UUID NOT NULL REFERENCES products(id) ON DELETE CASCADE,
+    day DATE NOT NULL,
+    views INTEGER NOT NULL DEFAULT 0,
+    PRIMARY KEY (product_id, day)
+);
+
+CREATE INDEX IF NOT EXISTS idx_product_views_daily_day ON product_views_daily(day);
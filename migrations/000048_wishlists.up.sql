@@ -0,0 +1,13 @@
+-- Products shoppers have saved to their storefront wishlists, reported by the storefront's
+-- wishlist.added and wishlist.removed webhooks. variant_id is empty when the shopper saved the
+-- product rather than one of its variants.
+
+CREATE TABLE IF NOT EXISTS wishlist_items (
+    session_id UUID NOT NULL REFERENCES sessions(id) ON DELETE CASCADE,
+    product_id UUID NOT NULL REFERENCES products(id) ON DELETE CASCADE,
+    variant_id VARCHAR(255) NOT NULL DEFAULT '',
+    added_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (session_id, product_id, variant_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_wishlist_items_product ON wishlist_items(product_id, variant_id);
@@ -0,0 +1,3 @@
+ALTER TABLE sessions DROP COLUMN IF EXISTS banned_by;
+ALTER TABLE sessions DROP COLUMN IF EXISTS banned_at;
+DROP TABLE IF EXISTS review_reports;
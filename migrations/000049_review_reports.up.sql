@@ -0,0 +1,21 @@
+-- Shoppers reporting reviews as abusive from the storefront, and the sessions admins ban for
+-- it. A session reports a review at most once. Reports stay after they're handled, with what
+-- was done, so the queue's history shows who dealt with what and how quickly.
+
+CREATE TABLE IF NOT EXISTS review_reports (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    review_id UUID NOT NULL REFERENCES reviews(id) ON DELETE CASCADE,
+    session_id UUID REFERENCES sessions(id) ON DELETE SET NULL,
+    reason VARCHAR(32) NOT NULL,
+    note TEXT NOT NULL DEFAULT '',
+    resolution VARCHAR(32) NOT NULL DEFAULT '',
+    resolved_by VARCHAR(255) NOT NULL DEFAULT '',
+    resolved_at TIMESTAMP WITH TIME ZONE,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (review_id, session_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_review_reports_open ON review_reports(created_at) WHERE resolved_at IS NULL;
+
+ALTER TABLE sessions ADD COLUMN IF NOT EXISTS banned_at TIMESTAMP WITH TIME ZONE;
+ALTER TABLE sessions ADD COLUMN IF NOT EXISTS banned_by VARCHAR(255) NOT NULL DEFAULT '';
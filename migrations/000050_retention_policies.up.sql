@@ -0,0 +1,14 @@
+-- How long personal data and history are kept, one row per rule the retention job enforces
+-- (sessions, reviews, activity). days is zero for a rule that keeps everything; a rule without
+-- a row is off. last_run_* record what the job did the last time it applied the rule.
+
+CREATE TABLE IF NOT EXISTS retention_policies (
+    rule VARCHAR(20) PRIMARY KEY,
+    days INTEGER NOT NULL DEFAULT 0 CHECK (days >= 0),
+    updated_by VARCHAR(255) NOT NULL DEFAULT '',
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    last_run_at TIMESTAMP WITH TIME ZONE,
+    last_run_rows BIGINT NOT NULL DEFAULT 0
+);
+
+CREATE INDEX IF NOT EXISTS idx_reviews_created_at ON reviews(created_at);
@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS idx_orphaned_media_orphaned_at;
+DROP TABLE IF EXISTS orphaned_media;
@@ -0,0 +1,12 @@
+-- Uploaded images that may no longer be used: those of purged products and those taken out of a
+-- gallery. The media cleanup job deletes each one from storage once it has waited out the grace
+-- period, unless a product or banner has started using it again.
+
+CREATE TABLE IF NOT EXISTS orphaned_media (
+    url TEXT PRIMARY KEY,
+    orphaned_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    attempts INTEGER NOT NULL DEFAULT 0,
+    error TEXT NOT NULL DEFAULT ''
+);
+
+CREATE INDEX IF NOT EXISTS idx_orphaned_media_orphaned_at ON orphaned_media(orphaned_at);
@@ -0,0 +1,17 @@
+-- Tenants kept in schemas of their own, each picked by the subdomain the dashboard is opened on.
+-- Only the main schema's table is read; every migration, this one included, is also applied to
+-- each tenant schema, where the table stays empty. schema_version and migration_error record
+-- the last time the tenant's schema was migrated.
+
+CREATE TABLE IF NOT EXISTS tenants (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    slug VARCHAR(63) NOT NULL UNIQUE,
+    name VARCHAR(255) NOT NULL,
+    schema_name VARCHAR(63) NOT NULL UNIQUE,
+    enabled BOOLEAN NOT NULL DEFAULT TRUE,
+    schema_version BIGINT NOT NULL DEFAULT 0,
+    migration_error TEXT NOT NULL DEFAULT '',
+    migrated_at TIMESTAMP WITH TIME ZONE,
+    created_by VARCHAR(255) NOT NULL DEFAULT '',
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
@@ -0,0 +1,10 @@
+DROP INDEX IF EXISTS idx_order_notifications_pending;
+DROP INDEX IF EXISTS idx_order_notifications_order_id;
+DROP TABLE IF EXISTS order_notifications;
+DROP TABLE IF EXISTS order_status_templates;
+DROP INDEX IF EXISTS idx_storefront_orders_status;
+ALTER TABLE storefront_orders
+    DROP COLUMN IF EXISTS customer_name,
+    DROP COLUMN IF EXISTS customer_email,
+    DROP COLUMN IF EXISTS status_changed_at,
+    DROP COLUMN IF EXISTS status;
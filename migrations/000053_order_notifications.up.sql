@@ -0,0 +1,60 @@
+-- Orders move through statuses as admins work on them, starting at placed when the storefront
+-- reports them. The customer's email and name come with order.placed, so the customer can be
+-- told when the status changes.
+
+ALTER TABLE storefront_orders
+    ADD COLUMN IF NOT EXISTS status VARCHAR(20) NOT NULL DEFAULT 'placed'
+        CHECK (status IN ('placed', 'processing', 'shipped', 'delivered', 'cancelled', 'refunded')),
+    ADD COLUMN IF NOT EXISTS status_changed_at TIMESTAMP WITH TIME ZONE,
+    ADD COLUMN IF NOT EXISTS customer_email VARCHAR(255) NOT NULL DEFAULT '',
+    ADD COLUMN IF NOT EXISTS customer_name VARCHAR(255) NOT NULL DEFAULT '';
+
+CREATE INDEX IF NOT EXISTS idx_storefront_orders_status ON storefront_orders(status, placed_at DESC);
+
+-- What the customer is sent when an order reaches each status: an email, an event to the
+-- storefront's notification endpoint, both or neither. subject and body are Go text templates.
+CREATE TABLE IF NOT EXISTS order_status_templates (
+    status VARCHAR(20) PRIMARY KEY,
+    send_email BOOLEAN NOT NULL DEFAULT false,
+    send_webhook BOOLEAN NOT NULL DEFAULT false,
+    subject VARCHAR(255) NOT NULL DEFAULT '',
+    body TEXT NOT NULL DEFAULT '',
+    updated_by VARCHAR(255) NOT NULL DEFAULT '',
+    updated_at TIMESTAMP WITH TIME ZONE
+);
+
+INSERT INTO order_status_templates (status, subject, body) VALUES
+    ('processing', 'We''re preparing order {{.OrderID}}',
+     E'Hi {{.CustomerName}},\n\nWe''ve started on your order {{.OrderID}} ({{.Total}}) and will let you know when it ships.'),
+    ('shipped', 'Order {{.OrderID}} is on its way',
+     E'Hi {{.CustomerName}},\n\nYour order {{.OrderID}} has shipped.'),
+    ('delivered', 'Order {{.OrderID}} was delivered',
+     E'Hi {{.CustomerName}},\n\nYour order {{.OrderID}} has been delivered. We hope you enjoy it.'),
+    ('cancelled', 'Order {{.OrderID}} was cancelled',
+     E'Hi {{.CustomerName}},\n\nYour order {{.OrderID}} has been cancelled. Reply to this email if that''s a surprise.'),
+    ('refunded', 'Order {{.OrderID}} was refunded',
+     E'Hi {{.CustomerName}},\n\nWe''ve refunded {{.Total}} for your order {{.OrderID}}.')
+ON CONFLICT (status) DO NOTHING;
+
+-- Every notification an order's status change queued, rendered when queued so the log shows
+-- what was sent. Pending ones are delivered by a job, which retries failures a few times.
+CREATE TABLE IF NOT EXISTS order_notifications (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    order_id VARCHAR(255) NOT NULL REFERENCES storefront_orders(id) ON DELETE CASCADE,
+    status VARCHAR(20) NOT NULL,
+    previous_status VARCHAR(20) NOT NULL DEFAULT '',
+    channel VARCHAR(10) NOT NULL CHECK (channel IN ('email', 'webhook')),
+    recipient VARCHAR(1000) NOT NULL DEFAULT '',
+    subject VARCHAR(255) NOT NULL DEFAULT '',
+    body TEXT NOT NULL DEFAULT '',
+    state VARCHAR(10) NOT NULL DEFAULT 'pending' CHECK (state IN ('pending', 'sent', 'failed', 'skipped')),
+    attempts INTEGER NOT NULL DEFAULT 0,
+    error TEXT NOT NULL DEFAULT '',
+    created_by VARCHAR(255) NOT NULL DEFAULT '',
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    next_attempt_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    sent_at TIMESTAMP WITH TIME ZONE
+);
+
+CREATE INDEX IF NOT EXISTS idx_order_notifications_order_id ON order_notifications(order_id, created_at DESC);
+CREATE INDEX IF NOT EXISTS idx_order_notifications_pending ON order_notifications(next_attempt_at) WHERE state = 'pending';
@@ -0,0 +1,9 @@
+DROP TABLE IF EXISTS pick_locations;
+UPDATE order_status_templates
+SET body = E'Hi {{.CustomerName}},\n\nYour order {{.OrderID}} has shipped.'
+WHERE status = 'shipped' AND updated_at IS NULL;
+ALTER TABLE storefront_orders
+    DROP COLUMN IF EXISTS tracking_number,
+    DROP COLUMN IF EXISTS carrier,
+    DROP COLUMN IF EXISTS packed_by,
+    DROP COLUMN IF EXISTS packed_at;
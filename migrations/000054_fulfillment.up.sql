@@ -0,0 +1,24 @@
+-- Packing an order ships it: who packed it, when, and the tracking number the carrier gave
+-- it, which the customer's shipped notification can include.
+
+ALTER TABLE storefront_orders
+    ADD COLUMN IF NOT EXISTS packed_at TIMESTAMP WITH TIME ZONE,
+    ADD COLUMN IF NOT EXISTS packed_by VARCHAR(255) NOT NULL DEFAULT '',
+    ADD COLUMN IF NOT EXISTS carrier VARCHAR(50) NOT NULL DEFAULT '',
+    ADD COLUMN IF NOT EXISTS tracking_number VARCHAR(100) NOT NULL DEFAULT '';
+
+-- The default shipped message gains the tracking number, unless an admin already changed it
+UPDATE order_status_templates
+SET body = E'Hi {{.CustomerName}},\n\nYour order {{.OrderID}} has shipped.{{if .TrackingNumber}} Its {{.Carrier}} tracking number is {{.TrackingNumber}}.{{end}}'
+WHERE status = 'shipped' AND updated_at IS NULL;
+
+-- Where a product, or one of its variants, is shelved, so pick lists can be walked in order.
+-- variant_id is empty for a product's own stock.
+CREATE TABLE IF NOT EXISTS pick_locations (
+    product_id UUID NOT NULL REFERENCES products(id) ON DELETE CASCADE,
+    variant_id VARCHAR(255) NOT NULL DEFAULT '',
+    location VARCHAR(50) NOT NULL,
+    updated_by VARCHAR(255) NOT NULL DEFAULT '',
+    updated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (product_id, variant_id)
+);
@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS shipping_labels;
+
+ALTER TABLE storefront_orders DROP COLUMN IF EXISTS shipping_address;
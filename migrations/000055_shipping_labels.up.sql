@@ -0,0 +1,29 @@
+-- Labels bought from the shipping provider for an order, with where the parcel has got to.
+-- The storefront sends the address an order ships to, which the labels are bought for.
+
+ALTER TABLE storefront_orders ADD COLUMN IF NOT EXISTS shipping_address JSONB;
+
+CREATE TABLE IF NOT EXISTS shipping_labels (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    order_id VARCHAR(255) NOT NULL REFERENCES storefront_orders(id) ON DELETE CASCADE,
+    provider VARCHAR(20) NOT NULL,
+    carrier VARCHAR(50) NOT NULL,
+    carrier_code VARCHAR(50) NOT NULL DEFAULT '',
+    service VARCHAR(100) NOT NULL DEFAULT '',
+    tracking_number VARCHAR(100) NOT NULL,
+    label_url TEXT NOT NULL DEFAULT '',
+    cost NUMERIC(12, 2),
+    currency VARCHAR(3) NOT NULL DEFAULT '',
+    shipment_id VARCHAR(255) NOT NULL DEFAULT '',
+    tracking_status VARCHAR(20) NOT NULL DEFAULT 'unknown',
+    tracking_detail TEXT NOT NULL DEFAULT '',
+    tracking_checked_at TIMESTAMP WITH TIME ZONE,
+    created_by VARCHAR(255) NOT NULL DEFAULT '',
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_shipping_labels_order ON shipping_labels(order_id, created_at DESC);
+
+-- The tracking job only reads parcels still moving, least recently checked first
+CREATE INDEX IF NOT EXISTS idx_shipping_labels_tracking ON shipping_labels(tracking_checked_at NULLS FIRST)
+    WHERE tracking_status NOT IN ('delivered', 'returned', 'failure');
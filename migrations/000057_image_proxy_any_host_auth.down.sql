@@ -0,0 +1,2 @@
+-- The removed auth values can't be restored
+SELECT 1;
@@ -0,0 +1,2 @@
+-- The profile for every other host no longer sends an auth header, so drop any it has
+UPDATE image_proxy_profiles SET auth_header = '', auth_value = '' WHERE host = '*';
@@ -0,0 +1,2 @@
+-- The redacted values can't be restored
+SELECT 1;
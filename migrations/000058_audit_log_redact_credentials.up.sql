@@ -0,0 +1,13 @@
+-- Redact credentials that were logged before the audit log knew their fields
+UPDATE audit_log
+SET changes = (
+    SELECT jsonb_agg(
+        CASE WHEN c->>'field' IN ('auth_value', 'admin_password', 'new_password', 'current_password',
+                                  'access_key', 'access_key_id', 'secret_access_key', 'service_key',
+                                  'service_role_key', 'private_key', 'credentials', 'passphrase')
+            THEN jsonb_build_object('field', c->'field', 'before', '"[redacted]"'::jsonb, 'after', '"[redacted]"'::jsonb)
+            ELSE c
+        END ORDER BY n)
+    FROM jsonb_array_elements(changes) WITH ORDINALITY AS e(c, n)
+)
+WHERE jsonb_array_length(changes) > 0;
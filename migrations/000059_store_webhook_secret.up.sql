@@ -0,0 +1,4 @@
+-- The secret a tenant's storefront signs its webhooks with, each tenant's schema holding its
+-- own. Filled in by the admin the first time it is needed; the main store signs with
+-- STOREFRONT_WEBHOOK_SECRET instead.
+ALTER TABLE store_settings ADD COLUMN IF NOT EXISTS webhook_secret TEXT NOT NULL DEFAULT '';
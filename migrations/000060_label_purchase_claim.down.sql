@@ -0,0 +1 @@
+ALTER TABLE storefront_orders DROP COLUMN IF EXISTS label_purchase_started_at;
@@ -0,0 +1,3 @@
+-- When a label purchase for the order started, so a second click can't buy another while the
+-- first is still with the shipping provider. Cleared once the label is recorded.
+ALTER TABLE storefront_orders ADD COLUMN IF NOT EXISTS label_purchase_started_at TIMESTAMP WITH TIME ZONE;
@@ -0,0 +1,5 @@
+-- Storefront tokens fall back to the catalog scope rather than gaining full access
+UPDATE api_tokens SET scope = 'catalog' WHERE scope = 'storefront';
+
+ALTER TABLE api_tokens DROP CONSTRAINT IF EXISTS api_tokens_scope_check;
+ALTER TABLE api_tokens ADD CONSTRAINT api_tokens_scope_check CHECK (scope IN ('full', 'catalog'));
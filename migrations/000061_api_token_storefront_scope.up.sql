@@ -0,0 +1,5 @@
+-- Storefront tokens read the catalog like catalog tokens and also make the writes shoppers
+-- cause: reviews, review reports and gift card checks, without a full token's admin access.
+
+ALTER TABLE api_tokens DROP CONSTRAINT IF EXISTS api_tokens_scope_check;
+ALTER TABLE api_tokens ADD CONSTRAINT api_tokens_scope_check CHECK (scope IN ('full', 'catalog', 'storefront'));
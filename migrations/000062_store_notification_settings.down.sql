@@ -0,0 +1,2 @@
+ALTER TABLE store_settings DROP COLUMN IF EXISTS mail_from;
+ALTER TABLE store_settings DROP COLUMN IF EXISTS notify_url;
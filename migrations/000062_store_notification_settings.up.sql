@@ -0,0 +1,4 @@
+-- Where a tenant's order notifications go: the endpoint its storefront takes events on and the
+-- sender of its customer emails. The main store uses STOREFRONT_NOTIFY_URL and MAIL_FROM.
+ALTER TABLE store_settings ADD COLUMN IF NOT EXISTS notify_url TEXT NOT NULL DEFAULT '';
+ALTER TABLE store_settings ADD COLUMN IF NOT EXISTS mail_from TEXT NOT NULL DEFAULT '';
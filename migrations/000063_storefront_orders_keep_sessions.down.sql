@@ -0,0 +1,3 @@
+ALTER TABLE storefront_orders DROP CONSTRAINT IF EXISTS storefront_orders_session_id_fkey;
+ALTER TABLE storefront_orders ADD CONSTRAINT storefront_orders_session_id_fkey
+    FOREIGN KEY (session_id) REFERENCES sessions(id) ON DELETE CASCADE;
@@ -0,0 +1,5 @@
+-- Deleting a shopper's session used to delete their orders with it, and their line items,
+-- notifications and shipping labels after them. A session with orders now can't be deleted.
+ALTER TABLE storefront_orders DROP CONSTRAINT IF EXISTS storefront_orders_session_id_fkey;
+ALTER TABLE storefront_orders ADD CONSTRAINT storefront_orders_session_id_fkey
+    FOREIGN KEY (session_id) REFERENCES sessions(id) ON DELETE RESTRICT;
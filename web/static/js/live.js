@@ -0,0 +1,108 @@
+// Live updates: changes other admins make arrive from /live as server-sent events. The product
+// list refreshes in place, and a product or category page says who just changed the record.
+// Pages also send a presence heartbeat (presenceWidget in the layout) with the record they show.
+(function () {
+  // presenceValues is what the presence heartbeat sends: the record the page shows, if any
+  window.presenceValues = function () {
+    const page = document.querySelector('[data-live-entity]');
+    if (!page) {
+      return {};
+    }
+    return {
+      entity_type: page.dataset.liveEntity,
+      entity_id: page.dataset.liveId,
+      editing: page.hasAttribute('data-live-editing') ? '1' : ''
+    };
+  };
+
+  if (!window.EventSource) {
+    return;
+  }
+
+  let refreshTimer = null;
+
+  // showBanner puts a notice at the top of the page, replacing any earlier one
+  function showBanner(text, action) {
+    let banner = document.getElementById('live-banner');
+    if (!banner) {
+      banner = document.createElement('div');
+      banner.id = 'live-banner';
+      banner.className = 'fixed top-0 inset-x-0 z-50 flex items-center justify-center gap-4 bg-amber-500 px-4 py-2 text-sm font-medium text-gray-900 shadow';
+      document.body.appendChild(banner);
+    }
+    banner.replaceChildren();
+
+    const message = document.createElement('span');
+    message.textContent = text;
+    banner.appendChild(message);
+
+    const reload = document.createElement('button');
+    reload.type = 'button';
+    reload.className = 'rounded bg-gray-900 px-2 py-1 text-xs font-semibold text-white hover:bg-gray-700';
+    reload.textContent = action;
+    reload.addEventListener('click', function () { window.location.reload(); });
+    banner.appendChild(reload);
+
+    const dismiss = document.createElement('button');
+    dismiss.type = 'button';
+    dismiss.className = 'text-gray-900 hover:text-gray-700';
+    dismiss.setAttribute('aria-label', 'Dismiss');
+    dismiss.textContent = '×';
+    dismiss.addEventListener('click', function () { banner.remove(); });
+    banner.appendChild(dismiss);
+  }
+
+  // who names the admin behind a change
+  function who(change) {
+    return change.actor || 'an automated job';
+  }
+
+  // refreshProductList reloads the list's results in place, a moment after the last change so
+  // a bulk edit only refreshes once. With products selected it asks first instead, so the
+  // selection isn't lost.
+  function refreshProductList(change) {
+    clearTimeout(refreshTimer);
+    refreshTimer = setTimeout(function () {
+      if (!document.getElementById('product-results')) {
+        return;
+      }
+      if (document.querySelector('input[form=compare-form]:checked') || typeof htmx === 'undefined') {
+        showBanner('Products were changed by ' + who(change) + ' just now.', 'Refresh');
+        return;
+      }
+      htmx.ajax('GET', window.location.pathname + window.location.search, {
+        target: '#product-results',
+        select: '#product-results',
+        swap: 'outerHTML'
+      });
+    }, 1000);
+  }
+
+  const source = new EventSource('/live');
+  source.addEventListener('change', function (message) {
+    let change;
+    try {
+      change = JSON.parse(message.data);
+    } catch (err) {
+      return;
+    }
+
+    // Pages showing one record mark it with data-live-entity and data-live-id
+    const page = document.querySelector('[data-live-entity]');
+    if (page && page.dataset.liveEntity === change.entity_type && page.dataset.liveId === change.entity_id) {
+      let text = (change.action === 'deleted' ? 'Deleted' : 'Edited') + ' by ' + who(change) + ' just now';
+      if (change.summary) {
+        text += ': ' + change.summary;
+      }
+      if (page.hasAttribute('data-live-editing')) {
+        text += '. Saving this form would overwrite their changes.';
+      }
+      showBanner(text, 'Reload');
+      return;
+    }
+
+    if (change.entity_type === 'product') {
+      refreshProductList(change);
+    }
+  });
+})();